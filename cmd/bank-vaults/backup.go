@@ -0,0 +1,210 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/internal/backup"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const (
+	cfgBackupStorage           = "backup-storage"
+	cfgBackupStorageValueS3    = "s3"
+	cfgBackupStorageValueGCS   = "gcs"
+	cfgBackupStorageValueAzure = "azure"
+	cfgBackupStorageValueFile  = "file"
+
+	cfgBackupS3Region       = "backup-s3-region"
+	cfgBackupS3Bucket       = "backup-s3-bucket"
+	cfgBackupS3Prefix       = "backup-s3-prefix"
+	cfgBackupS3SSEAlgorithm = "backup-s3-sse-algorithm"
+	cfgBackupS3SSEKeyID     = "backup-s3-sse-key-id"
+
+	cfgBackupGCSBucket = "backup-gcs-bucket"
+	cfgBackupGCSPrefix = "backup-gcs-prefix"
+
+	cfgBackupAzureAccount    = "backup-azure-account"
+	cfgBackupAzureAccountKey = "backup-azure-account-key"
+	cfgBackupAzureContainer  = "backup-azure-container"
+	cfgBackupAzurePrefix     = "backup-azure-prefix"
+
+	cfgBackupFilePath = "backup-file-path"
+
+	cfgBackupEncryptionKey = "backup-encryption-key"
+
+	cfgBackupPeriod         = "backup-period"
+	cfgBackupRetentionCount = "backup-retention-count"
+	cfgBackupRetentionAge   = "backup-retention-age"
+)
+
+var backupStorageFlags = pflag.NewFlagSet("backup-storage", pflag.ExitOnError)
+
+func init() {
+	backupStorageFlags.String(cfgBackupStorage, cfgBackupStorageValueS3, "The storage of the snapshots: 's3', 'gcs', 'azure' or 'file'")
+
+	backupStorageFlags.String(cfgBackupS3Region, "", "The region of the AWS S3 bucket to store the snapshots in")
+	backupStorageFlags.String(cfgBackupS3Bucket, "", "The AWS S3 bucket to store the snapshots in")
+	backupStorageFlags.String(cfgBackupS3Prefix, "", "The prefix of the snapshots in the AWS S3 bucket")
+	backupStorageFlags.String(cfgBackupS3SSEAlgorithm, "", "The server side encryption algorithm of the AWS S3 bucket (AES256 or aws:kms)")
+	backupStorageFlags.String(cfgBackupS3SSEKeyID, "", "The KMS key ID of the server side encryption of the AWS S3 bucket (only with aws:kms)")
+
+	backupStorageFlags.String(cfgBackupGCSBucket, "", "The Google Cloud Storage bucket to store the snapshots in")
+	backupStorageFlags.String(cfgBackupGCSPrefix, "", "The prefix of the snapshots in the Google Cloud Storage bucket")
+
+	backupStorageFlags.String(cfgBackupAzureAccount, "", "The Azure Storage account to store the snapshots in")
+	backupStorageFlags.String(cfgBackupAzureAccountKey, "", "The shared key of the Azure Storage account")
+	backupStorageFlags.String(cfgBackupAzureContainer, "", "The Azure Blob Storage container to store the snapshots in")
+	backupStorageFlags.String(cfgBackupAzurePrefix, "", "The prefix of the snapshots in the Azure Blob Storage container")
+
+	backupStorageFlags.String(cfgBackupFilePath, "", "The directory to store the snapshots in")
+
+	backupStorageFlags.String(cfgBackupEncryptionKey, "", "The base64 encoded 32 byte AES key to encrypt the snapshots with")
+}
+
+// bindBackupStorageFlags binds the snapshot storage flags of the command
+func bindBackupStorageFlags(cmd *cobra.Command) {
+	backupStorageFlags.VisitAll(func(flag *pflag.Flag) {
+		appConfig.BindPFlag(flag.Name, cmd.PersistentFlags().Lookup(flag.Name)) // nolint
+	})
+}
+
+// backupStorageForConfig creates the storage of the snapshots
+func backupStorageForConfig(cfg *viper.Viper) (backup.Storage, error) {
+	switch storage := cfg.GetString(cfgBackupStorage); storage {
+	case cfgBackupStorageValueS3:
+		return backup.NewS3Storage(
+			cfg.GetString(cfgBackupS3Region),
+			cfg.GetString(cfgBackupS3Bucket),
+			cfg.GetString(cfgBackupS3Prefix),
+			cfg.GetString(cfgBackupS3SSEAlgorithm),
+			cfg.GetString(cfgBackupS3SSEKeyID),
+		)
+	case cfgBackupStorageValueGCS:
+		return backup.NewGCSStorage(cfg.GetString(cfgBackupGCSBucket), cfg.GetString(cfgBackupGCSPrefix))
+	case cfgBackupStorageValueAzure:
+		return backup.NewAzureStorage(
+			cfg.GetString(cfgBackupAzureAccount),
+			cfg.GetString(cfgBackupAzureAccountKey),
+			cfg.GetString(cfgBackupAzureContainer),
+			cfg.GetString(cfgBackupAzurePrefix),
+		)
+	case cfgBackupStorageValueFile:
+		return backup.NewFileStorage(cfg.GetString(cfgBackupFilePath))
+	default:
+		return nil, errors.Errorf("unsupported backup storage: '%s'", storage)
+	}
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Stores Raft snapshots of the target Vault instance in an object storage",
+	Long: `This command takes a snapshot of the Raft storage of the target Vault instance
+(sys/storage/raft/snapshot) with the root token from the key store (or VAULT_TOKEN)
+and uploads it to AWS S3, Google Cloud Storage, Azure Blob Storage or a local directory,
+optionally encrypted with an AES-256-GCM key.
+
+After every snapshot the snapshots which are not retained anymore by --backup-retention-count
+and --backup-retention-age are deleted, the latest snapshot is always kept.
+
+With --backup-period the snapshots are taken periodically, and the time and size of the
+last successful snapshot and the number of failures are exported as Prometheus metrics.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bindBackupStorageFlags(cmd)
+		appConfig.BindPFlag(cfgBackupPeriod, cmd.PersistentFlags().Lookup(cfgBackupPeriod))                 // nolint
+		appConfig.BindPFlag(cfgBackupRetentionCount, cmd.PersistentFlags().Lookup(cfgBackupRetentionCount)) // nolint
+		appConfig.BindPFlag(cfgBackupRetentionAge, cmd.PersistentFlags().Lookup(cfgBackupRetentionAge))     // nolint
+
+		period := appConfig.GetDuration(cfgBackupPeriod)
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		storage, err := backupStorageForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating backup storage: %s", err.Error())
+		}
+
+		manager, err := backup.NewManager(storage, appConfig.GetString(cfgBackupEncryptionKey), backup.Retention{
+			Count:  appConfig.GetInt(cfgBackupRetentionCount),
+			MaxAge: appConfig.GetDuration(cfgBackupRetentionAge),
+		})
+		if err != nil {
+			logrus.Fatalf("error creating backup manager: %s", err.Error())
+		}
+
+		if period == 0 {
+			if _, _, err := manager.Backup(context.Background(), v); err != nil {
+				logrus.Fatalf("error backing up vault: %s", err.Error())
+			}
+			return
+		}
+
+		metrics := prometheusExporter{Vault: v, Mode: "backup"}
+		go func() {
+			err := metrics.Run()
+			if err != nil {
+				logrus.Fatalf("error creating prometheus exporter: %s", err.Error())
+			}
+		}()
+
+		for {
+			snapshot, size, err := manager.Backup(context.Background(), v)
+			if err != nil {
+				logrus.Errorf("error backing up vault: %s", err.Error())
+				failedBackupsCount++
+			} else {
+				lastSuccessfulBackupTimestamp = float64(snapshot.Time.Unix())
+				lastSuccessfulBackupSize = float64(size)
+			}
+
+			time.Sleep(period)
+		}
+	},
+}
+
+func init() {
+	backupCmd.PersistentFlags().AddFlagSet(backupStorageFlags)
+	backupCmd.PersistentFlags().Duration(cfgBackupPeriod, 0, "How often to take snapshots (0 means only once)")
+	backupCmd.PersistentFlags().Int(cfgBackupRetentionCount, 0, "How many of the latest snapshots to keep (0 means no limit)")
+	backupCmd.PersistentFlags().Duration(cfgBackupRetentionAge, 0, "How long to keep the snapshots (0 means no limit)")
+
+	rootCmd.AddCommand(backupCmd)
+}
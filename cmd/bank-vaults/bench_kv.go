@@ -0,0 +1,245 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+const (
+	cfgBenchIterations  = "iterations"
+	cfgBenchConcurrency = "concurrency"
+	cfgBenchValueSize   = "value-size"
+	cfgBenchKeyPrefix   = "key-prefix"
+)
+
+// the unseal path reads this many keys with the default secret threshold
+const benchUnsealReads = 3
+
+type benchResult struct {
+	operation string
+	latencies []time.Duration
+	errors    int
+	elapsed   time.Duration
+}
+
+func (r *benchResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(float64(len(r.latencies)-1)*p)]
+}
+
+func (r *benchResult) throughput() float64 {
+	if r.elapsed == 0 {
+		return 0
+	}
+	return float64(len(r.latencies)) / r.elapsed.Seconds()
+}
+
+func (r *benchResult) errorRate() float64 {
+	total := len(r.latencies) + r.errors
+	if total == 0 {
+		return 0
+	}
+	return float64(r.errors) / float64(total)
+}
+
+// benchOperation runs op iterations times on each of concurrency workers in parallel
+func benchOperation(operation string, iterations, concurrency int, op func(worker int) error) *benchResult {
+	result := benchResult{operation: operation}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				opStart := time.Now()
+				err := op(worker)
+				latency := time.Since(opStart)
+
+				mu.Lock()
+				if err != nil {
+					logrus.Debugf("%s failed: %s", operation, err.Error())
+					result.errors++
+				} else {
+					result.latencies = append(result.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+
+	return &result
+}
+
+// roundUpDuration rounds d up to whole seconds, to at least one second
+func roundUpDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return time.Second
+	}
+	return (d + time.Second - 1).Truncate(time.Second)
+}
+
+// benchRecommendations derives settings from the measured set and get operations
+func benchRecommendations(set, get *benchResult) []string {
+	var recommendations []string
+
+	slowest := set.percentile(0.99)
+	if p99 := get.percentile(0.99); p99 > slowest {
+		slowest = p99
+	}
+
+	recommendations = append(recommendations,
+		fmt.Sprintf("request timeout: at least %s (3x the slowest p99 latency)", roundUpDuration(3*slowest)))
+
+	unsealRead := benchUnsealReads * get.percentile(0.99)
+	recommendations = append(recommendations,
+		fmt.Sprintf("--%s: at least %s (reading %d unseal keys at p99 takes %s)",
+			cfgUnsealPeriod, roundUpDuration(2*unsealRead), benchUnsealReads, unsealRead))
+
+	if set.errors+get.errors > 0 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("retries: %.1f%% of the set and %.1f%% of the get operations failed, retry with backoff or use the replicated mode with more backends",
+				100*set.errorRate(), 100*get.errorRate()))
+	} else {
+		recommendations = append(recommendations, "retries: no operation failed, the default retry settings are enough")
+	}
+
+	switch {
+	case len(get.latencies) == 0:
+		recommendations = append(recommendations, "unseal path: not suitable, every get operation failed")
+	case get.errors == 0 && unsealRead < time.Second:
+		recommendations = append(recommendations, "unseal path: suitable")
+	case get.errorRate() < 0.01 && unsealRead < 5*time.Second:
+		recommendations = append(recommendations, "unseal path: usable, but unsealing after a restart will be slower or retried")
+	default:
+		recommendations = append(recommendations, "unseal path: not recommended, consider a faster backend or the replicated mode")
+	}
+
+	return recommendations
+}
+
+var benchKVCmd = &cobra.Command{
+	Use:   "bench-kv",
+	Short: "Measures the latency and throughput of the configured key store",
+	Long: `This command writes and reads test keys in the key store configured with --mode,
+then prints the latency percentiles and throughput of the operations, and
+recommendations for timeouts, retries and the unseal period based on them.
+
+The test keys are written under --key-prefix with one key per concurrent worker,
+they are overwritten on every run but not removed since the key stores don't support deleting.
+Never point --key-prefix to the names of the Vault keys (vault-unseal-, vault-recovery-, vault-root).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgBenchIterations, cmd.PersistentFlags().Lookup(cfgBenchIterations))   // nolint
+		appConfig.BindPFlag(cfgBenchConcurrency, cmd.PersistentFlags().Lookup(cfgBenchConcurrency)) // nolint
+		appConfig.BindPFlag(cfgBenchValueSize, cmd.PersistentFlags().Lookup(cfgBenchValueSize))     // nolint
+		appConfig.BindPFlag(cfgBenchKeyPrefix, cmd.PersistentFlags().Lookup(cfgBenchKeyPrefix))     // nolint
+
+		iterations := appConfig.GetInt(cfgBenchIterations)
+		concurrency := appConfig.GetInt(cfgBenchConcurrency)
+		prefix := appConfig.GetString(cfgBenchKeyPrefix)
+
+		if iterations < 1 || concurrency < 1 {
+			logrus.Fatalf("--%s and --%s must be positive", cfgBenchIterations, cfgBenchConcurrency)
+		}
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		value := make([]byte, appConfig.GetInt(cfgBenchValueSize))
+		if _, err := rand.Read(value); err != nil {
+			logrus.Fatalf("error generating test value: %s", err.Error())
+		}
+
+		key := func(worker int) string { return fmt.Sprint(prefix, worker) }
+
+		logrus.Infof("running %d set and get operations on %d workers in %s mode",
+			iterations, concurrency, appConfig.GetString(cfgMode))
+
+		set := benchOperation("set", iterations, concurrency, func(worker int) error {
+			return store.Set(key(worker), value)
+		})
+
+		get := benchOperation("get", iterations, concurrency, func(worker int) error {
+			stored, err := store.Get(key(worker))
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(stored, value) {
+				return fmt.Errorf("value of key '%s' differs from the written one", key(worker)) // nolint:goerr113
+			}
+			return nil
+		})
+
+		results := []*benchResult{set, get}
+
+		if _, ok := store.(kv.Locker); ok {
+			results = append(results, benchOperation("lock", iterations, 1, func(int) error {
+				unlock, err := kv.Lock(store, prefix+"lock", time.Minute)
+				if err != nil {
+					return err
+				}
+				return unlock()
+			}))
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OPERATION\tOK\tERRORS\tMIN\tP50\tP95\tP99\tMAX\tOPS/S")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%.1f\n",
+				r.operation, len(r.latencies), r.errors,
+				r.percentile(0), r.percentile(0.5), r.percentile(0.95), r.percentile(0.99), r.percentile(1),
+				r.throughput())
+		}
+		w.Flush()
+
+		fmt.Println("\nRecommendations:")
+		for _, recommendation := range benchRecommendations(set, get) {
+			fmt.Println("  -", recommendation)
+		}
+	},
+}
+
+func init() {
+	benchKVCmd.PersistentFlags().Int(cfgBenchIterations, 20, "number of operations of each kind per worker")
+	benchKVCmd.PersistentFlags().Int(cfgBenchConcurrency, 1, "number of concurrent workers")
+	benchKVCmd.PersistentFlags().Int(cfgBenchValueSize, 256, "size of the test values in bytes")
+	benchKVCmd.PersistentFlags().String(cfgBenchKeyPrefix, "bank-vaults-bench-", "prefix of the test keys")
+
+	rootCmd.AddCommand(benchKVCmd)
+}
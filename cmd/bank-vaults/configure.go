@@ -15,17 +15,25 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/banzaicloud/bank-vaults/internal/configuration"
+	"github.com/banzaicloud/bank-vaults/internal/convention"
+	"github.com/banzaicloud/bank-vaults/internal/hooks"
+	"github.com/banzaicloud/bank-vaults/internal/telemetry"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/configurer"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/jpillora/backoff"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -35,6 +43,16 @@ const (
 	cfgVaultConfigFile = "vault-config-file"
 	cfgFatal           = "fatal"
 	cfgDisableMetrics  = "disable-metrics"
+	cfgConsistency     = "vault-consistency"
+
+	cfgAPITimeout               = "api-timeout"
+	cfgConfigureHeartbeat       = "configure-heartbeat"
+	cfgConfigureSectionTimeouts = "configure-section-timeouts"
+	cfgConfigureConcurrency     = "configure-concurrency"
+	cfgConfigureRollback        = "configure-rollback"
+	cfgConfigureValidate        = "configure-dry-run-validation"
+	cfgConfigureCanary          = "configure-canary-namespace"
+	cfgSecretPathConvention     = "secret-path-convention"
 )
 
 var configureCmd = &cobra.Command{
@@ -44,11 +62,27 @@ var configureCmd = &cobra.Command{
 			https://www.vaultproject.io/docs/configuration/index.html. With this it is possible to
 			configure secret engines, auth methods, etc...`,
 	Run: func(cmd *cobra.Command, args []string) {
-		appConfig.BindPFlag(cfgOnce, cmd.PersistentFlags().Lookup(cfgOnce))                       // nolint
-		appConfig.BindPFlag(cfgFatal, cmd.PersistentFlags().Lookup(cfgFatal))                     // nolint
-		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))       // nolint
-		appConfig.BindPFlag(cfgVaultConfigFile, cmd.PersistentFlags().Lookup(cfgVaultConfigFile)) // nolint
-		appConfig.BindPFlag(cfgDisableMetrics, cmd.PersistentFlags().Lookup(cfgDisableMetrics))   // nolint
+		appConfig.BindPFlag(cfgOnce, cmd.PersistentFlags().Lookup(cfgOnce))                                                                 // nolint
+		appConfig.BindPFlag(cfgFatal, cmd.PersistentFlags().Lookup(cfgFatal))                                                               // nolint
+		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))                                                 // nolint
+		appConfig.BindPFlag(cfgVaultConfigFile, cmd.PersistentFlags().Lookup(cfgVaultConfigFile))                                           // nolint
+		appConfig.BindPFlag(cfgDisableMetrics, cmd.PersistentFlags().Lookup(cfgDisableMetrics))                                             // nolint
+		appConfig.BindPFlag(cfgConsistency, cmd.PersistentFlags().Lookup(cfgConsistency))                                                   // nolint
+		appConfig.BindPFlag(cfgAPITimeout, cmd.PersistentFlags().Lookup(cfgAPITimeout))                                                     // nolint
+		appConfig.BindPFlag(cfgConfigureHeartbeat, cmd.PersistentFlags().Lookup(cfgConfigureHeartbeat))                                     // nolint
+		appConfig.BindPFlag(cfgDryRun, cmd.PersistentFlags().Lookup(cfgDryRun))                                                             // nolint
+		appConfig.BindPFlag(cfgDryRunOutput, cmd.PersistentFlags().Lookup(cfgDryRunOutput))                                                 // nolint
+		appConfig.BindPFlag(cfgReconcilePeriod, cmd.PersistentFlags().Lookup(cfgReconcilePeriod))                                           // nolint
+		appConfig.BindPFlag(cfgReconcileSelfHeal, cmd.PersistentFlags().Lookup(cfgReconcileSelfHeal))                                       // nolint
+		appConfig.BindPFlag(cfgConfigureConcurrency, cmd.PersistentFlags().Lookup(cfgConfigureConcurrency))                                 // nolint
+		appConfig.BindPFlag(cfgConfigureRollback, cmd.PersistentFlags().Lookup(cfgConfigureRollback))                                       // nolint
+		appConfig.BindPFlag(cfgConfigureValidate, cmd.PersistentFlags().Lookup(cfgConfigureValidate))                                       // nolint
+		appConfig.BindPFlag(cfgConfigureCanary, cmd.PersistentFlags().Lookup(cfgConfigureCanary))                                           // nolint
+		appConfig.BindPFlag(cfgSecretPathConvention, cmd.PersistentFlags().Lookup(cfgSecretPathConvention))                                 // nolint
+		appConfig.BindPFlag(cfgConfigureLeaderElection, cmd.PersistentFlags().Lookup(cfgConfigureLeaderElection))                           // nolint
+		appConfig.BindPFlag(cfgConfigureLeaderElectionName, cmd.PersistentFlags().Lookup(cfgConfigureLeaderElectionName))                   // nolint
+		appConfig.BindPFlag(cfgConfigureLeaderElectionNamespace, cmd.PersistentFlags().Lookup(cfgConfigureLeaderElectionNamespace))         // nolint
+		appConfig.BindPFlag(cfgConfigureLeaderElectionLeaseDuration, cmd.PersistentFlags().Lookup(cfgConfigureLeaderElectionLeaseDuration)) // nolint
 
 		var unsealConfig unsealCfg
 
@@ -63,23 +97,71 @@ var configureCmd = &cobra.Command{
 			logrus.Fatalf("error creating kv store: %s", err.Error())
 		}
 
-		cl, err := vault.NewRawClient()
+		consistency, err := vault.ParseConsistencyMode(appConfig.GetString(cfgConsistency))
+		if err != nil {
+			logrus.Fatalf("error parsing consistency mode: %s", err.Error())
+		}
+
+		// Configuration reads back what it has written, so it has to see its own writes on replicated clusters
+		cl, err := vault.NewRawClientWithConsistency(consistency)
 		if err != nil {
 			logrus.Fatalf("error connecting to vault: %s", err.Error())
 		}
 
+		if apiTimeout := appConfig.GetDuration(cfgAPITimeout); apiTimeout > 0 {
+			cl.SetClientTimeout(apiTimeout)
+		}
+
 		vaultConfig, err := vaultConfigForConfig(appConfig)
 		if err != nil {
 			logrus.Fatalf("error building vault config: %s", err.Error())
 		}
 
-		v, err := vault.New(store, cl, vaultConfig)
+		vaultConfig.ConfigureHeartbeat = appConfig.GetDuration(cfgConfigureHeartbeat)
+		vaultConfig.ConfigureProgressHook = configureProgress.update
+		vaultConfig.LicenseHook = vaultLicense.update
+		vaultConfig.Metrics = telemetry.NewPrometheus(prometheus.DefaultRegisterer, prometheusNS)
+		vaultConfig.ConfigureConcurrency = appConfig.GetInt(cfgConfigureConcurrency)
+		vaultConfig.ConfigureRollback = appConfig.GetBool(cfgConfigureRollback)
+		vaultConfig.ConfigureDryRunValidation = appConfig.GetBool(cfgConfigureValidate)
+		vaultConfig.ConfigureCanaryNamespace = appConfig.GetString(cfgConfigureCanary)
+
+		vaultConfig.ConfigureSectionTimeouts = map[string]time.Duration{}
+		for section, timeout := range configureSectionTimeouts {
+			vaultConfig.ConfigureSectionTimeouts[section], err = time.ParseDuration(timeout)
+			if err != nil {
+				logrus.Fatalf("error parsing timeout of configuration section %s: %s", section, err.Error())
+			}
+		}
+
+		h, err := hooksForConfig(appConfig)
 		if err != nil {
-			logrus.Fatalf("error creating vault helper: %s", err.Error())
+			logrus.Fatalf("error loading hooks: %s", err.Error())
+		}
+
+		c, err := configurer.New(store, cl, vaultConfig, configurer.WithSealedRetryPeriod(unsealConfig.unsealPeriod))
+		if err != nil {
+			logrus.Fatalf("error creating configurer: %s", err.Error())
+		}
+
+		configLookups.setVault(c.Vault())
+
+		// only print what would change in Vault, nothing is applied
+		if appConfig.GetBool(cfgDryRun) {
+			for _, vaultConfigFile := range vaultConfigFiles {
+				diff, err := c.Plan(context.Background(), parseConfiguration(vaultConfigFile))
+				if err != nil {
+					logrus.Fatalf("error in configuration dry run: %s", err.Error())
+				}
+				if err := printConfigureDiff(os.Stdout, vaultConfigFile, diff, appConfig.GetString(cfgDryRunOutput)); err != nil {
+					logrus.Fatalf("error printing configuration dry run: %s", err.Error())
+				}
+			}
+			return
 		}
 
 		if !disableMetrics {
-			metrics := prometheusExporter{Vault: v, Mode: "configure"}
+			metrics := prometheusExporter{Vault: c.Vault(), Mode: "configure"}
 			go func() {
 				err := metrics.Run()
 				if err != nil {
@@ -88,6 +170,21 @@ var configureCmd = &cobra.Command{
 			}()
 		}
 
+		elector, err := configureLeaderElectorForConfig(appConfig, store)
+		if err != nil {
+			logrus.Fatalf("error creating configure leader elector: %s", err.Error())
+		}
+
+		// only the leader configures Vault, the other replicas stand by until they take over
+		if elector != nil {
+			logrus.Info("waiting to become the configure leader...")
+			if err := elector.Lead(context.Background()); err != nil {
+				logrus.Fatalf("error electing configure leader: %s", err.Error())
+			}
+		} else {
+			atomic.StoreInt32(&configureLeader, 1)
+		}
+
 		configurations := make(chan *viper.Viper, len(vaultConfigFiles))
 
 		for i, vaultConfigFile := range vaultConfigFiles {
@@ -97,6 +194,10 @@ var configureCmd = &cobra.Command{
 
 		if !runOnce {
 			go watchConfigurations(vaultConfigFiles, configurations)
+
+			if period := appConfig.GetDuration(cfgReconcilePeriod); period > 0 {
+				go reconcileConfigurations(c, vaultConfigFiles, period, appConfig.GetBool(cfgReconcileSelfHeal), configurations, h, cl.Address())
+			}
 		} else {
 			close(configurations)
 		}
@@ -113,47 +214,113 @@ var configureCmd = &cobra.Command{
 
 			logrus.Infoln("applying config file :", config.ConfigFileUsed())
 
-			func() {
-				for {
-					logrus.Infof("checking if vault is sealed...")
-					sealed, err := v.Sealed()
-					if err != nil {
-						logrus.Errorf("error checking if vault is sealed: %s, waiting %s before trying again...", err.Error(), unsealConfig.unsealPeriod)
-						time.Sleep(unsealConfig.unsealPeriod)
-						continue
-					}
-
-					// If vault is sealed, we stop here and wait another unsealPeriod
-					if sealed {
-						logrus.Infof("vault is sealed, waiting %s before trying again...", unsealConfig.unsealPeriod)
-						time.Sleep(unsealConfig.unsealPeriod)
-						continue
-					}
-
-					logrus.Info("vault is unsealed, configuring...")
-
-					if err = v.Configure(config); err != nil {
-						logrus.Errorf("error configuring vault: %s", err.Error())
-						if errorFatal {
-							os.Exit(1)
-						}
-						failedConfigurationsCount++
-						// Failed configuration handler - Increase the backoff sleep
-						go handleConfigurationError(config.ConfigFileUsed(), configurations, b.Duration())
-						return
-					}
-
-					// On *any* successful configuration reset the backoff
-					b.Reset()
-					successfulConfigurationsCount++
-					logrus.Info("successfully configured vault")
-					return
+			_, err := c.Apply(context.Background(), config)
+
+			// the accessors of the auth methods created by the first apply can be looked up now
+			if err == nil && configLookups.takePending(config.ConfigFileUsed()) {
+				logrus.Infoln("applying config file again with the accessors of the new auth methods :", config.ConfigFileUsed())
+				config = parseConfiguration(config.ConfigFileUsed())
+				_, err = c.Apply(context.Background(), config)
+			}
+
+			configureStatus.update(config.ConfigFileUsed(), err)
+
+			if err != nil {
+				logrus.Errorf("error configuring vault: %s", err.Error())
+				// the hooks log their errors
+				_ = h.Fire(hooks.EventConfigureFailed, cl.Address(), map[string]string{"config_file": config.ConfigFileUsed(), "error": err.Error()})
+				if errorFatal {
+					os.Exit(1)
 				}
-			}()
+				failedConfigurationsCount++
+				// Failed configuration handler - Increase the backoff sleep
+				go handleConfigurationError(config.ConfigFileUsed(), configurations, b.Duration())
+				continue
+			}
+
+			// On *any* successful configuration reset the backoff
+			b.Reset()
+			successfulConfigurationsCount++
+			lastSuccessfulConfigurationTimestamp = float64(time.Now().Unix())
+			logrus.Info("successfully configured vault")
+
+			// the hooks log their errors
+			_ = h.Fire(hooks.EventConfigure, cl.Address(), map[string]string{"config_file": config.ConfigFileUsed()})
 		}
 	},
 }
 
+// We need to pre-create a value and bind the the flag to this until
+// https://github.com/spf13/viper/issues/608 gets fixed.
+var configureSectionTimeouts map[string]string
+
+// configureProgressTracker keeps the latest progress of each configuration section
+type configureProgressTracker struct {
+	mu       sync.Mutex
+	sections map[string]vault.ConfigureProgress
+}
+
+var configureProgress = &configureProgressTracker{sections: map[string]vault.ConfigureProgress{}}
+
+func (t *configureProgressTracker) update(progress vault.ConfigureProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sections[progress.Section] = progress
+}
+
+func (t *configureProgressTracker) snapshot() map[string]vault.ConfigureProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sections := make(map[string]vault.ConfigureProgress, len(t.sections))
+	for section, progress := range t.sections {
+		sections[section] = progress
+	}
+
+	return sections
+}
+
+// configureStatusTracker keeps the result of the latest apply of each configuration file, it is reported
+// to the operator, which compares the hashes to the ones of the configuration it has written
+type configureStatusTracker struct {
+	mu    sync.Mutex
+	files map[string]vault.ConfigFileStatus
+}
+
+var configureStatus = &configureStatusTracker{files: map[string]vault.ConfigFileStatus{}}
+
+func (t *configureStatusTracker) update(configFile string, err error) {
+	status := vault.ConfigFileStatus{Applied: time.Now()}
+
+	content, readErr := ioutil.ReadFile(configFile)
+	if readErr != nil {
+		logrus.Warnf("error reading config file %s for its status: %s", configFile, readErr.Error())
+	} else {
+		status.Hash = vault.ConfigHash(content)
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.files[configFile] = status
+}
+
+func (t *configureStatusTracker) snapshot() map[string]vault.ConfigFileStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	files := make(map[string]vault.ConfigFileStatus, len(t.files))
+	for file, status := range t.files {
+		files[file] = status
+	}
+
+	return files
+}
+
 func handleConfigurationError(vaultConfigFile string, configurations chan *viper.Viper, sleepTime time.Duration) {
 	// This handler will sleep for a exponential backoff amount of time and re-inject the failed configuration into the
 	// configurations channel to be re-applied to vault
@@ -225,7 +392,17 @@ func parseConfiguration(vaultConfigFile string) *viper.Viper {
 		logrus.Fatalf("error reading vault config template: %s", err.Error())
 	}
 
-	templater := configuration.NewTemplater(configuration.DefaultLeftDelimiter, configuration.DefaultRightDelimiter)
+	templaterOpts := []configuration.Option{configuration.WithFuncs(configLookups.funcs(vaultConfigFile))}
+
+	if pathTemplate := appConfig.GetString(cfgSecretPathConvention); pathTemplate != "" {
+		pathConvention, err := convention.New(pathTemplate)
+		if err != nil {
+			logrus.Fatalf("error parsing secret path convention: %s", err.Error())
+		}
+		templaterOpts = append(templaterOpts, configuration.WithFuncs(pathConvention.TemplateFuncs()))
+	}
+
+	templater := configuration.NewTemplater(configuration.DefaultLeftDelimiter, configuration.DefaultRightDelimiter, templaterOpts...)
 
 	buffer, err := templater.EnvTemplate(string(vaultConfig))
 	if err != nil {
@@ -257,6 +434,24 @@ func init() {
 	configureCmd.PersistentFlags().Duration(cfgUnsealPeriod, time.Second*5, "How often to attempt to unseal the Vault instance")
 	configureCmd.PersistentFlags().StringSlice(cfgVaultConfigFile, []string{vault.DefaultConfigFile}, "The filename of the YAML/JSON Vault configuration")
 	configureCmd.PersistentFlags().Bool(cfgDisableMetrics, false, "Disable configurer metrics")
+	configureCmd.PersistentFlags().Duration(cfgAPITimeout, 0, "Timeout of the Vault API requests (0 means the Vault client default)")
+	configureCmd.PersistentFlags().Duration(cfgConfigureHeartbeat, 30*time.Second, "How often the progress of long running configuration sections is logged")
+	configureCmd.PersistentFlags().StringToStringVar(&configureSectionTimeouts, cfgConfigureSectionTimeouts, nil,
+		"Timeouts of the configuration sections, e.g. auth=5m,policies=10m (sections: auth, policies, plugins, secrets, audit, startupSecrets, groups, mfa)")
+	configureCmd.PersistentFlags().Bool(cfgDryRun, false, "Print the changes the configuration would make in Vault (with secrets redacted) without applying anything, then exit")
+	configureCmd.PersistentFlags().String(cfgDryRunOutput, "text", "The output format of the dry run: 'text' or 'json'")
+	configureCmd.PersistentFlags().Duration(cfgReconcilePeriod, 0, "How often to compare the live configuration of Vault with the configuration files to detect drift (0 disables it)")
+	configureCmd.PersistentFlags().Bool(cfgReconcileSelfHeal, false, "Apply the configuration files again when drift is detected")
+	configureCmd.PersistentFlags().Bool(cfgConfigureRollback, false, "Roll back the changes applied to Vault on the best-effort basis if the configuration fails midway, the paths which can't be read up front (e.g. rotations) aren't rolled back")
+	configureCmd.PersistentFlags().Bool(cfgConfigureValidate, false, "Validate the configuration with a dry run first, it is not applied if a section of the dry run fails")
+	configureCmd.PersistentFlags().String(cfgConfigureCanary, "", "The Vault Enterprise namespace the policies, auth methods and secret engines are applied to first, the configuration is not applied if that fails")
+	configureCmd.PersistentFlags().String(cfgSecretPathConvention, "", "The Vault secret path convention of the workloads, like secret/data/{namespace}/{app}, for the secretPath and secretPrefix functions of the configuration templates")
+	configureCmd.PersistentFlags().Int(cfgConfigureConcurrency, 1, "How many independent configuration sections are applied at the same time, the dependent ones (e.g. auth after policies) wait for their dependencies")
+	configureCmd.PersistentFlags().String(cfgConfigureLeaderElection, "", "Elect a single replica to configure Vault, the others stand by: 'kv' (a lock of the key store) or 'lease' (a Kubernetes Lease), empty to disable")
+	configureCmd.PersistentFlags().String(cfgConfigureLeaderElectionName, "bank-vaults-configure", "The name of the lock or the Lease of the configure leader election")
+	configureCmd.PersistentFlags().String(cfgConfigureLeaderElectionNamespace, "", "The namespace of the Lease of the configure leader election (defaults to the namespace of the pod)")
+	configureCmd.PersistentFlags().Duration(cfgConfigureLeaderElectionLeaseDuration, 15*time.Second, "How long the configure leadership is kept without renewal")
+	configureCmd.PersistentFlags().String(cfgConsistency, string(vault.ConsistencyReadYourWrites), "Vault Enterprise consistency mode (read-your-writes, retry-on-stale, forward-active-node or empty to disable)")
 
 	rootCmd.AddCommand(configureCmd)
 }
@@ -0,0 +1,79 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/configurer"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgDryRunOutput = "dry-run-output"
+
+var configOperationSymbols = map[vault.ConfigOperation]string{
+	vault.ConfigCreate: "+",
+	vault.ConfigUpdate: "~",
+	vault.ConfigDelete: "-",
+	vault.ConfigWrite:  "?",
+}
+
+// printConfigureDiff prints the result of a configuration dry run as text or JSON
+func printConfigureDiff(w io.Writer, configFile string, diff configurer.Report, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{"configFile": configFile, "diff": diff})
+	case "text":
+	default:
+		return errors.Errorf("unsupported dry run output: '%s'", output)
+	}
+
+	fmt.Fprintf(w, "%s: %d changes\n", configFile, len(diff.Changes))
+
+	for _, change := range diff.Changes {
+		fmt.Fprintf(w, "%s %s %s (%s)\n", configOperationSymbols[change.Operation], change.Operation, change.Path, change.Section)
+
+		fields := make([]string, 0, len(change.Fields))
+		for field := range change.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			value := change.Fields[field]
+			desired, _ := json.Marshal(value.Desired)
+			if change.Operation == vault.ConfigUpdate {
+				current, _ := json.Marshal(value.Current)
+				fmt.Fprintf(w, "    %s: %s -> %s\n", field, current, desired)
+			} else {
+				fmt.Fprintf(w, "    %s: %s\n", field, desired)
+			}
+		}
+	}
+
+	for _, warning := range diff.Warnings {
+		fmt.Fprintf(w, "! %s\n", strings.TrimSpace(warning))
+	}
+
+	return nil
+}
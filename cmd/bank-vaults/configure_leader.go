@@ -0,0 +1,276 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+const (
+	cfgConfigureLeaderElection           = "configure-leader-election"
+	cfgConfigureLeaderElectionValueKV    = "kv"
+	cfgConfigureLeaderElectionValueLease = "lease"
+
+	cfgConfigureLeaderElectionName          = "configure-leader-election-name"
+	cfgConfigureLeaderElectionNamespace     = "configure-leader-election-namespace"
+	cfgConfigureLeaderElectionLeaseDuration = "configure-leader-election-lease-duration"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// configureLeaderRetryPeriod is how often the standby instances try to become the leader
+const configureLeaderRetryPeriod = 2 * time.Second
+
+// configureLeader is 1 while this instance is the leader which configures Vault, it's accessed atomically
+var configureLeader int32
+
+// configureLeaderElector elects the single instance configuring Vault among the replicas
+type configureLeaderElector interface {
+	// Lead blocks until this instance becomes the leader, then keeps the leadership in the background
+	// and exits the process if it is lost, so that the instance restarts as a standby
+	Lead(ctx context.Context) error
+}
+
+func configureLeaderElectorForConfig(cfg *viper.Viper, store kv.Service) (configureLeaderElector, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the identity of the instance")
+	}
+
+	name := cfg.GetString(cfgConfigureLeaderElectionName)
+	leaseDuration := cfg.GetDuration(cfgConfigureLeaderElectionLeaseDuration)
+
+	switch election := cfg.GetString(cfgConfigureLeaderElection); election {
+	case "":
+		return nil, nil
+	case cfgConfigureLeaderElectionValueKV:
+		locker, ok := store.(kv.Locker)
+		if !ok {
+			return nil, errors.WithStack(kv.ErrLockingNotSupported)
+		}
+		return &kvLeaderElector{locker: locker, name: name, identity: identity, ttl: leaseDuration}, nil
+	case cfgConfigureLeaderElectionValueLease:
+		namespace := cfg.GetString(cfgConfigureLeaderElectionNamespace)
+		if namespace == "" {
+			content, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "error reading the namespace of the pod, set it explicitly")
+			}
+			namespace = strings.TrimSpace(string(content))
+		}
+		return &leaseLeaderElector{namespace: namespace, name: name, identity: identity, leaseDuration: leaseDuration}, nil
+	default:
+		return nil, errors.Errorf("unsupported configure leader election: '%s'", election)
+	}
+}
+
+// kvLeaderElector leads while it holds at least one of two locks of the key store, and a standby
+// has to acquire both to take over. The locks of the key stores can't be extended, so they are renewed
+// one at a time by releasing and acquiring them again, while the other one is still held, which means
+// that a standby can't take over during the renewal.
+type kvLeaderElector struct {
+	locker   kv.Locker
+	name     string
+	identity string
+	ttl      time.Duration
+}
+
+// kvLeaderLock is one of the two locks of the leader, unlock is nil while it's not held
+type kvLeaderLock struct {
+	name     string
+	unlock   func() error
+	acquired time.Time
+}
+
+func (e *kvLeaderElector) lockNames() [2]string {
+	return [2]string{e.name + "-0", e.name + "-1"}
+}
+
+// lockBoth acquires both locks, or none of them
+func (e *kvLeaderElector) lockBoth() ([]*kvLeaderLock, error) {
+	var locks []*kvLeaderLock
+	for _, name := range e.lockNames() {
+		unlock, err := e.locker.Lock(name, e.ttl)
+		if err != nil {
+			for _, lock := range locks {
+				_ = lock.unlock()
+			}
+			return nil, err
+		}
+		locks = append(locks, &kvLeaderLock{name: name, unlock: unlock, acquired: time.Now()})
+	}
+
+	return locks, nil
+}
+
+func (e *kvLeaderElector) Lead(ctx context.Context) error {
+	logger := logrus.WithFields(logrus.Fields{"lock": e.name, "identity": e.identity})
+
+	var locks []*kvLeaderLock
+	for {
+		var err error
+		locks, err = e.lockBoth()
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, kv.ErrLocked) {
+			return errors.Wrap(err, "error acquiring configure leader lock")
+		}
+
+		logger.Debug("another instance is configuring vault, standing by")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(configureLeaderRetryPeriod):
+		}
+	}
+
+	logger.Info("became the configure leader")
+	atomic.StoreInt32(&configureLeader, 1)
+
+	go func() {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				for _, lock := range locks {
+					if lock.unlock == nil {
+						continue
+					}
+					if err := lock.unlock(); err != nil {
+						logger.Warnf("error releasing configure leader lock %s: %s", lock.name, err.Error())
+					}
+				}
+				return
+			case <-ticker.C:
+				e.renew(logger, locks)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// renew renews the older lock if both are held, or acquires the missing one again, a standby may hold
+// it for a moment while it fails to acquire the other one. The leadership is only lost if the held lock
+// would expire before the next renewal.
+func (e *kvLeaderElector) renew(logger logrus.FieldLogger, locks []*kvLeaderLock) {
+	target, held := locks[0], locks[1]
+	switch {
+	case target.unlock == nil:
+	case held.unlock == nil, held.acquired.Before(target.acquired):
+		target, held = held, target
+	}
+
+	if target.unlock != nil {
+		if err := target.unlock(); err != nil {
+			logger.Warnf("error releasing configure leader lock %s for renewal: %s", target.name, err.Error())
+		}
+		target.unlock = nil
+	}
+
+	unlock, err := e.locker.Lock(target.name, e.ttl)
+	if err == nil {
+		target.unlock, target.acquired = unlock, time.Now()
+		return
+	}
+
+	if time.Since(held.acquired)+e.ttl/3 < e.ttl {
+		logger.Infof("error renewing configure leader lock %s, retrying with the next renewal: %s", target.name, err.Error())
+		return
+	}
+
+	atomic.StoreInt32(&configureLeader, 0)
+	logger.Fatalf("lost configure leadership: %s", err.Error())
+}
+
+// leaseLeaderElector is the leader while it holds a Kubernetes Lease
+type leaseLeaderElector struct {
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+}
+
+func (e *leaseLeaderElector) Lead(ctx context.Context) error {
+	client, err := newKubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: e.namespace, Name: e.name},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+	}
+
+	logger := logrus.WithFields(logrus.Fields{"lease": e.namespace + "/" + e.name, "identity": e.identity})
+
+	leading := make(chan struct{})
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   e.leaseDuration,
+		RenewDeadline:   e.leaseDuration * 2 / 3,
+		RetryPeriod:     configureLeaderRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				logger.Info("became the configure leader")
+				atomic.StoreInt32(&configureLeader, 1)
+				close(leading)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					logger.Fatal("lost configure leadership")
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.identity {
+					logger.Infof("%s is configuring vault, standing by", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating leader elector")
+	}
+
+	go elector.Run(ctx)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-leading:
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/internal/hooks"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/configurer"
+)
+
+const (
+	cfgReconcilePeriod   = "reconcile-period"
+	cfgReconcileSelfHeal = "reconcile-self-heal"
+)
+
+// configDriftState is the drift found by the latest reconciliation of every configuration file
+type configDriftState struct {
+	mu     sync.Mutex
+	files  map[string]int
+	healed float64
+}
+
+var configDrift = &configDriftState{files: map[string]int{}}
+
+func (s *configDriftState) update(configFile string, drift int, healed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[configFile] = drift
+	if healed {
+		s.healed++
+	}
+}
+
+// snapshot returns the number of drifted objects of all configuration files and the number of self-heals
+func (s *configDriftState) snapshot() (float64, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var drift int
+	for _, n := range s.files {
+		drift += n
+	}
+
+	return float64(drift), s.healed
+}
+
+// reconcileConfigurations compares the live configuration of Vault with the configuration files periodically,
+// the drift is logged, exported as metrics and fired as hooks, and if selfHeal is set the drifted
+// configuration files are applied again
+func reconcileConfigurations(c *configurer.Configurer, vaultConfigFiles []string, period time.Duration, selfHeal bool, configurations chan<- *viper.Viper, h *hooks.Hooks, vaultAddr string) {
+	for {
+		time.Sleep(period)
+
+		for _, vaultConfigFile := range vaultConfigFiles {
+			config := parseConfiguration(vaultConfigFile)
+
+			drift, err := c.Drift(context.Background(), config)
+			if err != nil {
+				logrus.Errorf("error detecting configuration drift of %s: %s", vaultConfigFile, err.Error())
+				continue
+			}
+
+			heal := selfHeal && len(drift) > 0
+			configDrift.update(vaultConfigFile, len(drift), heal)
+
+			if len(drift) == 0 {
+				logrus.Debugf("no configuration drift from %s", vaultConfigFile)
+				continue
+			}
+
+			for _, change := range drift {
+				logrus.WithFields(logrus.Fields{
+					"config_file": vaultConfigFile,
+					"section":     change.Section,
+					"operation":   change.Operation,
+					"path":        change.Path,
+				}).Warn("configuration drift detected")
+			}
+
+			// the hooks log their errors
+			_ = h.Fire(hooks.EventDrift, vaultAddr, map[string]string{
+				"config_file": vaultConfigFile,
+				"changes":     fmt.Sprint(len(drift)),
+			})
+
+			if heal {
+				logrus.Infof("applying %s again to heal the configuration drift", vaultConfigFile)
+				configurations <- config
+			}
+		}
+	}
+}
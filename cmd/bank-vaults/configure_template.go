@@ -0,0 +1,89 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// configTemplateLookups are the functions of the configuration templates which look values up in Vault,
+// besides the default ones (sprig, env, file, awsKms, gcpkms, blob):
+//
+//	auth:
+//	  - type: jwt
+//	    path: oidc
+//	policies:
+//	  - name: team
+//	    rules: path "secret/{{identity.entity.aliases.${ accessor "oidc" }.metadata.team}}/*" { capabilities = ["read"] }
+//
+// The accessors of the auth methods which are created by the same configuration don't exist before it is
+// applied, they are rendered empty and the configuration is parsed and applied again after the first apply.
+type configTemplateLookups struct {
+	mu      sync.Mutex
+	vault   vault.Vault
+	pending map[string]bool
+}
+
+var configLookups = &configTemplateLookups{pending: map[string]bool{}}
+
+// setVault sets the Vault the values are looked up in
+func (l *configTemplateLookups) setVault(v vault.Vault) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.vault = v
+}
+
+// funcs returns the lookup functions for rendering the configuration file
+func (l *configTemplateLookups) funcs(configFile string) template.FuncMap {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, configFile)
+
+	return template.FuncMap{
+		"accessor": func(path string) string {
+			l.mu.Lock()
+			v := l.vault
+			l.mu.Unlock()
+
+			if v != nil {
+				accessor, err := v.AuthMountAccessor(path)
+				if err == nil {
+					return accessor
+				}
+				logrus.Warnf("accessor of auth method %s is not available yet: %s", path, err.Error())
+			}
+
+			l.mu.Lock()
+			l.pending[configFile] = true
+			l.mu.Unlock()
+			return ""
+		},
+	}
+}
+
+// takePending returns true if an accessor wasn't available when the configuration file was rendered last
+func (l *configTemplateLookups) takePending(configFile string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending := l.pending[configFile]
+	delete(l.pending, configFile)
+	return pending
+}
@@ -18,12 +18,21 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/banzaicloud/bank-vaults/internal/hooks"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
 const cfgInitRootToken = "init-root-token"
 const cfgStoreRootToken = "store-root-token"
 const cfgPreFlightChecks = "pre-flight-checks"
+const cfgLockKeyStore = "lock-key-store"
+const cfgInitAuditFilePath = "init-audit-file-path"
+const cfgRecoveryShares = "recovery-shares"
+const cfgRecoveryThreshold = "recovery-threshold"
+const cfgStoredShares = "stored-shares"
+const cfgPGPKeys = "pgp-keys"
+const cfgRecoveryPGPKeys = "recovery-pgp-keys"
+const cfgWrapRootTokenTTL = "wrap-root-token-ttl"
 
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -34,9 +43,17 @@ storing the keys in the Cloud KMS keyring.
 
 It will not unseal the Vault instance after initialising.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		appConfig.BindPFlag(cfgInitRootToken, cmd.PersistentFlags().Lookup(cfgInitRootToken))     // nolint
-		appConfig.BindPFlag(cfgStoreRootToken, cmd.PersistentFlags().Lookup(cfgStoreRootToken))   // nolint
-		appConfig.BindPFlag(cfgPreFlightChecks, cmd.PersistentFlags().Lookup(cfgPreFlightChecks)) // nolint
+		appConfig.BindPFlag(cfgInitRootToken, cmd.PersistentFlags().Lookup(cfgInitRootToken))         // nolint
+		appConfig.BindPFlag(cfgStoreRootToken, cmd.PersistentFlags().Lookup(cfgStoreRootToken))       // nolint
+		appConfig.BindPFlag(cfgPreFlightChecks, cmd.PersistentFlags().Lookup(cfgPreFlightChecks))     // nolint
+		appConfig.BindPFlag(cfgLockKeyStore, cmd.PersistentFlags().Lookup(cfgLockKeyStore))           // nolint
+		appConfig.BindPFlag(cfgInitAuditFilePath, cmd.PersistentFlags().Lookup(cfgInitAuditFilePath)) // nolint
+		appConfig.BindPFlag(cfgRecoveryShares, cmd.PersistentFlags().Lookup(cfgRecoveryShares))       // nolint
+		appConfig.BindPFlag(cfgRecoveryThreshold, cmd.PersistentFlags().Lookup(cfgRecoveryThreshold)) // nolint
+		appConfig.BindPFlag(cfgStoredShares, cmd.PersistentFlags().Lookup(cfgStoredShares))           // nolint
+		appConfig.BindPFlag(cfgPGPKeys, cmd.PersistentFlags().Lookup(cfgPGPKeys))                     // nolint
+		appConfig.BindPFlag(cfgRecoveryPGPKeys, cmd.PersistentFlags().Lookup(cfgRecoveryPGPKeys))     // nolint
+		appConfig.BindPFlag(cfgWrapRootTokenTTL, cmd.PersistentFlags().Lookup(cfgWrapRootTokenTTL))   // nolint
 
 		store, err := kvStoreForConfig(appConfig)
 		if err != nil {
@@ -53,6 +70,15 @@ It will not unseal the Vault instance after initialising.`,
 			logrus.Fatalf("error building vault config: %s", err.Error())
 		}
 
+		h, err := hooksForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error loading hooks: %s", err.Error())
+		}
+
+		vaultConfig.InitHook = func() {
+			_ = h.Fire(hooks.EventInit, cl.Address(), nil) // the hooks log their errors
+		}
+
 		v, err := vault.New(store, cl, vaultConfig)
 		if err != nil {
 			logrus.Fatalf("error creating vault helper: %s", err.Error())
@@ -68,6 +94,14 @@ func init() {
 	initCmd.PersistentFlags().String(cfgInitRootToken, "", "root token for the new vault cluster")
 	initCmd.PersistentFlags().Bool(cfgStoreRootToken, true, "should the root token be stored in the key store")
 	initCmd.PersistentFlags().Bool(cfgPreFlightChecks, true, "should the key store be tested first to validate access rights")
+	initCmd.PersistentFlags().Bool(cfgLockKeyStore, false, "should the key store be locked during init to prevent concurrent writers")
+	initCmd.PersistentFlags().String(cfgInitAuditFilePath, "", "file path (or stdout) of a file audit device to enable right after init, this unseals vault during init")
+	initCmd.PersistentFlags().Int(cfgRecoveryShares, 0, "total count of recovery shares with auto-unseal seals (defaults to secret-shares)")
+	initCmd.PersistentFlags().Int(cfgRecoveryThreshold, 0, "minimum required recovery shares with auto-unseal seals (defaults to secret-threshold)")
+	initCmd.PersistentFlags().Int(cfgStoredShares, 0, "count of the shares stored by the seal, for the seals which need it")
+	initCmd.PersistentFlags().StringSlice(cfgPGPKeys, nil, "base64 encoded PGP public keys to encrypt the unseal keys with, one per share, bank-vaults can't unseal with the encrypted keys")
+	initCmd.PersistentFlags().StringSlice(cfgRecoveryPGPKeys, nil, "base64 encoded PGP public keys to encrypt the recovery keys with, one per recovery share")
+	initCmd.PersistentFlags().Duration(cfgWrapRootTokenTTL, 0, "response-wrap the root token with this TTL and store the wrapping token instead of the root token, this waits for vault to be unsealed")
 
 	rootCmd.AddCommand(initCmd)
 }
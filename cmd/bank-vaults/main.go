@@ -19,9 +19,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/internal/logging"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
 var appConfig *viper.Viper
@@ -38,8 +43,14 @@ const cfgModeValueVault = "vault"
 const cfgModeValueK8S = "k8s"
 const cfgModeValueHSMK8S = "hsm-k8s"
 const cfgModeValueHSM = "hsm"
+const cfgModeValueHSMPKCS11 = "hsm-pkcs11"
 const cfgModeValueDev = "dev"
 const cfgModeValueFile = "file"
+const cfgModeValueConsul = "consul"
+const cfgModeValueEtcd = "etcd"
+const cfgModeValueReplicated = "replicated"
+const cfgModeValueDistributed = "distributed"
+const cfgModeValueVaultTransitK8S = "vault-transit-k8s"
 
 const cfgGoogleCloudKMSProject = "google-cloud-kms-project"
 const cfgGoogleCloudKMSLocation = "google-cloud-kms-location"
@@ -73,6 +84,8 @@ const cfgVaultRole = "vault-role"
 const cfgVaultAuthPath = "vault-auth-path"
 const cfgVaultTokenPath = "vault-token-path"
 const cfgVaultToken = "vault-token"
+const cfgVaultTransitPath = "vault-transit-path"
+const cfgVaultTransitKeyName = "vault-transit-key-name"
 
 const cfgK8SNamespace = "k8s-secret-namespace"
 const cfgK8SSecret = "k8s-secret-name"
@@ -83,9 +96,38 @@ const cfgHSMSlotID = "hsm-slot-id"
 const cfgHSMTokenLabel = "hsm-token-label" // nolint:gosec
 const cfgHSMPin = "hsm-pin"
 const cfgHSMKeyLabel = "hsm-key-label"
+const cfgHSMTokenLabels = "hsm-token-labels" // nolint:gosec
 
 const cfgFilePath = "file-path"
 
+const cfgConsulAddress = "consul-address"
+const cfgConsulToken = "consul-token" // nolint:gosec
+const cfgConsulPrefix = "consul-prefix"
+const cfgConsulEncryptionKey = "consul-encryption-key"
+
+const cfgEtcdEndpoints = "etcd-endpoints"
+const cfgEtcdPrefix = "etcd-prefix"
+const cfgEtcdUsername = "etcd-username"
+const cfgEtcdPassword = "etcd-password" // nolint:gosec
+const cfgEtcdCertFile = "etcd-cert-file"
+const cfgEtcdKeyFile = "etcd-key-file"
+const cfgEtcdCAFile = "etcd-ca-file"
+const cfgEtcdEncryptionKey = "etcd-encryption-key"
+
+const cfgReplicatedModes = "replicated-modes"
+const cfgReplicatedWriteQuorum = "replicated-write-quorum"
+const cfgReplicatedReadQuorum = "replicated-read-quorum"
+
+const cfgDistributedModes = "distributed-modes"
+const cfgDistributedRootTokenMode = "distributed-root-token-mode"
+
+const cfgSealStatusCacheTTL = "seal-status-cache-ttl"
+
+const cfgHooksFile = "hooks-file"
+
+const cfgLogFormat = "log-format"
+const cfgLogLevel = "log-level"
+
 // We need to pre-create a value and bind the the flag to this until
 // https://github.com/spf13/viper/issues/608 gets fixed.
 var k8sSecretLabels map[string]string
@@ -94,6 +136,14 @@ var rootCmd = &cobra.Command{
 	Use:   "bank-vaults",
 	Short: "Automates initialization, unsealing and configuration of Hashicorp Vault.",
 	Long:  `This is a CLI tool to help automate the setup and management of Hashicorp Vault.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// the SDK logs through the standard logger, and its clients through their own one
+		if err := logging.Configure(logrus.StandardLogger(), appConfig.GetString(cfgLogFormat), appConfig.GetString(cfgLogLevel)); err != nil {
+			return err
+		}
+		vault.SetLogger(logrus.StandardLogger())
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
@@ -110,6 +160,11 @@ func configIntVar(key string, defaultValue int, description string) {
 	appConfig.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key)) // nolint
 }
 
+func configDurationVar(key string, defaultValue time.Duration, description string) {
+	rootCmd.PersistentFlags().Duration(key, defaultValue, description)
+	appConfig.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key)) // nolint
+}
+
 func configStringVar(key, defaultValue, description string) {
 	rootCmd.PersistentFlags().String(key, defaultValue, description)
 	appConfig.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key)) // nolint
@@ -145,8 +200,14 @@ func init() {
 						'%s' => Kubernetes Secrets;
 						'%s' => Kubernetes Secrets encrypted with HSM;
 						'%s' => HSM object on device, using HSM encryption;
+						'%s' => HSM objects on device, using HSM encryption, falling back between multiple HSM slots;
 						'%s' => Dev (vault server -dev) mode
-						'%s' => File mode`,
+						'%s' => File mode
+						'%s' => Consul KV, optionally encrypted with a local key
+						'%s' => etcd v3, optionally encrypted with a local key
+						'%s' => Replicated to the backends of multiple modes, with quorum reads and writes
+						'%s' => Unseal key shards distributed across the backends of multiple modes
+						'%s' => Kubernetes Secrets encrypted with the Transit secret engine of a remote Vault`,
 			cfgModeValueGoogleCloudKMSGCS,
 			cfgModeValueAWSKMS3,
 			cfgModeValueAzureKeyVault,
@@ -155,8 +216,14 @@ func init() {
 			cfgModeValueK8S,
 			cfgModeValueHSMK8S,
 			cfgModeValueHSM,
+			cfgModeValueHSMPKCS11,
 			cfgModeValueDev,
 			cfgModeValueFile,
+			cfgModeValueConsul,
+			cfgModeValueEtcd,
+			cfgModeValueReplicated,
+			cfgModeValueDistributed,
+			cfgModeValueVaultTransitK8S,
 		),
 	)
 
@@ -207,6 +274,8 @@ func init() {
 	configStringVar(cfgVaultAuthPath, "", "Auth path for Kubernetes auth type")
 	configStringVar(cfgVaultTokenPath, "", "Path to file containing Vault token")
 	configStringVar(cfgVaultToken, "", "Vault token")
+	configStringVar(cfgVaultTransitPath, "transit", "The mount path of the Transit secret engine in the remote Vault")
+	configStringVar(cfgVaultTransitKeyName, "", "The name of the Transit key in the remote Vault to encrypt values with")
 
 	// K8S Secret Storage flags
 	configStringVar(cfgK8SNamespace, "", "The namespace of the K8S Secret to store values in")
@@ -219,9 +288,45 @@ func init() {
 	configStringVar(cfgHSMTokenLabel, "", "The label of the token in a HSM slot")
 	configStringVar(cfgHSMPin, "", "The pin of the HSM token to login with")
 	configStringVar(cfgHSMKeyLabel, "bank-vaults", "The label of the HSM private key")
+	configStringSliceVar(cfgHSMTokenLabels, nil, "The labels of the tokens in HSM slots to read with in order, the next one is used if a slot is unavailable, the keys are written to all of them")
 
 	// File flags
 	configStringVar(cfgFilePath, "", "The path prefix of the files where to store values in")
+
+	// Consul flags
+	configStringVar(cfgConsulAddress, "", "The address of the Consul agent (defaults to CONSUL_HTTP_ADDR)")
+	configStringVar(cfgConsulToken, "", "The ACL token to access Consul KV with (defaults to CONSUL_HTTP_TOKEN)")
+	configStringVar(cfgConsulPrefix, "vault-unseal/", "The key prefix in Consul KV where to store values in")
+	configStringVar(cfgConsulEncryptionKey, "", "The base64 encoded 32 byte AES key to encrypt the values with before storing them in Consul KV")
+
+	// etcd flags
+	configStringSliceVar(cfgEtcdEndpoints, []string{"http://127.0.0.1:2379"}, "The etcd v3 endpoints to connect to")
+	configStringVar(cfgEtcdPrefix, "vault-unseal/", "The key prefix in etcd where to store values in")
+	configStringVar(cfgEtcdUsername, "", "The username to authenticate to etcd with")
+	configStringVar(cfgEtcdPassword, "", "The password to authenticate to etcd with")
+	configStringVar(cfgEtcdCertFile, "", "The client certificate file for mTLS connections to etcd")
+	configStringVar(cfgEtcdKeyFile, "", "The client key file for mTLS connections to etcd")
+	configStringVar(cfgEtcdCAFile, "", "The CA certificate file to verify the etcd servers with")
+	configStringVar(cfgEtcdEncryptionKey, "", "The base64 encoded 32 byte AES key to encrypt the values with before storing them in etcd")
+
+	// Replicated flags
+	configStringSliceVar(cfgReplicatedModes, nil, "The modes of the replicas in replicated mode, every AWS S3 bucket is a separate replica")
+	configIntVar(cfgReplicatedWriteQuorum, 0, "The number of replicas which have to store a value (defaults to the majority)")
+	configIntVar(cfgReplicatedReadQuorum, 0, "The number of replicas which have to agree on a value (defaults to the smallest one overlapping the write quorum, that is the majority, or 1 with 2 replicas)")
+
+	// Distributed flags
+	configStringSliceVar(cfgDistributedModes, nil, "The modes of the backends in distributed mode, shard n is stored in backend n modulo the number of backends, the other keys except the root token in the first one")
+	configStringVar(cfgDistributedRootTokenMode, "", "The mode of the backend storing the root token in distributed mode, it should differ from the shard backends (the root token is refused if unset)")
+
+	// Vault status flags
+	configDurationVar(cfgSealStatusCacheTTL, time.Second, "How long the seal status of Vault is cached")
+
+	// Hooks flags
+	configStringVar(cfgHooksFile, "", "The YAML/JSON file of the hooks to run after init, unseal, configure, failed configurations and on configuration drift")
+
+	// Logging flags
+	configStringVar(cfgLogFormat, logging.FormatConsole, "Format of the logs: console or json, key material is redacted in both")
+	configStringVar(cfgLogLevel, "info", "Level of the logs: trace, debug, info, warning, error, fatal or panic")
 }
 
 func main() {
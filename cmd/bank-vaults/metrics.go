@@ -15,11 +15,16 @@
 package main
 
 import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
@@ -41,6 +46,30 @@ var (
 		"Is the Vault node the leader.",
 		nil, nil,
 	)
+	unsealPanicsCount float64
+	unsealPanicsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "unseal", "panics"),
+		"Number of panics recovered while watching the Vault node",
+		nil, nil,
+	)
+	unsealAttemptsCount float64
+	unsealAttemptsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "unseal", "attempts"),
+		"Number of attempts to unseal the Vault node",
+		nil, nil,
+	)
+	failedUnsealAttemptsCount float64
+	failedUnsealAttemptsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "unseal", "failed"),
+		"Number of attempts to unseal the Vault node that failed",
+		nil, nil,
+	)
+	kvErrorsCount float64
+	kvErrorsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "kv", "errors"),
+		"Number of failed reads and writes of the key store, not found keys excluded",
+		nil, nil,
+	)
 	successfulConfigurationsCount float64
 	successfulConfigurationsDesc  = prometheus.NewDesc(
 		prometheus.BuildFQName(prometheusNS, "config", "successful"),
@@ -53,11 +82,181 @@ var (
 		"Number of configurations files applied that failed",
 		nil, nil,
 	)
+	lastSuccessfulConfigurationTimestamp float64
+	lastSuccessfulConfigurationDesc      = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "config", "last_success_timestamp_seconds"),
+		"Time of the last successful configuration files applied",
+		nil, nil,
+	)
+	configureLeaderDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "config", "leader"),
+		"Is this instance the one configuring Vault",
+		nil, nil,
+	)
+	configDriftDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "config", "drift"),
+		"Number of objects of Vault which have drifted from the configuration files",
+		nil, nil,
+	)
+	configDriftHealedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "config", "drift_healed"),
+		"Number of configuration files applied again to heal drift",
+		nil, nil,
+	)
+	lastSuccessfulBackupTimestamp float64
+	lastSuccessfulBackupDesc      = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "backup", "last_success_timestamp_seconds"),
+		"Time of the last successful Raft snapshot",
+		nil, nil,
+	)
+	lastSuccessfulBackupSize     float64
+	lastSuccessfulBackupSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "backup", "last_success_size_bytes"),
+		"Size of the last successful Raft snapshot",
+		nil, nil,
+	)
+	failedBackupsCount float64
+	failedBackupsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "backup", "failed"),
+		"Number of Raft snapshots that failed",
+		nil, nil,
+	)
+	lastSuccessfulRestoreDrillTimestamp float64
+	lastSuccessfulRestoreDrillDesc      = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "restore_drill", "last_success_timestamp_seconds"),
+		"Time of the last successful restore drill",
+		nil, nil,
+	)
+	lastSuccessfulRestoreDrillDuration     float64
+	lastSuccessfulRestoreDrillDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "restore_drill", "last_success_duration_seconds"),
+		"Duration of the last successful restore drill",
+		nil, nil,
+	)
+	lastRestoreDrillSnapshotTimestamp     float64
+	lastRestoreDrillSnapshotTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "restore_drill", "last_success_snapshot_timestamp_seconds"),
+		"Time of the Raft snapshot restored by the last successful restore drill",
+		nil, nil,
+	)
+	failedRestoreDrillsCount float64
+	failedRestoreDrillsDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "restore_drill", "failed"),
+		"Number of restore drills that failed",
+		nil, nil,
+	)
+	lastSuccessfulStandbyRestoreTimestamp float64
+	lastSuccessfulStandbyRestoreDesc      = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "standby", "last_success_timestamp_seconds"),
+		"Time of the last successful restore of the standby",
+		nil, nil,
+	)
+	lastStandbySnapshotTimestamp     float64
+	lastStandbySnapshotTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "standby", "last_success_snapshot_timestamp_seconds"),
+		"Time of the Raft snapshot of the primary restored last into the standby",
+		nil, nil,
+	)
+	failedStandbyRestoresCount float64
+	failedStandbyRestoresDesc  = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "standby", "failed"),
+		"Number of restores of the standby that failed",
+		nil, nil,
+	)
+	licenseExpirationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "license", "expiration_timestamp"),
+		"Unix timestamp of the expiration of the Vault Enterprise license",
+		nil, nil,
+	)
+	licenseExpiresSoonDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "license", "expires_soon"),
+		"Does the Vault Enterprise license expire within the expiry warning period",
+		nil, nil,
+	)
+	raftPeersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "raft", "peers"),
+		"Number of the Raft peers.",
+		nil, nil,
+	)
+	raftVotersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "raft", "voters"),
+		"Number of the voting Raft peers.",
+		nil, nil,
+	)
+	raftHealthyPeersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "raft", "healthy_peers"),
+		"Number of the healthy Raft peers.",
+		nil, nil,
+	)
+	raftRemovedPeersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(prometheusNS, "raft", "removed_peers"),
+		"Number of the dead Raft peers removed.",
+		nil, nil,
+	)
 )
 
+// licenseState is the license status found by the latest configuration, it is only exported
+// after a license section has been applied
+type licenseState struct {
+	mu     sync.Mutex
+	status *vault.LicenseStatus
+}
+
+var vaultLicense = &licenseState{}
+
+func (s *licenseState) update(status vault.LicenseStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = &status
+}
+
+func (s *licenseState) snapshot() *vault.LicenseStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+// errorCountingStore counts the failed reads and writes of the key store for the metrics
+type errorCountingStore struct {
+	kv.Service
+}
+
+// lockingErrorCountingStore keeps the locking support of the key store
+type lockingErrorCountingStore struct {
+	errorCountingStore
+	kv.Locker
+}
+
+func countKVErrors(store kv.Service) kv.Service {
+	if locker, ok := store.(kv.Locker); ok {
+		return lockingErrorCountingStore{errorCountingStore{store}, locker}
+	}
+	return errorCountingStore{store}
+}
+
+func (s errorCountingStore) Get(key string) ([]byte, error) {
+	value, err := s.Service.Get(key)
+	if err != nil && !kv.IsNotFoundError(err) {
+		kvErrorsCount++
+	}
+	return value, err
+}
+
+func (s errorCountingStore) Set(key string, value []byte) error {
+	err := s.Service.Set(key, value)
+	if err != nil {
+		kvErrorsCount++
+	}
+	return err
+}
+
 type prometheusExporter struct {
 	Vault vault.Vault
 	Mode  string
+	// export the Raft cluster state too (in unseal mode)
+	Raft bool
 }
 
 func (e *prometheusExporter) Describe(ch chan<- *prometheus.Desc) {
@@ -65,9 +264,38 @@ func (e *prometheusExporter) Describe(ch chan<- *prometheus.Desc) {
 		ch <- initializedDesc
 		ch <- sealedDesc
 		ch <- leaderDesc
+		ch <- unsealPanicsDesc
+		ch <- unsealAttemptsDesc
+		ch <- failedUnsealAttemptsDesc
+		ch <- kvErrorsDesc
+		if e.Raft {
+			ch <- raftPeersDesc
+			ch <- raftVotersDesc
+			ch <- raftHealthyPeersDesc
+			ch <- raftRemovedPeersDesc
+		}
 	} else if e.Mode == "configure" {
 		ch <- successfulConfigurationsDesc
 		ch <- failedConfigurationsDesc
+		ch <- lastSuccessfulConfigurationDesc
+		ch <- configureLeaderDesc
+		ch <- configDriftDesc
+		ch <- configDriftHealedDesc
+		ch <- licenseExpirationDesc
+		ch <- licenseExpiresSoonDesc
+	} else if e.Mode == "backup" {
+		ch <- lastSuccessfulBackupDesc
+		ch <- lastSuccessfulBackupSizeDesc
+		ch <- failedBackupsDesc
+	} else if e.Mode == "restore-drill" {
+		ch <- lastSuccessfulRestoreDrillDesc
+		ch <- lastSuccessfulRestoreDrillDurationDesc
+		ch <- lastRestoreDrillSnapshotTimestampDesc
+		ch <- failedRestoreDrillsDesc
+	} else if e.Mode == "standby" {
+		ch <- lastSuccessfulStandbyRestoreDesc
+		ch <- lastStandbySnapshotTimestampDesc
+		ch <- failedStandbyRestoresDesc
 	}
 }
 
@@ -80,6 +308,34 @@ func bToF(b bool) float64 {
 
 func (e *prometheusExporter) Collect(ch chan<- prometheus.Metric) {
 	if e.Mode == "unseal" {
+		// the metrics of the unsealer are exported even if Vault can't be reached
+		ch <- prometheus.MustNewConstMetric(
+			unsealPanicsDesc, prometheus.CounterValue, unsealPanicsCount,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			unsealAttemptsDesc, prometheus.CounterValue, unsealAttemptsCount,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			failedUnsealAttemptsDesc, prometheus.CounterValue, failedUnsealAttemptsCount,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			kvErrorsDesc, prometheus.CounterValue, kvErrorsCount,
+		)
+
+		if e.Raft {
+			state := raftClusterState.snapshot()
+			ch <- prometheus.MustNewConstMetric(raftPeersDesc, prometheus.GaugeValue, state.peers)
+			ch <- prometheus.MustNewConstMetric(raftVotersDesc, prometheus.GaugeValue, state.voters)
+			ch <- prometheus.MustNewConstMetric(raftHealthyPeersDesc, prometheus.GaugeValue, state.healthy)
+			ch <- prometheus.MustNewConstMetric(raftRemovedPeersDesc, prometheus.CounterValue, state.removedPeers)
+		}
+
+		initialized, err := e.Vault.Initialized()
+		if err != nil {
+			logrus.Errorf("error checking if vault is initialized: %s", err.Error())
+			return
+		}
+
 		sealed, err := e.Vault.Sealed()
 		if err != nil {
 			logrus.Errorf("error checking if vault is sealed: %s", err.Error())
@@ -93,7 +349,7 @@ func (e *prometheusExporter) Collect(ch chan<- prometheus.Metric) {
 		}
 
 		ch <- prometheus.MustNewConstMetric(
-			initializedDesc, prometheus.GaugeValue, bToF(true),
+			initializedDesc, prometheus.GaugeValue, bToF(initialized),
 		)
 		ch <- prometheus.MustNewConstMetric(
 			sealedDesc, prometheus.GaugeValue, bToF(sealed),
@@ -108,6 +364,54 @@ func (e *prometheusExporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(
 			failedConfigurationsDesc, prometheus.GaugeValue, failedConfigurationsCount,
 		)
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulConfigurationDesc, prometheus.GaugeValue, lastSuccessfulConfigurationTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			configureLeaderDesc, prometheus.GaugeValue, float64(atomic.LoadInt32(&configureLeader)),
+		)
+
+		drift, healed := configDrift.snapshot()
+		ch <- prometheus.MustNewConstMetric(configDriftDesc, prometheus.GaugeValue, drift)
+		ch <- prometheus.MustNewConstMetric(configDriftHealedDesc, prometheus.CounterValue, healed)
+
+		if license := vaultLicense.snapshot(); license != nil {
+			ch <- prometheus.MustNewConstMetric(licenseExpirationDesc, prometheus.GaugeValue, float64(license.Expiration.Unix()))
+			ch <- prometheus.MustNewConstMetric(licenseExpiresSoonDesc, prometheus.GaugeValue, bToF(license.ExpiresSoon))
+		}
+	} else if e.Mode == "backup" {
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulBackupDesc, prometheus.GaugeValue, lastSuccessfulBackupTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulBackupSizeDesc, prometheus.GaugeValue, lastSuccessfulBackupSize,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			failedBackupsDesc, prometheus.GaugeValue, failedBackupsCount,
+		)
+	} else if e.Mode == "restore-drill" {
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulRestoreDrillDesc, prometheus.GaugeValue, lastSuccessfulRestoreDrillTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulRestoreDrillDurationDesc, prometheus.GaugeValue, lastSuccessfulRestoreDrillDuration,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			lastRestoreDrillSnapshotTimestampDesc, prometheus.GaugeValue, lastRestoreDrillSnapshotTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			failedRestoreDrillsDesc, prometheus.GaugeValue, failedRestoreDrillsCount,
+		)
+	} else if e.Mode == "standby" {
+		ch <- prometheus.MustNewConstMetric(
+			lastSuccessfulStandbyRestoreDesc, prometheus.GaugeValue, lastSuccessfulStandbyRestoreTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			lastStandbySnapshotTimestampDesc, prometheus.GaugeValue, lastStandbySnapshotTimestamp,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			failedStandbyRestoresDesc, prometheus.GaugeValue, failedStandbyRestoresCount,
+		)
 	}
 }
 
@@ -119,5 +423,19 @@ func (e prometheusExporter) Run() error {
 	server := gin.New()
 	server.Use(gin.Logger(), gin.ErrorLogger())
 	server.GET(defaultMetricsPath, gin.WrapH(promhttp.Handler()))
+	if e.Mode == "configure" {
+		server.GET("/configure/progress", func(c *gin.Context) {
+			c.JSON(http.StatusOK, configureProgress.snapshot())
+		})
+		server.GET("/configure/status", func(c *gin.Context) {
+			c.JSON(http.StatusOK, configureStatus.snapshot())
+		})
+	}
+	if e.Mode == "unseal" && e.Raft {
+		server.GET("/raft/state", func(c *gin.Context) {
+			state := raftClusterState.snapshot()
+			c.JSON(http.StatusOK, vault.RaftState{Peers: int(state.peers), Voters: int(state.voters), Healthy: int(state.healthy)})
+		})
+	}
 	return server.Run(defaultMetricsPort)
 }
@@ -0,0 +1,280 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	"github.com/banzaicloud/bank-vaults/internal/hashicorp"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const (
+	cfgMigrateRelease           = "release"
+	cfgMigrateReleaseNamespace  = "release-namespace"
+	cfgMigrateWorkloadNamespace = "workload-namespace"
+	cfgMigrateVaultConfig       = "read-vault-config"
+	cfgMigrateOutputDir         = "output-dir"
+)
+
+var migrateFromHashicorpCmd = &cobra.Command{
+	Use:   "migrate-from-hashicorp",
+	Short: "Generates the resources replacing an installation of the HashiCorp Vault Helm chart",
+	Long: `This command reads the Helm release of the HashiCorp Vault chart from the cluster and
+generates a Vault custom resource with the same Vault configuration, replicas, image and data volumes
+into vault.yaml of the --output-dir. The custom resource is named after the release, so the data
+volume claims of the chart are reused by the StatefulSet of the operator.
+
+With --read-vault-config the auth methods, secrets engines and policies of the running Vault
+(VAULT_ADDR, VAULT_TOKEN) are added as the external configuration of the custom resource,
+the roles and the configuration of the auth methods and secrets engines have to be added manually.
+
+The Deployments, StatefulSets and DaemonSets annotated for the agent injector are migrated to
+the Vault Agent of the webhook: a ConfigMap with the Vault Agent configuration rendering the same
+templates, and a merge patch of the pod template annotations are generated for each of them:
+
+	kubectl apply -f <kind>-<namespace>-<name>-vault-agent.yaml
+	kubectl patch <kind> <name> -n <namespace> --type merge --patch "$(cat <kind>-<namespace>-<name>-patch.yaml)"
+
+The parts which can't be migrated are logged as warnings, nothing is changed in the cluster.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgMigrateRelease, cmd.PersistentFlags().Lookup(cfgMigrateRelease))                     // nolint
+		appConfig.BindPFlag(cfgMigrateReleaseNamespace, cmd.PersistentFlags().Lookup(cfgMigrateReleaseNamespace))   // nolint
+		appConfig.BindPFlag(cfgMigrateWorkloadNamespace, cmd.PersistentFlags().Lookup(cfgMigrateWorkloadNamespace)) // nolint
+		appConfig.BindPFlag(cfgMigrateVaultConfig, cmd.PersistentFlags().Lookup(cfgMigrateVaultConfig))             // nolint
+		appConfig.BindPFlag(cfgMigrateOutputDir, cmd.PersistentFlags().Lookup(cfgMigrateOutputDir))                 // nolint
+
+		k8sClient, err := newKubernetesClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to kubernetes: %s", err.Error())
+		}
+
+		release, err := helmRelease(k8sClient, appConfig.GetString(cfgMigrateReleaseNamespace), appConfig.GetString(cfgMigrateRelease))
+		if err != nil {
+			logrus.Fatalf("error reading helm release: %s", err.Error())
+		}
+
+		var externalConfig map[string]interface{}
+		if appConfig.GetBool(cfgMigrateVaultConfig) {
+			externalConfig, err = readVaultExternalConfig()
+			if err != nil {
+				logrus.Fatalf("error reading vault configuration: %s", err.Error())
+			}
+		}
+
+		migration, err := hashicorp.VaultFromRelease(release, externalConfig)
+		if err != nil {
+			logrus.Fatalf("error migrating helm release: %s", err.Error())
+		}
+
+		outputDir := appConfig.GetString(cfgMigrateOutputDir)
+
+		if err := writeYAML(filepath.Join(outputDir, "vault.yaml"), migration.Vault); err != nil {
+			logrus.Fatalf("error writing vault custom resource: %s", err.Error())
+		}
+		for _, warning := range migration.Warnings {
+			logrus.Warn(warning)
+		}
+
+		if err := migrateWorkloads(k8sClient, appConfig.GetString(cfgMigrateWorkloadNamespace), outputDir); err != nil {
+			logrus.Fatalf("error migrating workloads: %s", err.Error())
+		}
+	},
+}
+
+// helmRelease returns the latest deployed version of the Helm 3 release stored in the namespace
+func helmRelease(k8sClient kubernetes.Interface, namespace, name string) (*hashicorp.Release, error) {
+	secrets, err := k8sClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("owner=helm,name=%s,status=deployed", name),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing helm release secrets")
+	}
+
+	var latest *hashicorp.Release
+	for _, secret := range secrets.Items {
+		release, err := hashicorp.DecodeRelease(secret.Data["release"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding helm release secret %s", secret.Name)
+		}
+		if latest == nil || release.Version > latest.Version {
+			latest = release
+		}
+	}
+
+	if latest == nil {
+		return nil, errors.Errorf("no deployed helm release %s found in namespace %s", name, namespace)
+	}
+
+	return latest, nil
+}
+
+// readVaultExternalConfig lists the auth methods, secrets engines and policies of the Vault of the environment
+func readVaultExternalConfig() (map[string]interface{}, error) {
+	cl, err := vault.NewRawClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to vault")
+	}
+
+	authMounts, err := cl.Sys().ListAuth()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing auth methods")
+	}
+	auths := map[string]map[string]interface{}{}
+	for path, auth := range authMounts {
+		auths[path] = map[string]interface{}{"type": auth.Type, "description": auth.Description}
+	}
+
+	secretMounts, err := cl.Sys().ListMounts()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing secrets engines")
+	}
+	mounts := map[string]map[string]interface{}{}
+	for path, mount := range secretMounts {
+		mounts[path] = mountOutputToMap(mount)
+	}
+
+	names, err := cl.Sys().ListPolicies()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing policies")
+	}
+	policies := map[string]string{}
+	for _, name := range names {
+		rules, err := cl.Sys().GetPolicy(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading policy %s", name)
+		}
+		policies[name] = rules
+	}
+
+	return hashicorp.ExternalConfig(auths, mounts, policies), nil
+}
+
+func mountOutputToMap(mount *api.MountOutput) map[string]interface{} {
+	options := map[string]interface{}{}
+	for key, value := range mount.Options {
+		options[key] = value
+	}
+	return map[string]interface{}{"type": mount.Type, "description": mount.Description, "options": options}
+}
+
+// migrateWorkloads writes the Vault Agent ConfigMaps and the annotation patches of the workloads using the agent injector
+func migrateWorkloads(k8sClient kubernetes.Interface, namespace, outputDir string) error {
+	type workload struct {
+		kind, namespace, name string
+		annotations           map[string]string
+	}
+
+	var workloads []workload
+
+	deployments, err := k8sClient.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error listing deployments")
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, workload{"deployment", d.Namespace, d.Name, d.Spec.Template.Annotations})
+	}
+
+	statefulSets, err := k8sClient.AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error listing statefulsets")
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, workload{"statefulset", s.Namespace, s.Name, s.Spec.Template.Annotations})
+	}
+
+	daemonSets, err := k8sClient.AppsV1().DaemonSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error listing daemonsets")
+	}
+	for _, d := range daemonSets.Items {
+		workloads = append(workloads, workload{"daemonset", d.Namespace, d.Name, d.Spec.Template.Annotations})
+	}
+
+	for _, w := range workloads {
+		configMapName := w.name + "-vault-agent"
+
+		migration, ok := hashicorp.MigrateAnnotations(w.annotations, configMapName)
+		if !ok {
+			continue
+		}
+
+		prefix := filepath.Join(outputDir, strings.Join([]string{w.kind, w.namespace, w.name}, "-"))
+
+		configMap := corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: w.namespace},
+			Data:       map[string]string{"config.hcl": migration.AgentConfig},
+		}
+		if err := writeYAML(prefix+"-vault-agent.yaml", configMap); err != nil {
+			return err
+		}
+
+		patch := map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"annotations": migration.Annotations},
+				},
+			},
+		}
+		if err := writeYAML(prefix+"-patch.yaml", patch); err != nil {
+			return err
+		}
+
+		logrus.Infof("migrated the agent injector annotations of %s %s/%s", w.kind, w.namespace, w.name)
+		for _, warning := range migration.Warnings {
+			logrus.Warnf("%s %s/%s: %s", w.kind, w.namespace, w.name, warning)
+		}
+	}
+
+	return nil
+}
+
+func writeYAML(file string, object interface{}) error {
+	content, err := yaml.Marshal(object)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling %s", file)
+	}
+
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return errors.Wrapf(err, "error writing %s", file)
+	}
+
+	logrus.Infof("%s written", file)
+
+	return nil
+}
+
+func init() {
+	migrateFromHashicorpCmd.PersistentFlags().String(cfgMigrateRelease, "vault", "the name of the helm release of the HashiCorp Vault chart")
+	migrateFromHashicorpCmd.PersistentFlags().String(cfgMigrateReleaseNamespace, "default", "the namespace of the helm release")
+	migrateFromHashicorpCmd.PersistentFlags().String(cfgMigrateWorkloadNamespace, "", "the namespace of the workloads to migrate from the agent injector, all namespaces if empty")
+	migrateFromHashicorpCmd.PersistentFlags().Bool(cfgMigrateVaultConfig, false, "add the auth methods, secrets engines and policies of the running vault to the external configuration")
+	migrateFromHashicorpCmd.PersistentFlags().String(cfgMigrateOutputDir, ".", "the directory to write the generated resources to")
+
+	rootCmd.AddCommand(migrateFromHashicorpCmd)
+}
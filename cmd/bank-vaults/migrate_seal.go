@@ -0,0 +1,88 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgMigrateSealAddresses = "vault-addresses"
+
+var migrateSealCmd = &cobra.Command{
+	Use:   "migrate-seal",
+	Short: "Migrates the seal of the target Vault instances between Shamir and auto-unseal",
+	Long: `This command unseals the target Vault instances which have been restarted with
+a new seal configuration in migration mode (the -migrate flag of "vault operator unseal"),
+then stores the migrated keys in the key store under their new names:
+
+- from Shamir to auto-unseal the unseal keys are submitted and stored as recovery keys,
+- from auto-unseal to Shamir the recovery keys are submitted and stored as unseal keys.
+
+In a HA cluster, list the standby instances first and the active instance last with
+--vault-addresses, the instances are migrated one by one in this order. If not set
+the address from VAULT_ADDR is used. Instances which are not in migration mode are skipped.
+
+The key store has to be configured for the seal Vault is migrating from, the keys of the
+previous seal are not removed from it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgLockKeyStore, cmd.PersistentFlags().Lookup(cfgLockKeyStore))                 // nolint
+		appConfig.BindPFlag(cfgMigrateSealAddresses, cmd.PersistentFlags().Lookup(cfgMigrateSealAddresses)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		addresses := appConfig.GetStringSlice(cfgMigrateSealAddresses)
+		if len(addresses) == 0 {
+			addresses = []string{cl.Address()}
+		}
+
+		for _, address := range addresses {
+			if err := cl.SetAddress(address); err != nil {
+				logrus.Fatalf("error setting vault address: %s", err.Error())
+			}
+
+			v, err := vault.New(store, cl, vaultConfig)
+			if err != nil {
+				logrus.Fatalf("error creating vault helper: %s", err.Error())
+			}
+
+			if err = v.MigrateSeal(); err != nil {
+				logrus.Fatalf("error migrating the seal of vault at %s: %s", address, err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	migrateSealCmd.PersistentFlags().Bool(cfgLockKeyStore, false, "should the key store be locked during the migration to prevent concurrent writers")
+	migrateSealCmd.PersistentFlags().StringSlice(cfgMigrateSealAddresses, nil, "addresses of the Vault instances to migrate in order, standby instances first and the active instance last")
+
+	rootCmd.AddCommand(migrateSealCmd)
+}
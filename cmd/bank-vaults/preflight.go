@@ -0,0 +1,160 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/heroku/docker-registry-client/registry"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/internal/mirror"
+)
+
+const (
+	cfgPreflightImage            = "image"
+	cfgPreflightEndpoint         = "endpoint"
+	cfgPreflightImageMirrors     = "image-mirrors"
+	cfgPreflightRegistryUsername = "registry-username"
+	cfgPreflightRegistryPassword = "registry-password"
+	cfgPreflightTimeout          = "timeout"
+)
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Checks that the images and endpoints are reachable from the cluster",
+	Long: `This command checks that the manifest of every --image can be fetched from its registry,
+after rewriting it with the --image-mirrors the same way as the operator and the webhook
+do (IMAGE_MIRRORS), and that every --endpoint accepts connections.
+
+Endpoints with an http or https scheme are checked with a GET request (any response counts),
+the ones without a scheme (host:port) with a TCP connection. Run it in the cluster before
+an air-gapped install, with the images and endpoints the operator and the webhook will use.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgPreflightImage, cmd.PersistentFlags().Lookup(cfgPreflightImage))                       // nolint
+		appConfig.BindPFlag(cfgPreflightEndpoint, cmd.PersistentFlags().Lookup(cfgPreflightEndpoint))                 // nolint
+		appConfig.BindPFlag(cfgPreflightImageMirrors, cmd.PersistentFlags().Lookup(cfgPreflightImageMirrors))         // nolint
+		appConfig.BindPFlag(cfgPreflightRegistryUsername, cmd.PersistentFlags().Lookup(cfgPreflightRegistryUsername)) // nolint
+		appConfig.BindPFlag(cfgPreflightRegistryPassword, cmd.PersistentFlags().Lookup(cfgPreflightRegistryPassword)) // nolint
+		appConfig.BindPFlag(cfgPreflightTimeout, cmd.PersistentFlags().Lookup(cfgPreflightTimeout))                   // nolint
+
+		mirrors, err := mirror.Parse(appConfig.GetString(cfgPreflightImageMirrors))
+		if err != nil {
+			logrus.Fatalf("error parsing image mirrors: %s", err.Error())
+		}
+
+		timeout := appConfig.GetDuration(cfgPreflightTimeout)
+		username := appConfig.GetString(cfgPreflightRegistryUsername)
+		password := appConfig.GetString(cfgPreflightRegistryPassword)
+
+		var failed int
+
+		for _, image := range appConfig.GetStringSlice(cfgPreflightImage) {
+			mirrored := mirrors.Image(image)
+			if err := checkImage(mirrored, username, password); err != nil {
+				logrus.Errorf("image %s (%s) is not available: %s", image, mirrored, err.Error())
+				failed++
+				continue
+			}
+			logrus.Infof("image %s (%s) is available", image, mirrored)
+		}
+
+		for _, endpoint := range appConfig.GetStringSlice(cfgPreflightEndpoint) {
+			if err := checkEndpoint(endpoint, timeout); err != nil {
+				logrus.Errorf("endpoint %s is not reachable: %s", endpoint, err.Error())
+				failed++
+				continue
+			}
+			logrus.Infof("endpoint %s is reachable", endpoint)
+		}
+
+		if failed > 0 {
+			logrus.Fatalf("%d preflight checks failed", failed)
+		}
+	},
+}
+
+// splitReference returns the repository and the tag (or digest) of the repository reference of an image
+func splitReference(repository string) (string, string) {
+	if at := strings.Index(repository, "@"); at != -1 {
+		return repository[:at], repository[at+1:]
+	}
+	if colon := strings.LastIndex(repository, ":"); colon != -1 && !strings.Contains(repository[colon:], "/") {
+		return repository[:colon], repository[colon+1:]
+	}
+	return repository, "latest"
+}
+
+// checkImage fetches the manifest digest of the image from its registry
+func checkImage(image, username, password string) error {
+	registryName, repository := mirror.Split(image)
+	if registryName == "docker.io" {
+		registryName = "index.docker.io"
+	}
+	repository, reference := splitReference(repository)
+
+	reg, err := registry.New("https://"+registryName, username, password)
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to registry %s", registryName)
+	}
+	reg.Logf = registry.Quiet
+
+	if _, err := reg.ManifestDigest(repository, reference); err != nil {
+		return errors.Wrapf(err, "error fetching manifest of %s:%s", repository, reference)
+	}
+
+	return nil
+}
+
+// checkEndpoint connects to the endpoint, URLs are requested, anything else is dialed as host:port
+func checkEndpoint(endpoint string, timeout time.Duration) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		conn, err := net.DialTimeout("tcp", endpoint, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := http.Client{
+		Timeout: timeout,
+		// only the reachability is checked, the certificates are validated by the clients using the endpoints
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, // nolint:gosec
+	}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func init() {
+	preflightCmd.PersistentFlags().StringSlice(cfgPreflightImage, nil, "the images to check, can be repeated")
+	preflightCmd.PersistentFlags().StringSlice(cfgPreflightEndpoint, nil, "the endpoints to check (URLs or host:port), can be repeated")
+	preflightCmd.PersistentFlags().String(cfgPreflightImageMirrors, "", "the image mirrors as comma separated registry=mirror pairs, e.g. docker.io=registry.local/dockerhub")
+	preflightCmd.PersistentFlags().String(cfgPreflightRegistryUsername, "", "the username for the registries")
+	preflightCmd.PersistentFlags().String(cfgPreflightRegistryPassword, "", "the password for the registries")
+	preflightCmd.PersistentFlags().Duration(cfgPreflightTimeout, 10*time.Second, "the timeout of the endpoint checks")
+
+	rootCmd.AddCommand(preflightCmd)
+}
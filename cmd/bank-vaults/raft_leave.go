@@ -0,0 +1,127 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgRaftLeaveOnScaleDown = "raft-leave-on-scale-down"
+
+// statefulSetOrdinal splits the name of a StatefulSet Pod into the name of the StatefulSet and the ordinal of the Pod
+func statefulSetOrdinal(podName string) (string, int, error) {
+	i := strings.LastIndex(podName, "-")
+	if i < 1 {
+		return "", 0, errors.Errorf("pod %s is not part of a StatefulSet", podName)
+	}
+
+	ordinal, err := strconv.Atoi(podName[i+1:])
+	if err != nil {
+		return "", 0, errors.Errorf("pod %s is not part of a StatefulSet", podName)
+	}
+
+	return podName[:i], ordinal, nil
+}
+
+// scaledDown checks if the StatefulSet of the Pod has been scaled below the ordinal of the Pod,
+// which means that the Pod is deleted for good, not restarted
+func scaledDown(podName string) (bool, error) {
+	name, ordinal, err := statefulSetOrdinal(podName)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return false, errors.Wrap(err, "error reading the namespace of the pod")
+	}
+	namespace := strings.TrimSpace(string(content))
+
+	client, err := newKubernetesClient()
+	if err != nil {
+		return false, err
+	}
+
+	statefulSet, err := client.AppsV1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting statefulset %s", name)
+	}
+
+	replicas := 1
+	if statefulSet.Spec.Replicas != nil {
+		replicas = int(*statefulSet.Spec.Replicas)
+	}
+
+	return ordinal >= replicas, nil
+}
+
+// raftPeerOfPod finds the Raft peer of the Pod by its node ID or the host of its cluster address
+func raftPeerOfPod(peers []vault.RaftPeer, podName string) (vault.RaftPeer, bool) {
+	for _, peer := range peers {
+		host, _, err := net.SplitHostPort(peer.Address)
+		if err != nil {
+			host = peer.Address
+		}
+		if peer.ID == podName || host == podName || strings.HasPrefix(host, podName+".") {
+			return peer, true
+		}
+	}
+	return vault.RaftPeer{}, false
+}
+
+// raftLeave removes the Raft peer of the Pod from the cluster if the Pod is deleted by a scale-down,
+// so the remaining servers don't count it in the quorum anymore. The Pod has to be stepped down already.
+func raftLeave(v vault.Vault, podName string) error {
+	down, err := scaledDown(podName)
+	if err != nil {
+		return err
+	}
+	if !down {
+		logrus.Infof("pod %s is not removed by a scale-down, staying in the raft cluster", podName)
+		return nil
+	}
+
+	peers, err := v.RaftPeers()
+	if err != nil {
+		return err
+	}
+
+	peer, ok := raftPeerOfPod(peers, podName)
+	if !ok {
+		logrus.Infof("pod %s is not a raft peer, nothing to remove", podName)
+		return nil
+	}
+
+	if peer.Leader {
+		return errors.Errorf("raft peer %s of pod %s is still the leader", peer.ID, podName)
+	}
+
+	if err := v.RaftRemovePeer(peer.ID); err != nil {
+		return err
+	}
+
+	logrus.Infof("raft peer %s (%s) of pod %s removed from the cluster", peer.ID, peer.Address, podName)
+
+	return nil
+}
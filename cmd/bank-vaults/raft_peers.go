@@ -0,0 +1,161 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgRaftManagePeers = "raft-manage-peers"
+const cfgRaftDeadPeerGracePeriod = "raft-dead-peer-grace-period"
+const cfgRaftServerStabilizationTime = "raft-server-stabilization-time"
+
+// raftState is the latest observed state of the Raft cluster, exported as metrics
+type raftState struct {
+	mu           sync.Mutex
+	peers        float64
+	voters       float64
+	healthy      float64
+	removedPeers float64
+}
+
+var raftClusterState = &raftState{}
+
+func (s *raftState) update(peers []vault.RaftPeer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.peers, s.voters, s.healthy = 0, 0, 0
+	for _, peer := range peers {
+		s.peers++
+		if peer.Voter {
+			s.voters++
+		}
+		if peer.Healthy {
+			s.healthy++
+		}
+	}
+}
+
+func (s *raftState) peerRemoved() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removedPeers++
+}
+
+func (s *raftState) snapshot() raftState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return raftState{peers: s.peers, voters: s.voters, healthy: s.healthy, removedPeers: s.removedPeers}
+}
+
+// raftPeerManager removes the dead peers of the Raft cluster and configures autopilot
+// to promote the non-voters, it acts only on the leader
+type raftPeerManager struct {
+	vault                   vault.Vault
+	deadPeerGracePeriod     time.Duration
+	serverStabilizationTime time.Duration
+
+	unhealthySince      map[string]time.Time
+	autopilotConfigured bool
+}
+
+func newRaftPeerManager(v vault.Vault, deadPeerGracePeriod, serverStabilizationTime time.Duration) *raftPeerManager {
+	return &raftPeerManager{
+		vault:                   v,
+		deadPeerGracePeriod:     deadPeerGracePeriod,
+		serverStabilizationTime: serverStabilizationTime,
+		unhealthySince:          map[string]time.Time{},
+	}
+}
+
+func (m *raftPeerManager) manage() {
+	leader, err := m.vault.Leader()
+	if err != nil || !leader {
+		// the state is only tracked by the leader, a new leader starts the grace periods again
+		m.unhealthySince = map[string]time.Time{}
+		m.autopilotConfigured = false
+		return
+	}
+
+	if m.serverStabilizationTime > 0 && !m.autopilotConfigured {
+		err := m.vault.RaftAutopilotConfigure(map[string]interface{}{
+			"server_stabilization_time": m.serverStabilizationTime.String(),
+		})
+		if err != nil {
+			logrus.Warnf("error configuring raft autopilot: %s", err.Error())
+		} else {
+			logrus.Infof("raft autopilot promotes non-voters after %s", m.serverStabilizationTime)
+			m.autopilotConfigured = true
+		}
+	}
+
+	peers, err := m.vault.RaftPeers()
+	if err != nil {
+		logrus.Errorf("error listing raft peers: %s", err.Error())
+		return
+	}
+
+	raftClusterState.update(peers)
+
+	if m.deadPeerGracePeriod == 0 {
+		return
+	}
+
+	now := time.Now()
+	current := map[string]bool{}
+	for _, peer := range peers {
+		current[peer.ID] = true
+
+		if peer.Healthy || peer.Leader {
+			delete(m.unhealthySince, peer.ID)
+			continue
+		}
+
+		since, ok := m.unhealthySince[peer.ID]
+		if !ok {
+			logrus.Warnf("raft peer %s (%s) is unhealthy", peer.ID, peer.Address)
+			m.unhealthySince[peer.ID] = now
+			continue
+		}
+
+		if now.Sub(since) < m.deadPeerGracePeriod {
+			continue
+		}
+
+		logrus.Warnf("removing raft peer %s (%s), it is unhealthy since %s", peer.ID, peer.Address, since.Format(time.RFC3339))
+		if err := m.vault.RaftRemovePeer(peer.ID); err != nil {
+			logrus.Errorf("error removing raft peer: %s", err.Error())
+			continue
+		}
+
+		delete(m.unhealthySince, peer.ID)
+		raftClusterState.peerRemoved()
+	}
+
+	// forget the peers which have left the cluster in the meantime
+	for id := range m.unhealthySince {
+		if !current[id] {
+			delete(m.unhealthySince, id)
+		}
+	}
+}
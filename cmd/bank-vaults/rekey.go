@@ -0,0 +1,69 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgDryRun = "dry-run"
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Replaces the unseal keys of the target Vault instance with new ones",
+	Long: `This command rekeys the unseal keys (or the recovery keys when auto-unseal is used)
+of the unsealed target Vault instance, with the current keys from the key store.
+
+The new keys are split according to --secret-shares and --secret-threshold, they are
+stored in the key store and verified by Vault before they replace the current keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgDryRun, cmd.PersistentFlags().Lookup(cfgDryRun))             // nolint
+		appConfig.BindPFlag(cfgLockKeyStore, cmd.PersistentFlags().Lookup(cfgLockKeyStore)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		if err = v.Rekey(appConfig.GetBool(cfgDryRun)); err != nil {
+			logrus.Fatalf("error rekeying vault: %s", err.Error())
+		}
+	},
+}
+
+func init() {
+	rekeyCmd.PersistentFlags().Bool(cfgDryRun, false, "only check that vault can be rekeyed with the stored keys, without changing anything")
+	rekeyCmd.PersistentFlags().Bool(cfgLockKeyStore, false, "should the key store be locked during rekey to prevent concurrent writers")
+
+	rootCmd.AddCommand(rekeyCmd)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgReplicationType = "replication-type"
+const cfgReplicationSecondaryID = "replication-secondary-id"
+const cfgReplicationTokenTTL = "replication-token-ttl"
+
+var replicationTokenCmd = &cobra.Command{
+	Use:   "replication-token",
+	Short: "Generates a replication activation token for a secondary Vault cluster",
+	Long: `This command generates the activation token of a DR or performance replication
+secondary on the target Vault instance, which has to be the replication primary,
+with the root token from the key store, then prints the wrapped token to stdout.
+
+The token can be stored in a Kubernetes Secret of the secondary cluster, and referenced
+from the replication block of its external configuration to activate the secondary.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgReplicationType, cmd.PersistentFlags().Lookup(cfgReplicationType))               // nolint
+		appConfig.BindPFlag(cfgReplicationSecondaryID, cmd.PersistentFlags().Lookup(cfgReplicationSecondaryID)) // nolint
+		appConfig.BindPFlag(cfgReplicationTokenTTL, cmd.PersistentFlags().Lookup(cfgReplicationTokenTTL))       // nolint
+
+		replicationType := appConfig.GetString(cfgReplicationType)
+		if replicationType != "dr" && replicationType != "performance" {
+			logrus.Fatalf("unknown replication type: %s", replicationType)
+		}
+
+		id := appConfig.GetString(cfgReplicationSecondaryID)
+		if id == "" {
+			logrus.Fatalf("--%s is required", cfgReplicationSecondaryID)
+		}
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		token, err := v.ReplicationSecondaryToken(replicationType, id, appConfig.GetDuration(cfgReplicationTokenTTL))
+		if err != nil {
+			logrus.Fatalf("error generating replication token: %s", err.Error())
+		}
+
+		fmt.Println(token)
+	},
+}
+
+func init() {
+	replicationTokenCmd.PersistentFlags().String(cfgReplicationType, "dr", "the replication type of the secondary: dr or performance")
+	replicationTokenCmd.PersistentFlags().String(cfgReplicationSecondaryID, "", "the unique id of the secondary cluster")
+	replicationTokenCmd.PersistentFlags().Duration(cfgReplicationTokenTTL, 30*time.Minute, "how long the wrapped activation token is valid")
+
+	rootCmd.AddCommand(replicationTokenCmd)
+}
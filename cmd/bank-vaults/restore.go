@@ -0,0 +1,102 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/internal/backup"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgRestoreSnapshot = "snapshot"
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restores a Raft snapshot from an object storage into the target Vault instance",
+	Long: `This command downloads a snapshot stored by the backup command (the latest one by default)
+and force-restores it into the target Vault instance, then unseals it with the unseal keys from
+the key store, which have to be the keys of the cluster the snapshot was taken from.
+
+The target Vault is expected to be a fresh cluster: if it is not initialized yet, it is initialized
+with temporary keys which are discarded by the restore. If it is initialized already, VAULT_TOKEN has
+to be set to a root token of it.
+
+Together with the backup command, this makes disaster recovery drills scriptable.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bindBackupStorageFlags(cmd)
+		appConfig.BindPFlag(cfgRestoreSnapshot, cmd.PersistentFlags().Lookup(cfgRestoreSnapshot)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		storage, err := backupStorageForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating backup storage: %s", err.Error())
+		}
+
+		manager, err := backup.NewManager(storage, appConfig.GetString(cfgBackupEncryptionKey), backup.Retention{})
+		if err != nil {
+			logrus.Fatalf("error creating backup manager: %s", err.Error())
+		}
+
+		snapshot, err := manager.Snapshot(context.Background(), appConfig.GetString(cfgRestoreSnapshot))
+		if err != nil {
+			logrus.Fatalf("error finding snapshot: %s", err.Error())
+		}
+
+		logrus.Infof("restoring snapshot %s", snapshot.Name)
+
+		data, err := manager.DownloadFile(context.Background(), snapshot)
+		if err != nil {
+			logrus.Fatalf("error downloading snapshot: %s", err.Error())
+		}
+
+		err = v.RaftSnapshotRestore(data)
+		_ = data.Close()
+		_ = os.Remove(data.Name())
+		if err != nil {
+			logrus.Fatalf("error restoring snapshot: %s", err.Error())
+		}
+	},
+}
+
+func init() {
+	restoreCmd.PersistentFlags().AddFlagSet(backupStorageFlags)
+	restoreCmd.PersistentFlags().String(cfgRestoreSnapshot, "", "The name of the snapshot to restore (defaults to the latest one)")
+
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,200 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/internal/backup"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const (
+	cfgRestoreDrillPeriod      = "restore-drill-period"
+	cfgRestoreDrillVaultBinary = "restore-drill-vault-binary"
+	cfgRestoreDrillSealConfig  = "restore-drill-seal-config"
+	cfgRestoreDrillReadPaths   = "restore-drill-read-paths"
+)
+
+// restoreDrill verifies the latest snapshot, then restores it into a temporary Vault server and reads
+// the paths from it, the temporary server is stopped and its storage is deleted afterwards
+func restoreDrill(manager *backup.Manager, store vault.KVService, vaultConfig vault.Config, sealConfig string) (backup.Snapshot, error) {
+	snapshot, err := manager.Snapshot(context.Background(), "")
+	if err != nil {
+		return snapshot, errors.Wrap(err, "error finding snapshot")
+	}
+
+	logger := logrus.WithField("snapshot", snapshot.Name)
+	logger.Info("starting restore drill")
+
+	data, err := manager.DownloadFile(context.Background(), snapshot)
+	if err != nil {
+		return snapshot, errors.Wrap(err, "error downloading snapshot")
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	if err := backup.VerifySnapshot(data); err != nil {
+		return snapshot, errors.Wrap(err, "error verifying snapshot")
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return snapshot, errors.Wrap(err, "error rewinding snapshot")
+	}
+
+	logger.Info("snapshot verified, restoring it into a temporary vault")
+
+	temporaryVault, err := backup.StartTemporaryVault(appConfig.GetString(cfgRestoreDrillVaultBinary), sealConfig)
+	if err != nil {
+		return snapshot, err
+	}
+	defer func() {
+		if err := temporaryVault.Stop(); err != nil {
+			logger.Warnf("error stopping temporary vault: %s", err.Error())
+		}
+	}()
+
+	cl, err := vault.NewRawClient()
+	if err != nil {
+		return snapshot, errors.Wrap(err, "error creating vault client")
+	}
+	if err := cl.SetAddress(temporaryVault.Address); err != nil {
+		return snapshot, errors.Wrap(err, "error setting the address of the temporary vault")
+	}
+	// the root token of the snapshot is read from the key store
+	cl.SetToken("")
+
+	v, err := vault.New(store, cl, vaultConfig)
+	if err != nil {
+		return snapshot, errors.Wrap(err, "error creating vault helper")
+	}
+
+	if err := v.RaftSnapshotRestore(data); err != nil {
+		return snapshot, errors.Wrap(err, "error restoring snapshot")
+	}
+
+	if err := v.VerifyReadable(appConfig.GetStringSlice(cfgRestoreDrillReadPaths)); err != nil {
+		return snapshot, errors.Wrap(err, "error reading the restored data")
+	}
+
+	logger.Info("restore drill succeeded")
+
+	return snapshot, nil
+}
+
+var restoreDrillCmd = &cobra.Command{
+	Use:   "restore-drill",
+	Short: "Proves that the latest Raft snapshot is restorable, by restoring it into a temporary Vault",
+	Long: `This command downloads the latest snapshot stored by the backup command and verifies the
+checksums of its archive, then starts an isolated single node Vault server (the binary of
+--restore-drill-vault-binary, listening only on 127.0.0.1, with its Raft storage in a temporary
+directory), force-restores the snapshot into it and unseals it with the keys from the key store,
+just like the restore command. Then the paths of --restore-drill-read-paths are read from it with the
+stored root token, and the temporary server is stopped and its storage is deleted.
+
+When the snapshots are taken from an auto-unsealed cluster, --restore-drill-seal-config has to point
+to a file containing the same seal stanza, which is appended to the config of the temporary server.
+
+The key store is only read, the production cluster is never touched.
+
+With --restore-drill-period the drills run periodically, and the time of the last successful drill,
+its duration, the time of the snapshot it restored and the number of failures are exported as
+Prometheus metrics.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bindBackupStorageFlags(cmd)
+		appConfig.BindPFlag(cfgRestoreDrillPeriod, cmd.PersistentFlags().Lookup(cfgRestoreDrillPeriod))           // nolint
+		appConfig.BindPFlag(cfgRestoreDrillVaultBinary, cmd.PersistentFlags().Lookup(cfgRestoreDrillVaultBinary)) // nolint
+		appConfig.BindPFlag(cfgRestoreDrillSealConfig, cmd.PersistentFlags().Lookup(cfgRestoreDrillSealConfig))   // nolint
+		appConfig.BindPFlag(cfgRestoreDrillReadPaths, cmd.PersistentFlags().Lookup(cfgRestoreDrillReadPaths))     // nolint
+
+		period := appConfig.GetDuration(cfgRestoreDrillPeriod)
+
+		var sealConfig string
+		if file := appConfig.GetString(cfgRestoreDrillSealConfig); file != "" {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				logrus.Fatalf("error reading seal config: %s", err.Error())
+			}
+			sealConfig = "\n" + string(content)
+		}
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		storage, err := backupStorageForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating backup storage: %s", err.Error())
+		}
+
+		manager, err := backup.NewManager(storage, appConfig.GetString(cfgBackupEncryptionKey), backup.Retention{})
+		if err != nil {
+			logrus.Fatalf("error creating backup manager: %s", err.Error())
+		}
+
+		if period == 0 {
+			if _, err := restoreDrill(manager, store, vaultConfig, sealConfig); err != nil {
+				logrus.Fatalf("restore drill failed: %s", err.Error())
+			}
+			return
+		}
+
+		metrics := prometheusExporter{Mode: "restore-drill"}
+		go func() {
+			err := metrics.Run()
+			if err != nil {
+				logrus.Fatalf("error creating prometheus exporter: %s", err.Error())
+			}
+		}()
+
+		for {
+			start := time.Now()
+			snapshot, err := restoreDrill(manager, store, vaultConfig, sealConfig)
+			if err != nil {
+				logrus.Errorf("restore drill failed: %s", err.Error())
+				failedRestoreDrillsCount++
+			} else {
+				lastSuccessfulRestoreDrillTimestamp = float64(time.Now().Unix())
+				lastSuccessfulRestoreDrillDuration = time.Since(start).Seconds()
+				lastRestoreDrillSnapshotTimestamp = float64(snapshot.Time.Unix())
+			}
+
+			time.Sleep(period)
+		}
+	},
+}
+
+func init() {
+	restoreDrillCmd.PersistentFlags().AddFlagSet(backupStorageFlags)
+	restoreDrillCmd.PersistentFlags().Duration(cfgRestoreDrillPeriod, 0, "How often to run restore drills (0 means only once)")
+	restoreDrillCmd.PersistentFlags().String(cfgRestoreDrillVaultBinary, "vault", "The Vault binary to run the temporary server with")
+	restoreDrillCmd.PersistentFlags().String(cfgRestoreDrillSealConfig, "", "A file with the seal stanza of the cluster the snapshots are taken from, for auto-unseal")
+	restoreDrillCmd.PersistentFlags().StringSlice(cfgRestoreDrillReadPaths, []string{"sys/mounts"}, "The paths to read from the restored Vault with the root token")
+
+	rootCmd.AddCommand(restoreDrillCmd)
+}
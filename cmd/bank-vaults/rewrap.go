@@ -0,0 +1,85 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/vaulttransit"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgRotate = "rotate"
+
+var rewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "Re-encrypts the stored keys with the latest version of the encryption key",
+	Long: `This command re-encrypts the unseal keys, recovery keys, the root token and
+the other keys written by bank-vaults in the key store with the latest version of the
+encryption key, optionally rotating the key first. The userpass password records are
+found through the Vault configuration files. It is supported by the vault-transit-k8s mode only.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgRotate, cmd.PersistentFlags().Lookup(cfgRotate))                   // nolint
+		appConfig.BindPFlag(cfgVaultConfigFile, cmd.PersistentFlags().Lookup(cfgVaultConfigFile)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		rewrapper, ok := store.(vaulttransit.Rewrapper)
+		if !ok {
+			logrus.Fatalf("the %s mode doesn't support rewrapping", appConfig.GetString(cfgMode))
+		}
+
+		if appConfig.GetBool(cfgRotate) {
+			if err := rewrapper.Rotate(); err != nil {
+				logrus.Fatalf("error rotating the encryption key: %s", err.Error())
+			}
+			logrus.Info("encryption key rotated")
+		}
+
+		var configs []*viper.Viper
+		for _, vaultConfigFile := range appConfig.GetStringSlice(cfgVaultConfigFile) {
+			configs = append(configs, parseConfiguration(vaultConfigFile))
+		}
+
+		keys, err := vault.StoredKeys(store, configs...)
+		if err != nil {
+			logrus.Fatalf("error listing the stored keys: %s", err.Error())
+		}
+
+		for _, key := range keys {
+			err := rewrapper.Rewrap(key)
+			if kv.IsNotFoundError(err) {
+				continue
+			}
+			if err != nil {
+				logrus.Fatalf("error rewrapping key '%s': %s", key, err.Error())
+			}
+			logrus.Infof("key '%s' rewrapped", key)
+		}
+	},
+}
+
+func init() {
+	rewrapCmd.PersistentFlags().Bool(cfgRotate, false, "should the encryption key be rotated before rewrapping")
+	rewrapCmd.PersistentFlags().StringSlice(cfgVaultConfigFile, nil, "The filename of the YAML/JSON Vault configuration, to find the userpass password records")
+
+	rootCmd.AddCommand(rewrapCmd)
+}
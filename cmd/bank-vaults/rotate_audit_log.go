@@ -0,0 +1,130 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	cfgAuditLogFile      = "audit-log-file"
+	cfgAuditLogKeep      = "audit-log-keep"
+	cfgVaultProcessName  = "vault-process-name"
+	defaultVaultProcName = "vault"
+)
+
+var rotateAuditLogCmd = &cobra.Command{
+	Use:   "rotate-audit-log",
+	Short: "Rotates the log of the file audit devices and makes Vault reopen it",
+	Long: `This command renames the --audit-log-file to <file>.1 (shifting the older rotated
+logs and removing the ones above --audit-log-keep), then sends SIGHUP to the Vault
+process, which makes Vault reopen the files of its file audit devices.
+
+Without --audit-log-file only the signal is sent, which is what the postrotate hook
+of logrotate needs. The Vault process is looked up by name in the process namespace,
+so the containers of the Vault Pod have to share it (shareProcessNamespace).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgAuditLogFile, cmd.PersistentFlags().Lookup(cfgAuditLogFile))         // nolint
+		appConfig.BindPFlag(cfgAuditLogKeep, cmd.PersistentFlags().Lookup(cfgAuditLogKeep))         // nolint
+		appConfig.BindPFlag(cfgVaultProcessName, cmd.PersistentFlags().Lookup(cfgVaultProcessName)) // nolint
+
+		if file := appConfig.GetString(cfgAuditLogFile); file != "" {
+			if err := rotateFile(file, appConfig.GetInt(cfgAuditLogKeep)); err != nil {
+				logrus.Fatalf("error rotating audit log: %s", err.Error())
+			}
+		}
+
+		pid, err := findProcess(appConfig.GetString(cfgVaultProcessName))
+		if err != nil {
+			logrus.Fatalf("error finding vault process: %s", err.Error())
+		}
+
+		if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+			logrus.Fatalf("error signalling vault process %d: %s", pid, err.Error())
+		}
+
+		logrus.Infof("vault process %d signalled to reopen its audit logs", pid)
+	},
+}
+
+// rotateFile renames the file to file.1, file.1 to file.2 and so on, the files above keep are removed
+func rotateFile(file string, keep int) error {
+	if keep < 1 {
+		return errors.Errorf("at least one rotated file has to be kept, got %d", keep)
+	}
+
+	if err := os.Remove(fmt.Sprintf("%s.%d", file, keep)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing the oldest rotated file")
+	}
+
+	for i := keep - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", file, i), fmt.Sprintf("%s.%d", file, i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "error shifting rotated file %d", i)
+		}
+	}
+
+	if err := os.Rename(file, file+".1"); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error rotating file")
+	}
+
+	return nil
+}
+
+// findProcess returns the PID of the process with the name, it looks for it in /proc
+func findProcess(name string) (int, error) {
+	comms, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return 0, errors.Wrap(err, "error listing processes")
+	}
+
+	for _, comm := range comms {
+		content, err := ioutil.ReadFile(comm)
+		if err != nil {
+			// the process may have exited since listing
+			continue
+		}
+		if strings.TrimSpace(string(content)) != name {
+			continue
+		}
+
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(comm)))
+		if err != nil {
+			continue
+		}
+		if pid != os.Getpid() {
+			return pid, nil
+		}
+	}
+
+	return 0, errors.Errorf("no process named %s, is the process namespace shared with vault?", name)
+}
+
+func init() {
+	rotateAuditLogCmd.PersistentFlags().String(cfgAuditLogFile, "", "the audit log file to rotate, only the signal is sent if it is empty")
+	rotateAuditLogCmd.PersistentFlags().Int(cfgAuditLogKeep, 5, "the number of rotated audit log files to keep")
+	rotateAuditLogCmd.PersistentFlags().String(cfgVaultProcessName, defaultVaultProcName, "the name of the vault process to signal")
+
+	rootCmd.AddCommand(rotateAuditLogCmd)
+}
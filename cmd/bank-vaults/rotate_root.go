@@ -0,0 +1,65 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+var rotateRootCmd = &cobra.Command{
+	Use:   "rotate-root",
+	Short: "Replaces the root token of the target Vault instance with a new one",
+	Long: `This command generates a new root token for the unsealed target Vault instance
+with the unseal keys (or recovery keys when auto-unseal is used) from the key store,
+stores it in the key store, then revokes the previous root token.
+
+The operation is logged with the accessors of the tokens, the tokens itself are never logged.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgLockKeyStore, cmd.PersistentFlags().Lookup(cfgLockKeyStore)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		if err = v.RotateRoot(); err != nil {
+			logrus.Fatalf("error rotating root token: %s", err.Error())
+		}
+	},
+}
+
+func init() {
+	rotateRootCmd.PersistentFlags().Bool(cfgLockKeyStore, false, "should the key store be locked during the rotation to prevent concurrent writers")
+
+	rootCmd.AddCommand(rotateRootCmd)
+}
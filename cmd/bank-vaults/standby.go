@@ -0,0 +1,170 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/internal/backup"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgStandbyPeriod = "standby-period"
+
+// restoreStandby restores the snapshot into the standby Vault, then seals it again. After the first
+// restore the standby holds the data of the primary, so it is unsealed with the primary's keys and
+// its root token from the key store for the next restores.
+func restoreStandby(manager *backup.Manager, store vault.KVService, cl *api.Client, v vault.Vault, snapshot backup.Snapshot) error {
+	data, err := manager.DownloadFile(context.Background(), snapshot)
+	if err != nil {
+		return errors.Wrap(err, "error downloading snapshot")
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	if err := backup.VerifySnapshot(data); err != nil {
+		return errors.Wrap(err, "error verifying snapshot")
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "error rewinding snapshot")
+	}
+
+	status, err := cl.Sys().SealStatus()
+	if err != nil {
+		return errors.Wrap(err, "error checking status")
+	}
+
+	if status.Initialized {
+		if status.Sealed {
+			if err := v.Unseal(); err != nil {
+				return errors.Wrap(err, "error unsealing the standby vault for the restore")
+			}
+		}
+
+		rootToken, err := store.Get("vault-root")
+		if err != nil {
+			return errors.Wrap(err, "error getting the root token of the primary vault")
+		}
+		cl.SetToken(string(rootToken))
+		defer cl.SetToken("")
+	}
+
+	if err := v.RaftSnapshotRestore(data); err != nil {
+		return errors.Wrap(err, "error restoring snapshot")
+	}
+
+	return errors.Wrap(v.Seal(), "error sealing the standby vault after the restore")
+}
+
+var standbyCmd = &cobra.Command{
+	Use:   "standby",
+	Short: "Keeps a standby Vault restored from the latest Raft snapshot of a primary Vault, sealed",
+	Long: `This command keeps a warm standby of a primary Vault cluster, for example in another
+Kubernetes cluster or region, without Vault Enterprise DR replication. Every --standby-period it
+looks for the latest snapshot stored by the backup command of the primary, and if it is newer than
+the last restored one, it verifies and force-restores it into the target Vault (just like the restore
+command), then seals the target Vault again, so that it doesn't serve requests.
+
+The key store has to be the key store of the primary (read-only access is enough), since the restored
+data is unsealed with the primary's keys.
+
+For a failover, stop this command and unseal the standby with the unseal command, it serves the data
+of the latest restored snapshot afterwards. The time of the last restore, the time of the snapshot it
+restored and the number of failures are exported as Prometheus metrics.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bindBackupStorageFlags(cmd)
+		appConfig.BindPFlag(cfgStandbyPeriod, cmd.PersistentFlags().Lookup(cfgStandbyPeriod)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+		// the token of the primary is read from the key store when it is needed
+		cl.SetToken("")
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		storage, err := backupStorageForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating backup storage: %s", err.Error())
+		}
+
+		manager, err := backup.NewManager(storage, appConfig.GetString(cfgBackupEncryptionKey), backup.Retention{})
+		if err != nil {
+			logrus.Fatalf("error creating backup manager: %s", err.Error())
+		}
+
+		metrics := prometheusExporter{Mode: "standby"}
+		go func() {
+			err := metrics.Run()
+			if err != nil {
+				logrus.Fatalf("error creating prometheus exporter: %s", err.Error())
+			}
+		}()
+
+		period := appConfig.GetDuration(cfgStandbyPeriod)
+		var restored time.Time
+
+		for {
+			snapshot, err := manager.Snapshot(context.Background(), "")
+			if err != nil {
+				logrus.Errorf("error finding snapshot: %s", err.Error())
+				failedStandbyRestoresCount++
+			} else if snapshot.Time.After(restored) {
+				logrus.Infof("restoring snapshot %s into the standby vault", snapshot.Name)
+
+				if err := restoreStandby(manager, store, cl, v, snapshot); err != nil {
+					logrus.Errorf("error restoring the standby vault: %s", err.Error())
+					failedStandbyRestoresCount++
+				} else {
+					logrus.Infof("snapshot %s restored, the standby vault is sealed", snapshot.Name)
+					restored = snapshot.Time
+					lastSuccessfulStandbyRestoreTimestamp = float64(time.Now().Unix())
+					lastStandbySnapshotTimestamp = float64(snapshot.Time.Unix())
+				}
+			}
+
+			time.Sleep(period)
+		}
+	},
+}
+
+func init() {
+	standbyCmd.PersistentFlags().AddFlagSet(backupStorageFlags)
+	standbyCmd.PersistentFlags().Duration(cfgStandbyPeriod, 15*time.Minute, "How often to look for a new snapshot of the primary vault")
+
+	rootCmd.AddCommand(standbyCmd)
+}
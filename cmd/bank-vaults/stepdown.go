@@ -0,0 +1,168 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+const cfgStepDownTimeout = "stepdown-timeout"
+
+const stepDownPollInterval = time.Second
+
+// waitFor calls condition every stepDownPollInterval until it returns true, or the deadline passes
+func waitFor(deadline time.Time, what string, condition func() (bool, error)) error {
+	for {
+		done, err := condition()
+		if err == nil && done {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return errors.Wrapf(err, "timed out waiting for %s", what)
+			}
+			return errors.Errorf("timed out waiting for %s", what)
+		}
+
+		if err != nil {
+			logrus.Debugf("waiting for %s: %s", what, err.Error())
+		}
+
+		time.Sleep(stepDownPollInterval)
+	}
+}
+
+// stepDown steps down the target Vault if it is the active node, waits for another node to take over,
+// then for the target Vault to be a standby of the new active node
+func stepDown(cl *api.Client, v vault.Vault, timeout time.Duration) error {
+	leader, err := cl.Sys().Leader()
+	if err != nil {
+		return errors.Wrap(err, "error checking leader")
+	}
+
+	if !leader.HAEnabled {
+		logrus.Info("vault is not running in HA mode, nothing to step down")
+		return nil
+	}
+	if !leader.IsSelf {
+		logrus.Infof("vault is not the active node (the leader is %s), nothing to step down", leader.LeaderAddress)
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	logrus.Infof("stepping down the active vault at %s", cl.Address())
+
+	if err := v.StepDownActive(cl.Address()); err != nil {
+		return errors.Wrap(err, "error stepping down the active vault")
+	}
+
+	var newLeader string
+	err = waitFor(deadline, "a new leader", func() (bool, error) {
+		leader, err := cl.Sys().Leader()
+		if err != nil {
+			return false, err
+		}
+		newLeader = leader.LeaderAddress
+		return !leader.IsSelf && newLeader != "", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("%s is the new active node", newLeader)
+
+	err = waitFor(deadline, "vault to rejoin as standby", func() (bool, error) {
+		health, err := cl.Sys().Health()
+		if err != nil {
+			return false, err
+		}
+		return !health.Sealed && (health.Standby || health.PerformanceStandby), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.Info("vault rejoined the cluster as standby")
+
+	return nil
+}
+
+var stepDownCmd = &cobra.Command{
+	Use:   "stepdown",
+	Short: "Gracefully steps down the target Vault instance if it is the active node",
+	Long: `This command steps down the target Vault instance with the root token from the key store
+if it is the active node of an HA cluster, waits for another node to become the active node, then
+confirms that the target Vault instance rejoined the cluster as a standby. It does nothing if the
+target Vault instance is a standby already, or not running in HA mode.
+
+It is meant to run right before the active node is restarted, for example from a preStop hook of
+the Vault Pod during a rolling upgrade, so the leadership is handed over before the restart
+instead of after the active node disappears.
+
+With --raft-leave-on-scale-down the Raft peer of the Pod (identified by the POD_NAME
+environment variable) is removed from the cluster after the step down, if the StatefulSet of
+the Pod has been scaled below its ordinal.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgStepDownTimeout, cmd.PersistentFlags().Lookup(cfgStepDownTimeout))           // nolint
+		appConfig.BindPFlag(cfgRaftLeaveOnScaleDown, cmd.PersistentFlags().Lookup(cfgRaftLeaveOnScaleDown)) // nolint
+
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		cl, err := vault.NewRawClient()
+		if err != nil {
+			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		}
+
+		vaultConfig, err := vaultConfigForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error building vault config: %s", err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			logrus.Fatalf("error creating vault helper: %s", err.Error())
+		}
+
+		if err := stepDown(cl, v, appConfig.GetDuration(cfgStepDownTimeout)); err != nil {
+			logrus.Fatalf("error stepping down vault: %s", err.Error())
+		}
+
+		if appConfig.GetBool(cfgRaftLeaveOnScaleDown) {
+			if err := raftLeave(v, os.Getenv("POD_NAME")); err != nil {
+				logrus.Fatalf("error leaving the raft cluster: %s", err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	stepDownCmd.PersistentFlags().Duration(cfgStepDownTimeout, 20*time.Second, "how long to wait for a new leader, and for vault to rejoin as standby")
+	stepDownCmd.PersistentFlags().Bool(cfgRaftLeaveOnScaleDown, false, "remove the raft peer of the pod from the cluster if its statefulset has been scaled down")
+
+	rootCmd.AddCommand(stepDownCmd)
+}
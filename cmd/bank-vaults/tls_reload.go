@@ -0,0 +1,63 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const cfgTLSReloadFile = "tls-reload-file"
+
+const tlsReloadPollInterval = 10 * time.Second
+
+// watchTLSReload sends SIGHUP to the Vault process whenever the content of the certificate file changes,
+// which makes Vault reload the certificates of its listeners without a restart.
+// The containers of the Vault Pod have to share the process namespace for this.
+func watchTLSReload(file string) {
+	previous, err := ioutil.ReadFile(file)
+	if err != nil {
+		logrus.Warnf("error reading tls certificate %s: %s", file, err.Error())
+	}
+
+	for range time.Tick(tlsReloadPollInterval) {
+		current, err := ioutil.ReadFile(file)
+		if err != nil {
+			logrus.Warnf("error reading tls certificate %s: %s", file, err.Error())
+			continue
+		}
+		if bytes.Equal(previous, current) {
+			continue
+		}
+
+		pid, err := findProcess(defaultVaultProcName)
+		if err != nil {
+			logrus.Errorf("error finding vault process to reload tls certificate: %s", err.Error())
+			continue
+		}
+
+		if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+			logrus.Errorf("error signalling vault process %d: %s", pid, err.Error())
+			continue
+		}
+
+		logrus.Infof("tls certificate %s changed, vault process %d signalled to reload it", file, pid)
+		previous = current
+	}
+}
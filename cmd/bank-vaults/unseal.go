@@ -15,12 +15,18 @@
 package main
 
 import (
+	"context"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/banzaicloud/bank-vaults/internal/hooks"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/recovery"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/unsealer"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
@@ -40,6 +46,9 @@ type unsealCfg struct {
 	raft              bool
 	raftLeaderAddress string
 	raftSecondary     bool
+	raftManagePeers   bool
+	hooks             *hooks.Hooks
+	vaultAddr         string
 }
 
 var unsealCmd = &cobra.Command{
@@ -53,16 +62,28 @@ from one of the followings:
 - Alibaba KMS (backed by OSS)
 - Kubernetes Secrets (should be used only for development purposes)`,
 	Run: func(cmd *cobra.Command, args []string) {
-		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))           // nolint
-		appConfig.BindPFlag(cfgInit, cmd.PersistentFlags().Lookup(cfgInit))                           // nolint
-		appConfig.BindPFlag(cfgRaft, cmd.PersistentFlags().Lookup(cfgRaft))                           // nolint
-		appConfig.BindPFlag(cfgRaftLeaderAddress, cmd.PersistentFlags().Lookup(cfgRaftLeaderAddress)) // nolint
-		appConfig.BindPFlag(cfgRaftSecondary, cmd.PersistentFlags().Lookup(cfgRaftSecondary))         // nolint
-		appConfig.BindPFlag(cfgOnce, cmd.PersistentFlags().Lookup(cfgOnce))                           // nolint
-		appConfig.BindPFlag(cfgInitRootToken, cmd.PersistentFlags().Lookup(cfgInitRootToken))         // nolint
-		appConfig.BindPFlag(cfgStoreRootToken, cmd.PersistentFlags().Lookup(cfgStoreRootToken))       // nolint
-		appConfig.BindPFlag(cfgPreFlightChecks, cmd.PersistentFlags().Lookup(cfgPreFlightChecks))     // nolint
-		appConfig.BindPFlag(cfgAuto, cmd.PersistentFlags().Lookup(cfgAuto))                           // nolint
+		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))                               // nolint
+		appConfig.BindPFlag(cfgInit, cmd.PersistentFlags().Lookup(cfgInit))                                               // nolint
+		appConfig.BindPFlag(cfgRaft, cmd.PersistentFlags().Lookup(cfgRaft))                                               // nolint
+		appConfig.BindPFlag(cfgRaftLeaderAddress, cmd.PersistentFlags().Lookup(cfgRaftLeaderAddress))                     // nolint
+		appConfig.BindPFlag(cfgRaftSecondary, cmd.PersistentFlags().Lookup(cfgRaftSecondary))                             // nolint
+		appConfig.BindPFlag(cfgOnce, cmd.PersistentFlags().Lookup(cfgOnce))                                               // nolint
+		appConfig.BindPFlag(cfgInitRootToken, cmd.PersistentFlags().Lookup(cfgInitRootToken))                             // nolint
+		appConfig.BindPFlag(cfgStoreRootToken, cmd.PersistentFlags().Lookup(cfgStoreRootToken))                           // nolint
+		appConfig.BindPFlag(cfgPreFlightChecks, cmd.PersistentFlags().Lookup(cfgPreFlightChecks))                         // nolint
+		appConfig.BindPFlag(cfgLockKeyStore, cmd.PersistentFlags().Lookup(cfgLockKeyStore))                               // nolint
+		appConfig.BindPFlag(cfgAuto, cmd.PersistentFlags().Lookup(cfgAuto))                                               // nolint
+		appConfig.BindPFlag(cfgInitAuditFilePath, cmd.PersistentFlags().Lookup(cfgInitAuditFilePath))                     // nolint
+		appConfig.BindPFlag(cfgRecoveryShares, cmd.PersistentFlags().Lookup(cfgRecoveryShares))                           // nolint
+		appConfig.BindPFlag(cfgRecoveryThreshold, cmd.PersistentFlags().Lookup(cfgRecoveryThreshold))                     // nolint
+		appConfig.BindPFlag(cfgStoredShares, cmd.PersistentFlags().Lookup(cfgStoredShares))                               // nolint
+		appConfig.BindPFlag(cfgPGPKeys, cmd.PersistentFlags().Lookup(cfgPGPKeys))                                         // nolint
+		appConfig.BindPFlag(cfgRecoveryPGPKeys, cmd.PersistentFlags().Lookup(cfgRecoveryPGPKeys))                         // nolint
+		appConfig.BindPFlag(cfgWrapRootTokenTTL, cmd.PersistentFlags().Lookup(cfgWrapRootTokenTTL))                       // nolint
+		appConfig.BindPFlag(cfgRaftManagePeers, cmd.PersistentFlags().Lookup(cfgRaftManagePeers))                         // nolint
+		appConfig.BindPFlag(cfgRaftDeadPeerGracePeriod, cmd.PersistentFlags().Lookup(cfgRaftDeadPeerGracePeriod))         // nolint
+		appConfig.BindPFlag(cfgRaftServerStabilizationTime, cmd.PersistentFlags().Lookup(cfgRaftServerStabilizationTime)) // nolint
+		appConfig.BindPFlag(cfgTLSReloadFile, cmd.PersistentFlags().Lookup(cfgTLSReloadFile))                             // nolint
 
 		var unsealConfig unsealCfg
 
@@ -73,11 +94,13 @@ from one of the followings:
 		unsealConfig.raft = appConfig.GetBool(cfgRaft)
 		unsealConfig.raftLeaderAddress = appConfig.GetString(cfgRaftLeaderAddress)
 		unsealConfig.raftSecondary = appConfig.GetBool(cfgRaftSecondary)
+		unsealConfig.raftManagePeers = appConfig.GetBool(cfgRaftManagePeers)
 
 		store, err := kvStoreForConfig(appConfig)
 		if err != nil {
 			logrus.Fatalf("error creating kv store: %s", err.Error())
 		}
+		store = countKVErrors(store)
 
 		cl, err := vault.NewRawClient()
 		if err != nil {
@@ -89,12 +112,22 @@ from one of the followings:
 			logrus.Fatalf("error building vault config: %s", err.Error())
 		}
 
+		unsealConfig.hooks, err = hooksForConfig(appConfig)
+		if err != nil {
+			logrus.Fatalf("error loading hooks: %s", err.Error())
+		}
+		unsealConfig.vaultAddr = vault.ConfigAddress(cl.Address())
+
+		vaultConfig.InitHook = func() {
+			_ = unsealConfig.hooks.Fire(hooks.EventInit, unsealConfig.vaultAddr, nil) // the hooks log their errors
+		}
+
 		v, err := vault.New(store, cl, vaultConfig)
 		if err != nil {
 			logrus.Fatalf("error creating vault helper: %s", err.Error())
 		}
 
-		metrics := prometheusExporter{Vault: v, Mode: "unseal"}
+		metrics := prometheusExporter{Vault: v, Mode: "unseal", Raft: unsealConfig.raftManagePeers}
 		go func() {
 			err := metrics.Run()
 			if err != nil {
@@ -102,81 +135,65 @@ from one of the followings:
 			}
 		}()
 
-		if unsealConfig.proceedInit && unsealConfig.raft {
-			logrus.Info("joining leader vault...")
+		if file := appConfig.GetString(cfgTLSReloadFile); file != "" {
+			go watchTLSReload(file)
+		}
 
-			initialized, err := v.RaftInitialized()
-			if err != nil {
-				sealed, sErr := v.Sealed()
-				if sErr != nil || sealed {
-					logrus.Fatalf("error checking if vault is initialized: %s", err.Error())
+		// the attempts since the last unseal, including the successful one
+		var attempts int
+		unsealerOptions := []unsealer.Option{
+			unsealer.WithPeriod(unsealConfig.unsealPeriod),
+			unsealer.WithUnsealHook(func() {
+				data := map[string]string{"attempts": strconv.Itoa(attempts)}
+				attempts = 0
+				_ = unsealConfig.hooks.Fire(hooks.EventUnseal, unsealConfig.vaultAddr, data) // the hooks log their errors
+			}),
+			unsealer.WithUnsealAttemptHook(func(err error) {
+				attempts++
+				unsealAttemptsCount++
+				if err != nil {
+					failedUnsealAttemptsCount++
 				}
-				logrus.Warnf("error checking if vault is initialized, but vault is unsealed so continuing: %s", err.Error())
-			}
+			}),
+			unsealer.WithPanicHook(func(*recovery.Panic) { unsealPanicsCount++ }),
+		}
+		if unsealConfig.raft {
+			unsealerOptions = append(unsealerOptions, unsealer.WithRaft(strings.Split(unsealConfig.raftLeaderAddress, ",")...))
+		}
+		if unsealConfig.raftSecondary {
+			unsealerOptions = append(unsealerOptions, unsealer.WithRaftSecondary())
+		}
+		if unsealConfig.auto {
+			unsealerOptions = append(unsealerOptions, unsealer.WithAutoUnseal())
+		}
+		if unsealConfig.raftManagePeers {
+			peerManager := newRaftPeerManager(v,
+				appConfig.GetDuration(cfgRaftDeadPeerGracePeriod),
+				appConfig.GetDuration(cfgRaftServerStabilizationTime))
+			unsealerOptions = append(unsealerOptions, unsealer.WithCheckHook(peerManager.manage))
+		}
 
-			// If this is the first instance we have to init it, this happens once in the clusters lifetime
-			if !initialized && !unsealConfig.raftSecondary {
-				logrus.Info("initializing vault...")
-				if err := v.Init(); err != nil {
-					logrus.Fatalf("error initializing vault: %s", err.Error())
-				}
-			} else {
-				logrus.Info("joining raft cluster...")
-				if err := v.RaftJoin(unsealConfig.raftLeaderAddress); err != nil {
-					logrus.Fatalf("error joining leader vault: %s", err.Error())
-				}
+		u := unsealer.New(v, unsealerOptions...)
+
+		if unsealConfig.proceedInit {
+			if unsealConfig.raft {
+				logrus.Info("joining leader vault...")
 			}
-		} else if unsealConfig.proceedInit {
-			logrus.Info("initializing vault...")
-			if err := v.Init(); err != nil {
-				logrus.Fatalf("error initializing vault: %s", err.Error())
+			if err := u.Initialize(context.Background()); err != nil {
+				logrus.Fatal(err.Error())
 			}
 		}
 
-		for {
-			if !unsealConfig.auto {
-				unseal(unsealConfig, v)
+		if unsealConfig.runOnce && !unsealConfig.auto {
+			if _, err := u.Unseal(context.Background()); err != nil {
+				logrus.Error(err.Error())
+				os.Exit(1)
 			}
-
-			// wait unsealPeriod before trying again
-			time.Sleep(unsealConfig.unsealPeriod)
+			os.Exit(0)
 		}
-	},
-}
 
-func unseal(unsealConfig unsealCfg, v vault.Vault) {
-	logrus.Debug("checking if vault is sealed...")
-	sealed, err := v.Sealed()
-	if err != nil {
-		logrus.Errorf("error checking if vault is sealed: %s", err.Error())
-		exitIfNecessary(unsealConfig, 1)
-		return
-	}
-
-	// If vault is not sealed, we stop here and wait for another unsealPeriod
-	if !sealed {
-		logrus.Debug("vault is not sealed")
-		exitIfNecessary(unsealConfig, 0)
-		return
-	}
-
-	logrus.Info("vault is sealed, unsealing")
-
-	if err = v.Unseal(); err != nil {
-		logrus.Errorf("error unsealing vault: %s", err.Error())
-		exitIfNecessary(unsealConfig, 1)
-		return
-	}
-
-	logrus.Info("successfully unsealed vault")
-
-	exitIfNecessary(unsealConfig, 0)
-}
-
-func exitIfNecessary(unsealConfig unsealCfg, code int) {
-	if unsealConfig.runOnce {
-		os.Exit(code)
-	}
+		_ = u.Watch(context.Background())
+	},
 }
 
 func init() {
@@ -184,12 +201,24 @@ func init() {
 	unsealCmd.PersistentFlags().Bool(cfgInit, false, "Initialize vault instance if not yet initialized")
 	unsealCmd.PersistentFlags().Bool(cfgOnce, false, "Run unseal only once")
 	unsealCmd.PersistentFlags().Bool(cfgRaft, false, "Join leader vault instance in raft mode")
-	unsealCmd.PersistentFlags().String(cfgRaftLeaderAddress, "", "Address of leader vault instance in raft mode")
+	unsealCmd.PersistentFlags().String(cfgRaftLeaderAddress, "", "Address of leader vault instance in raft mode, or comma separated addresses to try in order")
 	unsealCmd.PersistentFlags().Bool(cfgRaftSecondary, false, "This instance should always join a raft leader")
+	unsealCmd.PersistentFlags().Bool(cfgRaftManagePeers, false, "Manage the raft peers on the leader: remove the dead ones and export the cluster state as metrics")
+	unsealCmd.PersistentFlags().Duration(cfgRaftDeadPeerGracePeriod, 10*time.Minute, "How long a raft peer has to be unhealthy before it is removed (0 disables the removal, needs Vault 1.7+)")
+	unsealCmd.PersistentFlags().Duration(cfgRaftServerStabilizationTime, 0, "How long a non-voter has to be healthy before autopilot promotes it to voter (0 keeps the Vault default, needs Vault 1.7+)")
+	unsealCmd.PersistentFlags().String(cfgTLSReloadFile, "", "Send SIGHUP to the vault process when this TLS certificate file changes (needs a shared process namespace)")
 	unsealCmd.PersistentFlags().String(cfgInitRootToken, "", "Root token for the new vault cluster (only if -init=true)")
 	unsealCmd.PersistentFlags().Bool(cfgStoreRootToken, true, "Should the root token be stored in the key store (only if -init=true)")
 	unsealCmd.PersistentFlags().Bool(cfgPreFlightChecks, true, "should the key store be tested first to validate access rights")
+	unsealCmd.PersistentFlags().Bool(cfgLockKeyStore, false, "should the key store be locked during init to prevent concurrent writers (only if -init=true)")
 	unsealCmd.PersistentFlags().Bool(cfgAuto, false, "Run in auto-unseal mode")
+	unsealCmd.PersistentFlags().String(cfgInitAuditFilePath, "", "File path (or stdout) of a file audit device to enable right after init (only if -init=true)")
+	unsealCmd.PersistentFlags().Int(cfgRecoveryShares, 0, "Total count of recovery shares with auto-unseal seals, defaults to secret-shares (only if -init=true)")
+	unsealCmd.PersistentFlags().Int(cfgRecoveryThreshold, 0, "Minimum required recovery shares with auto-unseal seals, defaults to secret-threshold (only if -init=true)")
+	unsealCmd.PersistentFlags().Int(cfgStoredShares, 0, "Count of the shares stored by the seal, for the seals which need it (only if -init=true)")
+	unsealCmd.PersistentFlags().StringSlice(cfgPGPKeys, nil, "Base64 encoded PGP public keys to encrypt the unseal keys with, one per share (only if -init=true)")
+	unsealCmd.PersistentFlags().StringSlice(cfgRecoveryPGPKeys, nil, "Base64 encoded PGP public keys to encrypt the recovery keys with, one per recovery share (only if -init=true)")
+	unsealCmd.PersistentFlags().Duration(cfgWrapRootTokenTTL, 0, "Response-wrap the root token with this TTL and store the wrapping token instead of it (only if -init=true)")
 
 	rootCmd.AddCommand(unsealCmd)
 }
@@ -15,23 +15,36 @@
 package main
 
 import (
+	"os"
+
 	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/banzaicloud/bank-vaults/internal/hooks"
 	"github.com/banzaicloud/bank-vaults/pkg/kv"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/alibabakms"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/alibabaoss"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/awskms"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/azurekv"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/consul"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/dev"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/distributed"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/etcd"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/file"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/gckms"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/gcs"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/hsm"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/k8s"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/localkms"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/multi"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/replicated"
 	"github.com/banzaicloud/bank-vaults/pkg/kv/s3"
 	kvvault "github.com/banzaicloud/bank-vaults/pkg/kv/vault"
+	"github.com/banzaicloud/bank-vaults/pkg/kv/vaulttransit"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
@@ -42,13 +55,54 @@ func vaultConfigForConfig(_ *viper.Viper) (vault.Config, error) {
 		SecretShares:    appConfig.GetInt(cfgSecretShares),
 		SecretThreshold: appConfig.GetInt(cfgSecretThreshold),
 
-		InitRootToken:  appConfig.GetString(cfgInitRootToken),
-		StoreRootToken: appConfig.GetBool(cfgStoreRootToken),
+		RecoveryShares:    appConfig.GetInt(cfgRecoveryShares),
+		RecoveryThreshold: appConfig.GetInt(cfgRecoveryThreshold),
+		StoredShares:      appConfig.GetInt(cfgStoredShares),
+
+		PGPKeys:         appConfig.GetStringSlice(cfgPGPKeys),
+		RecoveryPGPKeys: appConfig.GetStringSlice(cfgRecoveryPGPKeys),
+
+		InitRootToken:    appConfig.GetString(cfgInitRootToken),
+		StoreRootToken:   appConfig.GetBool(cfgStoreRootToken),
+		WrapRootTokenTTL: appConfig.GetDuration(cfgWrapRootTokenTTL),
 
 		PreFlightChecks: appConfig.GetBool(cfgPreFlightChecks),
+		LockKeyStore:    appConfig.GetBool(cfgLockKeyStore),
+
+		InitAuditFilePath: appConfig.GetString(cfgInitAuditFilePath),
+
+		SealStatusCache: vault.NewSealStatusCache(appConfig.GetDuration(cfgSealStatusCacheTTL)),
 	}, nil
 }
 
+// newKubernetesClient returns a client of the cluster of the KUBECONFIG, or of the cluster bank-vaults runs in
+func newKubernetesClient() (kubernetes.Interface, error) {
+	kubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	var config *rest.Config
+
+	var err error
+	if kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating k8s config")
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating k8s client")
+	}
+
+	return client, nil
+}
+
+// hooksForConfig loads the hooks fired after the init, unseal and configure operations
+func hooksForConfig(cfg *viper.Viper) (*hooks.Hooks, error) {
+	return hooks.Load(cfg.GetString(cfgHooksFile))
+}
+
 // all returns true if all values of a string slice are equal to target value
 func all(flags []string, target string) bool {
 	for _, value := range flags {
@@ -74,7 +128,11 @@ func correctValues(flags, choices []string) bool {
 }
 
 func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
-	switch mode := cfg.GetString(cfgMode); mode {
+	return kvStoreForMode(cfg, cfg.GetString(cfgMode))
+}
+
+func kvStoreForMode(cfg *viper.Viper, mode string) (kv.Service, error) {
+	switch mode {
 	case cfgModeValueGoogleCloudKMSGCS:
 		gcs, err := gcs.New(
 			cfg.GetString(cfgGoogleCloudStorageBucket),
@@ -97,66 +155,9 @@ func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
 		return kms, nil
 
 	case cfgModeValueAWSKMS3:
-		var services []kv.Service
-
-		s3Regions := cfg.GetStringSlice(cfgAWSS3Region)
-		s3Buckets := cfg.GetStringSlice(cfgAWSS3Bucket)
-		s3Prefix := cfg.GetString(cfgAWSS3Prefix)
-		s3SSEAlgos := cfg.GetStringSlice(cfgAWS3SSEAlgo)
-		kmsRegions := cfg.GetStringSlice(cfgAWSKMSRegion)
-		kmsKeyIDs := cfg.GetStringSlice(cfgAWSKMSKeyID)
-
-		if len(s3Regions) != len(s3Buckets) {
-			return nil, errors.Errorf("specify the same number of regions and buckets for AWS S3 kv store [%d != %d]", len(s3Regions), len(s3Buckets))
-		}
-
-		if len(kmsRegions) != len(kmsKeyIDs) {
-			return nil, errors.Errorf("specify the same number of regions and key IDs for AWS KMS kv store")
-		}
-
-		// if all the S3 buckets are using AES256 SSE then it's fine for no KMS keys to be defined
-		if !all(s3SSEAlgos, awskms.SseAES256) && len(kmsRegions) != len(s3Regions) {
-			return nil, errors.Errorf("specify the same number of S3 buckets and KMS keys/regions for AWS kv store."+
-				"if any bucket uses AES256 SSE set its key/region to empty strings %v %v %v", kmsKeyIDs, kmsRegions, s3Buckets)
-		}
-
-		if len(s3SSEAlgos) != 0 && len(s3SSEAlgos) != len(s3Buckets) {
-			return nil, errors.Errorf("specify an SSE algorithm for every S3 bucket. if a bucket has no SSE set it to an empty string")
-		} else if len(s3SSEAlgos) == 0 {
-			// if no SSE algorithms have been specified create an empty list. this helps ensure backwards compatibility
-			s3SSEAlgos = make([]string, len(s3Buckets))
-		}
-
-		if !correctValues(s3SSEAlgos, []string{awskms.SseAES256, awskms.SseKMS, ""}) {
-			return nil, errors.Errorf("you have specified one or more incorrect SSE algorithms: %v", s3SSEAlgos)
-		}
-
-		for i := 0; i < len(s3Buckets); i++ {
-			var kmsKeyID string
-			if s3SSEAlgos[i] == awskms.SseKMS {
-				kmsKeyID = kmsKeyIDs[i]
-			} else {
-				kmsKeyID = ""
-			}
-			s3Service, err := s3.New(
-				s3Regions[i],
-				s3Buckets[i],
-				s3Prefix,
-				s3SSEAlgos[i],
-				kmsKeyID,
-			)
-			if err != nil {
-				return nil, errors.Wrap(err, "error creating AWS S3 kv store")
-			}
-			if s3SSEAlgos[i] == "" {
-				kmsService, err := awskms.New(s3Service, kmsRegions[i], kmsKeyIDs[i])
-				if err != nil {
-					return nil, errors.Wrap(err, "error creating AWS KMS kv store")
-				}
-				services = append(services, kmsService)
-			} else {
-				services = append(services, s3Service)
-			}
+		services, err := awsKMSS3Services(cfg)
+		if err != nil {
+			return nil, err
 		}
 
 		return multi.New(services), nil
@@ -220,6 +221,39 @@ func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
 
 		return vault, nil
 
+	// bank-vaults unseal --mode vault-transit-k8s --vault-addr https://root-vault:8200 --vault-role unsealer --vault-transit-key-name downstream --k8s-secret-name vault-unseal-keys
+	case cfgModeValueVaultTransitK8S:
+		k8s, err := k8s.New(
+			cfg.GetString(cfgK8SNamespace),
+			cfg.GetString(cfgK8SSecret),
+			k8sSecretLabels,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating K8S Secret kv store")
+		}
+
+		client, err := vault.NewClientWithOptions(
+			vault.ClientURL(cfg.GetString(cfgVaultAddress)),
+			vault.ClientRole(cfg.GetString(cfgVaultRole)),
+			vault.ClientAuthPath(cfg.GetString(cfgVaultAuthPath)),
+			vault.ClientTokenPath(cfg.GetString(cfgVaultTokenPath)),
+			vault.ClientToken(cfg.GetString(cfgVaultToken)))
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating the client of the remote Vault")
+		}
+
+		transit, err := vaulttransit.New(
+			k8s,
+			client.RawClient(),
+			cfg.GetString(cfgVaultTransitPath),
+			cfg.GetString(cfgVaultTransitKeyName),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating Vault Transit kv store")
+		}
+
+		return transit, nil
+
 	case cfgModeValueK8S:
 		k8s, err := k8s.New(
 			cfg.GetString(cfgK8SNamespace),
@@ -249,6 +283,8 @@ func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
 			TokenLabel: cfg.GetString(cfgHSMTokenLabel),
 			Pin:        cfg.GetString(cfgHSMPin),
 			KeyLabel:   cfg.GetString(cfgHSMKeyLabel),
+
+			TokenLabels: cfg.GetStringSlice(cfgHSMTokenLabels),
 		}
 
 		hsm, err := hsm.New(config, k8s)
@@ -275,6 +311,26 @@ func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
 
 		return hsm, nil
 
+	// BANK_VAULTS_HSM_PIN=banzai bank-vaults unseal --init --mode hsm-pkcs11 --hsm-token-labels partition-a,partition-b --hsm-module-path /usr/lib/libCryptoki2_64.so
+	case cfgModeValueHSMPKCS11:
+		config := hsm.Config{
+			ModulePath:  cfg.GetString(cfgHSMModulePath),
+			Pin:         cfg.GetString(cfgHSMPin),
+			KeyLabel:    cfg.GetString(cfgHSMKeyLabel),
+			TokenLabels: cfg.GetStringSlice(cfgHSMTokenLabels),
+		}
+
+		if len(config.TokenLabels) == 0 {
+			return nil, errors.Errorf("at least one token label is required with --%s in %s mode", cfgHSMTokenLabels, cfgModeValueHSMPKCS11)
+		}
+
+		hsm, err := hsm.New(config, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating HSM kv store")
+		}
+
+		return hsm, nil
+
 	case cfgModeValueDev:
 		dev, err := dev.New()
 		if err != nil {
@@ -291,7 +347,197 @@ func kvStoreForConfig(cfg *viper.Viper) (kv.Service, error) {
 
 		return file, nil
 
+	case cfgModeValueConsul:
+		consul, err := consul.New(
+			cfg.GetString(cfgConsulAddress),
+			cfg.GetString(cfgConsulToken),
+			cfg.GetString(cfgConsulPrefix),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating Consul kv store")
+		}
+
+		encryptionKey := cfg.GetString(cfgConsulEncryptionKey)
+		if encryptionKey == "" {
+			logrus.Warn("no encryption key specified for Consul, the values are stored unencrypted")
+			return consul, nil
+		}
+
+		kms, err := localkms.New(consul, encryptionKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating local kms kv store")
+		}
+
+		return kms, nil
+
+	case cfgModeValueEtcd:
+		etcd, err := etcd.New(etcd.Config{
+			Endpoints: cfg.GetStringSlice(cfgEtcdEndpoints),
+			Prefix:    cfg.GetString(cfgEtcdPrefix),
+			Username:  cfg.GetString(cfgEtcdUsername),
+			Password:  cfg.GetString(cfgEtcdPassword),
+			CertFile:  cfg.GetString(cfgEtcdCertFile),
+			KeyFile:   cfg.GetString(cfgEtcdKeyFile),
+			CAFile:    cfg.GetString(cfgEtcdCAFile),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating etcd kv store")
+		}
+
+		encryptionKey := cfg.GetString(cfgEtcdEncryptionKey)
+		if encryptionKey == "" {
+			logrus.Warn("no encryption key specified for etcd, the values are stored unencrypted")
+			return etcd, nil
+		}
+
+		kms, err := localkms.New(etcd, encryptionKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating local kms kv store")
+		}
+
+		return kms, nil
+
+	case cfgModeValueReplicated:
+		var replicas []kv.Service
+
+		for _, replicaMode := range cfg.GetStringSlice(cfgReplicatedModes) {
+			switch replicaMode {
+			case cfgModeValueReplicated:
+				return nil, errors.New("replicated kv stores can't be nested")
+
+			// every bucket is a separate replica, so the regions can be lost independently
+			case cfgModeValueAWSKMS3:
+				services, err := awsKMSS3Services(cfg)
+				if err != nil {
+					return nil, err
+				}
+				replicas = append(replicas, services...)
+
+			default:
+				replica, err := kvStoreForMode(cfg, replicaMode)
+				if err != nil {
+					return nil, errors.Wrapf(err, "error creating %s replica", replicaMode)
+				}
+				replicas = append(replicas, replica)
+			}
+		}
+
+		replicated, err := replicated.New(
+			replicas,
+			cfg.GetInt(cfgReplicatedWriteQuorum),
+			cfg.GetInt(cfgReplicatedReadQuorum),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating replicated kv store")
+		}
+
+		return replicated, nil
+
+	case cfgModeValueDistributed:
+		var backends []kv.Service
+
+		for _, backendMode := range cfg.GetStringSlice(cfgDistributedModes) {
+			if backendMode == cfgModeValueDistributed {
+				return nil, errors.New("distributed kv stores can't be nested")
+			}
+
+			backend, err := kvStoreForMode(cfg, backendMode)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error creating %s backend", backendMode)
+			}
+			backends = append(backends, backend)
+		}
+
+		var rootTokenBackend kv.Service
+		if rootTokenMode := cfg.GetString(cfgDistributedRootTokenMode); rootTokenMode != "" {
+			if rootTokenMode == cfgModeValueDistributed {
+				return nil, errors.New("distributed kv stores can't be nested")
+			}
+
+			var err error
+			rootTokenBackend, err = kvStoreForMode(cfg, rootTokenMode)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error creating %s root token backend", rootTokenMode)
+			}
+		} else if cfg.GetBool(cfgStoreRootToken) {
+			return nil, errors.Errorf("the root token can't be stored in distributed mode without --%s, disable --%s", cfgDistributedRootTokenMode, cfgStoreRootToken)
+		}
+
+		distributed, err := distributed.New(backends, rootTokenBackend)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating distributed kv store")
+		}
+
+		return distributed, nil
+
 	default:
-		return nil, errors.Errorf("unsupported backend mode: '%s'", cfg.GetString(cfgMode))
+		return nil, errors.Errorf("unsupported backend mode: '%s'", mode)
 	}
 }
+
+// awsKMSS3Services returns a kv.Service for each of the configured AWS S3 buckets
+func awsKMSS3Services(cfg *viper.Viper) ([]kv.Service, error) {
+	var services []kv.Service
+
+	s3Regions := cfg.GetStringSlice(cfgAWSS3Region)
+	s3Buckets := cfg.GetStringSlice(cfgAWSS3Bucket)
+	s3Prefix := cfg.GetString(cfgAWSS3Prefix)
+	s3SSEAlgos := cfg.GetStringSlice(cfgAWS3SSEAlgo)
+	kmsRegions := cfg.GetStringSlice(cfgAWSKMSRegion)
+	kmsKeyIDs := cfg.GetStringSlice(cfgAWSKMSKeyID)
+
+	if len(s3Regions) != len(s3Buckets) {
+		return nil, errors.Errorf("specify the same number of regions and buckets for AWS S3 kv store [%d != %d]", len(s3Regions), len(s3Buckets))
+	}
+
+	if len(kmsRegions) != len(kmsKeyIDs) {
+		return nil, errors.Errorf("specify the same number of regions and key IDs for AWS KMS kv store")
+	}
+
+	// if all the S3 buckets are using AES256 SSE then it's fine for no KMS keys to be defined
+	if !all(s3SSEAlgos, awskms.SseAES256) && len(kmsRegions) != len(s3Regions) {
+		return nil, errors.Errorf("specify the same number of S3 buckets and KMS keys/regions for AWS kv store."+
+			"if any bucket uses AES256 SSE set its key/region to empty strings %v %v %v", kmsKeyIDs, kmsRegions, s3Buckets)
+	}
+
+	if len(s3SSEAlgos) != 0 && len(s3SSEAlgos) != len(s3Buckets) {
+		return nil, errors.Errorf("specify an SSE algorithm for every S3 bucket. if a bucket has no SSE set it to an empty string")
+	} else if len(s3SSEAlgos) == 0 {
+		// if no SSE algorithms have been specified create an empty list. this helps ensure backwards compatibility
+		s3SSEAlgos = make([]string, len(s3Buckets))
+	}
+
+	if !correctValues(s3SSEAlgos, []string{awskms.SseAES256, awskms.SseKMS, ""}) {
+		return nil, errors.Errorf("you have specified one or more incorrect SSE algorithms: %v", s3SSEAlgos)
+	}
+
+	for i := 0; i < len(s3Buckets); i++ {
+		var kmsKeyID string
+		if s3SSEAlgos[i] == awskms.SseKMS {
+			kmsKeyID = kmsKeyIDs[i]
+		} else {
+			kmsKeyID = ""
+		}
+		s3Service, err := s3.New(
+			s3Regions[i],
+			s3Buckets[i],
+			s3Prefix,
+			s3SSEAlgos[i],
+			kmsKeyID,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating AWS S3 kv store")
+		}
+		if s3SSEAlgos[i] == "" {
+			kmsService, err := awskms.New(s3Service, kmsRegions[i], kmsKeyIDs[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "error creating AWS KMS kv store")
+			}
+			services = append(services, kmsService)
+		} else {
+			services = append(services, s3Service)
+		}
+	}
+
+	return services, nil
+}
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -62,10 +64,16 @@ var (
 		"VAULT_TRANSIT_PATH":           true,
 		"VAULT_IGNORE_MISSING_SECRETS": true,
 		"VAULT_ENV_PASSTHROUGH":        true,
+		"VAULT_ENV_TRANSFORMS":         true,
 		"VAULT_JSON_LOG":               true,
 		"VAULT_LOG_LEVEL":              true,
 		"VAULT_REVOKE_TOKEN":           true,
 		"VAULT_ENV_DAEMON":             true,
+		"VAULT_ENV_WATCH_SECRETS":      true,
+		"VAULT_ENV_STATUS_FILE":        true,
+		"VAULT_ENV_FILES":              true,
+		"VAULT_ENV_FILES_DIR":          true,
+		"VAULT_ENV_FILES_GROUP_READ":   true,
 	}
 )
 
@@ -134,21 +142,46 @@ func main() {
 	daemonMode := cast.ToBool(os.Getenv("VAULT_ENV_DAEMON"))
 	sigs := make(chan os.Signal, 1)
 
+	// The file templates are rendered before the command is started,
+	// without a command vault-env exits after rendering them (as an init container)
+	var fileTemplates []injector.FileTemplate
+	if files := os.Getenv("VAULT_ENV_FILES"); files != "" {
+		if err := json.Unmarshal([]byte(files), &fileTemplates); err != nil {
+			logger.Fatalln("failed to parse file templates:", err)
+		}
+	}
+
 	var entrypointCmd []string
 	if len(os.Args) == 1 {
-		logger.Fatalln("no command is given, vault-env can't determine the entrypoint (command), please specify it explicitly or let the webhook query it (see documentation)")
+		if len(fileTemplates) == 0 {
+			logger.Fatalln("no command is given, vault-env can't determine the entrypoint (command), please specify it explicitly or let the webhook query it (see documentation)")
+		}
 	} else {
 		entrypointCmd = os.Args[1:]
 	}
 
-	binary, err := exec.LookPath(entrypointCmd[0])
-	if err != nil {
-		logger.Fatalln("binary not found", entrypointCmd[0])
+	var binary string
+	if len(entrypointCmd) > 0 {
+		binary, err = exec.LookPath(entrypointCmd[0])
+		if err != nil {
+			logger.Fatalln("binary not found", entrypointCmd[0])
+		}
 	}
 
 	// Used both for reading secrets and transit encryption
 	ignoreMissingSecrets := cast.ToBool(os.Getenv("VAULT_IGNORE_MISSING_SECRETS"))
 
+	// initial and sanitized environs
+	environ := make(map[string]string, len(os.Environ()))
+	sanitized := make(sanitizedEnviron, 0, len(environ))
+
+	for _, env := range os.Environ() {
+		split := strings.SplitN(env, "=", 2)
+		name := split[0]
+		value := split[1]
+		environ[name] = value
+	}
+
 	// The login procedure takes the token from a file (if using Vault Agent)
 	// or requests one for itself (Kubernetes Auth), so if we got a VAULT_TOKEN
 	// for the special value with "vault:login"
@@ -157,11 +190,24 @@ func main() {
 		os.Unsetenv("VAULT_TOKEN")
 	}
 
+	statusFile := os.Getenv("VAULT_ENV_STATUS_FILE")
+	runStatus := newStatus(environ)
+	writeStatus := func() {
+		if err := runStatus.write(statusFile); err != nil {
+			logger.Warnln("failed to write status:", err)
+		}
+	}
+
+	loginStart := time.Now()
+
 	client, err := vault.NewClientWithOptions(
 		vault.ClientRole(os.Getenv("VAULT_ROLE")),
 		vault.ClientAuthPath(os.Getenv("VAULT_PATH")),
 	)
+	runStatus.LoginDurationMs = milliseconds(time.Since(loginStart))
 	if err != nil {
+		runStatus.failed(reasonAuthFailed, err)
+		writeStatus()
 		logger.Fatal("failed to create vault client", err.Error())
 	}
 
@@ -179,15 +225,17 @@ func main() {
 		}
 	}
 
-	// initial and sanitized environs
-	environ := make(map[string]string, len(os.Environ()))
-	sanitized := make(sanitizedEnviron, 0, len(environ))
+	transforms, err := injector.ParseTransforms(os.Getenv("VAULT_ENV_TRANSFORMS"))
+	if err != nil {
+		logger.Fatalln("failed to parse transforms:", err)
+	}
 
 	config := injector.Config{
 		TransitKeyID:         os.Getenv("VAULT_TRANSIT_KEY_ID"),
 		TransitPath:          os.Getenv("VAULT_TRANSIT_PATH"),
 		DaemonMode:           daemonMode,
 		IgnoreMissingSecrets: ignoreMissingSecrets,
+		Transforms:           transforms,
 	}
 
 	var secretRenewer injector.SecretRenewer
@@ -197,22 +245,39 @@ func main() {
 
 	secretInjector := injector.NewSecretInjector(config, client, secretRenewer, logger)
 
-	for _, env := range os.Environ() {
-		split := strings.SplitN(env, "=", 2)
-		name := split[0]
-		value := split[1]
-		environ[name] = value
+	if len(fileTemplates) > 0 {
+		filesDir := os.Getenv("VAULT_ENV_FILES_DIR")
+		if filesDir == "" {
+			filesDir = "/vault/secrets"
+		}
+
+		groupReadable := cast.ToBool(os.Getenv("VAULT_ENV_FILES_GROUP_READ"))
+
+		if err := secretInjector.RenderFiles(filesDir, fileTemplates, groupReadable); err != nil {
+			logger.Fatalln("failed to render files from vault:", err)
+		}
+
+		if len(entrypointCmd) == 0 {
+			return
+		}
 	}
 
 	inject := func(key, value string) {
 		sanitized.append(key, value)
+		runStatus.resolved(key)
 	}
 
+	injectionStart := time.Now()
 	err = secretInjector.InjectSecretsFromVault(environ, inject)
+	runStatus.InjectionDurationMs = milliseconds(time.Since(injectionStart))
 	if err != nil {
+		runStatus.failed(failureReason(err), err)
+		writeStatus()
 		logger.Fatalln("failed to inject secrets from vault:", err)
 	}
 
+	writeStatus()
+
 	if cast.ToBool(os.Getenv("VAULT_REVOKE_TOKEN")) {
 		// ref: https://www.vaultproject.io/api/auth/token/index.html#revoke-a-token-self-
 		err = client.RawClient().Auth().Token().RevokeSelf(client.RawClient().Token())
@@ -241,6 +306,11 @@ func main() {
 			logger.Fatalln("failed to start process", entrypointCmd, err.Error())
 		}
 
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		if cast.ToBool(os.Getenv("VAULT_ENV_WATCH_SECRETS")) {
+			watchSecrets(watchCtx, client, referencedSecretPaths(environ, client), sigs, logger)
+		}
+
 		go func() {
 			for sig := range sigs {
 				// We don't want to signal a non-running process.
@@ -259,6 +329,7 @@ func main() {
 
 		err = cmd.Wait()
 
+		stopWatching()
 		close(sigs)
 
 		if _, ok := err.(*exec.ExitError); ok {
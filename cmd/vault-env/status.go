@@ -0,0 +1,140 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+
+	"github.com/banzaicloud/bank-vaults/internal/injector"
+)
+
+// Failure reasons reported in the status
+const (
+	reasonAuthFailed       = "auth_failed"
+	reasonPermissionDenied = "permission_denied"
+	reasonSecretMissing    = "secret_missing"
+	reasonError            = "error"
+)
+
+// status is the machine-readable report of a vault-env run, written as a single
+// JSON line to VAULT_ENV_STATUS_FILE (which can be a /dev/fd/N path) before exec.
+// It never contains secret values.
+type status struct {
+	Status     string   `json:"status"`
+	Reason     string   `json:"reason,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Resolved   []string `json:"resolved"`
+	Unresolved []string `json:"unresolved"`
+
+	LoginDurationMs     int64 `json:"loginDurationMs"`
+	InjectionDurationMs int64 `json:"injectionDurationMs"`
+
+	references map[string]bool
+}
+
+func newStatus(environ map[string]string) *status {
+	s := &status{references: map[string]bool{}}
+
+	for name, value := range environ {
+		if strings.HasPrefix(value, "vault:") || strings.HasPrefix(value, ">>vault:") {
+			s.references[name] = false
+		}
+	}
+
+	return s
+}
+
+// resolved marks a reference as injected
+func (s *status) resolved(name string) {
+	if _, ok := s.references[name]; ok {
+		s.references[name] = true
+	}
+}
+
+// failed records the failure and its reason
+func (s *status) failed(reason string, err error) {
+	s.Reason = reason
+	s.Error = err.Error()
+}
+
+// write writes the status to the given path, if any
+func (s *status) write(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	s.Status = "success"
+	if s.Reason != "" {
+		s.Status = "failure"
+	}
+
+	s.Resolved = []string{}
+	s.Unresolved = []string{}
+	for name, resolved := range s.references {
+		if resolved {
+			s.Resolved = append(s.Resolved, name)
+		} else {
+			s.Unresolved = append(s.Unresolved, name)
+		}
+	}
+	sort.Strings(s.Resolved)
+	sort.Strings(s.Unresolved)
+
+	line, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal status")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open status file %s", path)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+
+	return errors.Wrapf(err, "failed to write status file %s", path)
+}
+
+// failureReason classifies an injection error
+func failureReason(err error) string {
+	if injector.IsNotFoundError(err) {
+		return reasonSecretMissing
+	}
+
+	var respErr *vaultapi.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.StatusCode {
+		case http.StatusForbidden:
+			return reasonPermissionDenied
+		case http.StatusNotFound:
+			return reasonSecretMissing
+		}
+	}
+
+	return reasonError
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
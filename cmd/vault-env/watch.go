@@ -0,0 +1,81 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// secretEvents are the event types of the kv secret engines which change the injected values
+const secretEvents = "kv*"
+
+// referencedSecretPaths returns the Vault paths read by the references of the environment,
+// the transit encrypted values and the written paths are left out
+func referencedSecretPaths(environ map[string]string, client *vault.Client) map[string]bool {
+	paths := map[string]bool{}
+	for _, value := range environ {
+		if !strings.HasPrefix(value, "vault:") || value == vaultLogin || client.Transit.IsEncrypted(value) {
+			continue
+		}
+		path := strings.SplitN(strings.TrimPrefix(value, "vault:"), "#", 2)[0]
+		paths[strings.Trim(path, "/")] = true
+	}
+	return paths
+}
+
+// watchSecrets sends SIGTERM to the process when a secret it has been injected from is written or deleted
+// in Vault, so it is restarted with the new values. It subscribes to the event notifications of Vault,
+// which are supported from Vault 1.16, and it doesn't do anything with older versions.
+func watchSecrets(ctx context.Context, client *vault.Client, paths map[string]bool, sigs chan<- os.Signal, logger logrus.FieldLogger) {
+	if len(paths) == 0 {
+		return
+	}
+
+	events, err := vault.NewEventsClient(client.RawClient(), vault.EventsLogger(logger)).Subscribe(ctx, secretEvents)
+	if errors.Is(err, vault.ErrEventsNotSupported) {
+		logger.Warnln("vault doesn't support event notifications, the secrets aren't watched")
+		return
+	}
+	if err != nil {
+		logger.Warnln("failed to watch secrets:", err)
+		return
+	}
+
+	logger.Infof("watching %d secret paths for changes", len(paths))
+
+	go func() {
+		for event := range events {
+			path := strings.Trim(event.Path(), "/")
+			if !paths[path] {
+				continue
+			}
+
+			logger.Infof("secret %s changed (%s), sending SIGTERM to process", path, event.Type)
+			select {
+			case sigs <- syscall.SIGTERM:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}()
+}
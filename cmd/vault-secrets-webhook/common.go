@@ -24,15 +24,26 @@ import (
 )
 
 func getDataFromVault(data map[string]string, vaultClient *vault.Client, vaultConfig VaultConfig, logger logrus.FieldLogger) (map[string]string, error) {
+	data, err := vaultConfig.SecretPaths.resolveAll(data)
+	if err != nil {
+		return nil, err
+	}
+
 	vaultData := make(map[string]string, len(data))
 
 	inject := func(key, value string) {
 		vaultData[key] = value
 	}
 
+	transforms, err := injector.ParseTransforms(vaultConfig.VaultEnvTransforms)
+	if err != nil {
+		return nil, err
+	}
+
 	config := injector.Config{
 		TransitKeyID: vaultConfig.TransitKeyID,
 		TransitPath:  vaultConfig.TransitPath,
+		Transforms:   transforms,
 	}
 	secretInjector := injector.NewSecretInjector(config, vaultClient, nil, logger)
 
@@ -52,6 +52,7 @@ func (mw *mutatingWebhook) mutateConfigMap(configMap *corev1.ConfigMap, vaultCon
 
 	for key, value := range configMap.Data {
 		if hasVaultPrefix(value) {
+			mw.metrics.observe("configmap", value)
 			data := map[string]string{
 				key: value,
 			}
@@ -64,6 +65,7 @@ func (mw *mutatingWebhook) mutateConfigMap(configMap *corev1.ConfigMap, vaultCon
 
 	for key, value := range configMap.BinaryData {
 		if hasVaultPrefix(string(value)) {
+			mw.metrics.observe("configmap", string(value))
 			binaryData := map[string]string{
 				key: string(value),
 			}
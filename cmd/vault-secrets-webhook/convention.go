@@ -0,0 +1,105 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/banzaicloud/bank-vaults/internal/convention"
+)
+
+// secretPaths applies the secret path convention to the Vault references of a workload: references with
+// an empty or ./ relative path are resolved to the conventional path of the workload, and in enforcing mode
+// the references outside the prefix of the namespace of the workload are rejected.
+type secretPaths struct {
+	convention *convention.Convention
+	enforce    bool
+	namespace  string
+	app        string
+}
+
+// secretPathsOf returns the secret paths of the object in the namespace, or nil without a path convention
+func (mw *mutatingWebhook) secretPathsOf(obj metav1.Object, ns string) *secretPaths {
+	if mw.pathConvention == nil {
+		return nil
+	}
+
+	labels := obj.GetLabels()
+	app := labels[mw.pathConventionAppLabel]
+	if app == "" {
+		app = labels["app"]
+	}
+
+	return &secretPaths{
+		convention: mw.pathConvention,
+		enforce:    mw.enforcePathConvention,
+		namespace:  ns,
+		app:        app,
+	}
+}
+
+// resolve returns the reference with its secret path resolved, it is safe to call on a nil receiver
+func (p *secretPaths) resolve(reference string) (string, error) {
+	if p == nil {
+		return reference, nil
+	}
+
+	prefix := "vault:"
+	if strings.HasPrefix(reference, ">>vault:") {
+		prefix = ">>vault:"
+	}
+
+	value := strings.TrimPrefix(reference, prefix)
+	if value == "login" || transitEncryptedValue.MatchString(value) {
+		return reference, nil
+	}
+
+	split := strings.SplitN(value, "#", 2)
+	if len(split) < 2 {
+		return reference, nil
+	}
+
+	secretPath, err := p.convention.Resolve(p.namespace, p.app, split[0])
+	if err != nil {
+		return "", err
+	}
+
+	if p.enforce && !p.convention.Contains(p.namespace, secretPath) {
+		return "", errors.Errorf("secret path %s is outside of the prefix %s of namespace %s", secretPath, p.convention.Prefix(p.namespace), p.namespace)
+	}
+
+	return prefix + secretPath + "#" + split[1], nil
+}
+
+// resolveAll resolves the Vault references of data
+func (p *secretPaths) resolveAll(data map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(data))
+	for key, value := range data {
+		if !hasVaultPrefix(value) {
+			resolved[key] = value
+			continue
+		}
+
+		value, err := p.resolve(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid reference in %s", key)
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
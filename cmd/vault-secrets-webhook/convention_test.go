@@ -0,0 +1,60 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/banzaicloud/bank-vaults/internal/convention"
+)
+
+func Test_secretPaths_resolve(t *testing.T) {
+	pathConvention, err := convention.New("secret/data/{namespace}/{app}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw := mutatingWebhook{pathConvention: pathConvention, pathConventionAppLabel: "app.kubernetes.io/name", enforcePathConvention: true}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}}}
+	paths := mw.secretPathsOf(secret, "team")
+
+	for reference, expected := range map[string]string{
+		"vault:#password":                  "vault:secret/data/team/web#password",
+		"vault:./db#password#2":            "vault:secret/data/team/web/db#password#2",
+		">>vault:./db#password#{}":         ">>vault:secret/data/team/web/db#password#{}",
+		"vault:secret/data/team/api#token": "vault:secret/data/team/api#token",
+		"vault:login":                      "vault:login",
+		"vault:v1:ZW5jcnlwdGVkIHZhbHVl":    "vault:v1:ZW5jcnlwdGVkIHZhbHVl",
+	} {
+		resolved, err := paths.resolve(reference)
+		if err != nil {
+			t.Errorf("%s: %s", reference, err)
+			continue
+		}
+		if resolved != expected {
+			t.Errorf("%s: expected %q, got %q", reference, expected, resolved)
+		}
+	}
+
+	for _, reference := range []string{"vault:secret/data/other/api#token", "vault:secret/data/team/../other/api#token"} {
+		if _, err := paths.resolve(reference); err == nil {
+			t.Errorf("%s: expected the reference outside the namespace prefix to be rejected", reference)
+		}
+	}
+}
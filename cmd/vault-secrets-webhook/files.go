@@ -0,0 +1,188 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"emperror.dev/errors"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/banzaicloud/bank-vaults/internal/injector"
+)
+
+// parseVaultFiles parses the file templates of the vault-files and vault-env-files annotations, a YAML or JSON list of path and template pairs
+func parseVaultFiles(vaultFiles string) ([]injector.FileTemplate, error) {
+	var files []injector.FileTemplate
+	if err := yaml.Unmarshal([]byte(vaultFiles), &files); err != nil {
+		return nil, errors.WrapIf(err, "failed to parse the file templates")
+	}
+
+	for _, file := range files {
+		if file.Path == "" {
+			return nil, errors.New("every file template needs a path")
+		}
+	}
+
+	return files, nil
+}
+
+// getFilesInitContainer returns the init container which renders the file templates with vault-env into the vault-files volume
+func getFilesInitContainer(originalContainers []corev1.Container, podSecurityContext *corev1.PodSecurityContext, vaultConfig VaultConfig, files []injector.FileTemplate, containerEnvVars []corev1.EnvVar, containerVolMounts []corev1.VolumeMount) (corev1.Container, error) {
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return corev1.Container{}, errors.WrapIf(err, "failed to marshal the file templates")
+	}
+
+	env := append([]corev1.EnvVar{}, containerEnvVars...)
+	env = append(env, []corev1.EnvVar{
+		{
+			Name:  "VAULT_PATH",
+			Value: vaultConfig.Path,
+		},
+		{
+			Name:  "VAULT_ROLE",
+			Value: vaultConfig.Role,
+		},
+		{
+			Name:  "VAULT_IGNORE_MISSING_SECRETS",
+			Value: vaultConfig.IgnoreMissingSecrets,
+		},
+		{
+			Name:  "VAULT_JSON_LOG",
+			Value: vaultConfig.EnableJSONLog,
+		},
+		{
+			Name:  "VAULT_CLIENT_TIMEOUT",
+			Value: vaultConfig.ClientTimeout.String(),
+		},
+		{
+			Name:  "VAULT_ENV_FILES",
+			Value: string(filesJSON),
+		},
+		{
+			Name:  "VAULT_ENV_FILES_DIR",
+			Value: vaultConfig.ConfigfilePath,
+		},
+	}...)
+
+	securityContext, groupReadable, err := getFilesSecurityContext(originalContainers, podSecurityContext, vaultConfig)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+	if groupReadable {
+		env = append(env, corev1.EnvVar{Name: "VAULT_ENV_FILES_GROUP_READ", Value: "true"})
+	}
+
+	if vaultConfig.LogLevel != "" {
+		env = append(env, corev1.EnvVar{Name: "VAULT_LOG_LEVEL", Value: vaultConfig.LogLevel})
+	}
+	if len(vaultConfig.TransitKeyID) > 0 {
+		env = append(env, corev1.EnvVar{Name: "VAULT_TRANSIT_KEY_ID", Value: vaultConfig.TransitKeyID})
+	}
+	if len(vaultConfig.TransitPath) > 0 {
+		env = append(env, corev1.EnvVar{Name: "VAULT_TRANSIT_PATH", Value: vaultConfig.TransitPath})
+	}
+	if vaultConfig.UseAgent {
+		env = append(env, corev1.EnvVar{Name: "VAULT_TOKEN_FILE", Value: "/vault/.vault-token"})
+	}
+
+	// the service account token isn't mounted into the containers added by the webhook
+	volumeMounts := append([]corev1.VolumeMount{}, containerVolMounts...)
+	if serviceAccountMount := getServiceAccountMount(originalContainers); serviceAccountMount.Name != "" {
+		volumeMounts = append(volumeMounts, serviceAccountMount)
+	}
+	volumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      "vault-files",
+		MountPath: vaultConfig.ConfigfilePath,
+	})
+
+	return corev1.Container{
+		Name:            "vault-env-files",
+		Image:           viper.GetString("vault_env_image"),
+		ImagePullPolicy: corev1.PullPolicy(viper.GetString("vault_env_image_pull_policy")),
+		Command:         []string{"/usr/local/bin/vault-env"},
+		Env:             env,
+		VolumeMounts:    volumeMounts,
+		SecurityContext: securityContext,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("50m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+	}, nil
+}
+
+// getFilesSecurityContext returns the security context of the init container rendering the files, which are only readable
+// by its user, or by the fsGroup of the pod as well if it has one, which the volume and the files in it belong to.
+// Without an fsGroup the init container runs as the user of the containers, so all of them need the same runAsUser,
+// the user of their images isn't known here.
+func getFilesSecurityContext(containers []corev1.Container, podSecurityContext *corev1.PodSecurityContext, vaultConfig VaultConfig) (*corev1.SecurityContext, bool, error) {
+	if podSecurityContext != nil && podSecurityContext.FSGroup != nil {
+		return getSecurityContext(podSecurityContext, vaultConfig), true, nil
+	}
+
+	var podRunAsUser, runAsUser *int64
+	if podSecurityContext != nil {
+		podRunAsUser = podSecurityContext.RunAsUser
+	}
+
+	for _, container := range containers {
+		containerRunAsUser := podRunAsUser
+		if container.SecurityContext != nil && container.SecurityContext.RunAsUser != nil {
+			containerRunAsUser = container.SecurityContext.RunAsUser
+		}
+
+		if containerRunAsUser == nil {
+			return nil, false, errors.Errorf("the files of the vault-files annotation can't be read by container %s, the pod needs an fsGroup or a runAsUser for all of its containers", container.Name)
+		}
+		if runAsUser != nil && *runAsUser != *containerRunAsUser {
+			return nil, false, errors.New("the files of the vault-files annotation can't be read by containers running as different users, the pod needs an fsGroup")
+		}
+		runAsUser = containerRunAsUser
+	}
+
+	return &corev1.SecurityContext{
+		RunAsUser:                runAsUser,
+		AllowPrivilegeEscalation: &vaultConfig.PspAllowPrivilegeEscalation,
+	}, false, nil
+}
+
+func (mw *mutatingWebhook) addFilesVolToContainers(vaultConfig VaultConfig, containers []corev1.Container) {
+	for i, container := range containers {
+		mw.logger.Debugf("Add vault files VolumeMount to container %s", container.Name)
+
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "vault-files",
+			MountPath: vaultConfig.ConfigfilePath,
+			ReadOnly:  true,
+		})
+
+		containers[i] = container
+	}
+}
+
+// validateVaultFiles rejects the vault-files annotation together with the other annotations which mount into the same path
+func validateVaultFiles(vaultConfig VaultConfig) error {
+	if vaultConfig.CtConfigMap != "" || vaultConfig.AgentConfigMap != "" {
+		return errors.Errorf("the vault-files annotation can't be used together with consul-template or vault agent, they share the %s mount path", vaultConfig.ConfigfilePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/banzaicloud/bank-vaults/internal/injector"
+)
+
+func TestFilesInitContainerGroupReadable(t *testing.T) {
+	files := []injector.FileTemplate{{Path: "app.conf", Template: "secret"}}
+	fsGroup := int64(2000)
+	runAsUser := int64(1000)
+
+	groupReadable := func(podSecurityContext *corev1.PodSecurityContext) bool {
+		container, err := getFilesInitContainer([]corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsUser: &runAsUser}}}, podSecurityContext, VaultConfig{ConfigfilePath: "/vault/secrets"}, files, nil, nil)
+		assert.NoError(t, err)
+
+		for _, env := range container.Env {
+			if env.Name == "VAULT_ENV_FILES_GROUP_READ" {
+				return env.Value == "true"
+			}
+		}
+		return false
+	}
+
+	assert.False(t, groupReadable(&corev1.PodSecurityContext{}), "the files should be readable by the user only without an fsGroup")
+	assert.True(t, groupReadable(&corev1.PodSecurityContext{FSGroup: &fsGroup}), "the files should be readable by the fsGroup")
+}
+
+func TestFilesInitContainerRunsAsContainerUser(t *testing.T) {
+	files := []injector.FileTemplate{{Path: "app.conf", Template: "secret"}}
+	podRunAsUser := int64(100)
+	runAsUser := int64(1000)
+	otherRunAsUser := int64(2000)
+
+	// the pod has no fsGroup and the app container runs as another user than the pod
+	containers := []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{RunAsUser: &runAsUser}}}
+	container, err := getFilesInitContainer(containers, &corev1.PodSecurityContext{RunAsUser: &podRunAsUser}, VaultConfig{ConfigfilePath: "/vault/secrets"}, files, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, container.SecurityContext.RunAsUser)
+	assert.Equal(t, runAsUser, *container.SecurityContext.RunAsUser, "the files should be rendered as the user of the container reading them")
+	for _, env := range container.Env {
+		assert.NotEqual(t, "VAULT_ENV_FILES_GROUP_READ", env.Name)
+	}
+
+	_, err = getFilesInitContainer([]corev1.Container{{Name: "app"}}, nil, VaultConfig{ConfigfilePath: "/vault/secrets"}, files, nil, nil)
+	assert.Error(t, err, "the user of the image isn't known, so the files wouldn't be readable")
+
+	containers = append(containers, corev1.Container{Name: "sidecar", SecurityContext: &corev1.SecurityContext{RunAsUser: &otherRunAsUser}})
+	_, err = getFilesInitContainer(containers, nil, VaultConfig{ConfigfilePath: "/vault/secrets"}, files, nil, nil)
+	assert.Error(t, err, "the files can't be readable by containers running as different users")
+}
@@ -0,0 +1,100 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const webhookAnnotationPrefix = "vault.security.banzaicloud.io/"
+
+// maxOwnerDepth limits how far the controller chain of a Pod is followed (Pod -> ReplicaSet -> Deployment)
+const maxOwnerDepth = 3
+
+// inheritAnnotations copies the webhook annotations of from which are not set in annotations yet
+func inheritAnnotations(annotations, from map[string]string) {
+	for key, value := range from {
+		if !strings.HasPrefix(key, webhookAnnotationPrefix) {
+			continue
+		}
+		if _, ok := annotations[key]; !ok {
+			annotations[key] = value
+		}
+	}
+}
+
+// controllerOf returns the metadata of the controller owning the object in the namespace, or nil if it has none
+func (mw *mutatingWebhook) controllerOf(owner *metav1.OwnerReference, ns string) (metav1.Object, error) {
+	switch owner.Kind {
+	case "ReplicaSet":
+		return mw.k8sClient.AppsV1().ReplicaSets(ns).Get(owner.Name, metav1.GetOptions{})
+	case "Deployment":
+		return mw.k8sClient.AppsV1().Deployments(ns).Get(owner.Name, metav1.GetOptions{})
+	case "StatefulSet":
+		return mw.k8sClient.AppsV1().StatefulSets(ns).Get(owner.Name, metav1.GetOptions{})
+	case "DaemonSet":
+		return mw.k8sClient.AppsV1().DaemonSets(ns).Get(owner.Name, metav1.GetOptions{})
+	case "Job":
+		return mw.k8sClient.BatchV1().Jobs(ns).Get(owner.Name, metav1.GetOptions{})
+	case "CronJob":
+		return mw.k8sClient.BatchV1beta1().CronJobs(ns).Get(owner.Name, metav1.GetOptions{})
+	default:
+		return nil, nil
+	}
+}
+
+// inheritPodAnnotations sets the webhook annotations of the workload controllers and the Namespace of the Pod
+// which are not set on the Pod itself. The precedence is: Pod, workload controllers from the nearest
+// (ReplicaSet, Job) to the farthest (Deployment, CronJob), Namespace, then the webhook defaults.
+func (mw *mutatingWebhook) inheritPodAnnotations(pod *corev1.Pod, ns string) error {
+	annotations := map[string]string{}
+	for key, value := range pod.GetAnnotations() {
+		annotations[key] = value
+	}
+
+	var obj metav1.Object = pod
+	for i := 0; i < maxOwnerDepth; i++ {
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil {
+			break
+		}
+
+		controller, err := mw.controllerOf(owner, ns)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get %s %s", owner.Kind, owner.Name)
+		}
+		if controller == nil {
+			break
+		}
+
+		inheritAnnotations(annotations, controller.GetAnnotations())
+		obj = controller
+	}
+
+	namespace, err := mw.k8sClient.CoreV1().Namespaces().Get(ns, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get namespace %s", ns)
+	}
+
+	inheritAnnotations(annotations, namespace.GetAnnotations())
+
+	pod.SetAnnotations(annotations)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	cmp "github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func Test_mutatingWebhook_inheritPodAnnotations(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "team",
+				Annotations: map[string]string{
+					"vault.security.banzaicloud.io/vault-addr": "https://vault.team:8200",
+					"vault.security.banzaicloud.io/vault-role": "team",
+					"vault.security.banzaicloud.io/vault-path": "kubernetes-team",
+					"unrelated": "namespace",
+				},
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "app",
+				Namespace: "team",
+				Annotations: map[string]string{
+					"vault.security.banzaicloud.io/vault-role":           "app",
+					"vault.security.banzaicloud.io/vault-skip-verify":    "true",
+					"deployment.kubernetes.io/revision":                  "1",
+					"vault.security.banzaicloud.io/vault-client-timeout": "30s",
+				},
+			},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "app-5d4f8",
+				Namespace:       "team",
+				OwnerReferences: controllerRef("Deployment", "app"),
+			},
+		},
+	)
+
+	mw := mutatingWebhook{k8sClient: k8sClient}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-5d4f8-x8k2p",
+			OwnerReferences: controllerRef("ReplicaSet", "app-5d4f8"),
+			Annotations: map[string]string{
+				"vault.security.banzaicloud.io/vault-client-timeout": "5s",
+			},
+		},
+	}
+
+	if err := mw.inheritPodAnnotations(pod, "team"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"vault.security.banzaicloud.io/vault-addr":           "https://vault.team:8200",
+		"vault.security.banzaicloud.io/vault-role":           "app",
+		"vault.security.banzaicloud.io/vault-path":           "kubernetes-team",
+		"vault.security.banzaicloud.io/vault-skip-verify":    "true",
+		"vault.security.banzaicloud.io/vault-client-timeout": "5s",
+	}
+
+	if diff := cmp.Diff(expected, pod.GetAnnotations()); diff != "" {
+		t.Errorf("unexpected annotations (-want +got):\n%s", diff)
+	}
+}
@@ -38,6 +38,9 @@ import (
 	kubernetesConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	"github.com/banzaicloud/bank-vaults/cmd/vault-secrets-webhook/registry"
+	"github.com/banzaicloud/bank-vaults/internal/convention"
+	"github.com/banzaicloud/bank-vaults/internal/mirror"
+	"github.com/banzaicloud/bank-vaults/internal/telemetry"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
 
@@ -51,6 +54,7 @@ type VaultConfig struct {
 	ClientTimeout               time.Duration
 	UseAgent                    bool
 	VaultEnvDaemon              bool
+	VaultEnvWatchSecrets        bool
 	TransitKeyID                string
 	TransitPath                 string
 	CtConfigMap                 string
@@ -64,7 +68,11 @@ type VaultConfig struct {
 	PspAllowPrivilegeEscalation bool
 	IgnoreMissingSecrets        string
 	VaultEnvPassThrough         string
+	VaultEnvTransforms          string
 	ConfigfilePath              string
+	VaultFiles                  string
+	VaultEnvFiles               string
+	VaultEnvFilesPath           string
 	MutateConfigMap             bool
 	EnableJSONLog               string
 	LogLevel                    string
@@ -74,9 +82,11 @@ type VaultConfig struct {
 	AgentShareProcessDefault    string
 	AgentCPU                    resource.Quantity
 	AgentMemory                 resource.Quantity
+	ResourceSizing              bool
 	AgentImage                  string
 	AgentImagePullPolicy        corev1.PullPolicy
 	Skip                        bool
+	SecretPaths                 *secretPaths
 }
 
 func init() {
@@ -93,10 +103,20 @@ func init() {
 	viper.SetDefault("vault_client_timeout", "10s")
 	viper.SetDefault("vault_agent", "false")
 	viper.SetDefault("vault_env_daemon", "false")
+	viper.SetDefault("vault_env_watch_secrets", "false")
+	viper.SetDefault("sidecar_resource_sizing", "false")
+	viper.SetDefault("image_mirrors", "")
+	viper.SetDefault("sidecar_cpu_request_base", "25m")
+	viper.SetDefault("sidecar_cpu_request_per_reference", "5m")
+	viper.SetDefault("sidecar_cpu_request_max", "500m")
+	viper.SetDefault("sidecar_memory_request_base", "32Mi")
+	viper.SetDefault("sidecar_memory_request_per_reference", "2Mi")
+	viper.SetDefault("sidecar_memory_request_max", "512Mi")
 	viper.SetDefault("vault_ct_share_process_namespace", "")
 	viper.SetDefault("psp_allow_privilege_escalation", "false")
 	viper.SetDefault("vault_ignore_missing_secrets", "false")
 	viper.SetDefault("vault_env_passthrough", "")
+	viper.SetDefault("vault_env_transforms", "")
 	viper.SetDefault("mutate_configmap", "false")
 	viper.SetDefault("tls_cert_file", "")
 	viper.SetDefault("tls_private_key_file", "")
@@ -109,6 +129,19 @@ func init() {
 	viper.SetDefault("enable_json_log", "false")
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("vault_agent_share_process_namespace", "")
+	viper.SetDefault("metrics_path_prefix_depth", "3")
+	viper.SetDefault("metrics_path_prefix_limit", "100")
+	viper.SetDefault("metrics_backend", "prometheus")
+	viper.SetDefault("metrics_statsd_address", "")
+	viper.SetDefault("annotation_inheritance", "false")
+	viper.SetDefault("vault_lookup_shedding_threshold", "0")
+	viper.SetDefault("vault_lookup_priority_label", "vault.security.banzaicloud.io/lookup-priority")
+	viper.SetDefault("secrets_failure_policy", failurePolicyIgnore)
+	viper.SetDefault("configmap_failure_policy", failurePolicyIgnore)
+	viper.SetDefault("custom_resources_failure_policy", failurePolicyIgnore)
+	viper.SetDefault("secret_path_convention", "")
+	viper.SetDefault("secret_path_convention_app_label", "app.kubernetes.io/name")
+	viper.SetDefault("secret_path_convention_enforce", "false")
 	viper.AutomaticEnv()
 }
 
@@ -178,6 +211,12 @@ func parseVaultConfig(obj metav1.Object) VaultConfig {
 		vaultConfig.VaultEnvDaemon, _ = strconv.ParseBool(viper.GetString("vault_env_daemon"))
 	}
 
+	if val, ok := annotations["vault.security.banzaicloud.io/vault-env-watch-secrets"]; ok {
+		vaultConfig.VaultEnvWatchSecrets, _ = strconv.ParseBool(val)
+	} else {
+		vaultConfig.VaultEnvWatchSecrets, _ = strconv.ParseBool(viper.GetString("vault_env_watch_secrets"))
+	}
+
 	if val, ok := annotations["vault.security.banzaicloud.io/vault-ct-configmap"]; ok {
 		vaultConfig.CtConfigMap = val
 	} else {
@@ -200,6 +239,11 @@ func parseVaultConfig(obj metav1.Object) VaultConfig {
 	} else {
 		vaultConfig.VaultEnvPassThrough = viper.GetString("vault_env_passthrough")
 	}
+	if val, ok := annotations["vault.security.banzaicloud.io/vault-env-transforms"]; ok {
+		vaultConfig.VaultEnvTransforms = val
+	} else {
+		vaultConfig.VaultEnvTransforms = viper.GetString("vault_env_transforms")
+	}
 	if val, ok := annotations["vault.security.banzaicloud.io/vault-configfile-path"]; ok {
 		vaultConfig.ConfigfilePath = val
 	} else if val, ok := annotations["vault.security.banzaicloud.io/vault-ct-secrets-mount-path"]; ok {
@@ -208,6 +252,19 @@ func parseVaultConfig(obj metav1.Object) VaultConfig {
 		vaultConfig.ConfigfilePath = "/vault/secrets"
 	}
 
+	if val, ok := annotations["vault.security.banzaicloud.io/vault-files"]; ok {
+		vaultConfig.VaultFiles = val
+	}
+
+	if val, ok := annotations["vault.security.banzaicloud.io/vault-env-files"]; ok {
+		vaultConfig.VaultEnvFiles = val
+	}
+	if val, ok := annotations["vault.security.banzaicloud.io/vault-env-files-path"]; ok {
+		vaultConfig.VaultEnvFilesPath = val
+	} else {
+		vaultConfig.VaultEnvFilesPath = "/vault/env-files"
+	}
+
 	if val, ok := annotations["vault.security.banzaicloud.io/vault-ct-pull-policy"]; ok {
 		switch val {
 		case "Never", "never":
@@ -303,6 +360,12 @@ func parseVaultConfig(obj metav1.Object) VaultConfig {
 		vaultConfig.AgentMemory = resource.MustParse("128Mi")
 	}
 
+	if val, ok := annotations["vault.security.banzaicloud.io/sidecar-resource-sizing"]; ok {
+		vaultConfig.ResourceSizing, _ = strconv.ParseBool(val)
+	} else {
+		vaultConfig.ResourceSizing, _ = strconv.ParseBool(viper.GetString("sidecar_resource_sizing"))
+	}
+
 	if val, ok := annotations["vault.security.banzaicloud.io/vault-agent-share-process-namespace"]; ok {
 		vaultConfig.AgentShareProcessDefault = "found"
 		vaultConfig.AgentShareProcess, _ = strconv.ParseBool(val)
@@ -320,28 +383,57 @@ func parseVaultConfig(obj metav1.Object) VaultConfig {
 type mutatingWebhook struct {
 	k8sClient kubernetes.Interface
 	registry  registry.ImageRegistry
+	metrics   *referenceMetrics
+	shedder   *lookupShedder
 	logger    logrus.FieldLogger
+
+	pathConvention         *convention.Convention
+	pathConventionAppLabel string
+	enforcePathConvention  bool
+
+	imageMirrors mirror.Mirrors
 }
 
 func (mw *mutatingWebhook) vaultSecretsMutator(ctx context.Context, obj metav1.Object) (bool, error) {
+	if pod, ok := obj.(*corev1.Pod); ok && viper.GetBool("annotation_inheritance") {
+		err := mw.inheritPodAnnotations(pod, whcontext.GetAdmissionRequest(ctx).Namespace)
+		if err != nil {
+			mw.logger.Warnf("failed to inherit annotations, using the ones of the pod only: %s", err)
+		}
+	}
+
 	vaultConfig := parseVaultConfig(obj)
 
 	if vaultConfig.Skip {
 		return false, nil
 	}
 
+	vaultConfig.SecretPaths = mw.secretPathsOf(obj, whcontext.GetAdmissionRequest(ctx).Namespace)
+
 	switch v := obj.(type) {
 	case *corev1.Pod:
 		return false, mw.mutatePod(v, vaultConfig, whcontext.GetAdmissionRequest(ctx).Namespace, whcontext.IsAdmissionRequestDryRun(ctx))
 
 	case *corev1.Secret:
-		return false, mw.mutateSecret(v, vaultConfig)
+		if !secretNeedsMutation(v) {
+			return false, nil
+		}
+		return false, mw.shedder.do("secret", whcontext.GetAdmissionRequest(ctx).Namespace, func() error {
+			return mw.mutateSecret(v, vaultConfig)
+		})
 
 	case *corev1.ConfigMap:
-		return false, mw.mutateConfigMap(v, vaultConfig)
+		if !configMapNeedsMutation(v) {
+			return false, nil
+		}
+		return false, mw.shedder.do("configmap", whcontext.GetAdmissionRequest(ctx).Namespace, func() error {
+			return mw.mutateConfigMap(v, vaultConfig)
+		})
 
 	case *unstructured.Unstructured:
-		return false, mw.mutateObject(v, vaultConfig)
+		return false, mw.shedder.do("object", whcontext.GetAdmissionRequest(ctx).Namespace, func() error {
+			return mw.mutateObject(v, vaultConfig)
+		})
 
 	default:
 		return false, nil
@@ -524,10 +616,47 @@ func main() {
 		logger.Fatalf("error creating k8s client: %s", err)
 	}
 
+	recorder, err := telemetry.NewRecorder(viper.GetString("metrics_backend"), "vault_secrets_webhook", viper.GetString("metrics_statsd_address"), prometheus.DefaultRegisterer)
+	if err != nil {
+		logger.Fatalf("error creating metrics recorder: %s", err)
+	}
+
+	referenceMetrics := newReferenceMetrics(recorder, viper.GetInt("metrics_path_prefix_depth"), viper.GetInt("metrics_path_prefix_limit"))
+
+	shedder := newLookupShedder(
+		k8sClient,
+		logger,
+		recorder,
+		viper.GetInt("vault_lookup_shedding_threshold"),
+		viper.GetString("vault_lookup_priority_label"),
+		map[string]string{
+			"secret":    viper.GetString("secrets_failure_policy"),
+			"configmap": viper.GetString("configmap_failure_policy"),
+			"object":    viper.GetString("custom_resources_failure_policy"),
+		},
+	)
+
 	mutatingWebhook := mutatingWebhook{
 		k8sClient: k8sClient,
 		registry:  registry.NewRegistry(),
+		metrics:   referenceMetrics,
+		shedder:   shedder,
 		logger:    logger,
+
+		pathConventionAppLabel: viper.GetString("secret_path_convention_app_label"),
+		enforcePathConvention:  viper.GetBool("secret_path_convention_enforce"),
+	}
+
+	if pathTemplate := viper.GetString("secret_path_convention"); pathTemplate != "" {
+		mutatingWebhook.pathConvention, err = convention.New(pathTemplate)
+		if err != nil {
+			logger.Fatalf("error parsing secret path convention: %s", err)
+		}
+	}
+
+	mutatingWebhook.imageMirrors, err = mirror.Parse(viper.GetString("image_mirrors"))
+	if err != nil {
+		logger.Fatalf("error parsing image mirrors: %s", err)
 	}
 
 	mutator := mutating.MutatorFunc(mutatingWebhook.vaultSecretsMutator)
@@ -539,11 +668,13 @@ func main() {
 	configMapHandler := handlerFor(mutating.WebhookConfig{Name: "vault-secrets-configmap", Obj: &corev1.ConfigMap{}}, mutator, metricsRecorder, logger)
 	objectHandler := handlerFor(mutating.WebhookConfig{Name: "vault-secrets-object", Obj: &unstructured.Unstructured{}}, mutator, metricsRecorder, logger)
 
+	panics := recorder.Counter("recovered_panics_total", "Number of admission requests whose handling panicked, by webhook.", "webhook")
+
 	mux := http.NewServeMux()
-	mux.Handle("/pods", podHandler)
-	mux.Handle("/secrets", secretHandler)
-	mux.Handle("/configmaps", configMapHandler)
-	mux.Handle("/objects", objectHandler)
+	mux.Handle("/pods", recoverPanics("vault-secrets-pods", podHandler, panics, logger))
+	mux.Handle("/secrets", recoverPanics("vault-secrets-secret", secretHandler, panics, logger))
+	mux.Handle("/configmaps", recoverPanics("vault-secrets-configmap", configMapHandler, panics, logger))
+	mux.Handle("/objects", recoverPanics("vault-secrets-object", objectHandler, panics, logger))
 	mux.Handle("/healthz", http.HandlerFunc(healthzHandler))
 
 	telemetryAddress := viper.GetString("telemetry_listen_address")
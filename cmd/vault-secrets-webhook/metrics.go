@@ -0,0 +1,105 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+)
+
+const (
+	// otherPathPrefix is the label value used once the tracked prefix limit is reached
+	otherPathPrefix = "_other"
+	// transitPathPrefix is the label value for transit encrypted values
+	transitPathPrefix = "_transit"
+)
+
+// transitEncryptedValue matches transit ciphertexts with the vault: prefix trimmed
+var transitEncryptedValue = regexp.MustCompile(`^v\d+:.+$`)
+
+// referenceMetrics counts the Vault secret references injected by the webhook,
+// grouped by path prefix. The number of distinct prefixes is bounded to keep the
+// cardinality of the metric under control.
+type referenceMetrics struct {
+	counter metrics.Counter
+
+	depth int
+	limit int
+
+	mu       sync.Mutex
+	prefixes map[string]bool
+}
+
+func newReferenceMetrics(recorder metrics.Recorder, depth, limit int) *referenceMetrics {
+	return &referenceMetrics{
+		counter: metrics.OrNoop(recorder).Counter(
+			"secret_references_total",
+			"Number of Vault secret references injected, by resource kind and Vault path prefix.",
+			"kind", "path_prefix",
+		),
+		depth:    depth,
+		limit:    limit,
+		prefixes: map[string]bool{},
+	}
+}
+
+// observe records a secret reference, it is safe to call on a nil receiver.
+func (m *referenceMetrics) observe(kind, reference string) {
+	if m == nil {
+		return
+	}
+
+	m.counter.Add(1, kind, m.boundedPrefix(pathPrefix(reference, m.depth)))
+}
+
+func (m *referenceMetrics) boundedPrefix(prefix string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.prefixes[prefix] {
+		return prefix
+	}
+
+	if len(m.prefixes) >= m.limit {
+		return otherPathPrefix
+	}
+
+	m.prefixes[prefix] = true
+
+	return prefix
+}
+
+// pathPrefix returns the first depth segments of the Vault path in a secret reference
+// like vault:secret/data/accounts/aws#AWS_SECRET_ACCESS_KEY
+func pathPrefix(reference string, depth int) string {
+	reference = strings.TrimPrefix(reference, ">>")
+	reference = strings.TrimPrefix(reference, "vault:")
+
+	if transitEncryptedValue.MatchString(reference) {
+		return transitPathPrefix
+	}
+
+	path := strings.SplitN(reference, "#", 2)[0]
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if depth > 0 && len(segments) > depth {
+		segments = segments[:depth]
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,51 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pathPrefix(t *testing.T) {
+	tests := []struct {
+		reference string
+		depth     int
+		want      string
+	}{
+		{reference: "vault:secret/data/accounts/aws#AWS_SECRET_ACCESS_KEY", depth: 3, want: "secret/data/accounts"},
+		{reference: "vault:secret/data/accounts/aws#AWS_SECRET_ACCESS_KEY", depth: 2, want: "secret/data"},
+		{reference: ">>vault:database/creds/my-role#username", depth: 3, want: "database/creds/my-role"},
+		{reference: "vault:secret/data/app#key#2", depth: 0, want: "secret/data/app"},
+		{reference: "vault:v1:8SDd3WHDOjf7mq69CyCqYjBXAiQQAVZRkFM13ok481zoCmHnSeDX9g==", depth: 3, want: transitPathPrefix},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, pathPrefix(tt.reference, tt.depth), tt.reference)
+	}
+}
+
+func Test_referenceMetricsLimit(t *testing.T) {
+	m := newReferenceMetrics(nil, 1, 2)
+
+	assert.Equal(t, "a", m.boundedPrefix("a"))
+	assert.Equal(t, "b", m.boundedPrefix("b"))
+	assert.Equal(t, otherPathPrefix, m.boundedPrefix("c"))
+	assert.Equal(t, "a", m.boundedPrefix("a"))
+
+	var nilMetrics *referenceMetrics
+	nilMetrics.observe("pod", "vault:secret/data/app#key")
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -26,6 +27,8 @@ import (
 	kubeVer "k8s.io/apimachinery/pkg/version"
 
 	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/internal/injector"
 )
 
 const vaultAgentConfig = `
@@ -50,7 +53,11 @@ auto_auth {
 func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, ns string, dryRun bool) error {
 	mw.logger.Debug("Successfully connected to the API")
 
-	initContainersMutated, err := mw.mutateContainers(pod.Spec.InitContainers, &pod.Spec, vaultConfig, ns)
+	// the files of the vault-env-files annotation are rendered by vault-env in the containers only
+	initVaultConfig := vaultConfig
+	initVaultConfig.VaultEnvFiles = ""
+
+	initContainersMutated, err := mw.mutateContainers(pod.Spec.InitContainers, &pod.Spec, initVaultConfig, ns)
 	if err != nil {
 		return err
 	}
@@ -106,7 +113,19 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, n
 		})
 	}
 
-	if initContainersMutated || containersMutated || vaultConfig.CtConfigMap != "" || vaultConfig.AgentConfigMap != "" {
+	var vaultFiles []injector.FileTemplate
+	if vaultConfig.VaultFiles != "" {
+		if err := validateVaultFiles(vaultConfig); err != nil {
+			return err
+		}
+
+		vaultFiles, err = parseVaultFiles(vaultConfig.VaultFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	if initContainersMutated || containersMutated || vaultConfig.CtConfigMap != "" || vaultConfig.AgentConfigMap != "" || len(vaultFiles) > 0 {
 		var agentConfigMapName string
 
 		if vaultConfig.UseAgent || vaultConfig.CtConfigMap != "" {
@@ -128,13 +147,28 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, n
 			}
 		}
 
-		pod.Spec.InitContainers = append(getInitContainers(pod.Spec.Containers, pod.Spec.SecurityContext, vaultConfig, initContainersMutated, containersMutated, containerEnvVars, containerVolMounts), pod.Spec.InitContainers...)
+		initContainers := getInitContainers(pod.Spec.Containers, pod.Spec.SecurityContext, vaultConfig, initContainersMutated, containersMutated, containerEnvVars, containerVolMounts)
+		if len(vaultFiles) > 0 {
+			filesContainer, err := getFilesInitContainer(pod.Spec.Containers, pod.Spec.SecurityContext, vaultConfig, vaultFiles, containerEnvVars, containerVolMounts)
+			if err != nil {
+				return err
+			}
+			initContainers = append(initContainers, filesContainer)
+		}
+		mw.mirrorImages(initContainers)
+		pod.Spec.InitContainers = append(initContainers, pod.Spec.InitContainers...)
 		mw.logger.Debug("Successfully appended pod init containers to spec")
 
 		pod.Spec.Volumes = append(pod.Spec.Volumes, mw.getVolumes(pod.Spec.Volumes, agentConfigMapName, vaultConfig)...)
 		mw.logger.Debug("Successfully appended pod spec volumes")
 	}
 
+	if len(vaultFiles) > 0 {
+		mw.logger.Debug("Vault files found")
+
+		mw.addFilesVolToContainers(vaultConfig, pod.Spec.Containers)
+	}
+
 	if vaultConfig.CtConfigMap != "" {
 		mw.logger.Debug("Consul Template config found")
 
@@ -158,7 +192,13 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, n
 			shareProcessNamespace := true
 			pod.Spec.ShareProcessNamespace = &shareProcessNamespace
 		}
-		pod.Spec.Containers = append(getContainers(vaultConfig, containerEnvVars, containerVolMounts), pod.Spec.Containers...)
+		ctContainers := getContainers(vaultConfig, containerEnvVars, containerVolMounts)
+		if vaultConfig.ResourceSizing {
+			references := mw.templateSecretReferences(vaultConfig.CtConfigMap, ns)
+			ctContainers[0].Resources = resourceSizingFromConfig().resources(ctContainers[0].Resources.Limits, references)
+		}
+		mw.mirrorImages(ctContainers)
+		pod.Spec.Containers = append(ctContainers, pod.Spec.Containers...)
 
 		mw.logger.Debug("Successfully appended pod containers to spec")
 	}
@@ -186,7 +226,13 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, n
 			shareProcessNamespace := true
 			pod.Spec.ShareProcessNamespace = &shareProcessNamespace
 		}
-		pod.Spec.Containers = append(getAgentContainers(pod.Spec.Containers, vaultConfig, containerEnvVars, containerVolMounts), pod.Spec.Containers...)
+		agentContainers := getAgentContainers(pod.Spec.Containers, vaultConfig, containerEnvVars, containerVolMounts)
+		if vaultConfig.ResourceSizing {
+			references := mw.templateSecretReferences(vaultConfig.AgentConfigMap, ns)
+			agentContainers[0].Resources = resourceSizingFromConfig().resources(agentContainers[0].Resources.Limits, references)
+		}
+		mw.mirrorImages(agentContainers)
+		pod.Spec.Containers = append(agentContainers, pod.Spec.Containers...)
 
 		mw.logger.Debug("Successfully appended pod containers to spec")
 	}
@@ -197,6 +243,20 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, vaultConfig VaultConfig, n
 func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSpec *corev1.PodSpec, vaultConfig VaultConfig, ns string) (bool, error) {
 	mutated := false
 
+	var vaultEnvFiles string
+	if vaultConfig.VaultEnvFiles != "" {
+		files, err := parseVaultFiles(vaultConfig.VaultEnvFiles)
+		if err != nil {
+			return false, err
+		}
+
+		filesJSON, err := json.Marshal(files)
+		if err != nil {
+			return false, err
+		}
+		vaultEnvFiles = string(filesJSON)
+	}
+
 	for i, container := range containers {
 		var envVars []corev1.EnvVar
 		if len(container.EnvFrom) > 0 {
@@ -207,8 +267,14 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 			envVars = append(envVars, envFrom...)
 		}
 
-		for _, env := range container.Env {
+		for j, env := range container.Env {
 			if hasVaultPrefix(env.Value) {
+				value, err := vaultConfig.SecretPaths.resolve(env.Value)
+				if err != nil {
+					return false, err
+				}
+				container.Env[j].Value = value
+				env.Value = value
 				envVars = append(envVars, env)
 			}
 			if env.ValueFrom != nil {
@@ -223,17 +289,32 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 			}
 		}
 
-		if len(envVars) == 0 {
+		// the containers are mutated for the vault-env-files annotation even without secrets in their environment
+		if len(envVars) == 0 && vaultEnvFiles == "" {
 			continue
 		}
 
+		// the references coming from ConfigMaps and Secrets are read by vault-env as they are, only check them here
+		for _, env := range envVars {
+			if _, err := vaultConfig.SecretPaths.resolve(env.Value); err != nil {
+				return false, err
+			}
+		}
+
+		for _, env := range envVars {
+			mw.metrics.observe("pod", env.Value)
+		}
+
 		mutated = true
 
 		args := container.Command
 
 		// the container has no explicitly specified command
 		if len(args) == 0 {
-			imageConfig, err := mw.registry.GetImageConfig(mw.k8sClient, ns, &container, podSpec) // nolint:gosec
+			// the image config is looked up in the mirror registry, the image of the container is left as is
+			lookup := container
+			lookup.Image = mw.imageMirrors.Image(container.Image)
+			imageConfig, err := mw.registry.GetImageConfig(mw.k8sClient, ns, &lookup, podSpec)
 			if err != nil {
 				return false, err
 			}
@@ -303,6 +384,15 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 			}...)
 		}
 
+		if vaultConfig.VaultEnvTransforms != "" {
+			container.Env = append(container.Env, []corev1.EnvVar{
+				{
+					Name:  "VAULT_ENV_TRANSFORMS",
+					Value: vaultConfig.VaultEnvTransforms,
+				},
+			}...)
+		}
+
 		if len(vaultConfig.TransitKeyID) > 0 {
 			container.Env = append(container.Env, []corev1.EnvVar{
 				{
@@ -346,6 +436,25 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 			})
 		}
 
+		if vaultEnvFiles != "" {
+			container.Env = append(container.Env, []corev1.EnvVar{
+				{
+					Name:  "VAULT_ENV_FILES",
+					Value: vaultEnvFiles,
+				},
+				{
+					Name:  "VAULT_ENV_FILES_DIR",
+					Value: vaultConfig.VaultEnvFilesPath,
+				},
+			}...)
+			// every container renders the files as its own user, so each of them has its own directory of the volume
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      "vault-env-files",
+				MountPath: vaultConfig.VaultEnvFilesPath,
+				SubPath:   container.Name,
+			})
+		}
+
 		if vaultConfig.VaultEnvDaemon {
 			container.Env = append(container.Env, corev1.EnvVar{
 				Name:  "VAULT_ENV_DAEMON",
@@ -353,12 +462,26 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 			})
 		}
 
+		if vaultConfig.VaultEnvDaemon && vaultConfig.VaultEnvWatchSecrets {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  "VAULT_ENV_WATCH_SECRETS",
+				Value: "true",
+			})
+		}
+
 		containers[i] = container
 	}
 
 	return mutated, nil
 }
 
+// mirrorImages rewrites the images of the injected containers to be pulled from the image mirrors
+func (mw *mutatingWebhook) mirrorImages(containers []corev1.Container) {
+	for i := range containers {
+		containers[i].Image = mw.imageMirrors.Image(containers[i].Image)
+	}
+}
+
 func (mw *mutatingWebhook) addSecretsVolToContainers(vaultConfig VaultConfig, containers []corev1.Container) {
 	for i, container := range containers {
 		mw.logger.Debugf("Add secrets VolumeMount to container %s", container.Name)
@@ -403,6 +526,30 @@ func (mw *mutatingWebhook) getVolumes(existingVolumes []corev1.Volume, agentConf
 		},
 	}
 
+	if vaultConfig.VaultEnvFiles != "" {
+		mw.logger.Debug("Add vault-env files volume to podspec")
+		volumes = append(volumes, corev1.Volume{
+			Name: "vault-env-files",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					Medium: corev1.StorageMediumMemory,
+				},
+			},
+		})
+	}
+
+	if vaultConfig.VaultFiles != "" {
+		mw.logger.Debug("Add vault files volume to podspec")
+		volumes = append(volumes, corev1.Volume{
+			Name: "vault-files",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					Medium: corev1.StorageMediumMemory,
+				},
+			},
+		})
+	}
+
 	if vaultConfig.UseAgent || vaultConfig.CtConfigMap != "" {
 		mw.logger.Debug("Add vault agent volumes to podspec")
 		volumes = append(volumes, corev1.Volume{
@@ -59,6 +59,10 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 		vaultConfig VaultConfig
 		ns          string
 	}
+	vaultEnvFilesConfig := vaultConfig
+	vaultEnvFilesConfig.VaultEnvFiles = "- path: app.conf\n  template: 'password=${ vault \"vault:secret/data/app#password\" }'\n"
+	vaultEnvFilesConfig.VaultEnvFilesPath = "/vault/env-files"
+
 	tests := []struct {
 		name             string
 		fields           fields
@@ -286,6 +290,121 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 			mutated: false,
 			wantErr: false,
 		},
+		{name: "Will mutate container without secrets for vault-env-files",
+			fields: fields{
+				k8sClient: fake.NewSimpleClientset(),
+				registry: &MockRegistry{
+					Image: imagev1.ImageConfig{},
+				},
+			},
+			args: args{
+				containers: []corev1.Container{
+					{
+						Name:    "MyContainer",
+						Image:   "myimage",
+						Command: []string{"/bin/bash"},
+					},
+				},
+				vaultConfig: vaultEnvFilesConfig,
+			},
+			wantedContainers: []corev1.Container{
+				{
+					Name:    "MyContainer",
+					Image:   "myimage",
+					Command: []string{"/vault/vault-env"},
+					Args:    []string{"/bin/bash"},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "vault-env", MountPath: "/vault/"},
+						{Name: "vault-env-files", MountPath: "/vault/env-files", SubPath: "MyContainer"},
+					},
+					Env: []corev1.EnvVar{
+						{Name: "VAULT_ADDR", Value: "addr"},
+						{Name: "VAULT_SKIP_VERIFY", Value: "false"},
+						{Name: "VAULT_PATH", Value: "path"},
+						{Name: "VAULT_ROLE", Value: "role"},
+						{Name: "VAULT_IGNORE_MISSING_SECRETS", Value: "ignoreMissingSecrets"},
+						{Name: "VAULT_ENV_PASSTHROUGH", Value: "vaultEnvPassThrough"},
+						{Name: "VAULT_JSON_LOG", Value: "enableJSONLog"},
+						{Name: "VAULT_CLIENT_TIMEOUT", Value: "10s"},
+						{Name: "VAULT_ENV_FILES", Value: `[{"path":"app.conf","template":"password=${ vault \"vault:secret/data/app#password\" }"}]`},
+						{Name: "VAULT_ENV_FILES_DIR", Value: "/vault/env-files"},
+					},
+				},
+			},
+			mutated: true,
+			wantErr: false,
+		},
+		{name: "Will mutate every container for vault-env-files into its own directory",
+			fields: fields{
+				k8sClient: fake.NewSimpleClientset(),
+				registry: &MockRegistry{
+					Image: imagev1.ImageConfig{},
+				},
+			},
+			args: args{
+				containers: []corev1.Container{
+					{
+						Name:    "MyContainer",
+						Image:   "myimage",
+						Command: []string{"/bin/bash"},
+					},
+					{
+						Name:    "OtherContainer",
+						Image:   "myimage",
+						Command: []string{"/bin/bash"},
+					},
+				},
+				vaultConfig: vaultEnvFilesConfig,
+			},
+			wantedContainers: []corev1.Container{
+				{
+					Name:    "MyContainer",
+					Image:   "myimage",
+					Command: []string{"/vault/vault-env"},
+					Args:    []string{"/bin/bash"},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "vault-env", MountPath: "/vault/"},
+						{Name: "vault-env-files", MountPath: "/vault/env-files", SubPath: "MyContainer"},
+					},
+					Env: []corev1.EnvVar{
+						{Name: "VAULT_ADDR", Value: "addr"},
+						{Name: "VAULT_SKIP_VERIFY", Value: "false"},
+						{Name: "VAULT_PATH", Value: "path"},
+						{Name: "VAULT_ROLE", Value: "role"},
+						{Name: "VAULT_IGNORE_MISSING_SECRETS", Value: "ignoreMissingSecrets"},
+						{Name: "VAULT_ENV_PASSTHROUGH", Value: "vaultEnvPassThrough"},
+						{Name: "VAULT_JSON_LOG", Value: "enableJSONLog"},
+						{Name: "VAULT_CLIENT_TIMEOUT", Value: "10s"},
+						{Name: "VAULT_ENV_FILES", Value: `[{"path":"app.conf","template":"password=${ vault \"vault:secret/data/app#password\" }"}]`},
+						{Name: "VAULT_ENV_FILES_DIR", Value: "/vault/env-files"},
+					},
+				},
+				{
+					Name:    "OtherContainer",
+					Image:   "myimage",
+					Command: []string{"/vault/vault-env"},
+					Args:    []string{"/bin/bash"},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "vault-env", MountPath: "/vault/"},
+						{Name: "vault-env-files", MountPath: "/vault/env-files", SubPath: "OtherContainer"},
+					},
+					Env: []corev1.EnvVar{
+						{Name: "VAULT_ADDR", Value: "addr"},
+						{Name: "VAULT_SKIP_VERIFY", Value: "false"},
+						{Name: "VAULT_PATH", Value: "path"},
+						{Name: "VAULT_ROLE", Value: "role"},
+						{Name: "VAULT_IGNORE_MISSING_SECRETS", Value: "ignoreMissingSecrets"},
+						{Name: "VAULT_ENV_PASSTHROUGH", Value: "vaultEnvPassThrough"},
+						{Name: "VAULT_JSON_LOG", Value: "enableJSONLog"},
+						{Name: "VAULT_CLIENT_TIMEOUT", Value: "10s"},
+						{Name: "VAULT_ENV_FILES", Value: `[{"path":"app.conf","template":"password=${ vault \"vault:secret/data/app#password\" }"}]`},
+						{Name: "VAULT_ENV_FILES_DIR", Value: "/vault/env-files"},
+					},
+				},
+			},
+			mutated: true,
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -663,6 +782,146 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{name: "Will mutate pod with vault-files annotation",
+			fields: fields{
+				k8sClient: fake.NewSimpleClientset(),
+				registry: &MockRegistry{
+					Image: imagev1.ImageConfig{},
+				},
+			},
+			args: args{
+				pod: &corev1.Pod{
+					Spec: corev1.PodSpec{
+						SecurityContext: &corev1.PodSecurityContext{
+							RunAsUser: &runAsUser,
+						},
+						Containers: []corev1.Container{
+							{
+								Name:    "MyContainer",
+								Image:   "myimage",
+								Command: []string{"/bin/bash"},
+								Args:    nil,
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "token",
+										MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+									},
+								},
+							},
+						},
+					},
+				},
+				vaultConfig: VaultConfig{
+					VaultFiles:     "- path: app.conf\n  template: 'password=${ vault \"vault:secret/data/app#password\" }'\n",
+					ConfigfilePath: "/vault/secrets",
+					Addr:           "test",
+					SkipVerify:     false,
+					Path:           "kubernetes",
+					Role:           "app",
+					ClientTimeout:  10 * time.Second,
+				},
+			},
+			wantedPod: &corev1.Pod{
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsUser: &runAsUser,
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:            "vault-env-files",
+							Image:           "banzaicloud/vault-env:latest",
+							ImagePullPolicy: "IfNotPresent",
+							Command:         []string{"/usr/local/bin/vault-env"},
+							Env: []corev1.EnvVar{
+								{Name: "VAULT_ADDR", Value: "test"},
+								{Name: "VAULT_SKIP_VERIFY", Value: "false"},
+								{Name: "VAULT_PATH", Value: "kubernetes"},
+								{Name: "VAULT_ROLE", Value: "app"},
+								{Name: "VAULT_IGNORE_MISSING_SECRETS", Value: ""},
+								{Name: "VAULT_JSON_LOG", Value: ""},
+								{Name: "VAULT_CLIENT_TIMEOUT", Value: "10s"},
+								{Name: "VAULT_ENV_FILES", Value: `[{"path":"app.conf","template":"password=${ vault \"vault:secret/data/app#password\" }"}]`},
+								{Name: "VAULT_ENV_FILES_DIR", Value: "/vault/secrets"},
+							},
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("50m"),
+									corev1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+							},
+							SecurityContext: initContainerSecurityContext,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "vault-env",
+									MountPath: "/vault/",
+								},
+								{
+									Name:      "token",
+									MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+								},
+								{
+									Name:      "vault-files",
+									MountPath: "/vault/secrets",
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "MyContainer",
+							Image:   "myimage",
+							Command: []string{"/bin/bash"},
+							Args:    nil,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "token",
+									MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+								},
+								{
+									Name:      "vault-files",
+									MountPath: "/vault/secrets",
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "vault-env",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{
+									Medium: corev1.StorageMediumMemory,
+								},
+							},
+						},
+						{
+							Name: "vault-files",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{
+									Medium: corev1.StorageMediumMemory,
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{name: "Will not mutate pod with vault-files and ct-configmap annotations",
+			fields: fields{
+				k8sClient: fake.NewSimpleClientset(),
+			},
+			args: args{
+				pod: &corev1.Pod{},
+				vaultConfig: VaultConfig{
+					VaultFiles:     "- path: app.conf\n  template: config\n",
+					CtConfigMap:    "config-map-test",
+					ConfigfilePath: "/vault/secrets",
+				},
+			},
+			wantErr:   true,
+			wantedPod: &corev1.Pod{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,38 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/recovery"
+)
+
+// recoverPanics answers the admission requests whose handling panicked with 500 Internal Server Error,
+// so the failure policy of the webhook applies to them, and the panic is logged with its stack trace
+func recoverPanics(webhook string, next http.Handler, panics metrics.Counter, logger logrus.FieldLogger) http.Handler {
+	return recovery.Handler(next, func(r *http.Request, p *recovery.Panic) {
+		logger.WithFields(logrus.Fields{
+			"webhook": webhook,
+			"path":    r.URL.Path,
+			"stack":   string(p.Stack),
+		}).Errorf("recovered from panic while handling admission request: %v", p.Value)
+
+		panics.Add(1, webhook)
+	})
+}
@@ -62,6 +62,7 @@ func (mw *mutatingWebhook) mutateSecret(secret *corev1.Secret, vaultConfig Vault
 				return errors.Wrap(err, "mutate dockerconfig json failed")
 			}
 		} else if hasVaultPrefix(string(value)) {
+			mw.metrics.observe("secret", string(value))
 			sc := map[string]string{
 				key: string(value),
 			}
@@ -85,6 +86,7 @@ func (mw *mutatingWebhook) mutateDockerCreds(secret *corev1.Secret, dc *registry
 		}
 		auth := string(authBytes)
 		if hasVaultPrefix(auth) {
+			mw.metrics.observe("secret", auth)
 			split := strings.Split(auth, ":")
 			if len(split) != 4 {
 				return errors.New("splitting auth credentials failed") // nolint:goerr113
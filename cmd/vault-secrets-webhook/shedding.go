@@ -0,0 +1,119 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+)
+
+const (
+	// criticalPriority is the value of the priority label of the namespaces which are never shed
+	criticalPriority = "critical"
+
+	failurePolicyIgnore = "Ignore"
+	failurePolicyFail   = "Fail"
+)
+
+// lookupShedder bounds the number of in-flight Vault lookups of the webhook. Once the threshold is
+// exceeded the requests of low-priority namespaces aren't sent to Vault, the failure policy of their
+// resource kind is applied immediately instead, while the ones of critical namespaces are still served.
+// Namespaces are critical if their priority label is set to "critical".
+type lookupShedder struct {
+	k8sClient kubernetes.Interface
+	logger    logrus.FieldLogger
+
+	threshold       int64
+	priorityLabel   string
+	failurePolicies map[string]string
+
+	inFlight int64
+
+	inFlightGauge metrics.Gauge
+	shedCounter   metrics.Counter
+}
+
+func newLookupShedder(k8sClient kubernetes.Interface, logger logrus.FieldLogger, recorder metrics.Recorder, threshold int, priorityLabel string, failurePolicies map[string]string) *lookupShedder {
+	recorder = metrics.OrNoop(recorder)
+	return &lookupShedder{
+		k8sClient:       k8sClient,
+		logger:          logger,
+		threshold:       int64(threshold),
+		priorityLabel:   priorityLabel,
+		failurePolicies: failurePolicies,
+		inFlightGauge: recorder.Gauge(
+			"in_flight_vault_lookups",
+			"Number of requests doing Vault lookups currently.",
+		),
+		shedCounter: recorder.Counter(
+			"shed_vault_lookups_total",
+			"Number of requests whose Vault lookups were shed, by resource kind and the applied failure policy.",
+			"kind", "failure_policy",
+		),
+	}
+}
+
+// isCritical reports whether the lookups of the namespace must not be shed
+func (s *lookupShedder) isCritical(ns string) bool {
+	namespace, err := s.k8sClient.CoreV1().Namespaces().Get(ns, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Warnf("failed to get namespace %s, handling it as low-priority: %s", ns, err)
+		return false
+	}
+	return namespace.GetLabels()[s.priorityLabel] == criticalPriority
+}
+
+// failurePolicy returns the failure policy of the resource kind, Ignore unless it is set to Fail
+func (s *lookupShedder) failurePolicy(kind string) string {
+	if strings.EqualFold(s.failurePolicies[kind], failurePolicyFail) {
+		return failurePolicyFail
+	}
+	return failurePolicyIgnore
+}
+
+// do calls lookup, which does the Vault lookups of a resource of the kind in the namespace, unless it has to be shed.
+// Shed requests are admitted without mutation with the Ignore failure policy and rejected with Fail.
+// It is safe to call on a nil receiver, that doesn't shed anything.
+func (s *lookupShedder) do(kind, ns string, lookup func() error) error {
+	if s == nil || s.threshold <= 0 {
+		return lookup()
+	}
+
+	s.inFlightGauge.Add(1)
+	defer func() {
+		atomic.AddInt64(&s.inFlight, -1)
+		s.inFlightGauge.Add(-1)
+	}()
+	if atomic.AddInt64(&s.inFlight, 1) <= s.threshold || s.isCritical(ns) {
+		return lookup()
+	}
+
+	policy := s.failurePolicy(kind)
+	s.shedCounter.Add(1, kind, policy)
+
+	if policy == failurePolicyFail {
+		return errors.Errorf("too many in-flight Vault lookups, rejecting %s of low-priority namespace %s", kind, ns)
+	}
+
+	s.logger.Warnf("too many in-flight Vault lookups, admitting %s of low-priority namespace %s without mutation", kind, ns)
+	return nil
+}
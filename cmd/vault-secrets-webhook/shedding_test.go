@@ -0,0 +1,81 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_lookupShedder_do(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "system",
+				Labels: map[string]string{"priority": "critical"},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "batch",
+			},
+		},
+	)
+
+	shedder := newLookupShedder(k8sClient, logrus.New(), nil, 1, "priority", map[string]string{"secret": "Fail", "configmap": "Ignore"})
+
+	var lookups []string
+	lookup := func(kind, ns string) func() error {
+		return func() error {
+			lookups = append(lookups, kind+"/"+ns)
+			return nil
+		}
+	}
+
+	// below the threshold every namespace is served
+	if err := shedder.do("secret", "batch", lookup("secret", "batch")); err != nil {
+		t.Fatal(err)
+	}
+
+	// take the in-flight lookup of the threshold
+	err := shedder.do("secret", "system", func() error {
+		if err := shedder.do("secret", "system", lookup("secret", "system")); err != nil {
+			t.Errorf("lookup of critical namespace shed: %s", err)
+		}
+		if err := shedder.do("secret", "batch", lookup("secret", "batch")); err == nil {
+			t.Error("expected the shed secret to be rejected")
+		}
+		if err := shedder.do("configmap", "batch", lookup("configmap", "batch")); err != nil {
+			t.Errorf("expected the shed configmap to be ignored: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"secret/batch", "secret/system"}
+	if len(lookups) != len(expected) || lookups[0] != expected[0] || lookups[1] != expected[1] {
+		t.Errorf("unexpected lookups: %v", lookups)
+	}
+
+	if shedder.inFlight != 0 {
+		t.Errorf("expected no in-flight lookups, got %d", shedder.inFlight)
+	}
+}
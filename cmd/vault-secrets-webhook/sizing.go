@@ -0,0 +1,100 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// templateSecretReference matches the secret lookups of the consul-template and Vault Agent templates,
+// the quotes may be escaped in the templates inlined into the HCL configuration
+var templateSecretReference = regexp.MustCompile(`\b(secret|secrets|pkiCert)\s+\\?"`)
+
+// resourceSizing scales the resources of the injected sidecars with the number of secrets they render:
+// the requests are the base plus the per reference amount for every reference, capped at the maximum,
+// the limits are raised to the requests if they are lower. The secrets aren't read by the webhook,
+// so their sizes aren't known, only their references are counted.
+type resourceSizing struct {
+	cpuBase, cpuPerReference, cpuMax          resource.Quantity
+	memoryBase, memoryPerReference, memoryMax resource.Quantity
+}
+
+// resourceSizingFromConfig returns the sizing of the webhook configuration
+func resourceSizingFromConfig() resourceSizing {
+	quantity := func(key string) resource.Quantity {
+		q, err := resource.ParseQuantity(viper.GetString(key))
+		if err != nil {
+			return resource.Quantity{}
+		}
+		return q
+	}
+
+	return resourceSizing{
+		cpuBase:            quantity("sidecar_cpu_request_base"),
+		cpuPerReference:    quantity("sidecar_cpu_request_per_reference"),
+		cpuMax:             quantity("sidecar_cpu_request_max"),
+		memoryBase:         quantity("sidecar_memory_request_base"),
+		memoryPerReference: quantity("sidecar_memory_request_per_reference"),
+		memoryMax:          quantity("sidecar_memory_request_max"),
+	}
+}
+
+func sizedQuantity(base, perReference, max resource.Quantity, references int) resource.Quantity {
+	sized := base.DeepCopy()
+	for i := 0; i < references; i++ {
+		sized.Add(perReference)
+	}
+	if !max.IsZero() && sized.Cmp(max) > 0 {
+		return max.DeepCopy()
+	}
+	return sized
+}
+
+// resources returns the resources of a sidecar rendering the number of secret references with the limits
+func (s resourceSizing) resources(limits corev1.ResourceList, references int) corev1.ResourceRequirements {
+	requests := corev1.ResourceList{
+		corev1.ResourceCPU:    sizedQuantity(s.cpuBase, s.cpuPerReference, s.cpuMax, references),
+		corev1.ResourceMemory: sizedQuantity(s.memoryBase, s.memoryPerReference, s.memoryMax, references),
+	}
+
+	sizedLimits := corev1.ResourceList{}
+	for name, limit := range limits {
+		if request, ok := requests[name]; ok && request.Cmp(limit) > 0 {
+			limit = request
+		}
+		sizedLimits[name] = limit
+	}
+
+	return corev1.ResourceRequirements{Requests: requests, Limits: sizedLimits}
+}
+
+// templateSecretReferences counts the secret references in the templates of the ConfigMap
+func (mw *mutatingWebhook) templateSecretReferences(configMapName, ns string) int {
+	data, err := mw.getDataFromConfigmap(configMapName, ns)
+	if err != nil {
+		mw.logger.Warnf("failed to get configmap %s for sizing the sidecar resources, sizing it for no references: %s", configMapName, err)
+		return 0
+	}
+
+	var references int
+	for _, template := range data {
+		references += len(templateSecretReference.FindAllString(template, -1))
+	}
+	return references
+}
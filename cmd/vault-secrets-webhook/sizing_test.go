@@ -0,0 +1,97 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	cmp "github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_resourceSizing_resources(t *testing.T) {
+	sizing := resourceSizing{
+		cpuBase:            resource.MustParse("25m"),
+		cpuPerReference:    resource.MustParse("5m"),
+		cpuMax:             resource.MustParse("500m"),
+		memoryBase:         resource.MustParse("32Mi"),
+		memoryPerReference: resource.MustParse("2Mi"),
+		memoryMax:          resource.MustParse("512Mi"),
+	}
+	limits := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	}
+
+	tests := []struct {
+		name       string
+		references int
+		requests   corev1.ResourceList
+		limits     corev1.ResourceList
+	}{
+		{
+			name:       "few references",
+			references: 3,
+			requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("40m"),
+				corev1.ResourceMemory: resource.MustParse("38Mi"),
+			},
+			limits: limits,
+		},
+		{
+			name:       "many references",
+			references: 200,
+			requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("432Mi"),
+			},
+			limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("432Mi"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := sizing.resources(limits, tt.references)
+			for _, list := range []struct{ want, got corev1.ResourceList }{{tt.requests, got.Requests}, {tt.limits, got.Limits}} {
+				for name, want := range list.want {
+					if q := list.got[name]; q.Cmp(want) != 0 {
+						t.Errorf("%s: expected %s, got %s", name, want.String(), q.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_templateSecretReferences(t *testing.T) {
+	mw := mutatingWebhook{k8sClient: fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: "default"},
+		Data: map[string]string{
+			"config.hcl": `template { contents = "{{ with secret \"secret/data/db\" }}{{ .Data.data.password }}{{ end }}" }`,
+			"app.tmpl":   `{{ with secret "secret/data/a" }}{{ end }}{{ range secrets "secret/metadata/" }}{{ end }}{{ with pkiCert "pki/issue/app" }}{{ end }}`,
+		},
+	})}
+
+	if diff := cmp.Diff(4, mw.templateSecretReferences("templates", "default")); diff != "" {
+		t.Errorf("unexpected references (-want +got):\n%s", diff)
+	}
+}
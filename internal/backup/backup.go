@@ -0,0 +1,296 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup stores Raft snapshots of Vault in object storages with retention policies.
+package backup
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	snapshotPrefix    = "vault-raft-snapshot-"
+	snapshotSuffix    = ".snap"
+	encryptedSuffix   = ".enc"
+	snapshotTimestamp = "20060102T150405Z"
+)
+
+// Storage is an object storage where the snapshots are stored
+type Storage interface {
+	Upload(ctx context.Context, name string, r io.Reader) error
+	Download(ctx context.Context, name string, w io.Writer) error
+	// List returns the names of all objects in the storage
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// Snapshotter takes Raft snapshots, it is implemented by the Vault helper of the SDK
+type Snapshotter interface {
+	RaftSnapshot(w io.Writer) (int64, error)
+}
+
+// Retention defines which snapshots are kept, zero values mean no limit
+type Retention struct {
+	// the number of the latest snapshots to keep
+	Count int
+	// how long the snapshots are kept
+	MaxAge time.Duration
+}
+
+// Snapshot is a stored snapshot
+type Snapshot struct {
+	Name      string
+	Time      time.Time
+	Encrypted bool
+}
+
+// parseSnapshot parses the name of a stored snapshot, it returns false for other objects
+func parseSnapshot(name string) (Snapshot, bool) {
+	snapshot := Snapshot{Name: name}
+
+	if strings.HasSuffix(name, encryptedSuffix) {
+		snapshot.Encrypted = true
+		name = strings.TrimSuffix(name, encryptedSuffix)
+	}
+
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return snapshot, false
+	}
+
+	t, err := time.Parse(snapshotTimestamp, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+	if err != nil {
+		return snapshot, false
+	}
+	snapshot.Time = t
+
+	return snapshot, true
+}
+
+// Manager takes, stores and prunes the snapshots
+type Manager struct {
+	storage   Storage
+	encryptor *encryptor
+	retention Retention
+	now       func() time.Time
+}
+
+// NewManager creates a Manager, the snapshots are encrypted with AES-256-GCM
+// if a base64 encoded 32 byte encryption key is given
+func NewManager(storage Storage, encryptionKey string, retention Retention) (*Manager, error) {
+	m := Manager{storage: storage, retention: retention, now: time.Now}
+
+	if encryptionKey != "" {
+		var err error
+		m.encryptor, err = newEncryptor(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+// Snapshots returns the stored snapshots from the newest to the oldest
+func (m *Manager) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	names, err := m.storage.List(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing snapshots")
+	}
+
+	var snapshots []Snapshot
+	for _, name := range names {
+		if snapshot, ok := parseSnapshot(name); ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+
+	return snapshots, nil
+}
+
+// Backup takes a snapshot and stores it, then prunes the snapshots which are not retained anymore
+func (m *Manager) Backup(ctx context.Context, snapshotter Snapshotter) (Snapshot, int64, error) {
+	snapshot := Snapshot{Time: m.now().UTC().Truncate(time.Second)}
+	snapshot.Name = snapshotPrefix + snapshot.Time.Format(snapshotTimestamp) + snapshotSuffix
+
+	if m.encryptor != nil {
+		snapshot.Name += encryptedSuffix
+		snapshot.Encrypted = true
+	}
+
+	// the snapshot is streamed to the storage, the upload is canceled if the snapshot fails,
+	// so that the storages don't store a partial snapshot
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		size int64
+		err  error
+	}
+	results := make(chan result, 1)
+
+	r, w := io.Pipe()
+	go func() {
+		size, err := m.snapshot(snapshotter, w)
+		if err != nil {
+			cancel()
+		}
+		_ = w.CloseWithError(err)
+		results <- result{size: size, err: err}
+	}()
+
+	uploadErr := m.storage.Upload(uploadCtx, snapshot.Name, r)
+	// unblocks the snapshot if the upload stopped reading it
+	_ = r.CloseWithError(io.ErrClosedPipe)
+
+	res := <-results
+	if res.err != nil && !errors.Is(res.err, io.ErrClosedPipe) {
+		return snapshot, 0, res.err
+	}
+	if uploadErr != nil {
+		return snapshot, 0, errors.Wrapf(uploadErr, "error uploading snapshot %s", snapshot.Name)
+	}
+	if res.err != nil {
+		return snapshot, 0, res.err
+	}
+	size := res.size
+
+	logrus.WithFields(logrus.Fields{"snapshot": snapshot.Name, "size": size}).Info("snapshot stored")
+
+	if err := m.Prune(ctx); err != nil {
+		return snapshot, size, errors.Wrap(err, "error pruning snapshots")
+	}
+
+	return snapshot, size, nil
+}
+
+// snapshot takes a snapshot and writes it to w, encrypted if there is an encryption key
+func (m *Manager) snapshot(snapshotter Snapshotter, w io.Writer) (int64, error) {
+	if m.encryptor == nil {
+		return snapshotter.RaftSnapshot(w)
+	}
+
+	ew, err := m.encryptor.encryptWriter(w)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := snapshotter.RaftSnapshot(ew)
+	if err != nil {
+		return 0, err
+	}
+
+	return size, errors.Wrap(ew.Close(), "error encrypting snapshot")
+}
+
+// Prune deletes the snapshots which are not retained anymore, the latest snapshot is always kept
+func (m *Manager) Prune(ctx context.Context) error {
+	snapshots, err := m.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := m.now()
+	for i, snapshot := range snapshots {
+		if i == 0 {
+			continue
+		}
+
+		expiredCount := m.retention.Count > 0 && i >= m.retention.Count
+		expiredAge := m.retention.MaxAge > 0 && now.Sub(snapshot.Time) > m.retention.MaxAge
+		if !expiredCount && !expiredAge {
+			continue
+		}
+
+		if err := m.storage.Delete(ctx, snapshot.Name); err != nil {
+			return errors.Wrapf(err, "error deleting snapshot %s", snapshot.Name)
+		}
+
+		logrus.WithField("snapshot", snapshot.Name).Info("snapshot pruned")
+	}
+
+	return nil
+}
+
+// Snapshot returns the stored snapshot with the name, or the latest snapshot if the name is empty
+func (m *Manager) Snapshot(ctx context.Context, name string) (Snapshot, error) {
+	snapshots, err := m.Snapshots(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	for _, snapshot := range snapshots {
+		if name == "" || snapshot.Name == name {
+			return snapshot, nil
+		}
+	}
+
+	if name == "" {
+		return Snapshot{}, errors.New("there are no snapshots in the storage") // nolint:goerr113
+	}
+
+	return Snapshot{}, errors.Errorf("snapshot %s is not in the storage", name)
+}
+
+// Download writes the decrypted snapshot to w, the chunks of an encrypted snapshot are written once they
+// are authenticated, so w has to be discarded if there is an error
+func (m *Manager) Download(ctx context.Context, snapshot Snapshot, w io.Writer) error {
+	if !snapshot.Encrypted {
+		return m.storage.Download(ctx, snapshot.Name, w)
+	}
+
+	if m.encryptor == nil {
+		return errors.Errorf("snapshot %s is encrypted, but there is no encryption key", snapshot.Name)
+	}
+
+	dw := m.encryptor.decryptWriter(w)
+	if err := m.storage.Download(ctx, snapshot.Name, dw); err != nil {
+		return errors.Wrapf(err, "error decrypting snapshot %s", snapshot.Name)
+	}
+
+	return errors.Wrapf(dw.Close(), "error decrypting snapshot %s", snapshot.Name)
+}
+
+// DownloadFile writes the decrypted snapshot to a temporary file, so that it can be read more than once
+// without holding it in memory. The returned file is rewound, the caller has to close and remove it.
+func (m *Manager) DownloadFile(ctx context.Context, snapshot Snapshot) (*os.File, error) {
+	file, err := ioutil.TempFile("", snapshotPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating temporary file")
+	}
+
+	if err := m.Download(ctx, snapshot, file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, errors.Wrap(err, "error rewinding temporary file")
+	}
+
+	return file, nil
+}
@@ -0,0 +1,151 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSnapshotter []byte
+
+func (f fakeSnapshotter) RaftSnapshot(w io.Writer) (int64, error) {
+	n, err := w.Write(f)
+	return int64(n), err
+}
+
+func TestManagerBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	// objects which are not snapshots are never pruned
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("keep"), 0600))
+
+	manager, err := NewManager(storage, "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=", Retention{Count: 2})
+	require.NoError(t, err)
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Hour)
+
+		snapshot, size, err := manager.Backup(context.Background(), fakeSnapshotter("snapshot"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), size)
+		assert.True(t, snapshot.Encrypted)
+	}
+
+	snapshots, err := manager.Snapshots(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "vault-raft-snapshot-20200601T150000Z.snap.enc", snapshots[0].Name)
+	assert.Equal(t, "vault-raft-snapshot-20200601T140000Z.snap.enc", snapshots[1].Name)
+
+	var stored bytes.Buffer
+	require.NoError(t, storage.Download(context.Background(), snapshots[0].Name, &stored))
+	assert.NotContains(t, stored.String(), "snapshot")
+
+	latest, err := manager.Snapshot(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, snapshots[0], latest)
+
+	var downloaded bytes.Buffer
+	require.NoError(t, manager.Download(context.Background(), latest, &downloaded))
+	assert.Equal(t, "snapshot", downloaded.String())
+
+	file, err := manager.DownloadFile(context.Background(), latest)
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "snapshot", string(data))
+
+	names, err := storage.List(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, names, "README")
+}
+
+type failingSnapshotter struct{}
+
+func (failingSnapshotter) RaftSnapshot(w io.Writer) (int64, error) {
+	n, err := w.Write([]byte("partial"))
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), errors.New("connection reset") // nolint:goerr113
+}
+
+func TestManagerBackupFailedSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	manager, err := NewManager(storage, "", Retention{})
+	require.NoError(t, err)
+
+	_, _, err = manager.Backup(context.Background(), failingSnapshotter{})
+	assert.EqualError(t, err, "connection reset")
+
+	names, err := storage.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, names, "a partial snapshot shouldn't be stored")
+}
+
+func TestManagerPruneMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"vault-raft-snapshot-20200520T120000Z.snap",
+		"vault-raft-snapshot-20200530T120000Z.snap",
+		"vault-raft-snapshot-20200531T120000Z.snap",
+	} {
+		require.NoError(t, storage.Upload(context.Background(), name, bytes.NewReader(nil)))
+	}
+
+	manager, err := NewManager(storage, "", Retention{MaxAge: 7 * 24 * time.Hour})
+	require.NoError(t, err)
+	manager.now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	require.NoError(t, manager.Prune(context.Background()))
+
+	snapshots, err := manager.Snapshots(context.Background())
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, "vault-raft-snapshot-20200530T120000Z.snap", snapshots[1].Name)
+}
@@ -0,0 +1,198 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"emperror.dev/errors"
+)
+
+// encryptor encrypts the snapshots with AES-256-GCM as a stream of chunks, so that a snapshot is never
+// held in memory as a whole. The stream starts with a random nonce prefix, the nonce of each chunk is
+// the prefix, the big-endian index of the chunk and a flag which is only set for the last chunk, so
+// reordered, dropped and truncated chunks fail the authentication.
+type encryptor struct {
+	aead cipher.AEAD
+}
+
+const (
+	encryptionChunkSize   = 64 * 1024
+	encryptionNoncePrefix = 7
+)
+
+func newEncryptor(encodedKey string) (*encryptor, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding encryption key")
+	}
+
+	if len(key) != 32 {
+		return nil, errors.Errorf("invalid encryption key length: %d, a 32 byte key is required", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating gcm cipher")
+	}
+
+	return &encryptor{aead: aead}, nil
+}
+
+// chunkNonce returns the nonce of the chunk with the index
+func (e *encryptor) chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, e.aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionNoncePrefix:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encryptWriter returns a writer which writes the encrypted stream of the written data to w,
+// it has to be closed to write the last chunk
+func (e *encryptor) encryptWriter(w io.Writer) (io.WriteCloser, error) {
+	prefix := make([]byte, encryptionNoncePrefix)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, errors.Wrap(err, "error generating nonce")
+	}
+
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{encryptor: e, w: w, prefix: prefix, buffer: make([]byte, 0, encryptionChunkSize)}, nil
+}
+
+// decryptWriter returns a writer which writes the decrypted data of the written stream to w, only
+// authenticated chunks are written, the last one when it is closed
+func (e *encryptor) decryptWriter(w io.Writer) io.WriteCloser {
+	return &decryptingWriter{encryptor: e, w: w}
+}
+
+type encryptingWriter struct {
+	*encryptor
+	w      io.Writer
+	prefix []byte
+	buffer []byte
+	index  uint32
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// a full chunk is only sealed when there is more data, since the last chunk is flagged
+		if len(w.buffer) == encryptionChunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+c]
+		p = p[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
+func (w *encryptingWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *encryptingWriter) seal(last bool) error {
+	if w.index == math.MaxUint32 {
+		return errors.New("snapshot is too large to encrypt") // nolint:goerr113
+	}
+
+	if _, err := w.w.Write(w.aead.Seal(nil, w.chunkNonce(w.prefix, w.index, last), w.buffer, nil)); err != nil {
+		return err
+	}
+
+	w.buffer = w.buffer[:0]
+	w.index++
+
+	return nil
+}
+
+type decryptingWriter struct {
+	*encryptor
+	w      io.Writer
+	prefix []byte
+	buffer []byte
+	index  uint32
+}
+
+func (w *decryptingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if len(w.prefix) < encryptionNoncePrefix {
+		c := encryptionNoncePrefix - len(w.prefix)
+		if c > len(p) {
+			c = len(p)
+		}
+		w.prefix = append(w.prefix, p[:c]...)
+		p = p[c:]
+	}
+
+	w.buffer = append(w.buffer, p...)
+
+	// a full chunk is only opened when there is more data, since the last chunk is flagged
+	chunkSize := encryptionChunkSize + w.aead.Overhead()
+	for len(w.buffer) > chunkSize {
+		if err := w.open(w.buffer[:chunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buffer = w.buffer[:copy(w.buffer, w.buffer[chunkSize:])]
+	}
+
+	return n, nil
+}
+
+func (w *decryptingWriter) Close() error {
+	if len(w.prefix) < encryptionNoncePrefix {
+		return errors.New("encrypted snapshot is too short") // nolint:goerr113
+	}
+
+	return w.open(w.buffer, true)
+}
+
+func (w *decryptingWriter) open(chunk []byte, last bool) error {
+	plaintext, err := w.aead.Open(nil, w.chunkNonce(w.prefix, w.index, last), chunk, nil)
+	if err != nil {
+		return errors.Wrap(err, "error decrypting snapshot")
+	}
+
+	if _, err := w.w.Write(plaintext); err != nil {
+		return err
+	}
+
+	w.index++
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptTest(t *testing.T, e *encryptor, plaintext []byte) []byte {
+	var ciphertext bytes.Buffer
+	ew, err := e.encryptWriter(&ciphertext)
+	require.NoError(t, err)
+	_, err = io.Copy(ew, bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	require.NoError(t, ew.Close())
+	return ciphertext.Bytes()
+}
+
+func decryptTest(e *encryptor, ciphertext []byte) ([]byte, error) {
+	var plaintext bytes.Buffer
+	dw := e.decryptWriter(&plaintext)
+	if _, err := io.Copy(dw, bytes.NewReader(ciphertext)); err != nil {
+		return nil, err
+	}
+	if err := dw.Close(); err != nil {
+		return nil, err
+	}
+	return plaintext.Bytes(), nil
+}
+
+func TestEncryptionStream(t *testing.T) {
+	e, err := newEncryptor("MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=")
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, encryptionChunkSize - 1, encryptionChunkSize, 3*encryptionChunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext := encryptTest(t, e, plaintext)
+
+		decrypted, err := decryptTest(e, ciphertext)
+		require.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(plaintext, decrypted), "size %d", size)
+
+		if size <= encryptionChunkSize {
+			continue
+		}
+
+		// dropping the last chunk leaves a stream which ends with a chunk not flagged as the last one
+		chunk := encryptionChunkSize + e.aead.Overhead()
+		_, err = decryptTest(e, ciphertext[:encryptionNoncePrefix+chunk])
+		assert.Error(t, err, "a truncated snapshot of size %d should fail the authentication", size)
+	}
+}
+
+func TestEncryptionTampered(t *testing.T) {
+	e, err := newEncryptor("MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=")
+	require.NoError(t, err)
+
+	ciphertext := encryptTest(t, e, []byte("snapshot"))
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	_, err = decryptTest(e, ciphertext)
+	assert.Error(t, err)
+
+	_, err = decryptTest(e, ciphertext[:3])
+	assert.Error(t, err, "a snapshot shorter than the nonce prefix can't be decrypted")
+}
@@ -0,0 +1,97 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+type azureStorage struct {
+	container azblob.ContainerURL
+	prefix    string
+}
+
+// NewAzureStorage creates a Storage backed by an Azure Blob Storage container, authenticated with a shared key
+func NewAzureStorage(account, accountKey, container, prefix string) (Storage, error) {
+	if account == "" || container == "" {
+		return nil, errors.New("storage account and container must be specified") // nolint:goerr113
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(account, accountKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating azure storage credential")
+	}
+
+	u, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", account, container))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing azure container url")
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+
+	return &azureStorage{container: azblob.NewContainerURL(*u, pipeline), prefix: prefix}, nil
+}
+
+func (a *azureStorage) Upload(ctx context.Context, name string, r io.Reader) error {
+	blob := a.container.NewBlockBlobURL(a.prefix + name)
+	_, err := azblob.UploadStreamToBlockBlob(ctx, r, blob, azblob.UploadStreamToBlockBlobOptions{})
+	return errors.Wrapf(err, "error uploading '%s' to azure container", a.prefix+name)
+}
+
+func (a *azureStorage) Download(ctx context.Context, name string, w io.Writer) error {
+	blob := a.container.NewBlockBlobURL(a.prefix + name)
+	resp, err := blob.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return errors.Wrapf(err, "error downloading '%s' from azure container", a.prefix+name)
+	}
+
+	body := resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 3})
+	defer body.Close()
+
+	_, err = io.Copy(w, body)
+	return errors.Wrapf(err, "error downloading '%s' from azure container", a.prefix+name)
+}
+
+func (a *azureStorage) List(ctx context.Context) ([]string, error) {
+	var names []string
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := a.container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: a.prefix})
+		if err != nil {
+			return nil, errors.Wrap(err, "error listing azure container")
+		}
+
+		for _, blob := range resp.Segment.BlobItems {
+			names = append(names, strings.TrimPrefix(blob.Name, a.prefix))
+		}
+
+		marker = resp.NextMarker
+	}
+
+	return names, nil
+}
+
+func (a *azureStorage) Delete(ctx context.Context, name string) error {
+	blob := a.container.NewBlockBlobURL(a.prefix + name)
+	_, err := blob.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	return errors.Wrapf(err, "error deleting '%s' from azure container", a.prefix+name)
+}
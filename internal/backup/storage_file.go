@@ -0,0 +1,93 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"emperror.dev/errors"
+)
+
+type fileStorage struct {
+	path string
+}
+
+// NewFileStorage creates a Storage backed by a local directory, e.g. a mounted persistent volume
+func NewFileStorage(path string) (Storage, error) {
+	if path == "" {
+		return nil, errors.New("path must be specified") // nolint:goerr113
+	}
+
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errors.Wrap(err, "error creating backup directory")
+	}
+
+	return &fileStorage{path: path}, nil
+}
+
+func (f *fileStorage) Upload(_ context.Context, name string, r io.Reader) error {
+	// write to a temporary file first, so a failed upload doesn't leave a partial snapshot behind
+	tmp, err := ioutil.TempFile(f.path, "."+name)
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return errors.Wrapf(err, "error writing file '%s'", name)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "error writing file '%s'", name)
+	}
+
+	return errors.Wrapf(os.Rename(tmp.Name(), filepath.Join(f.path, name)), "error writing file '%s'", name)
+}
+
+func (f *fileStorage) Download(_ context.Context, name string, w io.Writer) error {
+	file, err := os.Open(filepath.Join(f.path, name))
+	if err != nil {
+		return errors.Wrapf(err, "error reading file '%s'", name)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return errors.Wrapf(err, "error reading file '%s'", name)
+}
+
+func (f *fileStorage) List(_ context.Context) ([]string, error) {
+	files, err := ioutil.ReadDir(f.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing backup directory")
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.Mode().IsRegular() {
+			names = append(names, file.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (f *fileStorage) Delete(_ context.Context, name string) error {
+	return errors.Wrapf(os.Remove(filepath.Join(f.path, name)), "error deleting file '%s'", name)
+}
@@ -0,0 +1,96 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"emperror.dev/errors"
+	"google.golang.org/api/iterator"
+)
+
+type gcsStorage struct {
+	client *storage.Client
+	bucket string
+	prefix string
+}
+
+// NewGCSStorage creates a Storage backed by a Google Cloud Storage bucket
+func NewGCSStorage(bucket, prefix string) (Storage, error) {
+	if bucket == "" {
+		return nil, errors.New("bucket must be specified") // nolint:goerr113
+	}
+
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating gcs client")
+	}
+
+	return &gcsStorage{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (g *gcsStorage) Upload(ctx context.Context, name string, r io.Reader) error {
+	// closing the writer would create the object, canceling the context discards the partial upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := g.client.Bucket(g.bucket).Object(g.prefix + name).NewWriter(ctx)
+
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		_ = w.Close()
+		return errors.Wrapf(err, "error uploading '%s' to gcs bucket '%s'", g.prefix+name, g.bucket)
+	}
+
+	// the object is only created when the writer is closed successfully
+	return errors.Wrapf(w.Close(), "error uploading '%s' to gcs bucket '%s'", g.prefix+name, g.bucket)
+}
+
+func (g *gcsStorage) Download(ctx context.Context, name string, w io.Writer) error {
+	r, err := g.client.Bucket(g.bucket).Object(g.prefix + name).NewReader(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error downloading '%s' from gcs bucket '%s'", g.prefix+name, g.bucket)
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return errors.Wrapf(err, "error downloading '%s' from gcs bucket '%s'", g.prefix+name, g.bucket)
+}
+
+func (g *gcsStorage) List(ctx context.Context) ([]string, error) {
+	var names []string
+
+	objects := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{Prefix: g.prefix})
+	for {
+		object, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing gcs bucket '%s'", g.bucket)
+		}
+		names = append(names, strings.TrimPrefix(object.Name, g.prefix))
+	}
+
+	return names, nil
+}
+
+func (g *gcsStorage) Delete(ctx context.Context, name string) error {
+	err := g.client.Bucket(g.bucket).Object(g.prefix + name).Delete(ctx)
+	return errors.Wrapf(err, "error deleting '%s' from gcs bucket '%s'", g.prefix+name, g.bucket)
+}
@@ -0,0 +1,122 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv/awskms"
+)
+
+type s3Storage struct {
+	client   *awss3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+	sseAlgo  string
+	sseKeyID string
+}
+
+// NewS3Storage creates a Storage backed by an AWS S3 bucket, with optional server side encryption
+func NewS3Storage(region, bucket, prefix, sseAlgo, sseKeyID string) (Storage, error) {
+	if region == "" {
+		return nil, errors.New("region must be specified") // nolint:goerr113
+	}
+
+	if bucket == "" {
+		return nil, errors.New("bucket must be specified") // nolint:goerr113
+	}
+
+	if sseAlgo == awskms.SseKMS && sseKeyID == "" {
+		return nil, errors.New("you need to provide a CMK KeyID when using aws:kms for SSE") // nolint:goerr113
+	}
+
+	sess, err := session.NewSession(aws.NewConfig().WithRegion(region))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating aws session")
+	}
+
+	return &s3Storage{
+		client:   awss3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		prefix:   prefix,
+		sseAlgo:  sseAlgo,
+		sseKeyID: sseKeyID,
+	}, nil
+}
+
+func (s *s3Storage) Upload(ctx context.Context, name string, r io.Reader) error {
+	input := s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+		Body:   r,
+	}
+	if s.sseAlgo != "" {
+		input.ServerSideEncryption = aws.String(s.sseAlgo)
+		if s.sseAlgo == awskms.SseKMS {
+			input.SSEKMSKeyId = aws.String(s.sseKeyID)
+		}
+	}
+
+	_, err := s.uploader.UploadWithContext(ctx, &input)
+	return errors.Wrapf(err, "error uploading '%s' to s3 bucket '%s'", s.prefix+name, s.bucket)
+}
+
+func (s *s3Storage) Download(ctx context.Context, name string, w io.Writer) error {
+	output, err := s.client.GetObjectWithContext(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error downloading '%s' from s3 bucket '%s'", s.prefix+name, s.bucket)
+	}
+	defer output.Body.Close()
+
+	_, err = io.Copy(w, output.Body)
+	return errors.Wrapf(err, "error downloading '%s' from s3 bucket '%s'", s.prefix+name, s.bucket)
+}
+
+func (s *s3Storage) List(ctx context.Context) ([]string, error) {
+	var names []string
+
+	err := s.client.ListObjectsV2PagesWithContext(ctx, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *awss3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			names = append(names, strings.TrimPrefix(aws.StringValue(object.Key), s.prefix))
+		}
+		return true
+	})
+
+	return names, errors.Wrapf(err, "error listing s3 bucket '%s'", s.bucket)
+}
+
+func (s *s3Storage) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	return errors.Wrapf(err, "error deleting '%s' from s3 bucket '%s'", s.prefix+name, s.bucket)
+}
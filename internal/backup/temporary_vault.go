@@ -0,0 +1,169 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// temporaryVaultStartTimeout limits how long the temporary Vault server is waited for to start listening
+const temporaryVaultStartTimeout = time.Minute
+
+const temporaryVaultConfig = `
+storage "raft" {
+  path    = %q
+  node_id = "restore-drill"
+}
+
+listener "tcp" {
+  address         = "127.0.0.1:%d"
+  cluster_address = "127.0.0.1:%d"
+  tls_disable     = true
+}
+
+api_addr      = "http://127.0.0.1:%d"
+cluster_addr  = "http://127.0.0.1:%d"
+disable_mlock = true
+`
+
+// TemporaryVault is an isolated single node Vault server with its Raft storage in a temporary
+// directory, listening only on the loopback interface, to restore snapshots into
+type TemporaryVault struct {
+	// Address is the API address of the server
+	Address string
+
+	dir  string
+	cmd  *exec.Cmd
+	log  io.WriteCloser
+	done chan error
+}
+
+// freePort returns a TCP port which is free on the loopback interface
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errors.Wrap(err, "error finding a free port")
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// StartTemporaryVault starts a Vault server with the binary and waits until it is listening.
+// The extra config is appended to the generated config, e.g. the seal stanza of the cluster the
+// snapshots are taken from, so that the restored data is auto-unsealed the same way.
+func StartTemporaryVault(binary, extraConfig string) (*TemporaryVault, error) {
+	apiPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	clusterPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "bank-vaults-drill")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating temporary directory")
+	}
+
+	raftDir := filepath.Join(dir, "raft")
+	if err := os.Mkdir(raftDir, 0700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "error creating raft directory")
+	}
+
+	config := fmt.Sprintf(temporaryVaultConfig, raftDir, apiPort, clusterPort, apiPort, clusterPort) + extraConfig
+	configFile := filepath.Join(dir, "config.hcl")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "error writing temporary vault config")
+	}
+
+	t := TemporaryVault{
+		Address: fmt.Sprintf("http://127.0.0.1:%d", apiPort),
+		dir:     dir,
+		cmd:     exec.Command(binary, "server", "-config", configFile), // nolint:gosec
+		log:     logrus.WithField("vault", "temporary").WriterLevel(logrus.DebugLevel),
+		done:    make(chan error, 1),
+	}
+	t.cmd.Stdout = t.log
+	t.cmd.Stderr = t.log
+
+	if err := t.cmd.Start(); err != nil {
+		_ = t.log.Close()
+		_ = os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "error starting temporary vault")
+	}
+
+	go func() { t.done <- t.cmd.Wait() }()
+
+	client := http.Client{Timeout: 5 * time.Second}
+	for deadline := time.Now().Add(temporaryVaultStartTimeout); ; time.Sleep(time.Second) {
+		select {
+		case err := <-t.done:
+			t.done <- err
+			_ = t.Stop()
+			return nil, errors.Errorf("temporary vault exited: %v", err)
+		default:
+		}
+
+		// any response means it's listening, an uninitialized Vault responds with 501
+		resp, err := client.Get(t.Address + "/v1/sys/health")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			_ = t.Stop()
+			return nil, errors.Wrap(err, "temporary vault didn't start listening in time")
+		}
+	}
+
+	logrus.Infof("temporary vault started at %s", t.Address)
+
+	return &t, nil
+}
+
+// Stop stops the server and deletes its storage
+func (t *TemporaryVault) Stop() error {
+	select {
+	case <-t.done:
+	default:
+		_ = t.cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-t.done:
+		case <-time.After(30 * time.Second):
+			_ = t.cmd.Process.Kill()
+			<-t.done
+		}
+	}
+
+	_ = t.log.Close()
+
+	return errors.Wrap(os.RemoveAll(t.dir), "error deleting the storage of the temporary vault")
+}
@@ -0,0 +1,102 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+const snapshotChecksums = "SHA256SUMS"
+
+// requiredSnapshotFiles are the files of the Raft snapshot archives of Vault covered by the checksums
+var requiredSnapshotFiles = []string{"meta.json", "state.bin"}
+
+// VerifySnapshot checks that r is a complete Raft snapshot archive of Vault (a gzipped tarball),
+// and that the checksums of its files match the ones in its SHA256SUMS file
+func VerifySnapshot(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "snapshot is not gzip compressed")
+	}
+	defer gz.Close()
+
+	hashes := map[string]string{}
+	var checksums string
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading snapshot archive")
+		}
+
+		if header.Name == snapshotChecksums {
+			var sb strings.Builder
+			if _, err := io.Copy(&sb, archive); err != nil {
+				return errors.Wrapf(err, "error reading %s of the snapshot", header.Name)
+			}
+			checksums = sb.String()
+			continue
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, archive); err != nil {
+			return errors.Wrapf(err, "error reading %s of the snapshot", header.Name)
+		}
+		hashes[header.Name] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	if checksums == "" {
+		return errors.Errorf("snapshot has no %s file", snapshotChecksums)
+	}
+
+	expected := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		expected[fields[1]] = fields[0]
+	}
+
+	for _, name := range requiredSnapshotFiles {
+		if _, ok := hashes[name]; !ok {
+			return errors.Errorf("snapshot has no %s file", name)
+		}
+		if _, ok := expected[name]; !ok {
+			return errors.Errorf("%s of the snapshot has no checksum", name)
+		}
+	}
+
+	for name, sum := range expected {
+		if hashes[name] != sum {
+			return errors.Errorf("checksum of %s of the snapshot doesn't match", name)
+		}
+	}
+
+	return nil
+}
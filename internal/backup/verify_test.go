@@ -0,0 +1,63 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSnapshot(t *testing.T, files map[string]string, checksums string) []byte {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+
+	for name, content := range files {
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err := archive.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, archive.WriteHeader(&tar.Header{Name: snapshotChecksums, Mode: 0600, Size: int64(len(checksums))}))
+	_, err := archive.Write([]byte(checksums))
+	require.NoError(t, err)
+
+	require.NoError(t, archive.Close())
+	require.NoError(t, gz.Close())
+
+	return buffer.Bytes()
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	files := map[string]string{"meta.json": "{}", "state.bin": "state"}
+	checksums := fmt.Sprintf("%x  meta.json\n%x  state.bin\n", sha256.Sum256([]byte("{}")), sha256.Sum256([]byte("state")))
+
+	assert.NoError(t, VerifySnapshot(bytes.NewReader(testSnapshot(t, files, checksums))))
+
+	files["state.bin"] = "corrupted"
+	assert.EqualError(t, VerifySnapshot(bytes.NewReader(testSnapshot(t, files, checksums))), "checksum of state.bin of the snapshot doesn't match")
+
+	delete(files, "state.bin")
+	assert.EqualError(t, VerifySnapshot(bytes.NewReader(testSnapshot(t, files, checksums))), "snapshot has no state.bin file")
+
+	assert.Error(t, VerifySnapshot(bytes.NewReader([]byte("not a snapshot"))))
+}
@@ -54,14 +54,36 @@ const templateName = "config"
 type Templater struct {
 	leftDelimiter  string
 	rightDelimiter string
+	funcs          template.FuncMap
+}
+
+// Option configures a Templater
+type Option func(*Templater)
+
+// WithFuncs adds template functions to the default ones, for example lookups which need a client
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(t *Templater) {
+		if t.funcs == nil {
+			t.funcs = template.FuncMap{}
+		}
+		for name, fn := range funcs {
+			t.funcs[name] = fn
+		}
+	}
 }
 
 // NewTemplater initializes a new templater object
-func NewTemplater(leftDelimiter, rightDelimiter string) Templater {
-	return Templater{
+func NewTemplater(leftDelimiter, rightDelimiter string, opts ...Option) Templater {
+	t := Templater{
 		leftDelimiter:  leftDelimiter,
 		rightDelimiter: rightDelimiter,
 	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
 }
 
 // EnvTemplate interpolates environment variables in a configuration text
@@ -84,6 +106,7 @@ func (t Templater) Template(templateText string, data interface{}) (*bytes.Buffe
 	configTemplate, err := template.New(templateName).
 		Funcs(sprig.TxtFuncMap()).
 		Funcs(customFuncs()).
+		Funcs(t.funcs).
 		Delims(t.leftDelimiter, t.rightDelimiter).
 		Parse(templateText)
 
@@ -108,6 +131,7 @@ func customFuncs() template.FuncMap {
 func funcMap() map[string]interface{} {
 	return map[string]interface{}{
 		"awskms": awsKmsDecrypt,
+		"awsKms": awsKmsDecrypt,
 		"file":   fileContent,
 		"gcpkms": gcpKmsDecrypt,
 		"blob":   blobRead,
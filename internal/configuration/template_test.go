@@ -0,0 +1,42 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configuration
+
+import (
+	"os"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateWithFuncs(t *testing.T) {
+	require.NoError(t, os.Setenv("ROLE_ARN", "arn:aws:iam::123456789012:role/vault"))
+	defer os.Unsetenv("ROLE_ARN")
+
+	templater := NewTemplater(DefaultLeftDelimiter, DefaultRightDelimiter, WithFuncs(template.FuncMap{
+		"accessor": func(path string) string { return "auth_" + path + "_1234" },
+	}))
+
+	buffer, err := templater.EnvTemplate(`role: ${ env "ROLE_ARN" }
+arn: ${ .Env.ROLE_ARN | upper }
+accessor: ${ accessor "kubernetes" }`)
+	require.NoError(t, err)
+
+	assert.Equal(t, `role: arn:aws:iam::123456789012:role/vault
+arn: ARN:AWS:IAM::123456789012:ROLE/VAULT
+accessor: auth_kubernetes_1234`, buffer.String())
+}
@@ -0,0 +1,127 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convention
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"emperror.dev/errors"
+)
+
+const (
+	// NamespacePlaceholder is replaced with the namespace of the workload
+	NamespacePlaceholder = "{namespace}"
+	// AppPlaceholder is replaced with the name of the application of the workload
+	AppPlaceholder = "{app}"
+)
+
+var placeholder = regexp.MustCompile(`{[^}]*}`)
+
+// Convention derives the Vault secret paths of the workloads from a template like secret/data/{namespace}/{app},
+// the part of the template before the first placeholder following the namespace is the prefix a workload
+// is allowed to reference secrets under.
+type Convention struct {
+	template string
+}
+
+// New validates the template and returns a convention for it. The template has to contain the namespace
+// placeholder before any other placeholder, so that every namespace gets a distinct prefix.
+func New(pathTemplate string) (*Convention, error) {
+	pathTemplate = strings.Trim(pathTemplate, "/")
+
+	placeholders := placeholder.FindAllString(pathTemplate, -1)
+	if len(placeholders) == 0 || placeholders[0] != NamespacePlaceholder {
+		return nil, errors.Errorf("path convention %q has to start its placeholders with %s", pathTemplate, NamespacePlaceholder)
+	}
+
+	for _, p := range placeholders {
+		if p != NamespacePlaceholder && p != AppPlaceholder {
+			return nil, errors.Errorf("unknown placeholder %s in path convention %q", p, pathTemplate)
+		}
+	}
+
+	return &Convention{template: pathTemplate}, nil
+}
+
+// Path returns the conventional secret path of the application in the namespace
+func (c *Convention) Path(namespace, app string) (string, error) {
+	if namespace == "" {
+		return "", errors.New("namespace is required for the conventional secret path") // nolint:goerr113
+	}
+	if app == "" && strings.Contains(c.template, AppPlaceholder) {
+		return "", errors.Errorf("application is required for the conventional secret path in namespace %s", namespace)
+	}
+
+	return strings.NewReplacer(NamespacePlaceholder, namespace, AppPlaceholder, app).Replace(c.template), nil
+}
+
+// Prefix returns the prefix of the secret paths the workloads of the namespace are allowed to reference
+func (c *Convention) Prefix(namespace string) string {
+	prefix, _ := c.prefix(namespace)
+	return prefix
+}
+
+// prefix returns the prefix of the namespace, and whether the template continues with a placeholder after it
+func (c *Convention) prefix(namespace string) (string, bool) {
+	prefix := strings.Replace(c.template, NamespacePlaceholder, namespace, -1)
+	if loc := placeholder.FindStringIndex(prefix); loc != nil {
+		return prefix[:loc[0]], true
+	}
+	return prefix, false
+}
+
+// Contains reports whether the secret path is under the prefix of the namespace. Paths are cleaned
+// before the comparison, so they can't escape the prefix with relative segments.
+func (c *Convention) Contains(namespace, secretPath string) bool {
+	prefix, partial := c.prefix(namespace)
+	secretPath = path.Clean(strings.TrimPrefix(secretPath, "/"))
+
+	// a placeholder in the middle of a path segment continues the last segment of the prefix
+	if partial && !strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(secretPath, prefix)
+	}
+
+	return strings.HasPrefix(secretPath+"/", strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// Resolve returns the secret path a reference of the application in the namespace points to. References
+// which are empty or start with ./ are relative to the conventional path of the application, the others are
+// returned as is.
+func (c *Convention) Resolve(namespace, app, secretPath string) (string, error) {
+	if secretPath != "" && secretPath != "." && !strings.HasPrefix(secretPath, "./") {
+		return secretPath, nil
+	}
+
+	base, err := c.Path(namespace, app)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(base, secretPath), nil
+}
+
+// TemplateFuncs returns the secretPath and secretPrefix template functions of the convention,
+// for using it in policy templates, for example:
+//
+//	path "${ secretPrefix "team" }*" { capabilities = ["read"] }
+func (c *Convention) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"secretPath":   c.Path,
+		"secretPrefix": c.Prefix,
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convention
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	for _, template := range []string{"secret/data/static", "secret/data/{app}/{namespace}", "secret/data/{namespace}/{name}"} {
+		_, err := New(template)
+		assert.Error(t, err, template)
+	}
+}
+
+func TestConvention(t *testing.T) {
+	c, err := New("/secret/data/{namespace}/{app}/")
+	require.NoError(t, err)
+
+	p, err := c.Path("team", "web")
+	require.NoError(t, err)
+	assert.Equal(t, "secret/data/team/web", p)
+
+	_, err = c.Path("team", "")
+	assert.Error(t, err)
+
+	assert.Equal(t, "secret/data/team/", c.Prefix("team"))
+
+	assert.True(t, c.Contains("team", "secret/data/team/web"))
+	assert.True(t, c.Contains("team", "secret/data/team/db/password"))
+	assert.False(t, c.Contains("team", "secret/data/team-b/web"))
+	assert.False(t, c.Contains("team", "secret/data/team/../other/web"))
+	assert.False(t, c.Contains("team", "secret/data/other/web"))
+
+	for reference, expected := range map[string]string{
+		"":                 "secret/data/team/web",
+		"./db":             "secret/data/team/web/db",
+		"secret/data/x/db": "secret/data/x/db",
+	} {
+		resolved, err := c.Resolve("team", "web", reference)
+		require.NoError(t, err)
+		assert.Equal(t, expected, resolved)
+	}
+}
+
+func TestConventionNamespaceOnly(t *testing.T) {
+	c, err := New("secret/data/{namespace}")
+	require.NoError(t, err)
+
+	assert.True(t, c.Contains("team", "secret/data/team"))
+	assert.True(t, c.Contains("team", "secret/data/team/web"))
+	assert.False(t, c.Contains("team", "secret/data/teams"))
+}
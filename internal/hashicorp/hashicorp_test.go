@@ -0,0 +1,153 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashicorp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl"
+)
+
+const testRelease = `{
+  "name": "vault",
+  "namespace": "vault",
+  "version": 2,
+  "config": {
+    "server": {
+      "image": {"tag": "1.5.0"},
+      "ha": {"enabled": true, "replicas": 5, "raft": {"enabled": true}},
+      "extraEnvironmentVars": {"VAULT_LOG_FORMAT": "json"}
+    }
+  },
+  "chart": {
+    "values": {
+      "injector": {"enabled": true},
+      "server": {
+        "image": {"repository": "hashicorp/vault", "tag": "1.4.2"},
+        "dataStorage": {"enabled": true, "size": "10Gi", "mountPath": "/vault/data", "accessMode": "ReadWriteOnce"},
+        "extraContainers": null,
+        "standalone": {"config": "storage \"file\" {\n path = \"/vault/data\"\n}\n"},
+        "ha": {
+          "enabled": false,
+          "replicas": 3,
+          "raft": {
+            "enabled": false,
+            "config": "ui = true\nlistener \"tcp\" {\n tls_disable = 1\n address = \"[::]:8200\"\n}\nstorage \"raft\" {\n path = \"/vault/data\"\n}\nservice_registration \"kubernetes\" {}\n"
+          }
+        }
+      }
+    }
+  }
+}`
+
+func encodeRelease(t *testing.T, release string) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(release)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+}
+
+func TestVaultFromRelease(t *testing.T) {
+	release, err := DecodeRelease(encodeRelease(t, testRelease))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migration, err := VaultFromRelease(release, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := migration.Vault["spec"].(map[string]interface{})
+
+	if spec["size"] != 5 || spec["image"] != "hashicorp/vault:1.5.0" || spec["serviceAccount"] != "vault" {
+		t.Errorf("unexpected spec: %v", spec)
+	}
+
+	storage := spec["config"].(map[string]interface{})["storage"]
+	if !reflect.DeepEqual(storage, map[string]interface{}{"raft": map[string]interface{}{"path": "/vault/data"}}) {
+		t.Errorf("unexpected storage: %v", storage)
+	}
+
+	mounts := spec["volumeMounts"]
+	if !reflect.DeepEqual(mounts, []interface{}{map[string]interface{}{"name": "data", "mountPath": "/vault/data"}}) {
+		t.Errorf("unexpected volume mounts: %v", mounts)
+	}
+
+	envs := spec["vaultEnvsConfig"]
+	if !reflect.DeepEqual(envs, []interface{}{map[string]interface{}{"name": "VAULT_LOG_FORMAT", "value": "json"}}) {
+		t.Errorf("unexpected envs: %v", envs)
+	}
+
+	// manual unsealing and the injector
+	if len(migration.Warnings) != 2 {
+		t.Errorf("unexpected warnings: %v", migration.Warnings)
+	}
+}
+
+func TestMigrateAnnotations(t *testing.T) {
+	if _, ok := MigrateAnnotations(map[string]string{"vault.hashicorp.com/role": "app"}, "app-vault-agent"); ok {
+		t.Fatal("workloads without agent-inject must be skipped")
+	}
+
+	migration, ok := MigrateAnnotations(map[string]string{
+		"vault.hashicorp.com/agent-inject":               "true",
+		"vault.hashicorp.com/role":                       "app",
+		"vault.hashicorp.com/auth-path":                  "kubernetes-prod",
+		"vault.hashicorp.com/agent-pre-populate-only":    "true",
+		"vault.hashicorp.com/agent-inject-secret-db":     "secret/data/db",
+		"vault.hashicorp.com/agent-inject-template-db":   `{{ with secret "secret/data/db" }}{{ .Data.data.password }}{{ end }}`,
+		"vault.hashicorp.com/agent-inject-secret-config": "secret/data/config",
+		"vault.hashicorp.com/agent-inject-file-config":   "config.yaml",
+		"vault.hashicorp.com/agent-run-as-user":          "1000",
+		"app.kubernetes.io/name":                         "app",
+	}, "app-vault-agent")
+	if !ok {
+		t.Fatal("workloads with agent-inject must be migrated")
+	}
+
+	if value := migration.Annotations["vault.security.banzaicloud.io/vault-agent-once"]; value == nil || *value != "true" {
+		t.Errorf("unexpected vault-agent-once annotation: %v", value)
+	}
+	if value, ok := migration.Annotations["vault.hashicorp.com/role"]; !ok || value != nil {
+		t.Error("the agent injector annotations must be removed")
+	}
+	if _, ok := migration.Annotations["app.kubernetes.io/name"]; ok {
+		t.Error("the other annotations must be kept")
+	}
+	if !reflect.DeepEqual(migration.Warnings, []string{"annotation vault.hashicorp.com/agent-run-as-user is not migrated"}) {
+		t.Errorf("unexpected warnings: %v", migration.Warnings)
+	}
+
+	var config map[string]interface{}
+	if err := hcl.Decode(&config, migration.AgentConfig); err != nil {
+		t.Fatalf("invalid agent config: %s\n%s", err, migration.AgentConfig)
+	}
+	for _, expected := range []string{`mount_path = "auth/kubernetes-prod"`, `role = "app"`, `"/vault/secrets/config.yaml"`, `"/vault/secrets/db"`, `.Data.data.password`} {
+		if !strings.Contains(migration.AgentConfig, expected) {
+			t.Errorf("agent config doesn't contain %s:\n%s", expected, migration.AgentConfig)
+		}
+	}
+}
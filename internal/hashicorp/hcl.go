@@ -0,0 +1,61 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashicorp
+
+import (
+	"emperror.dev/errors"
+	"github.com/hashicorp/hcl"
+)
+
+// ParseConfig parses the HCL configuration of Vault to the structure of the config of the Vault custom resource
+func ParseConfig(config string) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	if err := hcl.Decode(&decoded, config); err != nil {
+		return nil, errors.Wrap(err, "error parsing vault configuration")
+	}
+
+	flattened, _ := flattenHCL(decoded).(map[string]interface{})
+	return flattened, nil
+}
+
+// flattenHCL unwraps the single element lists the HCL decoder wraps every block in,
+// the repeated blocks are kept as lists
+func flattenHCL(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		if len(v) == 1 {
+			return flattenHCL(v[0])
+		}
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, flattenHCL(item))
+		}
+		return list
+	case map[string]interface{}:
+		flattened := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			flattened[key] = flattenHCL(item)
+		}
+		return flattened
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, flattenHCL(item))
+		}
+		return list
+	default:
+		return value
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashicorp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	injectorPrefix = "vault.hashicorp.com/"
+	webhookPrefix  = "vault.security.banzaicloud.io/"
+
+	injectSecretPrefix   = "agent-inject-secret-"
+	injectTemplatePrefix = "agent-inject-template-"
+	injectFilePrefix     = "agent-inject-file-"
+	injectCommandPrefix  = "agent-inject-command-"
+)
+
+// injectorAnnotations maps the annotations of the agent injector to the ones of the webhook with the same meaning
+var injectorAnnotations = map[string]string{
+	"service":                 "vault-addr",
+	"tls-skip-verify":         "vault-skip-verify",
+	"tls-secret":              "vault-tls-secret",
+	"agent-pre-populate-only": "vault-agent-once",
+	"agent-limits-cpu":        "vault-agent-cpu",
+	"agent-limits-mem":        "vault-agent-memory",
+}
+
+// the annotations of the agent injector which are part of the generated agent configuration,
+// or which don't need to be migrated
+var handledInjectorAnnotations = map[string]bool{
+	"agent-inject":        true,
+	"agent-inject-status": true,
+	"role":                true,
+	"auth-path":           true,
+}
+
+// agentConfig is the Vault Agent configuration of the webhook, rendering the templates of the agent injector
+const agentConfig = `pid_file = "/tmp/pidfile"
+
+auto_auth {
+  method "kubernetes" {
+    mount_path = "%s"
+    config = {
+      role = "%s"
+    }
+  }
+
+  sink "file" {
+    config = {
+      path = "/vault/.vault-token"
+    }
+  }
+}
+`
+
+// defaultTemplate is the template of the agent injector for the secrets without a template
+const defaultTemplate = `{{ with secret "%s" }}{{ range $k, $v := .Data }}{{ $k }}: {{ $v }}
+{{ end }}{{ end }}`
+
+// AgentMigration is the result of converting the agent injector annotations of a workload
+type AgentMigration struct {
+	// Annotations has the annotations of the webhook for the pod template, the annotations
+	// of the agent injector have nil values, so a JSON merge patch with them removes them
+	Annotations map[string]*string
+	// AgentConfig is the config.hcl of the Vault Agent ConfigMap of the webhook
+	AgentConfig string
+	// Warnings are the annotations which aren't migrated
+	Warnings []string
+}
+
+// MigrateAnnotations converts the agent injector annotations of a pod template to the annotations
+// of the webhook running Vault Agent with the configuration in the named ConfigMap.
+// It returns false if the agent injector is not enabled by the annotations.
+func MigrateAnnotations(annotations map[string]string, configMapName string) (*AgentMigration, bool) {
+	if annotations[injectorPrefix+"agent-inject"] != "true" {
+		return nil, false
+	}
+
+	migration := &AgentMigration{Annotations: map[string]*string{}}
+	set := func(name, value string) {
+		migration.Annotations[webhookPrefix+name] = &value
+	}
+
+	set("vault-agent-configmap", configMapName)
+
+	var secrets []string
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, injectorPrefix) {
+			continue
+		}
+		migration.Annotations[key] = nil
+
+		name := strings.TrimPrefix(key, injectorPrefix)
+		switch {
+		case handledInjectorAnnotations[name]:
+		case injectorAnnotations[name] != "":
+			set(injectorAnnotations[name], value)
+		case strings.HasPrefix(name, injectSecretPrefix):
+			secrets = append(secrets, strings.TrimPrefix(name, injectSecretPrefix))
+		case strings.HasPrefix(name, injectTemplatePrefix), strings.HasPrefix(name, injectFilePrefix), strings.HasPrefix(name, injectCommandPrefix):
+			// part of the template of a secret
+		default:
+			migration.Warnings = append(migration.Warnings, fmt.Sprintf("annotation %s is not migrated", key))
+		}
+	}
+
+	authPath := annotations[injectorPrefix+"auth-path"]
+	if authPath == "" {
+		authPath = "auth/kubernetes"
+	} else if !strings.HasPrefix(authPath, "auth/") {
+		authPath = "auth/" + authPath
+	}
+
+	var config strings.Builder
+	fmt.Fprintf(&config, agentConfig, authPath, annotations[injectorPrefix+"role"])
+
+	sort.Strings(secrets)
+	for _, secret := range secrets {
+		contents := annotations[injectorPrefix+injectTemplatePrefix+secret]
+		if contents == "" {
+			contents = fmt.Sprintf(defaultTemplate, annotations[injectorPrefix+injectSecretPrefix+secret])
+		}
+
+		file := annotations[injectorPrefix+injectFilePrefix+secret]
+		if file == "" {
+			file = secret
+		}
+
+		fmt.Fprintf(&config, "\ntemplate {\n  destination = %q\n  contents = <<EOH\n%s\nEOH\n", "/vault/secrets/"+file, contents)
+		if command := annotations[injectorPrefix+injectCommandPrefix+secret]; command != "" {
+			fmt.Fprintf(&config, "  command = %q\n", command)
+		}
+		config.WriteString("}\n")
+	}
+
+	migration.AgentConfig = config.String()
+
+	sort.Strings(migration.Warnings)
+
+	return migration, true
+}
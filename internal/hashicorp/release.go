@@ -0,0 +1,132 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hashicorp converts the installations of the HashiCorp Vault Helm chart and the annotations of its
+// Agent Injector to a Vault custom resource of the operator and the annotations of the webhook.
+package hashicorp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// Release is the part of a Helm release the migration needs
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	// Config holds the values set for the release
+	Config map[string]interface{} `json:"config"`
+	Chart  struct {
+		// Values holds the default values of the chart
+		Values map[string]interface{} `json:"values"`
+	} `json:"chart"`
+}
+
+// DecodeRelease decodes the release of a Helm 3 release Secret (the release key of its data),
+// which is the base64 encoded, gzipped JSON of the release
+func DecodeRelease(data []byte) (*Release, error) {
+	compressed, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding release")
+	}
+
+	// Helm doesn't compress the releases stored by its older versions
+	raw := compressed
+	if bytes.HasPrefix(compressed, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing release")
+		}
+		defer reader.Close()
+
+		raw, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing release")
+		}
+	}
+
+	var release Release
+	if err := json.Unmarshal(raw, &release); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling release")
+	}
+
+	return &release, nil
+}
+
+// Values returns the values of the release: the values set merged into the default values of the chart
+func (r *Release) Values() Values {
+	return Values(mergeValues(r.Chart.Values, r.Config))
+}
+
+func mergeValues(defaults, values map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range values {
+		if valueMap, ok := value.(map[string]interface{}); ok {
+			if defaultMap, ok := merged[key].(map[string]interface{}); ok {
+				merged[key] = mergeValues(defaultMap, valueMap)
+				continue
+			}
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// Values are the values of a Helm release
+type Values map[string]interface{}
+
+// Get returns the value at the dot separated path, or nil if it is not set
+func (v Values) Get(path string) interface{} {
+	var value interface{} = map[string]interface{}(v)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// String returns the string value at the path, or the default if it is not a non-empty string
+func (v Values) String(path, defaultValue string) string {
+	if s, ok := v.Get(path).(string); ok && s != "" {
+		return s
+	}
+	return defaultValue
+}
+
+// Bool returns the bool value at the path, or false if it is not a bool
+func (v Values) Bool(path string) bool {
+	b, _ := v.Get(path).(bool)
+	return b
+}
+
+// Int returns the numeric value at the path, or the default if it is not a number
+func (v Values) Int(path string, defaultValue int) int {
+	if n, ok := v.Get(path).(float64); ok {
+		return int(n)
+	}
+	return defaultValue
+}
@@ -0,0 +1,250 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashicorp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the placeholders the startup script of the chart replaces in the configuration
+var configPlaceholders = []string{"HOST_IP", "POD_IP", "HOSTNAME", "API_ADDR", "TRANSIT_ADDR", "RAFT_ADDR"}
+
+// Migration is the result of converting a HashiCorp Vault installation
+type Migration struct {
+	// Vault is the Vault custom resource
+	Vault map[string]interface{}
+	// Warnings are the parts of the installation which aren't migrated, or which need manual steps
+	Warnings []string
+}
+
+func (m *Migration) warnf(format string, args ...interface{}) {
+	m.Warnings = append(m.Warnings, fmt.Sprintf(format, args...))
+}
+
+// configOf returns the Vault configuration of the mode the release is deployed in
+func configOf(values Values) string {
+	switch {
+	case values.Bool("server.ha.enabled") && values.Bool("server.ha.raft.enabled"):
+		return values.String("server.ha.raft.config", "")
+	case values.Bool("server.ha.enabled"):
+		return values.String("server.ha.config", "")
+	default:
+		return values.String("server.standalone.config", "")
+	}
+}
+
+// VaultFromRelease converts the release of the HashiCorp Vault chart to a Vault custom resource with the
+// same configuration. The custom resource is named after the release, so the StatefulSet of the operator
+// gets the name of the StatefulSet of the chart, and the data volume claims of the chart are reused.
+// The external configuration is the one given, see ExternalConfig.
+func VaultFromRelease(release *Release, externalConfig map[string]interface{}) (*Migration, error) {
+	values := release.Values()
+	migration := &Migration{}
+
+	rawConfig := configOf(values)
+	if strings.Contains(rawConfig, "{{") {
+		migration.warnf("the vault configuration of the chart is templated, the templates are migrated as is")
+	}
+	for _, placeholder := range configPlaceholders {
+		if strings.Contains(rawConfig, placeholder) {
+			migration.warnf("the vault configuration refers to %s which is replaced by the startup script of the chart only, replace it in the config of the Vault custom resource", placeholder)
+		}
+	}
+
+	config, err := ParseConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1
+	if values.Bool("server.ha.enabled") {
+		size = values.Int("server.ha.replicas", 3)
+	}
+
+	image := values.String("server.image.repository", "hashicorp/vault")
+	if tag := values.String("server.image.tag", ""); tag != "" {
+		image += ":" + tag
+	}
+
+	serviceAccount := values.String("server.serviceAccount.name", release.Name)
+
+	spec := map[string]interface{}{
+		"size":           size,
+		"image":          image,
+		"serviceAccount": serviceAccount,
+		"config":         config,
+		"unsealConfig": map[string]interface{}{
+			"kubernetes": map[string]interface{}{
+				"secretNamespace": release.Namespace,
+			},
+		},
+	}
+
+	if len(externalConfig) > 0 {
+		spec["externalConfig"] = externalConfig
+	}
+
+	if values.Bool("server.dataStorage.enabled") {
+		mountPath := values.String("server.dataStorage.mountPath", "/vault/data")
+		claimSpec := map[string]interface{}{
+			"accessModes": []interface{}{values.String("server.dataStorage.accessMode", "ReadWriteOnce")},
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"storage": values.String("server.dataStorage.size", "10Gi")},
+			},
+		}
+		if storageClass := values.String("server.dataStorage.storageClass", ""); storageClass != "" {
+			claimSpec["storageClassName"] = storageClass
+		}
+
+		spec["volumeClaimTemplates"] = []interface{}{
+			map[string]interface{}{"metadata": map[string]interface{}{"name": "data"}, "spec": claimSpec},
+		}
+		spec["volumeMounts"] = []interface{}{
+			map[string]interface{}{"name": "data", "mountPath": mountPath},
+		}
+	}
+
+	if env, ok := values.Get("server.extraEnvironmentVars").(map[string]interface{}); ok && len(env) > 0 {
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var vaultEnvsConfig []interface{}
+		for _, name := range names {
+			vaultEnvsConfig = append(vaultEnvsConfig, map[string]interface{}{"name": name, "value": fmt.Sprint(env[name])})
+		}
+		spec["vaultEnvsConfig"] = vaultEnvsConfig
+	}
+
+	if resources, ok := values.Get("server.resources").(map[string]interface{}); ok && len(resources) > 0 {
+		spec["resources"] = map[string]interface{}{"vault": resources}
+	}
+
+	for _, unsupported := range []string{"server.extraContainers", "server.extraVolumes", "server.volumes", "server.auditStorage.enabled"} {
+		if isSet(values.Get(unsupported)) {
+			migration.warnf("%s is not migrated", unsupported)
+		}
+	}
+
+	if _, ok := config["seal"]; !ok {
+		migration.warnf("vault is unsealed manually, store the unseal keys as vault-unseal-0, vault-unseal-1, ... and the root token as vault-root in the vault-unseal-keys Secret in the %s namespace before applying the Vault custom resource", release.Namespace)
+	}
+
+	if values.Bool("injector.enabled") {
+		migration.warnf("the agent injector of the chart is enabled, install the vault-secrets-webhook chart and migrate the annotations of the workloads")
+	}
+
+	migration.Vault = map[string]interface{}{
+		"apiVersion": "vault.banzaicloud.com/v1alpha1",
+		"kind":       "Vault",
+		"metadata": map[string]interface{}{
+			"name":      release.Name,
+			"namespace": release.Namespace,
+		},
+		"spec": spec,
+	}
+
+	return migration, nil
+}
+
+// ExternalConfig returns the external configuration of the Vault custom resource listing the
+// auth methods, secrets engines and policies of a running Vault. The roles and the configuration
+// of the auth methods and secrets engines can't be listed generically, they have to be added manually.
+func ExternalConfig(auths, mounts map[string]map[string]interface{}, policies map[string]string) map[string]interface{} {
+	externalConfig := map[string]interface{}{}
+
+	if len(auths) > 0 {
+		var authList []interface{}
+		for _, path := range sortedKeys(auths) {
+			auth := map[string]interface{}{"type": auths[path]["type"], "path": strings.TrimSuffix(path, "/")}
+			if description, _ := auths[path]["description"].(string); description != "" {
+				auth["description"] = description
+			}
+			authList = append(authList, auth)
+		}
+		externalConfig["auth"] = authList
+	}
+
+	if len(mounts) > 0 {
+		var secrets []interface{}
+		for _, path := range sortedKeys(mounts) {
+			mount := mounts[path]
+			switch mount["type"] {
+			case "system", "identity", "cubbyhole", "token":
+				continue
+			}
+			secret := map[string]interface{}{"type": mount["type"], "path": strings.TrimSuffix(path, "/")}
+			if description, _ := mount["description"].(string); description != "" {
+				secret["description"] = description
+			}
+			if options, ok := mount["options"].(map[string]interface{}); ok && len(options) > 0 {
+				secret["options"] = options
+			}
+			secrets = append(secrets, secret)
+		}
+		if len(secrets) > 0 {
+			externalConfig["secrets"] = secrets
+		}
+	}
+
+	var policyList []interface{}
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "root" || name == "default" {
+			continue
+		}
+		policyList = append(policyList, map[string]interface{}{"name": name, "rules": policies[name]})
+	}
+	if len(policyList) > 0 {
+		externalConfig["policies"] = policyList
+	}
+
+	return externalConfig
+}
+
+// isSet returns false for the zero values of the values, including the empty lists and maps
+func isSet(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+func sortedKeys(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,450 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hooks runs user defined automation and notifications after the init, unseal and configure
+// operations of bank-vaults, when a configuration fails to be applied and when configuration drift is detected.
+//
+// The hooks are configured in a YAML/JSON file:
+//
+//	hooks:
+//	  - name: smoke-test
+//	    events: [unseal, configure]
+//	    timeout: 1m
+//	    exec:
+//	      command: ["/scripts/smoke-test.sh"]
+//	  - name: cmdb
+//	    events: [init]
+//	    http:
+//	      url: https://cmdb.example.com/api/events
+//	      headers:
+//	        Authorization: Bearer ${CMDB_TOKEN}
+//	  - name: pagerduty
+//	    events: [configure-failed]
+//	    http:
+//	      url: https://events.pagerduty.com/v2/enqueue
+//	      body: |
+//	        {"routing_key": {{ json (env "PD_ROUTING_KEY") }}, "event_action": "trigger",
+//	         "payload": {"summary": {{ json .Data.error }}, "source": {{ json .VaultAddr }}, "severity": "error"}}
+//	  - name: on-call
+//	    events: [init, unseal, configure-failed]
+//	    slack:
+//	      url: ${SLACK_WEBHOOK_URL}
+//	      text: "Vault {{ .VaultAddr }}: {{ .Event }}{{ with .Data.attempts }} after {{ . }} attempts{{ end }}"
+//	  - name: warm-cache
+//	    events: [unseal]
+//	    plugin:
+//	      path: /plugins/warm-cache.so
+//	      symbol: Hook
+//
+// The bodies of the http hooks and the texts of the slack hooks are Go templates of the Payload,
+// the json function renders a value as JSON and the env function returns an environment variable.
+// The environment variables are expanded in the URLs and the headers.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+	"text/template"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Event is an operation of bank-vaults after which hooks are fired
+type Event string
+
+const (
+	// EventInit is fired after Vault has been initialized
+	EventInit Event = "init"
+	// EventUnseal is fired after Vault has been unsealed
+	EventUnseal Event = "unseal"
+	// EventConfigure is fired after a configuration file has been applied
+	EventConfigure Event = "configure"
+	// EventDrift is fired when the live configuration of Vault has drifted from a configuration file
+	EventDrift Event = "drift"
+	// EventConfigureFailed is fired after a configuration file failed to be applied
+	EventConfigureFailed Event = "configure-failed"
+)
+
+// DefaultSlackText is the text of the slack hooks if it is not set
+const DefaultSlackText = "Vault {{ .VaultAddr }}: {{ .Event }}{{ range $key, $value := .Data }}, {{ $key }}: {{ $value }}{{ end }}"
+
+// DefaultTimeout is the timeout of a hook if it is not set
+const DefaultTimeout = 30 * time.Second
+
+// DefaultPluginSymbol is the function looked up in Go plugins if the symbol is not set
+const DefaultPluginSymbol = "Hook"
+
+// PluginFunc is the signature of the function exported by Go plugins hooks,
+// data holds the same values as the environment variables of exec hooks
+type PluginFunc = func(ctx context.Context, event string, data map[string]string) error
+
+// ExecConfig configures a hook running a command
+type ExecConfig struct {
+	Command []string `mapstructure:"command"`
+}
+
+// HTTPConfig configures a hook sending the event in an HTTP request, as the JSON of the Payload
+// or as the Body template rendered with it
+type HTTPConfig struct {
+	URL     string            `mapstructure:"url"`
+	Method  string            `mapstructure:"method"`
+	Headers map[string]string `mapstructure:"headers"`
+	Body    string            `mapstructure:"body"`
+}
+
+// SlackConfig configures a hook posting the Text template rendered with the Payload to a Slack incoming webhook
+type SlackConfig struct {
+	URL  string `mapstructure:"url"`
+	Text string `mapstructure:"text"`
+}
+
+// PluginConfig configures a hook calling a function of a Go plugin
+type PluginConfig struct {
+	Path   string `mapstructure:"path"`
+	Symbol string `mapstructure:"symbol"`
+}
+
+// Config configures a hook, exactly one of Exec, HTTP, Slack and Plugin has to be set
+type Config struct {
+	Name    string        `mapstructure:"name"`
+	Events  []Event       `mapstructure:"events"`
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	Exec   *ExecConfig   `mapstructure:"exec"`
+	HTTP   *HTTPConfig   `mapstructure:"http"`
+	Slack  *SlackConfig  `mapstructure:"slack"`
+	Plugin *PluginConfig `mapstructure:"plugin"`
+}
+
+// Payload is the information about the event passed to the hooks
+type Payload struct {
+	Event     Event             `json:"event"`
+	VaultAddr string            `json:"vaultAddr"`
+	Time      time.Time         `json:"time"`
+	Data      map[string]string `json:"data,omitempty"`
+}
+
+// env returns the payload as environment variables for exec hooks
+func (p Payload) env() []string {
+	env := []string{
+		"BANK_VAULTS_HOOK_EVENT=" + string(p.Event),
+		"BANK_VAULTS_HOOK_VAULT_ADDR=" + p.VaultAddr,
+		"BANK_VAULTS_HOOK_TIME=" + p.Time.Format(time.RFC3339),
+	}
+	for key, value := range p.Data {
+		env = append(env, "BANK_VAULTS_HOOK_"+strings.ToUpper(key)+"="+value)
+	}
+	return env
+}
+
+type runFunc func(ctx context.Context, payload Payload) error
+
+type hook struct {
+	name    string
+	events  map[Event]bool
+	timeout time.Duration
+	run     runFunc
+}
+
+// Hooks fires the configured hooks of the events
+type Hooks struct {
+	hooks []hook
+}
+
+// Load reads the hooks from the "hooks" list of a YAML/JSON file, an empty path means no hooks
+func Load(path string) (*Hooks, error) {
+	if path == "" {
+		return &Hooks{}, nil
+	}
+
+	config := viper.New()
+	config.SetConfigFile(path)
+	if err := config.ReadInConfig(); err != nil {
+		return nil, errors.Wrap(err, "error reading hooks file")
+	}
+
+	var configs []Config
+	if err := config.UnmarshalKey("hooks", &configs); err != nil {
+		return nil, errors.Wrap(err, "error parsing hooks file")
+	}
+
+	return New(configs)
+}
+
+// New creates the hooks from their configuration
+func New(configs []Config) (*Hooks, error) {
+	var hooks Hooks
+
+	for i, config := range configs {
+		name := config.Name
+		if name == "" {
+			name = fmt.Sprint("hook-", i)
+		}
+
+		if len(config.Events) == 0 {
+			return nil, errors.Errorf("hook %s has no events", name)
+		}
+
+		h := hook{name: name, events: map[Event]bool{}, timeout: config.Timeout}
+		if h.timeout == 0 {
+			h.timeout = DefaultTimeout
+		}
+
+		for _, event := range config.Events {
+			switch event {
+			case EventInit, EventUnseal, EventConfigure, EventDrift, EventConfigureFailed:
+				h.events[event] = true
+			default:
+				return nil, errors.Errorf("hook %s has an unknown event: %s", name, event)
+			}
+		}
+
+		var kinds int
+		var err error
+		if config.Exec != nil {
+			kinds++
+			h.run, err = newExecHook(config.Exec)
+		}
+		if config.HTTP != nil {
+			kinds++
+			h.run, err = newHTTPHook(config.HTTP)
+		}
+		if config.Slack != nil {
+			kinds++
+			h.run, err = newSlackHook(config.Slack)
+		}
+		if config.Plugin != nil {
+			kinds++
+			h.run, err = newPluginHook(config.Plugin)
+		}
+		if kinds != 1 {
+			return nil, errors.Errorf("hook %s has to have exactly one of exec, http, slack or plugin", name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating hook %s", name)
+		}
+
+		hooks.hooks = append(hooks.hooks, h)
+	}
+
+	return &hooks, nil
+}
+
+// Fire runs the hooks of the event one after the other in the order of their configuration.
+// Failing hooks are logged and don't stop the other hooks, the errors of the hooks are returned.
+func (h *Hooks) Fire(event Event, vaultAddr string, data map[string]string) error {
+	payload := Payload{Event: event, VaultAddr: vaultAddr, Time: time.Now().UTC(), Data: data}
+
+	var errs []error
+	for _, hook := range h.hooks {
+		if !hook.events[event] {
+			continue
+		}
+
+		log := logrus.WithFields(logrus.Fields{"hook": hook.name, "event": event})
+		log.Debug("running hook")
+
+		ctx, cancel := context.WithTimeout(context.Background(), hook.timeout)
+		err := hook.run(ctx, payload)
+		cancel()
+
+		if err != nil {
+			log.Errorf("hook failed: %s", err.Error())
+			errs = append(errs, errors.Wrapf(err, "hook %s failed", hook.name))
+			continue
+		}
+
+		log.Info("hook succeeded")
+	}
+
+	return errors.Combine(errs...)
+}
+
+func newExecHook(config *ExecConfig) (runFunc, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("exec hook needs a command") // nolint:goerr113
+	}
+
+	return func(ctx context.Context, payload Payload) error {
+		cmd := exec.CommandContext(ctx, config.Command[0], config.Command[1:]...) // nolint:gosec
+		cmd.Env = append(os.Environ(), payload.env()...)
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.WrapWithDetails(err, "command failed", "output", string(output))
+		}
+
+		logrus.Debugf("hook output: %s", output)
+
+		return nil
+	}, nil
+}
+
+// templateFuncs are the functions of the body and text templates
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		content, err := json.Marshal(value)
+		return string(content), err
+	},
+	"env": os.Getenv,
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	return tmpl, errors.Wrapf(err, "error parsing %s template", name)
+}
+
+func renderTemplate(tmpl *template.Template, payload Payload) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return nil, errors.Wrapf(err, "error rendering %s template", tmpl.Name())
+	}
+	return buf.Bytes(), nil
+}
+
+func newHTTPHook(config *HTTPConfig) (runFunc, error) {
+	if config.URL == "" {
+		return nil, errors.New("http hook needs an url") // nolint:goerr113
+	}
+
+	method := config.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body *template.Template
+	if config.Body != "" {
+		var err error
+		body, err = parseTemplate("body", config.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context, payload Payload) error {
+		var content []byte
+		var err error
+		if body != nil {
+			content, err = renderTemplate(body, payload)
+		} else {
+			content, err = json.Marshal(payload)
+			err = errors.Wrap(err, "error marshaling payload")
+		}
+		if err != nil {
+			return err
+		}
+
+		return send(ctx, method, os.ExpandEnv(config.URL), config.Headers, content)
+	}, nil
+}
+
+func newSlackHook(config *SlackConfig) (runFunc, error) {
+	if config.URL == "" {
+		return nil, errors.New("slack hook needs an url") // nolint:goerr113
+	}
+
+	text := config.Text
+	if text == "" {
+		text = DefaultSlackText
+	}
+
+	tmpl, err := parseTemplate("text", text)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, payload Payload) error {
+		text, err := renderTemplate(tmpl, payload)
+		if err != nil {
+			return err
+		}
+
+		content, err := json.Marshal(map[string]string{"text": string(text)})
+		if err != nil {
+			return errors.Wrap(err, "error marshaling slack message")
+		}
+
+		return send(ctx, http.MethodPost, os.ExpandEnv(config.URL), nil, content)
+	}, nil
+}
+
+// send sends the JSON content in an HTTP request, the environment variables are expanded in the headers
+func send(ctx context.Context, method, url string, headers map[string]string, content []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func newPluginHook(config *PluginConfig) (runFunc, error) {
+	p, err := plugin.Open(config.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening plugin")
+	}
+
+	symbol := config.Symbol
+	if symbol == "" {
+		symbol = DefaultPluginSymbol
+	}
+
+	s, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking up plugin symbol")
+	}
+
+	fn, ok := s.(PluginFunc)
+	if !ok {
+		// exported function variables are looked up as pointers
+		fnPtr, ok := s.(*PluginFunc)
+		if !ok {
+			return nil, errors.Errorf("plugin symbol %s is not a %T", symbol, fn)
+		}
+		fn = *fnPtr
+	}
+
+	return func(ctx context.Context, payload Payload) error {
+		data := map[string]string{"vault_addr": payload.VaultAddr, "time": payload.Time.Format(time.RFC3339)}
+		for key, value := range payload.Data {
+			data[key] = value
+		}
+		return fn(ctx, string(payload.Event), data)
+	}, nil
+}
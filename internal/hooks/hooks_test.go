@@ -0,0 +1,137 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	var payloads []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "output")
+
+	hooksFile := filepath.Join(dir, "hooks.yaml")
+	require.NoError(t, ioutil.WriteFile(hooksFile, []byte(fmt.Sprintf(`
+hooks:
+  - name: notify
+    events: [unseal, configure]
+    http:
+      url: %s
+      headers:
+        Authorization: Bearer secret
+  - name: smoke-test
+    events: [configure]
+    timeout: 5s
+    exec:
+      command: ["sh", "-c", "echo $BANK_VAULTS_HOOK_EVENT $BANK_VAULTS_HOOK_CONFIG_FILE > %s"]
+  - name: failing
+    events: [configure]
+    exec:
+      command: ["false"]
+`, server.URL, output)), 0600))
+
+	h, err := Load(hooksFile)
+	require.NoError(t, err)
+
+	assert.NoError(t, h.Fire(EventInit, "https://vault:8200", nil))
+	assert.Empty(t, payloads)
+
+	assert.NoError(t, h.Fire(EventUnseal, "https://vault:8200", nil))
+
+	err = h.Fire(EventConfigure, "https://vault:8200", map[string]string{"config_file": "vault-config.yml"})
+	assert.EqualError(t, err, "hook failing failed: command failed: exit status 1")
+
+	require.Len(t, payloads, 2)
+	assert.Equal(t, EventUnseal, payloads[0].Event)
+	assert.Equal(t, "https://vault:8200", payloads[0].VaultAddr)
+	assert.Equal(t, EventConfigure, payloads[1].Event)
+	assert.Equal(t, map[string]string{"config_file": "vault-config.yml"}, payloads[1].Data)
+
+	executed, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "configure vault-config.yml\n", string(executed))
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New([]Config{{Name: "none", Events: []Event{EventInit}}})
+	assert.EqualError(t, err, "hook none has to have exactly one of exec, http, slack or plugin")
+
+	_, err = New([]Config{{Name: "unknown", Events: []Event{"rekey"}, Exec: &ExecConfig{Command: []string{"true"}}}})
+	assert.EqualError(t, err, "hook unknown has an unknown event: rekey")
+}
+
+func TestTemplates(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, r.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+
+	os.Setenv("HOOKS_TEST_KEY", "routing-key")
+	defer os.Unsetenv("HOOKS_TEST_KEY")
+
+	h, err := New([]Config{
+		{
+			Name:   "alert",
+			Events: []Event{EventConfigureFailed},
+			HTTP: &HTTPConfig{
+				URL:  server.URL + "/alert",
+				Body: `{"key": {{ json (env "HOOKS_TEST_KEY") }}, "summary": {{ json .Data.error }}}`,
+			},
+		},
+		{
+			Name:   "slack",
+			Events: []Event{EventUnseal, EventConfigureFailed},
+			Slack:  &SlackConfig{URL: server.URL + "/slack"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, h.Fire(EventUnseal, "https://vault:8200", map[string]string{"attempts": "3"}))
+	assert.NoError(t, h.Fire(EventConfigureFailed, "https://vault:8200", map[string]string{"error": `policy "a" is invalid`}))
+
+	assert.Equal(t, []string{
+		`/slack {"text":"Vault https://vault:8200: unseal, attempts: 3"}`,
+		`/alert {"key": "routing-key", "summary": "policy \"a\" is invalid"}`,
+		`/slack {"text":"Vault https://vault:8200: configure-failed, error: policy \"a\" is invalid"}`,
+	}, bodies)
+
+	_, err = New([]Config{{Name: "invalid", Events: []Event{EventInit}, Slack: &SlackConfig{URL: server.URL, Text: "{{ .Event "}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/bank-vaults/internal/configuration"
+)
+
+// FileTemplate is a file rendered from a template, the template can read secrets with the vault function
+// and the same references as the environment variables, for example:
+//
+//	password: ${ vault "vault:secret/data/app#password" }
+type FileTemplate struct {
+	Path     string `json:"path"`
+	Template string `json:"template"`
+}
+
+// fileTemplatePath returns the path of the file under dir, the file can't be outside of dir
+func fileTemplatePath(dir, path string) (string, error) {
+	cleanPath := filepath.Clean(path)
+	if path == "" || filepath.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("file path has to be relative and inside of the secrets directory: %s", path)
+	}
+
+	return filepath.Join(dir, cleanPath), nil
+}
+
+// RenderFiles renders the file templates into dir, the files are written only after all of them have been rendered.
+// They contain secrets, so only the user of the process can read them, or its group as well if groupReadable is set,
+// for example when the files are read by other containers of a Pod, which share its fsGroup.
+func (i SecretInjector) RenderFiles(dir string, files []FileTemplate, groupReadable bool) error {
+	resolved := map[string]string{}
+
+	vaultFunc := func(reference string) (string, error) {
+		if value, ok := resolved[reference]; ok {
+			return value, nil
+		}
+
+		if !strings.HasPrefix(strings.TrimPrefix(reference, ">>"), "vault:") {
+			return "", errors.Errorf("not a vault reference: %s", reference)
+		}
+
+		var value string
+		err := i.InjectSecretsFromVault(map[string]string{reference: reference}, func(_, v string) {
+			value = v
+		})
+		if err != nil {
+			return "", err
+		}
+
+		resolved[reference] = value
+		return value, nil
+	}
+
+	templater := configuration.NewTemplater(
+		configuration.DefaultLeftDelimiter,
+		configuration.DefaultRightDelimiter,
+		configuration.WithFuncs(template.FuncMap{"vault": vaultFunc}),
+	)
+
+	rendered := make(map[string][]byte, len(files))
+	paths := make([]string, 0, len(files))
+
+	for _, file := range files {
+		path, err := fileTemplatePath(dir, file.Path)
+		if err != nil {
+			return err
+		}
+
+		buffer, err := templater.Template(file.Template, nil)
+		if err != nil {
+			return errors.WrapIff(err, "failed to render file: %s", file.Path)
+		}
+
+		if _, ok := rendered[path]; !ok {
+			paths = append(paths, path)
+		}
+		rendered[path] = buffer.Bytes()
+	}
+
+	dirMode, fileMode := os.FileMode(0700), os.FileMode(0600)
+	if groupReadable {
+		dirMode, fileMode = 0750, 0640
+	}
+
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+			return errors.Wrapf(err, "failed to create directory of file: %s", path)
+		}
+
+		if err := ioutil.WriteFile(path, rendered[path], fileMode); err != nil {
+			return errors.Wrapf(err, "failed to write file: %s", path)
+		}
+
+		i.logger.Infoln("rendered file:", path)
+	}
+
+	return nil
+}
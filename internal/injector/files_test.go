@@ -0,0 +1,71 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-files")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	injector := NewSecretInjector(Config{}, nil, nil, logrus.New())
+
+	err = injector.RenderFiles(dir, []FileTemplate{
+		{Path: "app/config.yaml", Template: `name: ${ "app" | upper }`},
+	}, false)
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "app", "config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name: APP", string(content))
+
+	info, err := os.Stat(filepath.Join(dir, "app", "config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "only the user should read the secret files")
+
+	info, err = os.Stat(filepath.Join(dir, "app"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), "only the user should list the secret directories")
+
+	err = injector.RenderFiles(dir, []FileTemplate{{Path: "shared/config.yaml", Template: "shared"}}, true)
+	assert.NoError(t, err)
+
+	info, err = os.Stat(filepath.Join(dir, "shared", "config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm(), "the group should read the group readable secret files")
+
+	for _, path := range []string{"", "/etc/passwd", "../config.yaml", "app/../../config.yaml"} {
+		err = injector.RenderFiles(dir, []FileTemplate{{Path: path, Template: "secret"}}, false)
+		assert.Error(t, err, path)
+	}
+
+	err = injector.RenderFiles(dir, []FileTemplate{
+		{Path: "first.txt", Template: "first"},
+		{Path: "second.txt", Template: `${ vault "secret/data/app#password" }`},
+	}, false)
+	assert.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "first.txt"))
+	assert.True(t, os.IsNotExist(err), "no file should be written if a template fails")
+}
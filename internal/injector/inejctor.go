@@ -30,6 +30,21 @@ import (
 
 type SecretInjectorFunc func(key, value string)
 
+// notFoundError marks the errors caused by a missing secret path or key
+type notFoundError struct {
+	error
+}
+
+func (notFoundError) NotFound() bool {
+	return true
+}
+
+// IsNotFoundError returns true if the error was caused by a missing secret path or key
+func IsNotFoundError(err error) bool {
+	var notFound interface{ NotFound() bool }
+	return errors.As(err, &notFound) && notFound.NotFound()
+}
+
 type SecretRenewer interface {
 	Renew(path string, secret *vaultapi.Secret) error
 }
@@ -39,6 +54,8 @@ type Config struct {
 	TransitPath          string
 	IgnoreMissingSecrets bool
 	DaemonMode           bool
+	// Transforms are applied to the values resolved from Vault before they are injected
+	Transforms Transforms
 }
 
 type SecretInjector struct {
@@ -58,6 +75,15 @@ func (i SecretInjector) InjectSecretsFromVault(references map[string]string, inj
 
 	templater := configuration.NewTemplater(configuration.DefaultLeftDelimiter, configuration.DefaultRightDelimiter)
 
+	injectResolved := func(name, value string) error {
+		value, err := i.config.Transforms.Apply(name, value)
+		if err != nil {
+			return err
+		}
+		inject(name, value)
+		return nil
+	}
+
 	for name, value := range references {
 		var update bool
 		if strings.HasPrefix(value, ">>vault:") {
@@ -89,7 +115,9 @@ func (i SecretInjector) InjectSecretsFromVault(references map[string]string, inj
 			}
 
 			if v, ok := transitCache[value]; ok {
-				inject(name, string(v))
+				if err := injectResolved(name, string(v)); err != nil {
+					return err
+				}
 				continue
 			}
 
@@ -103,7 +131,9 @@ func (i SecretInjector) InjectSecretsFromVault(references map[string]string, inj
 			}
 
 			transitCache[value] = out
-			inject(name, string(out))
+			if err := injectResolved(name, string(out)); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -160,7 +190,7 @@ func (i SecretInjector) InjectSecretsFromVault(references map[string]string, inj
 
 		if secret == nil {
 			if !i.config.IgnoreMissingSecrets {
-				return errors.Errorf("path not found: %s", valuePath)
+				return notFoundError{errors.Errorf("path not found: %s", valuePath)}
 			}
 
 			i.logger.Errorln("path not found:", valuePath)
@@ -199,16 +229,20 @@ func (i SecretInjector) InjectSecretsFromVault(references map[string]string, inj
 			if err != nil {
 				return errors.Wrapf(err, "failed to interpolate template key with vault data: %s", key)
 			}
-			inject(name, value.String())
+			if err := injectResolved(name, value.String()); err != nil {
+				return err
+			}
 		} else {
 			if value, ok := data[key]; ok {
 				value, err := cast.ToStringE(value)
 				if err != nil {
 					return errors.Wrap(err, "value can't be cast to a string")
 				}
-				inject(name, value)
+				if err := injectResolved(name, value); err != nil {
+					return err
+				}
 			} else {
-				return errors.Errorf("key '%s' not found under path: %s", key, valuePath)
+				return notFoundError{errors.Errorf("key '%s' not found under path: %s", key, valuePath)}
 			}
 		}
 	}
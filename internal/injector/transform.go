@@ -0,0 +1,192 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"plugin"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// DefaultTransformPluginSymbol is the symbol looked up in the transform plugins
+const DefaultTransformPluginSymbol = "Transform"
+
+// TransformPluginFunc is the signature of the function exported by a transform plugin
+type TransformPluginFunc func(name, value string) (string, error)
+
+// ValueTransformer post-processes a value resolved from Vault before it gets injected
+type ValueTransformer interface {
+	Transform(name, value string) (string, error)
+}
+
+// ValueTransformerFunc adapts a function to a ValueTransformer
+type ValueTransformerFunc func(name, value string) (string, error)
+
+func (fn ValueTransformerFunc) Transform(name, value string) (string, error) {
+	return fn(name, value)
+}
+
+// Transforms are the value transformers applied in order to the value of the named variables
+type Transforms map[string][]ValueTransformer
+
+// Apply runs the transformers of the variable on the value, it returns the value as is if it has none
+func (t Transforms) Apply(name, value string) (string, error) {
+	for _, transformer := range t[name] {
+		var err error
+		value, err = transformer.Transform(name, value)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to transform variable: %s", name)
+		}
+	}
+
+	return value, nil
+}
+
+// ParseTransforms parses the transforms of the variables in the "NAME=transform1,transform2:arg;NAME2=transform3" format.
+// The built-in transforms are:
+//   - base64: encodes the value with standard base64
+//   - base64decode: decodes the standard base64 encoded value
+//   - trim: removes the leading and trailing whitespace
+//   - json: quotes the value as a JSON string
+//   - jaas:<LoginModule>: turns a JSON object into a JAAS configuration entry of the login module
+//   - plugin:<path>: calls the Transform function of the Go plugin
+func ParseTransforms(spec string) (Transforms, error) {
+	transforms := Transforms{}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		split := strings.SplitN(entry, "=", 2)
+		name := strings.TrimSpace(split[0])
+		if len(split) != 2 || name == "" {
+			return nil, errors.Errorf("invalid transform, expected NAME=transform: %s", entry)
+		}
+
+		for _, definition := range strings.Split(split[1], ",") {
+			transformer, err := newValueTransformer(strings.TrimSpace(definition))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid transform of variable: %s", name)
+			}
+			transforms[name] = append(transforms[name], transformer)
+		}
+	}
+
+	return transforms, nil
+}
+
+func newValueTransformer(definition string) (ValueTransformer, error) {
+	split := strings.SplitN(definition, ":", 2)
+	kind := split[0]
+	var arg string
+	if len(split) == 2 {
+		arg = split[1]
+	}
+
+	switch kind {
+	case "base64":
+		return ValueTransformerFunc(func(_, value string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(value)), nil
+		}), nil
+	case "base64decode":
+		return ValueTransformerFunc(func(_, value string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", errors.Wrap(err, "failed to decode base64 value")
+			}
+			return string(decoded), nil
+		}), nil
+	case "trim":
+		return ValueTransformerFunc(func(_, value string) (string, error) {
+			return strings.TrimSpace(value), nil
+		}), nil
+	case "json":
+		return ValueTransformerFunc(func(_, value string) (string, error) {
+			quoted, err := json.Marshal(value)
+			return string(quoted), err
+		}), nil
+	case "jaas":
+		if arg == "" {
+			return nil, errors.New("jaas transform requires a login module, e.g. jaas:org.apache.kafka.common.security.plain.PlainLoginModule") // nolint:goerr113
+		}
+		return jaasTransformer(arg), nil
+	case "plugin":
+		if arg == "" {
+			return nil, errors.New("plugin transform requires the path of the plugin") // nolint:goerr113
+		}
+		return newPluginTransformer(arg)
+	default:
+		return nil, errors.Errorf("unknown transform: %s", definition)
+	}
+}
+
+// jaasTransformer turns a JSON object of options into a JAAS configuration entry, for example
+// {"username":"alice","password":"secret"} becomes: <LoginModule> required password="secret" username="alice";
+func jaasTransformer(loginModule string) ValueTransformer {
+	return ValueTransformerFunc(func(_, value string) (string, error) {
+		var options map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &options); err != nil {
+			return "", errors.Wrap(err, "jaas transform requires a JSON object value")
+		}
+
+		keys := make([]string, 0, len(options))
+		for key := range options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var b strings.Builder
+		b.WriteString(loginModule)
+		b.WriteString(" required")
+		for _, key := range keys {
+			option := fmt.Sprint(options[key])
+			option = strings.ReplaceAll(option, "\\", "\\\\")
+			option = strings.ReplaceAll(option, "\"", "\\\"")
+			fmt.Fprintf(&b, " %s=\"%s\"", key, option)
+		}
+		b.WriteString(";")
+
+		return b.String(), nil
+	})
+}
+
+func newPluginTransformer(path string) (ValueTransformer, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening plugin")
+	}
+
+	s, err := p.Lookup(DefaultTransformPluginSymbol)
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking up plugin symbol")
+	}
+
+	switch fn := s.(type) {
+	case func(name, value string) (string, error):
+		return ValueTransformerFunc(fn), nil
+	case *func(name, value string) (string, error):
+		// exported function variables are looked up as pointers
+		return ValueTransformerFunc(*fn), nil
+	default:
+		return nil, errors.Errorf("plugin symbol %s is not a %T", DefaultTransformPluginSymbol, TransformPluginFunc(nil))
+	}
+}
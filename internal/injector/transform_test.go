@@ -0,0 +1,51 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransforms(t *testing.T) {
+	transforms, err := ParseTransforms("CERT=trim,base64; KAFKA_JAAS=jaas:org.apache.kafka.common.security.plain.PlainLoginModule;TOKEN=json")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "CERT", value: " certificate\n", expected: "Y2VydGlmaWNhdGU="},
+		{name: "KAFKA_JAAS", value: `{"username":"alice","password":"se\"cret"}`, expected: `org.apache.kafka.common.security.plain.PlainLoginModule required password="se\"cret" username="alice";`},
+		{name: "TOKEN", value: "to\"ken", expected: `"to\"ken"`},
+		{name: "OTHER", value: "unchanged", expected: "unchanged"},
+	}
+
+	for _, test := range tests {
+		value, err := transforms.Apply(test.name, test.value)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, value, test.name)
+	}
+
+	_, err = transforms.Apply("KAFKA_JAAS", "not json")
+	assert.Error(t, err)
+
+	for _, spec := range []string{"CERT", "CERT=unknown", "KAFKA_JAAS=jaas", "=base64"} {
+		_, err := ParseTransforms(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging configures the logrus loggers of the bank-vaults CLI: the format, the level,
+// and the redaction of key material which could end up in the (debug) output.
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FormatConsole is the human readable text format of logrus
+	FormatConsole = "console"
+	// FormatJSON is one JSON object per line, for log pipelines
+	FormatJSON = "json"
+)
+
+const redacted = "<redacted>"
+
+// sensitiveFields are the field names which always hold key material or credentials,
+// the "key" field holds the ID of a key in the key store, so it is not one of them
+var sensitiveFields = map[string]bool{
+	"token":         true,
+	"root_token":    true,
+	"unseal_key":    true,
+	"recovery_key":  true,
+	"keys":          true,
+	"keys_base64":   true,
+	"otp":           true,
+	"encoded_token": true,
+	"password":      true,
+	"secret_id":     true,
+}
+
+// keyMaterial matches Vault tokens (service, batch and recovery tokens, with the legacy one letter prefixes),
+// and the hex and base64 encoded unseal and recovery keys
+var keyMaterial = regexp.MustCompile(`\b(?:hv[sbr]|[sbr])\.[A-Za-z0-9_-]{20,}|\b[0-9a-f]{64,}\b|\b[A-Za-z0-9+/]{43}=`)
+
+// Redact replaces the key material in s
+func Redact(s string) string {
+	return keyMaterial.ReplaceAllString(s, redacted)
+}
+
+// redactingFormatter redacts the message and the fields of the entries before formatting them
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+func (f redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redactedEntry := *entry
+	redactedEntry.Message = Redact(entry.Message)
+	redactedEntry.Data = make(logrus.Fields, len(entry.Data))
+	for name, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			if sensitiveFields[strings.ToLower(name)] {
+				value = redacted
+			} else {
+				value = Redact(v)
+			}
+		case error:
+			if name == logrus.ErrorKey {
+				value = Redact(v.Error())
+			}
+		default:
+			if sensitiveFields[strings.ToLower(name)] {
+				value = redacted
+			}
+		}
+		redactedEntry.Data[name] = value
+	}
+	return f.Formatter.Format(&redactedEntry)
+}
+
+// Configure sets the format (console or json) and the level of the logger, its output is redacted
+func Configure(logger *logrus.Logger, format, level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return errors.Wrap(err, "invalid log level")
+	}
+
+	var formatter logrus.Formatter
+	switch format {
+	case FormatConsole, "":
+		formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return errors.Errorf("invalid log format %q, it should be %s or %s", format, FormatConsole, FormatJSON)
+	}
+
+	logger.SetLevel(lvl)
+	logger.SetFormatter(redactingFormatter{formatter})
+
+	return nil
+}
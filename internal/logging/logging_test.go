@@ -0,0 +1,66 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigure(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+
+	if err := Configure(logger, FormatJSON, "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"key":   "vault-root",
+		"token": "not-a-token-but-a-token-field",
+		"path":  "auth/token/lookup/hvs.CAESIJlvq2NmLmZs3xJ1dkq3f1Yb",
+	}).Debugf("unseal key: %s", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("the output should be JSON: %s", buf.String())
+	}
+
+	if entry["level"] != "debug" {
+		t.Errorf("the debug entry should be written: %v", entry)
+	}
+	if entry["key"] != "vault-root" {
+		t.Errorf("the key ID must not be redacted: %v", entry)
+	}
+	if entry["token"] != redacted || entry["path"] != "auth/token/lookup/"+redacted {
+		t.Errorf("the token must be redacted: %v", entry)
+	}
+	if msg := entry["msg"].(string); msg != "unseal key: "+redacted {
+		t.Errorf("the unseal key must be redacted: %s", msg)
+	}
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	if err := Configure(logrus.New(), "xml", "info"); err == nil {
+		t.Error("the xml format should be rejected")
+	}
+	if err := Configure(logrus.New(), FormatConsole, "loud"); err == nil {
+		t.Error("the loud level should be rejected")
+	}
+}
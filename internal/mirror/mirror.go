@@ -0,0 +1,86 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror rewrites container image references to pull them from the mirror registries
+// of air-gapped clusters.
+package mirror
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+const dockerHub = "docker.io"
+
+// Mirrors maps the registries to the registries (and optional repository prefixes) mirroring them
+type Mirrors map[string]string
+
+// Parse parses a comma separated list of registry=mirror pairs,
+// e.g. docker.io=registry.local/dockerhub,quay.io=registry.local/quay
+func Parse(mirrors string) (Mirrors, error) {
+	m := Mirrors{}
+	for _, pair := range strings.Split(mirrors, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid image mirror %q, expected registry=mirror", pair)
+		}
+
+		m[normalizeRegistry(parts[0])] = strings.TrimSuffix(parts[1], "/")
+	}
+	return m, nil
+}
+
+func normalizeRegistry(registry string) string {
+	if registry == "index.docker.io" || registry == "registry-1.docker.io" {
+		return dockerHub
+	}
+	return registry
+}
+
+// Split returns the registry and the repository (with the tag or digest) of the image,
+// the Docker Hub images get the docker.io registry, the official ones the library repository
+func Split(image string) (string, string) {
+	slash := strings.Index(image, "/")
+	if slash == -1 {
+		return dockerHub, "library/" + image
+	}
+
+	registry := image[:slash]
+	if !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		return dockerHub, image
+	}
+
+	return normalizeRegistry(registry), image[slash+1:]
+}
+
+// Image returns the image pulled from the mirror of its registry, or the image as is if its registry isn't mirrored
+func (m Mirrors) Image(image string) string {
+	if len(m) == 0 || image == "" {
+		return image
+	}
+
+	registry, repository := Split(image)
+	mirror, ok := m[registry]
+	if !ok {
+		return image
+	}
+
+	return mirror + "/" + repository
+}
@@ -0,0 +1,44 @@
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import "testing"
+
+func TestMirrorsImage(t *testing.T) {
+	mirrors, err := Parse("docker.io=registry.local/dockerhub, quay.io=registry.local/quay/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"vault:1.5.0":                             "registry.local/dockerhub/library/vault:1.5.0",
+		"banzaicloud/bank-vaults:latest":          "registry.local/dockerhub/banzaicloud/bank-vaults:latest",
+		"index.docker.io/prom/statsd-exporter":    "registry.local/dockerhub/prom/statsd-exporter",
+		"quay.io/coreos/etcd@sha256:0123":         "registry.local/quay/coreos/etcd@sha256:0123",
+		"ghcr.io/banzaicloud/vault-env:1.5.0":     "ghcr.io/banzaicloud/vault-env:1.5.0",
+		"localhost:5000/vault":                    "localhost:5000/vault",
+		"registry.local/dockerhub/library/vault:": "registry.local/dockerhub/library/vault:",
+	}
+
+	for image, expected := range tests {
+		if mirrored := mirrors.Image(image); mirrored != expected {
+			t.Errorf("%s: expected %s, got %s", image, expected, mirrored)
+		}
+	}
+
+	if _, err := Parse("docker.io"); err == nil {
+		t.Error("mirrors without a mirror registry must be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry creates the metrics recorders of the bank-vaults components for the configured backend.
+package telemetry
+
+import (
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+)
+
+// Backends of the metrics
+const (
+	BackendPrometheus = "prometheus"
+	BackendStatsd     = "statsd"
+	BackendNone       = "none"
+)
+
+// NewRecorder returns the Recorder of the backend, the metrics are prefixed with namespace.
+// The Prometheus metrics are registered with registerer, the StatsD ones are sent to statsdAddress.
+func NewRecorder(backend, namespace, statsdAddress string, registerer prometheus.Registerer) (metrics.Recorder, error) {
+	switch backend {
+	case BackendPrometheus, "":
+		return NewPrometheus(registerer, namespace), nil
+	case BackendStatsd:
+		if statsdAddress == "" {
+			return nil, errors.New("the statsd metrics backend needs an address") // nolint:goerr113
+		}
+		return metrics.NewStatsd(statsdAddress, namespace)
+	case BackendNone:
+		return metrics.Noop, nil
+	default:
+		return nil, errors.Errorf("unknown metrics backend: %s", backend)
+	}
+}
+
+// prometheusRecorder registers the metrics with a Prometheus registerer, the metrics are created
+// once per name, so components can ask for the same metric again
+type prometheusRecorder struct {
+	registerer prometheus.Registerer
+	namespace  string
+
+	mu         sync.Mutex
+	collectors map[string]prometheus.Collector
+}
+
+// NewPrometheus returns a Recorder registering the metrics with registerer
+func NewPrometheus(registerer prometheus.Registerer, namespace string) metrics.Recorder {
+	return &prometheusRecorder{
+		registerer: registerer,
+		namespace:  namespace,
+		collectors: map[string]prometheus.Collector{},
+	}
+}
+
+// register returns the registered collector of the name, or creates and registers it with create
+func (r *prometheusRecorder) register(name string, create func() prometheus.Collector) prometheus.Collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if collector, ok := r.collectors[name]; ok {
+		return collector
+	}
+
+	collector := create()
+	if err := r.registerer.Register(collector); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			collector = are.ExistingCollector
+		}
+	}
+	r.collectors[name] = collector
+
+	return collector
+}
+
+func (r *prometheusRecorder) Counter(name, help string, labelNames ...string) metrics.Counter {
+	vec, _ := r.register(name, func() prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: r.namespace, Name: name, Help: help}, labelNames)
+	}).(*prometheus.CounterVec)
+	return prometheusCounter{vec}
+}
+
+func (r *prometheusRecorder) Gauge(name, help string, labelNames ...string) metrics.Gauge {
+	vec, _ := r.register(name, func() prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: r.namespace, Name: name, Help: help}, labelNames)
+	}).(*prometheus.GaugeVec)
+	return prometheusGauge{vec}
+}
+
+func (r *prometheusRecorder) Histogram(name, help string, labelNames ...string) metrics.Histogram {
+	vec, _ := r.register(name, func() prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: r.namespace, Name: name, Help: help}, labelNames)
+	}).(*prometheus.HistogramVec)
+	return prometheusHistogram{vec}
+}
+
+type prometheusCounter struct{ vec *prometheus.CounterVec }
+
+func (c prometheusCounter) Add(value float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(value)
+}
+
+type prometheusGauge struct{ vec *prometheus.GaugeVec }
+
+func (g prometheusGauge) Set(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+func (g prometheusGauge) Add(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(value)
+}
+
+type prometheusHistogram struct{ vec *prometheus.HistogramVec }
+
+func (h prometheusHistogram) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
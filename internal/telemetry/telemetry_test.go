@@ -0,0 +1,52 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheus(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	recorder, err := NewRecorder("", "bank_vaults", "", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Counter("lookups_total", "Number of lookups.", "kind").Add(1, "secret")
+	// the metric is created once, asking for it again returns the registered one
+	recorder.Counter("lookups_total", "Number of lookups.", "kind").Add(2, "secret")
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "bank_vaults_lookups_total" {
+		t.Errorf("expected only the bank_vaults_lookups_total metric, got %v", families)
+	}
+
+	vec := recorder.(*prometheusRecorder).collectors["lookups_total"].(*prometheus.CounterVec)
+	if value := testutil.ToFloat64(vec.WithLabelValues("secret")); value != 3 {
+		t.Errorf("expected the counter to be 3, got %v", value)
+	}
+
+	if _, err := NewRecorder("otlp", "bank_vaults", "", registry); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
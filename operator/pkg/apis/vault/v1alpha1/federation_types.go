@@ -0,0 +1,263 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// FederationCAPath is where the CA bundles of the federation peers are mounted in the Vault Pods
+const FederationCAPath = "/vault/federation"
+
+// Federation declares the peers of a Vault in other clusters, and the replication or the transit auto-unseal
+// between them. The operator translates it into the replication block of the externalConfig, which the
+// configurer bootstraps, and the transit seal of the Vault config.
+type Federation struct {
+	// Peers are the Vault clusters this Vault is federated with.
+	// default:
+	Peers []FederationPeer `json:"peers"`
+
+	// Replication configures this Vault as a Vault Enterprise replication primary or secondary of a peer.
+	// default:
+	Replication []FederationReplication `json:"replication,omitempty"`
+
+	// TransitUnseal auto-unseals this Vault with the transit secret engine of a peer.
+	// default:
+	TransitUnseal *FederationTransitUnseal `json:"transitUnseal,omitempty"`
+}
+
+// FederationPeer is a Vault cluster in another Kubernetes cluster or datacenter
+type FederationPeer struct {
+	// Name identifies the peer in the replication and transitUnseal blocks.
+	// default:
+	Name string `json:"name"`
+
+	// Address is the API address of the peer, for example https://vault.dc2.example.com:8200
+	// default:
+	Address string `json:"address"`
+
+	// CABundleSecret is the Secret (in the namespace of the Vault) holding the CA certificates of the peer,
+	// it is mounted in the Vault Pods.
+	// default:
+	CABundleSecret *v1.SecretKeySelector `json:"caBundleSecret,omitempty"`
+}
+
+// FederationReplication is a performance or DR replication role of this Vault
+type FederationReplication struct {
+	// Type is the replication type: performance or dr.
+	// default:
+	Type string `json:"type"`
+
+	// Mode is primary or secondary.
+	// default:
+	Mode string `json:"mode"`
+
+	// Peer is the name of the primary peer, required for secondaries.
+	// default:
+	Peer string `json:"peer,omitempty"`
+
+	// TokenSecret is the Secret holding the activation token of a secondary, generated on the primary with
+	// bank-vaults replication-token.
+	// default:
+	TokenSecret *v1.SecretKeySelector `json:"tokenSecret,omitempty"`
+
+	// PrimaryClusterAddr is the cluster address of a primary the secondaries connect to.
+	// default: the cluster_addr of Vault
+	PrimaryClusterAddr string `json:"primaryClusterAddr,omitempty"`
+
+	// WaitHealthy is how long the configurer waits for the replication to be healthy.
+	// default: 5m
+	WaitHealthy string `json:"waitHealthy,omitempty"`
+}
+
+// FederationTransitUnseal is the transit seal of this Vault with a key of a peer
+type FederationTransitUnseal struct {
+	// Peer is the name of the peer with the transit secret engine.
+	// default:
+	Peer string `json:"peer"`
+
+	// MountPath is the mount path of the transit secret engine on the peer.
+	// default: transit
+	MountPath string `json:"mountPath,omitempty"`
+
+	// KeyName is the name of the transit key.
+	// default: autounseal
+	KeyName string `json:"keyName,omitempty"`
+
+	// TokenSecret is the Secret holding the token on the peer which may encrypt and decrypt with the key,
+	// it is passed to Vault as VAULT_TOKEN.
+	// default:
+	TokenSecret v1.SecretKeySelector `json:"tokenSecret"`
+}
+
+// GetPeer returns the peer with the name
+func (f *Federation) GetPeer(name string) (FederationPeer, bool) {
+	for _, peer := range f.Peers {
+		if peer.Name == name {
+			return peer, true
+		}
+	}
+	return FederationPeer{}, false
+}
+
+// PeerCAFile returns the path of the CA bundle of the peer in the Vault Pods, or "" if it has none
+func (f *Federation) PeerCAFile(name string) string {
+	peer, ok := f.GetPeer(name)
+	if !ok || peer.CABundleSecret == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/ca.crt", FederationCAPath, peer.Name)
+}
+
+// Validate checks the references to the peers and the replication settings
+func (f *Federation) Validate() error {
+	names := map[string]bool{}
+	for _, peer := range f.Peers {
+		if peer.Name == "" || peer.Address == "" {
+			return fmt.Errorf("federation peers need a name and an address")
+		}
+		if names[peer.Name] {
+			return fmt.Errorf("duplicate federation peer: %s", peer.Name)
+		}
+		names[peer.Name] = true
+	}
+
+	types := map[string]bool{}
+	for _, replication := range f.Replication {
+		if replication.Type != "performance" && replication.Type != "dr" {
+			return fmt.Errorf("unknown replication type: %s", replication.Type)
+		}
+		if types[replication.Type] {
+			return fmt.Errorf("duplicate %s replication", replication.Type)
+		}
+		types[replication.Type] = true
+
+		switch replication.Mode {
+		case "primary":
+		case "secondary":
+			if !names[replication.Peer] {
+				return fmt.Errorf("the %s replication secondary needs a primary peer", replication.Type)
+			}
+			if replication.TokenSecret == nil {
+				return fmt.Errorf("the %s replication secondary needs a tokenSecret", replication.Type)
+			}
+		default:
+			return fmt.Errorf("unknown %s replication mode: %s", replication.Type, replication.Mode)
+		}
+	}
+
+	if f.TransitUnseal != nil && !names[f.TransitUnseal.Peer] {
+		return fmt.Errorf("unknown transit unseal peer: %s", f.TransitUnseal.Peer)
+	}
+
+	return nil
+}
+
+// MergeExternalConfig adds the replication block of the federation to the externalConfig, the replication
+// types configured in the externalConfig itself are kept as they are
+func (f *Federation) MergeExternalConfig(externalConfig VaultExternalConfig) VaultExternalConfig {
+	if f == nil || len(f.Replication) == 0 {
+		return externalConfig
+	}
+
+	config := copyExternalConfig(externalConfig)
+
+	replicationConfig := map[string]interface{}{}
+	if existing, ok := config["replication"].(map[string]interface{}); ok {
+		for replicationType, value := range existing {
+			replicationConfig[replicationType] = value
+		}
+	}
+
+	for _, replication := range f.Replication {
+		if _, ok := replicationConfig[replication.Type]; ok {
+			continue
+		}
+
+		typeConfig := map[string]interface{}{"mode": replication.Mode}
+		if replication.WaitHealthy != "" {
+			typeConfig["waitHealthy"] = replication.WaitHealthy
+		}
+
+		if replication.Mode == "primary" {
+			if replication.PrimaryClusterAddr != "" {
+				typeConfig["primaryClusterAddr"] = replication.PrimaryClusterAddr
+			}
+		} else {
+			peer, _ := f.GetPeer(replication.Peer)
+			typeConfig["primaryAPIAddr"] = peer.Address
+			if caFile := f.PeerCAFile(peer.Name); caFile != "" {
+				typeConfig["caFile"] = caFile
+			}
+			typeConfig["token"] = map[string]interface{}{
+				"valueFrom": map[string]interface{}{
+					"secretKeyRef": map[string]interface{}{
+						"name": replication.TokenSecret.Name,
+						"key":  replication.TokenSecret.Key,
+					},
+				},
+			}
+		}
+
+		replicationConfig[replication.Type] = typeConfig
+	}
+
+	config["replication"] = replicationConfig
+
+	return config
+}
+
+// TransitSeal returns the transit seal stanza of the Vault config, or nil if the transit auto-unseal isn't used
+func (f *Federation) TransitSeal() map[string]interface{} {
+	if f == nil || f.TransitUnseal == nil {
+		return nil
+	}
+
+	peer, _ := f.GetPeer(f.TransitUnseal.Peer)
+
+	mountPath := f.TransitUnseal.MountPath
+	if mountPath == "" {
+		mountPath = "transit"
+	}
+	keyName := f.TransitUnseal.KeyName
+	if keyName == "" {
+		keyName = "autounseal"
+	}
+
+	transit := map[string]interface{}{
+		"address":    peer.Address,
+		"mount_path": mountPath + "/",
+		"key_name":   keyName,
+	}
+	if caFile := f.PeerCAFile(peer.Name); caFile != "" {
+		transit["tls_ca_cert"] = caFile
+	}
+
+	return map[string]interface{}{"transit": transit}
+}
+
+// ReplicationStatus is the state of a replication type of this Vault, read from the unauthenticated
+// sys/replication/status endpoint
+type ReplicationStatus struct {
+	Type  string `json:"type"`
+	Mode  string `json:"mode"`
+	State string `json:"state,omitempty"`
+	// Lag is the count of the WAL entries of the primary peer not streamed to this secondary yet
+	Lag int64 `json:"lag,omitempty"`
+	// Error is set if the state couldn't be read
+	Error string `json:"error,omitempty"`
+}
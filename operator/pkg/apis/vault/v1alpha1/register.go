@@ -57,6 +57,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Vault{},
 		&VaultList{},
+		&VaultPolicy{},
+		&VaultPolicyList{},
+		&VaultRole{},
+		&VaultRoleList{},
+		&VaultSecretEngine{},
+		&VaultSecretEngineList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
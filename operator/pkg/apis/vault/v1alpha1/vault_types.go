@@ -23,6 +23,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +31,9 @@ import (
 	"github.com/spf13/cast"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/pointer"
@@ -60,6 +64,38 @@ type Vault struct {
 	Status VaultStatus `json:"status,omitempty"`
 }
 
+// VaultDeletionProtectionFinalizer blocks the deletion of a Vault with deletionProtection until it is confirmed
+const VaultDeletionProtectionFinalizer = "vault.banzaicloud.com/deletion-protection"
+
+// HasFinalizer checks if the Vault has the deletion protection finalizer of the operator
+func (vault *Vault) HasFinalizer() bool {
+	for _, finalizer := range vault.Finalizers {
+		if finalizer == VaultDeletionProtectionFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFinalizer adds or removes the deletion protection finalizer, it returns true if the finalizers have changed
+func (vault *Vault) SetFinalizer(enabled bool) bool {
+	if vault.HasFinalizer() == enabled {
+		return false
+	}
+	if enabled {
+		vault.Finalizers = append(vault.Finalizers, VaultDeletionProtectionFinalizer)
+		return true
+	}
+	finalizers := make([]string, 0, len(vault.Finalizers))
+	for _, finalizer := range vault.Finalizers {
+		if finalizer != VaultDeletionProtectionFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	vault.Finalizers = finalizers
+	return true
+}
+
 // VaultList contains a list of Vault
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -164,6 +200,12 @@ type VaultSpec struct {
 	// default:
 	WatchedSecretsAnnotations []map[string]string `json:"watchedSecretsAnnotations"`
 
+	// RestartOnReferencedConfigChange restarts the Vault Pods as well when a value of a Secret or ConfigMap
+	// referenced by a valueFrom of the externalConfig changes, the configurer Pods apply the configuration
+	// again in any case.
+	// default: false
+	RestartOnReferencedConfigChange bool `json:"restartOnReferencedConfigChange,omitempty"`
+
 	// Annotations define a set of common Kubernetes annotations that will be added to all operator managed resources.
 	// default:
 	Annotations map[string]string `json:"annotations"`
@@ -228,6 +270,18 @@ type VaultSpec struct {
 	// default:
 	SecurityContext v1.PodSecurityContext `json:"securityContext,omitempty"`
 
+	// ContainerSecurityContext is a Kubernetes SecurityContext that will be applied to the vault and bank-vaults
+	// containers of the Vault Pods, the fields set in it override the defaults. With "disable_mlock" in the Vault
+	// config the default is a hardened profile: the containers run as non-root with a read-only root filesystem,
+	// without privilege escalation and with all capabilities dropped, otherwise the vault container runs with IPC_LOCK,
+	// which Vault requires for mlock.
+	// default:
+	ContainerSecurityContext *v1.SecurityContext `json:"containerSecurityContext,omitempty"`
+
+	// SeccompProfile is the seccomp profile of the Vault Pods, "unconfined" disables it.
+	// default: "runtime/default"
+	SeccompProfile string `json:"seccompProfile,omitempty"`
+
 	// EtcdVersion is the ETCD version of the automatically provisioned ETCD cluster
 	// default: "3.3.17"
 	EtcdVersion string `json:"etcdVersion"`
@@ -294,10 +348,35 @@ type VaultSpec struct {
 	// default:
 	Tolerations []v1.Toleration `json:"tolerations"`
 
+	// TopologySpreadConstraints is Kubernetes TopologySpreadConstraints definition that should be applied to all Vault Pods,
+	// the constraints without a labelSelector select the Vault Pods.
+	// default:
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// PriorityClassName is the name of the PriorityClass of the Vault Pods.
+	// default: ""
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// RuntimeClassName is the name of the RuntimeClass of the Vault Pods.
+	// default: ""
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+
+	// PodDisruptionBudget, if it is specified the operator creates a PodDisruptionBudget for the Vault Pods.
+	// See the type for more details.
+	// default:
+	PodDisruptionBudget *PodDisruptionBudget `json:"podDisruptionBudget,omitempty"`
+
 	// ServiceAccount is Kubernetes ServiceAccount in which the Vault Pods should be running in.
 	// default: default
 	ServiceAccount string `json:"serviceAccount"`
 
+	// ServiceAccountTokenProjections define projected ServiceAccount token volumes with custom audiences and
+	// expiration, mounted into the Vault and bank-vaults containers, for clusters enforcing bound audiences.
+	// Point KUBERNETES_SERVICE_ACCOUNT_TOKEN to the token file with the env configs to authenticate with it.
+	// See the type for more details.
+	// default:
+	ServiceAccountTokenProjections []ServiceAccountTokenProjection `json:"serviceAccountTokenProjections,omitempty"`
+
 	// Volumes define some extra Kubernetes Volumes for the Vault Pods.
 	// default:
 	Volumes []v1.Volume `json:"volumes,omitempty"`
@@ -329,10 +408,135 @@ type VaultSpec struct {
 	// default:
 	Ingress *Ingress `json:"ingress,omitempty"`
 
+	// NetworkPolicy, if it is specified the operator will create least-privilege NetworkPolicies for the Vault
+	// and the Vault configurer Pods.
+	// See the type for more details.
+	// default:
+	NetworkPolicy *NetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// CSIProvider, if it is specified the operator deploys the Vault CSI provider DaemonSet configured against
+	// this Vault, and the SecretProviderClasses generated from the templates. The Secrets Store CSI driver
+	// has to be installed separately. See the type for more details.
+	// default:
+	CSIProvider *CSIProvider `json:"csiProvider,omitempty"`
+
+	// Federation declares the peers of this Vault in other clusters, and the performance/DR replication or
+	// the transit auto-unseal the operator configures between them. See the type for more details.
+	// default:
+	Federation *Federation `json:"federation,omitempty"`
+
+	// RBAC, if it is specified the operator creates a ServiceAccount for the Vault and one for the configurer Pods,
+	// bound to least-privilege Roles scoped to the Secrets and Pods of this Vault, and ServiceAccount is ignored.
+	// See the type for more details.
+	// default:
+	RBAC *RBAC `json:"rbac,omitempty"`
+
+	// AuditLogShipping, if it is specified the operator runs a log shipper sidecar (Vector or Fluent Bit) with a generated
+	// configuration, which delivers the audit log of a file audit device to the destination with an on-disk buffer.
+	// See the type for more details.
+	// default:
+	AuditLogShipping *AuditLogShipping `json:"auditLogShipping,omitempty"`
+
+	// Standby, if it is specified this Vault is a warm standby of a primary Vault (for example in another cluster):
+	// instead of initializing and unsealing it, the bank-vaults sidecar restores the latest Raft snapshot of the primary
+	// periodically and keeps Vault sealed. Remove it to fail over, the sidecar unseals Vault with the keys of the primary.
+	// See the type for more details.
+	// default:
+	Standby *StandbyConfig `json:"standby,omitempty"`
+
+	// Backup, if it is specified the operator runs a CronJob which stores Raft snapshots of Vault with the
+	// bank-vaults backup command on a schedule, and prunes the ones which are not retained anymore.
+	// The state of the last backups is reported in the status. See the type for more details.
+	// default:
+	Backup *BackupSchedule `json:"backup,omitempty"`
+
+	// Teams is a shorthand for onboarding teams: a KV version 2 mount with a path prefix, a policy and
+	// a Kubernetes auth role for every team, which are merged into the externalConfig.
+	// See the type for more details.
+	// default:
+	Teams *TeamsConfig `json:"teams,omitempty"`
+
+	// ConfigurerLeaderElection makes the configurer Pods elect a leader with a Kubernetes Lease, so that
+	// only one of them applies the externalConfig, even while a new one is rolled out.
+	// default: false
+	ConfigurerLeaderElection bool `json:"configurerLeaderElection,omitempty"`
+
+	// ConfigurerCanary validates the changes of the externalConfig before the configurer applies them,
+	// so that a bad policy or auth method doesn't break the authentication of the workloads.
+	// See the type for more details.
+	// default:
+	ConfigurerCanary *ConfigurerCanary `json:"configurerCanary,omitempty"`
+
+	// StepDownOnShutdown adds preStop hooks to the Vault Pods, which step down the active Vault instance
+	// with "bank-vaults stepdown" before it is stopped, and wait for it to rejoin as standby, so the
+	// leadership is handed over gracefully during rolling upgrades.
+	// default: false
+	StepDownOnShutdown bool `json:"stepDownOnShutdown,omitempty"`
+
+	// DeletionProtection adds a finalizer to the Vault, which blocks its deletion (and the garbage collection
+	// of the StatefulSet and the other owned resources) until the vault.banzaicloud.io/confirm-deletion
+	// annotation is set to the name of the Vault.
+	// default: false
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// RaftScaling makes changing the size of a Vault cluster with Raft storage safe: the new servers join as
+	// non-voters and autopilot promotes them after they have been healthy for RaftServerStabilizationTime
+	// (Vault 1.7+), the servers removed by a scale-down leave the Raft cluster in a preStop hook (after
+	// stepping down if active), so they are not counted in the quorum anymore. Scale down one server at a time.
+	// default: false
+	RaftScaling bool `json:"raftScaling,omitempty"`
+
+	// RaftServerStabilizationTime is how long a new Raft server has to be healthy before it becomes a voter,
+	// when RaftScaling is enabled.
+	// default: 30s
+	RaftServerStabilizationTime string `json:"raftServerStabilizationTime,omitempty"`
+
+	// Upgrade makes the operator roll out the changes of the Vault Pods (e.g. a new Vault image) standby-first,
+	// instead of the StatefulSet controller in reverse ordinal order, see UpgradeConfig.
+	// default:
+	Upgrade *UpgradeConfig `json:"upgrade,omitempty"`
+
+	// VaultPolicyNamespaces lists the Namespaces the VaultPolicy resources referencing this Vault are accepted from,
+	// "*" accepts them from every Namespace. Their policies are added to the externalConfig as <namespace>-<name>.
+	// default:
+	VaultPolicyNamespaces []string `json:"vaultPolicyNamespaces,omitempty"`
+
+	// VaultRoleNamespaces lists the Namespaces the VaultRole resources referencing this Vault are accepted from,
+	// with the prefixes of the policies their roles may be granted. Their roles are added to the Kubernetes auth
+	// methods in the externalConfig as <namespace>-<name>.
+	// default:
+	VaultRoleNamespaces []VaultRoleNamespace `json:"vaultRoleNamespaces,omitempty"`
+
+	// VaultSecretEngineNamespaces lists the Namespaces the VaultSecretEngine resources referencing this Vault are
+	// accepted from besides its own Namespace, "*" accepts them from every Namespace. They are added to the secrets
+	// of the externalConfig.
+	// default:
+	VaultSecretEngineNamespaces []string `json:"vaultSecretEngineNamespaces,omitempty"`
+
+	// LocalVaultAddress is the address the bank-vaults sidecar health checks and unseals the Vault instance
+	// of its Pod at, for example unix:///vault/socket/vault.sock for a unix listener on a volume shared by the
+	// containers, or a listener with a non-standard scheme or port.
+	// default: https://127.0.0.1:8200 (http with TLS disabled)
+	LocalVaultAddress string `json:"localVaultAddress,omitempty"`
+
+	// ExternalVaultAddress is the address of an externally managed Vault cluster (HCP Vault, or a cluster running
+	// on VMs for example). If it is set the operator only runs the configurer, and the unsealer next to it, against
+	// this address, the StatefulSet, the Services and the TLS Secret of Vault are not created. The CA certificate
+	// of the Vault is taken from the existingTlsSecretName Secret if it is set, from the system roots otherwise.
+	// The unsealer runs in auto-unseal mode if the config has a seal stanza, like with an operator managed Vault.
+	// default:
+	ExternalVaultAddress string `json:"externalVaultAddress,omitempty"`
+
 	// ServiceMonitorEnabled enables the creation of Prometheus Operator specific ServiceMonitor for Vault.
 	// default: false
 	ServiceMonitorEnabled bool `json:"serviceMonitorEnabled,omitempty"`
 
+	// Monitoring, if it is specified the operator creates Prometheus Operator ServiceMonitors for Vault and the
+	// bank-vaults containers (the sidecar and the configurer), and optionally a Grafana dashboard ConfigMap.
+	// It implies serviceMonitorEnabled. See the type for more details.
+	// default:
+	Monitoring *Monitoring `json:"monitoring,omitempty"`
+
 	// ExistingTLSSecretName is name of the secret that contains a TLS server certificate and key and the corresponding CA certificate.
 	// Required secret format kubernetes.io/tls type secret keys + ca.crt key
 	// If it is set, generating certificate will be disabled
@@ -347,6 +551,16 @@ type VaultSpec struct {
 	// default:
 	TLSAdditionalHosts []string `json:"tlsAdditionalHosts,omitempty"`
 
+	// TLSReload makes the bank-vaults sidecar send SIGHUP to Vault when the server certificate in the TLS Secret
+	// changes, so the renewed certificate is reloaded by Vault instead of restarting the Vault Pods.
+	// The Pods are still restarted if the CA changes. It turns on shareProcessNamespace for the Vault Pods.
+	// default: false
+	TLSReload bool `json:"tlsReload,omitempty"`
+
+	// TLS configures how the TLS certificates of Vault are provisioned, instead of the operator generating its own CA.
+	// default:
+	TLS *TLSConfig `json:"tls,omitempty"`
+
 	// CANamespaces define a list of namespaces where the generated CA certificate for Vault should be distributed,
 	// use ["*"] for all namespaces.
 	// default:
@@ -356,6 +570,11 @@ type VaultSpec struct {
 	// default: false
 	IstioEnabled bool `json:"istioEnabled,omitempty"`
 
+	// ServiceMesh adjusts the Vault Pods and Services to work under service mesh sidecar injection,
+	// it implies IstioEnabled.
+	// default:
+	ServiceMesh *ServiceMesh `json:"serviceMesh,omitempty"`
+
 	// VeleroEnabled describes if the cluster has a Velero running and enabled.
 	// default: false
 	VeleroEnabled bool `json:"veleroEnabled,omitempty"`
@@ -366,6 +585,51 @@ type VaultSpec struct {
 
 	// InitContainers add extra initContainers
 	VaultInitContainers []v1.Container `json:"vaultInitContainers,omitempty"`
+
+	// ExtraInitContainers are added to the Vault Pods after the config-templating init container
+	// (and the vaultInitContainers).
+	// default:
+	ExtraInitContainers []v1.Container `json:"extraInitContainers,omitempty"`
+
+	// SidecarContainers are added to the Vault Pods next to the Vault and bank-vaults containers, for example
+	// log shippers or proxies. They can mount the volumes of the Pod by name: vault-config, vault-tls,
+	// the sharedVolumes and the volumes of the spec.
+	// default:
+	SidecarContainers []v1.Container `json:"sidecarContainers,omitempty"`
+
+	// SharedVolumes are emptyDir volumes of the Vault Pods mounted in the Vault container at /vault/shared/<name>,
+	// to share files or sockets with the sidecarContainers which mount them by name.
+	// default:
+	SharedVolumes []string `json:"sharedVolumes,omitempty"`
+}
+
+// ServiceAccountTokenProjection is a projected ServiceAccount token volume of the Vault and configurer Pods
+type ServiceAccountTokenProjection struct {
+	// Name of the volume.
+	Name string `json:"name"`
+
+	// MountPath is the directory where the token file is mounted in the containers.
+	MountPath string `json:"mountPath"`
+
+	// Path is the name of the token file in MountPath.
+	// default: token
+	Path string `json:"path,omitempty"`
+
+	// Audience is the intended audience of the token, the token is rejected by recipients which are not in it.
+	// default: the audience of the API server
+	Audience string `json:"audience,omitempty"`
+
+	// ExpirationSeconds is the requested lifetime of the token, it is rotated by the kubelet before it expires.
+	// default: 3600
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+// GetPath returns the name of the token file in the volume
+func (p *ServiceAccountTokenProjection) GetPath() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	return "token"
 }
 
 // HAStorageTypes is the set of storage backends supporting High Availability
@@ -530,6 +794,30 @@ func (spec *VaultSpec) GetTLSExpiryThreshold() time.Duration {
 	return duration
 }
 
+// IsTLSReload returns if the TLS certificates are reloaded by Vault instead of restarting it,
+// the certificates renewed by cert-manager are always reloaded
+func (spec *VaultSpec) IsTLSReload() bool {
+	return (spec.TLSReload || spec.IsCertManagerTLS()) && !spec.IsTLSDisabled()
+}
+
+// IsCertManagerTLS returns if the TLS certificate of Vault is issued by cert-manager
+func (spec *VaultSpec) IsCertManagerTLS() bool {
+	return spec.TLS != nil && spec.TLS.CertManager != nil && !spec.IsTLSDisabled()
+}
+
+// HasExternalTLSSecret returns if the TLS Secret of Vault is not generated by the operator
+func (spec *VaultSpec) HasExternalTLSSecret() bool {
+	return spec.ExistingTLSSecretName != "" || spec.IsCertManagerTLS()
+}
+
+// GetTLSSecretName returns the name of the TLS Secret of Vault
+func (vault *Vault) GetTLSSecretName() string {
+	if vault.Spec.ExistingTLSSecretName != "" {
+		return vault.Spec.ExistingTLSSecretName
+	}
+	return vault.Name + "-tls"
+}
+
 func (spec *VaultSpec) getListener() map[string]interface{} {
 	return cast.ToStringMap(spec.Config["listener"])
 }
@@ -603,10 +891,23 @@ func (spec *VaultSpec) GetAnnotations() map[string]string {
 	return spec.Annotations
 }
 
+// GetSeccompProfile returns the seccomp profile of the Vault Pods
+func (spec *VaultSpec) GetSeccompProfile() string {
+	if spec.SeccompProfile == "" {
+		return "runtime/default"
+	}
+	return spec.SeccompProfile
+}
+
+// IsMlockDisabled returns true if mlock is disabled in the Vault config
+func (spec *VaultSpec) IsMlockDisabled() bool {
+	return cast.ToBool(spec.Config["disable_mlock"])
+}
+
 // GetAPIPortName returns the main Vault port name based on Istio and TLS settings
 func (spec *VaultSpec) GetAPIPortName() string {
 	portName := "api-port"
-	if spec.IstioEnabled {
+	if spec.IsServiceMesh() {
 		if spec.IsTLSDisabled() {
 			return "http-" + portName
 		}
@@ -664,6 +965,26 @@ func (spec *VaultSpec) IsFluentDEnabled() bool {
 	return spec.FluentDEnabled
 }
 
+// IsAuditLogShippingEnabled returns true if the audit log shipper sidecar is to be deployed
+func (spec *VaultSpec) IsAuditLogShippingEnabled() bool {
+	return spec.AuditLogShipping != nil
+}
+
+// IsRBACEnabled returns true if the ServiceAccounts and Roles of the Vault and configurer Pods are to be generated
+func (spec *VaultSpec) IsRBACEnabled() bool {
+	return spec.RBAC != nil
+}
+
+// IsStandby returns true if Vault is a warm standby restored from the snapshots of a primary Vault
+func (spec *VaultSpec) IsStandby() bool {
+	return spec.Standby != nil
+}
+
+// IsExternalVault returns true if the operator only configures an externally managed Vault
+func (spec *VaultSpec) IsExternalVault() bool {
+	return spec.ExternalVaultAddress != ""
+}
+
 // IsStatsDDisabled returns false if statsd sidecar is to be deployed
 func (spec *VaultSpec) IsStatsDDisabled() bool {
 	return spec.StatsDDisabled
@@ -671,18 +992,65 @@ func (spec *VaultSpec) IsStatsDDisabled() bool {
 
 // ConfigJSON returns the Config field as a JSON string
 func (spec *VaultSpec) ConfigJSON() string {
-	config, _ := json.Marshal(spec.Config)
+	vaultConfig := spec.Config
+	if seal := spec.Federation.TransitSeal(); seal != nil && !spec.hasSealConfig() {
+		vaultConfig = VaultConfig{}
+		for key, value := range spec.Config {
+			vaultConfig[key] = value
+		}
+		vaultConfig["seal"] = seal
+	}
+	config, _ := json.Marshal(vaultConfig)
 	return string(config)
 }
 
-// ExternalConfigJSON returns the ExternalConfig field as a JSON string
+// ExternalConfigResources are the resources merged into the ExternalConfig, besides the teams
+type ExternalConfigResources struct {
+	Policies      []VaultPolicy
+	Roles         []VaultRole
+	SecretEngines []VaultSecretEngine
+	// RemovedSecretEngines are the paths of the secret engines to disable
+	RemovedSecretEngines []string
+}
+
+// ExternalConfigJSON returns the ExternalConfig field, with the configuration of the teams merged, as a JSON string
 func (spec *VaultSpec) ExternalConfigJSON() string {
-	config, _ := json.Marshal(spec.ExternalConfig)
+	return spec.ExternalConfigJSONWith(ExternalConfigResources{})
+}
+
+// BaseExternalConfig returns the externalConfig with the federation and the teams merged into it, the
+// VaultPolicies, VaultRoles and VaultSecretEngines are merged into this one and checked for conflicts with it
+func (spec *VaultSpec) BaseExternalConfig() VaultExternalConfig {
+	externalConfig := spec.Federation.MergeExternalConfig(spec.ExternalConfig)
+	if spec.Teams != nil {
+		externalConfig = spec.Teams.Merge(externalConfig)
+	}
+	return externalConfig
+}
+
+// ExternalConfigJSONWith returns the ExternalConfig field, with the configuration of the teams and the
+// accepted resources merged, as a JSON string
+func (spec *VaultSpec) ExternalConfigJSONWith(resources ExternalConfigResources) string {
+	externalConfig := spec.BaseExternalConfig()
+	if len(resources.Policies) > 0 {
+		externalConfig, _ = MergeVaultPolicies(externalConfig, resources.Policies)
+	}
+	if len(resources.Roles) > 0 {
+		externalConfig, _ = MergeVaultRoles(externalConfig, resources.Roles)
+	}
+	if len(resources.SecretEngines) > 0 || len(resources.RemovedSecretEngines) > 0 {
+		externalConfig, _ = MergeVaultSecretEngines(externalConfig, resources.SecretEngines, resources.RemovedSecretEngines)
+	}
+	config, _ := json.Marshal(externalConfig)
 	return string(config)
 }
 
 // IsAutoUnseal checks if auto-unseal is configured
 func (spec *VaultSpec) IsAutoUnseal() bool {
+	return spec.hasSealConfig() || (spec.Federation != nil && spec.Federation.TransitUnseal != nil)
+}
+
+func (spec *VaultSpec) hasSealConfig() bool {
 	_, ok := spec.Config["seal"]
 	return ok
 }
@@ -740,6 +1108,18 @@ func (vault *Vault) LabelsForVaultConfigurer() map[string]string {
 	return map[string]string{"app.kubernetes.io/name": "vault-configurator", "vault_cr": vault.Name}
 }
 
+// LabelsForVaultBackup returns the labels for selecting the backup Jobs
+// belonging to the given vault CR name.
+func (vault *Vault) LabelsForVaultBackup() map[string]string {
+	return map[string]string{"app.kubernetes.io/name": "vault-backup", "vault_cr": vault.Name}
+}
+
+// LabelsForVaultUnsealer returns the labels for selecting the unsealer Pods of an external Vault
+// belonging to the given vault CR name.
+func (vault *Vault) LabelsForVaultUnsealer() map[string]string {
+	return map[string]string{"app.kubernetes.io/name": "vault-unsealer", "vault_cr": vault.Name}
+}
+
 // AsOwnerReference returns this Vault instance as an OwnerReference
 func (vault *Vault) AsOwnerReference() metav1.OwnerReference {
 	return metav1.OwnerReference{
@@ -754,9 +1134,74 @@ func (vault *Vault) AsOwnerReference() metav1.OwnerReference {
 // VaultStatus defines the observed state of Vault
 type VaultStatus struct {
 	// Important: Run "make generate-code" to regenerate code after modifying this file
-	Nodes      []string                `json:"nodes"`
-	Leader     string                  `json:"leader"`
+	Nodes  []string `json:"nodes"`
+	Leader string   `json:"leader"`
+	// Conditions are Healthy, Initialized, Unsealed, ConfigSynced, RaftHealthy (with Raft storage)
+	// and BackupSucceeded (with a backup schedule)
 	Conditions []v1.ComponentCondition `json:"conditions,omitempty"`
+	// LastSyncedConfigHash is the hash of the externalConfig last applied successfully by the configurer
+	LastSyncedConfigHash string `json:"lastSyncedConfigHash,omitempty"`
+	// Upgrade is the phase of the standby-first upgrade (with the update revision), if there is one in progress
+	Upgrade string `json:"upgrade,omitempty"`
+	// RemovedSecretEngines are the paths of the deleted VaultSecretEngines with unmountOnDelete, which are
+	// disabled by the configurer (until a secret engine is mounted at the same path again)
+	RemovedSecretEngines []string `json:"removedSecretEngines,omitempty"`
+	// Replication is the state of the replication types configured by the federation
+	Replication []ReplicationStatus `json:"replication,omitempty"`
+	// Backup is the state of the scheduled snapshots, if there is a backup schedule
+	Backup *BackupStatus `json:"backup,omitempty"`
+}
+
+// The condition types of the Vault status besides v1.ComponentHealthy
+const (
+	// VaultInitialized is true if Vault has been initialized
+	VaultInitialized v1.ComponentConditionType = "Initialized"
+	// VaultUnsealed is true if every Vault instance is unsealed
+	VaultUnsealed v1.ComponentConditionType = "Unsealed"
+	// VaultConfigSynced is true if the configurer has applied the current externalConfig successfully
+	VaultConfigSynced v1.ComponentConditionType = "ConfigSynced"
+	// VaultRaftHealthy is true if every server of the Raft cluster is healthy
+	VaultRaftHealthy v1.ComponentConditionType = "RaftHealthy"
+	// VaultBackupSucceeded is true if the last finished backup Job has stored a snapshot (with a backup schedule)
+	VaultBackupSucceeded v1.ComponentConditionType = "BackupSucceeded"
+)
+
+// TLSConfig represents the TLS field of a VaultSpec Kubernetes object
+type TLSConfig struct {
+	// CertManager makes the operator request the TLS certificate of Vault from cert-manager,
+	// with a Certificate resource issuing into the <vault name>-tls Secret.
+	// default:
+	CertManager *CertManagerTLSConfig `json:"certManager,omitempty"`
+}
+
+// CertManagerTLSConfig represents the cert-manager Certificate of Vault
+type CertManagerTLSConfig struct {
+	// IssuerRef is the Issuer or ClusterIssuer of the certificate.
+	// default:
+	IssuerRef CertManagerIssuerRef `json:"issuerRef"`
+
+	// Duration is the requested lifetime of the certificate in Go's Duration format.
+	// default: the default of the issuer
+	Duration string `json:"duration,omitempty"`
+
+	// RenewBefore is how long before the expiration cert-manager renews the certificate, in Go's Duration format.
+	// default: tlsExpiryThreshold
+	RenewBefore string `json:"renewBefore,omitempty"`
+}
+
+// CertManagerIssuerRef references a cert-manager Issuer or ClusterIssuer
+type CertManagerIssuerRef struct {
+	// Name is the name of the issuer.
+	// default:
+	Name string `json:"name"`
+
+	// Kind is the kind of the issuer, Issuer (in the namespace of Vault) or ClusterIssuer.
+	// default: Issuer
+	Kind string `json:"kind,omitempty"`
+
+	// Group is the API group of the issuer, for external issuers.
+	// default: cert-manager.io
+	Group string `json:"group,omitempty"`
 }
 
 // UnsealConfig represents the UnsealConfig field of a VaultSpec Kubernetes object
@@ -927,15 +1372,7 @@ func (usc *UnsealConfig) ToArgs(vault *Vault) []string {
 
 	} else {
 
-		secretNamespace := vault.Namespace
-		if usc.Kubernetes.SecretNamespace != "" {
-			secretNamespace = usc.Kubernetes.SecretNamespace
-		}
-
-		secretName := vault.Name + "-unseal-keys"
-		if usc.Kubernetes.SecretName != "" {
-			secretName = usc.Kubernetes.SecretName
-		}
+		secretNamespace, secretName, _ := usc.KubernetesKeyStore(vault)
 
 		var secretLabels []string
 		for k, v := range vault.LabelsForVault() {
@@ -960,6 +1397,31 @@ func (usc *UnsealConfig) ToArgs(vault *Vault) []string {
 	return args
 }
 
+// KubernetesKeyStore returns the namespace and the name of the Secret the unseal keys are stored in,
+// if they are stored in a Kubernetes Secret
+func (usc *UnsealConfig) KubernetesKeyStore(vault *Vault) (string, string, bool) {
+	if usc.Google != nil || usc.Azure != nil || usc.AWS != nil || usc.Alibaba != nil || usc.Vault != nil {
+		return "", "", false
+	}
+
+	if usc.HSM != nil {
+		return usc.Kubernetes.SecretNamespace, usc.Kubernetes.SecretName,
+			usc.Kubernetes.SecretNamespace != "" && usc.Kubernetes.SecretName != ""
+	}
+
+	secretNamespace := vault.Namespace
+	if usc.Kubernetes.SecretNamespace != "" {
+		secretNamespace = usc.Kubernetes.SecretNamespace
+	}
+
+	secretName := vault.Name + "-unseal-keys"
+	if usc.Kubernetes.SecretName != "" {
+		secretName = usc.Kubernetes.SecretName
+	}
+
+	return secretNamespace, secretName, true
+}
+
 // HSMDaemonNeeded returns if the unsealing mechanims needs a HSM Daemon present
 func (usc *UnsealConfig) HSMDaemonNeeded() bool {
 	return usc.HSM != nil && usc.HSM.Daemon
@@ -1041,8 +1503,765 @@ type Resources struct {
 	PrometheusExporter *v1.ResourceRequirements `json:"prometheusExporter,omitempty"`
 }
 
+// PodDisruptionBudget of the Vault Pods
+type PodDisruptionBudget struct {
+	// MinAvailable is the count or the percentage of the Vault Pods which have to stay available during
+	// voluntary disruptions, like node drains. With a single Vault Pod the default blocks the drains.
+	// default: the quorum of the cluster (size/2+1)
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+}
+
+// GetPodDisruptionBudgetMinAvailable returns the minAvailable of the PodDisruptionBudget of the Vault Pods
+func (spec *VaultSpec) GetPodDisruptionBudgetMinAvailable() intstr.IntOrString {
+	if spec.PodDisruptionBudget != nil && spec.PodDisruptionBudget.MinAvailable != nil {
+		return *spec.PodDisruptionBudget.MinAvailable
+	}
+	return intstr.FromInt(int(spec.Size)/2 + 1)
+}
+
+// Monitoring specification of the Prometheus Operator and Grafana resources of Vault
+type Monitoring struct {
+	// Labels of the ServiceMonitors, which the serviceMonitorSelector of the Prometheus selects.
+	// default:
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Interval of the scrapes.
+	// default: 30s
+	Interval string `json:"interval,omitempty"`
+
+	// GrafanaDashboards, if it is specified the operator creates a ConfigMap with the Grafana dashboard of Vault
+	// and bank-vaults, which the dashboard sidecar of the Grafana Helm chart loads.
+	// default:
+	GrafanaDashboards *GrafanaDashboards `json:"grafanaDashboards,omitempty"`
+}
+
+// GrafanaDashboards specification of the Grafana dashboard ConfigMap of Vault
+type GrafanaDashboards struct {
+	// Namespace of the ConfigMap, for example the one of Grafana. A ConfigMap in another namespace has
+	// no owner reference, so it has to be deleted manually.
+	// default: the namespace of the Vault
+	Namespace string `json:"namespace,omitempty"`
+
+	// Labels of the ConfigMap, which the dashboard sidecar of Grafana selects.
+	// default: grafana_dashboard: "1"
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// IsServiceMonitorEnabled returns true if the operator creates ServiceMonitors for Vault
+func (spec *VaultSpec) IsServiceMonitorEnabled() bool {
+	return spec.ServiceMonitorEnabled || spec.Monitoring != nil
+}
+
+// GetMonitoringInterval returns the interval of the scrapes of the ServiceMonitors
+func (spec *VaultSpec) GetMonitoringInterval() string {
+	if spec.Monitoring == nil || spec.Monitoring.Interval == "" {
+		return "30s"
+	}
+	return spec.Monitoring.Interval
+}
+
+// GetLabels returns the labels of the Grafana dashboard ConfigMap
+func (g *GrafanaDashboards) GetLabels() map[string]string {
+	if len(g.Labels) == 0 {
+		return map[string]string{"grafana_dashboard": "1"}
+	}
+	return g.Labels
+}
+
+// ConfigurerCanary specification of the validation of the externalConfig before it is applied,
+// the externalConfig is not applied if the validation fails
+type ConfigurerCanary struct {
+	// Namespace is a Vault Enterprise namespace the policies, auth methods, secret engines and namespaces
+	// of the externalConfig are applied to first. The secret engine configs with rotate: true are skipped.
+	// default:
+	Namespace string `json:"namespace,omitempty"`
+
+	// DryRun validates the externalConfig with a dry run first, every section of it has to be evaluated
+	// without errors, this works without Vault Enterprise as well.
+	// default: false
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// ToArgs returns the configure command arguments of the canary
+func (c *ConfigurerCanary) ToArgs() []string {
+	var args []string
+	if c.Namespace != "" {
+		args = append(args, "--configure-canary-namespace", c.Namespace)
+	}
+	if c.DryRun {
+		args = append(args, "--configure-dry-run-validation")
+	}
+	return args
+}
+
+// ServiceMesh configures the Vault Pods and Services for service mesh sidecar injection
+type ServiceMesh struct {
+	// Type of the service mesh, only istio is supported currently.
+	// default: istio
+	Type string `json:"type,omitempty"`
+
+	// ExcludeInboundPorts are the ports of the Vault Pods which bypass the mesh sidecar. Vault terminates
+	// the mutual TLS of the cluster port (request forwarding and Raft) itself, so the sidecar can't proxy it.
+	// default: [8201]
+	ExcludeInboundPorts []int32 `json:"excludeInboundPorts,omitempty"`
+
+	// HoldApplicationUntilProxyStarts makes the Vault and bank-vaults containers wait for the mesh sidecar,
+	// so the unsealer can reach the key store and Vault can join the cluster right after the Pod starts.
+	// default: true
+	HoldApplicationUntilProxyStarts *bool `json:"holdApplicationUntilProxyStarts,omitempty"`
+}
+
+// IsServiceMesh returns true if the Vault Pods run under service mesh sidecar injection
+func (spec *VaultSpec) IsServiceMesh() bool {
+	return spec.IstioEnabled || spec.ServiceMesh != nil
+}
+
+// GetServiceMesh returns the service mesh settings of Vault with the defaults filled in, or nil
+// if Vault doesn't run under a service mesh
+func (spec *VaultSpec) GetServiceMesh() *ServiceMesh {
+	if !spec.IsServiceMesh() {
+		return nil
+	}
+	serviceMesh := ServiceMesh{}
+	if spec.ServiceMesh != nil {
+		serviceMesh = *spec.ServiceMesh.DeepCopy()
+	}
+	if serviceMesh.Type == "" {
+		serviceMesh.Type = ServiceMeshIstio
+	}
+	if len(serviceMesh.ExcludeInboundPorts) == 0 {
+		serviceMesh.ExcludeInboundPorts = []int32{8201}
+	}
+	if serviceMesh.HoldApplicationUntilProxyStarts == nil {
+		hold := true
+		serviceMesh.HoldApplicationUntilProxyStarts = &hold
+	}
+	return &serviceMesh
+}
+
+// ServiceMeshIstio is the Istio service mesh type
+const ServiceMeshIstio = "istio"
+
+// CSIProvider is the Vault provider of the Secrets Store CSI driver, which mounts Vault secrets into Pods
+// without the Vault Agent injector or the webhook
+type CSIProvider struct {
+	// Image is the image of the Vault CSI provider.
+	// default: hashicorp/vault-csi-provider:0.1.0
+	Image string `json:"image,omitempty"`
+
+	// Resources of the Vault CSI provider container.
+	// default:
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector of the Vault CSI provider DaemonSet, it has to match the nodes of the CSI driver.
+	// default:
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the Vault CSI provider DaemonSet.
+	// default:
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// ProvidersDir is the host directory where the Secrets Store CSI driver looks for the provider sockets.
+	// default: /etc/kubernetes/secrets-store-csi-providers
+	ProvidersDir string `json:"providersDir,omitempty"`
+
+	// SecretProviderClasses are generated for this Vault, so the Pods only have to reference them in their CSI volumes.
+	// default:
+	SecretProviderClasses []SecretProviderClassTemplate `json:"secretProviderClasses,omitempty"`
+}
+
+// GetImage returns the image of the Vault CSI provider
+func (csi *CSIProvider) GetImage() string {
+	if csi.Image == "" {
+		return "hashicorp/vault-csi-provider:0.1.0"
+	}
+	return csi.Image
+}
+
+// GetProvidersDir returns the host directory of the CSI provider sockets
+func (csi *CSIProvider) GetProvidersDir() string {
+	if csi.ProvidersDir == "" {
+		return "/etc/kubernetes/secrets-store-csi-providers"
+	}
+	return csi.ProvidersDir
+}
+
+// SecretProviderClassTemplate is the template of a SecretProviderClass reading the secrets from this Vault
+type SecretProviderClassTemplate struct {
+	// Name of the SecretProviderClass.
+	// default:
+	Name string `json:"name"`
+
+	// Namespace of the SecretProviderClass, where the Pods using it run.
+	// default: the namespace of the Vault
+	Namespace string `json:"namespace,omitempty"`
+
+	// Role is the Kubernetes auth role which the CSI provider logs in with, for the ServiceAccount of the Pod.
+	// default:
+	Role string `json:"role"`
+
+	// AuthPath is the mount path of the Kubernetes auth method.
+	// default: kubernetes
+	AuthPath string `json:"authPath,omitempty"`
+
+	// Objects are the secrets mounted as files.
+	// default:
+	Objects []CSISecretObject `json:"objects"`
+}
+
+// GetNamespace returns the namespace of the SecretProviderClass
+func (spc *SecretProviderClassTemplate) GetNamespace(vaultNamespace string) string {
+	if spc.Namespace == "" {
+		return vaultNamespace
+	}
+	return spc.Namespace
+}
+
+// GetAuthPath returns the mount path of the Kubernetes auth method
+func (spc *SecretProviderClassTemplate) GetAuthPath() string {
+	if spc.AuthPath == "" {
+		return "kubernetes"
+	}
+	return spc.AuthPath
+}
+
+// CSISecretObject is a Vault secret key mounted as a file by the CSI driver
+type CSISecretObject struct {
+	// ObjectName is the name of the file.
+	ObjectName string `json:"objectName"`
+
+	// SecretPath is the API path of the secret, for example secret/data/app for KV version 2.
+	SecretPath string `json:"secretPath"`
+
+	// SecretKey is the key in the data of the secret.
+	SecretKey string `json:"secretKey"`
+}
+
 // Ingress specification for the Vault cluster
 type Ingress struct {
 	Annotations map[string]string   `json:"annotations,omitempty"`
 	Spec        v1beta1.IngressSpec `json:"spec,omitempty"`
 }
+
+// AuditLogShipping specification for the Vault cluster. The audit log directory is an emptyDir volume shared with
+// the shipper, configure a file audit device writing to the path in the external config:
+//
+//	audit:
+//	  - type: file
+//	    options:
+//	      file_path: /vault/logs/audit.log
+type AuditLogShipping struct {
+	// Shipper is the log shipper running in the sidecar: vector or fluent-bit.
+	// default: vector
+	Shipper string `json:"shipper,omitempty"`
+
+	// Image of the log shipper.
+	// default: timberio/vector:0.10.0-alpine or fluent/fluent-bit:1.5
+	Image string `json:"image,omitempty"`
+
+	// Path is the audit log file written by the file audit device, it has to be in /vault/logs.
+	// default: /vault/logs/audit.log
+	Path string `json:"path,omitempty"`
+
+	// BufferSize is the size limit of the on-disk buffer, where the logs are kept while the destination is unavailable.
+	// default: 256Mi
+	BufferSize string `json:"bufferSize,omitempty"`
+
+	// Destination the audit logs are delivered to.
+	Destination AuditLogDestination `json:"destination"`
+
+	// Resources of the log shipper container.
+	// default:
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// AuditLogDestination is where the audit logs are shipped to
+type AuditLogDestination struct {
+	// Type of the destination: http, elasticsearch, loki or s3.
+	Type string `json:"type"`
+
+	// Endpoint is the URL of the destination, not used for s3.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Options are added to the sink (Vector) or the output (Fluent Bit) section of the generated configuration as is,
+	// for example the index of Elasticsearch or the bucket and region of S3. Both shippers substitute the
+	// ${ENV_VAR} references, which is how credentials can be referenced from CredentialsSecret.
+	// default:
+	Options map[string]string `json:"options,omitempty"`
+
+	// CredentialsSecret is the name of a Secret whose keys are exposed as environment variables to the log shipper.
+	// default:
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// GetShipper returns the log shipper of the audit logs
+func (s *AuditLogShipping) GetShipper() string {
+	if s.Shipper == "" {
+		return "vector"
+	}
+	return s.Shipper
+}
+
+// GetImage returns the image of the audit log shipper
+func (s *AuditLogShipping) GetImage() string {
+	if s.Image != "" {
+		return s.Image
+	}
+	if s.GetShipper() == "fluent-bit" {
+		return "fluent/fluent-bit:1.5"
+	}
+	return "timberio/vector:0.10.0-alpine"
+}
+
+// GetPath returns the audit log file shipped
+func (s *AuditLogShipping) GetPath() string {
+	if s.Path == "" {
+		return "/vault/logs/audit.log"
+	}
+	return s.Path
+}
+
+// GetBufferSize returns the size limit of the on-disk buffer in bytes
+func (s *AuditLogShipping) GetBufferSize() int64 {
+	size, err := resource.ParseQuantity(s.BufferSize)
+	if err != nil {
+		size = resource.MustParse("256Mi")
+	}
+	return size.Value()
+}
+
+// RBAC specification for the Vault cluster. The Vault ServiceAccount (named after the Vault) may manage the
+// unseal keys Secret and the lock Secrets of the Kubernetes key store, and update its own Pods for the Kubernetes
+// service registration. The configurer ServiceAccount (<name>-configurer) may only read the unseal keys Secret
+// for the root token.
+type RBAC struct {
+	// AuthDelegator binds the system:auth-delegator ClusterRole to the Vault ServiceAccount, which is needed by the
+	// Kubernetes auth method when it reviews the tokens of the clients with the token of Vault.
+	// default: false
+	AuthDelegator bool `json:"authDelegator,omitempty"`
+
+	// VaultRules are added to the Role of the Vault ServiceAccount.
+	// default:
+	VaultRules []rbacv1.PolicyRule `json:"vaultRules,omitempty"`
+
+	// ConfigurerRules are added to the Role of the configurer ServiceAccount, for example to read
+	// the Secrets referenced by the external configuration.
+	// default:
+	ConfigurerRules []rbacv1.PolicyRule `json:"configurerRules,omitempty"`
+}
+
+// StandbyConfig specification of a warm standby Vault cluster, which requires Raft storage and the unsealConfig
+// of the primary, since the restored data is unsealed with the keys of the primary. The snapshots are the ones
+// stored by the backup command of the primary. Credentials of the storage (for example
+// BANK_VAULTS_BACKUP_AZURE_ACCOUNT_KEY) can be passed in sidecarEnvsConfig.
+//
+// Only the first Vault instance is started while it is sealed, the others join it after the failover.
+type StandbyConfig struct {
+	// Period is how often the storage is checked for a new snapshot of the primary.
+	// default: 15m
+	Period string `json:"period,omitempty"`
+
+	SnapshotStorage `json:",inline"`
+}
+
+// ToArgs returns the StandbyConfig as an argument array for the bank-vaults standby command
+func (s *StandbyConfig) ToArgs() []string {
+	args := s.SnapshotStorage.ToArgs()
+
+	if s.Period != "" {
+		args = append(args, "--standby-period", s.Period)
+	}
+
+	return args
+}
+
+// SnapshotStorage is the object storage of the Raft snapshots of the bank-vaults backup command
+type SnapshotStorage struct {
+	// Storage of the snapshots: s3, gcs or azure.
+	Storage string `json:"storage"`
+
+	// Bucket of the snapshots, the container with azure.
+	Bucket string `json:"bucket"`
+
+	// Prefix of the snapshots in the bucket.
+	// default:
+	Prefix string `json:"prefix,omitempty"`
+
+	// Region of the S3 bucket.
+	// default:
+	Region string `json:"region,omitempty"`
+
+	// AzureAccount is the Azure Storage account of the container.
+	// default:
+	AzureAccount string `json:"azureAccount,omitempty"`
+
+	// EncryptionKeySecret selects the base64 encoded AES key the snapshots are encrypted with.
+	// default:
+	EncryptionKeySecret *v1.SecretKeySelector `json:"encryptionKeySecret,omitempty"`
+}
+
+// ToArgs returns the SnapshotStorage as an argument array for the bank-vaults backup commands
+func (s *SnapshotStorage) ToArgs() []string {
+	args := []string{"--backup-storage", s.Storage}
+
+	switch s.Storage {
+	case "s3":
+		args = append(args, "--backup-s3-bucket", s.Bucket, "--backup-s3-prefix", s.Prefix, "--backup-s3-region", s.Region)
+	case "gcs":
+		args = append(args, "--backup-gcs-bucket", s.Bucket, "--backup-gcs-prefix", s.Prefix)
+	case "azure":
+		args = append(args, "--backup-azure-account", s.AzureAccount, "--backup-azure-container", s.Bucket, "--backup-azure-prefix", s.Prefix)
+	}
+
+	return args
+}
+
+// BackupSchedule specification of the scheduled Raft snapshots of Vault, which requires Raft storage. Every run
+// of the CronJob takes a snapshot with the root token from the key store of the unsealConfig, stores it, then
+// prunes the snapshots which are not retained anymore, the latest snapshot is always kept. The stored snapshots
+// can be restored with the bank-vaults restore command, or by a standby Vault.
+type BackupSchedule struct {
+	// Schedule of the snapshots in Cron format.
+	// default: @hourly
+	Schedule string `json:"schedule,omitempty"`
+
+	// Suspend stops taking new snapshots, the stored ones are kept.
+	// default: false
+	Suspend bool `json:"suspend,omitempty"`
+
+	SnapshotStorage `json:",inline"`
+
+	// RetentionCount is how many of the latest snapshots are kept.
+	// default: 0 (no limit)
+	RetentionCount int `json:"retentionCount,omitempty"`
+
+	// RetentionAge is how long the snapshots are kept, for example 720h.
+	// default: (no limit)
+	RetentionAge string `json:"retentionAge,omitempty"`
+
+	// Env of the backup container, for example the credentials of the storage (AWS_ACCESS_KEY_ID or
+	// BANK_VAULTS_BACKUP_AZURE_ACCOUNT_KEY).
+	// default:
+	Env []v1.EnvVar `json:"env,omitempty"`
+
+	// Resources of the backup container.
+	// default:
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// GetSchedule returns the Cron schedule of the snapshots
+func (b *BackupSchedule) GetSchedule() string {
+	if b.Schedule == "" {
+		return "@hourly"
+	}
+	return b.Schedule
+}
+
+// ToArgs returns the BackupSchedule as an argument array for the bank-vaults backup command
+func (b *BackupSchedule) ToArgs() []string {
+	args := b.SnapshotStorage.ToArgs()
+
+	if b.RetentionCount > 0 {
+		args = append(args, "--backup-retention-count", strconv.Itoa(b.RetentionCount))
+	}
+	if b.RetentionAge != "" {
+		args = append(args, "--backup-retention-age", b.RetentionAge)
+	}
+
+	return args
+}
+
+// BackupStatus is the state of the scheduled snapshots of Vault
+type BackupStatus struct {
+	// LastScheduleTime is when the last backup Job was started
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is when the last successful backup Job has finished
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastJob is the name of the last finished backup Job
+	LastJob string `json:"lastJob,omitempty"`
+	// ConsecutiveFailures is the number of the failed backup Jobs since the last successful one (in the Job history)
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+}
+
+// TeamsConfig specification of the teams sharing a KV version 2 mount, every team gets the <mountPath>/<prefix>
+// path prefix, a team-<name> policy granting access to it and a role with the same name in the Kubernetes auth
+// method. The mount and the auth method are added to the externalConfig if they are not declared there, the
+// roles are appended to the ones of the declared auth method.
+type TeamsConfig struct {
+	// MountPath is the path of the KV version 2 mount of the teams.
+	// default: teams
+	MountPath string `json:"mountPath,omitempty"`
+
+	// AuthPath is the path of the Kubernetes auth method the roles of the teams are created in.
+	// default: kubernetes
+	AuthPath string `json:"authPath,omitempty"`
+
+	// TokenTTL is the TTL of the tokens issued by the roles of the teams.
+	// default: 1h
+	TokenTTL string `json:"tokenTTL,omitempty"`
+
+	// Teams is the list of the teams.
+	Teams []Team `json:"teams"`
+}
+
+// Team specification of a team in TeamsConfig
+type Team struct {
+	// Name of the team, the policy and the role of it are named team-<name>.
+	Name string `json:"name"`
+
+	// Prefix is the path prefix of the secrets of the team in the mount.
+	// default: name
+	Prefix string `json:"prefix,omitempty"`
+
+	// Namespaces the ServiceAccounts of the team are bound from.
+	// default: name
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// ServiceAccounts of the team bound to the role.
+	// default: ["*"]
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+
+	// Capabilities granted on the secrets of the team.
+	// default: ["read", "list"]
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// GetMountPath returns the path of the KV mount of the teams
+func (t *TeamsConfig) GetMountPath() string {
+	if t.MountPath == "" {
+		return "teams"
+	}
+	return strings.Trim(t.MountPath, "/")
+}
+
+// GetAuthPath returns the path of the Kubernetes auth method of the teams
+func (t *TeamsConfig) GetAuthPath() string {
+	if t.AuthPath == "" {
+		return "kubernetes"
+	}
+	return strings.Trim(t.AuthPath, "/")
+}
+
+// GetTokenTTL returns the TTL of the tokens issued by the roles of the teams
+func (t *TeamsConfig) GetTokenTTL() string {
+	if t.TokenTTL == "" {
+		return "1h"
+	}
+	return t.TokenTTL
+}
+
+// PolicyName returns the name of the policy and the role of the team
+func (t *Team) PolicyName() string {
+	return "team-" + t.Name
+}
+
+// GetPrefix returns the path prefix of the secrets of the team
+func (t *Team) GetPrefix() string {
+	if t.Prefix == "" {
+		return t.Name
+	}
+	return strings.Trim(t.Prefix, "/")
+}
+
+// GetNamespaces returns the Namespaces the ServiceAccounts of the team are bound from
+func (t *Team) GetNamespaces() []string {
+	if len(t.Namespaces) == 0 {
+		return []string{t.Name}
+	}
+	return t.Namespaces
+}
+
+// GetServiceAccounts returns the ServiceAccounts of the team bound to the role
+func (t *Team) GetServiceAccounts() []string {
+	if len(t.ServiceAccounts) == 0 {
+		return []string{"*"}
+	}
+	return t.ServiceAccounts
+}
+
+// GetCapabilities returns the capabilities granted on the secrets of the team
+func (t *Team) GetCapabilities() []string {
+	if len(t.Capabilities) == 0 {
+		return []string{"read", "list"}
+	}
+	return t.Capabilities
+}
+
+// Rules returns the HCL rules of the policy of the team, the metadata of the secrets can be read
+// and listed, and deleted as well if the team can delete its secrets.
+func (t *Team) Rules(mountPath string) string {
+	metadataCapabilities := []string{"read", "list"}
+	for _, capability := range t.GetCapabilities() {
+		if capability == "delete" {
+			metadataCapabilities = append(metadataCapabilities, "delete")
+			break
+		}
+	}
+
+	quote := func(capabilities []string) string {
+		quoted := make([]string, len(capabilities))
+		for i, capability := range capabilities {
+			quoted[i] = fmt.Sprintf("%q", capability)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	prefix := t.GetPrefix()
+	return fmt.Sprintf("path \"%s/data/%s/*\" {\n  capabilities = [%s]\n}\n", mountPath, prefix, quote(t.GetCapabilities())) +
+		fmt.Sprintf("path \"%s/metadata/%s/*\" {\n  capabilities = [%s]\n}\n", mountPath, prefix, quote(metadataCapabilities))
+}
+
+// Merge returns a copy of the external config with the mount, the policies and the roles of the teams added
+func (t *TeamsConfig) Merge(externalConfig VaultExternalConfig) VaultExternalConfig {
+	config := copyExternalConfig(externalConfig)
+
+	mountPath := t.GetMountPath()
+	authPath := t.GetAuthPath()
+
+	policies, _ := config["policies"].([]interface{})
+	roles := make([]interface{}, 0, len(t.Teams))
+	for i := range t.Teams {
+		team := &t.Teams[i]
+		policies = append(policies, map[string]interface{}{
+			"name":  team.PolicyName(),
+			"rules": team.Rules(mountPath),
+		})
+		roles = append(roles, map[string]interface{}{
+			"name":                             team.PolicyName(),
+			"bound_service_account_names":      team.GetServiceAccounts(),
+			"bound_service_account_namespaces": team.GetNamespaces(),
+			"policies":                         []string{team.PolicyName()},
+			"ttl":                              t.GetTokenTTL(),
+		})
+	}
+	config["policies"] = policies
+
+	secrets, _ := config["secrets"].([]interface{})
+	mounted := false
+	for _, secret := range secrets {
+		if secret, ok := secret.(map[string]interface{}); ok && externalConfigPath(secret) == mountPath {
+			mounted = true
+			break
+		}
+	}
+	if !mounted {
+		secrets = append(secrets, map[string]interface{}{
+			"path":        mountPath,
+			"type":        "kv",
+			"description": "KV secrets of the teams",
+			"options":     map[string]interface{}{"version": 2},
+		})
+	}
+	config["secrets"] = secrets
+
+	// an empty teams list doesn't declare a Kubernetes auth method without roles
+	if len(roles) > 0 {
+		mergeKubernetesRoles(config, authPath, roles)
+	}
+
+	return config
+}
+
+// copyExternalConfig returns a deep copy of the external config
+func copyExternalConfig(externalConfig VaultExternalConfig) VaultExternalConfig {
+	// the external config is copied through JSON, since it is decoded from JSON as well
+	config := VaultExternalConfig{}
+	if raw, err := json.Marshal(externalConfig); err == nil {
+		_ = json.Unmarshal(raw, &config)
+	}
+	if config == nil {
+		config = VaultExternalConfig{}
+	}
+	return config
+}
+
+// externalConfigPath returns the path of a mount or an auth method of the external config, which defaults to its type
+func externalConfigPath(item map[string]interface{}) string {
+	path := cast.ToString(item["path"])
+	if path == "" {
+		path = cast.ToString(item["type"])
+	}
+	return strings.Trim(path, "/")
+}
+
+// kubernetesAuth returns the Kubernetes auth method of the external config at the path, or nil if there is none
+func kubernetesAuth(config VaultExternalConfig, authPath string) map[string]interface{} {
+	auths, _ := config["auth"].([]interface{})
+	for _, auth := range auths {
+		if auth, ok := auth.(map[string]interface{}); ok && cast.ToString(auth["type"]) == "kubernetes" && externalConfigPath(auth) == authPath {
+			return auth
+		}
+	}
+	return nil
+}
+
+// mergeKubernetesRoles appends the roles to the Kubernetes auth method of the external config at the path,
+// the auth method is added if it is not declared
+func mergeKubernetesRoles(config VaultExternalConfig, authPath string, roles []interface{}) {
+	if auth := kubernetesAuth(config, authPath); auth != nil {
+		existingRoles, _ := auth["roles"].([]interface{})
+		auth["roles"] = append(existingRoles, roles...)
+		return
+	}
+
+	auths, _ := config["auth"].([]interface{})
+	config["auth"] = append(auths, map[string]interface{}{
+		"type":  "kubernetes",
+		"path":  authPath,
+		"roles": roles,
+	})
+}
+
+// UpgradeConfig configures the standby-first rollout of the Vault Pods. The StatefulSet uses the OnDelete update
+// strategy, and the operator deletes the outdated standby Pods one at a time, each after the previous one is
+// healthy (ready and unsealed) again. The active Pod is deleted last, it is stepped down by its preStop hook first.
+type UpgradeConfig struct {
+	// PodHealthyTime is how long an upgraded Pod has to be healthy before the next one is upgraded.
+	// default: 30s
+	PodHealthyTime string `json:"podHealthyTime,omitempty"`
+
+	// PauseBeforeLeader is how long to wait after the standby Pods have been upgraded, before the active one.
+	// default: 0s
+	PauseBeforeLeader string `json:"pauseBeforeLeader,omitempty"`
+
+	// ManualLeaderApproval holds the upgrade of the active Pod, until the Vault resource is annotated with
+	// vault.banzaicloud.io/approve-upgrade set to the update revision of the StatefulSet (see status.upgrade).
+	// default: false
+	ManualLeaderApproval bool `json:"manualLeaderApproval,omitempty"`
+}
+
+// GetPodHealthyTime returns how long an upgraded Pod has to be healthy before the next one is upgraded
+func (u *UpgradeConfig) GetPodHealthyTime() time.Duration {
+	return parseDurationOrDefault(u.PodHealthyTime, 30*time.Second, "podHealthyTime")
+}
+
+// GetPauseBeforeLeader returns how long to wait after the standby Pods have been upgraded, before the active one
+func (u *UpgradeConfig) GetPauseBeforeLeader() time.Duration {
+	return parseDurationOrDefault(u.PauseBeforeLeader, 0, "pauseBeforeLeader")
+}
+
+func parseDurationOrDefault(value string, defaultValue time.Duration, field string) time.Duration {
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Error(err, "using default due to parse error", field, value)
+		return defaultValue
+	}
+	return duration
+}
+
+// NetworkPolicy specification for the Vault cluster, the cluster port is always restricted to the Vault Pods
+type NetworkPolicy struct {
+	// APIFrom lists the peers (for example the webhook and the consumer namespaces) allowed to reach the Vault API port,
+	// the Vault and Vault configurer Pods are always allowed. If empty, the API port is open to every peer.
+	APIFrom []networkingv1.NetworkPolicyPeer `json:"apiFrom,omitempty"`
+
+	// MetricsFrom lists the peers allowed to reach the metrics ports. If empty, they are open to every peer.
+	MetricsFrom []networkingv1.NetworkPolicyPeer `json:"metricsFrom,omitempty"`
+
+	// Egress lists the destinations the Vault and Vault configurer Pods may connect to, for example the KMS endpoints,
+	// the storage backend and the Kubernetes API. DNS and the Vault Pods are always allowed. If empty, egress is not restricted.
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
@@ -0,0 +1,163 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// vaultPolicyCapabilities are the capabilities a VaultPolicy may grant, sudo is reserved to the central externalConfig
+var vaultPolicyCapabilities = map[string]bool{
+	"create": true,
+	"read":   true,
+	"update": true,
+	"patch":  true,
+	"delete": true,
+	"list":   true,
+	"deny":   true,
+}
+
+// VaultPolicy is a Vault policy defined in the namespace of an application team, the operator adds it to the
+// externalConfig of the referenced Vault with the name <namespace>-<name>, if the Vault accepts the policies
+// of the namespace (see vaultPolicyNamespaces)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+type VaultPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VaultPolicySpec   `json:"spec,omitempty"`
+	Status VaultPolicyStatus `json:"status,omitempty"`
+}
+
+// VaultPolicyList contains a list of VaultPolicy
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type VaultPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VaultPolicy `json:"items"`
+}
+
+// VaultPolicySpec defines the desired state of VaultPolicy
+type VaultPolicySpec struct {
+	// VaultRef selects the Vault the policy is written to.
+	VaultRef VaultReference `json:"vaultRef"`
+
+	// Rules are the HCL rules of the policy.
+	Rules string `json:"rules"`
+}
+
+// VaultReference selects a Vault resource
+type VaultReference struct {
+	// Name of the Vault resource.
+	Name string `json:"name"`
+
+	// Namespace of the Vault resource.
+	// default: the namespace of the referencing resource
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// VaultPolicyStatus defines the observed state of VaultPolicy
+type VaultPolicyStatus struct {
+	// PolicyName is the name of the policy in Vault.
+	PolicyName string `json:"policyName,omitempty"`
+
+	// Error is set if the policy is not accepted by the referenced Vault.
+	Error string `json:"error,omitempty"`
+}
+
+// GetVaultNamespace returns the namespace of the referenced Vault
+func (p *VaultPolicy) GetVaultNamespace() string {
+	if p.Spec.VaultRef.Namespace == "" {
+		return p.Namespace
+	}
+	return p.Spec.VaultRef.Namespace
+}
+
+// PolicyName returns the name of the policy in Vault, which is scoped by the namespace of the VaultPolicy
+func (p *VaultPolicy) PolicyName() string {
+	return p.Namespace + "-" + p.Name
+}
+
+// Validate checks that the rules of the policy can be parsed, and only grant the allowed capabilities
+func (p *VaultPolicy) Validate() error {
+	var rules struct {
+		Path map[string]struct {
+			Capabilities []string `hcl:"capabilities"`
+		} `hcl:"path"`
+	}
+	if err := hcl.Decode(&rules, p.Spec.Rules); err != nil {
+		return fmt.Errorf("invalid rules: %v", err)
+	}
+	if len(rules.Path) == 0 {
+		return fmt.Errorf("the rules have no paths")
+	}
+	for path, rule := range rules.Path {
+		for _, capability := range rule.Capabilities {
+			if !vaultPolicyCapabilities[capability] {
+				return fmt.Errorf("capability %q of path %q is not allowed", capability, path)
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptsVaultPolicies checks if the Vault accepts the VaultPolicies of the namespace
+func (spec *VaultSpec) AcceptsVaultPolicies(namespace string) bool {
+	for _, allowed := range spec.VaultPolicyNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeVaultPolicies returns a copy of the external config with the VaultPolicies added, the policies with the
+// name of a policy which is already in the external config are returned as conflicting, without adding them
+func MergeVaultPolicies(externalConfig VaultExternalConfig, vaultPolicies []VaultPolicy) (VaultExternalConfig, []VaultPolicy) {
+	config := copyExternalConfig(externalConfig)
+
+	policies, _ := config["policies"].([]interface{})
+	names := map[string]bool{}
+	for _, policy := range policies {
+		if policy, ok := policy.(map[string]interface{}); ok {
+			names[fmt.Sprint(policy["name"])] = true
+		}
+	}
+
+	var conflicting []VaultPolicy
+	for _, p := range vaultPolicies {
+		name := p.PolicyName()
+		if names[name] {
+			conflicting = append(conflicting, p)
+			continue
+		}
+		names[name] = true
+		policies = append(policies, map[string]interface{}{
+			"name":  name,
+			"rules": p.Spec.Rules,
+		})
+	}
+	if len(policies) > 0 {
+		config["policies"] = policies
+	}
+
+	return config, conflicting
+}
@@ -0,0 +1,200 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VaultRole is a Kubernetes auth role requested by an application team in its own namespace, bound to
+// ServiceAccounts of the namespace. The operator adds it to the externalConfig of the referenced Vault with
+// the name <namespace>-<name>, if the Vault accepts the roles of the namespace and the policies of the role
+// (see vaultRoleNamespaces)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+type VaultRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VaultRoleSpec   `json:"spec,omitempty"`
+	Status VaultRoleStatus `json:"status,omitempty"`
+}
+
+// VaultRoleList contains a list of VaultRole
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type VaultRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VaultRole `json:"items"`
+}
+
+// VaultRoleSpec defines the desired state of VaultRole
+type VaultRoleSpec struct {
+	// VaultRef selects the Vault the role is written to.
+	VaultRef VaultReference `json:"vaultRef"`
+
+	// AuthPath is the path of the Kubernetes auth method the role is created in.
+	// default: kubernetes
+	AuthPath string `json:"authPath,omitempty"`
+
+	// ServiceAccounts are the names of the ServiceAccounts in the namespace of the VaultRole bound to the role,
+	// "*" binds every ServiceAccount of the namespace.
+	ServiceAccounts []string `json:"serviceAccounts"`
+
+	// Policies are the policies the tokens of the role are granted.
+	Policies []string `json:"policies"`
+
+	// TokenTTL is the TTL of the tokens issued by the role.
+	// default: the TTL of the auth method
+	TokenTTL string `json:"tokenTTL,omitempty"`
+
+	// TokenMaxTTL is the maximum TTL of the tokens issued by the role.
+	// default: the maximum TTL of the auth method
+	TokenMaxTTL string `json:"tokenMaxTTL,omitempty"`
+}
+
+// VaultRoleStatus defines the observed state of VaultRole
+type VaultRoleStatus struct {
+	// RoleName is the name of the role in Vault.
+	RoleName string `json:"roleName,omitempty"`
+
+	// Error is set if the role is not accepted by the referenced Vault.
+	Error string `json:"error,omitempty"`
+}
+
+// VaultRoleNamespace allows the VaultRole resources of a Namespace to be granted policies with the prefixes
+type VaultRoleNamespace struct {
+	// Namespace the VaultRoles are accepted from, "*" accepts them from every Namespace.
+	Namespace string `json:"namespace"`
+
+	// PolicyPrefixes are the prefixes of the policies the roles may be granted, besides the VaultPolicies
+	// of the Namespace (<namespace>-), "*" allows every policy.
+	// default:
+	PolicyPrefixes []string `json:"policyPrefixes,omitempty"`
+}
+
+// GetVaultNamespace returns the namespace of the referenced Vault
+func (r *VaultRole) GetVaultNamespace() string {
+	if r.Spec.VaultRef.Namespace == "" {
+		return r.Namespace
+	}
+	return r.Spec.VaultRef.Namespace
+}
+
+// GetAuthPath returns the path of the Kubernetes auth method the role is created in
+func (r *VaultRole) GetAuthPath() string {
+	if r.Spec.AuthPath == "" {
+		return "kubernetes"
+	}
+	return strings.Trim(r.Spec.AuthPath, "/")
+}
+
+// RoleName returns the name of the role in Vault, which is scoped by the namespace of the VaultRole
+func (r *VaultRole) RoleName() string {
+	return r.Namespace + "-" + r.Name
+}
+
+// PolicyPrefixes returns the prefixes of the policies the VaultRoles of the namespace may be granted,
+// or false if the Vault doesn't accept the VaultRoles of the namespace
+func (spec *VaultSpec) PolicyPrefixes(namespace string) ([]string, bool) {
+	var prefixes []string
+	accepted := false
+	for _, allowed := range spec.VaultRoleNamespaces {
+		if allowed.Namespace == "*" || allowed.Namespace == namespace {
+			accepted = true
+			prefixes = append(prefixes, allowed.PolicyPrefixes...)
+		}
+	}
+	if !accepted {
+		return nil, false
+	}
+	return append(prefixes, namespace+"-"), true
+}
+
+// Validate checks that the role binds ServiceAccounts and grants policies, and the policies have one of the prefixes
+func (r *VaultRole) Validate(policyPrefixes []string) error {
+	if len(r.Spec.ServiceAccounts) == 0 {
+		return fmt.Errorf("the role binds no ServiceAccounts")
+	}
+	if len(r.Spec.Policies) == 0 {
+		return fmt.Errorf("the role grants no policies")
+	}
+	for _, policy := range r.Spec.Policies {
+		allowed := false
+		for _, prefix := range policyPrefixes {
+			if prefix == "*" || strings.HasPrefix(policy, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("policy %q is not allowed for the roles of namespace %s", policy, r.Namespace)
+		}
+	}
+	return nil
+}
+
+// MergeVaultRoles returns a copy of the external config with the VaultRoles added to their Kubernetes auth methods,
+// the roles with the name of a role which is already in the auth method are returned as conflicting, without adding them
+func MergeVaultRoles(externalConfig VaultExternalConfig, vaultRoles []VaultRole) (VaultExternalConfig, []VaultRole) {
+	config := copyExternalConfig(externalConfig)
+
+	names := map[string]map[string]bool{}
+	namesOf := func(authPath string) map[string]bool {
+		if names[authPath] == nil {
+			names[authPath] = map[string]bool{}
+			if auth := kubernetesAuth(config, authPath); auth != nil {
+				roles, _ := auth["roles"].([]interface{})
+				for _, role := range roles {
+					names[authPath][cast.ToString(cast.ToStringMap(role)["name"])] = true
+				}
+			}
+		}
+		return names[authPath]
+	}
+
+	var conflicting []VaultRole
+	for _, r := range vaultRoles {
+		authPath := r.GetAuthPath()
+		existing := namesOf(authPath)
+		if existing[r.RoleName()] {
+			conflicting = append(conflicting, r)
+			continue
+		}
+		existing[r.RoleName()] = true
+
+		role := map[string]interface{}{
+			"name":                             r.RoleName(),
+			"bound_service_account_names":      r.Spec.ServiceAccounts,
+			"bound_service_account_namespaces": []string{r.Namespace},
+			"policies":                         r.Spec.Policies,
+		}
+		if r.Spec.TokenTTL != "" {
+			role["ttl"] = r.Spec.TokenTTL
+		}
+		if r.Spec.TokenMaxTTL != "" {
+			role["max_ttl"] = r.Spec.TokenMaxTTL
+		}
+		mergeKubernetesRoles(config, authPath, []interface{}{role})
+	}
+
+	return config, conflicting
+}
@@ -0,0 +1,286 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VaultSecretEngineFinalizer makes the operator record the path of a deleted VaultSecretEngine with unmountOnDelete,
+// so the secret engine is disabled by the configurer
+const VaultSecretEngineFinalizer = "vault.banzaicloud.com/unmount"
+
+// VaultSecretEngineAccepted is the condition of a VaultSecretEngine merged into the externalConfig of its Vault
+const VaultSecretEngineAccepted VaultSecretEngineConditionType = "Accepted"
+
+// VaultSecretEngine is a secret engine (e.g. kv, database, pki or transit) mounted and tuned in the referenced Vault,
+// outside of its externalConfig. The operator adds it to the secrets of the externalConfig, if the Vault accepts
+// the VaultSecretEngines of the namespace (see vaultSecretEngineNamespaces)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+type VaultSecretEngine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VaultSecretEngineSpec   `json:"spec,omitempty"`
+	Status VaultSecretEngineStatus `json:"status,omitempty"`
+}
+
+// VaultSecretEngineList contains a list of VaultSecretEngine
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type VaultSecretEngineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VaultSecretEngine `json:"items"`
+}
+
+// VaultSecretEngineSpec defines the desired state of VaultSecretEngine, the fields are the ones of the secrets
+// of the externalConfig
+type VaultSecretEngineSpec struct {
+	// VaultRef selects the Vault the secret engine is mounted in.
+	VaultRef VaultReference `json:"vaultRef"`
+
+	// Type of the secret engine, e.g. kv, database, pki or transit.
+	Type string `json:"type"`
+
+	// Path the secret engine is mounted at.
+	// default: the type
+	Path string `json:"path,omitempty"`
+
+	// Description of the mount.
+	// default:
+	Description string `json:"description,omitempty"`
+
+	// PluginName of the secret engine, for plugins.
+	// default:
+	PluginName string `json:"pluginName,omitempty"`
+
+	// Local mounts are not replicated.
+	// default: false
+	Local bool `json:"local,omitempty"`
+
+	// SealWrap enables seal wrapping of the mount.
+	// default: false
+	SealWrap bool `json:"sealWrap,omitempty"`
+
+	// Options of the mount, e.g. the version of kv.
+	// default:
+	Options map[string]string `json:"options,omitempty"`
+
+	// Config is the tuning of the mount, e.g. default_lease_ttl and max_lease_ttl.
+	// default:
+	Config VaultExternalConfig `json:"config,omitempty"`
+
+	// Configuration is written to the endpoints of the secret engine, e.g. the roles, like in the externalConfig.
+	// default:
+	Configuration VaultExternalConfig `json:"configuration,omitempty"`
+
+	// UnmountOnDelete disables the secret engine when the VaultSecretEngine is deleted, which deletes its data.
+	// default: false
+	UnmountOnDelete bool `json:"unmountOnDelete,omitempty"`
+}
+
+// VaultSecretEngineConditionType is the type of the conditions of a VaultSecretEngine
+type VaultSecretEngineConditionType string
+
+// VaultSecretEngineCondition is a condition of a VaultSecretEngine
+type VaultSecretEngineCondition struct {
+	Type               VaultSecretEngineConditionType `json:"type"`
+	Status             v1.ConditionStatus             `json:"status"`
+	LastTransitionTime metav1.Time                    `json:"lastTransitionTime,omitempty"`
+	Message            string                         `json:"message,omitempty"`
+}
+
+// VaultSecretEngineStatus defines the observed state of VaultSecretEngine
+type VaultSecretEngineStatus struct {
+	// Path the secret engine is mounted at.
+	Path string `json:"path,omitempty"`
+
+	Conditions []VaultSecretEngineCondition `json:"conditions,omitempty"`
+}
+
+// GetVaultNamespace returns the namespace of the referenced Vault
+func (e *VaultSecretEngine) GetVaultNamespace() string {
+	if e.Spec.VaultRef.Namespace == "" {
+		return e.Namespace
+	}
+	return e.Spec.VaultRef.Namespace
+}
+
+// GetPath returns the path the secret engine is mounted at
+func (e *VaultSecretEngine) GetPath() string {
+	if e.Spec.Path == "" {
+		return e.Spec.Type
+	}
+	return strings.Trim(e.Spec.Path, "/")
+}
+
+// HasFinalizer checks if the VaultSecretEngine has the finalizer of the operator
+func (e *VaultSecretEngine) HasFinalizer() bool {
+	for _, finalizer := range e.Finalizers {
+		if finalizer == VaultSecretEngineFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFinalizer adds or removes the finalizer of the operator, it returns true if the finalizers have changed
+func (e *VaultSecretEngine) SetFinalizer(enabled bool) bool {
+	if e.HasFinalizer() == enabled {
+		return false
+	}
+	if enabled {
+		e.Finalizers = append(e.Finalizers, VaultSecretEngineFinalizer)
+		return true
+	}
+	finalizers := make([]string, 0, len(e.Finalizers))
+	for _, finalizer := range e.Finalizers {
+		if finalizer != VaultSecretEngineFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	e.Finalizers = finalizers
+	return true
+}
+
+// Validate checks that the type of the secret engine is set
+func (e *VaultSecretEngine) Validate() error {
+	if e.Spec.Type == "" {
+		return fmt.Errorf("the type of the secret engine is not set")
+	}
+	return nil
+}
+
+// SetCondition sets the condition of the VaultSecretEngine, it returns true if the condition has changed
+func (s *VaultSecretEngineStatus) SetCondition(conditionType VaultSecretEngineConditionType, err error) bool {
+	condition := VaultSecretEngineCondition{Type: conditionType, Status: v1.ConditionTrue}
+	if err != nil {
+		condition.Status = v1.ConditionFalse
+		condition.Message = err.Error()
+	}
+
+	for i := range s.Conditions {
+		existing := &s.Conditions[i]
+		if existing.Type != conditionType {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Message == condition.Message {
+			return false
+		}
+		condition.LastTransitionTime = metav1.Now()
+		*existing = condition
+		return true
+	}
+
+	condition.LastTransitionTime = metav1.Now()
+	s.Conditions = append(s.Conditions, condition)
+	return true
+}
+
+// AcceptsVaultSecretEngines checks if the Vault accepts the VaultSecretEngines of the namespace,
+// the ones in the namespace of the Vault are always accepted
+func (v *Vault) AcceptsVaultSecretEngines(namespace string) bool {
+	if namespace == v.Namespace {
+		return true
+	}
+	for _, allowed := range v.Spec.VaultSecretEngineNamespaces {
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// secret returns the VaultSecretEngine as an item of the secrets of the externalConfig
+func (e *VaultSecretEngine) secret() map[string]interface{} {
+	secret := map[string]interface{}{
+		"type": e.Spec.Type,
+		"path": e.GetPath(),
+	}
+	if e.Spec.Description != "" {
+		secret["description"] = e.Spec.Description
+	}
+	if e.Spec.PluginName != "" {
+		secret["plugin_name"] = e.Spec.PluginName
+	}
+	if e.Spec.Local {
+		secret["local"] = true
+	}
+	if e.Spec.SealWrap {
+		secret["seal_wrap"] = true
+	}
+	if len(e.Spec.Options) > 0 {
+		options := map[string]interface{}{}
+		for key, value := range e.Spec.Options {
+			options[key] = value
+		}
+		secret["options"] = options
+	}
+	if len(e.Spec.Config) > 0 {
+		secret["config"] = map[string]interface{}(copyExternalConfig(e.Spec.Config))
+	}
+	if len(e.Spec.Configuration) > 0 {
+		secret["configuration"] = map[string]interface{}(copyExternalConfig(e.Spec.Configuration))
+	}
+	return secret
+}
+
+// MergeVaultSecretEngines returns a copy of the external config with the VaultSecretEngines added to the secrets,
+// and the removed paths to the removedSecrets. The secret engines with the path of a secret engine which is
+// already in the external config are returned as conflicting, without adding them.
+func MergeVaultSecretEngines(externalConfig VaultExternalConfig, secretEngines []VaultSecretEngine, removedPaths []string) (VaultExternalConfig, []VaultSecretEngine) {
+	config := copyExternalConfig(externalConfig)
+
+	secrets, _ := config["secrets"].([]interface{})
+	paths := map[string]bool{}
+	for _, secret := range secrets {
+		if secret, ok := secret.(map[string]interface{}); ok {
+			paths[externalConfigPath(secret)] = true
+		}
+	}
+
+	var conflicting []VaultSecretEngine
+	for i := range secretEngines {
+		e := &secretEngines[i]
+		if paths[e.GetPath()] {
+			conflicting = append(conflicting, *e)
+			continue
+		}
+		paths[e.GetPath()] = true
+		secrets = append(secrets, e.secret())
+	}
+	if len(secrets) > 0 {
+		config["secrets"] = secrets
+	}
+
+	removed, _ := config["removedSecrets"].([]interface{})
+	for _, path := range removedPaths {
+		if !paths[path] {
+			removed = append(removed, path)
+		}
+	}
+	if len(removed) > 0 {
+		config["removedSecrets"] = removed
+	}
+
+	return config, conflicting
+}
@@ -0,0 +1,272 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+const (
+	auditLogShipperConfigPath = "/etc/auditlog-shipper"
+	auditLogBufferPath        = "/var/lib/auditlog-shipper"
+)
+
+// auditLogSinkTypes are the sink (Vector) and output (Fluent Bit) types of the audit log destinations
+var auditLogSinkTypes = map[string]map[string]string{
+	"vector":     {"http": "http", "elasticsearch": "elasticsearch", "loki": "loki", "s3": "aws_s3"},
+	"fluent-bit": {"http": "http", "elasticsearch": "es", "loki": "loki", "s3": "s3"},
+}
+
+func auditLogShipperConfigFile(shipping *vaultv1alpha1.AuditLogShipping) string {
+	if shipping.GetShipper() == "fluent-bit" {
+		return "fluent-bit.conf"
+	}
+	return "vector.toml"
+}
+
+// sortedOptions returns the options of the destination sorted by their keys, for a stable configuration
+func sortedOptions(options map[string]string) []string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tomlValue quotes the value unless it is a number or a bool
+func tomlValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	if value == "true" || value == "false" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func vectorConfig(shipping *vaultv1alpha1.AuditLogShipping, sinkType string) string {
+	destination := shipping.Destination
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "data_dir = %q\n\n", auditLogBufferPath)
+	b.WriteString("[sources.vault_audit]\n")
+	b.WriteString("  type = \"file\"\n")
+	fmt.Fprintf(&b, "  include = [%q]\n", shipping.GetPath())
+	// audit entries with large request or response bodies
+	b.WriteString("  max_line_bytes = 1048576\n\n")
+	b.WriteString("[sinks.destination]\n")
+	fmt.Fprintf(&b, "  type = %q\n", sinkType)
+	b.WriteString("  inputs = [\"vault_audit\"]\n")
+
+	switch destination.Type {
+	case "http":
+		fmt.Fprintf(&b, "  uri = %q\n", destination.Endpoint)
+		b.WriteString("  encoding.codec = \"text\"\n")
+	case "elasticsearch":
+		fmt.Fprintf(&b, "  endpoint = %q\n", destination.Endpoint)
+	case "loki":
+		fmt.Fprintf(&b, "  endpoint = %q\n", destination.Endpoint)
+		b.WriteString("  encoding.codec = \"text\"\n")
+		b.WriteString("  labels.source = \"vault-audit\"\n")
+	case "s3":
+		b.WriteString("  encoding.codec = \"text\"\n")
+	}
+
+	b.WriteString("  buffer.type = \"disk\"\n")
+	fmt.Fprintf(&b, "  buffer.max_size = %d\n", shipping.GetBufferSize())
+	b.WriteString("  buffer.when_full = \"block\"\n")
+
+	for _, key := range sortedOptions(destination.Options) {
+		fmt.Fprintf(&b, "  %s = %s\n", key, tomlValue(destination.Options[key]))
+	}
+
+	return b.String()
+}
+
+func fluentBitConfig(shipping *vaultv1alpha1.AuditLogShipping, outputType string) (string, error) {
+	destination := shipping.Destination
+
+	var b strings.Builder
+	b.WriteString("[SERVICE]\n")
+	b.WriteString("    Flush        5\n")
+	fmt.Fprintf(&b, "    storage.path %s\n\n", auditLogBufferPath)
+	b.WriteString("[INPUT]\n")
+	b.WriteString("    Name         tail\n")
+	fmt.Fprintf(&b, "    Path         %s\n", shipping.GetPath())
+	fmt.Fprintf(&b, "    DB           %s/audit.db\n", auditLogBufferPath)
+	b.WriteString("    Buffer_Max_Size 1M\n")
+	b.WriteString("    storage.type filesystem\n\n")
+	b.WriteString("[OUTPUT]\n")
+	fmt.Fprintf(&b, "    Name         %s\n", outputType)
+	b.WriteString("    Match        *\n")
+	fmt.Fprintf(&b, "    storage.total_limit_size %d\n", shipping.GetBufferSize())
+	b.WriteString("    Retry_Limit  False\n")
+
+	if destination.Type != "s3" {
+		endpoint, err := url.Parse(destination.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return "", fmt.Errorf("invalid audit log destination endpoint: %q", destination.Endpoint)
+		}
+
+		port := endpoint.Port()
+		if port == "" {
+			port = "80"
+			if endpoint.Scheme == "https" {
+				port = "443"
+			}
+		}
+
+		fmt.Fprintf(&b, "    Host         %s\n", endpoint.Hostname())
+		fmt.Fprintf(&b, "    Port         %s\n", port)
+		if endpoint.Scheme == "https" {
+			b.WriteString("    tls          On\n")
+		}
+		if destination.Type == "http" && endpoint.Path != "" {
+			fmt.Fprintf(&b, "    URI          %s\n", endpoint.RequestURI())
+		}
+		if destination.Type == "loki" {
+			b.WriteString("    Labels       source=vault-audit\n")
+		}
+	}
+
+	for _, key := range sortedOptions(destination.Options) {
+		fmt.Fprintf(&b, "    %s %s\n", key, destination.Options[key])
+	}
+
+	return b.String(), nil
+}
+
+// configMapForAuditLogShipping returns the ConfigMap with the generated configuration of the audit log shipper
+func configMapForAuditLogShipping(v *vaultv1alpha1.Vault) (*corev1.ConfigMap, error) {
+	shipping := v.Spec.AuditLogShipping
+
+	sinkTypes, ok := auditLogSinkTypes[shipping.GetShipper()]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit log shipper: %s", shipping.GetShipper())
+	}
+
+	sinkType, ok := sinkTypes[shipping.Destination.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit log destination type: %s", shipping.Destination.Type)
+	}
+
+	if !strings.HasPrefix(shipping.GetPath(), "/vault/logs/") {
+		return nil, fmt.Errorf("audit log path has to be in /vault/logs: %s", shipping.GetPath())
+	}
+
+	var config string
+	if shipping.GetShipper() == "fluent-bit" {
+		var err error
+		config, err = fluentBitConfig(shipping, sinkType)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		config = vectorConfig(shipping, sinkType)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.Name + "-auditlog-shipper-config",
+			Namespace: v.Namespace,
+			Labels:    v.LabelsForVault(),
+		},
+		Data: map[string]string{auditLogShipperConfigFile(shipping): config},
+	}
+	return cm, nil
+}
+
+func withAuditLogShippingVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	if v.Spec.IsAuditLogShippingEnabled() {
+		volumes = append(volumes, []corev1.Volume{
+			{
+				Name: "auditlog-shipper-config",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: v.Name + "-auditlog-shipper-config",
+						},
+					},
+				},
+			},
+			{
+				Name: "auditlog-buffer",
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			},
+		}...)
+	}
+	return volumes
+}
+
+func withAuditLogShippingContainer(v *vaultv1alpha1.Vault, containers []corev1.Container) []corev1.Container {
+	if !v.Spec.IsAuditLogShippingEnabled() {
+		return containers
+	}
+
+	shipping := v.Spec.AuditLogShipping
+	configFile := auditLogShipperConfigPath + "/" + auditLogShipperConfigFile(shipping)
+
+	container := corev1.Container{
+		Image:           shipping.GetImage(),
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Name:            "auditlog-shipper",
+		Args:            []string{"--config", configFile},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "vault-auditlogs",
+				MountPath: "/vault/logs",
+				ReadOnly:  true,
+			},
+			{
+				Name:      "auditlog-shipper-config",
+				MountPath: auditLogShipperConfigPath,
+			},
+			{
+				Name:      "auditlog-buffer",
+				MountPath: auditLogBufferPath,
+			},
+		},
+	}
+
+	if shipping.GetShipper() == "fluent-bit" {
+		container.Command = []string{"/fluent-bit/bin/fluent-bit"}
+	}
+
+	if shipping.Destination.CredentialsSecret != "" {
+		container.EnvFrom = []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: shipping.Destination.CredentialsSecret},
+			},
+		}}
+	}
+
+	if shipping.Resources != nil {
+		container.Resources = *shipping.Resources
+	}
+
+	return append(containers, container)
+}
@@ -0,0 +1,215 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+func backupCronJobName(v *vaultv1alpha1.Vault) string {
+	return fmt.Sprintf("%s-backup", v.Name)
+}
+
+// validateBackupSchedule checks the backup schedule of Vault
+func validateBackupSchedule(v *vaultv1alpha1.Vault) error {
+	backup := v.Spec.Backup
+	if !v.Spec.IsRaftStorage() {
+		return fmt.Errorf("the snapshots require raft storage")
+	}
+	switch backup.Storage {
+	case "s3", "gcs", "azure":
+	default:
+		return fmt.Errorf("unsupported snapshot storage: '%s'", backup.Storage)
+	}
+	if backup.Bucket == "" {
+		return fmt.Errorf("the bucket of the snapshots is required")
+	}
+	return nil
+}
+
+// cronJobForBackup returns the CronJob which runs the bank-vaults backup command against the active Vault
+// instance on the schedule, with the root token from the key store (like the configurer)
+func cronJobForBackup(v *vaultv1alpha1.Vault) *batchv1beta1.CronJob {
+	backup := v.Spec.Backup
+	ls := v.LabelsForVaultBackup()
+
+	env := withTLSEnv(v, false, withCredentialsEnv(v, withCommonEnv(v, []corev1.EnvVar{})))
+	if backup.EncryptionKeySecret != nil {
+		env = append(env, corev1.EnvVar{
+			Name: "BANK_VAULTS_BACKUP_ENCRYPTION_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: backup.EncryptionKeySecret,
+			},
+		})
+	}
+	env = append(env, backup.Env...)
+
+	resources := getBankVaultsResource(v)
+	if backup.Resources != nil {
+		resources = backup.Resources
+	}
+
+	podSpec := corev1.PodSpec{
+		ServiceAccountName:           configurerServiceAccount(v),
+		AutomountServiceAccountToken: pointer.BoolPtr(true),
+		RestartPolicy:                corev1.RestartPolicyNever,
+
+		Containers: []corev1.Container{
+			{
+				Image:           v.Spec.GetBankVaultsImage(),
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Name:            "bank-vaults",
+				Command:         []string{"bank-vaults", "backup"},
+				Args:            append(v.Spec.UnsealConfig.ToArgs(v), backup.ToArgs()...),
+				Env:             env,
+				VolumeMounts:    withServiceAccountTokenVolumeMounts(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{}))),
+				Resources:       *resources,
+			},
+		},
+		Volumes:         withServiceAccountTokenVolumes(v, withTLSVolume(v, withCredentialsVolume(v, []corev1.Volume{}))),
+		SecurityContext: withPodSecurityContext(v),
+		NodeSelector:    v.Spec.NodeSelector,
+		Tolerations:     v.Spec.Tolerations,
+	}
+
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        backupCronJobName(v),
+			Namespace:   v.Namespace,
+			Annotations: getCommonAnnotations(v, map[string]string{}),
+			Labels:      ls,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: backup.GetSchedule(),
+			Suspend:  pointer.BoolPtr(backup.Suspend),
+			// a snapshot is taken of the whole storage, a running one makes the next one pointless
+			ConcurrencyPolicy:          batchv1beta1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: pointer.Int32Ptr(3),
+			FailedJobsHistoryLimit:     pointer.Int32Ptr(3),
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: ls,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: pointer.Int32Ptr(2),
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels:      ls,
+							Annotations: getCommonAnnotations(v, map[string]string{}),
+						},
+						Spec: podSpec,
+					},
+				},
+			},
+		},
+	}
+}
+
+// jobFinished returns the type of the condition which finished the Job (Complete or Failed) and its message,
+// or an empty type if the Job is still running
+func jobFinished(job *batchv1.Job) (batchv1.JobConditionType, string) {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return c.Type, c.Message
+		}
+	}
+	return "", ""
+}
+
+// backupStatusForVault returns the state of the scheduled snapshots and the BackupSucceeded condition,
+// from the CronJob and the backup Jobs kept in its history
+func (r *ReconcileVault) backupStatusForVault(v *vaultv1alpha1.Vault) (*vaultv1alpha1.BackupStatus, corev1.ComponentCondition) {
+	conditionType := vaultv1alpha1.VaultBackupSucceeded
+	status := &vaultv1alpha1.BackupStatus{}
+	if v.Status.Backup != nil {
+		status.LastSuccessfulTime = v.Status.Backup.LastSuccessfulTime
+	}
+
+	cronJob := &batchv1beta1.CronJob{}
+	err := r.client.Get(context.TODO(), client.ObjectKey{Namespace: v.Namespace, Name: backupCronJobName(v)}, cronJob)
+	if err != nil {
+		return v.Status.Backup, unknownCondition(conditionType, err.Error())
+	}
+	status.LastScheduleTime = cronJob.Status.LastScheduleTime
+
+	jobs := &batchv1.JobList{}
+	err = r.client.List(context.TODO(), jobs, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultBackup()),
+		Namespace:     v.Namespace,
+	})
+	if err != nil {
+		return v.Status.Backup, unknownCondition(conditionType, err.Error())
+	}
+
+	// from the newest to the oldest
+	sort.Slice(jobs.Items, func(i, j int) bool {
+		return jobs.Items[j].CreationTimestamp.Before(&jobs.Items[i].CreationTimestamp)
+	})
+
+	condition := corev1.ComponentCondition{Type: conditionType, Status: corev1.ConditionUnknown, Message: "no backup job has finished yet"}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		finished, message := jobFinished(job)
+		if finished == "" {
+			continue
+		}
+
+		if status.LastJob == "" {
+			status.LastJob = job.Name
+			if finished == batchv1.JobComplete {
+				condition = statusCondition(conditionType, true, "")
+			} else {
+				condition = statusCondition(conditionType, false, fmt.Sprintf("backup job %s failed: %s", job.Name, message))
+			}
+		}
+
+		if finished == batchv1.JobComplete {
+			if status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(job.Status.CompletionTime) {
+				status.LastSuccessfulTime = job.Status.CompletionTime
+			}
+			break
+		}
+		status.ConsecutiveFailures++
+	}
+
+	return status, condition
+}
+
+// backupEvents records an event when a backup starts failing, and when it succeeds again
+func (r *ReconcileVault) backupEvents(v *vaultv1alpha1.Vault, previous []corev1.ComponentCondition, current corev1.ComponentCondition) {
+	if r.recorder == nil {
+		return
+	}
+
+	before := findCondition(previous, vaultv1alpha1.VaultBackupSucceeded)
+	switch {
+	case current.Status == corev1.ConditionFalse && (before == nil || before.Message != current.Message):
+		r.recorder.Event(v, corev1.EventTypeWarning, "BackupFailed", current.Message)
+	case current.Status == corev1.ConditionTrue && before != nil && before.Status == corev1.ConditionFalse:
+		r.recorder.Event(v, corev1.EventTypeNormal, "BackupSucceeded", "the snapshot has been stored")
+	}
+}
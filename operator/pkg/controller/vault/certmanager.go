@@ -0,0 +1,101 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// certificateGVK is the cert-manager Certificate, the operator doesn't depend on the cert-manager API types
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1alpha2", Kind: "Certificate"}
+
+// certManagerCertificateNameAnnotation is set by cert-manager on the Secrets it issues into
+const certManagerCertificateNameAnnotation = "cert-manager.io/certificate-name"
+
+// certificateForVault returns the cert-manager Certificate which issues the TLS Secret of Vault
+func certificateForVault(v *vaultv1alpha1.Vault, service *corev1.Service) *unstructured.Unstructured {
+	config := v.Spec.TLS.CertManager
+
+	var dnsNames, ipAddresses []interface{}
+	for _, host := range hostsAndIPsForVault(v, service) {
+		if net.ParseIP(host) != nil {
+			ipAddresses = append(ipAddresses, host)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+
+	issuerRef := map[string]interface{}{
+		"name": config.IssuerRef.Name,
+		"kind": "Issuer",
+	}
+	if config.IssuerRef.Kind != "" {
+		issuerRef["kind"] = config.IssuerRef.Kind
+	}
+	if config.IssuerRef.Group != "" {
+		issuerRef["group"] = config.IssuerRef.Group
+	}
+
+	renewBefore := config.RenewBefore
+	if renewBefore == "" {
+		renewBefore = v.Spec.GetTLSExpiryThreshold().String()
+	}
+
+	spec := map[string]interface{}{
+		"secretName":  v.GetTLSSecretName(),
+		"commonName":  v.Name,
+		"dnsNames":    dnsNames,
+		"issuerRef":   issuerRef,
+		"renewBefore": renewBefore,
+	}
+	if len(ipAddresses) > 0 {
+		spec["ipAddresses"] = ipAddresses
+	}
+	if config.Duration != "" {
+		spec["duration"] = config.Duration
+	}
+
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(v.GetTLSSecretName())
+	certificate.SetNamespace(v.Namespace)
+	certificate.SetLabels(withVaultLabels(v, v.LabelsForVault()))
+
+	return certificate
+}
+
+// certManagerSecretRequests maps the TLS Secrets issued by cert-manager to the Vault they belong to,
+// so the renewed certificates are picked up without waiting for the next resync
+func certManagerSecretRequests(o handler.MapObject) []reconcile.Request {
+	name := o.Meta.GetName()
+	if o.Meta.GetAnnotations()[certManagerCertificateNameAnnotation] != name || !strings.HasSuffix(name, "-tls") {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: o.Meta.GetNamespace(),
+		Name:      strings.TrimSuffix(name, "-tls"),
+	}}}
+}
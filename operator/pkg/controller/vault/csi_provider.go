@@ -0,0 +1,170 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/yaml"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// secretProviderClassGVK is the SecretProviderClass of the Secrets Store CSI driver
+var secretProviderClassGVK = schema.GroupVersionKind{Group: "secrets-store.csi.x-k8s.io", Version: "v1alpha1", Kind: "SecretProviderClass"}
+
+// csiProviderCACertPath is where the CA certificate of Vault is mounted in the CSI provider
+const csiProviderCACertPath = "/vault/tls/ca.crt"
+
+func csiProviderName(v *vaultv1alpha1.Vault) string {
+	return v.Name + "-csi-provider"
+}
+
+func csiProviderLabels(v *vaultv1alpha1.Vault) map[string]string {
+	return map[string]string{"app.kubernetes.io/name": "vault-csi-provider", "vault_cr": v.Name}
+}
+
+// serviceAccountForCSIProvider returns the ServiceAccount of the Vault CSI provider, it needs no permissions,
+// the provider logs in to Vault with the token of the ServiceAccount of the Pod mounting the secrets
+func serviceAccountForCSIProvider(v *vaultv1alpha1.Vault) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      csiProviderName(v),
+			Namespace: v.Namespace,
+			Labels:    withVaultLabels(v, csiProviderLabels(v)),
+		},
+	}
+}
+
+// daemonSetForCSIProvider returns the DaemonSet of the Vault CSI provider, which serves the Secrets Store CSI driver
+// on a socket in the providers directory of the nodes
+func daemonSetForCSIProvider(v *vaultv1alpha1.Vault) *appsv1.DaemonSet {
+	csi := v.Spec.CSIProvider
+	ls := csiProviderLabels(v)
+
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("50m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+	}
+	if csi.Resources != nil {
+		resources = *csi.Resources
+	}
+
+	volumes := []corev1.Volume{{
+		Name: "providervol",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: csi.GetProvidersDir()},
+		},
+	}}
+	volumeMounts := []corev1.VolumeMount{{Name: "providervol", MountPath: "/provider"}}
+
+	// the provider connects to Vault on behalf of the Pods, it has to trust the CA of Vault
+	if !v.Spec.IsTLSDisabled() {
+		volumes = append(volumes, corev1.Volume{
+			Name: "vault-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: v.GetTLSSecretName(),
+					Items:      []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: "vault-tls", MountPath: "/vault/tls", ReadOnly: true})
+	}
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      csiProviderName(v),
+			Namespace: v.Namespace,
+			Labels:    withVaultLabels(v, ls),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: ls},
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type: appsv1.RollingUpdateDaemonSetStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: withVaultLabels(v, ls),
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName:           csiProviderName(v),
+					AutomountServiceAccountToken: pointer.BoolPtr(false),
+					NodeSelector:                 csi.NodeSelector,
+					Tolerations:                  csi.Tolerations,
+					Containers: []corev1.Container{{
+						Name:            "vault-csi-provider",
+						Image:           csi.GetImage(),
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						Args:            []string{"--endpoint=/provider/vault.sock"},
+						Resources:       resources,
+						VolumeMounts:    volumeMounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
+
+// secretProviderClassesForVault returns the SecretProviderClasses generated from the templates of the CSI provider
+func secretProviderClassesForVault(v *vaultv1alpha1.Vault) ([]*unstructured.Unstructured, error) {
+	var classes []*unstructured.Unstructured
+
+	for _, template := range v.Spec.CSIProvider.SecretProviderClasses {
+		objects, err := yaml.Marshal(template.Objects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal the objects of secret provider class %s: %v", template.Name, err)
+		}
+
+		parameters := map[string]interface{}{
+			"vaultAddress":             fmt.Sprintf("%s://%s.%s:8200", v.Spec.GetAPIScheme(), v.Name, v.Namespace),
+			"vaultKubernetesMountPath": template.GetAuthPath(),
+			"roleName":                 template.Role,
+			"objects":                  string(objects),
+		}
+		if !v.Spec.IsTLSDisabled() {
+			parameters["vaultCACertPath"] = csiProviderCACertPath
+		}
+
+		class := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"provider":   "vault",
+				"parameters": parameters,
+			},
+		}}
+		class.SetGroupVersionKind(secretProviderClassGVK)
+		class.SetName(template.Name)
+		class.SetNamespace(template.GetNamespace(v.Namespace))
+		class.SetLabels(withVaultLabels(v, map[string]string{"vault_cr": v.Name}))
+
+		classes = append(classes, class)
+	}
+
+	return classes, nil
+}
@@ -0,0 +1,256 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// validateExternalVault checks the address of an external Vault, and that no features are requested
+// which need the Vault workload managed by the operator
+func validateExternalVault(v *vaultv1alpha1.Vault) error {
+	address, err := url.Parse(v.Spec.ExternalVaultAddress)
+	if err != nil {
+		return fmt.Errorf("failed to parse the address: %v", err)
+	}
+	if (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return fmt.Errorf("the address has to be an http(s) URL: '%s'", v.Spec.ExternalVaultAddress)
+	}
+	if v.Spec.IsStandby() {
+		return fmt.Errorf("an external vault can't be a standby")
+	}
+	if v.Spec.Backup != nil {
+		return fmt.Errorf("the snapshots of an external vault are not managed by the operator")
+	}
+	if v.Spec.Upgrade != nil {
+		return fmt.Errorf("the upgrades of an external vault are not managed by the operator")
+	}
+	if v.Spec.UnsealConfig.HSMDaemonNeeded() {
+		return fmt.Errorf("the HSM daemon runs in the Vault Pods, it can't be used with an external vault")
+	}
+	if v.Spec.IsCertManagerTLS() {
+		return fmt.Errorf("the certificate of an external vault is not managed by the operator, set existingTlsSecretName for its CA")
+	}
+	return nil
+}
+
+// withExternalVaultEnv points the bank-vaults containers to the external Vault
+func withExternalVaultEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.EnvVar {
+	envs = append(envs, corev1.EnvVar{
+		Name:  api.EnvVaultAddress,
+		Value: v.Spec.ExternalVaultAddress,
+	})
+	if v.Spec.ExistingTLSSecretName != "" {
+		envs = append(envs, corev1.EnvVar{
+			Name:  api.EnvVaultCACert,
+			Value: "/vault/tls/ca.crt",
+		})
+	}
+	return envs
+}
+
+// withExternalVaultTLSVolume mounts the CA certificate of the external Vault from the existing TLS Secret,
+// the certificate and the key of the server are not needed
+func withExternalVaultTLSVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	if v.Spec.ExistingTLSSecretName == "" {
+		return volumes
+	}
+	return append(volumes, corev1.Volume{
+		Name: "vault-tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: v.Spec.ExistingTLSSecretName,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  "ca.crt",
+						Path: "ca.crt",
+					},
+				},
+			},
+		},
+	})
+}
+
+// deploymentForExternalVaultUnsealer returns the Deployment which initializes and unseals the external Vault,
+// with the keys in the key store, like the bank-vaults sidecar of an operator managed Vault
+func deploymentForExternalVaultUnsealer(v *vaultv1alpha1.Vault) *appsv1.Deployment {
+	ls := v.LabelsForVaultUnsealer()
+
+	unsealCommand := []string{"bank-vaults", "unseal", "--init"}
+	if v.Spec.IsAutoUnseal() {
+		unsealCommand = append(unsealCommand, "--auto")
+	}
+
+	podSpec := corev1.PodSpec{
+		ServiceAccountName:           configurerServiceAccount(v),
+		AutomountServiceAccountToken: pointer.BoolPtr(true),
+
+		Containers: []corev1.Container{
+			{
+				Image:           v.Spec.GetBankVaultsImage(),
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				Name:            "bank-vaults",
+				Command:         unsealCommand,
+				Args:            append(v.Spec.UnsealConfig.Options.ToArgs(), v.Spec.UnsealConfig.ToArgs(v)...),
+				Ports: []corev1.ContainerPort{{
+					Name:          getMetricsPortName(v),
+					ContainerPort: 9091,
+					Protocol:      "TCP",
+				}},
+				Env:             withCommonEnv(v, withTLSEnv(v, false, withCredentialsEnv(v, []corev1.EnvVar{}))),
+				VolumeMounts:    withServiceAccountTokenVolumeMounts(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{}))),
+				Resources:       *getBankVaultsResource(v),
+				SecurityContext: withBankVaultsSecurityContext(v),
+			},
+		},
+		Volumes:         withServiceAccountTokenVolumes(v, withTLSVolume(v, withCredentialsVolume(v, []corev1.Volume{}))),
+		SecurityContext: withPodSecurityContext(v),
+		NodeSelector:    v.Spec.NodeSelector,
+		Tolerations:     v.Spec.Tolerations,
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        v.Name + "-unsealer",
+			Namespace:   v.Namespace,
+			Annotations: withVaultConfigurerAnnotations(v, map[string]string{}),
+			Labels:      withVaultConfigurerLabels(v, ls),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: ls,
+			},
+			RevisionHistoryLimit: pointer.Int32Ptr(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      withVaultConfigurerLabels(v, ls),
+					Annotations: withVaultConfigurerAnnotations(v, withPrometheusAnnotations("9091", map[string]string{})),
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+// reconcileExternalVault creates the configurer and the unsealer of an externally managed Vault,
+// then updates the status of the Vault with the health of the external Vault
+func (r *ReconcileVault) reconcileExternalVault(request reconcile.Request, v *vaultv1alpha1.Vault) (reconcile.Result, error) {
+	if err := r.reconcileRBAC(v); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	unsealer := deploymentForExternalVaultUnsealer(v)
+	mirrorPodSpecImages(r.imageMirrors, &unsealer.Spec.Template.Spec)
+	// Set Vault instance as the owner and controller
+	if err := controllerutil.SetControllerReference(v, unsealer, r.scheme); err != nil {
+		return reconcile.Result{}, err
+	}
+	if err := r.createOrUpdateObject(unsealer); err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to create/update unsealer deployment: %v", err)
+	}
+
+	referencedConfigHash, err := r.referencedConfigHash(v)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to hash referenced config: %v", err)
+	}
+
+	cm, err := r.reconcileConfigurer(v, map[string]string{}, referencedConfigHash)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// the external Vault is checked through its unauthenticated health endpoint only
+	var statusError string
+	var health *api.HealthResponse
+	client, err := vault.NewInsecureRawClient()
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	client.SetAddress(v.Spec.ExternalVaultAddress)
+	health, err = client.Sys().Health()
+	if err != nil {
+		statusError = err.Error()
+	}
+
+	conditions := []corev1.ComponentCondition{{
+		Type:   corev1.ComponentHealthy,
+		Status: corev1.ConditionFalse,
+		Error:  statusError,
+	}}
+	if statusError != "" {
+		conditions = append(conditions,
+			unknownCondition(vaultv1alpha1.VaultInitialized, statusError),
+			unknownCondition(vaultv1alpha1.VaultUnsealed, statusError))
+	} else {
+		if health.Initialized && !health.Sealed && !health.Standby {
+			conditions[0].Status = corev1.ConditionTrue
+		}
+		conditions = append(conditions,
+			statusCondition(vaultv1alpha1.VaultInitialized, health.Initialized, "vault is not initialized"),
+			statusCondition(vaultv1alpha1.VaultUnsealed, !health.Sealed, "the external vault is sealed"))
+	}
+	configSynced, lastSyncedConfigHash := r.configSyncedCondition(v, cm)
+	conditions = append(conditions, configSynced)
+
+	// the health of the external Vault is not watched, it is checked again with the config sync
+	requeueAfter := configSyncPollInterval
+	if configSynced.Status == corev1.ConditionTrue {
+		requeueAfter = 5 * time.Minute
+	}
+
+	// Fetch the Vault instance again to minimize the possibility of updating a stale object
+	v = &vaultv1alpha1.Vault{}
+	err = r.client.Get(context.TODO(), request.NamespacedName, v)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	r.configSyncEvents(v, v.Status.Conditions, configSynced)
+
+	if !reflect.DeepEqual(conditions, v.Status.Conditions) || lastSyncedConfigHash != v.Status.LastSyncedConfigHash ||
+		len(v.Status.Nodes) > 0 || v.Status.Leader != "" {
+		v.Status.Nodes = nil
+		v.Status.Leader = ""
+		v.Status.Conditions = conditions
+		v.Status.LastSyncedConfigHash = lastSyncedConfigHash
+		log.V(1).Info("Updating vault status", "status", v.Status, "resourceVersion", v.ResourceVersion)
+		err := r.client.Update(context.TODO(), v)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to update vault status: %v", err)
+		}
+	}
+
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
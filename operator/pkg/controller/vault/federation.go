@@ -0,0 +1,157 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	corev1 "k8s.io/api/core/v1"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// replicationStatusPollInterval is how often the replication status of the federation is refreshed
+const replicationStatusPollInterval = time.Minute
+
+// withFederationVolumes mounts the CA bundles of the federation peers, Vault reads them for the replication
+// and the transit seal
+func withFederationVolumes(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	if v.Spec.Federation == nil {
+		return volumes
+	}
+
+	for _, peer := range v.Spec.Federation.Peers {
+		if peer.CABundleSecret == nil {
+			continue
+		}
+		key := peer.CABundleSecret.Key
+		if key == "" {
+			key = "ca.crt"
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: "federation-" + peer.Name,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: peer.CABundleSecret.Name,
+					Items:      []corev1.KeyToPath{{Key: key, Path: "ca.crt"}},
+				},
+			},
+		})
+	}
+
+	return volumes
+}
+
+func withFederationVolumeMounts(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
+	if v.Spec.Federation == nil {
+		return volumeMounts
+	}
+
+	for _, peer := range v.Spec.Federation.Peers {
+		if peer.CABundleSecret == nil {
+			continue
+		}
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "federation-" + peer.Name,
+			MountPath: vaultv1alpha1.FederationCAPath + "/" + peer.Name,
+			ReadOnly:  true,
+		})
+	}
+
+	return volumeMounts
+}
+
+// withFederationEnv passes the token of the transit seal to Vault, so it isn't written into the config
+func withFederationEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.EnvVar {
+	if v.Spec.Federation == nil || v.Spec.Federation.TransitUnseal == nil {
+		return envs
+	}
+
+	tokenSecret := v.Spec.Federation.TransitUnseal.TokenSecret
+	return append(envs, corev1.EnvVar{
+		Name:      "VAULT_TOKEN",
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &tokenSecret},
+	})
+}
+
+// readReplicationStatus reads the unauthenticated replication status endpoint of the Vault at the address
+func readReplicationStatus(address string) (map[string]interface{}, error) {
+	client, err := vault.NewInsecureRawClient()
+	if err != nil {
+		return nil, err
+	}
+	client.SetAddress(address)
+
+	secret, err := client.Logical().Read("sys/replication/status")
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("empty replication status")
+	}
+
+	return secret.Data, nil
+}
+
+// replicationStatusForVault returns the state of the replication types of the federation, read from the leader,
+// the lag of a secondary is the count of the WAL entries of its primary peer it hasn't streamed yet
+func replicationStatusForVault(v *vaultv1alpha1.Vault, leader string) []vaultv1alpha1.ReplicationStatus {
+	if v.Spec.Federation == nil || len(v.Spec.Federation.Replication) == 0 {
+		return nil
+	}
+
+	var statuses []vaultv1alpha1.ReplicationStatus
+
+	var local map[string]interface{}
+	err := fmt.Errorf("there is no leader")
+	if leader != "" {
+		local, err = readReplicationStatus(fmt.Sprintf("%s://%s.%s:8200", strings.ToLower(string(getVaultURIScheme(v))), leader, v.Namespace))
+	}
+
+	for _, replication := range v.Spec.Federation.Replication {
+		status := vaultv1alpha1.ReplicationStatus{Type: replication.Type, Mode: replication.Mode}
+		if err != nil {
+			status.Error = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+
+		typeStatus := cast.ToStringMap(local[replication.Type])
+		status.Mode = cast.ToString(typeStatus["mode"])
+		status.State = cast.ToString(typeStatus["state"])
+
+		if status.Mode == "secondary" {
+			peer, _ := v.Spec.Federation.GetPeer(replication.Peer)
+			primary, err := readReplicationStatus(peer.Address)
+			if err != nil {
+				status.Error = fmt.Sprintf("error reading the replication status of the primary %s: %v", peer.Name, err)
+			} else {
+				lastWAL := cast.ToInt64(cast.ToStringMap(primary[replication.Type])["last_wal"])
+				lastRemoteWAL := cast.ToInt64(typeStatus["last_remote_wal"])
+				if lag := lastWAL - lastRemoteWAL; lag > 0 {
+					status.Lag = lag
+				}
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,64 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"os"
+
+	etcdv1beta2 "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/banzaicloud/bank-vaults/internal/mirror"
+)
+
+// the images the etcd operator defaults to, they are set explicitly to be mirrored
+const (
+	etcdDefaultRepository   = "quay.io/coreos/etcd"
+	etcdDefaultBusyboxImage = "busybox:1.28.0-glibc"
+)
+
+// imageMirrorsFromEnv returns the image mirrors of the operator, see mirror.Parse for the format
+func imageMirrorsFromEnv() (mirror.Mirrors, error) {
+	return mirror.Parse(os.Getenv("IMAGE_MIRRORS"))
+}
+
+// mirrorPodSpecImages rewrites the images of the containers to be pulled from the image mirrors
+func mirrorPodSpecImages(mirrors mirror.Mirrors, spec *corev1.PodSpec) {
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Image = mirrors.Image(spec.InitContainers[i].Image)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Image = mirrors.Image(spec.Containers[i].Image)
+	}
+}
+
+// mirrorEtcdImages rewrites the images of the etcd cluster to be pulled from the image mirrors
+func mirrorEtcdImages(mirrors mirror.Mirrors, etcdCluster *etcdv1beta2.EtcdCluster) {
+	if len(mirrors) == 0 {
+		return
+	}
+
+	if etcdCluster.Spec.Repository == "" {
+		etcdCluster.Spec.Repository = etcdDefaultRepository
+	}
+	etcdCluster.Spec.Repository = mirrors.Image(etcdCluster.Spec.Repository)
+
+	if etcdCluster.Spec.Pod != nil {
+		if etcdCluster.Spec.Pod.BusyboxImage == "" {
+			etcdCluster.Spec.Pod.BusyboxImage = etcdDefaultBusyboxImage
+		}
+		etcdCluster.Spec.Pod.BusyboxImage = mirrors.Image(etcdCluster.Spec.Pod.BusyboxImage)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"os"
+
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/banzaicloud/bank-vaults/internal/telemetry"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+)
+
+// metricsRecorderFromEnv returns the metrics recorder of the operator for the METRICS_BACKEND
+// (prometheus, statsd or none), the Prometheus metrics are served with the ones of the manager
+func metricsRecorderFromEnv() (metrics.Recorder, error) {
+	return telemetry.NewRecorder(os.Getenv("METRICS_BACKEND"), "vault_operator", os.Getenv("METRICS_STATSD_ADDRESS"), crmetrics.Registry)
+}
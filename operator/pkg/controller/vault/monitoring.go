@@ -0,0 +1,154 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+
+	monitorv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// withMonitoringLabels adds the labels of the monitoring spec to the labels of a ServiceMonitor
+func withMonitoringLabels(v *vaultv1alpha1.Vault, labels map[string]string) map[string]string {
+	if v.Spec.Monitoring == nil {
+		return labels
+	}
+	for key, value := range v.Spec.Monitoring.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// serviceMonitorForBankVaults returns the ServiceMonitor of the metrics of the bank-vaults sidecars and the
+// configurer, it selects the per-instance Services of Vault (not the global one, which would scrape a random
+// sidecar) and the Service of the configurer
+func serviceMonitorForBankVaults(v *vaultv1alpha1.Vault) *monitorv1.ServiceMonitor {
+	return &monitorv1.ServiceMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-bank-vaults", v.Name),
+			Namespace: v.Namespace,
+			Labels:    withMonitoringLabels(v, v.LabelsForVault()),
+		},
+		Spec: monitorv1.ServiceMonitorSpec{
+			JobLabel: v.Name,
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"vault_cr": v.Name},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      "app.kubernetes.io/name",
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{v.LabelsForVault()["app.kubernetes.io/name"], v.LabelsForVaultConfigurer()["app.kubernetes.io/name"]},
+					},
+					{
+						Key:      "global_service",
+						Operator: metav1.LabelSelectorOpDoesNotExist,
+					},
+				},
+			},
+			NamespaceSelector: monitorv1.NamespaceSelector{
+				MatchNames: []string{v.Namespace},
+			},
+			Endpoints: []monitorv1.Endpoint{{
+				Interval: v.Spec.GetMonitoringInterval(),
+				Port:     getMetricsPortName(v),
+				Path:     "/metrics",
+			}},
+		},
+	}
+}
+
+// dashboardPanel is a graph of the Grafana dashboard of Vault
+type dashboardPanel struct {
+	title string
+	expr  string
+	unit  string
+}
+
+// grafanaDashboardForVault returns the ConfigMap with the Grafana dashboard of the Vault and bank-vaults metrics
+func grafanaDashboardForVault(v *vaultv1alpha1.Vault) (*corev1.ConfigMap, error) {
+	dashboards := v.Spec.Monitoring.GrafanaDashboards
+
+	namespace := dashboards.Namespace
+	if namespace == "" {
+		namespace = v.Namespace
+	}
+
+	vaultPods := fmt.Sprintf(`namespace="%s",pod=~"%s-[0-9]+"`, v.Namespace, v.Name)
+	configurerPods := fmt.Sprintf(`namespace="%s",pod=~"%s-configurer-.+"`, v.Namespace, v.Name)
+
+	panels := []dashboardPanel{
+		{"Sealed", fmt.Sprintf("max by (pod) (vault_sys_sealed{%s})", vaultPods), "none"},
+		{"Leader", fmt.Sprintf("max by (pod) (vault_sys_leader{%s})", vaultPods), "none"},
+		{"Requests", fmt.Sprintf("sum by (pod) (rate(vault_core_handle_request_count{%s}[5m]))", vaultPods), "reqps"},
+		{"Failed unseal attempts", fmt.Sprintf("sum by (pod) (increase(vault_unseal_failed{%s}[5m]))", vaultPods), "none"},
+		{"Healthy Raft peers", fmt.Sprintf("max(vault_raft_healthy_peers{%s})", vaultPods), "none"},
+		{"Key store errors", fmt.Sprintf("sum by (pod) (increase(vault_kv_errors{%s}[5m]))", vaultPods), "none"},
+		{"Time since the last configuration", fmt.Sprintf("time() - max(vault_config_last_success_timestamp_seconds{%s})", configurerPods), "s"},
+		{"Failed configurations", fmt.Sprintf("sum(increase(vault_config_failed{%s}[5m]))", configurerPods), "none"},
+	}
+
+	var dashboardPanels []map[string]interface{}
+	for i, panel := range panels {
+		dashboardPanels = append(dashboardPanels, map[string]interface{}{
+			"id":         i + 1,
+			"type":       "graph",
+			"title":      panel.title,
+			"datasource": "${datasource}",
+			"gridPos":    map[string]int{"x": (i % 2) * 12, "y": (i / 2) * 8, "w": 12, "h": 8},
+			"targets": []map[string]interface{}{
+				{"expr": panel.expr, "legendFormat": "{{pod}}", "refId": "A"},
+			},
+			"yaxes": []map[string]interface{}{
+				{"format": panel.unit, "min": 0},
+				{"format": "short", "show": false},
+			},
+		})
+	}
+
+	dashboard := map[string]interface{}{
+		"title":         fmt.Sprintf("Vault %s/%s", v.Namespace, v.Name),
+		"uid":           fmt.Sprintf("vault-%s-%s", v.Namespace, v.Name),
+		"tags":          []string{"vault", "bank-vaults"},
+		"schemaVersion": 22,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{
+			"list": []map[string]interface{}{
+				{"name": "datasource", "type": "datasource", "query": "prometheus"},
+			},
+		},
+		"panels": dashboardPanels,
+	}
+
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-grafana-dashboard", v.Name),
+			Namespace:   namespace,
+			Annotations: getCommonAnnotations(v, map[string]string{}),
+			Labels:      dashboards.GetLabels(),
+		},
+		Data: map[string]string{fmt.Sprintf("vault-%s-%s.json", v.Namespace, v.Name): string(data)},
+	}, nil
+}
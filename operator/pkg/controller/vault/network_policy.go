@@ -0,0 +1,174 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// The ports of the bank-vaults and StatsD exporter metrics
+const (
+	bankVaultsMetricsPort = 9091
+	statsDMetricsPort     = 9102
+)
+
+func networkPolicyPorts(ports ...int32) []networkingv1.NetworkPolicyPort {
+	var policyPorts []networkingv1.NetworkPolicyPort
+	for _, p := range ports {
+		port := intstr.FromInt(int(p))
+		policyPorts = append(policyPorts, networkingv1.NetworkPolicyPort{Port: &port})
+	}
+	return policyPorts
+}
+
+func dnsNetworkPolicyPorts() []networkingv1.NetworkPolicyPort {
+	udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+	port := intstr.FromInt(53)
+	return []networkingv1.NetworkPolicyPort{
+		{Protocol: &udp, Port: &port},
+		{Protocol: &tcp, Port: &port},
+	}
+}
+
+// withNetworkPolicyEgress restricts the egress of a policy if egress rules are specified,
+// DNS and the Vault Pods are always reachable.
+func withNetworkPolicyEgress(v *vaultv1alpha1.Vault, policy *networkingv1.NetworkPolicy) *networkingv1.NetworkPolicy {
+	policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+
+	if len(v.Spec.NetworkPolicy.Egress) == 0 {
+		return policy
+	}
+
+	policy.Spec.PolicyTypes = append(policy.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+	policy.Spec.Egress = append([]networkingv1.NetworkPolicyEgressRule{
+		{Ports: dnsNetworkPolicyPorts()},
+		{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: v.LabelsForVault()}}}},
+	}, v.Spec.NetworkPolicy.Egress...)
+
+	return policy
+}
+
+// networkPoliciesForVault returns the least-privilege NetworkPolicies of the Vault and configurer Pods if enabled:
+// the API port is open to the configured peers, the other Vault ports to the Vault Pods only.
+func networkPoliciesForVault(v *vaultv1alpha1.Vault) []*networkingv1.NetworkPolicy {
+	if v.Spec.NetworkPolicy == nil {
+		return nil
+	}
+
+	vaultPeer := networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: v.LabelsForVault()}}
+	configurerPeer := networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: v.LabelsForVaultConfigurer()}}
+
+	var apiPorts, clusterPorts []int32
+	servicePorts, _ := getServicePorts(v)
+	for _, port := range servicePorts {
+		if port.Name == v.Spec.GetAPIPortName() {
+			apiPorts = append(apiPorts, port.Port)
+		} else {
+			clusterPorts = append(clusterPorts, port.Port)
+		}
+	}
+
+	// An empty peer list allows every peer, so only add the Vault and configurer Pods when the API is restricted
+	var apiFrom []networkingv1.NetworkPolicyPeer
+	if len(v.Spec.NetworkPolicy.APIFrom) > 0 {
+		apiFrom = append([]networkingv1.NetworkPolicyPeer{vaultPeer, configurerPeer}, v.Spec.NetworkPolicy.APIFrom...)
+		if v.Spec.Backup != nil {
+			apiFrom = append(apiFrom, networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: v.LabelsForVaultBackup()}})
+		}
+	}
+
+	ingress := []networkingv1.NetworkPolicyIngressRule{
+		{
+			Ports: networkPolicyPorts(bankVaultsMetricsPort, statsDMetricsPort),
+			From:  v.Spec.NetworkPolicy.MetricsFrom,
+		},
+	}
+	if len(apiPorts) > 0 {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: networkPolicyPorts(apiPorts...),
+			From:  apiFrom,
+		})
+	}
+	if len(clusterPorts) > 0 {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: networkPolicyPorts(clusterPorts...),
+			From:  []networkingv1.NetworkPolicyPeer{vaultPeer},
+		})
+	}
+
+	vaultPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.Name,
+			Namespace: v.Namespace,
+			Labels:    withVaultLabels(v, v.LabelsForVault()),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *vaultPeer.PodSelector,
+			Ingress:     ingress,
+		},
+	}
+
+	configurerPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-configurer", v.Name),
+			Namespace: v.Namespace,
+			Labels:    withVaultConfigurerLabels(v, v.LabelsForVaultConfigurer()),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *configurerPeer.PodSelector,
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: networkPolicyPorts(bankVaultsMetricsPort),
+					From:  v.Spec.NetworkPolicy.MetricsFrom,
+				},
+			},
+		},
+	}
+
+	return []*networkingv1.NetworkPolicy{
+		withNetworkPolicyEgress(v, vaultPolicy),
+		withNetworkPolicyEgress(v, configurerPolicy),
+	}
+}
+
+// deleteNetworkPolicies removes the NetworkPolicies created by the operator for the Vault,
+// this is called when spec.networkPolicy is unset.
+func (r *ReconcileVault) deleteNetworkPolicies(v *vaultv1alpha1.Vault) error {
+	var policies networkingv1.NetworkPolicyList
+	if err := r.client.List(context.TODO(), &policies, &client.ListOptions{Namespace: v.Namespace}); err != nil {
+		return fmt.Errorf("failed to list network policies: %v", err)
+	}
+
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		if !metav1.IsControlledBy(policy, v) {
+			continue
+		}
+		if err := r.client.Delete(context.TODO(), policy); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete network policy %s: %v", policy.Name, err)
+		}
+	}
+
+	return nil
+}
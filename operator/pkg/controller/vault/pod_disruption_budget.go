@@ -0,0 +1,59 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// podDisruptionBudgetForVault returns the PodDisruptionBudget of the Vault Pods if enabled,
+// by default the voluntary disruptions may not break the quorum of the cluster
+func podDisruptionBudgetForVault(v *vaultv1alpha1.Vault) *policyv1beta1.PodDisruptionBudget {
+	if v.Spec.PodDisruptionBudget == nil {
+		return nil
+	}
+
+	minAvailable := v.Spec.GetPodDisruptionBudgetMinAvailable()
+
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        v.Name,
+			Namespace:   v.Namespace,
+			Annotations: withVaultAnnotations(v, getCommonAnnotations(v, map[string]string{})),
+			Labels:      withVaultLabels(v, v.LabelsForVault()),
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: v.LabelsForVault()},
+		},
+	}
+}
+
+// withTopologySpreadConstraints returns the topology spread constraints of the Vault Pods,
+// the ones without a label selector select the Vault Pods
+func withTopologySpreadConstraints(v *vaultv1alpha1.Vault) []corev1.TopologySpreadConstraint {
+	var constraints []corev1.TopologySpreadConstraint
+	for _, constraint := range v.Spec.TopologySpreadConstraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{MatchLabels: v.LabelsForVault()}
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
@@ -0,0 +1,66 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// vaultAnnotation references the Vault of the objects it can't own, because they are cluster-scoped or in another namespace
+const vaultAnnotation = "vault.banzaicloud.io/vault"
+
+// ownedObjectChanged passes the updates of the managed objects which can be drift, the status updates of the
+// StatefulSets and Deployments don't change their generation, so they don't trigger a reconcile.
+// Objects without a generation (like ConfigMaps and RBAC objects) are passed on every change.
+var ownedObjectChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaNew.GetGeneration() == 0 {
+			return e.MetaOld.GetResourceVersion() != e.MetaNew.GetResourceVersion()
+		}
+		return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() ||
+			!reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels())
+	},
+}
+
+// setVaultAnnotation sets the vaultAnnotation on an object which can't be owned by the Vault
+func setVaultAnnotation(v *vaultv1alpha1.Vault, o interface {
+	GetAnnotations() map[string]string
+	SetAnnotations(map[string]string)
+}) {
+	annotations := o.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[vaultAnnotation] = v.Namespace + "/" + v.Name
+	o.SetAnnotations(annotations)
+}
+
+// annotatedVaultRequests maps an object with the vaultAnnotation to the reconcile request of its Vault
+var annotatedVaultRequests = handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+	split := strings.SplitN(o.Meta.GetAnnotations()[vaultAnnotation], "/", 2)
+	if len(split) != 2 {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: split[0], Name: split[1]}}}
+})
@@ -0,0 +1,71 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// pausedAnnotation can be set to "true" on a Vault to stop reconciling it, the managed resources are left as
+// they are (without drift repair) until the annotation is removed
+const pausedAnnotation = "vault.banzaicloud.io/paused"
+
+// confirmDeletionAnnotation has to be set to the name of a Vault with deletionProtection to let it be deleted
+const confirmDeletionAnnotation = "vault.banzaicloud.io/confirm-deletion"
+
+// isPaused returns true if the reconciliation of the Vault is paused
+func isPaused(v *vaultv1alpha1.Vault) bool {
+	return v.GetAnnotations()[pausedAnnotation] == "true"
+}
+
+// reconcileDeletionProtection keeps the deletion protection finalizer of the Vault in sync with the spec. It
+// returns true if the Vault is being deleted, then the finalizer is only removed if the deletion is confirmed,
+// and nothing else is reconciled.
+func (r *ReconcileVault) reconcileDeletionProtection(v *vaultv1alpha1.Vault) (bool, error) {
+	if v.DeletionTimestamp == nil {
+		if v.SetFinalizer(v.Spec.DeletionProtection) {
+			if err := r.client.Update(context.TODO(), v); err != nil {
+				return false, fmt.Errorf("failed to update the finalizers of vault: %v", err)
+			}
+		}
+		return false, nil
+	}
+
+	if !v.HasFinalizer() {
+		return true, nil
+	}
+
+	if v.Spec.DeletionProtection && v.GetAnnotations()[confirmDeletionAnnotation] != v.Name {
+		if r.recorder != nil {
+			r.recorder.Eventf(v, corev1.EventTypeWarning, "DeletionBlocked",
+				"the vault is protected from deletion, set the %s annotation to %q to confirm it", confirmDeletionAnnotation, v.Name)
+		}
+		return true, nil
+	}
+
+	log.Info("deletion of protected vault confirmed", "vault", v.Name)
+
+	v.SetFinalizer(false)
+	if err := r.client.Update(context.TODO(), v); err != nil {
+		return true, fmt.Errorf("failed to remove the finalizer of vault: %v", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,206 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	"github.com/spf13/cast"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// keyStoreLocks are the locks of the key store taken by the unsealer, they are Secrets with the Kubernetes key store
+var keyStoreLocks = []string{"init", "migrate-seal", "rekey", "rotate-root"}
+
+// vaultServiceAccount returns the ServiceAccount of the Vault Pods
+func vaultServiceAccount(v *vaultv1alpha1.Vault) string {
+	if v.Spec.IsRBACEnabled() {
+		return v.Name
+	}
+	return v.Spec.GetServiceAccount()
+}
+
+// configurerServiceAccount returns the ServiceAccount of the configurer Pods
+func configurerServiceAccount(v *vaultv1alpha1.Vault) string {
+	if v.Spec.IsRBACEnabled() {
+		return fmt.Sprintf("%s-configurer", v.Name)
+	}
+	return v.Spec.GetServiceAccount()
+}
+
+// roleWithBinding returns a Role with the rules and a RoleBinding of it to the ServiceAccount in the namespace of the Vault
+func roleWithBinding(v *vaultv1alpha1.Vault, name, namespace, serviceAccount string, labels map[string]string, rules []rbacv1.PolicyRule) []runtime.Object {
+	meta := metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}
+
+	return []runtime.Object{
+		&rbacv1.Role{
+			ObjectMeta: meta,
+			Rules:      rules,
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: meta,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     name,
+			},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: v.Namespace},
+			},
+		},
+	}
+}
+
+// rbacForVault returns the ServiceAccounts, Roles and RoleBindings of the Vault and configurer Pods if enabled.
+// The Roles of the Kubernetes key store are created in the namespace of the unseal keys Secret, the
+// ClusterRoleBinding of the auth delegator is cluster scoped, the rest is in the namespace of the Vault.
+func rbacForVault(v *vaultv1alpha1.Vault) []runtime.Object {
+	if !v.Spec.IsRBACEnabled() {
+		return nil
+	}
+
+	vaultLabels := withVaultLabels(v, v.LabelsForVault())
+	configurerLabels := withVaultConfigurerLabels(v, v.LabelsForVaultConfigurer())
+
+	objects := []runtime.Object{
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: vaultServiceAccount(v), Namespace: v.Namespace, Labels: vaultLabels},
+		},
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: configurerServiceAccount(v), Namespace: v.Namespace, Labels: configurerLabels},
+		},
+	}
+
+	var vaultRules, configurerRules []rbacv1.PolicyRule
+
+	// Vault labels its own Pods with the Kubernetes service registration
+	if _, ok := cast.ToStringMap(v.Spec.Config["service_registration"])["kubernetes"]; ok {
+		var pods []string
+		for i := 0; i < int(v.Spec.Size); i++ {
+			pods = append(pods, fmt.Sprintf("%s-%d", v.Name, i))
+		}
+		vaultRules = append(vaultRules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"pods"},
+			ResourceNames: pods,
+			Verbs:         []string{"get", "update", "patch"},
+		})
+	}
+
+	// the bank-vaults sidecar checks if its Pod is removed by a scale-down before leaving the Raft cluster
+	if v.Spec.RaftScaling && v.Spec.IsRaftStorage() {
+		vaultRules = append(vaultRules, rbacv1.PolicyRule{
+			APIGroups:     []string{"apps"},
+			Resources:     []string{"statefulsets"},
+			ResourceNames: []string{v.Name},
+			Verbs:         []string{"get"},
+		})
+	}
+
+	if namespace, secret, ok := v.Spec.UnsealConfig.KubernetesKeyStore(v); ok {
+		secrets := []string{secret}
+		for _, lock := range keyStoreLocks {
+			secrets = append(secrets, fmt.Sprintf("%s-%s-lock", secret, lock))
+		}
+
+		// create can't be restricted to resource names
+		keyStoreRules := []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: secrets,
+				Verbs:         []string{"get", "update", "delete"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"create"},
+			},
+		}
+		configurerKeyStoreRules := []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{secret},
+				Verbs:         []string{"get"},
+			},
+		}
+
+		if namespace == v.Namespace {
+			vaultRules = append(vaultRules, keyStoreRules...)
+			configurerRules = append(configurerRules, configurerKeyStoreRules...)
+		} else {
+			objects = append(objects, roleWithBinding(v, fmt.Sprintf("%s-key-store", v.Name), namespace, vaultServiceAccount(v), vaultLabels, keyStoreRules)...)
+			objects = append(objects, roleWithBinding(v, fmt.Sprintf("%s-configurer-key-store", v.Name), namespace, configurerServiceAccount(v), configurerLabels, configurerKeyStoreRules)...)
+		}
+	}
+
+	if v.Spec.ConfigurerLeaderElection {
+		configurerRules = append(configurerRules, rbacv1.PolicyRule{
+			APIGroups: []string{"coordination.k8s.io"},
+			Resources: []string{"leases"},
+			Verbs:     []string{"get", "create", "update"},
+		})
+	}
+
+	// the configurer reads the valueFrom references of the external configuration
+	referenced := map[string][]string{}
+	for _, ref := range externalConfigReferences(v) {
+		resource := "secrets"
+		if ref.Kind == "ConfigMap" {
+			resource = "configmaps"
+		}
+		if names := referenced[resource]; len(names) == 0 || names[len(names)-1] != ref.Name {
+			referenced[resource] = append(names, ref.Name)
+		}
+	}
+	for _, resource := range []string{"configmaps", "secrets"} {
+		if names := referenced[resource]; len(names) > 0 {
+			configurerRules = append(configurerRules, rbacv1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{resource},
+				ResourceNames: names,
+				Verbs:         []string{"get"},
+			})
+		}
+	}
+
+	vaultRules = append(vaultRules, v.Spec.RBAC.VaultRules...)
+	configurerRules = append(configurerRules, v.Spec.RBAC.ConfigurerRules...)
+
+	objects = append(objects, roleWithBinding(v, vaultServiceAccount(v), v.Namespace, vaultServiceAccount(v), vaultLabels, vaultRules)...)
+	objects = append(objects, roleWithBinding(v, configurerServiceAccount(v), v.Namespace, configurerServiceAccount(v), configurerLabels, configurerRules)...)
+
+	if v.Spec.RBAC.AuthDelegator {
+		objects = append(objects, &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%s-auth-delegator", v.Namespace, v.Name), Labels: vaultLabels},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     "system:auth-delegator",
+			},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Name: vaultServiceAccount(v), Namespace: v.Namespace},
+			},
+		})
+	}
+
+	return objects
+}
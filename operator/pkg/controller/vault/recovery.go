@@ -0,0 +1,44 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/recovery"
+)
+
+// recoveringReconciler returns the panics of the reconciliation as errors, so the request is
+// retried with backoff and the other Vault resources are still reconciled by the operator
+type recoveringReconciler struct {
+	reconcile.Reconciler
+	panics metrics.Counter
+}
+
+func (r *recoveringReconciler) Reconcile(request reconcile.Request) (result reconcile.Result, err error) {
+	err = recovery.Call(func() error {
+		result, err = r.Reconciler.Reconcile(request)
+		return err
+	})
+
+	if p, ok := err.(*recovery.Panic); ok {
+		log.Error(p, "recovered from panic while reconciling Vault",
+			"Request.Namespace", request.Namespace, "Request.Name", request.Name, "stack", string(p.Stack))
+		r.panics.Add(1)
+	}
+
+	return result, err
+}
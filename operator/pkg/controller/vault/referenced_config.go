@@ -0,0 +1,122 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// referencedConfigHashAnnotation is the hash of the referenced values on the Pod templates, the Pods are
+// restarted when it changes, it is only calculated from the values so it doesn't trigger itself
+const referencedConfigHashAnnotation = "vault.banzaicloud.io/referenced-config-hash"
+
+// externalConfigReferences returns the valueFrom references of the external configuration, which are
+// resolved by the configurer from the namespace of the Vault, the invalid ones fail there
+func externalConfigReferences(v *vaultv1alpha1.Vault) []vault.ValueReference {
+	refs, _ := vault.ValueReferences(map[string]interface{}(v.Spec.Federation.MergeExternalConfig(v.Spec.ExternalConfig)))
+	return refs
+}
+
+// referencedValue returns the value of the reference, or false if the object or the key doesn't exist
+func (r *ReconcileVault) referencedValue(namespace string, ref vault.ValueReference) (string, bool, error) {
+	key := client.ObjectKey{Namespace: namespace, Name: ref.Name}
+
+	if ref.Kind == "ConfigMap" {
+		cm := &corev1.ConfigMap{}
+		if err := r.client.Get(context.TODO(), key, cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		if value, ok := cm.Data[ref.Key]; ok {
+			return value, true, nil
+		}
+		value, ok := cm.BinaryData[ref.Key]
+		return string(value), ok, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.client.Get(context.TODO(), key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	value, ok := secret.Data[ref.Key]
+	return string(value), ok, nil
+}
+
+// referencedConfigHash returns the hash of the values referenced by the external configuration, or an empty
+// string if there are no references. Only the referenced keys are hashed, so the changes of other keys in
+// the same objects don't restart anything.
+func (r *ReconcileVault) referencedConfigHash(v *vaultv1alpha1.Vault) (string, error) {
+	refs := externalConfigReferences(v)
+	if len(refs) == 0 {
+		return "", nil
+	}
+
+	var values []string
+	for _, ref := range refs {
+		value, ok, err := r.referencedValue(v.Namespace, ref)
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s %s: %v", ref.Kind, ref.Name, err)
+		}
+		// the missing ones are hashed too, so the configuration is applied again when they are created
+		if !ok {
+			value = "<missing>"
+		}
+		values = append(values, fmt.Sprintf("%s/%s/%s=%s", ref.Kind, ref.Name, ref.Key, value))
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(values, ";;")))), nil
+}
+
+// referencedConfigRequests returns the map function of the watches of the Secrets or ConfigMaps, it enqueues
+// the Vaults in the namespace of the object which reference it from their external configurations
+func referencedConfigRequests(c client.Client, kind string) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []reconcile.Request {
+		vaults := &vaultv1alpha1.VaultList{}
+		if err := c.List(context.TODO(), vaults, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "failed to list vaults for referenced object", "kind", kind, "name", o.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for i := range vaults.Items {
+			v := &vaults.Items[i]
+			for _, ref := range externalConfigReferences(v) {
+				if ref.Kind == kind && ref.Name == o.Meta.GetName() {
+					requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: v.Namespace, Name: v.Name}})
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+const seccompPodAnnotation = "seccomp.security.alpha.kubernetes.io/pod"
+
+// the user and group of the vault user in the official Vault image
+const (
+	vaultUID = int64(100)
+	vaultGID = int64(1000)
+)
+
+// hardenedSecurityContext returns the default SecurityContext of the Vault Pod containers with mlock disabled
+func hardenedSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		RunAsNonRoot:             pointer.BoolPtr(true),
+		ReadOnlyRootFilesystem:   pointer.BoolPtr(true),
+		AllowPrivilegeEscalation: pointer.BoolPtr(false),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+}
+
+// mergeSecurityContext overrides the fields of the SecurityContext with the ones set in the override
+func mergeSecurityContext(sc *corev1.SecurityContext, override *corev1.SecurityContext) *corev1.SecurityContext {
+	if override == nil {
+		return sc
+	}
+	override = override.DeepCopy()
+	if override.Capabilities != nil {
+		sc.Capabilities = override.Capabilities
+	}
+	if override.Privileged != nil {
+		sc.Privileged = override.Privileged
+	}
+	if override.SELinuxOptions != nil {
+		sc.SELinuxOptions = override.SELinuxOptions
+	}
+	if override.WindowsOptions != nil {
+		sc.WindowsOptions = override.WindowsOptions
+	}
+	if override.RunAsUser != nil {
+		sc.RunAsUser = override.RunAsUser
+	}
+	if override.RunAsGroup != nil {
+		sc.RunAsGroup = override.RunAsGroup
+	}
+	if override.RunAsNonRoot != nil {
+		sc.RunAsNonRoot = override.RunAsNonRoot
+	}
+	if override.ReadOnlyRootFilesystem != nil {
+		sc.ReadOnlyRootFilesystem = override.ReadOnlyRootFilesystem
+	}
+	if override.AllowPrivilegeEscalation != nil {
+		sc.AllowPrivilegeEscalation = override.AllowPrivilegeEscalation
+	}
+	if override.ProcMount != nil {
+		sc.ProcMount = override.ProcMount
+	}
+	return sc
+}
+
+// withBankVaultsSecurityContext returns the SecurityContext of the bank-vaults sidecar,
+// which runs as non-root in the bank-vaults image already
+func withBankVaultsSecurityContext(v *vaultv1alpha1.Vault) *corev1.SecurityContext {
+	if !v.Spec.IsMlockDisabled() {
+		return mergeSecurityContext(&corev1.SecurityContext{}, v.Spec.ContainerSecurityContext)
+	}
+	return mergeSecurityContext(hardenedSecurityContext(), v.Spec.ContainerSecurityContext)
+}
+
+func hasCapability(capabilities []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// validateContainerSecurityContext checks that the SecurityContext of the vault container lets the
+// entrypoint of the Vault image grant IPC_LOCK to the vault binary when mlock is enabled:
+// it has to start as root with a writable root filesystem, and switch to the vault user with the capability
+func validateContainerSecurityContext(v *vaultv1alpha1.Vault) error {
+	if v.Spec.IsMlockDisabled() {
+		return nil
+	}
+	sc := withContainerSecurityContext(v)
+	if (sc.RunAsNonRoot != nil && *sc.RunAsNonRoot) || (sc.RunAsUser != nil && *sc.RunAsUser != 0) {
+		return fmt.Errorf("mlock requires the vault container to start as root, set disable_mlock in the config to run as non-root")
+	}
+	if sc.AllowPrivilegeEscalation != nil && !*sc.AllowPrivilegeEscalation {
+		return fmt.Errorf("mlock requires privilege escalation in the vault container, set disable_mlock in the config to disable it")
+	}
+	if sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem {
+		return fmt.Errorf("mlock requires a writable root filesystem in the vault container, set disable_mlock in the config to make it read-only")
+	}
+	if sc.Capabilities == nil || !hasCapability(sc.Capabilities.Add, "IPC_LOCK") {
+		return fmt.Errorf("mlock requires the IPC_LOCK capability in the vault container, add it or set disable_mlock in the config")
+	}
+	return nil
+}
+
+func withSeccompAnnotations(v *vaultv1alpha1.Vault, annotations map[string]string) map[string]string {
+	annotations[seccompPodAnnotation] = v.Spec.GetSeccompProfile()
+	return annotations
+}
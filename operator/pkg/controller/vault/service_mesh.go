@@ -0,0 +1,93 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getClusterPortName returns the name of the Vault cluster port, the mesh detects the protocol from the name prefix
+func getClusterPortName(v *vaultv1alpha1.Vault) string {
+	if v.Spec.IsServiceMesh() {
+		return "tcp-cluster-port"
+	}
+	return "cluster-port"
+}
+
+// getMetricsPortName returns the name of the bank-vaults metrics port
+func getMetricsPortName(v *vaultv1alpha1.Vault) string {
+	if v.Spec.IsServiceMesh() {
+		return "http-metrics"
+	}
+	return "metrics"
+}
+
+// withServiceMeshAnnotations adds the Istio annotations to the Vault Pods, which exclude the ports Vault
+// terminates the mutual TLS of itself from the interception, rewrite the probes so the kubelet can reach
+// them with strict mTLS, and hold the containers until the sidecar is ready
+func withServiceMeshAnnotations(v *vaultv1alpha1.Vault, annotations map[string]string) map[string]string {
+	serviceMesh := v.Spec.GetServiceMesh()
+	if serviceMesh == nil || serviceMesh.Type != vaultv1alpha1.ServiceMeshIstio {
+		return annotations
+	}
+
+	var ports []string
+	for _, port := range serviceMesh.ExcludeInboundPorts {
+		ports = append(ports, strconv.Itoa(int(port)))
+	}
+
+	annotations["traffic.sidecar.istio.io/excludeInboundPorts"] = strings.Join(ports, ",")
+	// the Vault Pods connect to each others' cluster port directly as well
+	annotations["traffic.sidecar.istio.io/excludeOutboundPorts"] = "8201"
+	annotations["sidecar.istio.io/rewriteAppHTTPProbers"] = "true"
+	if *serviceMesh.HoldApplicationUntilProxyStarts {
+		annotations["proxy.istio.io/config"] = "{\"holdApplicationUntilProxyStarts\": true}"
+	}
+
+	return annotations
+}
+
+func headlessServiceName(v *vaultv1alpha1.Vault) string {
+	return fmt.Sprintf("%s-headless", v.Name)
+}
+
+// headlessServiceForVault returns a headless Service for the Vault Pods under a service mesh, so the
+// mesh knows the addresses of all of the Pods (even the not ready ones), which the standby instances
+// and the Raft peers connect to directly, instead of through the ClusterIP of the Vault Service
+func headlessServiceForVault(v *vaultv1alpha1.Vault) *corev1.Service {
+	servicePorts, _ := getServicePorts(v)
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        headlessServiceName(v),
+			Namespace:   v.Namespace,
+			Annotations: withVaultAnnotations(v, getCommonAnnotations(v, map[string]string{})),
+			Labels:      withVaultLabels(v, v.LabelsForVault()),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     corev1.ServiceTypeClusterIP,
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 v.LabelsForVault(),
+			Ports:                    servicePorts,
+			PublishNotReadyAddresses: true,
+		},
+	}
+}
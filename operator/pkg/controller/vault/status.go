@@ -0,0 +1,162 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// configSyncPollInterval is how often the configuration sync is checked until the configurer has applied it
+const configSyncPollInterval = 30 * time.Second
+
+// statusCondition returns a condition which is true if ok, or false with the message
+func statusCondition(conditionType corev1.ComponentConditionType, ok bool, message string) corev1.ComponentCondition {
+	if ok {
+		return corev1.ComponentCondition{Type: conditionType, Status: corev1.ConditionTrue}
+	}
+	return corev1.ComponentCondition{Type: conditionType, Status: corev1.ConditionFalse, Message: message}
+}
+
+// unknownCondition returns a condition which can't be observed, because of the error
+func unknownCondition(conditionType corev1.ComponentConditionType, err string) corev1.ComponentCondition {
+	return corev1.ComponentCondition{Type: conditionType, Status: corev1.ConditionUnknown, Error: err}
+}
+
+// findCondition returns the condition of the type, or nil if there is none
+func findCondition(conditions []corev1.ComponentCondition, conditionType corev1.ComponentConditionType) *corev1.ComponentCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// getStatusJSON decodes the JSON response of a status endpoint of a bank-vaults container
+func (r *ReconcileVault) getStatusJSON(url string, out interface{}) error {
+	resp, err := r.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// configSyncedCondition compares the hash of the externalConfig in the ConfigMap of the configurer to the one
+// last applied by the configurer Pods, it returns the condition and the hash of the last successful apply
+func (r *ReconcileVault) configSyncedCondition(v *vaultv1alpha1.Vault, cm *corev1.ConfigMap) (corev1.ComponentCondition, string) {
+	lastSynced := v.Status.LastSyncedConfigHash
+
+	pods := podList()
+	err := r.client.List(context.TODO(), pods, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultConfigurer()),
+		Namespace:     v.Namespace,
+	})
+	if err != nil {
+		return unknownCondition(vaultv1alpha1.VaultConfigSynced, err.Error()), lastSynced
+	}
+
+	// only the configure leader applies the configuration, the file status with the latest apply is the current one
+	configFile := "/config/" + cm.Name + "/" + vault.DefaultConfigFile
+	var latest *vault.ConfigFileStatus
+	var statusErr error
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		files := map[string]vault.ConfigFileStatus{}
+		if err := r.getStatusJSON(fmt.Sprintf("http://%s:%d/configure/status", pod.Status.PodIP, bankVaultsMetricsPort), &files); err != nil {
+			statusErr = err
+			continue
+		}
+
+		if status, ok := files[configFile]; ok && (latest == nil || status.Applied.After(latest.Applied)) {
+			latest = &status
+		}
+	}
+
+	if latest == nil {
+		if statusErr != nil {
+			return unknownCondition(vaultv1alpha1.VaultConfigSynced, statusErr.Error()), lastSynced
+		}
+		return unknownCondition(vaultv1alpha1.VaultConfigSynced, "the configurer hasn't applied the configuration yet"), lastSynced
+	}
+
+	if latest.Error != "" {
+		condition := statusCondition(vaultv1alpha1.VaultConfigSynced, false, "error applying the configuration")
+		condition.Error = latest.Error
+		return condition, lastSynced
+	}
+
+	current := vault.ConfigHash([]byte(cm.Data[vault.DefaultConfigFile]))
+	return statusCondition(vaultv1alpha1.VaultConfigSynced, latest.Hash == current, "the configurer hasn't applied the current configuration yet"), latest.Hash
+}
+
+// raftHealthyCondition checks the state of the Raft cluster observed by the bank-vaults sidecar of the leader,
+// which is only available if it manages the Raft peers
+func (r *ReconcileVault) raftHealthyCondition(pods []corev1.Pod, leader string) corev1.ComponentCondition {
+	if leader == "" {
+		return unknownCondition(vaultv1alpha1.VaultRaftHealthy, "there is no leader")
+	}
+
+	for _, pod := range pods {
+		if pod.Name != leader {
+			continue
+		}
+
+		var state vault.RaftState
+		if err := r.getStatusJSON(fmt.Sprintf("http://%s:%d/raft/state", pod.Status.PodIP, bankVaultsMetricsPort), &state); err != nil {
+			return unknownCondition(vaultv1alpha1.VaultRaftHealthy, err.Error())
+		}
+
+		return statusCondition(vaultv1alpha1.VaultRaftHealthy, state.Peers > 0 && state.Healthy == state.Peers,
+			fmt.Sprintf("%d of the %d raft peers are healthy (%d voters)", state.Healthy, state.Peers, state.Voters))
+	}
+
+	return unknownCondition(vaultv1alpha1.VaultRaftHealthy, fmt.Sprintf("leader pod %s not found", leader))
+}
+
+// configSyncEvents emits an event if the configurer has failed to apply the configuration with a new error,
+// or if it has applied the configuration successfully after a failure or a change
+func (r *ReconcileVault) configSyncEvents(v *vaultv1alpha1.Vault, previous []corev1.ComponentCondition, current corev1.ComponentCondition) {
+	if r.recorder == nil {
+		return
+	}
+
+	before := findCondition(previous, vaultv1alpha1.VaultConfigSynced)
+	switch {
+	case current.Error != "" && (before == nil || before.Error != current.Error):
+		r.recorder.Eventf(v, corev1.EventTypeWarning, "ConfigApplyFailed", "error applying the configuration: %s", current.Error)
+	case current.Status == corev1.ConditionTrue && before != nil && before.Status != corev1.ConditionTrue:
+		r.recorder.Event(v, corev1.EventTypeNormal, "ConfigSynced", "the configuration has been applied")
+	}
+}
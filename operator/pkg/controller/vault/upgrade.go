@@ -0,0 +1,178 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// approveUpgradeAnnotation approves the upgrade of the active Pod to the update revision it is set to
+const approveUpgradeAnnotation = "vault.banzaicloud.io/approve-upgrade"
+
+// upgradePollInterval is how often a standby-first upgrade in progress is reconciled
+const upgradePollInterval = 10 * time.Second
+
+// vaultPodState is the state of a Vault Pod observed during the upgrade
+type vaultPodState struct {
+	pod      corev1.Pod
+	outdated bool
+	healthy  bool
+	active   bool
+	// healthySince is the last time the Pod became ready
+	healthySince time.Time
+}
+
+// podReadySince returns if the Pod is ready, and since when
+func podReadySince(pod *corev1.Pod) (bool, time.Time) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue, condition.LastTransitionTime.Time
+		}
+	}
+	return false, time.Time{}
+}
+
+// vaultPodStates observes the Pods of the StatefulSet, and the health of Vault in them
+func vaultPodStates(v *vaultv1alpha1.Vault, pods []corev1.Pod, updateRevision string) ([]vaultPodState, error) {
+	states := make([]vaultPodState, 0, len(pods))
+	for _, pod := range pods {
+		state := vaultPodState{
+			pod:      pod,
+			outdated: pod.Labels[appsv1.StatefulSetRevisionLabel] != updateRevision,
+		}
+
+		ready, since := podReadySince(&pod)
+		if ready && pod.DeletionTimestamp == nil {
+			client, err := vault.NewInsecureRawClient()
+			if err != nil {
+				return nil, err
+			}
+			client.SetAddress(fmt.Sprintf("%s://%s.%s:8200", strings.ToLower(string(getVaultURIScheme(v))), pod.Name, v.Namespace))
+
+			health, err := client.Sys().Health()
+			if err == nil && health.Initialized && !health.Sealed {
+				state.healthy = true
+				state.healthySince = since
+				state.active = !health.Standby && !health.PerformanceStandby
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	// the standbys are upgraded in reverse ordinal order, like the StatefulSet controller does
+	sort.Slice(states, func(i, j int) bool { return states[i].pod.Name > states[j].pod.Name })
+
+	return states, nil
+}
+
+// upgradeVault rolls out the update revision of the StatefulSet standby-first: the outdated standby Pods are
+// deleted one at a time after every Pod has been healthy for the PodHealthyTime, then (after the pause or
+// the manual approval) the active Pod, which is stepped down by its preStop hook. It returns the phase of
+// the upgrade for the status and when to reconcile again, the phase is empty if there is nothing to upgrade.
+func (r *ReconcileVault) upgradeVault(v *vaultv1alpha1.Vault) (string, time.Duration, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: v.Namespace, Name: v.Name}, statefulSet)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get StatefulSet: %v", err)
+	}
+
+	updateRevision := statefulSet.Status.UpdateRevision
+	if updateRevision == "" || statefulSet.Status.UpdatedReplicas == statefulSet.Status.Replicas {
+		return "", 0, nil
+	}
+
+	pods := podList()
+	err = r.client.List(context.TODO(), pods, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(v.LabelsForVault()),
+		Namespace:     v.Namespace,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	states, err := vaultPodStates(v, pods.Items, updateRevision)
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	healthyTime := v.Spec.Upgrade.GetPodHealthyTime()
+
+	var outdatedStandbys []vaultPodState
+	var outdatedActive *vaultPodState
+	var lastHealthy time.Time
+	for i := range states {
+		state := &states[i]
+		if !state.healthy || now.Sub(state.healthySince) < healthyTime {
+			// the health of every Pod is verified before the next one is upgraded
+			return "Verifying " + updateRevision, upgradePollInterval, nil
+		}
+		if state.healthySince.After(lastHealthy) {
+			lastHealthy = state.healthySince
+		}
+		if !state.outdated {
+			continue
+		}
+		if state.active {
+			outdatedActive = state
+		} else {
+			outdatedStandbys = append(outdatedStandbys, *state)
+		}
+	}
+
+	if len(outdatedStandbys) > 0 {
+		pod := outdatedStandbys[0].pod
+		log.Info("upgrading standby vault pod", "pod", pod.Name, "revision", updateRevision, "image", v.Spec.Image)
+		if err := r.client.Delete(context.TODO(), &pod); err != nil {
+			return "", 0, fmt.Errorf("failed to delete pod %s: %v", pod.Name, err)
+		}
+		return "UpgradingStandbys " + updateRevision, upgradePollInterval, nil
+	}
+
+	if outdatedActive == nil {
+		// the Pods are healthy, but none of the outdated ones is active yet
+		return "Verifying " + updateRevision, upgradePollInterval, nil
+	}
+
+	if v.Spec.Upgrade.ManualLeaderApproval && v.Annotations[approveUpgradeAnnotation] != updateRevision {
+		return "WaitingForApproval " + updateRevision, upgradePollInterval, nil
+	}
+
+	if pause := v.Spec.Upgrade.GetPauseBeforeLeader(); now.Sub(lastHealthy) < pause {
+		return "PausedBeforeLeader " + updateRevision, upgradePollInterval, nil
+	}
+
+	pod := outdatedActive.pod
+	log.Info("upgrading active vault pod", "pod", pod.Name, "revision", updateRevision, "image", v.Spec.Image)
+	if err := r.client.Delete(context.TODO(), &pod); err != nil {
+		return "", 0, fmt.Errorf("failed to delete pod %s: %v", pod.Name, err)
+	}
+
+	return "UpgradingLeader " + updateRevision, upgradePollInterval, nil
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -37,19 +38,25 @@ import (
 	monitorv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/hashicorp/vault/api"
 	"github.com/imdario/mergo"
-	"github.com/spf13/cast"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -59,7 +66,9 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"github.com/banzaicloud/bank-vaults/internal/mirror"
 	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
 	bvtls "github.com/banzaicloud/bank-vaults/pkg/sdk/tls"
 	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
 )
@@ -68,6 +77,25 @@ var log = logf.Log.WithName("controller_vault")
 
 var configFileNames = []string{"vault-config.yml", "vault-config.yaml"}
 
+// driftRepairSuspendedAnnotation can be set to "true" on an operator managed resource
+// to stop the operator from reverting manual changes made to it
+const driftRepairSuspendedAnnotation = "vault.banzaicloud.io/drift-repair-suspended"
+
+// ownedObjectTypes are watched to detect and revert out-of-band changes to the resources the operator manages
+var ownedObjectTypes = []runtime.Object{
+	&appsv1.StatefulSet{},
+	&appsv1.Deployment{},
+	&appsv1.DaemonSet{},
+	&corev1.Service{},
+	&corev1.ConfigMap{},
+	&networkingv1.NetworkPolicy{},
+	&policyv1beta1.PodDisruptionBudget{},
+	&batchv1beta1.CronJob{},
+	&corev1.ServiceAccount{},
+	&rbacv1.Role{},
+	&rbacv1.RoleBinding{},
+}
+
 // Add creates a new Vault Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -84,11 +112,30 @@ func newReconciler(mgr manager.Manager) (reconcile.Reconciler, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ReconcileVault{
+	imageMirrors, err := imageMirrorsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := metricsRecorderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	reconciler := &ReconcileVault{
 		client:              mgr.GetClient(),
 		nonNamespacedClient: nonNamespacedClient,
 		scheme:              mgr.GetScheme(),
 		httpClient:          newHTTPClient(),
+		recorder:            mgr.GetEventRecorderFor("vault-controller"),
+		imageMirrors:        imageMirrors,
+		driftRepairs: recorder.Counter(
+			"drift_repairs_total",
+			"Number of out-of-band changes of the operator managed resources reverted, by resource kind.",
+			"kind",
+		),
+	}
+	return &recoveringReconciler{
+		Reconciler: reconciler,
+		panics:     recorder.Counter("recovered_panics_total", "Number of reconciliations of Vault resources which panicked."),
 	}, nil
 }
 
@@ -106,6 +153,66 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch for changes to the VaultPolicies, VaultRoles and VaultSecretEngines, which are merged into the external config of the Vault they reference.
+	// They are in the namespaces of the teams, so they are watched with a cluster-wide cache, the one of the manager is restricted to WATCH_NAMESPACE.
+	clusterCache, err := cache.New(mgr.GetConfig(), cache.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		return err
+	}
+	err = mgr.Add(clusterCache)
+	if err != nil {
+		return err
+	}
+	for t, toRequests := range map[runtime.Object]handler.ToRequestsFunc{
+		&vaultv1alpha1.VaultPolicy{}:       vaultPolicyRequests,
+		&vaultv1alpha1.VaultRole{}:         vaultRoleRequests,
+		&vaultv1alpha1.VaultSecretEngine{}: vaultSecretEngineRequests,
+	} {
+		informer, err := clusterCache.GetInformer(t)
+		if err != nil {
+			return err
+		}
+		err = c.Watch(&source.Informer{Informer: informer}, &handler.EnqueueRequestsFromMapFunc{ToRequests: toRequests})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch for the renewals of the TLS Secrets issued by cert-manager
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(certManagerSecretRequests)})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the Secrets and ConfigMaps referenced by the external configurations
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: referencedConfigRequests(mgr.GetClient(), "Secret")})
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: referencedConfigRequests(mgr.GetClient(), "ConfigMap")})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to secondary resources owned by Vault, to repair drift
+	for _, t := range ownedObjectTypes {
+		err = c.Watch(&source.Kind{Type: t}, &handler.EnqueueRequestForOwner{
+			IsController: true,
+			OwnerType:    &vaultv1alpha1.Vault{},
+		}, ownedObjectChanged)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch for changes to the RBAC objects which can't be owned by Vault, to repair drift
+	for _, t := range []runtime.Object{&rbacv1.Role{}, &rbacv1.RoleBinding{}, &rbacv1.ClusterRoleBinding{}} {
+		err = c.Watch(&source.Kind{Type: t}, &handler.EnqueueRequestsFromMapFunc{ToRequests: annotatedVaultRequests}, ownedObjectChanged)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -121,16 +228,65 @@ type ReconcileVault struct {
 	nonNamespacedClient client.Client
 	scheme              *runtime.Scheme
 	httpClient          *http.Client
+	recorder            record.EventRecorder
+	// imageMirrors rewrites the images of the deployed containers for air-gapped clusters
+	imageMirrors mirror.Mirrors
+	// driftRepairs counts the reverted out-of-band changes
+	driftRepairs metrics.Counter
 }
 
 func (r *ReconcileVault) createOrUpdateObject(o runtime.Object) error {
-	return createOrUpdateObjectWithClient(r.client, o)
+	drifted, err := createOrUpdateObjectWithDriftCheck(r.client, o)
+	if err == nil && drifted && r.driftRepairs != nil {
+		r.driftRepairs.Add(1, reflect.TypeOf(o).Elem().Name())
+	}
+	if err == nil && drifted && r.recorder != nil {
+		r.recorder.Eventf(o, corev1.EventTypeWarning, "DriftRepaired",
+			"Reverted out-of-band changes, set the %s annotation to \"true\" to suspend this", driftRepairSuspendedAnnotation)
+	}
+	return err
+}
+
+// createOrUpdateUnstructured creates or updates the spec of a resource of an API the operator doesn't depend on,
+// the Vault instance is set as its controller if they are in the same namespace
+func (r *ReconcileVault) createOrUpdateUnstructured(v *vaultv1alpha1.Vault, o *unstructured.Unstructured) error {
+	c := r.client
+	if o.GetNamespace() == v.Namespace {
+		if err := controllerutil.SetControllerReference(v, o, r.scheme); err != nil {
+			return err
+		}
+	} else {
+		// Owner references can't point to other namespaces, these objects have to be deleted manually
+		c = r.nonNamespacedClient
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(o.GroupVersionKind())
+	err := c.Get(context.TODO(), types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}, current)
+	if apierrors.IsNotFound(err) {
+		return c.Create(context.TODO(), o)
+	} else if err != nil {
+		return err
+	}
+
+	current.Object["spec"] = o.Object["spec"]
+	current.SetLabels(o.GetLabels())
+	current.SetOwnerReferences(o.GetOwnerReferences())
+
+	return c.Update(context.TODO(), current)
 }
 
 func createOrUpdateObjectWithClient(c client.Client, o runtime.Object) error {
+	_, err := createOrUpdateObjectWithDriftCheck(c, o)
+	return err
+}
+
+// createOrUpdateObjectWithDriftCheck creates or updates the object, and reports if the update
+// reverted changes which were made to the object outside of the operator.
+func createOrUpdateObjectWithDriftCheck(c client.Client, o runtime.Object) (bool, error) {
 	key, err := client.ObjectKeyFromObject(o)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	current := o.DeepCopyObject()
@@ -141,8 +297,15 @@ func createOrUpdateObjectWithClient(c client.Client, o runtime.Object) error {
 		if err != nil {
 			log.Error(err, "failed to annotate original object", "object", o)
 		}
-		return c.Create(context.TODO(), o)
+		return false, c.Create(context.TODO(), o)
 	} else if err == nil {
+		objectMeta := o.(metav1.ObjectMetaAccessor).GetObjectMeta()
+
+		if current.(metav1.ObjectMetaAccessor).GetObjectMeta().GetAnnotations()[driftRepairSuspendedAnnotation] == "true" {
+			log.Info(fmt.Sprintf("Drift repair is suspended for object %s:%s, skipping update", o.GetObjectKind(), objectMeta.GetName()))
+			return false, nil
+		}
+
 		// Handle special cases for update
 		switch o.(type) {
 		case *corev1.Service:
@@ -162,6 +325,9 @@ func createOrUpdateObjectWithClient(c client.Client, o runtime.Object) error {
 					svc.Spec.Ports[i].NodePort = currentSvc.Spec.Ports[i].NodePort
 				}
 			}
+		case *corev1.ServiceAccount:
+			// Preserve the token Secrets added by the token controller
+			o.(*corev1.ServiceAccount).Secrets = current.(*corev1.ServiceAccount).Secrets
 		}
 
 		result, err := patch.DefaultPatchMaker.Calculate(current, o, patch.IgnoreStatusFields())
@@ -171,10 +337,13 @@ func createOrUpdateObjectWithClient(c client.Client, o runtime.Object) error {
 			resourceVersion := current.(metav1.ObjectMetaAccessor).GetObjectMeta().GetResourceVersion()
 			o.(metav1.ObjectMetaAccessor).GetObjectMeta().SetResourceVersion(resourceVersion)
 
-			return c.Update(context.TODO(), o)
+			return false, c.Update(context.TODO(), o)
 		}
 
 		if !result.IsEmpty() {
+			// If the desired state is the same as the last applied one, the object has been changed by someone else
+			drifted := sameConfiguration(result.Original, result.Modified)
+
 			log.V(1).Info(fmt.Sprintf("Resource update for object %s:%s", o.GetObjectKind(), o.(metav1.ObjectMetaAccessor).GetObjectMeta().GetName()),
 				"patch", string(result.Patch),
 				// "original", string(result.Original),
@@ -190,13 +359,50 @@ func createOrUpdateObjectWithClient(c client.Client, o runtime.Object) error {
 			resourceVersion := current.(metav1.ObjectMetaAccessor).GetObjectMeta().GetResourceVersion()
 			o.(metav1.ObjectMetaAccessor).GetObjectMeta().SetResourceVersion(resourceVersion)
 
-			return c.Update(context.TODO(), o)
+			err = c.Update(context.TODO(), o)
+			if err == nil && drifted {
+				log.Info(fmt.Sprintf("Reverted out-of-band changes of object %s:%s", o.GetObjectKind(), objectMeta.GetName()))
+			}
+
+			return drifted, err
 		}
 
 		log.V(1).Info(fmt.Sprintf("Skipping update for object %s:%s", o.GetObjectKind(), o.(metav1.ObjectMetaAccessor).GetObjectMeta().GetName()))
 	}
 
-	return err
+	return false, err
+}
+
+// sameConfiguration compares the last applied and the desired configuration of an object, ignoring the status
+func sameConfiguration(original, modified []byte) bool {
+	if len(original) == 0 {
+		return false
+	}
+
+	var originalObject, modifiedObject map[string]interface{}
+	if err := json.Unmarshal(original, &originalObject); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(modified, &modifiedObject); err != nil {
+		return false
+	}
+
+	delete(originalObject, "status")
+	delete(modifiedObject, "status")
+
+	originalJSON, _ := json.Marshal(originalObject)
+	modifiedJSON, _ := json.Marshal(modifiedObject)
+
+	originalJSON, _, err := patch.DeleteNullInJson(originalJSON)
+	if err != nil {
+		return false
+	}
+	modifiedJSON, _, err = patch.DeleteNullInJson(modifiedJSON)
+	if err != nil {
+		return false
+	}
+
+	return string(originalJSON) == string(modifiedJSON)
 }
 
 // Check if secret match the labels or annotations selectors
@@ -265,13 +471,63 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		if apierrors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// The VaultSecretEngines referencing it can't be unmounted anymore, so they are released.
 			// Return and don't requeue
-			return reconcile.Result{}, nil
+			return reconcile.Result{}, r.releaseVaultSecretEngines(request.NamespacedName)
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
+	deleting, err := r.reconcileDeletionProtection(v)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if deleting {
+		return reconcile.Result{}, r.releaseVaultSecretEngines(request.NamespacedName)
+	}
+
+	if isPaused(v) {
+		reqLogger.Info("Reconciliation of Vault is paused", "annotation", pausedAnnotation)
+		return reconcile.Result{}, nil
+	}
+
+	if v.Spec.Federation != nil {
+		if err := v.Spec.Federation.Validate(); err != nil {
+			if r.recorder != nil {
+				r.recorder.Event(v, corev1.EventTypeWarning, "InvalidFederation", err.Error())
+			}
+			return reconcile.Result{}, fmt.Errorf("invalid federation: %v", err)
+		}
+	}
+
+	if err := validateContainerSecurityContext(v); err != nil {
+		if r.recorder != nil {
+			r.recorder.Event(v, corev1.EventTypeWarning, "InvalidSecurityContext", err.Error())
+		}
+		return reconcile.Result{}, fmt.Errorf("invalid security context: %v", err)
+	}
+
+	if v.Spec.Backup != nil {
+		if err := validateBackupSchedule(v); err != nil {
+			if r.recorder != nil {
+				r.recorder.Event(v, corev1.EventTypeWarning, "InvalidBackupSchedule", err.Error())
+			}
+			return reconcile.Result{}, fmt.Errorf("invalid backup schedule: %v", err)
+		}
+	}
+
+	// Only the configurer and the unsealer run for an externally managed Vault
+	if v.Spec.IsExternalVault() {
+		if err := validateExternalVault(v); err != nil {
+			if r.recorder != nil {
+				r.recorder.Event(v, corev1.EventTypeWarning, "InvalidExternalVault", err.Error())
+			}
+			return reconcile.Result{}, fmt.Errorf("invalid external vault: %v", err)
+		}
+		return r.reconcileExternalVault(request, v)
+	}
+
 	// check if we need to create an etcd cluster
 	// if etcd size is < 0. Will not create etcd cluster
 	if v.Spec.HasEtcdStorage() && v.Spec.GetEtcdSize() > 0 {
@@ -279,6 +535,7 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		if err != nil {
 			return reconcile.Result{}, fmt.Errorf("failed to fabricate etcd cluster: %v", err)
 		}
+		mirrorEtcdImages(r.imageMirrors, etcdCluster)
 
 		// Create the secret if it doesn't exist
 		sec, err := secretForEtcd(v, etcdCluster)
@@ -352,28 +609,50 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		}
 	}
 
+	if v.Spec.IsServiceMesh() {
+		headlessService := headlessServiceForVault(v)
+		// Set Vault instance as the owner and controller
+		if err := controllerutil.SetControllerReference(v, headlessService, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+		err = r.createOrUpdateObject(headlessService)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update headless service: %v", err)
+		}
+	}
+
 	tlsExpiration := time.Time{}
+	tlsCAExpiration := time.Time{}
 	if !v.Spec.IsTLSDisabled() {
-		// Check if we have an existing TLS Secret for Vault
-		secretName := v.Name + "-tls"
-		if v.Spec.ExistingTLSSecretName != "" {
-			secretName = v.Spec.ExistingTLSSecretName
+		// Request the TLS Secret from cert-manager
+		if v.Spec.IsCertManagerTLS() {
+			if err := r.createOrUpdateUnstructured(v, certificateForVault(v, service)); err != nil {
+				return reconcile.Result{}, fmt.Errorf("failed to create/update cert-manager certificate: %v", err)
+			}
 		}
+
+		// Check if we have an existing TLS Secret for Vault
+		secretName := v.GetTLSSecretName()
 		sec := &corev1.Secret{}
 		// Get tls secret
 		err := r.client.Get(context.TODO(), types.NamespacedName{
 			Namespace: v.Namespace,
 			Name:      secretName,
 		}, sec)
-		if apierrors.IsNotFound(err) && v.Spec.ExistingTLSSecretName == "" {
+		if apierrors.IsNotFound(err) && v.Spec.IsCertManagerTLS() {
+			// The Secret is created by cert-manager when the certificate has been issued
+			reqLogger.Info("waiting for cert-manager to issue the TLS certificate", "secret", secretName)
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		} else if apierrors.IsNotFound(err) && !v.Spec.HasExternalTLSSecret() {
 			// If tls secret doesn't exist generate tls
 			tlsExpiration, err = populateTLSSecret(v, service, sec)
 			if err != nil {
 				return reconcile.Result{}, fmt.Errorf("failed to fabricate secret for vault: %v", err)
 			}
+			tlsCAExpiration = caExpiration(sec)
 		} else if err != nil {
 			return reconcile.Result{}, fmt.Errorf("failed to get tls secret for vault: %v", err)
-		} else if v.Spec.ExistingTLSSecretName == "" && len(sec.Data) > 0 {
+		} else if !v.Spec.HasExternalTLSSecret() && len(sec.Data) > 0 {
 			// If tls secret exists check expiration date and if hosts have changed
 			certificate, err := bvtls.PEMToCertificate(sec.Data["server.crt"])
 			if err != nil {
@@ -384,6 +663,7 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 			tlsHostsChanged := certHostsAndIPsChanged(v, service, certificate)
 
 			// Do we need to regenerate the TLS certificate and possibly even the CA?
+			rotated := true
 			if time.Until(tlsExpiration) < v.Spec.GetTLSExpiryThreshold() {
 				// Generate new TLS server certificate if expiration date is too close
 				reqLogger.Info("cert expiration date too close", "date", tlsExpiration.UTC().Format(time.RFC3339))
@@ -392,14 +672,26 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 				// Generate new TLS server certificate if the TLS hosts have changed
 				reqLogger.Info("TLS server hosts have changed")
 				tlsExpiration, err = populateTLSSecret(v, service, sec)
+			} else {
+				rotated = false
 			}
 			if err != nil {
 				return reconcile.Result{}, fmt.Errorf("failed to fabricate secret for vault: %v", err)
 			}
+			tlsCAExpiration = caExpiration(sec)
+			if rotated && r.recorder != nil {
+				r.recorder.Eventf(v, corev1.EventTypeNormal, "TLSCertificateRotated",
+					"TLS server certificate renewed, it expires at %s", tlsExpiration.UTC().Format(time.RFC3339))
+			}
+		} else {
+			if v.Spec.IsCertManagerTLS() {
+				tlsExpiration, _ = bvtls.GetCertExpirationDate(sec.Data[corev1.TLSCertKey])
+			}
+			tlsCAExpiration = caExpiration(sec)
 		}
 
 		// Set Vault instance as the owner and controller
-		if v.Spec.ExistingTLSSecretName == "" {
+		if !v.Spec.HasExternalTLSSecret() {
 			if err := controllerutil.SetControllerReference(v, sec, r.scheme); err != nil {
 				return reconcile.Result{}, err
 			}
@@ -432,6 +724,23 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		}
 	}
 
+	if v.Spec.IsAuditLogShippingEnabled() {
+		cm, err := configMapForAuditLogShipping(v)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to generate audit log shipper configmap: %v", err)
+		}
+
+		// Set Vault instance as the owner and controller
+		if err := controllerutil.SetControllerReference(v, cm, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		err = r.createOrUpdateObject(cm)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update audit log shipper configmap: %v", err)
+		}
+	}
+
 	if !v.Spec.IsStatsDDisabled() {
 		// Create the configmap if it doesn't exist
 		cm := configMapForStatsD(v)
@@ -472,14 +781,36 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 
 	}
 
+	// Create the ServiceAccounts and Roles if specified, before the Pods using them
+	if err := r.reconcileRBAC(v); err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Create the StatefulSet if it doesn't exist
 	tlsAnnotations := map[string]string{}
 	tlsAnnotations["vault.banzaicloud.io/tls-expiration-date"] = tlsExpiration.UTC().Format(time.RFC3339)
-	statefulSet, err := statefulSetForVault(v, externalSecretsToWatchItems, tlsAnnotations, service)
+	// Vault reloads the renewed server certificate itself, the Pods are only restarted if the CA changes
+	vaultTLSAnnotations := tlsAnnotations
+	if v.Spec.IsTLSReload() {
+		vaultTLSAnnotations = map[string]string{
+			"vault.banzaicloud.io/tls-ca-expiration-date": tlsCAExpiration.UTC().Format(time.RFC3339),
+		}
+	}
+	statefulSet, err := statefulSetForVault(v, externalSecretsToWatchItems, vaultTLSAnnotations, service)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("failed to fabricate StatefulSet: %v", err)
 	}
 
+	// Roll the configurer (and the Vault Pods if requested) when a value referenced by the externalConfig changes
+	referencedConfigHash, err := r.referencedConfigHash(v)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to hash referenced config: %v", err)
+	}
+	if referencedConfigHash != "" && v.Spec.RestartOnReferencedConfigChange {
+		statefulSet.Spec.Template.Annotations[referencedConfigHashAnnotation] = referencedConfigHash
+	}
+	mirrorPodSpecImages(r.imageMirrors, &statefulSet.Spec.Template.Spec)
+
 	// Set Vault instance as the owner and controller
 	if err := controllerutil.SetControllerReference(v, statefulSet, r.scheme); err != nil {
 		return reconcile.Result{}, err
@@ -490,87 +821,142 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		return reconcile.Result{}, fmt.Errorf("failed to create/update StatefulSet: %v", err)
 	}
 
-	if v.Spec.ServiceMonitorEnabled {
-		// Create the ServiceMonitor if it doesn't exist
-		serviceMonitor := serviceMonitorForVault(v)
-		// Set Vault instance as the owner and controller
-		if err := controllerutil.SetControllerReference(v, serviceMonitor, r.scheme); err != nil {
-			return reconcile.Result{}, err
-		}
-		err = r.createOrUpdateObject(serviceMonitor)
+	// Roll out the changes of the Vault Pods standby-first
+	var upgradePhase string
+	var requeueAfter time.Duration
+	if v.Spec.Upgrade != nil {
+		upgradePhase, requeueAfter, err = r.upgradeVault(v)
 		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("failed to create/update serviceMonitor: %v", err)
+			return reconcile.Result{}, fmt.Errorf("failed to upgrade vault: %v", err)
 		}
 	}
 
-	// Create the configmap if it doesn't exist
-	cm := configMapForConfigurer(v)
+	if v.Spec.IsServiceMonitorEnabled() {
+		// Create the ServiceMonitors if they don't exist
+		serviceMonitors := []*monitorv1.ServiceMonitor{serviceMonitorForVault(v)}
+		if v.Spec.Monitoring != nil {
+			serviceMonitors = append(serviceMonitors, serviceMonitorForBankVaults(v))
+		}
+		for _, serviceMonitor := range serviceMonitors {
+			// Set Vault instance as the owner and controller
+			if err := controllerutil.SetControllerReference(v, serviceMonitor, r.scheme); err != nil {
+				return reconcile.Result{}, err
+			}
+			err = r.createOrUpdateObject(serviceMonitor)
+			if err != nil {
+				return reconcile.Result{}, fmt.Errorf("failed to create/update serviceMonitor: %v", err)
+			}
+		}
+	}
 
-	// Set Vault instance as the owner and controller
-	if err := controllerutil.SetControllerReference(v, cm, r.scheme); err != nil {
-		return reconcile.Result{}, err
+	if v.Spec.Monitoring != nil && v.Spec.Monitoring.GrafanaDashboards != nil {
+		cm, err := grafanaDashboardForVault(v)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to generate grafana dashboard configmap: %v", err)
+		}
+
+		if cm.Namespace == v.Namespace {
+			// Set Vault instance as the owner and controller
+			if err := controllerutil.SetControllerReference(v, cm, r.scheme); err != nil {
+				return reconcile.Result{}, err
+			}
+			err = r.createOrUpdateObject(cm)
+		} else {
+			// Owner references can't point to other namespaces, this ConfigMap has to be deleted manually
+			err = createOrUpdateObjectWithClient(r.nonNamespacedClient, cm)
+		}
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update grafana dashboard configmap: %v", err)
+		}
 	}
 
-	err = r.createOrUpdateObject(cm)
+	// Create the configurer of Vault
+	cm, err := r.reconcileConfigurer(v, tlsAnnotations, referencedConfigHash)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to create/update configurer configmap: %v", err)
+		return reconcile.Result{}, err
 	}
 
-	externalConfigMaps := corev1.ConfigMapList{}
-	externalConfigMapsFilter := client.ListOptions{
-		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultConfigurer()),
-		Namespace:     v.Namespace,
-	}
-	if err = r.client.List(context.TODO(), &externalConfigMaps, &externalConfigMapsFilter); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to list configmaps: %v", err)
-	}
+	// Create ingress if specificed
+	if ingress := ingressForVault(v); ingress != nil {
+		// Set Vault instance as the owner and controller
+		if err := controllerutil.SetControllerReference(v, ingress, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
 
-	externalSecrets := corev1.SecretList{}
-	externalSecretsFilter := client.ListOptions{
-		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultConfigurer()),
-		Namespace:     v.Namespace,
-	}
-	if err = r.client.List(context.TODO(), &externalSecrets, &externalSecretsFilter); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to list secrets: %v", err)
+		err = r.createOrUpdateObject(ingress)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update ingress: %v", err)
+		}
 	}
 
-	// Create the deployment if it doesn't exist
-	configurerDep, err := deploymentForConfigurer(v, externalConfigMaps, externalSecrets, tlsAnnotations)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to fabricate deployment: %v", err)
-	}
+	// Create network policies if specified
+	for _, networkPolicy := range networkPoliciesForVault(v) {
+		// Set Vault instance as the owner and controller
+		if err := controllerutil.SetControllerReference(v, networkPolicy, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
 
-	// Set Vault instance as the owner and controller
-	if err := controllerutil.SetControllerReference(v, configurerDep, r.scheme); err != nil {
-		return reconcile.Result{}, err
+		err = r.createOrUpdateObject(networkPolicy)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update network policy: %v", err)
+		}
 	}
-	err = r.createOrUpdateObject(configurerDep)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to create/update configurer deployment: %v", err)
+	if v.Spec.NetworkPolicy == nil {
+		if err := r.deleteNetworkPolicies(v); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	// Create the Configurer service if it doesn't exist
-	configurerSer := serviceForVaultConfigurer(v)
-	// Set Vault instance as the owner and controller
-	if err := controllerutil.SetControllerReference(v, configurerSer, r.scheme); err != nil {
-		return reconcile.Result{}, err
-	}
+	// Create the PodDisruptionBudget if specified
+	if pdb := podDisruptionBudgetForVault(v); pdb != nil {
+		// Set Vault instance as the owner and controller
+		if err := controllerutil.SetControllerReference(v, pdb, r.scheme); err != nil {
+			return reconcile.Result{}, err
+		}
 
-	err = r.createOrUpdateObject(configurerSer)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to create/update service: %v", err)
+		err = r.createOrUpdateObject(pdb)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("failed to create/update pod disruption budget: %v", err)
+		}
 	}
 
-	// Create ingress if specificed
-	if ingress := ingressForVault(v); ingress != nil {
+	// Schedule the Raft snapshots if specified
+	if v.Spec.Backup != nil {
+		cronJob := cronJobForBackup(v)
 		// Set Vault instance as the owner and controller
-		if err := controllerutil.SetControllerReference(v, ingress, r.scheme); err != nil {
+		if err := controllerutil.SetControllerReference(v, cronJob, r.scheme); err != nil {
 			return reconcile.Result{}, err
 		}
 
-		err = r.createOrUpdateObject(ingress)
+		err = r.createOrUpdateObject(cronJob)
 		if err != nil {
-			return reconcile.Result{}, fmt.Errorf("failed to create/update ingress: %v", err)
+			return reconcile.Result{}, fmt.Errorf("failed to create/update backup cronjob: %v", err)
+		}
+	}
+
+	// Deploy the Vault CSI provider if specified
+	if v.Spec.CSIProvider != nil {
+		for _, o := range []runtime.Object{serviceAccountForCSIProvider(v), daemonSetForCSIProvider(v)} {
+			// Set Vault instance as the owner and controller
+			if err := controllerutil.SetControllerReference(v, o.(metav1.Object), r.scheme); err != nil {
+				return reconcile.Result{}, err
+			}
+
+			err = r.createOrUpdateObject(o)
+			if err != nil {
+				return reconcile.Result{}, fmt.Errorf("failed to create/update csi provider: %v", err)
+			}
+		}
+
+		secretProviderClasses, err := secretProviderClassesForVault(v)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		for _, secretProviderClass := range secretProviderClasses {
+			err = r.createOrUpdateUnstructured(v, secretProviderClass)
+			if err != nil {
+				return reconcile.Result{}, fmt.Errorf("failed to create/update secret provider class: %v", err)
+			}
 		}
 	}
 
@@ -589,6 +975,8 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 
 	var leader string
 	var statusError string
+	var initialized bool
+	var sealed []string
 	for i := 0; i < int(v.Spec.Size); i++ {
 		client, err := vault.NewInsecureRawClient()
 		if err != nil {
@@ -602,11 +990,64 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		if err != nil {
 			statusError = err.Error()
 			break
-		} else if !health.Standby {
+		}
+		if health.Initialized {
+			initialized = true
+		}
+		if health.Sealed {
+			sealed = append(sealed, podName)
+		}
+		if !health.Standby {
 			leader = podName
 		}
 	}
 
+	conditionStatus := v1.ConditionFalse
+	if leader != "" && statusError == "" {
+		conditionStatus = v1.ConditionTrue
+	}
+	conditions := []v1.ComponentCondition{{
+		Type:   v1.ComponentHealthy,
+		Status: conditionStatus,
+		Error:  statusError,
+	}}
+	if statusError != "" {
+		conditions = append(conditions,
+			unknownCondition(vaultv1alpha1.VaultInitialized, statusError),
+			unknownCondition(vaultv1alpha1.VaultUnsealed, statusError))
+	} else {
+		conditions = append(conditions,
+			statusCondition(vaultv1alpha1.VaultInitialized, initialized, "vault is not initialized"),
+			statusCondition(vaultv1alpha1.VaultUnsealed, len(sealed) == 0, fmt.Sprintf("sealed instances: %s", strings.Join(sealed, ", "))))
+	}
+	configSynced, lastSyncedConfigHash := r.configSyncedCondition(v, cm)
+	conditions = append(conditions, configSynced)
+	if v.Spec.IsRaftStorage() {
+		conditions = append(conditions, r.raftHealthyCondition(podList.Items, leader))
+	}
+	var backupStatus *vaultv1alpha1.BackupStatus
+	var backupSucceeded v1.ComponentCondition
+	if v.Spec.Backup != nil {
+		backupStatus, backupSucceeded = r.backupStatusForVault(v)
+		conditions = append(conditions, backupSucceeded)
+	}
+
+	// the configuration is applied asynchronously by the configurer, it is checked again until it is synced
+	if configSynced.Status != v1.ConditionTrue && (requeueAfter == 0 || requeueAfter > configSyncPollInterval) {
+		requeueAfter = configSyncPollInterval
+	}
+
+	// the generated certificate is renewed when its expiration gets closer than the threshold, even without changes
+	if !tlsExpiration.IsZero() && !v.Spec.HasExternalTLSSecret() {
+		renewAfter := time.Until(tlsExpiration) - v.Spec.GetTLSExpiryThreshold() + time.Minute
+		if renewAfter < time.Minute {
+			renewAfter = time.Minute
+		}
+		if requeueAfter == 0 || requeueAfter > renewAfter {
+			requeueAfter = renewAfter
+		}
+	}
+
 	// Fetch the Vault instance again to minimize the possibility of updating a stale object
 	// see https://github.com/banzaicloud/bank-vaults/issues/364
 	v = &vaultv1alpha1.Vault{}
@@ -622,18 +1063,26 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		return reconcile.Result{}, err
 	}
 
-	if !reflect.DeepEqual(podNames, v.Status.Nodes) || !reflect.DeepEqual(leader, v.Status.Leader) {
+	r.configSyncEvents(v, v.Status.Conditions, configSynced)
+	if v.Spec.Backup != nil {
+		r.backupEvents(v, v.Status.Conditions, backupSucceeded)
+	}
+
+	replication := replicationStatusForVault(v, leader)
+	if len(replication) > 0 && (requeueAfter == 0 || requeueAfter > replicationStatusPollInterval) {
+		requeueAfter = replicationStatusPollInterval
+	}
+
+	if !reflect.DeepEqual(podNames, v.Status.Nodes) || !reflect.DeepEqual(leader, v.Status.Leader) || upgradePhase != v.Status.Upgrade ||
+		!reflect.DeepEqual(conditions, v.Status.Conditions) || lastSyncedConfigHash != v.Status.LastSyncedConfigHash ||
+		!reflect.DeepEqual(replication, v.Status.Replication) || !reflect.DeepEqual(backupStatus, v.Status.Backup) {
 		v.Status.Nodes = podNames
 		v.Status.Leader = leader
-		conditionStatus := v1.ConditionFalse
-		if leader != "" && statusError == "" {
-			conditionStatus = v1.ConditionTrue
-		}
-		v.Status.Conditions = []v1.ComponentCondition{{
-			Type:   v1.ComponentHealthy,
-			Status: conditionStatus,
-			Error:  statusError,
-		}}
+		v.Status.Upgrade = upgradePhase
+		v.Status.Conditions = conditions
+		v.Status.LastSyncedConfigHash = lastSyncedConfigHash
+		v.Status.Replication = replication
+		v.Status.Backup = backupStatus
 		log.V(1).Info("Updating vault status", "status", v.Status, "resourceVersion", v.ResourceVersion)
 		err := r.client.Update(context.TODO(), v)
 		if err != nil {
@@ -641,7 +1090,118 @@ func (r *ReconcileVault) Reconcile(request reconcile.Request) (reconcile.Result,
 		}
 	}
 
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// reconcileRBAC creates the ServiceAccounts and Roles of the Vault and configurer Pods if specified
+func (r *ReconcileVault) reconcileRBAC(v *vaultv1alpha1.Vault) error {
+	for _, o := range rbacForVault(v) {
+		var err error
+		object := o.(metav1.Object)
+		if object.GetNamespace() == v.Namespace {
+			// Set Vault instance as the owner and controller
+			if err := controllerutil.SetControllerReference(v, object, r.scheme); err != nil {
+				return err
+			}
+			err = r.createOrUpdateObject(o)
+		} else {
+			// Owner references can't point to other namespaces, these objects have to be deleted manually
+			setVaultAnnotation(v, object)
+			err = createOrUpdateObjectWithClient(r.nonNamespacedClient, o)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create/update RBAC object %s: %v", object.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// reconcileConfigurer creates the ConfigMap of the externalConfig, the Deployment and the Service
+// of the configurer, it returns the ConfigMap for checking if its config has been applied
+func (r *ReconcileVault) reconcileConfigurer(v *vaultv1alpha1.Vault, tlsAnnotations map[string]string, referencedConfigHash string) (*corev1.ConfigMap, error) {
+	vaultPolicies, err := r.vaultPoliciesForVault(v)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultRoles, err := r.vaultRolesForVault(v)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultSecretEngines, err := r.vaultSecretEnginesForVault(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the configmap if it doesn't exist
+	cm := configMapForConfigurer(v, vaultv1alpha1.ExternalConfigResources{
+		Policies:             vaultPolicies,
+		Roles:                vaultRoles,
+		SecretEngines:        vaultSecretEngines,
+		RemovedSecretEngines: v.Status.RemovedSecretEngines,
+	})
+
+	// Set Vault instance as the owner and controller
+	if err := controllerutil.SetControllerReference(v, cm, r.scheme); err != nil {
+		return nil, err
+	}
+
+	err = r.createOrUpdateObject(cm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/update configurer configmap: %v", err)
+	}
+
+	externalConfigMaps := corev1.ConfigMapList{}
+	externalConfigMapsFilter := client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultConfigurer()),
+		Namespace:     v.Namespace,
+	}
+	if err := r.client.List(context.TODO(), &externalConfigMaps, &externalConfigMapsFilter); err != nil {
+		return nil, fmt.Errorf("failed to list configmaps: %v", err)
+	}
+
+	externalSecrets := corev1.SecretList{}
+	externalSecretsFilter := client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(v.LabelsForVaultConfigurer()),
+		Namespace:     v.Namespace,
+	}
+	if err := r.client.List(context.TODO(), &externalSecrets, &externalSecretsFilter); err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %v", err)
+	}
+
+	// Create the deployment if it doesn't exist
+	configurerDep, err := deploymentForConfigurer(v, externalConfigMaps, externalSecrets, tlsAnnotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fabricate deployment: %v", err)
+	}
+	mirrorPodSpecImages(r.imageMirrors, &configurerDep.Spec.Template.Spec)
+	if referencedConfigHash != "" {
+		configurerDep.Spec.Template.Annotations[referencedConfigHashAnnotation] = referencedConfigHash
+	}
+
+	// Set Vault instance as the owner and controller
+	if err := controllerutil.SetControllerReference(v, configurerDep, r.scheme); err != nil {
+		return nil, err
+	}
+	err = r.createOrUpdateObject(configurerDep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/update configurer deployment: %v", err)
+	}
+
+	// Create the Configurer service if it doesn't exist
+	configurerSer := serviceForVaultConfigurer(v)
+	// Set Vault instance as the owner and controller
+	if err := controllerutil.SetControllerReference(v, configurerSer, r.scheme); err != nil {
+		return nil, err
+	}
+
+	err = r.createOrUpdateObject(configurerSer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/update service: %v", err)
+	}
+
+	return cm, nil
 }
 
 func newHTTPClient() *http.Client {
@@ -747,7 +1307,7 @@ func serviceForVault(v *vaultv1alpha1.Vault) *corev1.Service {
 		annotations["cloud.google.com/app-protocols"] = fmt.Sprintf("{\"%s\":\"HTTPS\"}", v.Spec.GetAPIPortName())
 	}
 
-	servicePorts = append(servicePorts, corev1.ServicePort{Name: "metrics", Port: 9091})
+	servicePorts = append(servicePorts, corev1.ServicePort{Name: getMetricsPortName(v), Port: 9091})
 	servicePorts = append(servicePorts, corev1.ServicePort{Name: "statsd", Port: 9102})
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -775,7 +1335,7 @@ func serviceMonitorForVault(v *vaultv1alpha1.Vault) *monitorv1.ServiceMonitor {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      v.Name,
 			Namespace: v.Namespace,
-			Labels:    ls,
+			Labels:    withMonitoringLabels(v, v.LabelsForVault()),
 		},
 		Spec: monitorv1.ServiceMonitorSpec{
 			JobLabel: v.Name,
@@ -792,7 +1352,7 @@ func serviceMonitorForVault(v *vaultv1alpha1.Vault) *monitorv1.ServiceMonitor {
 	version, err := v.Spec.GetVersion()
 	if err == nil && !version.LessThan(vaultVersionWithPrometheus) {
 		serviceMonitor.Spec.Endpoints = []monitorv1.Endpoint{{
-			Interval: "30s",
+			Interval: v.Spec.GetMonitoringInterval(),
 			Port:     v.Spec.GetAPIPortName(),
 			Scheme:   strings.ToLower(string(getVaultURIScheme(v))),
 			Params:   map[string][]string{"format": {"prometheus"}},
@@ -804,7 +1364,7 @@ func serviceMonitorForVault(v *vaultv1alpha1.Vault) *monitorv1.ServiceMonitor {
 		}}
 	} else {
 		serviceMonitor.Spec.Endpoints = []monitorv1.Endpoint{{
-			Interval: "30s",
+			Interval: v.Spec.GetMonitoringInterval(),
 			Port:     "prometheus",
 		}}
 	}
@@ -823,7 +1383,7 @@ func getServicePorts(v *vaultv1alpha1.Vault) ([]corev1.ServicePort, []corev1.Con
 					Port: 8200,
 				},
 				{
-					Name: "cluster-port",
+					Name: getClusterPortName(v),
 					Port: 8201,
 				},
 			}, []corev1.ContainerPort{
@@ -832,7 +1392,7 @@ func getServicePorts(v *vaultv1alpha1.Vault) ([]corev1.ServicePort, []corev1.Con
 					ContainerPort: 8200,
 				},
 				{
-					Name:          "cluster-port",
+					Name:          getClusterPortName(v),
 					ContainerPort: 8201,
 				},
 			}
@@ -865,7 +1425,7 @@ func perInstanceVaultServiceName(svc string, i int) string {
 func perInstanceServicesForVault(v *vaultv1alpha1.Vault) []*corev1.Service {
 	var services []*corev1.Service
 	servicePorts, _ := getServicePorts(v)
-	servicePorts = append(servicePorts, corev1.ServicePort{Name: "metrics", Port: 9091})
+	servicePorts = append(servicePorts, corev1.ServicePort{Name: getMetricsPortName(v), Port: 9091})
 
 	for i := 0; i < int(v.Spec.Size); i++ {
 
@@ -899,7 +1459,7 @@ func serviceForVaultConfigurer(v *vaultv1alpha1.Vault) *corev1.Service {
 	var servicePorts []corev1.ServicePort
 
 	ls := v.LabelsForVaultConfigurer()
-	servicePorts = append(servicePorts, corev1.ServicePort{Name: "metrics", Port: 9091})
+	servicePorts = append(servicePorts, corev1.ServicePort{Name: getMetricsPortName(v), Port: 9091})
 
 	serviceName := fmt.Sprintf("%s-configurer", v.Name)
 
@@ -956,6 +1516,15 @@ func deploymentForConfigurer(v *vaultv1alpha1.Vault, configmaps corev1.ConfigMap
 	volumeMounts := []corev1.VolumeMount{}
 	configArgs := []string{}
 
+	// the Lease is in the namespace of the configurer Pods
+	if v.Spec.ConfigurerLeaderElection {
+		configArgs = append(configArgs, "--configure-leader-election", "lease", "--configure-leader-election-name", v.Name+"-configurer")
+	}
+
+	if v.Spec.ConfigurerCanary != nil {
+		configArgs = append(configArgs, v.Spec.ConfigurerCanary.ToArgs()...)
+	}
+
 	sort.Slice(configmaps.Items, func(i, j int) bool { return configmaps.Items[i].Name < configmaps.Items[j].Name })
 	sort.Slice(secrets.Items, func(i, j int) bool { return secrets.Items[i].Name < secrets.Items[j].Name })
 
@@ -1028,7 +1597,7 @@ func deploymentForConfigurer(v *vaultv1alpha1.Vault, configmaps corev1.ConfigMap
 	}
 
 	podSpec := corev1.PodSpec{
-		ServiceAccountName:           v.Spec.GetServiceAccount(),
+		ServiceAccountName:           configurerServiceAccount(v),
 		AutomountServiceAccountToken: pointer.BoolPtr(true),
 
 		Containers: []corev1.Container{
@@ -1039,17 +1608,17 @@ func deploymentForConfigurer(v *vaultv1alpha1.Vault, configmaps corev1.ConfigMap
 				Command:         []string{"bank-vaults", "configure"},
 				Args:            append(v.Spec.UnsealConfig.ToArgs(v), configArgs...),
 				Ports: []corev1.ContainerPort{{
-					Name:          "metrics",
+					Name:          getMetricsPortName(v),
 					ContainerPort: 9091,
 					Protocol:      "TCP",
 				}},
 				Env:          withNamespaceEnv(v, withCommonEnv(v, withTLSEnv(v, false, withCredentialsEnv(v, []corev1.EnvVar{})))),
-				VolumeMounts: withHSMVolumeMount(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, volumeMounts))),
+				VolumeMounts: withServiceAccountTokenVolumeMounts(v, withHSMVolumeMount(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, volumeMounts)))),
 				WorkingDir:   "/config",
 				Resources:    *getBankVaultsResource(v),
 			},
 		},
-		Volumes:         withHSMVolume(v, withTLSVolume(v, withCredentialsVolume(v, volumes))),
+		Volumes:         withServiceAccountTokenVolumes(v, withHSMVolume(v, withTLSVolume(v, withCredentialsVolume(v, volumes)))),
 		SecurityContext: withPodSecurityContext(v),
 		NodeSelector:    v.Spec.NodeSelector,
 		Tolerations:     v.Spec.Tolerations,
@@ -1083,10 +1652,16 @@ func deploymentForConfigurer(v *vaultv1alpha1.Vault, configmaps corev1.ConfigMap
 			},
 		},
 	}
+
+	// the data of a standby is configured by the primary and restored from its snapshots
+	if v.Spec.IsStandby() {
+		dep.Spec.Replicas = pointer.Int32Ptr(0)
+	}
+
 	return dep, nil
 }
 
-func configMapForConfigurer(v *vaultv1alpha1.Vault) *corev1.ConfigMap {
+func configMapForConfigurer(v *vaultv1alpha1.Vault, resources vaultv1alpha1.ExternalConfigResources) *corev1.ConfigMap {
 	ls := v.LabelsForVaultConfigurer()
 	cm := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1094,7 +1669,7 @@ func configMapForConfigurer(v *vaultv1alpha1.Vault) *corev1.ConfigMap {
 			Namespace: v.Namespace,
 			Labels:    withVaultConfigurerLabels(v, ls),
 		},
-		Data: map[string]string{vault.DefaultConfigFile: v.Spec.ExternalConfigJSON()},
+		Data: map[string]string{vault.DefaultConfigFile: v.Spec.ExternalConfigJSONWith(resources)},
 	}
 	return cm
 }
@@ -1127,6 +1702,10 @@ func hostsAndIPsForVault(v *vaultv1alpha1.Vault, service *corev1.Service) []stri
 		}
 	}
 
+	if v.Spec.IsServiceMesh() {
+		hostsAndIPs = append(hostsAndIPs, hostsForService(headlessServiceName(v), v.Namespace)...)
+	}
+
 	return hostsAndIPs
 }
 
@@ -1143,6 +1722,19 @@ func loadBalancerIngressPoints(service *corev1.Service) []string {
 	return hostsAndIPs
 }
 
+// caExpiration returns the expiration of the CA certificate in the TLS secret (the regenerated one if it has been populated)
+func caExpiration(secret *corev1.Secret) time.Time {
+	caCrt := []byte(secret.StringData["ca.crt"])
+	if len(caCrt) == 0 {
+		caCrt = secret.Data["ca.crt"]
+	}
+	expiration, err := bvtls.GetCertExpirationDate(caCrt)
+	if err != nil {
+		return time.Time{}
+	}
+	return expiration
+}
+
 // populateTLSSecret will populate a secret containing a TLS chain
 func populateTLSSecret(v *vaultv1alpha1.Vault, service *corev1.Service, secret *corev1.Secret) (time.Time, error) {
 	hostsAndIPs := hostsAndIPsForVault(v, service)
@@ -1215,7 +1807,7 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 
 	configSizeLimit := resource.MustParse("1Mi")
 
-	volumes := withTLSVolume(v, withCredentialsVolume(v, []corev1.Volume{
+	volumes := withFederationVolumes(v, withTLSVolume(v, withCredentialsVolume(v, []corev1.Volume{
 		{
 			Name: "vault-config",
 			VolumeSource: corev1.VolumeSource{
@@ -1225,18 +1817,18 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 				},
 			},
 		},
-	}))
+	})))
 
-	volumes = withHSMVolume(v, withStatsdVolume(v, withAuditLogVolume(v, volumes)))
+	volumes = withSharedVolumes(v, withHSMVolume(v, withStatsdVolume(v, withAuditLogShippingVolume(v, withAuditLogVolume(v, volumes)))))
 
-	volumeMounts := withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{
+	volumeMounts := withFederationVolumeMounts(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{
 		{
 			Name:      "vault-config",
 			MountPath: "/vault/config",
 		},
-	}))
+	})))
 
-	volumeMounts = withAuditLogVolumeMount(v, volumeMounts)
+	volumeMounts = withSharedVolumeMounts(v, withAuditLogVolumeMount(v, volumeMounts))
 
 	// TODO Configure Vault to wait for etcd in an init container in this case
 	// If etcd size is < 0 means not create new etcd cluster
@@ -1292,20 +1884,63 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 		if v.Spec.RaftLeaderAddress != "" {
 			unsealCommand = append(unsealCommand, "--raft-secondary")
 		}
+
+		if v.Spec.RaftScaling {
+			stabilizationTime := v.Spec.RaftServerStabilizationTime
+			if stabilizationTime == "" {
+				stabilizationTime = "30s"
+			}
+			unsealCommand = append(unsealCommand, "--raft-manage-peers", "--raft-server-stabilization-time", stabilizationTime)
+		}
+	}
+
+	if v.Spec.IsTLSReload() {
+		unsealCommand = append(unsealCommand, "--tls-reload-file", "/vault/tls/server.crt")
+	}
+
+	unsealArgs := append(v.Spec.UnsealConfig.Options.ToArgs(), v.Spec.UnsealConfig.ToArgs(v)...)
+
+	// a standby is restored from the snapshots of the primary and kept sealed instead
+	if v.Spec.IsStandby() {
+		unsealCommand = []string{"bank-vaults", "standby"}
+		unsealArgs = append(v.Spec.UnsealConfig.ToArgs(v), v.Spec.Standby.ToArgs()...)
+	}
+
+	// the preStop hooks of the containers run at the same time, Vault keeps serving for a while, so the
+	// active instance can be stepped down by the bank-vaults sidecar before Vault gets the SIGTERM
+	var vaultLifecycle, bankVaultsLifecycle *corev1.Lifecycle
+	// the active instance is always stepped down with the standby-first upgrades,
+	// with Raft scaling the servers removed by a scale-down also leave the Raft cluster after stepping down
+	raftScaling := v.Spec.RaftScaling && v.Spec.IsRaftStorage()
+	if (v.Spec.StepDownOnShutdown || raftScaling || v.Spec.Upgrade != nil) && !v.Spec.IsStandby() {
+		stepDownCommand := []string{"bank-vaults", "stepdown", "--stepdown-timeout", "9s"}
+		if raftScaling {
+			stepDownCommand = append(stepDownCommand, "--raft-leave-on-scale-down")
+		}
+		vaultLifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{Command: []string{"sleep", "10"}},
+			},
+		}
+		bankVaultsLifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{Command: append(stepDownCommand, v.Spec.UnsealConfig.ToArgs(v)...)},
+			},
+		}
 	}
 
 	configJSON := v.Spec.ConfigJSON()
 
 	_, containerPorts := getServicePorts(v)
 
-	containers := withVeleroContainer(v, withStatsDContainer(v, withAuditLogContainer(v, []corev1.Container{
+	containers := withVeleroContainer(v, withStatsDContainer(v, withAuditLogShippingContainer(v, withAuditLogContainer(v, []corev1.Container{
 		{
 			Image:           v.Spec.GetVaultImage(),
 			ImagePullPolicy: corev1.PullIfNotPresent,
 			Name:            "vault",
 			Args:            []string{"server"},
 			Ports:           containerPorts,
-			Env:             withClusterAddr(v, service, withCredentialsEnv(v, withVaultEnv(v, []corev1.EnvVar{}))),
+			Env:             withFederationEnv(v, withClusterAddr(v, service, withCredentialsEnv(v, withVaultEnv(v, []corev1.EnvVar{})))),
 			SecurityContext: withContainerSecurityContext(v),
 			// This probe makes sure Vault is responsive in a HTTPS manner
 			// See: https://www.vaultproject.io/api/system/init.html
@@ -1329,16 +1964,17 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 				PeriodSeconds:    5,
 				FailureThreshold: 2,
 			},
-			VolumeMounts: withVaultVolumeMounts(v, volumeMounts),
+			VolumeMounts: withServiceAccountTokenVolumeMounts(v, withVaultVolumeMounts(v, volumeMounts)),
 			Resources:    *getVaultResource(v),
+			Lifecycle:    vaultLifecycle,
 		},
 		{
 			Image:           v.Spec.GetBankVaultsImage(),
 			ImagePullPolicy: corev1.PullIfNotPresent,
 			Name:            "bank-vaults",
 			Command:         unsealCommand,
-			Args:            append(v.Spec.UnsealConfig.Options.ToArgs(), v.Spec.UnsealConfig.ToArgs(v)...),
-			Env: withSidecarEnv(v, withTLSEnv(v, true, withCredentialsEnv(v, withCommonEnv(v, []corev1.EnvVar{
+			Args:            unsealArgs,
+			Env: withSidecarEnv(v, withStandbyEnv(v, withTLSEnv(v, true, withCredentialsEnv(v, withCommonEnv(v, []corev1.EnvVar{
 				{
 					Name: "POD_NAME",
 					ValueFrom: &corev1.EnvVarSource{
@@ -1347,16 +1983,18 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 						},
 					},
 				},
-			})))),
+			}))))),
 			Ports: []corev1.ContainerPort{{
-				Name:          "metrics",
+				Name:          getMetricsPortName(v),
 				ContainerPort: 9091,
 				Protocol:      "TCP",
 			}},
-			VolumeMounts: withHSMVolumeMount(v, withBanksVaultsVolumeMounts(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{})))),
-			Resources:    *getBankVaultsResource(v),
+			VolumeMounts:    withServiceAccountTokenVolumeMounts(v, withHSMVolumeMount(v, withBanksVaultsVolumeMounts(v, withTLSVolumeMount(v, withCredentialsVolumeMount(v, []corev1.VolumeMount{}))))),
+			Resources:       *getBankVaultsResource(v),
+			Lifecycle:       bankVaultsLifecycle,
+			SecurityContext: withBankVaultsSecurityContext(v),
 		},
-	})))
+	}))))
 
 	if v.Spec.UnsealConfig.HSMDaemonNeeded() {
 		containers = append(containers, corev1.Container{
@@ -1373,13 +2011,18 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 		})
 	}
 
+	containers, err := withSidecarContainers(v, containers)
+	if err != nil {
+		return nil, err
+	}
+
 	podSpec := corev1.PodSpec{
 		Affinity: &corev1.Affinity{
 			PodAntiAffinity: getPodAntiAffinity(v),
 			NodeAffinity:    getNodeAffinity(v),
 		},
 
-		ServiceAccountName:           v.Spec.GetServiceAccount(),
+		ServiceAccountName:           vaultServiceAccount(v),
 		AutomountServiceAccountToken: pointer.BoolPtr(true),
 
 		InitContainers: withVaultInitContainers(v, []corev1.Container{
@@ -1408,12 +2051,23 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 		}),
 
 		Containers:      containers,
-		Volumes:         withVaultVolumes(v, volumes),
+		Volumes:         withServiceAccountTokenVolumes(v, withVaultVolumes(v, volumes)),
 		SecurityContext: withPodSecurityContext(v),
 		NodeSelector:    v.Spec.NodeSelector,
 		Tolerations:     v.Spec.Tolerations,
 	}
 
+	// the bank-vaults sidecar signals the Vault process to reload the certificates
+	if v.Spec.IsTLSReload() {
+		podSpec.ShareProcessNamespace = pointer.BoolPtr(true)
+	}
+
+	podSpec.TopologySpreadConstraints = withTopologySpreadConstraints(v)
+	podSpec.PriorityClassName = v.Spec.PriorityClassName
+	if v.Spec.RuntimeClassName != "" {
+		podSpec.RuntimeClassName = pointer.StringPtr(v.Spec.RuntimeClassName)
+	}
+
 	// merge provided VaultPodSpec into the PodSpec defined above
 	// the values in VaultPodSpec will never overwrite fields defined in the PodSpec above
 	if err := mergo.MergeWithOverwrite(&podSpec, v.Spec.VaultPodSpec); err != nil {
@@ -1425,6 +2079,12 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 		podManagementPolicy = appsv1.OrderedReadyPodManagement
 	}
 
+	// the operator deletes the outdated Pods itself with the standby-first upgrades
+	updateStrategy := appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+	if v.Spec.Upgrade != nil {
+		updateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+	}
+
 	return &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        v.Name,
@@ -1434,9 +2094,7 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Replicas: &replicas,
-			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
-				Type: appsv1.RollingUpdateStatefulSetStrategyType,
-			},
+			UpdateStrategy: updateStrategy,
 			PodManagementPolicy: podManagementPolicy,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: ls,
@@ -1444,12 +2102,12 @@ func statefulSetForVault(v *vaultv1alpha1.Vault, externalSecretsToWatchItems []c
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: withVaultLabels(v, ls),
-					Annotations: withVeleroAnnotations(v,
+					Annotations: withServiceMeshAnnotations(v, withVeleroAnnotations(v,
 						withTLSExpirationAnnotations(tlsAnnotations,
-							withVaultAnnotations(v,
+							withSeccompAnnotations(v, withVaultAnnotations(v,
 								withVaultWatchedExternalSecrets(v, externalSecretsToWatchItems,
 									withPrometheusAnnotations("9102",
-										getCommonAnnotations(v, map[string]string{})))))),
+										getCommonAnnotations(v, map[string]string{})))))))),
 				},
 				Spec: podSpec,
 			},
@@ -1548,15 +2206,22 @@ func withTLSExpirationAnnotations(tlsAnnotations, annotations map[string]string)
 
 // TLS Functions
 func withTLSEnv(v *vaultv1alpha1.Vault, localhost bool, envs []corev1.EnvVar) []corev1.EnvVar {
+	if v.Spec.IsExternalVault() {
+		return withExternalVaultEnv(v, envs)
+	}
 	host := fmt.Sprintf("%s.%s", v.Name, v.Namespace)
 	if localhost {
 		host = "127.0.0.1"
 	}
 	if !v.Spec.IsTLSDisabled() {
+		address := fmt.Sprintf("https://%s:8200", host)
+		if localhost && v.Spec.LocalVaultAddress != "" {
+			address = v.Spec.LocalVaultAddress
+		}
 		envs = append(envs, []corev1.EnvVar{
 			{
 				Name:  api.EnvVaultAddress,
-				Value: fmt.Sprintf("https://%s:8200", host),
+				Value: address,
 			},
 			{
 				Name:  api.EnvVaultCACert,
@@ -1564,23 +2229,30 @@ func withTLSEnv(v *vaultv1alpha1.Vault, localhost bool, envs []corev1.EnvVar) []
 			},
 		}...)
 	} else {
+		address := fmt.Sprintf("http://%s:8200", host)
+		if localhost && v.Spec.LocalVaultAddress != "" {
+			address = v.Spec.LocalVaultAddress
+		}
 		envs = append(envs, corev1.EnvVar{
 
 			Name:  api.EnvVaultAddress,
-			Value: fmt.Sprintf("http://%s:8200", host),
+			Value: address,
 		})
 	}
 	return envs
 }
 
 func withTLSVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	if v.Spec.IsExternalVault() {
+		return withExternalVaultTLSVolume(v, volumes)
+	}
 	if !v.Spec.IsTLSDisabled() {
-		if v.Spec.ExistingTLSSecretName != "" {
+		if v.Spec.HasExternalTLSSecret() {
 			volumes = append(volumes, corev1.Volume{
 				Name: "vault-tls",
 				VolumeSource: corev1.VolumeSource{
 					Secret: &corev1.SecretVolumeSource{
-						SecretName: v.Spec.ExistingTLSSecretName,
+						SecretName: v.GetTLSSecretName(),
 						Items: []corev1.KeyToPath{
 							{
 								Key:  "ca.crt",
@@ -1613,7 +2285,7 @@ func withTLSVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Vol
 }
 
 func withTLSVolumeMount(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
-	if !v.Spec.IsTLSDisabled() {
+	if (!v.Spec.IsExternalVault() && !v.Spec.IsTLSDisabled()) || (v.Spec.IsExternalVault() && v.Spec.ExistingTLSSecretName != "") {
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
 			Name:      "vault-tls",
 			MountPath: "/vault/tls",
@@ -1735,7 +2407,46 @@ func withStatsdVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.
 }
 
 func withVaultInitContainers(v *vaultv1alpha1.Vault, containers []corev1.Container) []corev1.Container {
-	return append(containers, v.Spec.VaultInitContainers...)
+	containers = append(containers, v.Spec.VaultInitContainers...)
+	return append(containers, v.Spec.ExtraInitContainers...)
+}
+
+// withSidecarContainers adds the sidecar containers of the spec, their names can't collide with the generated containers
+func withSidecarContainers(v *vaultv1alpha1.Vault, containers []corev1.Container) ([]corev1.Container, error) {
+	names := map[string]bool{}
+	for _, container := range containers {
+		names[container.Name] = true
+	}
+
+	for _, sidecar := range v.Spec.SidecarContainers {
+		if names[sidecar.Name] {
+			return nil, fmt.Errorf("sidecar container name %q is already used by the Vault Pod", sidecar.Name)
+		}
+		names[sidecar.Name] = true
+		containers = append(containers, sidecar)
+	}
+
+	return containers, nil
+}
+
+func withSharedVolumes(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	for _, name := range v.Spec.SharedVolumes {
+		volumes = append(volumes, corev1.Volume{
+			Name:         name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+	return volumes
+}
+
+func withSharedVolumeMounts(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
+	for _, name := range v.Spec.SharedVolumes {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: "/vault/shared/" + name,
+		})
+	}
+	return volumeMounts
 }
 
 func withVeleroContainer(v *vaultv1alpha1.Vault, containers []corev1.Container) []corev1.Container {
@@ -1790,14 +2501,16 @@ func withStatsDContainer(v *vaultv1alpha1.Vault, containers []corev1.Container)
 }
 
 func withAuditLogVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	if v.Spec.IsFluentDEnabled() || v.Spec.IsAuditLogShippingEnabled() {
+		volumes = append(volumes, corev1.Volume{
+			Name: "vault-auditlogs",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
 	if v.Spec.IsFluentDEnabled() {
 		volumes = append(volumes, []corev1.Volume{
-			{
-				Name: "vault-auditlogs",
-				VolumeSource: corev1.VolumeSource{
-					EmptyDir: &corev1.EmptyDirVolumeSource{},
-				},
-			},
 			{
 				Name: "fluentd-config",
 				VolumeSource: corev1.VolumeSource{
@@ -1814,7 +2527,7 @@ func withAuditLogVolume(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev
 }
 
 func withAuditLogVolumeMount(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
-	if v.Spec.IsFluentDEnabled() {
+	if v.Spec.IsFluentDEnabled() || v.Spec.IsAuditLogShippingEnabled() {
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
 			Name:      "vault-auditlogs",
 			MountPath: "/vault/logs",
@@ -1870,6 +2583,37 @@ func withHSMVolumeMount(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMoun
 	return volumeMounts
 }
 
+func withServiceAccountTokenVolumes(v *vaultv1alpha1.Vault, volumes []corev1.Volume) []corev1.Volume {
+	for _, projection := range v.Spec.ServiceAccountTokenProjections {
+		volumes = append(volumes, corev1.Volume{
+			Name: projection.Name,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          projection.Audience,
+							ExpirationSeconds: projection.ExpirationSeconds,
+							Path:              projection.GetPath(),
+						},
+					}},
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+func withServiceAccountTokenVolumeMounts(v *vaultv1alpha1.Vault, volumeMounts []corev1.VolumeMount) []corev1.VolumeMount {
+	for _, projection := range v.Spec.ServiceAccountTokenProjections {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      projection.Name,
+			MountPath: projection.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	return volumeMounts
+}
+
 func getPodAntiAffinity(v *vaultv1alpha1.Vault) *corev1.PodAntiAffinity {
 	if v.Spec.PodAntiAffinity == "" {
 		return nil
@@ -1992,6 +2736,19 @@ func withSidecarEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.EnvVa
 	return envs
 }
 
+func withStandbyEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.EnvVar {
+	if v.Spec.IsStandby() && v.Spec.Standby.EncryptionKeySecret != nil {
+		envs = append(envs, corev1.EnvVar{
+			Name: "BANK_VAULTS_BACKUP_ENCRYPTION_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: v.Spec.Standby.EncryptionKeySecret,
+			},
+		})
+	}
+
+	return envs
+}
+
 func withNamespaceEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.EnvVar {
 	return append(envs, []corev1.EnvVar{
 		{
@@ -2002,21 +2759,23 @@ func withNamespaceEnv(v *vaultv1alpha1.Vault, envs []corev1.EnvVar) []corev1.Env
 }
 
 func withContainerSecurityContext(v *vaultv1alpha1.Vault) *corev1.SecurityContext {
-	if cast.ToBool(v.Spec.Config["disable_mlock"]) {
-		return &corev1.SecurityContext{}
+	if v.Spec.IsMlockDisabled() {
+		sc := hardenedSecurityContext()
+		sc.RunAsUser = pointer.Int64Ptr(vaultUID)
+		sc.RunAsGroup = pointer.Int64Ptr(vaultGID)
+		return mergeSecurityContext(sc, v.Spec.ContainerSecurityContext)
 	}
-	return &corev1.SecurityContext{
+	return mergeSecurityContext(&corev1.SecurityContext{
 		Capabilities: &corev1.Capabilities{
 			Add: []corev1.Capability{"IPC_LOCK"},
 		},
-	}
+	}, v.Spec.ContainerSecurityContext)
 }
 
 func withPodSecurityContext(v *vaultv1alpha1.Vault) *corev1.PodSecurityContext {
 	if v.Spec.SecurityContext.Size() == 0 {
-		vaultGID := int64(1000)
 		return &corev1.PodSecurityContext{
-			FSGroup: &vaultGID,
+			FSGroup: pointer.Int64Ptr(vaultGID),
 		}
 	}
 	return &v.Spec.SecurityContext
@@ -0,0 +1,96 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// vaultPolicyRequests maps a VaultPolicy to the reconcile request of the Vault it references
+var vaultPolicyRequests = handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+	p, ok := o.Object.(*vaultv1alpha1.VaultPolicy)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: p.GetVaultNamespace(), Name: p.Spec.VaultRef.Name}}}
+})
+
+// vaultPoliciesForVault returns the VaultPolicies referencing the Vault which are accepted by it: they are in
+// one of its vaultPolicyNamespaces, they are valid, and their name doesn't conflict with the externalConfig.
+// The status of every VaultPolicy referencing the Vault is updated with the name of the policy or the error.
+func (r *ReconcileVault) vaultPoliciesForVault(v *vaultv1alpha1.Vault) ([]vaultv1alpha1.VaultPolicy, error) {
+	// the VaultPolicies are in the namespaces of the teams, not in the one of the Vault
+	list := &vaultv1alpha1.VaultPolicyList{}
+	if err := r.nonNamespacedClient.List(context.TODO(), list); err != nil {
+		return nil, fmt.Errorf("failed to list VaultPolicies: %v", err)
+	}
+
+	var referencing, accepted []vaultv1alpha1.VaultPolicy
+	errs := map[string]string{}
+	for _, p := range list.Items {
+		if p.Spec.VaultRef.Name != v.Name || p.GetVaultNamespace() != v.Namespace {
+			continue
+		}
+		referencing = append(referencing, p)
+
+		if !v.Spec.AcceptsVaultPolicies(p.Namespace) {
+			errs[p.PolicyName()] = fmt.Sprintf("vault %s/%s doesn't accept the VaultPolicies of namespace %s", v.Namespace, v.Name, p.Namespace)
+		} else if err := p.Validate(); err != nil {
+			errs[p.PolicyName()] = err.Error()
+		} else {
+			accepted = append(accepted, p)
+		}
+	}
+
+	// the policies are sorted, so the external config only changes with them
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i].PolicyName() < accepted[j].PolicyName() })
+
+	_, conflicting := vaultv1alpha1.MergeVaultPolicies(v.Spec.BaseExternalConfig(), accepted)
+	for _, p := range conflicting {
+		errs[p.PolicyName()] = fmt.Sprintf("policy %s is defined in the externalConfig of vault %s/%s already", p.PolicyName(), v.Namespace, v.Name)
+	}
+
+	policies := accepted[:0]
+	for _, p := range accepted {
+		if _, ok := errs[p.PolicyName()]; !ok {
+			policies = append(policies, p)
+		}
+	}
+
+	for i := range referencing {
+		p := &referencing[i]
+		status := vaultv1alpha1.VaultPolicyStatus{PolicyName: p.PolicyName(), Error: errs[p.PolicyName()]}
+		if status.Error != "" {
+			status.PolicyName = ""
+		}
+		if status == p.Status {
+			continue
+		}
+		p.Status = status
+		if err := r.nonNamespacedClient.Update(context.TODO(), p); err != nil {
+			return nil, fmt.Errorf("failed to update the status of VaultPolicy %s/%s: %v", p.Namespace, p.Name, err)
+		}
+	}
+
+	return policies, nil
+}
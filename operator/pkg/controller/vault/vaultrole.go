@@ -0,0 +1,98 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// vaultRoleRequests maps a VaultRole to the reconcile request of the Vault it references
+var vaultRoleRequests = handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+	role, ok := o.Object.(*vaultv1alpha1.VaultRole)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: role.GetVaultNamespace(), Name: role.Spec.VaultRef.Name}}}
+})
+
+// vaultRolesForVault returns the VaultRoles referencing the Vault which are accepted by it: they are in one of
+// its vaultRoleNamespaces, they only grant policies with the allowed prefixes, and their name doesn't conflict
+// with a role of the externalConfig. The status of every VaultRole referencing the Vault is updated with the
+// name of the role or the error.
+func (r *ReconcileVault) vaultRolesForVault(v *vaultv1alpha1.Vault) ([]vaultv1alpha1.VaultRole, error) {
+	// the VaultRoles are in the namespaces of the teams, not in the one of the Vault
+	list := &vaultv1alpha1.VaultRoleList{}
+	if err := r.nonNamespacedClient.List(context.TODO(), list); err != nil {
+		return nil, fmt.Errorf("failed to list VaultRoles: %v", err)
+	}
+
+	var referencing, accepted []vaultv1alpha1.VaultRole
+	errs := map[string]string{}
+	for _, role := range list.Items {
+		if role.Spec.VaultRef.Name != v.Name || role.GetVaultNamespace() != v.Namespace {
+			continue
+		}
+		referencing = append(referencing, role)
+
+		prefixes, ok := v.Spec.PolicyPrefixes(role.Namespace)
+		if !ok {
+			errs[role.RoleName()] = fmt.Sprintf("vault %s/%s doesn't accept the VaultRoles of namespace %s", v.Namespace, v.Name, role.Namespace)
+		} else if err := role.Validate(prefixes); err != nil {
+			errs[role.RoleName()] = err.Error()
+		} else {
+			accepted = append(accepted, role)
+		}
+	}
+
+	// the roles are sorted, so the external config only changes with them
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i].RoleName() < accepted[j].RoleName() })
+
+	_, conflicting := vaultv1alpha1.MergeVaultRoles(v.Spec.BaseExternalConfig(), accepted)
+	for _, role := range conflicting {
+		errs[role.RoleName()] = fmt.Sprintf("role %s is defined in the %s auth method of vault %s/%s already", role.RoleName(), role.GetAuthPath(), v.Namespace, v.Name)
+	}
+
+	roles := accepted[:0]
+	for _, role := range accepted {
+		if _, ok := errs[role.RoleName()]; !ok {
+			roles = append(roles, role)
+		}
+	}
+
+	for i := range referencing {
+		role := &referencing[i]
+		status := vaultv1alpha1.VaultRoleStatus{RoleName: role.RoleName(), Error: errs[role.RoleName()]}
+		if status.Error != "" {
+			status.RoleName = ""
+		}
+		if status == role.Status {
+			continue
+		}
+		role.Status = status
+		if err := r.nonNamespacedClient.Update(context.TODO(), role); err != nil {
+			return nil, fmt.Errorf("failed to update the status of VaultRole %s/%s: %v", role.Namespace, role.Name, err)
+		}
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,172 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vaultv1alpha1 "github.com/banzaicloud/bank-vaults/operator/pkg/apis/vault/v1alpha1"
+)
+
+// vaultSecretEngineRequests maps a VaultSecretEngine to the reconcile request of the Vault it references
+var vaultSecretEngineRequests = handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+	e, ok := o.Object.(*vaultv1alpha1.VaultSecretEngine)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: e.GetVaultNamespace(), Name: e.Spec.VaultRef.Name}}}
+})
+
+// vaultSecretEnginesForVault returns the VaultSecretEngines referencing the Vault which are accepted by it: they
+// are in its namespace or one of its vaultSecretEngineNamespaces, they are valid, and their path doesn't conflict
+// with a secret engine of the externalConfig. The paths of the deleted ones with unmountOnDelete are recorded in
+// the status of the Vault before their finalizer is removed. The status of every VaultSecretEngine referencing
+// the Vault is updated with its path and conditions.
+func (r *ReconcileVault) vaultSecretEnginesForVault(v *vaultv1alpha1.Vault) ([]vaultv1alpha1.VaultSecretEngine, error) {
+	list := &vaultv1alpha1.VaultSecretEngineList{}
+	if err := r.nonNamespacedClient.List(context.TODO(), list); err != nil {
+		return nil, fmt.Errorf("failed to list VaultSecretEngines: %v", err)
+	}
+
+	var referencing, accepted, deleted []vaultv1alpha1.VaultSecretEngine
+	errs := map[string]error{}
+	key := func(e *vaultv1alpha1.VaultSecretEngine) string { return e.Namespace + "/" + e.Name }
+	for _, e := range list.Items {
+		if e.Spec.VaultRef.Name != v.Name || e.GetVaultNamespace() != v.Namespace {
+			continue
+		}
+
+		if e.DeletionTimestamp != nil {
+			if e.HasFinalizer() {
+				deleted = append(deleted, e)
+			}
+			continue
+		}
+		referencing = append(referencing, e)
+
+		if !v.AcceptsVaultSecretEngines(e.Namespace) {
+			errs[key(&e)] = fmt.Errorf("vault %s/%s doesn't accept the VaultSecretEngines of namespace %s", v.Namespace, v.Name, e.Namespace)
+		} else if err := e.Validate(); err != nil {
+			errs[key(&e)] = err
+		} else {
+			accepted = append(accepted, e)
+		}
+	}
+
+	// the secret engines are sorted, so the external config only changes with them
+	sort.Slice(accepted, func(i, j int) bool { return key(&accepted[i]) < key(&accepted[j]) })
+
+	_, conflicting := vaultv1alpha1.MergeVaultSecretEngines(v.Spec.BaseExternalConfig(), accepted, nil)
+	for i := range conflicting {
+		e := &conflicting[i]
+		errs[key(e)] = fmt.Errorf("a secret engine is mounted at %s in vault %s/%s already", e.GetPath(), v.Namespace, v.Name)
+	}
+
+	secretEngines := accepted[:0]
+	mounted := map[string]bool{}
+	for i := range accepted {
+		e := &accepted[i]
+		if errs[key(e)] == nil {
+			secretEngines = append(secretEngines, *e)
+			mounted[e.GetPath()] = true
+		}
+	}
+
+	// the removed paths are recorded before the finalizers are removed, a path mounted again is not removed anymore
+	removed := make([]string, 0, len(v.Status.RemovedSecretEngines))
+	seen := map[string]bool{}
+	for _, path := range v.Status.RemovedSecretEngines {
+		if !mounted[path] && !seen[path] {
+			removed = append(removed, path)
+			seen[path] = true
+		}
+	}
+	for i := range deleted {
+		e := &deleted[i]
+		if e.Spec.UnmountOnDelete && !mounted[e.GetPath()] && !seen[e.GetPath()] {
+			removed = append(removed, e.GetPath())
+			seen[e.GetPath()] = true
+		}
+	}
+	if !reflect.DeepEqual(removed, v.Status.RemovedSecretEngines) && (len(removed) > 0 || len(v.Status.RemovedSecretEngines) > 0) {
+		v.Status.RemovedSecretEngines = removed
+		if err := r.client.Update(context.TODO(), v); err != nil {
+			return nil, fmt.Errorf("failed to record the removed secret engines of vault: %v", err)
+		}
+	}
+
+	for i := range deleted {
+		e := &deleted[i]
+		e.SetFinalizer(false)
+		if err := r.nonNamespacedClient.Update(context.TODO(), e); err != nil {
+			return nil, fmt.Errorf("failed to remove the finalizer of VaultSecretEngine %s: %v", key(e), err)
+		}
+	}
+
+	for i := range referencing {
+		e := &referencing[i]
+		err := errs[key(e)]
+
+		changed := e.SetFinalizer(e.Spec.UnmountOnDelete)
+		path := e.GetPath()
+		if err != nil {
+			path = ""
+		}
+		if e.Status.Path != path {
+			e.Status.Path = path
+			changed = true
+		}
+		if e.Status.SetCondition(vaultv1alpha1.VaultSecretEngineAccepted, err) {
+			changed = true
+		}
+
+		if changed {
+			if err := r.nonNamespacedClient.Update(context.TODO(), e); err != nil {
+				return nil, fmt.Errorf("failed to update VaultSecretEngine %s: %v", key(e), err)
+			}
+		}
+	}
+
+	return secretEngines, nil
+}
+
+// releaseVaultSecretEngines removes the finalizers of the VaultSecretEngines referencing a Vault which is
+// missing or being deleted, there is no Vault to unmount them from anymore, and they would block the
+// deletion of their namespaces forever. The finalizers are added again if the Vault is created again.
+func (r *ReconcileVault) releaseVaultSecretEngines(vault types.NamespacedName) error {
+	list := &vaultv1alpha1.VaultSecretEngineList{}
+	if err := r.nonNamespacedClient.List(context.TODO(), list); err != nil {
+		return fmt.Errorf("failed to list VaultSecretEngines: %v", err)
+	}
+
+	for i := range list.Items {
+		e := &list.Items[i]
+		if e.Spec.VaultRef.Name != vault.Name || e.GetVaultNamespace() != vault.Namespace || !e.SetFinalizer(false) {
+			continue
+		}
+		if err := r.nonNamespacedClient.Update(context.TODO(), e); err != nil {
+			return fmt.Errorf("failed to remove the finalizer of VaultSecretEngine %s/%s: %v", e.Namespace, e.Name, err)
+		}
+	}
+
+	return nil
+}
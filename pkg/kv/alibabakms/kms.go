@@ -15,6 +15,8 @@
 package alibabakms
 
 import (
+	"time"
+
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
 
@@ -76,3 +78,11 @@ func (a *alibabaKMS) Set(key string, val []byte) error {
 
 	return a.store.Set(key, cipherText)
 }
+
+func (a *alibabaKMS) Delete(key string) error {
+	return kv.Delete(a.store, key)
+}
+
+func (a *alibabaKMS) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(a.store, name, ttl)
+}
@@ -15,6 +15,8 @@
 package awskms
 
 import (
+	"time"
+
 	"emperror.dev/errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -99,3 +101,11 @@ func (a *awsKMS) Set(key string, val []byte) error {
 
 	return a.store.Set(key, cipherText)
 }
+
+func (a *awsKMS) Delete(key string) error {
+	return kv.Delete(a.store, key)
+}
+
+func (a *awsKMS) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(a.store, name, ttl)
+}
@@ -0,0 +1,118 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/consul/api"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type consulStorage struct {
+	cl     *api.Client
+	prefix string
+}
+
+// New creates a new kv.Service backed by Consul KV, without any encryption.
+// The address and token fall back to the CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN environment variables.
+func New(address, token, prefix string) (kv.Service, error) {
+	config := api.DefaultConfig()
+	if address != "" {
+		config.Address = address
+	}
+	if token != "" {
+		config.Token = token
+	}
+
+	cl, err := api.NewClient(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating consul client")
+	}
+
+	return &consulStorage{cl: cl, prefix: prefix}, nil
+}
+
+func (c *consulStorage) Set(key string, val []byte) error {
+	k := keyWithPrefix(c.prefix, key)
+
+	_, err := c.cl.KV().Put(&api.KVPair{Key: k, Value: val}, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error writing key '%s' to consul", k)
+	}
+
+	return nil
+}
+
+func (c *consulStorage) Get(key string) ([]byte, error) {
+	k := keyWithPrefix(c.prefix, key)
+
+	pair, _, err := c.cl.KV().Get(k, &api.QueryOptions{RequireConsistent: true})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting key '%s' from consul", k)
+	}
+
+	if pair == nil {
+		return nil, kv.NewNotFoundError("key '%s' is not present in consul", k)
+	}
+
+	return pair.Value, nil
+}
+
+func (c *consulStorage) Delete(key string) error {
+	k := keyWithPrefix(c.prefix, key)
+
+	if _, err := c.cl.KV().Delete(k, nil); err != nil {
+		return errors.Wrapf(err, "error deleting key '%s' from consul", k)
+	}
+
+	return nil
+}
+
+// Lock acquires a Consul lock with a session, which expires after the TTL if it isn't released
+func (c *consulStorage) Lock(name string, ttl time.Duration) (func() error, error) {
+	k := keyWithPrefix(c.prefix, name+".lock")
+
+	lock, err := c.cl.LockOpts(&api.LockOptions{
+		Key:          k,
+		SessionName:  "bank-vaults",
+		SessionTTL:   ttl.String(),
+		LockTryOnce:  true,
+		LockWaitTime: time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating consul lock '%s'", k)
+	}
+
+	lost, err := lock.Lock(nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error acquiring consul lock '%s'", k)
+	}
+
+	if lost == nil {
+		return nil, errors.WithDetails(kv.ErrLocked, "lock", k)
+	}
+
+	return func() error {
+		return errors.Wrapf(lock.Unlock(), "error releasing consul lock '%s'", k)
+	}, nil
+}
+
+func keyWithPrefix(prefix, key string) string {
+	return fmt.Sprintf("%s%s", prefix, key)
+}
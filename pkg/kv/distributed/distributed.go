@@ -0,0 +1,147 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distributed
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+// shardKeyPattern matches the names of the unseal and recovery keys bank-vaults stores,
+// including the pending keys of a rekey, the last group is the shard index
+var shardKeyPattern = regexp.MustCompile(`^vault-(?:rekey-)?(?:unseal|recovery)(?:-pgp)?-(\d+)$`)
+
+// rootTokenKeys are the names of the root token and its wrapped copy
+var rootTokenKeys = map[string]bool{"vault-root": true, "vault-root-wrapped": true}
+
+type distributed struct {
+	backends  []kv.Service
+	rootToken kv.Service
+}
+
+// New creates a new kv.Service which distributes the unseal and recovery key shards across the backends,
+// shard n is stored in backend n modulo the number of backends, so no single backend holds a quorum of
+// the shards if there are at least as many backends as the threshold requires. The pending keys of a rekey
+// are distributed the same way. The root token would be a single point of compromise as well, so it is
+// stored in the rootToken backend, which should not be one of the shard backends, and the root token is
+// refused if that is nil. Every other key is stored in the first backend.
+func New(backends []kv.Service, rootToken kv.Service) (kv.Service, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("at least one backend is required") // nolint:goerr113
+	}
+
+	return &distributed{backends: backends, rootToken: rootToken}, nil
+}
+
+// backendFor returns the index of the backend storing the key
+func (d *distributed) backendFor(key string) int {
+	match := shardKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return 0
+	}
+
+	shard, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+
+	return shard % len(d.backends)
+}
+
+func (d *distributed) Set(key string, val []byte) error {
+	if rootTokenKeys[key] {
+		if d.rootToken == nil {
+			return errors.Errorf("key %q can't be stored without a root token backend in distributed mode", key)
+		}
+		return errors.Wrapf(d.rootToken.Set(key, val), "error setting key %q in the root token backend", key)
+	}
+
+	i := d.backendFor(key)
+	logrus.Debugf("setting key %q in backend %d", key, i)
+
+	return errors.Wrapf(d.backends[i].Set(key, val), "error setting key %q in backend %d", key, i)
+}
+
+func (d *distributed) Get(key string) ([]byte, error) {
+	if rootTokenKeys[key] {
+		if d.rootToken == nil {
+			return nil, kv.NewNotFoundError("key %q isn't stored without a root token backend in distributed mode", key)
+		}
+		return d.rootToken.Get(key)
+	}
+
+	i := d.backendFor(key)
+
+	val, err := d.backends[i].Get(key)
+	if err != nil {
+		// keep the not found errors detectable
+		if kv.IsNotFoundError(err) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "error getting key %q from backend %d", key, i)
+	}
+
+	return val, nil
+}
+
+func (d *distributed) Delete(key string) error {
+	if rootTokenKeys[key] {
+		if d.rootToken == nil {
+			return nil
+		}
+		return errors.Wrapf(kv.Delete(d.rootToken, key), "error deleting key %q from the root token backend", key)
+	}
+
+	i := d.backendFor(key)
+
+	return errors.Wrapf(kv.Delete(d.backends[i], key), "error deleting key %q from backend %d", key, i)
+}
+
+// Lock acquires the lock in all the backends which support locking
+func (d *distributed) Lock(name string, ttl time.Duration) (func() error, error) {
+	var unlocks []func() error
+
+	unlock := func() error {
+		var err error
+		for _, unlock := range unlocks {
+			err = errors.Append(err, unlock())
+		}
+		return err
+	}
+
+	for _, backend := range d.backends {
+		u, err := kv.Lock(backend, name, ttl)
+		if errors.Is(err, kv.ErrLockingNotSupported) {
+			continue
+		}
+		if err != nil {
+			_ = unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, u)
+	}
+
+	if len(unlocks) == 0 {
+		return nil, kv.ErrLockingNotSupported
+	}
+
+	return unlock, nil
+}
@@ -0,0 +1,84 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distributed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type inMemoryStorage map[string][]byte
+
+func (s inMemoryStorage) Get(key string) ([]byte, error) {
+	if data, ok := s[key]; ok {
+		return data, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s inMemoryStorage) Set(key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func TestDistributed(t *testing.T) {
+	backends := []inMemoryStorage{{}, {}, {}}
+	rootToken := inMemoryStorage{}
+	store, err := New([]kv.Service{backends[0], backends[1], backends[2]}, rootToken)
+	require.NoError(t, err)
+
+	for _, key := range []string{"vault-unseal-0", "vault-unseal-1", "vault-unseal-2", "vault-unseal-3", "vault-recovery-pgp-1", "vault-rekey-unseal-2", "vault-root", "vault-test"} {
+		require.NoError(t, store.Set(key, []byte(key)))
+	}
+
+	assert.Equal(t, inMemoryStorage{"vault-unseal-0": []byte("vault-unseal-0"), "vault-unseal-3": []byte("vault-unseal-3"), "vault-test": []byte("vault-test")}, backends[0])
+	assert.Equal(t, inMemoryStorage{"vault-unseal-1": []byte("vault-unseal-1"), "vault-recovery-pgp-1": []byte("vault-recovery-pgp-1")}, backends[1])
+	assert.Equal(t, inMemoryStorage{"vault-unseal-2": []byte("vault-unseal-2"), "vault-rekey-unseal-2": []byte("vault-rekey-unseal-2")}, backends[2])
+	assert.Equal(t, inMemoryStorage{"vault-root": []byte("vault-root")}, rootToken)
+
+	val, err := store.Get("vault-unseal-2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("vault-unseal-2"), val)
+
+	val, err = store.Get("vault-root")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("vault-root"), val)
+
+	_, err = store.Get("vault-unseal-4")
+	assert.True(t, kv.IsNotFoundError(err), "missing keys should be not found errors")
+
+	_, err = New(nil, nil)
+	assert.Error(t, err)
+}
+
+func TestDistributedWithoutRootTokenBackend(t *testing.T) {
+	backends := []inMemoryStorage{{}, {}}
+	store, err := New([]kv.Service{backends[0], backends[1]}, nil)
+	require.NoError(t, err)
+
+	for _, key := range []string{"vault-root", "vault-root-wrapped"} {
+		assert.Error(t, store.Set(key, []byte(key)), "the root token must be refused")
+
+		_, err = store.Get(key)
+		assert.True(t, kv.IsNotFoundError(err), "the root token should be not found: %v", err)
+	}
+
+	assert.Empty(t, backends[0])
+	assert.Empty(t, backends[1])
+}
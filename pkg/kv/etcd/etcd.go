@@ -0,0 +1,170 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/pkg/transport"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Config holds the etcd connection settings, the TLS files are optional
+type Config struct {
+	Endpoints []string
+	Prefix    string
+	Username  string
+	Password  string
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+}
+
+type etcdStorage struct {
+	cl     *clientv3.Client
+	prefix string
+}
+
+// New creates a new kv.Service backed by etcd v3, without any encryption.
+// If a client certificate or CA file is configured mTLS is used to connect to etcd.
+func New(config Config) (kv.Service, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("at least one etcd endpoint is required") // nolint:goerr113
+	}
+
+	var tlsConfig *tls.Config
+	if config.CertFile != "" || config.CAFile != "" {
+		tlsInfo := transport.TLSInfo{
+			CertFile:      config.CertFile,
+			KeyFile:       config.KeyFile,
+			TrustedCAFile: config.CAFile,
+		}
+
+		var err error
+		tlsConfig, err = tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating etcd TLS config")
+		}
+	}
+
+	cl, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.Endpoints,
+		DialTimeout: requestTimeout,
+		TLS:         tlsConfig,
+		Username:    config.Username,
+		Password:    config.Password,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating etcd client")
+	}
+
+	return &etcdStorage{cl: cl, prefix: config.Prefix}, nil
+}
+
+func (e *etcdStorage) Set(key string, val []byte) error {
+	k := keyWithPrefix(e.prefix, key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if _, err := e.cl.Put(ctx, k, string(val)); err != nil {
+		return errors.Wrapf(err, "error writing key '%s' to etcd", k)
+	}
+
+	return nil
+}
+
+func (e *etcdStorage) Get(key string) ([]byte, error) {
+	k := keyWithPrefix(e.prefix, key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := e.cl.Get(ctx, k)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting key '%s' from etcd", k)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, kv.NewNotFoundError("key '%s' is not present in etcd", k)
+	}
+
+	return resp.Kvs[0].Value, nil
+}
+
+// Delete removes the key, a missing key isn't an error.
+func (e *etcdStorage) Delete(key string) error {
+	k := keyWithPrefix(e.prefix, key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if _, err := e.cl.Delete(ctx, k); err != nil {
+		return errors.Wrapf(err, "error deleting key '%s' from etcd", k)
+	}
+
+	return nil
+}
+
+// Lock creates the lock key attached to a lease if it doesn't exist yet,
+// the lock expires with the lease after the TTL if it isn't released.
+func (e *etcdStorage) Lock(name string, ttl time.Duration) (func() error, error) {
+	k := keyWithPrefix(e.prefix, name+".lock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	// etcd lease TTLs have a second granularity
+	lease, err := e.cl.Grant(ctx, int64(math.Ceil(ttl.Seconds())))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error granting etcd lease for lock '%s'", k)
+	}
+
+	resp, err := e.cl.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(k), "=", 0)).
+		Then(clientv3.OpPut(k, "bank-vaults", clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		_, _ = e.cl.Revoke(context.Background(), lease.ID)
+		return nil, errors.Wrapf(err, "error acquiring etcd lock '%s'", k)
+	}
+
+	if !resp.Succeeded {
+		_, _ = e.cl.Revoke(ctx, lease.ID)
+		return nil, errors.WithDetails(kv.ErrLocked, "lock", k)
+	}
+
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+
+		// revoking the lease deletes the lock key as well
+		_, err := e.cl.Revoke(ctx, lease.ID)
+		return errors.Wrapf(err, "error releasing etcd lock '%s'", k)
+	}, nil
+}
+
+func keyWithPrefix(prefix, key string) string {
+	return fmt.Sprintf("%s%s", prefix, key)
+}
@@ -0,0 +1,123 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/coreos/etcd/embed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+// newTestStorage starts an embedded single member etcd server listening on random local ports
+func newTestStorage(t *testing.T) (kv.Service, func()) {
+	dir, err := ioutil.TempDir("", "kv-etcd")
+	require.NoError(t, err)
+
+	clientURL, _ := url.Parse("http://127.0.0.1:0")
+	peerURL, _ := url.Parse("http://127.0.0.1:0")
+
+	config := embed.NewConfig()
+	config.Dir = dir
+	config.LCUrls, config.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	config.LPUrls, config.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	config.InitialCluster = config.InitialClusterFromName(config.Name)
+
+	server, err := embed.StartEtcd(config)
+	require.NoError(t, err)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		server.Close()
+		t.Fatal("etcd server didn't start")
+	}
+
+	service, err := New(Config{Endpoints: []string{server.Clients[0].Addr().String()}, Prefix: "vault/"})
+	require.NoError(t, err)
+
+	return service, func() {
+		_ = service.(*etcdStorage).cl.Close()
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEtcd(t *testing.T) {
+	service, done := newTestStorage(t)
+	defer done()
+
+	_, err := service.Get("vault-root")
+	assert.True(t, kv.IsNotFoundError(err), "missing keys should be not found errors: %v", err)
+
+	require.NoError(t, service.Set("vault-root", []byte("s.token")))
+
+	value, err := service.Get("vault-root")
+	require.NoError(t, err)
+	assert.Equal(t, "s.token", string(value))
+
+	require.NoError(t, kv.Delete(service, "vault-root"))
+
+	_, err = service.Get("vault-root")
+	assert.True(t, kv.IsNotFoundError(err), "the key should be deleted: %v", err)
+
+	_, err = New(Config{})
+	assert.Error(t, err, "an endpoint is required")
+}
+
+func TestLock(t *testing.T) {
+	service, done := newTestStorage(t)
+	defer done()
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err)
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock should be held: %v", err)
+
+	_, err = kv.Lock(service, "rekey", time.Minute)
+	assert.NoError(t, err, "locks with other names are independent")
+
+	require.NoError(t, unlock())
+
+	unlock, err = kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "the lock should be free after unlock")
+	require.NoError(t, unlock())
+}
+
+func TestLockExpiry(t *testing.T) {
+	service, done := newTestStorage(t)
+	defer done()
+
+	_, err := kv.Lock(service, "init", time.Second)
+	require.NoError(t, err)
+
+	// the lease of the lock expires without unlock
+	require.Eventually(t, func() bool {
+		unlock, err := kv.Lock(service, "init", time.Minute)
+		if err != nil {
+			return false
+		}
+		return unlock() == nil
+	}, 10*time.Second, 200*time.Millisecond, "an expired lock should be free")
+}
@@ -18,6 +18,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
+
+	"emperror.dev/errors"
 
 	"github.com/banzaicloud/bank-vaults/pkg/kv"
 )
@@ -45,3 +48,39 @@ func (f *file) Get(key string) ([]byte, error) {
 
 	return val, err
 }
+
+func (f *file) Delete(key string) error {
+	err := os.Remove(path.Join(f.path, key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "error deleting key '%s' from file", key)
+	}
+
+	return nil
+}
+
+// Lock creates an exclusive lock file, an expired lock file is taken over
+func (f *file) Lock(name string, ttl time.Duration) (func() error, error) {
+	lockFile := path.Join(f.path, name+".lock")
+
+	for i := 0; i < 2; i++ {
+		lock, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = lock.Close()
+			return func() error { return os.Remove(lockFile) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(err, "error creating lock file '%s'", lockFile)
+		}
+
+		info, err := os.Stat(lockFile)
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			return nil, errors.WithDetails(kv.ErrLocked, "lock", lockFile)
+		}
+
+		// The lock has expired, take it over
+		_ = os.Remove(lockFile)
+	}
+
+	return nil, errors.WithDetails(kv.ErrLocked, "lock", lockFile)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	service, err := New(dir)
+	require.NoError(t, err)
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err)
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock should be held: %v", err)
+
+	_, err = kv.Lock(service, "rekey", time.Minute)
+	assert.NoError(t, err, "locks with other names are independent")
+
+	require.NoError(t, unlock())
+
+	unlock, err = kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "the lock should be free after unlock")
+	require.NoError(t, unlock())
+}
+
+func TestLockExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	service, err := New(dir)
+	require.NoError(t, err)
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(path.Join(dir, "init.lock"), expired, expired))
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "an expired lock should be taken over")
+	require.NoError(t, unlock())
+}
+
+func TestDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	service, err := New(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Set("vault-rekey-unseal-0", []byte("key")))
+	require.NoError(t, kv.Delete(service, "vault-rekey-unseal-0"))
+
+	_, err = service.Get("vault-rekey-unseal-0")
+	assert.True(t, kv.IsNotFoundError(err), "the key should be deleted: %v", err)
+
+	assert.NoError(t, kv.Delete(service, "vault-rekey-unseal-0"), "deleting a missing key is not an error")
+}
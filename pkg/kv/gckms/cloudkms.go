@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"emperror.dev/errors"
 	"golang.org/x/oauth2/google"
@@ -103,3 +104,11 @@ func (g *googleKms) Set(key string, val []byte) error {
 
 	return g.store.Set(key, cipherText)
 }
+
+func (g *googleKms) Delete(key string) error {
+	return kv.Delete(g.store, key)
+}
+
+func (g *googleKms) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(g.store, name, ttl)
+}
@@ -18,9 +18,12 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"emperror.dev/errors"
+	"google.golang.org/api/googleapi"
 
 	"github.com/banzaicloud/bank-vaults/pkg/kv"
 )
@@ -76,6 +79,69 @@ func (g *gcsStorage) Get(key string) ([]byte, error) {
 	return b, nil
 }
 
+// Delete removes the object of the key, a missing object isn't an error
+func (g *gcsStorage) Delete(key string) error {
+	ctx := context.Background()
+	n := objectNameWithPrefix(g.prefix, key)
+
+	err := g.cl.Bucket(g.bucket).Object(n).Delete(ctx)
+	if err != nil && err != storage.ErrObjectNotExist { // nolint:goerr113
+		return errors.Wrapf(err, "error deleting key '%s' from gcs bucket '%s'", n, g.bucket)
+	}
+
+	return nil
+}
+
+// Lock creates a lock object only if it doesn't exist yet, an expired lock object is taken over
+func (g *gcsStorage) Lock(name string, ttl time.Duration) (func() error, error) {
+	ctx := context.Background()
+	n := objectNameWithPrefix(g.prefix, name+".lock")
+
+	for i := 0; i < 2; i++ {
+		o := g.cl.Bucket(g.bucket).Object(n)
+
+		w := o.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+		w.Metadata = map[string]string{"expires-at": time.Now().Add(ttl).UTC().Format(time.RFC3339)}
+		_, _ = w.Write([]byte(name))
+
+		err := w.Close()
+		if err == nil {
+			generation := w.Attrs().Generation
+			return func() error {
+				err := o.If(storage.Conditions{GenerationMatch: generation}).Delete(ctx)
+				return errors.Wrapf(err, "error deleting lock object '%s'", n)
+			}, nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, errors.Wrapf(err, "error creating lock object '%s' in gcs bucket '%s'", n, g.bucket)
+		}
+
+		attrs, err := o.Attrs(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting lock object '%s'", n)
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, attrs.Metadata["expires-at"])
+		if err == nil && time.Now().Before(expiresAt) {
+			return nil, errors.WithDetails(kv.ErrLocked, "lock", n, "expires", expiresAt)
+		}
+
+		// The lock has expired, take it over
+		err = o.If(storage.Conditions{GenerationMatch: attrs.Generation}).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist && !isPreconditionFailed(err) { // nolint:goerr113
+			return nil, errors.Wrapf(err, "error deleting expired lock object '%s'", n)
+		}
+	}
+
+	return nil, errors.WithDetails(kv.ErrLocked, "lock", n)
+}
+
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
 func objectNameWithPrefix(prefix, key string) string {
 	return fmt.Sprintf("%s%s", prefix, key)
 }
@@ -0,0 +1,163 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type fakeObject struct {
+	Bucket     string            `json:"bucket"`
+	Name       string            `json:"name"`
+	Generation int64             `json:"generation,string"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// fakeGCS serves the object insert, get and delete calls of the JSON API with generation preconditions
+type fakeGCS struct {
+	mu         sync.Mutex
+	objects    map[string]*fakeObject
+	generation int64
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	precondition := r.URL.Query().Get("ifGenerationMatch")
+
+	writeError := func(code int) {
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"error": {"code": ` + strconv.Itoa(code) + `, "message": "` + http.StatusText(code) + `"}}`))
+	}
+
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/") {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeError(http.StatusBadRequest)
+			return
+		}
+		part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+		if err != nil {
+			writeError(http.StatusBadRequest)
+			return
+		}
+		var object fakeObject
+		if err := json.NewDecoder(part).Decode(&object); err != nil {
+			writeError(http.StatusBadRequest)
+			return
+		}
+
+		current, exists := f.objects[object.Name]
+		if precondition == "0" && exists || precondition != "" && precondition != "0" && (!exists || strconv.FormatInt(current.Generation, 10) != precondition) {
+			writeError(http.StatusPreconditionFailed)
+			return
+		}
+
+		f.generation++
+		object.Generation = f.generation
+		f.objects[object.Name] = &object
+		_ = json.NewEncoder(w).Encode(object)
+		return
+	}
+
+	name := r.URL.Path[strings.Index(r.URL.Path, "/o/")+len("/o/"):]
+	current, exists := f.objects[name]
+	if !exists {
+		writeError(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(current)
+	case http.MethodDelete:
+		if precondition != "" && strconv.FormatInt(current.Generation, 10) != precondition {
+			writeError(http.StatusPreconditionFailed)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestStorage(t *testing.T) (*gcsStorage, *fakeGCS, func()) {
+	fake := &fakeGCS{objects: map[string]*fakeObject{}}
+	server := httptest.NewServer(fake)
+
+	cl, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	return &gcsStorage{cl: cl, bucket: "bucket", prefix: "vault/"}, fake, server.Close
+}
+
+func TestLock(t *testing.T) {
+	service, fake, done := newTestStorage(t)
+	defer done()
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err)
+	require.Contains(t, fake.objects, "vault/init.lock")
+	_, err = time.Parse(time.RFC3339, fake.objects["vault/init.lock"].Metadata["expires-at"])
+	assert.NoError(t, err, "the lock object should carry its expiration")
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock should be held: %v", err)
+
+	require.NoError(t, unlock())
+	assert.NotContains(t, fake.objects, "vault/init.lock")
+
+	unlock, err = kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "the lock should be free after unlock")
+	require.NoError(t, unlock())
+}
+
+func TestLockExpiry(t *testing.T) {
+	service, _, done := newTestStorage(t)
+	defer done()
+
+	expiredUnlock, err := kv.Lock(service, "init", -time.Minute)
+	require.NoError(t, err)
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "an expired lock should be taken over")
+
+	assert.Error(t, expiredUnlock(), "the expired lock can't release the lock which took it over")
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock which took over should be held: %v", err)
+
+	require.NoError(t, unlock())
+}
@@ -0,0 +1,202 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hsm
+
+import (
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+// slotService is a KV encryptor bound to a single HSM slot
+type slotService interface {
+	kv.Service
+	healthCheck() error
+	Delete(key string) error
+	Lock(name string, ttl time.Duration) (func() error, error)
+	close() error
+}
+
+type failoverSlot struct {
+	label   string
+	service slotService
+}
+
+// failoverCrypto uses the first healthy of an ordered list of HSM slots for reading,
+// so an outage of a single HSM partition doesn't stop the unsealing.
+// The values are written to all the slots, each of them stores its own copy encrypted with its own key pair,
+// and the write fails if any of the slots is unavailable, so no slot is left behind with a missing or stale value.
+type failoverCrypto struct {
+	mu    sync.Mutex
+	slots []*failoverSlot
+	open  func(label string) (slotService, error)
+	log   *logrus.Logger
+}
+
+func newFailover(config Config, storage kv.Service) (kv.Service, error) {
+	f := &failoverCrypto{
+		log: logrus.New(),
+		open: func(label string) (slotService, error) {
+			slotConfig := config
+			slotConfig.TokenLabel = label
+			slotConfig.TokenLabels = nil
+
+			return newSlot(slotConfig, slotStorage{Service: storage, label: label})
+		},
+	}
+
+	for _, label := range config.TokenLabels {
+		f.slots = append(f.slots, &failoverSlot{label: label})
+	}
+
+	// open the slots eagerly to fail fast if none of them is usable
+	err := f.do(func(slotService) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// slotStorage stores the values of a slot under the keys suffixed with its token label,
+// the locks are shared by all the slots
+type slotStorage struct {
+	kv.Service
+	label string
+}
+
+func (s slotStorage) Get(key string) ([]byte, error) {
+	return s.Service.Get(key + "." + s.label)
+}
+
+func (s slotStorage) Set(key string, value []byte) error {
+	return s.Service.Set(key+"."+s.label, value)
+}
+
+func (s slotStorage) Delete(key string) error {
+	return kv.Delete(s.Service, key+"."+s.label)
+}
+
+func (s slotStorage) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(s.Service, name, ttl)
+}
+
+// available opens the slot, or health-checks it if it is open already
+func (f *failoverCrypto) available(slot *failoverSlot) error {
+	if slot.service == nil {
+		service, err := f.open(slot.label)
+		if err != nil {
+			f.log.Warnf("can't open HSM slot with token label %q: %s", slot.label, err)
+			return errors.WrapIff(err, "token %q", slot.label)
+		}
+		slot.service = service
+	} else if err := slot.service.healthCheck(); err != nil {
+		f.log.Warnf("HSM slot with token label %q is unhealthy: %s", slot.label, err)
+		// the session is reopened when the slot becomes healthy again
+		if err := slot.service.close(); err != nil {
+			f.log.Warnf("can't close the session of HSM slot with token label %q: %s", slot.label, err)
+		}
+		slot.service = nil
+		return errors.WrapIff(err, "token %q", slot.label)
+	}
+
+	return nil
+}
+
+// do runs fn on the slots in order until it succeeds, opening and health-checking each slot
+// before use. Errors which are not caused by the slot (missing keys, held locks) are returned as is.
+func (f *failoverCrypto) do(fn func(slotService) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+
+	for _, slot := range f.slots {
+		if err := f.available(slot); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err := fn(slot.service)
+		if err == nil || kv.IsNotFoundError(err) || errors.Is(err, kv.ErrLocked) || errors.Is(err, kv.ErrLockingNotSupported) {
+			return err
+		}
+
+		f.log.Warnf("HSM slot with token label %q failed, falling back to the next one: %s", slot.label, err)
+		errs = append(errs, errors.WrapIff(err, "token %q", slot.label))
+	}
+
+	return errors.WrapIf(errors.Combine(errs...), "none of the HSM slots are available")
+}
+
+// each runs fn on all the slots, it fails if any of the slots is unavailable or fn fails on it
+func (f *failoverCrypto) each(fn func(slotService) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+
+	for _, slot := range f.slots {
+		if err := f.available(slot); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := fn(slot.service); err != nil {
+			f.log.Warnf("HSM slot with token label %q failed: %s", slot.label, err)
+			errs = append(errs, errors.WrapIff(err, "token %q", slot.label))
+		}
+	}
+
+	return errors.WrapIf(errors.Combine(errs...), "not all the HSM slots are available")
+}
+
+func (f *failoverCrypto) Get(key string) ([]byte, error) {
+	var value []byte
+	err := f.do(func(s slotService) error {
+		var err error
+		value, err = s.Get(key)
+		return err
+	})
+
+	return value, err
+}
+
+func (f *failoverCrypto) Set(key string, value []byte) error {
+	return f.each(func(s slotService) error {
+		return s.Set(key, value)
+	})
+}
+
+func (f *failoverCrypto) Delete(key string) error {
+	return f.each(func(s slotService) error {
+		return s.Delete(key)
+	})
+}
+
+func (f *failoverCrypto) Lock(name string, ttl time.Duration) (func() error, error) {
+	var unlock func() error
+	err := f.do(func(s slotService) error {
+		var err error
+		unlock, err = s.Lock(name, ttl)
+		return err
+	})
+
+	return unlock, err
+}
@@ -0,0 +1,195 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hsm
+
+import (
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type fakeSlot struct {
+	data      map[string][]byte
+	unhealthy bool
+	closed    int
+}
+
+func (s *fakeSlot) Get(key string) ([]byte, error) {
+	if s.unhealthy {
+		return nil, errors.New("device error")
+	}
+	if data, ok := s.data[key]; ok {
+		return data, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s *fakeSlot) Set(key string, value []byte) error {
+	if s.unhealthy {
+		return errors.New("device error")
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *fakeSlot) healthCheck() error {
+	if s.unhealthy {
+		return errors.New("token removed")
+	}
+	return nil
+}
+
+func (s *fakeSlot) Delete(key string) error {
+	if s.unhealthy {
+		return errors.New("device error")
+	}
+	delete(s.data, key)
+	return nil
+}
+
+func (s *fakeSlot) Lock(string, time.Duration) (func() error, error) {
+	return nil, kv.ErrLockingNotSupported
+}
+
+func (s *fakeSlot) close() error {
+	s.closed++
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	slots := map[string]*fakeSlot{
+		"primary":   {data: map[string][]byte{"key": []byte("primary")}},
+		"secondary": {data: map[string][]byte{"key": []byte("secondary")}},
+	}
+
+	f := &failoverCrypto{
+		log: logrus.New(),
+		open: func(label string) (slotService, error) {
+			if slot, ok := slots[label]; ok {
+				return slot, nil
+			}
+			return nil, errors.New("can't find HSM slot")
+		},
+	}
+	for _, label := range []string{"missing", "primary", "secondary"} {
+		f.slots = append(f.slots, &failoverSlot{label: label})
+	}
+
+	value, err := f.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "primary", string(value))
+
+	_, err = f.Get("other")
+	assert.True(t, kv.IsNotFoundError(err), "not found errors must not fall back")
+
+	slots["primary"].unhealthy = true
+
+	value, err = f.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", string(value))
+	assert.Equal(t, 1, slots["primary"].closed, "the session of the unhealthy slot should be closed")
+
+	slots["secondary"].unhealthy = true
+
+	_, err = f.Get("key")
+	assert.Error(t, err)
+}
+
+func TestFailoverWritesAllSlots(t *testing.T) {
+	slots := map[string]*fakeSlot{
+		"primary":   {data: map[string][]byte{}},
+		"secondary": {data: map[string][]byte{}},
+	}
+
+	f := &failoverCrypto{
+		log: logrus.New(),
+		open: func(label string) (slotService, error) {
+			return slots[label], nil
+		},
+	}
+	for _, label := range []string{"primary", "secondary"} {
+		f.slots = append(f.slots, &failoverSlot{label: label})
+	}
+
+	require.NoError(t, f.Set("vault-unseal-0", []byte("unseal")))
+
+	// the key written while the primary slot was in use is readable after losing it
+	slots["primary"].unhealthy = true
+
+	value, err := f.Get("vault-unseal-0")
+	require.NoError(t, err)
+	assert.Equal(t, "unseal", string(value))
+
+	err = f.Set("vault-unseal-0", []byte("rekeyed"))
+	assert.Error(t, err, "a write must fail if a slot would be left behind with a stale value")
+	assert.Equal(t, "rekeyed", string(slots["secondary"].data["vault-unseal-0"]))
+
+	slots["primary"].unhealthy = false
+
+	require.NoError(t, f.Delete("vault-unseal-0"))
+	assert.Empty(t, slots["primary"].data)
+	assert.Empty(t, slots["secondary"].data)
+}
+
+type lockingStorage map[string][]byte
+
+func (s lockingStorage) Get(key string) ([]byte, error) {
+	if value, ok := s[key]; ok {
+		return value, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s lockingStorage) Set(key string, value []byte) error {
+	s[key] = value
+	return nil
+}
+
+func (s lockingStorage) Lock(name string, _ time.Duration) (func() error, error) {
+	if _, ok := s[name+".lock"]; ok {
+		return nil, kv.ErrLocked
+	}
+	s[name+".lock"] = nil
+	return func() error { delete(s, name+".lock"); return nil }, nil
+}
+
+func TestSlotStorage(t *testing.T) {
+	storage := lockingStorage{}
+	primary := slotStorage{Service: storage, label: "primary"}
+	secondary := slotStorage{Service: storage, label: "secondary"}
+
+	require.NoError(t, primary.Set("vault-root", []byte("primary")))
+	require.NoError(t, secondary.Set("vault-root", []byte("secondary")))
+	assert.Equal(t, "primary", string(storage["vault-root.primary"]))
+	assert.Equal(t, "secondary", string(storage["vault-root.secondary"]))
+
+	value, err := secondary.Get("vault-root")
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", string(value))
+
+	assert.True(t, errors.Is(primary.Delete("vault-root"), kv.ErrDeletingNotSupported))
+
+	unlock, err := primary.Lock("init", time.Minute)
+	require.NoError(t, err)
+	_, err = secondary.Lock("init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the slots should share the locks: %v", err)
+	require.NoError(t, unlock())
+}
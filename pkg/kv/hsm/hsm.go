@@ -18,6 +18,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/miekg/pkcs11"
@@ -38,6 +39,7 @@ type hsmCrypto struct {
 	storage    kv.Service
 	log        *logrus.Logger
 	session    p11.Session
+	slot       p11.Slot
 	encrypt    cryptoFunc
 	decrypt    cryptoFunc
 }
@@ -49,10 +51,27 @@ type Config struct {
 	TokenLabel string
 	Pin        string
 	KeyLabel   string
+
+	// TokenLabels is an ordered list of token labels to fall back between,
+	// when set it takes precedence over SlotID and TokenLabel
+	TokenLabels []string
 }
 
 // New returns a HSM backed KV encryptor. Currently RSA keys are supported only.
 func New(config Config, storage kv.Service) (kv.Service, error) {
+	if len(config.TokenLabels) > 0 {
+		return newFailover(config, storage)
+	}
+
+	slot, err := newSlot(config, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+func newSlot(config Config, storage kv.Service) (*hsmCrypto, error) {
 	log := logrus.New()
 
 	if config.KeyLabel == "" {
@@ -221,6 +240,7 @@ func New(config Config, storage kv.Service) (kv.Service, error) {
 	return &hsmCrypto{
 		log:        log,
 		session:    session,
+		slot:       *slot,
 		privateKey: privateKey,
 		publicKey:  publicKey,
 		storage:    storage,
@@ -318,3 +338,23 @@ func (h *hsmStorage) Set(key string, value []byte) error {
 	_, err := h.session.CreateObject(attributes)
 	return errors.Wrap(err, "failed to write object to HSM")
 }
+
+// healthCheck checks that the token of the slot is still reachable
+func (h *hsmCrypto) healthCheck() error {
+	_, err := h.slot.TokenInfo()
+	return errors.WrapIf(err, "can't query token info from slot")
+}
+
+// close logs out and closes the session of the slot
+func (h *hsmCrypto) close() error {
+	logoutErr := h.session.Logout()
+	return errors.Combine(logoutErr, h.session.Close())
+}
+
+func (h *hsmCrypto) Delete(key string) error {
+	return kv.Delete(h.storage, key)
+}
+
+func (h *hsmCrypto) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(h.storage, name, ttl)
+}
@@ -16,7 +16,9 @@ package k8s
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"time"
 
 	"emperror.dev/errors"
 	v1 "k8s.io/api/core/v1"
@@ -33,8 +35,11 @@ import (
 // TODO: remove this in the next release.
 const EnvK8SOwnerReference = "K8S_OWNER_REFERENCE"
 
+// lockExpiresAnnotation holds the expiration time of a lock Secret
+const lockExpiresAnnotation = "vault.banzaicloud.io/lock-expires-at"
+
 type k8sStorage struct {
-	client         *kubernetes.Clientset
+	client         kubernetes.Interface
 	namespace      string
 	secret         string
 	labels         map[string]string
@@ -127,3 +132,80 @@ func (k *k8sStorage) Get(key string) ([]byte, error) {
 
 	return val, nil
 }
+
+// Delete removes the key from the Secret holding the values, a missing key or Secret isn't an error
+func (k *k8sStorage) Delete(key string) error {
+	secret, err := k.client.CoreV1().Secrets(k.namespace).Get(k.secret, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error checking if '%s' secret exists", k.secret)
+	}
+
+	if _, ok := secret.Data[key]; !ok {
+		return nil
+	}
+
+	delete(secret.Data, key)
+	if _, err := k.client.CoreV1().Secrets(k.namespace).Update(secret); err != nil {
+		return errors.Wrapf(err, "error deleting secret key '%s' from secret '%s'", key, k.secret)
+	}
+
+	return nil
+}
+
+// Lock creates a lock Secret next to the Secret holding the values, an expired lock Secret is taken over
+func (k *k8sStorage) Lock(name string, ttl time.Duration) (func() error, error) {
+	lockName := fmt.Sprintf("%s-%s-lock", k.secret, name)
+
+	for i := 0; i < 2; i++ {
+		lock := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   k.namespace,
+				Name:        lockName,
+				Labels:      k.labels,
+				Annotations: map[string]string{lockExpiresAnnotation: time.Now().Add(ttl).UTC().Format(time.RFC3339)},
+			},
+		}
+		if k.ownerReference != nil {
+			lock.ObjectMeta.SetOwnerReferences([]metav1.OwnerReference{*k.ownerReference})
+		}
+
+		lock, err := k.client.CoreV1().Secrets(k.namespace).Create(lock)
+		if err == nil {
+			uid := lock.UID
+			return func() error {
+				err := k.client.CoreV1().Secrets(k.namespace).Delete(lockName, &metav1.DeleteOptions{
+					Preconditions: &metav1.Preconditions{UID: &uid},
+				})
+				return errors.Wrapf(err, "error deleting lock secret '%s'", lockName)
+			}, nil
+		}
+
+		if !k8serrors.IsAlreadyExists(err) {
+			return nil, errors.Wrapf(err, "error creating lock secret '%s'", lockName)
+		}
+
+		current, err := k.client.CoreV1().Secrets(k.namespace).Get(lockName, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting lock secret '%s'", lockName)
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, current.Annotations[lockExpiresAnnotation])
+		if err == nil && time.Now().Before(expiresAt) {
+			return nil, errors.WithDetails(kv.ErrLocked, "lock", lockName, "expires", expiresAt)
+		}
+
+		// The lock has expired, take it over
+		uid := current.UID
+		err = k.client.CoreV1().Secrets(k.namespace).Delete(lockName, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "error deleting expired lock secret '%s'", lockName)
+		}
+	}
+
+	return nil, errors.WithDetails(kv.ErrLocked, "lock", lockName)
+}
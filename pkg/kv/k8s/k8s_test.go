@@ -0,0 +1,83 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+func TestLock(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	service := &k8sStorage{client: client, namespace: "vault", secret: "vault-unseal-keys"}
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err)
+
+	lock, err := client.CoreV1().Secrets("vault").Get("vault-unseal-keys-init-lock", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, lock.Annotations[lockExpiresAnnotation])
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock should be held: %v", err)
+
+	require.NoError(t, unlock())
+
+	_, err = client.CoreV1().Secrets("vault").Get("vault-unseal-keys-init-lock", metav1.GetOptions{})
+	assert.Error(t, err, "the lock secret should be deleted by unlock")
+
+	unlock, err = kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "the lock should be free after unlock")
+	require.NoError(t, unlock())
+}
+
+func TestLockExpiry(t *testing.T) {
+	service := &k8sStorage{client: fake.NewSimpleClientset(), namespace: "vault", secret: "vault-unseal-keys"}
+
+	_, err := kv.Lock(service, "init", -time.Minute)
+	require.NoError(t, err)
+
+	unlock, err := kv.Lock(service, "init", time.Minute)
+	require.NoError(t, err, "an expired lock should be taken over")
+
+	_, err = kv.Lock(service, "init", time.Minute)
+	assert.True(t, errors.Is(err, kv.ErrLocked), "the lock which took over should be held: %v", err)
+
+	require.NoError(t, unlock())
+}
+
+func TestDelete(t *testing.T) {
+	service := &k8sStorage{client: fake.NewSimpleClientset(), namespace: "vault", secret: "vault-unseal-keys"}
+
+	assert.NoError(t, kv.Delete(service, "vault-rekey-unseal-0"), "deleting from a missing secret is not an error")
+
+	require.NoError(t, service.Set("vault-unseal-0", []byte("key")))
+	require.NoError(t, service.Set("vault-rekey-unseal-0", []byte("key")))
+	require.NoError(t, kv.Delete(service, "vault-rekey-unseal-0"))
+
+	_, err := service.Get("vault-rekey-unseal-0")
+	assert.True(t, kv.IsNotFoundError(err), "the key should be deleted: %v", err)
+
+	_, err = service.Get("vault-unseal-0")
+	assert.NoError(t, err, "the other keys of the secret should be kept")
+}
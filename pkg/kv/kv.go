@@ -16,10 +16,20 @@ package kv
 
 import (
 	"fmt"
+	"time"
 
 	"emperror.dev/errors"
 )
 
+// ErrLockingNotSupported is returned when a kv.Service doesn't support locking
+const ErrLockingNotSupported = errors.Sentinel("locking is not supported by the key-value store")
+
+// ErrLocked is returned when a lock is held by someone else
+const ErrLocked = errors.Sentinel("the lock is held by someone else")
+
+// ErrDeletingNotSupported is returned when a kv.Service doesn't support deleting keys
+const ErrDeletingNotSupported = errors.Sentinel("deleting is not supported by the key-value store")
+
 // NotFoundError represents an error when a key is not found
 type NotFoundError struct {
 	msg string // description of error
@@ -52,3 +62,36 @@ type Service interface {
 	Set(key string, value []byte) error
 	Get(key string) ([]byte, error)
 }
+
+// Locker is implemented by the key-value stores which support advisory locking,
+// to protect destructive operations from concurrent writers.
+type Locker interface {
+	// Lock acquires the named lock, which expires after ttl if it is not released with unlock.
+	Lock(name string, ttl time.Duration) (unlock func() error, err error)
+}
+
+// Lock acquires the named lock of the store if it supports locking.
+func Lock(s Service, name string, ttl time.Duration) (func() error, error) {
+	locker, ok := s.(Locker)
+	if !ok {
+		return nil, ErrLockingNotSupported
+	}
+
+	return locker.Lock(name, ttl)
+}
+
+// Deleter is implemented by the key-value stores which support deleting keys.
+type Deleter interface {
+	// Delete removes the key, removing a missing key is not an error.
+	Delete(key string) error
+}
+
+// Delete removes the key from the store if it supports deleting keys.
+func Delete(s Service, key string) error {
+	deleter, ok := s.(Deleter)
+	if !ok {
+		return ErrDeletingNotSupported
+	}
+
+	return deleter.Delete(key)
+}
@@ -0,0 +1,125 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localkms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+// ciphertextPrefix marks the values in the same format as Vault's transit secret engine does
+const ciphertextPrefix = "vault:v1:"
+
+type localKMS struct {
+	store kv.Service
+	aead  cipher.AEAD
+}
+
+var _ kv.Service = &localKMS{}
+
+// New creates a new kv.Service encrypted locally with AES-256-GCM, using a base64 encoded 32 byte key
+func New(store kv.Service, encodedKey string) (kv.Service, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding encryption key")
+	}
+
+	if len(key) != 32 {
+		return nil, errors.Errorf("invalid encryption key length: %d, a 32 byte key is required", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating gcm cipher")
+	}
+
+	return &localKMS{store: store, aead: aead}, nil
+}
+
+// encrypt encrypts the value of the key, the key is authenticated as additional data,
+// so a ciphertext can't be swapped with the one of another key in the store
+func (l *localKMS) encrypt(key string, s []byte) ([]byte, error) {
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "error generating nonce")
+	}
+
+	ciphertext := l.aead.Seal(nonce, nonce, s, []byte(key))
+
+	return []byte(ciphertextPrefix + base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+func (l *localKMS) decrypt(key string, s []byte) ([]byte, error) {
+	if !strings.HasPrefix(string(s), ciphertextPrefix) {
+		return nil, errors.New("value is not encrypted with a local key") // nolint:goerr113
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(s), ciphertextPrefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding ciphertext")
+	}
+
+	nonceSize := l.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext is too short") // nolint:goerr113
+	}
+
+	plaintext, err := l.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting ciphertext")
+	}
+
+	return plaintext, nil
+}
+
+func (l *localKMS) Get(key string) ([]byte, error) {
+	cipherText, err := l.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.decrypt(key, cipherText)
+}
+
+func (l *localKMS) Set(key string, val []byte) error {
+	cipherText, err := l.encrypt(key, val)
+	if err != nil {
+		return err
+	}
+
+	return l.store.Set(key, cipherText)
+}
+
+func (l *localKMS) Delete(key string) error {
+	return kv.Delete(l.store, key)
+}
+
+func (l *localKMS) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(l.store, name, ttl)
+}
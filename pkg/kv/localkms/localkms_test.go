@@ -0,0 +1,68 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localkms
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type inMemoryStorage map[string][]byte
+
+func (s inMemoryStorage) Get(key string) ([]byte, error) {
+	if data, ok := s[key]; ok {
+		return data, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s inMemoryStorage) Set(key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func TestLocalKMS(t *testing.T) {
+	storage := inMemoryStorage{}
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	service, err := New(storage, key)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Set("vault-root", []byte("s.token")))
+
+	assert.True(t, strings.HasPrefix(string(storage["vault-root"]), ciphertextPrefix))
+	assert.NotContains(t, string(storage["vault-root"]), "s.token")
+
+	value, err := service.Get("vault-root")
+	require.NoError(t, err)
+	assert.Equal(t, "s.token", string(value))
+
+	// a ciphertext moved to another key isn't accepted
+	storage["vault-unseal-0"] = storage["vault-root"]
+	_, err = service.Get("vault-unseal-0")
+	assert.Error(t, err)
+
+	_, err = service.Get("missing")
+	assert.True(t, kv.IsNotFoundError(err))
+
+	_, err = New(storage, base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
@@ -15,6 +15,8 @@
 package multi
 
 import (
+	"time"
+
 	"emperror.dev/errors"
 	"github.com/sirupsen/logrus"
 
@@ -58,3 +60,44 @@ func (f *multi) Get(key string) ([]byte, error) {
 	}
 	return nil, multiErr
 }
+
+// Delete removes the key from all the Services
+func (f *multi) Delete(key string) error {
+	for _, service := range f.services {
+		if err := kv.Delete(service, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lock acquires the lock in all the Services which support locking
+func (f *multi) Lock(name string, ttl time.Duration) (func() error, error) {
+	var unlocks []func() error
+
+	unlock := func() error {
+		var err error
+		for _, unlock := range unlocks {
+			err = errors.Append(err, unlock())
+		}
+		return err
+	}
+
+	for _, service := range f.services {
+		u, err := kv.Lock(service, name, ttl)
+		if errors.Is(err, kv.ErrLockingNotSupported) {
+			continue
+		}
+		if err != nil {
+			_ = unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, u)
+	}
+
+	if len(unlocks) == 0 {
+		return nil, kv.ErrLockingNotSupported
+	}
+
+	return unlock, nil
+}
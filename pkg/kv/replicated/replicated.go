@@ -0,0 +1,234 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replicated
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type replicated struct {
+	replicas    []kv.Service
+	writeQuorum int
+	readQuorum  int
+}
+
+type result struct {
+	replica int
+	val     []byte
+	err     error
+}
+
+// New creates a new kv.Service which replicates the values to all the replicas (for example
+// buckets in different regions). A write succeeds if at least writeQuorum replicas stored the value,
+// a read succeeds if at least readQuorum replicas returned the same value and no other value reached
+// the read quorum. The write quorum defaults to the majority of the replicas, the read quorum to the
+// smallest one which overlaps every write quorum, so losing a minority of the replicas never blocks
+// unsealing, and with two replicas (which have no tolerable minority) losing one only blocks writes.
+func New(replicas []kv.Service, writeQuorum, readQuorum int) (kv.Service, error) {
+	if len(replicas) == 0 {
+		return nil, errors.New("at least one replica is required") // nolint:goerr113
+	}
+
+	if writeQuorum == 0 {
+		writeQuorum = len(replicas)/2 + 1
+	}
+	if readQuorum == 0 {
+		readQuorum = len(replicas) - writeQuorum + 1
+	}
+
+	if writeQuorum < 1 || writeQuorum > len(replicas) {
+		return nil, errors.Errorf("write quorum must be between 1 and %d: %d", len(replicas), writeQuorum)
+	}
+	if readQuorum < 1 || readQuorum > len(replicas) {
+		return nil, errors.Errorf("read quorum must be between 1 and %d: %d", len(replicas), readQuorum)
+	}
+
+	return &replicated{replicas: replicas, writeQuorum: writeQuorum, readQuorum: readQuorum}, nil
+}
+
+// each calls fn on all the replicas in parallel and returns the results in replica order
+func (r *replicated) each(fn func(kv.Service) ([]byte, error)) []result {
+	results := make([]result, len(r.replicas))
+
+	var wg sync.WaitGroup
+	for i, replica := range r.replicas {
+		wg.Add(1)
+		go func(i int, replica kv.Service) {
+			defer wg.Done()
+			val, err := fn(replica)
+			results[i] = result{replica: i, val: val, err: err}
+		}(i, replica)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (r *replicated) Set(key string, val []byte) error {
+	results := r.each(func(replica kv.Service) ([]byte, error) {
+		return nil, replica.Set(key, val)
+	})
+
+	var written int
+	var multiErr error
+	for _, res := range results {
+		if res.err != nil {
+			logrus.Warnf("error setting key %q in replica %d: %s", key, res.replica, res.err)
+			multiErr = errors.Append(multiErr, res.err)
+			continue
+		}
+		written++
+	}
+
+	if written < r.writeQuorum {
+		return errors.WrapWithDetails(multiErr, "write quorum not reached", "key", key, "written", written, "quorum", r.writeQuorum)
+	}
+
+	return nil
+}
+
+func (r *replicated) Get(key string) ([]byte, error) {
+	results := r.each(func(replica kv.Service) ([]byte, error) {
+		return replica.Get(key)
+	})
+
+	var values [][]byte
+	var votes []int
+	var notFound int
+	var multiErr error
+
+	for _, res := range results {
+		if res.err != nil {
+			if kv.IsNotFoundError(res.err) {
+				notFound++
+				continue
+			}
+			logrus.Warnf("error getting key %q from replica %d: %s", key, res.replica, res.err)
+			multiErr = errors.Append(multiErr, res.err)
+			continue
+		}
+
+		found := false
+		for i, val := range values {
+			if bytes.Equal(val, res.val) {
+				votes[i]++
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, res.val)
+			votes = append(votes, 1)
+		}
+	}
+
+	var agreed [][]byte
+	for i, val := range values {
+		if votes[i] >= r.readQuorum {
+			agreed = append(agreed, val)
+		}
+	}
+
+	if len(agreed) == 1 {
+		r.repair(key, agreed[0], results)
+		return agreed[0], nil
+	}
+
+	if len(agreed) > 1 {
+		return nil, errors.NewWithDetails("the replicas disagree on the value", "key", key, "values", len(agreed), "quorum", r.readQuorum)
+	}
+
+	if len(values) == 0 && notFound >= r.readQuorum {
+		return nil, kv.NewNotFoundError("key '%s' is not present in %d replicas", key, notFound)
+	}
+
+	return nil, errors.WrapWithDetails(
+		errors.Append(multiErr, errors.New("no value has been agreed on by enough replicas")), // nolint:goerr113
+		"read quorum not reached", "key", key, "quorum", r.readQuorum, "notFound", notFound,
+	)
+}
+
+// repair writes the agreed value back to the replicas which are missing it or store a different one,
+// for example after an unsuccessful write or when a new replica has been added
+func (r *replicated) repair(key string, val []byte, results []result) {
+	for _, res := range results {
+		if res.err == nil && bytes.Equal(res.val, val) {
+			continue
+		}
+		if res.err != nil && !kv.IsNotFoundError(res.err) {
+			continue
+		}
+
+		logrus.Infof("repairing key %q in replica %d", key, res.replica)
+		if err := r.replicas[res.replica].Set(key, val); err != nil {
+			logrus.Warnf("error repairing key %q in replica %d: %s", key, res.replica, err)
+		}
+	}
+}
+
+// Delete removes the key from all the replicas, it fails if any of them fails,
+// so a key is never left behind in a replica which could outvote the others later
+func (r *replicated) Delete(key string) error {
+	results := r.each(func(replica kv.Service) ([]byte, error) {
+		return nil, kv.Delete(replica, key)
+	})
+
+	var multiErr error
+	for _, res := range results {
+		if res.err != nil {
+			multiErr = errors.Append(multiErr, errors.WrapWithDetails(res.err, "error deleting key", "key", key, "replica", res.replica))
+		}
+	}
+
+	return multiErr
+}
+
+// Lock acquires the lock in all the replicas which support locking
+func (r *replicated) Lock(name string, ttl time.Duration) (func() error, error) {
+	var unlocks []func() error
+
+	unlock := func() error {
+		var err error
+		for _, unlock := range unlocks {
+			err = errors.Append(err, unlock())
+		}
+		return err
+	}
+
+	for _, replica := range r.replicas {
+		u, err := kv.Lock(replica, name, ttl)
+		if errors.Is(err, kv.ErrLockingNotSupported) {
+			continue
+		}
+		if err != nil {
+			_ = unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, u)
+	}
+
+	if len(unlocks) == 0 {
+		return nil, kv.ErrLockingNotSupported
+	}
+
+	return unlock, nil
+}
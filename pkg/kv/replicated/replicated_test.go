@@ -0,0 +1,141 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replicated
+
+import (
+	"sync"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type inMemoryStorage struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	down bool
+}
+
+func newInMemoryStorage() *inMemoryStorage {
+	return &inMemoryStorage{data: map[string][]byte{}}
+}
+
+func (s *inMemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return nil, errors.New("region is down")
+	}
+	if data, ok := s.data[key]; ok {
+		return data, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s *inMemoryStorage) Set(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errors.New("region is down")
+	}
+	s.data[key] = data
+	return nil
+}
+
+func TestReplicated(t *testing.T) {
+	euWest, usEast, apSouth := newInMemoryStorage(), newInMemoryStorage(), newInMemoryStorage()
+
+	service, err := New([]kv.Service{euWest, usEast, apSouth}, 0, 0)
+	require.NoError(t, err)
+
+	_, err = service.Get("vault-root")
+	assert.True(t, kv.IsNotFoundError(err))
+
+	require.NoError(t, service.Set("vault-root", []byte("s.token")))
+	assert.Equal(t, "s.token", string(apSouth.data["vault-root"]))
+
+	// losing one region doesn't block reads nor writes
+	usEast.down = true
+
+	value, err := service.Get("vault-root")
+	require.NoError(t, err)
+	assert.Equal(t, "s.token", string(value))
+
+	require.NoError(t, service.Set("vault-unseal-0", []byte("key")))
+
+	// the value missing from a recovered region is repaired on read
+	usEast.down = false
+
+	value, err = service.Get("vault-unseal-0")
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(value))
+	assert.Equal(t, "key", string(usEast.data["vault-unseal-0"]))
+
+	// losing the majority blocks writes and reads
+	usEast.down, apSouth.down = true, true
+
+	assert.Error(t, service.Set("vault-unseal-1", []byte("key")))
+
+	_, err = service.Get("vault-root")
+	assert.Error(t, err)
+	assert.False(t, kv.IsNotFoundError(err))
+}
+
+func TestReplicatedDivergedValues(t *testing.T) {
+	euWest, usEast := newInMemoryStorage(), newInMemoryStorage()
+	euWest.data["vault-root"] = []byte("s.old")
+	usEast.data["vault-root"] = []byte("s.new")
+
+	service, err := New([]kv.Service{euWest, usEast}, 0, 2)
+	require.NoError(t, err)
+
+	_, err = service.Get("vault-root")
+	assert.Error(t, err)
+	assert.False(t, kv.IsNotFoundError(err))
+
+	_, err = New([]kv.Service{euWest, usEast}, 3, 0)
+	assert.Error(t, err)
+}
+
+func TestReplicatedTwoRegions(t *testing.T) {
+	euWest, usEast := newInMemoryStorage(), newInMemoryStorage()
+
+	service, err := New([]kv.Service{euWest, usEast}, 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Set("vault-unseal-0", []byte("key")))
+
+	// losing one of two regions doesn't block unsealing, only writes
+	usEast.down = true
+
+	value, err := service.Get("vault-unseal-0")
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(value))
+
+	assert.Error(t, service.Set("vault-unseal-1", []byte("key")))
+
+	// a single replica can't decide between diverged values
+	usEast.down = false
+	usEast.data["vault-unseal-0"] = []byte("other")
+
+	_, err = service.Get("vault-unseal-0")
+	assert.Error(t, err)
+	assert.False(t, kv.IsNotFoundError(err))
+}
@@ -109,6 +109,22 @@ func (s3 *s3Storage) Get(key string) ([]byte, error) {
 	return b, nil
 }
 
+// Delete removes the object of the key, S3 doesn't report deleting a missing object as an error
+func (s3 *s3Storage) Delete(key string) error {
+	n := objectNameWithPrefix(s3.prefix, key)
+
+	input := awss3.DeleteObjectInput{
+		Bucket: aws.String(s3.bucket),
+		Key:    aws.String(n),
+	}
+
+	if _, err := s3.client.DeleteObject(&input); err != nil {
+		return errors.Wrapf(err, "error deleting key '%s' from s3 bucket '%s'", n, s3.bucket)
+	}
+
+	return nil
+}
+
 func objectNameWithPrefix(prefix, key string) string {
 	return fmt.Sprintf("%s%s", prefix, key)
 }
@@ -0,0 +1,147 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaulttransit
+
+import (
+	"encoding/base64"
+	"path"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+// Rewrapper is implemented by the kv.Services which can rotate their encryption key
+// and re-encrypt the stored values with the latest version of it.
+type Rewrapper interface {
+	Rotate() error
+	Rewrap(key string) error
+}
+
+type vaultTransit struct {
+	store   kv.Service
+	client  *vaultapi.Client
+	path    string
+	keyName string
+}
+
+var _ kv.Service = &vaultTransit{}
+var _ Rewrapper = &vaultTransit{}
+
+// New creates a new kv.Service encrypted by the Transit secret engine of a (central) Vault
+func New(store kv.Service, client *vaultapi.Client, transitPath, keyName string) (kv.Service, error) {
+	if keyName == "" {
+		return nil, errors.New("transit key name is required") // nolint:goerr113
+	}
+
+	if transitPath == "" {
+		transitPath = "transit"
+	}
+
+	return &vaultTransit{
+		store:   store,
+		client:  client,
+		path:    transitPath,
+		keyName: keyName,
+	}, nil
+}
+
+func (t *vaultTransit) write(operation string, data map[string]interface{}) (map[string]interface{}, error) {
+	secret, err := t.client.Logical().Write(path.Join(t.path, operation, t.keyName), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		return nil, errors.Errorf("empty response from transit %s", operation)
+	}
+
+	return secret.Data, nil
+}
+
+func (t *vaultTransit) encrypt(s []byte) ([]byte, error) {
+	data, err := t.write("encrypt", map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(s),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error encrypting data with transit key '%s'", t.keyName)
+	}
+
+	return []byte(cast.ToString(data["ciphertext"])), nil
+}
+
+func (t *vaultTransit) decrypt(s []byte) ([]byte, error) {
+	data, err := t.write("decrypt", map[string]interface{}{
+		"ciphertext": string(s),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting data with transit key '%s'", t.keyName)
+	}
+
+	return base64.StdEncoding.DecodeString(cast.ToString(data["plaintext"]))
+}
+
+func (t *vaultTransit) Get(key string) ([]byte, error) {
+	cipherText, err := t.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.decrypt(cipherText)
+}
+
+func (t *vaultTransit) Set(key string, val []byte) error {
+	cipherText, err := t.encrypt(val)
+	if err != nil {
+		return err
+	}
+
+	return t.store.Set(key, cipherText)
+}
+
+// Rotate creates a new version of the transit key, new values are encrypted with it
+func (t *vaultTransit) Rotate() error {
+	_, err := t.client.Logical().Write(path.Join(t.path, "keys", t.keyName, "rotate"), nil)
+	return errors.Wrapf(err, "error rotating transit key '%s'", t.keyName)
+}
+
+// Rewrap re-encrypts a stored value with the latest version of the transit key,
+// without the plaintext ever leaving the central Vault
+func (t *vaultTransit) Rewrap(key string) error {
+	cipherText, err := t.store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	data, err := t.write("rewrap", map[string]interface{}{
+		"ciphertext": string(cipherText),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error rewrapping key '%s' with transit key '%s'", key, t.keyName)
+	}
+
+	return t.store.Set(key, []byte(cast.ToString(data["ciphertext"])))
+}
+
+func (t *vaultTransit) Delete(key string) error {
+	return kv.Delete(t.store, key)
+}
+
+func (t *vaultTransit) Lock(name string, ttl time.Duration) (func() error, error) {
+	return kv.Lock(t.store, name, ttl)
+}
@@ -0,0 +1,95 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaulttransit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/banzaicloud/bank-vaults/pkg/kv"
+)
+
+type inMemoryStorage map[string][]byte
+
+func (s inMemoryStorage) Get(key string) ([]byte, error) {
+	if data, ok := s[key]; ok {
+		return data, nil
+	}
+	return nil, kv.NewNotFoundError("key not found")
+}
+
+func (s inMemoryStorage) Set(key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+// fakeTransit imitates the transit engine, the ciphertext is the versioned plaintext
+func fakeTransit(t *testing.T) *httptest.Server {
+	version := "v1"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		data := map[string]string{}
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/unseal":
+			data["ciphertext"] = "vault:" + version + ":" + request["plaintext"]
+		case "/v1/transit/decrypt/unseal":
+			data["plaintext"] = request["ciphertext"][strings.LastIndex(request["ciphertext"], ":")+1:]
+		case "/v1/transit/rewrap/unseal":
+			data["ciphertext"] = "vault:" + version + request["ciphertext"][strings.LastIndex(request["ciphertext"], ":"):]
+		case "/v1/transit/keys/unseal/rotate":
+			version = "v2"
+		default:
+			t.Errorf("unexpected request: %s", r.URL.Path)
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func TestVaultTransit(t *testing.T) {
+	server := fakeTransit(t)
+	defer server.Close()
+
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: server.URL})
+	require.NoError(t, err)
+
+	storage := inMemoryStorage{}
+	service, err := New(storage, client, "", "unseal")
+	require.NoError(t, err)
+
+	require.NoError(t, service.Set("vault-unseal-0", []byte("key")))
+	assert.True(t, strings.HasPrefix(string(storage["vault-unseal-0"]), "vault:v1:"))
+
+	rewrapper := service.(Rewrapper)
+	require.NoError(t, rewrapper.Rotate())
+	require.NoError(t, rewrapper.Rewrap("vault-unseal-0"))
+	assert.True(t, strings.HasPrefix(string(storage["vault-unseal-0"]), "vault:v2:"))
+
+	value, err := service.Get("vault-unseal-0")
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(value))
+
+	assert.True(t, kv.IsNotFoundError(rewrapper.Rewrap("vault-unseal-1")))
+}
@@ -0,0 +1,224 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configurer applies the external configuration of bank-vaults (auth methods, policies,
+// secret engines, ...) to Vault, plans it and detects drift from it, just like the configure
+// command of bank-vaults, so that it can be embedded into custom operators and CI tools.
+//
+//	c, _ := configurer.New(store, client, vault.Config{})
+//	report, err := c.Apply(ctx, config)
+package configurer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// DefaultSealedRetryPeriod is how often Apply checks by default whether a sealed Vault has been unsealed
+const DefaultSealedRetryPeriod = 5 * time.Second
+
+type options struct {
+	sealedRetryPeriod time.Duration
+}
+
+// Option configures a Configurer
+type Option interface {
+	apply(o *options)
+}
+
+type optionFunc func(o *options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithSealedRetryPeriod sets how often Apply checks whether a sealed Vault has been unsealed
+func WithSealedRetryPeriod(period time.Duration) Option {
+	return optionFunc(func(o *options) { o.sealedRetryPeriod = period })
+}
+
+// Report is the result of an application or a plan of a configuration
+type Report struct {
+	// the progress of the applied sections in the order they were started
+	Sections []vault.ConfigureProgress `json:"sections,omitempty"`
+	// the changes of a plan, secret values are redacted
+	Changes []vault.ConfigChange `json:"changes,omitempty"`
+	// the errors of the sections of a plan which couldn't be evaluated completely
+	Warnings []string      `json:"warnings,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// recordProgress keeps the latest progress of every section
+func (r *Report) recordProgress(progress vault.ConfigureProgress) {
+	for i := range r.Sections {
+		if r.Sections[i].Section == progress.Section {
+			r.Sections[i] = progress
+			return
+		}
+	}
+	r.Sections = append(r.Sections, progress)
+}
+
+// Configurer applies configurations to a Vault instance with the root token from the key store
+type Configurer struct {
+	vault   vault.Vault
+	options options
+
+	// serializes the applications, so that the progress is recorded into the report of the running one
+	applyMu  sync.Mutex
+	reportMu sync.Mutex
+	report   *Report
+}
+
+// New creates a Configurer, the progress hook of the config is still called
+func New(store vault.KVService, cl *api.Client, config vault.Config, opts ...Option) (*Configurer, error) {
+	c := Configurer{options: options{sealedRetryPeriod: DefaultSealedRetryPeriod}}
+
+	for _, opt := range opts {
+		opt.apply(&c.options)
+	}
+
+	progressHook := config.ConfigureProgressHook
+	config.ConfigureProgressHook = func(progress vault.ConfigureProgress) {
+		c.reportMu.Lock()
+		if c.report != nil {
+			c.report.recordProgress(progress)
+		}
+		c.reportMu.Unlock()
+
+		if progressHook != nil {
+			progressHook(progress)
+		}
+	}
+
+	var err error
+	c.vault, err = vault.New(store, cl, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating vault helper")
+	}
+
+	return &c, nil
+}
+
+// Vault returns the Vault helper of the SDK used by the Configurer
+func (c *Configurer) Vault() vault.Vault {
+	return c.vault
+}
+
+// waitUnsealed waits until Vault is unsealed or ctx is done
+func (c *Configurer) waitUnsealed(ctx context.Context) error {
+	for {
+		logrus.Debug("checking if vault is sealed...")
+		sealed, err := c.vault.Sealed()
+		if err == nil && !sealed {
+			return nil
+		}
+
+		if err != nil {
+			logrus.Errorf("error checking if vault is sealed: %s, waiting %s before trying again...", err.Error(), c.options.sealedRetryPeriod)
+		} else {
+			logrus.Infof("vault is sealed, waiting %s before trying again...", c.options.sealedRetryPeriod)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "vault hasn't been unsealed")
+		case <-time.After(c.options.sealedRetryPeriod):
+		}
+	}
+}
+
+// Apply waits until Vault is unsealed, then applies the configuration. The report holds the progress of
+// the sections, also when the configuration has failed.
+func (c *Configurer) Apply(ctx context.Context, config *viper.Viper) (Report, error) {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+
+	var report Report
+	if err := c.waitUnsealed(ctx); err != nil {
+		return report, err
+	}
+
+	start := time.Now()
+
+	c.reportMu.Lock()
+	c.report = &report
+	c.reportMu.Unlock()
+
+	err := c.vault.Configure(config)
+
+	c.reportMu.Lock()
+	c.report = nil
+	c.reportMu.Unlock()
+
+	report.Duration = time.Since(start)
+
+	return report, err
+}
+
+// Plan returns the changes Apply would make in Vault, without changing anything
+func (c *Configurer) Plan(ctx context.Context, config *viper.Viper) (Report, error) {
+	var report Report
+	if err := c.waitUnsealed(ctx); err != nil {
+		return report, err
+	}
+
+	start := time.Now()
+
+	diff, err := c.vault.ConfigureDryRun(config)
+	if err != nil {
+		return report, err
+	}
+
+	report.Changes = diff.Changes
+	report.Warnings = diff.Warnings
+	report.Duration = time.Since(start)
+
+	return report, nil
+}
+
+// Drift returns the changes of a plan which are drift of the live configuration of Vault from the
+// configuration. The writes to paths which can't be read, and the fields which Vault doesn't return
+// (e.g. secrets) can't drift.
+func (c *Configurer) Drift(ctx context.Context, config *viper.Viper) ([]vault.ConfigChange, error) {
+	report, err := c.Plan(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []vault.ConfigChange
+	for _, change := range report.Changes {
+		switch change.Operation {
+		case vault.ConfigCreate, vault.ConfigDelete:
+			drift = append(drift, change)
+		case vault.ConfigUpdate:
+			for _, field := range change.Fields {
+				if field.Current != nil {
+					drift = append(drift, change)
+					break
+				}
+			}
+		}
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,102 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+type memoryKV map[string][]byte
+
+func (m memoryKV) Set(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryKV) Get(key string) ([]byte, error) {
+	return m[key], nil
+}
+
+func TestApply(t *testing.T) {
+	var policies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/seal-status":
+			_ = json.NewEncoder(w).Encode(api.SealStatusResponse{Initialized: true})
+		case "PUT /v1/sys/policies/acl/reader":
+			policies = append(policies, "reader")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_, _ = w.Write([]byte("{\"data\":{}}"))
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hookCalls int
+	c, err := New(memoryKV{"vault-root": []byte("root")}, cl, vault.Config{
+		ConfigureProgressHook: func(vault.ConfigureProgress) { hookCalls++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+policies:
+  - name: reader
+    rules: path "secret/*" { capabilities = ["read"] }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.Apply(context.Background(), externalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(policies) != 1 {
+		t.Errorf("the policy should be written once: %v", policies)
+	}
+	if hookCalls == 0 {
+		t.Error("the progress hook of the config should be called still")
+	}
+	if len(report.Sections) == 0 || report.Sections[0].Section != "policies" || !report.Sections[0].Done || report.Sections[0].Items != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	for _, section := range report.Sections {
+		if section.Error != "" {
+			t.Errorf("section %s failed: %s", section.Section, section.Error)
+		}
+	}
+}
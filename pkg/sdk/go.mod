@@ -5,6 +5,7 @@ go 1.12
 require (
 	emperror.dev/errors v0.7.0
 	github.com/fsnotify/fsnotify v1.4.7
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/hcl v1.0.0
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/hashicorp/vault/sdk v0.1.13
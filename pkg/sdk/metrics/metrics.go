@@ -0,0 +1,62 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics is the metrics facade of the bank-vaults components (SDK, webhook, operator),
+// so they don't depend on a metrics library. Implement Recorder to plug one in (OTLP for example),
+// a StatsD recorder without dependencies is provided, the components ship a Prometheus one.
+package metrics
+
+// Recorder creates the metrics of a component. The label values of the metrics are passed
+// in the order of the label names, the name has no prefix, it is added by the Recorder.
+type Recorder interface {
+	Counter(name, help string, labelNames ...string) Counter
+	Gauge(name, help string, labelNames ...string) Gauge
+	Histogram(name, help string, labelNames ...string) Histogram
+}
+
+// Counter is a metric which only increases
+type Counter interface {
+	Add(value float64, labelValues ...string)
+}
+
+// Gauge is a metric which can go up and down
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+	Add(value float64, labelValues ...string)
+}
+
+// Histogram is a metric of observed values, like durations
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// Noop is a Recorder which drops every metric, it is used when no Recorder is configured
+var Noop Recorder = noop{}
+
+type noop struct{}
+
+func (noop) Counter(string, string, ...string) Counter     { return noop{} }
+func (noop) Gauge(string, string, ...string) Gauge         { return noop{} }
+func (noop) Histogram(string, string, ...string) Histogram { return noop{} }
+func (noop) Add(float64, ...string)                        {}
+func (noop) Set(float64, ...string)                        {}
+func (noop) Observe(float64, ...string)                    {}
+
+// OrNoop returns the recorder, or Noop if it is nil
+func OrNoop(recorder Recorder) Recorder {
+	if recorder == nil {
+		return Noop
+	}
+	return recorder
+}
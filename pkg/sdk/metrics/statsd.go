@@ -0,0 +1,116 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// statsd sends the metrics to a StatsD server over UDP, the labels are sent as DogStatsD tags
+type statsd struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewStatsd returns a Recorder sending the metrics to the StatsD server at address (host:port),
+// the names of the metrics are prefixed with prefix and a dot.
+func NewStatsd(address, prefix string) (Recorder, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to statsd at %s", address)
+	}
+
+	if prefix != "" {
+		prefix += "."
+	}
+
+	return &statsd{conn: conn, prefix: prefix}, nil
+}
+
+type statsdMetric struct {
+	s          *statsd
+	name       string
+	labelNames []string
+	// the StatsD type of the metric: c, g or h
+	metricType string
+}
+
+func (s *statsd) metric(name, metricType string, labelNames []string) *statsdMetric {
+	return &statsdMetric{s: s, name: s.prefix + name, labelNames: labelNames, metricType: metricType}
+}
+
+func (s *statsd) Counter(name, _ string, labelNames ...string) Counter {
+	return s.metric(name, "c", labelNames)
+}
+
+func (s *statsd) Gauge(name, _ string, labelNames ...string) Gauge {
+	return s.metric(name, "g", labelNames)
+}
+
+func (s *statsd) Histogram(name, _ string, labelNames ...string) Histogram {
+	return s.metric(name, "h", labelNames)
+}
+
+// line formats a StatsD line like name:value|type|#label:value
+func (m *statsdMetric) line(value string, labelValues []string) string {
+	line := fmt.Sprintf("%s:%s|%s", m.name, value, m.metricType)
+
+	var tags []string
+	for i, labelName := range m.labelNames {
+		if i < len(labelValues) {
+			tags = append(tags, labelName+":"+labelValues[i])
+		}
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
+
+// send writes the line, UDP is fire and forget so the errors are dropped
+func (m *statsdMetric) send(value string, labelValues []string) {
+	_, _ = m.s.conn.Write([]byte(m.line(value, labelValues)))
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (m *statsdMetric) Add(value float64, labelValues ...string) {
+	// gauges are changed relatively with a sign
+	if m.metricType == "g" && value >= 0 {
+		m.send("+"+formatValue(value), labelValues)
+		return
+	}
+	m.send(formatValue(value), labelValues)
+}
+
+func (m *statsdMetric) Set(value float64, labelValues ...string) {
+	// a negative value would be a relative change, so the gauge is zeroed first
+	if value < 0 {
+		m.send("0", labelValues)
+	}
+	m.send(formatValue(value), labelValues)
+}
+
+func (m *statsdMetric) Observe(value float64, labelValues ...string) {
+	m.send(formatValue(value), labelValues)
+}
@@ -0,0 +1,63 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	recorder, err := NewStatsd(conn.LocalAddr().String(), "bank_vaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Counter("lookups_total", "", "kind").Add(1, "secret")
+	recorder.Gauge("in_flight", "").Add(-1)
+	recorder.Gauge("in_flight", "").Set(-2)
+	recorder.Histogram("duration_seconds", "", "section", "result").Observe(0.25, "auth", "success")
+
+	expected := []string{
+		"bank_vaults.lookups_total:1|c|#kind:secret",
+		"bank_vaults.in_flight:-1|g",
+		"bank_vaults.in_flight:0|g",
+		"bank_vaults.in_flight:-2|g",
+		"bank_vaults.duration_seconds:0.25|h|#section:auth,result:success",
+	}
+
+	var lines []string
+	buffer := make([]byte, 1024)
+	for range expected {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(buffer[:n]))
+	}
+
+	if !reflect.DeepEqual(expected, lines) {
+		t.Errorf("expected lines %v, got %v", expected, lines)
+	}
+}
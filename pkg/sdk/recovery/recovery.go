@@ -0,0 +1,67 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recovery turns the panics of the webhook handlers, the operator reconcilers and the unseal loop
+// into errors with the stack trace of the panic, so a single bad object doesn't crash the whole process.
+package recovery
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// Panic is a recovered panic
+type Panic struct {
+	Value interface{}
+	// the stack trace of the goroutine at the panic
+	Stack []byte
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Call calls fn, its panic is returned as a *Panic error
+func Call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Panic{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
+
+// Handler recovers the panics of the requests served by next, they are passed to onPanic and
+// answered with 500 Internal Server Error. http.ErrAbortHandler is not recovered, it aborts the request.
+func Handler(next http.Handler, onPanic func(r *http.Request, p *Panic)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			onPanic(r, &Panic{Value: recovered, Stack: debug.Stack()})
+
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"emperror.dev/errors"
+)
+
+func TestCall(t *testing.T) {
+	err := Call(func() error {
+		var m map[string]string
+		m["panic"] = "assignment to entry in nil map"
+		return nil
+	})
+
+	var p *Panic
+	if !errors.As(err, &p) {
+		t.Fatalf("expected a panic error, got %v", err)
+	}
+	if !strings.Contains(string(p.Stack), "TestCall") {
+		t.Errorf("expected the stack trace of the panic, got %s", p.Stack)
+	}
+
+	expected := errors.New("failed") // nolint:goerr113
+	if err := Call(func() error { return expected }); err != expected {
+		t.Errorf("expected the error of the function, got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var recovered *Panic
+	handler := Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("bad object")
+	}), func(_ *http.Request, p *Panic) { recovered = p })
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pods", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+	if recovered == nil || recovered.Value != "bad object" {
+		t.Errorf("expected the panic to be passed to the handler, got %v", recovered)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unsealer initializes, unseals and watches a Vault instance with the keys of a key store,
+// just like the unseal command of bank-vaults, so that it can be embedded into other programs.
+//
+//	v, _ := vault.New(store, client, vault.Config{SecretShares: 5, SecretThreshold: 3, StoreRootToken: true})
+//	u := unsealer.New(v, unsealer.WithPeriod(10*time.Second))
+//	if err := u.Initialize(ctx); err != nil { ... }
+//	_ = u.Watch(ctx)
+package unsealer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/recovery"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+// DefaultPeriod is how often Vault is checked by default
+const DefaultPeriod = 5 * time.Second
+
+type options struct {
+	period              time.Duration
+	raft                bool
+	raftLeaderAddresses []string
+	raftSecondary       bool
+	autoUnseal          bool
+	unsealHook          func()
+	unsealAttemptHook   func(error)
+	checkHook           func()
+	panicHook           func(*recovery.Panic)
+}
+
+// Option configures an Unsealer
+type Option interface {
+	apply(o *options)
+}
+
+type optionFunc func(o *options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithPeriod sets how often Vault is checked by Watch, and how often the Raft join is retried
+func WithPeriod(period time.Duration) Option {
+	return optionFunc(func(o *options) { o.period = period })
+}
+
+// WithRaft makes Initialize join the Raft cluster through the first of the leader addresses
+// accepting the join, unless this is the first node of the cluster, which is initialized
+func WithRaft(leaderAddresses ...string) Option {
+	return optionFunc(func(o *options) {
+		o.raft = true
+		o.raftLeaderAddresses = leaderAddresses
+	})
+}
+
+// WithRaftSecondary makes Initialize always join the Raft cluster, never initialize it
+func WithRaftSecondary() Option {
+	return optionFunc(func(o *options) { o.raftSecondary = true })
+}
+
+// WithAutoUnseal makes Watch only run the check hook, since Vault unseals itself
+func WithAutoUnseal() Option {
+	return optionFunc(func(o *options) { o.autoUnseal = true })
+}
+
+// WithUnsealHook sets a function called after every successful unseal
+func WithUnsealHook(hook func()) Option {
+	return optionFunc(func(o *options) { o.unsealHook = hook })
+}
+
+// WithUnsealAttemptHook sets a function called after every unseal attempt with its error, e.g. to count them
+func WithUnsealAttemptHook(hook func(error)) Option {
+	return optionFunc(func(o *options) { o.unsealAttemptHook = hook })
+}
+
+// WithCheckHook sets a function called after every periodic check of Watch, e.g. to manage the Raft peers
+func WithCheckHook(hook func()) Option {
+	return optionFunc(func(o *options) { o.checkHook = hook })
+}
+
+// WithPanicHook sets a function called with the panics recovered in Watch, e.g. to count them
+func WithPanicHook(hook func(*recovery.Panic)) Option {
+	return optionFunc(func(o *options) { o.panicHook = hook })
+}
+
+// Unsealer initializes and unseals a Vault instance
+type Unsealer struct {
+	vault   vault.Vault
+	options options
+}
+
+// New creates an Unsealer for the Vault helper of the SDK, which holds the key store and the init configuration
+func New(v vault.Vault, opts ...Option) *Unsealer {
+	u := Unsealer{vault: v, options: options{period: DefaultPeriod}}
+
+	for _, opt := range opts {
+		opt.apply(&u.options)
+	}
+
+	return &u
+}
+
+// Initialize initializes Vault if it is not initialized yet. In Raft mode the first node of the cluster
+// is initialized, the other ones join it, the join is retried until ctx is done.
+func (u *Unsealer) Initialize(ctx context.Context) error {
+	if !u.options.raft {
+		logrus.Info("initializing vault...")
+		return errors.Wrap(u.vault.Init(), "error initializing vault")
+	}
+
+	initialized, err := u.vault.RaftInitialized()
+	if err != nil {
+		sealed, sErr := u.vault.Sealed()
+		if sErr != nil || sealed {
+			return errors.Wrap(err, "error checking if vault is initialized")
+		}
+		logrus.Warnf("error checking if vault is initialized, but vault is unsealed so continuing: %s", err.Error())
+	}
+
+	// If this is the first instance we have to init it, this happens once in the clusters lifetime
+	if !initialized && !u.options.raftSecondary {
+		logrus.Info("initializing vault...")
+		return errors.Wrap(u.vault.Init(), "error initializing vault")
+	}
+
+	// like retry_join, the join is retried until one of the leaders accepts it
+	for {
+		logrus.Info("joining raft cluster...")
+		err := u.raftJoin()
+		if err == nil {
+			return nil
+		}
+		logrus.Errorf("error joining leader vault, waiting %s before trying again: %s", u.options.period, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "error joining leader vault")
+		case <-time.After(u.options.period):
+		}
+	}
+}
+
+// raftJoin joins the Raft cluster through the first leader address which accepts the join
+func (u *Unsealer) raftJoin() error {
+	var errs []error
+	for _, address := range u.options.raftLeaderAddresses {
+		err := u.vault.RaftJoin(strings.TrimSpace(address))
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, errors.Wrapf(err, "error joining through %s", address))
+	}
+	if len(errs) == 0 {
+		// joining without a leader address relies on the retry_join stanzas of the Vault configuration
+		return u.vault.RaftJoin("")
+	}
+	return errors.Combine(errs...)
+}
+
+// Unseal unseals Vault if it is sealed, and tells whether it has been unsealed now
+func (u *Unsealer) Unseal(ctx context.Context) (bool, error) {
+	logrus.Debug("checking if vault is sealed...")
+	sealed, err := u.vault.Sealed()
+	if err != nil {
+		return false, errors.Wrap(err, "error checking if vault is sealed")
+	}
+
+	if !sealed {
+		logrus.Debug("vault is not sealed")
+		return false, nil
+	}
+
+	logrus.Info("vault is sealed, unsealing")
+
+	err = u.vault.Unseal()
+	if u.options.unsealAttemptHook != nil {
+		u.options.unsealAttemptHook(err)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "error unsealing vault")
+	}
+
+	logrus.Info("successfully unsealed vault")
+
+	if u.options.unsealHook != nil {
+		u.options.unsealHook()
+	}
+
+	return true, nil
+}
+
+// Watch unseals Vault whenever it is sealed, checking it periodically until ctx is done.
+// The errors are logged, since they are retried, and so are the panics of the checks.
+func (u *Unsealer) Watch(ctx context.Context) error {
+	for {
+		err := recovery.Call(func() error {
+			u.check(ctx)
+			return nil
+		})
+		if p, ok := err.(*recovery.Panic); ok {
+			logrus.WithField("stack", string(p.Stack)).Errorf("recovered from panic while watching vault: %v", p.Value)
+			if u.options.panicHook != nil {
+				u.options.panicHook(p)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(u.options.period):
+		}
+	}
+}
+
+// check is one periodic check of Watch
+func (u *Unsealer) check(ctx context.Context) {
+	if !u.options.autoUnseal {
+		if _, err := u.Unseal(ctx); err != nil {
+			logrus.Error(err.Error())
+		}
+	}
+
+	if u.options.checkHook != nil {
+		u.options.checkHook()
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unsealer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/recovery"
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/vault"
+)
+
+type fakeVault struct {
+	vault.Vault
+
+	initialized bool
+	sealed      bool
+	initCalls   int
+	joins       []string
+}
+
+func (f *fakeVault) RaftInitialized() (bool, error) { return f.initialized, nil }
+func (f *fakeVault) Sealed() (bool, error)          { return f.sealed, nil }
+func (f *fakeVault) Init() error                    { f.initCalls++; f.initialized = true; return nil }
+func (f *fakeVault) Unseal() error                  { f.sealed = false; return nil }
+
+func (f *fakeVault) RaftJoin(address string) error {
+	f.joins = append(f.joins, address)
+	if address != "https://vault-1:8200" {
+		return errors.New("not the leader")
+	}
+	return nil
+}
+
+func TestInitializeRaft(t *testing.T) {
+	v := &fakeVault{}
+	if err := New(v, WithRaft("https://vault-0:8200")).Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v.initCalls != 1 || len(v.joins) != 0 {
+		t.Errorf("the first node should be initialized: %+v", v)
+	}
+
+	v = &fakeVault{}
+	u := New(v, WithRaft("https://vault-0:8200", "https://vault-1:8200"), WithRaftSecondary(), WithPeriod(time.Millisecond))
+	if err := u.Initialize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v.initCalls != 0 || len(v.joins) != 2 {
+		t.Errorf("the secondary node should join through the second address: %+v", v)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	v := &fakeVault{initialized: true, sealed: true}
+
+	var unseals, attempts, checks int
+	u := New(v,
+		WithPeriod(time.Millisecond),
+		WithUnsealHook(func() { unseals++ }),
+		WithUnsealAttemptHook(func(err error) {
+			if err == nil {
+				attempts++
+			}
+		}),
+		WithCheckHook(func() {
+			checks++
+			if checks == 2 {
+				v.sealed = true
+			}
+		}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := u.Watch(ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if unseals != 2 || attempts != 2 {
+		t.Errorf("expected 2 unseals and attempts, got %d unseals and %d attempts", unseals, attempts)
+	}
+}
+
+func TestWatchRecoversPanics(t *testing.T) {
+	v := &fakeVault{initialized: true}
+
+	var checks, panics int
+	u := New(v,
+		WithPeriod(time.Millisecond),
+		WithAutoUnseal(),
+		WithCheckHook(func() {
+			checks++
+			if checks == 1 {
+				panic("bad check")
+			}
+		}),
+		WithPanicHook(func(*recovery.Panic) { panics++ }),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := u.Watch(ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if panics != 1 || checks < 2 {
+		t.Errorf("expected the watch to go on after 1 panic, got %d panics and %d checks", panics, checks)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
+)
+
+// ClientAppRole logs in with the AppRole auth method instead of Kubernetes, the role name is set with
+// ClientRole and the mount path with ClientAuthPath (defaults to "approle" in this case).
+// A WrappedSecretID is only unwrapped if the wrapping token was created by the secret-id endpoint
+// of the role, so a substituted token can't make the client log in as someone else.
+type ClientAppRole struct {
+	RoleID          string
+	SecretID        string
+	WrappedSecretID string
+	// WrappingMaxTTL is the longest accepted TTL of the wrapping token of the secret_id
+	WrappingMaxTTL time.Duration
+}
+
+func (co ClientAppRole) apply(o *clientOptions) {
+	o.appRole = &co
+}
+
+// appRoleSecretID returns the secret_id of the AppRole login, unwrapping it if needed
+func (client *Client) appRoleSecretID(o *clientOptions) (string, error) {
+	if o.appRole.WrappedSecretID == "" {
+		return o.appRole.SecretID, nil
+	}
+
+	secret, err := UnwrapValidated(client.client, o.appRole.WrappedSecretID, WrappingValidation{
+		CreationPath: fmt.Sprintf("auth/%s/role/%s/secret-id", o.authPath, o.role),
+		MaxTTL:       o.appRole.WrappingMaxTTL,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error unwrapping AppRole secret_id")
+	}
+
+	secretID := cast.ToString(secret.Data["secret_id"])
+	if secretID == "" {
+		return "", errors.New("wrapped response doesn't contain an AppRole secret_id")
+	}
+
+	return secretID, nil
+}
+
+// appRoleLogin logs in with the AppRole auth method and starts renewing the token.
+// The secret_id may be single use, so there is no re-login once the token expires.
+func (client *Client) appRoleLogin(o *clientOptions) error {
+	secretID, err := client.appRoleSecretID(o)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"role_id":   o.appRole.RoleID,
+		"secret_id": secretID,
+	}
+
+	secret, err := client.logical.Write(fmt.Sprintf("auth/%s/login", o.authPath), data)
+	if err != nil {
+		return errors.Wrap(err, "failed to login with AppRole")
+	}
+	if secret == nil || secret.Auth == nil {
+		return errors.New("received empty answer from Vault for AppRole login")
+	}
+
+	logger.Println("received new Vault token with AppRole")
+
+	client.client.SetToken(secret.Auth.ClientToken)
+	client.emitTokenEvent(TokenEvent{Type: TokenLoggedIn, Secret: secret})
+
+	if !secret.Auth.Renewable {
+		return nil
+	}
+
+	tokenRenewer, err := client.client.NewRenewer(&vaultapi.RenewerInput{Secret: secret})
+	if err != nil {
+		return errors.Wrap(err, "failed to renew Vault token")
+	}
+
+	client.mu.Lock()
+	client.tokenRenewer = tokenRenewer
+	client.mu.Unlock()
+
+	go tokenRenewer.Renew()
+	go client.runRenewChecker(tokenRenewer)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+const defaultAuditRetryInterval = 5 * time.Second
+
+// auditProbeInput is hashed with the audit device to validate it, it is never stored
+const auditProbeInput = "bank-vaults-audit-probe"
+
+// enableAuditDevice enables the audit device at the path. Socket devices are retried as many times
+// as the retries of the device, since Vault connects to the socket while enabling it.
+// If validate is set, the device is probed after enabling and it is disabled again if the probe fails,
+// since Vault rejects all requests when none of its audit devices can log them.
+func (v *vault) enableAuditDevice(path string, auditDevice map[string]interface{}) error {
+	var options api.EnableAuditOptions
+	if err := mapstructure.Decode(auditDevice, &options); err != nil {
+		return errors.Wrap(err, "error parsing audit options")
+	}
+
+	retries, err := cast.ToIntE(auditDevice["retries"])
+	if err != nil {
+		return errors.Wrapf(err, "error parsing retries of audit device %s", path)
+	}
+	retryInterval := defaultAuditRetryInterval
+	if interval, ok := auditDevice["retryInterval"]; ok {
+		retryInterval, err = cast.ToDurationE(interval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing retryInterval of audit device %s", path)
+		}
+	}
+	validate, err := getOrDefaultBool(auditDevice, "validate")
+	if err != nil {
+		return errors.Wrapf(err, "error parsing validate of audit device %s", path)
+	}
+
+	logrus.Infof("enabling audit device with options: %#v", options)
+	for attempt := 0; ; attempt++ {
+		err = v.cl.Sys().EnableAuditWithOptions(path, &options)
+		if err == nil || attempt >= retries {
+			break
+		}
+		logrus.Warnf("error enabling audit device %s, retrying in %s: %s", path, retryInterval, err.Error())
+		time.Sleep(retryInterval)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error enabling audit device %s in vault", path)
+	}
+
+	if validate {
+		if err := v.validateAuditDevice(path); err != nil {
+			if disableErr := v.cl.Sys().DisableAudit(path); disableErr != nil {
+				logrus.Errorf("error disabling audit device %s after its validation failed: %s", path, disableErr.Error())
+			}
+			return errors.Wrapf(err, "audit device %s failed validation, disabled it", path)
+		}
+		logrus.Infof("audit device %s validated", path)
+	}
+
+	return nil
+}
+
+// validateAuditDevice probes the audit device at the path: the hash of the device is computed
+// and a request is sent, which is logged by the audit devices, Vault fails the request if none of
+// the devices could log it. A device failing beside working devices is only visible in the Vault logs.
+func (v *vault) validateAuditDevice(path string) error {
+	if _, err := v.cl.Sys().AuditHash(path, auditProbeInput); err != nil {
+		return errors.Wrap(err, "error hashing with audit device")
+	}
+
+	if _, err := v.cl.Auth().Token().LookupSelf(); err != nil {
+		return errors.Wrap(err, "error sending audited request")
+	}
+
+	return nil
+}
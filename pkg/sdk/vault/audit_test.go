@@ -0,0 +1,84 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestAuditServer simulates a Vault where the socket audit device becomes reachable after two attempts
+// and the file audit device can't be written
+func newTestAuditServer(t *testing.T, requests map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + r.URL.Path
+		requests[request]++
+
+		switch request {
+		case "PUT /v1/sys/audit/socket":
+			if requests[request] <= 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case "PUT /v1/sys/audit/file", "DELETE /v1/sys/audit/file":
+			w.WriteHeader(http.StatusNoContent)
+		case "PUT /v1/sys/audit-hash/socket":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"hash": "hmac-sha256:probe"}})
+		case "PUT /v1/sys/audit-hash/file":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "GET /v1/auth/token/lookup-self":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{}})
+		default:
+			t.Errorf("unexpected request: %s", request)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestEnableAuditDevice(t *testing.T) {
+	requests := map[string]int{}
+	server := newTestAuditServer(t, requests)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	config.MaxRetries = 0
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	socket := map[string]interface{}{"type": "socket", "retries": 2, "retryInterval": "1ms", "validate": true}
+	if err := v.enableAuditDevice("socket", socket); err != nil {
+		t.Fatal(err)
+	}
+	if requests["PUT /v1/sys/audit/socket"] != 3 {
+		t.Errorf("expected 3 attempts to enable the socket audit device, got %d", requests["PUT /v1/sys/audit/socket"])
+	}
+
+	file := map[string]interface{}{"type": "file", "validate": true, "options": map[string]interface{}{"file_path": "/vault/logs/audit.log"}}
+	if err := v.enableAuditDevice("file", file); err == nil {
+		t.Fatal("the audit device failing validation must be rejected")
+	}
+	if requests["DELETE /v1/sys/audit/file"] != 1 {
+		t.Error("the audit device failing validation must be disabled")
+	}
+}
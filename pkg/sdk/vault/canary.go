@@ -0,0 +1,58 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// configureCanary validates the configuration before it is applied: with ConfigureDryRunValidation every
+// section of its dry run has to be evaluated without errors, with ConfigureCanaryNamespace the policies,
+// auth methods, secret engines and namespaces of the configuration are applied to that Vault Enterprise
+// namespace first. The secret engine configs with rotated credentials are skipped in the canary namespace.
+func (v *vault) configureCanary(config *viper.Viper) error {
+	if v.config.ConfigureDryRunValidation {
+		diff, err := v.ConfigureDryRun(config)
+		if err != nil {
+			return errors.Wrap(err, "error in the dry run of the configuration")
+		}
+		if len(diff.Warnings) > 0 {
+			return errors.Errorf("the dry run of the configuration failed, it is not applied: %s", strings.Join(diff.Warnings, "; "))
+		}
+	}
+
+	name := strings.Trim(v.config.ConfigureCanaryNamespace, "/")
+	if name == "" {
+		return nil
+	}
+
+	logrus.Infof("applying the configuration to the canary namespace %s first", name)
+
+	cv := *v
+	cv.canary = true
+
+	err := cv.configureSection("canary", func(v *vault) error {
+		return v.configureNamespace(name, config.AllSettings())
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error applying the configuration to the canary namespace %s, it is not applied", name)
+	}
+
+	return nil
+}
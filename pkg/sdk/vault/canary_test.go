@@ -0,0 +1,92 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureCanary(t *testing.T) {
+	var requests []string
+	var failPolicy bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.Header.Get(consts.NamespaceHeaderName)
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/namespaces/canary":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		case "PUT /v1/sys/namespaces/canary", "PUT /v1/sys/policies/acl/reader":
+			requests = append(requests, namespace+" "+r.Method+" "+r.URL.Path)
+			if failPolicy && strings.HasPrefix(r.URL.Path, "/v1/sys/policies") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["failed to parse policy"]}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s in namespace %q", r.Method, r.URL.Path, namespace)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("root")
+
+	v := &vault{cl: cl, config: &Config{ConfigureCanaryNamespace: "canary"}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+policies:
+  - name: reader
+    rules: path "secret/*" { capabilities = ["read"] }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configureCanary(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		" PUT /v1/sys/namespaces/canary",
+		"canary PUT /v1/sys/policies/acl/reader",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+
+	failPolicy = true
+	if err := v.configureCanary(externalConfig); err == nil || !strings.Contains(err.Error(), "canary namespace canary") {
+		t.Errorf("the failed canary configuration should be an error: %v", err)
+	}
+}
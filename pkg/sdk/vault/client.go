@@ -18,9 +18,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -48,6 +50,12 @@ func init() {
 	}
 }
 
+// SetLogger sets the logger of the clients, e.g. to share the format and the level of the program's logger,
+// by default it is a logrus logger writing JSON if VAULT_JSON_LOG is true
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
 // NewData is a helper function for Vault KV Version two secret data creation
 func NewData(cas int, data map[string]interface{}) map[string]interface{} {
 	return map[string]interface{}{
@@ -58,11 +66,18 @@ func NewData(cas int, data map[string]interface{}) map[string]interface{} {
 
 type clientOptions struct {
 	url       string
+	urls      []string
+	srv       string
 	role      string
 	authPath  string
 	tokenPath string
 	token     string
 	timeout   time.Duration
+
+	consistency    ConsistencyMode
+	requestLogging bool
+	tokenHooks     []TokenHook
+	appRole        *ClientAppRole
 }
 
 // ClientOption configures a Vault client using the functional options paradigm popularized by Rob Pike and Dave Cheney.
@@ -80,6 +95,22 @@ func (co ClientURL) apply(o *clientOptions) {
 	o.url = string(co)
 }
 
+// ClientURLs is a list of vault urls to fail over between, the active node is preferred.
+// It only takes effect when the client is created from a config (not from a raw client).
+type ClientURLs []string
+
+func (co ClientURLs) apply(o *clientOptions) {
+	o.urls = co
+}
+
+// ClientSRV is a DNS SRV record name which resolves to the vault urls to fail over between,
+// the scheme of the configured address is used for all of them.
+type ClientSRV string
+
+func (co ClientSRV) apply(o *clientOptions) {
+	o.srv = string(co)
+}
+
 // ClientRole is the vault role which the client would like to receive
 type ClientRole string
 
@@ -124,6 +155,8 @@ type Client struct {
 	client       *vaultapi.Client
 	logical      *vaultapi.Logical
 	tokenRenewer *vaultapi.Renewer
+	failover     *failoverTransport
+	tokenHooks   []TokenHook
 	closed       bool
 	watch        *fsnotify.Watcher
 	mu           sync.Mutex
@@ -156,11 +189,45 @@ func NewClientFromConfig(config *vaultapi.Config, opts ...ClientOption) (*Client
 		return nil, err
 	}
 
+	o := &clientOptions{}
+
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+
+	transport := config.HttpClient.Transport
+
+	failover, err := newFailoverForConfig(config, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if failover != nil {
+		opts = append(opts, ClientURL(failover.Address()))
+	}
+
+	setConsistency(config, o.consistency)
+	setRequestLogging(config, o.requestLogging || os.Getenv("VAULT_REQUEST_LOGGING") == "true")
+
+	// The CA certificate reload has to reach the original transport
+	reloadConfig := config
+	if config.HttpClient.Transport != transport {
+		reloadConfig = &vaultapi.Config{HttpClient: &http.Client{Transport: transport}}
+	}
+
 	client, err := NewClientFromRawClient(rawClient, opts...)
 	if err != nil {
+		if failover != nil {
+			failover.close()
+		}
 		return nil, err
 	}
 
+	if failover != nil {
+		client.failover = failover
+		go failover.run(defaultFailoverCheckInterval)
+	}
+
 	caCertPath := os.Getenv(vaultapi.EnvVaultCACert)
 	caCertReload := os.Getenv("VAULT_CACERT_RELOAD") != "false"
 
@@ -189,7 +256,7 @@ func NewClientFromConfig(config *vaultapi.Config, opts ...ClientOption) (*Client
 					// we only care about the CA cert file or the Secret mount directory (if in Kubernetes)
 					if filepath.Clean(event.Name) == caCertFile || filepath.Base(event.Name) == "..data" {
 						if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-							err := config.ReadEnvironment()
+							err := reloadConfig.ReadEnvironment()
 							if err != nil {
 								logger.Println("failed to reload Vault config:", err)
 							} else {
@@ -209,6 +276,44 @@ func NewClientFromConfig(config *vaultapi.Config, opts ...ClientOption) (*Client
 	return client, nil
 }
 
+// newFailoverForConfig installs a failover transport into the config's HTTP client
+// if multiple addresses or an SRV record is configured in the options.
+func newFailoverForConfig(config *vaultapi.Config, o *clientOptions) (*failoverTransport, error) {
+	addresses := o.urls
+	if o.srv != "" {
+		scheme := ""
+		if u, err := url.Parse(config.Address); err == nil {
+			scheme = u.Scheme
+		}
+
+		srvAddresses, err := resolveSRVAddresses(o.srv, scheme)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, srvAddresses...)
+	}
+
+	if len(addresses) == 0 {
+		return nil, nil
+	}
+
+	failover, err := newFailoverTransport(config.HttpClient.Transport, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	failover.checkHealth()
+
+	config.HttpClient = &http.Client{
+		Transport:     failover,
+		CheckRedirect: config.HttpClient.CheckRedirect,
+		Jar:           config.HttpClient.Jar,
+		Timeout:       config.HttpClient.Timeout,
+	}
+
+	return failover, nil
+}
+
 // NewClientFromRawClient creates a new Vault client from custom raw client.
 func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*Client, error) {
 	logical := rawClient.Logical()
@@ -229,6 +334,13 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 		opt.apply(o)
 	}
 
+	client.tokenHooks = o.tokenHooks
+
+	// Set the first failover URL if no URL is defined
+	if o.url == "" && len(o.urls) > 0 {
+		o.url = o.urls[0]
+	}
+
 	// Set URL if defined
 	if o.url != "" {
 		err := rawClient.SetAddress(o.url)
@@ -245,6 +357,9 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 	// Default auth path
 	if o.authPath == "" {
 		o.authPath = "kubernetes"
+		if o.appRole != nil {
+			o.authPath = "approle"
+		}
 	}
 
 	// Default token path
@@ -269,6 +384,10 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 	// Add token if set
 	if o.token != "" {
 		rawClient.SetToken(o.token)
+	} else if o.appRole != nil {
+		if err := client.appRoleLogin(o); err != nil {
+			return nil, err
+		}
 	} else if rawClient.Token() == "" {
 		token, err := ioutil.ReadFile(o.tokenPath)
 		if err == nil {
@@ -331,14 +450,18 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 					rawClient.SetToken(secret.Auth.ClientToken)
 
 					if !initialTokenSent {
+						client.emitTokenEvent(TokenEvent{Type: TokenLoggedIn, Secret: secret})
 						initialTokenArrived <- secret.LeaseID
 						initialTokenSent = true
+					} else {
+						client.emitTokenEvent(TokenEvent{Type: TokenReauthenticated, Secret: secret})
 					}
 
 					// Start the renewing process
 					tokenRenewer, err = rawClient.NewRenewer(&vaultapi.RenewerInput{Secret: secret})
 					if err != nil {
 						logger.Println("failed to renew Vault token", err.Error())
+						client.emitTokenEvent(TokenEvent{Type: TokenRenewalFailed, Err: err})
 						continue
 					}
 
@@ -348,7 +471,7 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 
 					go tokenRenewer.Renew()
 
-					runRenewChecker(tokenRenewer)
+					client.runRenewChecker(tokenRenewer)
 				}
 				logger.Println("Vault token renewal closed")
 			}()
@@ -367,21 +490,29 @@ func NewClientFromRawClient(rawClient *vaultapi.Client, opts ...ClientOption) (*
 	return client, nil
 }
 
-func runRenewChecker(tokenRenewer *vaultapi.Renewer) {
+func (client *Client) runRenewChecker(tokenRenewer *vaultapi.Renewer) {
 	for {
 		select {
 		case err := <-tokenRenewer.DoneCh():
 			if err != nil {
 				logger.Println("error in Vault token renewal:", err.Error())
+				client.emitTokenEvent(TokenEvent{Type: TokenRenewalFailed, Err: err})
 			}
 			return
 		case o := <-tokenRenewer.RenewCh():
 			ttl, _ := o.Secret.TokenTTL()
 			logger.Println("renewed Vault token ttl =", ttl)
+			client.emitTokenEvent(TokenEvent{Type: TokenRenewed, Secret: o.Secret})
 		}
 	}
 }
 
+// SealStatus returns the seal status of Vault, shared with the other clients
+// of this process through DefaultSealStatusCache if it is enabled.
+func (client *Client) SealStatus() (*vaultapi.SealStatusResponse, error) {
+	return DefaultSealStatusCache.SealStatus(client.client)
+}
+
 // Vault returns the underlying hashicorp Vault client.
 // Deprecated: use RawClient instead.
 func (client *Client) Vault() *vaultapi.Client {
@@ -393,6 +524,21 @@ func (client *Client) RawClient() *vaultapi.Client {
 	return client.client
 }
 
+// RevokeToken revokes the Vault token of this client and closes it
+func (client *Client) RevokeToken() error {
+	err := client.client.Auth().Token().RevokeSelf("")
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke Vault token")
+	}
+
+	client.Close()
+	client.client.ClearToken()
+
+	client.emitTokenEvent(TokenEvent{Type: TokenRevoked})
+
+	return nil
+}
+
 // Close stops the token renewing process of this client
 func (client *Client) Close() {
 	client.mu.Lock()
@@ -407,6 +553,10 @@ func (client *Client) Close() {
 	if client.watch != nil {
 		_ = client.watch.Close()
 	}
+
+	if client.failover != nil {
+		client.failover.close()
+	}
 }
 
 // NewRawClient creates a new raw Vault client.
@@ -433,3 +583,20 @@ func NewInsecureRawClient() (*api.Client, error) {
 
 	return vaultapi.NewClient(config)
 }
+
+// ConfigAddress returns the address of the client in the format of the Address of the client configuration
+// (and VAULT_ADDR), so a new client can be created for the same Vault. The clients connecting to a unix domain
+// socket (unix:///path/to/vault.sock) report an http address with the escaped socket path as the host.
+func ConfigAddress(address string) string {
+	escapedSocket := strings.TrimPrefix(address, "http://")
+	if escapedSocket == address || !strings.HasPrefix(escapedSocket, "%2F") {
+		return address
+	}
+
+	socket, err := url.PathUnescape(escapedSocket)
+	if err != nil {
+		return address
+	}
+
+	return "unix://" + socket
+}
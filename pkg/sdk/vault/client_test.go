@@ -0,0 +1,96 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigAddress(t *testing.T) {
+	tests := map[string]string{
+		"https://127.0.0.1:8200":          "https://127.0.0.1:8200",
+		"http://vault.vault:8200":         "http://vault.vault:8200",
+		"http://%2Fvault%2Fsocket%2Fsock": "unix:///vault/socket/sock",
+	}
+
+	for address, expected := range tests {
+		if actual := ConfigAddress(address); actual != expected {
+			t.Errorf("%s: expected %q, got %q", address, expected, actual)
+		}
+	}
+}
+
+func TestUnixSocketClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "vault.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var stepDownToken string
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path {
+			case "GET /v1/sys/seal-status":
+				_, _ = w.Write([]byte(`{"initialized": true, "sealed": false}`))
+			case "PUT /v1/sys/step-down":
+				stepDownToken = r.Header.Get("X-Vault-Token")
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}()
+
+	os.Setenv("VAULT_ADDR", "unix://"+socket)
+	defer os.Unsetenv("VAULT_ADDR")
+
+	cl, err := NewRawClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(memoryKV{"vault-root": []byte("root")}, cl, Config{SecretShares: 1, SecretThreshold: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := v.Sealed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed {
+		t.Error("vault should be unsealed")
+	}
+
+	if err := v.StepDownActive(cl.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if stepDownToken != "root" {
+		t.Errorf("the step-down should reach the socket with the root token, got %q", stepDownToken)
+	}
+}
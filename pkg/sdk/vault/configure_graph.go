@@ -0,0 +1,197 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"emperror.dev/errors"
+	"github.com/spf13/viper"
+)
+
+// configureStep is a configuration section with the sections which have to be applied before it
+type configureStep struct {
+	section   string
+	dependsOn []string
+	// wraps the error of the section
+	message   string
+	configure func(v *vault, config *viper.Viper) error
+}
+
+// configureSteps are the configuration sections in a dependency respecting order,
+// which is the order of the serial application too
+var configureSteps = []configureStep{
+	{
+		section:   "policies",
+		message:   "error configuring policies for vault",
+		configure: (*vault).configurePolicies,
+	},
+	{
+		section:   "passwordPolicies",
+		message:   "error configuring password policies for vault",
+		configure: (*vault).configurePasswordPolicies,
+	},
+	{
+		section:   "plugins",
+		message:   "error configuring plugins for vault",
+		configure: (*vault).configurePlugins,
+	},
+	{
+		// the roles of the auth methods reference policies
+		section:   "auth",
+		dependsOn: []string{"policies"},
+		message:   "error configuring auth methods for vault",
+		configure: (*vault).configureAuthMethods,
+	},
+	{
+		// secret engines may be plugins, their roles reference policies and their configs password policies
+		section:   "secrets",
+		dependsOn: []string{"plugins", "policies", "passwordPolicies"},
+		message:   "error configuring secret engines for vault",
+		configure: (*vault).configureSecretEngines,
+	},
+	{
+		section:   "audit",
+		message:   "error configuring audit devices for vault",
+		configure: (*vault).configureAuditDevices,
+	},
+	{
+		// startup secrets are written into the mounted secret engines
+		section:   "startupSecrets",
+		dependsOn: []string{"secrets"},
+		message:   "error writing startup secrets to vault",
+		configure: (*vault).configureStartupSecrets,
+	},
+	{
+		// groups reference policies, and their aliases reference the mount accessors of auth methods
+		section:   "groups",
+		dependsOn: []string{"policies", "auth"},
+		message:   "error writing groups configurations for vault",
+		configure: (*vault).configureIdentityGroups,
+	},
+	{
+		// entities and groups reference policies, and their aliases reference the mount accessors of auth methods
+		section:   "identity",
+		dependsOn: []string{"policies", "auth"},
+		message:   "error configuring identity entities and groups for vault",
+		configure: (*vault).configureIdentity,
+	},
+	{
+		// the assignments of the OIDC provider reference identity entities and groups
+		section:   "oidc",
+		dependsOn: []string{"identity", "groups"},
+		message:   "error configuring the oidc provider of vault",
+		configure: (*vault).configureOIDCProvider,
+	},
+	{
+		// enforcements reference auth methods and identity groups
+		section:   "mfa",
+		dependsOn: []string{"auth", "groups", "identity"},
+		message:   "error configuring login mfa for vault",
+		configure: (*vault).configureLoginMFA,
+	},
+	{
+		section:   "license",
+		message:   "error configuring license for vault",
+		configure: (*vault).configureLicense,
+	},
+	{
+		// replication is a Vault Enterprise feature which needs the license
+		section:   "replication",
+		dependsOn: []string{"license"},
+		message:   "error configuring replication for vault",
+		configure: (*vault).configureReplication,
+	},
+	{
+		// the secret engines of the namespaces may be plugins of the plugin catalog,
+		// and namespaces are a Vault Enterprise feature which needs the license
+		section:   "namespaces",
+		dependsOn: []string{"license", "plugins"},
+		message:   "error configuring namespaces for vault",
+		configure: (*vault).configureNamespaces,
+	},
+	{
+		// quotas may be set on namespaces, auth methods and secret engines
+		section:   "quotas",
+		dependsOn: []string{"auth", "secrets", "namespaces"},
+		message:   "error configuring quotas for vault",
+		configure: (*vault).configureQuotas,
+	},
+}
+
+type configureStepResult struct {
+	section string
+	err     error
+}
+
+// applyConfigureSteps applies the steps, running at most concurrency independent steps at the same time.
+// After a step has failed no more steps are started, the errors of the running ones are combined.
+func (v *vault) applyConfigureSteps(config *viper.Viper, steps []configureStep, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	unmet := map[string]int{}
+	dependents := map[string][]string{}
+	for _, step := range steps {
+		unmet[step.section] = len(step.dependsOn)
+		for _, dependency := range step.dependsOn {
+			dependents[dependency] = append(dependents[dependency], step.section)
+		}
+	}
+
+	started := map[string]bool{}
+	results := make(chan configureStepResult)
+	running := 0
+	var errs []error
+
+	for {
+		// start the ready steps in their declared order
+		for i := 0; i < len(steps) && running < concurrency && len(errs) == 0; i++ {
+			step := steps[i]
+			if started[step.section] || unmet[step.section] > 0 {
+				continue
+			}
+
+			started[step.section] = true
+			running++
+
+			go func() {
+				err := v.configureSection(step.section, func(v *vault) error { return step.configure(v, config) })
+				results <- configureStepResult{section: step.section, err: errors.Wrap(err, step.message)}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+
+		for _, dependent := range dependents[result.section] {
+			unmet[dependent]--
+		}
+	}
+
+	if len(errs) == 0 && len(started) < len(steps) {
+		return errors.New("configuration sections have circular or missing dependencies") // nolint:goerr113
+	}
+
+	return errors.Combine(errs...)
+}
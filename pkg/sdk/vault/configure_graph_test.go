@@ -0,0 +1,97 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/spf13/viper"
+)
+
+func TestApplyConfigureSteps(t *testing.T) {
+	var mu sync.Mutex
+	var applied []string
+	var running, maxRunning int
+
+	step := func(section string, err error, dependsOn ...string) configureStep {
+		return configureStep{
+			section:   section,
+			dependsOn: dependsOn,
+			message:   "error configuring " + section,
+			configure: func(v *vault, config *viper.Viper) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				time.Sleep(20 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				applied = append(applied, section)
+				mu.Unlock()
+
+				return err
+			},
+		}
+	}
+
+	v := &vault{config: &Config{}}
+
+	steps := []configureStep{
+		step("a", nil),
+		step("b", nil),
+		step("c", nil, "a"),
+		step("d", nil, "a", "b"),
+	}
+
+	if err := v.applyConfigureSteps(viper.New(), steps, 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, ",") != "a,b,c,d" || maxRunning != 1 {
+		t.Errorf("serial application: unexpected order %v with %d concurrent steps", applied, maxRunning)
+	}
+
+	applied, maxRunning = nil, 0
+	if err := v.applyConfigureSteps(viper.New(), steps, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 4 || maxRunning != 2 {
+		t.Errorf("parallel application: unexpected steps %v with %d concurrent steps", applied, maxRunning)
+	}
+	for i, section := range applied {
+		if (section == "c" || section == "d") && i < 2 {
+			t.Errorf("%s was applied before its dependencies: %v", section, applied)
+		}
+	}
+
+	applied, maxRunning = nil, 0
+	steps[0] = step("a", errors.New("failure"))
+	err := v.applyConfigureSteps(viper.New(), steps, 2)
+	if err == nil || !strings.Contains(err.Error(), "error configuring a: failure") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, section := range applied {
+		if section == "c" || section == "d" {
+			t.Errorf("%s was applied after its dependency failed", section)
+		}
+	}
+}
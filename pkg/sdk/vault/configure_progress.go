@@ -0,0 +1,161 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
+)
+
+const defaultConfigureHeartbeat = 30 * time.Second
+
+// ConfigureProgress is the progress of a configuration section (auth, policies, secrets, ...).
+type ConfigureProgress struct {
+	Section string    `json:"section"`
+	Started time.Time `json:"started"`
+	Items   int       `json:"items"`
+	Done    bool      `json:"done"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ConfigFileStatus is the result of the latest apply of a configuration file
+type ConfigFileStatus struct {
+	// Hash of the applied content of the file, see ConfigHash
+	Hash    string    `json:"hash"`
+	Applied time.Time `json:"applied"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// ConfigHash returns the hash of the content of a configuration file, which is reported in ConfigFileStatus
+func ConfigHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// sectionProgress tracks the currently applied configuration section
+type sectionProgress struct {
+	mu       sync.Mutex
+	progress ConfigureProgress
+	deadline time.Time
+	hook     func(ConfigureProgress)
+}
+
+func (p *sectionProgress) snapshot() ConfigureProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.progress
+}
+
+func (p *sectionProgress) report() {
+	if p.hook != nil {
+		p.hook(p.snapshot())
+	}
+}
+
+// progressStep records that an item of the current section has been applied,
+// and fails if the section ran over its timeout.
+func (v *vault) progressStep() error {
+	p := v.progress
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.progress.Items++
+	section, items, deadline := p.progress.Section, p.progress.Items, p.deadline
+	p.mu.Unlock()
+
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		return errors.Errorf("timeout while configuring %s after %d items", section, items)
+	}
+
+	return nil
+}
+
+// configureSection applies a configuration section, logging a heartbeat while it runs.
+// The section is applied with a copy of the helper tracking its own progress, so that
+// independent sections can be applied concurrently.
+func (v *vault) configureSection(section string, configure func(v *vault) error) error {
+	p := &sectionProgress{
+		progress: ConfigureProgress{Section: section, Started: time.Now()},
+		hook:     v.config.ConfigureProgressHook,
+	}
+	if timeout := v.config.ConfigureSectionTimeouts[section]; timeout > 0 {
+		p.deadline = p.progress.Started.Add(timeout)
+	}
+
+	sv := *v
+	sv.progress = p
+
+	p.report()
+
+	heartbeat := v.config.ConfigureHeartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultConfigureHeartbeat
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				progress := p.snapshot()
+				logrus.WithFields(logrus.Fields{
+					"section": progress.Section,
+					"items":   progress.Items,
+					"elapsed": time.Since(progress.Started).Round(time.Second).String(),
+				}).Info("still configuring vault")
+				p.report()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	err := configure(&sv)
+	close(stop)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.OrNoop(v.config.Metrics).Histogram(
+		"configure_section_duration_seconds",
+		"Duration of applying the configuration sections, by section and result.",
+		"section", "result",
+	).Observe(time.Since(p.progress.Started).Seconds(), section, result)
+
+	p.mu.Lock()
+	p.progress.Done = true
+	if err != nil {
+		p.progress.Error = err.Error()
+	}
+	p.mu.Unlock()
+
+	p.report()
+
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	headerVaultIndex        = "X-Vault-Index"
+	headerVaultInconsistent = "X-Vault-Inconsistent"
+	headerVaultForward      = "X-Vault-Forward"
+
+	staleReadRetries = 5
+	staleReadBackoff = 100 * time.Millisecond
+)
+
+// ConsistencyMode controls how the client deals with eventually consistent
+// Vault Enterprise performance standby and replica nodes.
+type ConsistencyMode string
+
+const (
+	// ConsistencyDefault doesn't send any consistency headers
+	ConsistencyDefault ConsistencyMode = ""
+	// ConsistencyReadYourWrites replays the X-Vault-Index of the last write on reads,
+	// and asks nodes which are behind that state to always forward the read to the active node
+	ConsistencyReadYourWrites ConsistencyMode = "read-your-writes"
+	// ConsistencyRetryOnStale replays the X-Vault-Index of the last write on reads,
+	// and retries the reads with a backoff while they hit nodes which are behind that state
+	ConsistencyRetryOnStale ConsistencyMode = "retry-on-stale"
+	// ConsistencyForwardActive forwards every request to the active node
+	ConsistencyForwardActive ConsistencyMode = "forward-active-node"
+)
+
+// ParseConsistencyMode parses a consistency mode name.
+func ParseConsistencyMode(mode string) (ConsistencyMode, error) {
+	switch m := ConsistencyMode(mode); m {
+	case ConsistencyDefault, ConsistencyReadYourWrites, ConsistencyRetryOnStale, ConsistencyForwardActive:
+		return m, nil
+	default:
+		return ConsistencyDefault, errors.Errorf("unknown Vault consistency mode: %s", mode)
+	}
+}
+
+type consistencyOption ConsistencyMode
+
+func (co consistencyOption) apply(o *clientOptions) {
+	o.consistency = ConsistencyMode(co)
+}
+
+// WithConsistency sets the consistency mode of the client.
+// It only takes effect when the client is created from a config (not from a raw client).
+func WithConsistency(mode ConsistencyMode) ClientOption {
+	return consistencyOption(mode)
+}
+
+// consistencyTransport is an http.RoundTripper which adds the Vault Enterprise
+// consistency headers to the requests, and tracks the X-Vault-Index of the last write.
+type consistencyTransport struct {
+	base http.RoundTripper
+	mode ConsistencyMode
+
+	mu    sync.RWMutex
+	index string
+}
+
+func isReadRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == "LIST"
+}
+
+func (t *consistencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.mode == ConsistencyForwardActive {
+		r := req.Clone(req.Context())
+		r.Header.Set(headerVaultForward, "active-node")
+		return t.base.RoundTrip(r)
+	}
+
+	if !isReadRequest(req) {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if index := resp.Header.Get(headerVaultIndex); index != "" {
+			t.mu.Lock()
+			t.index = index
+			t.mu.Unlock()
+		}
+
+		return resp, nil
+	}
+
+	t.mu.RLock()
+	index := t.index
+	t.mu.RUnlock()
+
+	if index == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set(headerVaultIndex, index)
+
+	if t.mode == ConsistencyReadYourWrites {
+		r.Header.Set(headerVaultInconsistent, "forward-active-node")
+		return t.base.RoundTrip(r)
+	}
+
+	r.Header.Set(headerVaultInconsistent, "fail")
+
+	backoff := staleReadBackoff
+	for i := 0; ; i++ {
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusPreconditionFailed || i == staleReadRetries {
+			return resp, err
+		}
+
+		_ = resp.Body.Close()
+
+		logger.Debugf("Vault node is behind the last write, retrying read in %s", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// setConsistency installs a consistency transport into the config's HTTP client.
+func setConsistency(config *vaultapi.Config, mode ConsistencyMode) {
+	if mode == ConsistencyDefault {
+		return
+	}
+
+	config.HttpClient = &http.Client{
+		Transport:     &consistencyTransport{base: config.HttpClient.Transport, mode: mode},
+		CheckRedirect: config.HttpClient.CheckRedirect,
+		Jar:           config.HttpClient.Jar,
+		Timeout:       config.HttpClient.Timeout,
+	}
+}
+
+// NewRawClientWithConsistency creates a new raw Vault client with the given consistency mode.
+func NewRawClientWithConsistency(mode ConsistencyMode) (*vaultapi.Client, error) {
+	config := vaultapi.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	config.HttpClient.Transport.(*http.Transport).TLSHandshakeTimeout = 5 * time.Second
+
+	setConsistency(config, mode)
+
+	return vaultapi.NewClient(config)
+}
@@ -0,0 +1,64 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConsistencyTransportRetryOnStale(t *testing.T) {
+	staleReads := 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			w.Header().Set(headerVaultIndex, "index-1")
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if r.Header.Get(headerVaultIndex) != "index-1" || r.Header.Get(headerVaultInconsistent) != "fail" {
+				t.Errorf("expected the index of the last write to be replayed, got headers %v", r.Header)
+			}
+			if staleReads > 0 {
+				staleReads--
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &consistencyTransport{base: http.DefaultTransport, mode: ConsistencyRetryOnStale}}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v1/secret/data/test", strings.NewReader("{}"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = client.Get(server.URL + "/v1/secret/data/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d after retrying stale reads, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
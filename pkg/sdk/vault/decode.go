@@ -0,0 +1,123 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// DecodeSecret decodes the data of a secret into the target struct (or map), the fields are matched
+// by their mapstructure tags, or their names case insensitively. The data of KV version 2 secrets is
+// unwrapped, so the same struct can be used for both versions. Besides the weak conversions of
+// mapstructure (strings to numbers and bools, and vice versa):
+//   - time.Duration fields accept durations ("1h30m") and seconds (5400, "5400") which Vault returns TTLs in
+//   - []byte fields accept base64 encoded strings
+//   - time.Time fields accept RFC 3339 timestamps
+func DecodeSecret(secret *vaultapi.Secret, target interface{}) error {
+	if secret == nil {
+		return errors.New("secret is empty") // nolint:goerr113
+	}
+
+	return DecodeSecretData(secretData(secret), target)
+}
+
+// DecodeSecretData decodes the data map of a secret into the target, with the conversions of DecodeSecret
+func DecodeSecretData(data map[string]interface{}, target interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			durationDecodeHook,
+			base64DecodeHook,
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+		),
+		WeaklyTypedInput: true,
+		Result:           target,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating secret decoder")
+	}
+
+	return errors.Wrap(decoder.Decode(data), "error decoding secret data")
+}
+
+// secretData returns the data of the secret, unwrapped if it has been read from a KV version 2 secret engine
+func secretData(secret *vaultapi.Secret) map[string]interface{} {
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+			return data
+		}
+	}
+	return secret.Data
+}
+
+// durationDecodeHook converts durations and seconds to time.Duration
+func durationDecodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != durationType {
+		return data, nil
+	}
+
+	switch value := data.(type) {
+	case string:
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Duration(seconds) * time.Second, nil
+		}
+		return time.ParseDuration(value)
+	case json.Number:
+		seconds, err := value.Int64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error converting %s seconds to duration", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	case time.Duration:
+		return value, nil
+	}
+
+	if from.Kind() >= reflect.Int && from.Kind() <= reflect.Float64 {
+		seconds, err := cast.ToInt64E(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error converting %v seconds to duration", data)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return data, nil
+}
+
+// base64DecodeHook decodes base64 encoded strings to []byte
+func base64DecodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != bytesType || from.Kind() != reflect.String {
+		return data, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data.(string))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding base64 value")
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,82 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestDecodeSecret(t *testing.T) {
+	secret, err := api.ParseSecret(strings.NewReader(`{
+		"data": {
+			"data": {
+				"username": "app",
+				"port": "5432",
+				"enabled": "true",
+				"ttl": 3600,
+				"max_ttl": "2h",
+				"certificate": "Y2VydGlmaWNhdGU="
+			},
+			"metadata": {"created_time": "2020-03-01T10:00:00Z", "version": 2}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var credentials struct {
+		Username    string
+		Port        int
+		Enabled     bool
+		TTL         time.Duration
+		MaxTTL      time.Duration `mapstructure:"max_ttl"`
+		Certificate []byte
+	}
+
+	if err := DecodeSecret(secret, &credentials); err != nil {
+		t.Fatal(err)
+	}
+
+	if credentials.Username != "app" || credentials.Port != 5432 || !credentials.Enabled {
+		t.Errorf("unexpected credentials: %+v", credentials)
+	}
+	if credentials.TTL != time.Hour || credentials.MaxTTL != 2*time.Hour {
+		t.Errorf("unexpected durations: %s, %s", credentials.TTL, credentials.MaxTTL)
+	}
+	if string(credentials.Certificate) != "certificate" {
+		t.Errorf("unexpected certificate: %q", credentials.Certificate)
+	}
+
+	var metadata struct {
+		CreatedTime time.Time `mapstructure:"created_time"`
+		Version     int
+	}
+
+	if err := DecodeSecretData(secret.Data["metadata"].(map[string]interface{}), &metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata.Version != 2 || !metadata.CreatedTime.Equal(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+
+	if err := DecodeSecret(nil, &metadata); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+}
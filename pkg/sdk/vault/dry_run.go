@@ -0,0 +1,328 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// ConfigOperation is the kind of a change of the Vault configuration
+type ConfigOperation string
+
+const (
+	ConfigCreate ConfigOperation = "create"
+	ConfigUpdate ConfigOperation = "update"
+	ConfigDelete ConfigOperation = "delete"
+	// ConfigWrite is a write to a path whose current state can't be read
+	ConfigWrite ConfigOperation = "write"
+)
+
+const redacted = "<redacted>"
+
+// dryRunID is returned as the ID of the objects which would be created
+const dryRunID = "<dry-run>"
+
+// sensitiveField matches the names of the fields whose values are never shown
+var sensitiveField = regexp.MustCompile(`(?i)(password|passphrase|secret|token|credential|private|jwt|pem|certificate|access_key|api_key|^key$|^data$)`)
+
+// FieldChange is a changed field of a configuration object, secret values are redacted
+type FieldChange struct {
+	Current interface{} `json:"current,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+}
+
+// ConfigChange is a change Configure would make in Vault
+type ConfigChange struct {
+	Section   string                 `json:"section"`
+	Operation ConfigOperation        `json:"operation"`
+	Path      string                 `json:"path"`
+	Fields    map[string]FieldChange `json:"fields,omitempty"`
+}
+
+// ConfigureDiff is the result of a dry run of Configure
+type ConfigureDiff struct {
+	Changes []ConfigChange `json:"changes"`
+	// errors of the sections which couldn't be evaluated completely, e.g. because
+	// they read objects back which would be created by the configuration
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// dryRunTransport is an http.RoundTripper which sends only the reads to Vault,
+// the writes are recorded as changes compared with the current state of their paths
+type dryRunTransport struct {
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	changes []ConfigChange
+}
+
+// isDryRunRead tells whether a request doesn't change Vault
+func isDryRunRead(req *http.Request) bool {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == "LIST" {
+		return true
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	return strings.HasPrefix(path, "identity/lookup/") || strings.HasPrefix(path, "sys/wrapping/lookup")
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isDryRunRead(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	var desired map[string]interface{}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading request body")
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &desired); err != nil {
+				return nil, errors.Wrap(err, "error decoding request body")
+			}
+		}
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	if namespace := strings.Trim(req.Header.Get(consts.NamespaceHeaderName), "/"); namespace != "" {
+		path = namespace + "/" + path
+	}
+
+	exists, current, err := t.read(req)
+	if err != nil {
+		return nil, err
+	}
+
+	change := ConfigChange{Path: path}
+	switch {
+	case req.Method == http.MethodDelete:
+		if exists {
+			change.Operation = ConfigDelete
+		}
+	case current == nil && exists:
+		change.Operation = ConfigWrite
+		change.Fields = diffFields(nil, desired)
+	case current == nil:
+		change.Operation = ConfigCreate
+		change.Fields = diffFields(nil, desired)
+	default:
+		change.Operation = ConfigUpdate
+		change.Fields = diffFields(current, desired)
+		// nothing changes
+		if len(change.Fields) == 0 {
+			change.Operation = ""
+		}
+	}
+
+	if change.Operation != "" {
+		t.mu.Lock()
+		t.changes = append(t.changes, change)
+		t.mu.Unlock()
+	}
+
+	// the IDs of the objects which would be created, for the code reading them from the response
+	response, _ := json.Marshal(map[string]interface{}{"data": map[string]interface{}{"id": dryRunID, "method_id": dryRunID}})
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(response)),
+		Request:    req,
+	}, nil
+}
+
+// read reads the current state of the path of a write request, exists is true if the path
+// exists but it can't be read, in which case current is nil
+func (t *dryRunTransport) read(req *http.Request) (exists bool, current map[string]interface{}, err error) {
+	return readCurrentState(t.base, req)
+}
+
+// readCurrentState reads the current state of the path of a write request with the transport
+func readCurrentState(base http.RoundTripper, req *http.Request) (exists bool, current map[string]interface{}, err error) {
+	read, err := http.NewRequest(http.MethodGet, req.URL.String(), nil)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "error creating read request")
+	}
+	read = read.WithContext(req.Context())
+	read.Header = req.Header.Clone()
+	read.Header.Del("Content-Length")
+
+	resp, err := base.RoundTrip(read)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil, nil
+	default:
+		return true, nil, nil
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return true, nil, nil
+	}
+
+	if data, ok := response["data"].(map[string]interface{}); ok {
+		return true, data, nil
+	}
+
+	return true, response, nil
+}
+
+// diffFields returns the fields of desired which differ from current, with the secret values redacted
+func diffFields(current, desired map[string]interface{}) map[string]FieldChange {
+	fields := map[string]FieldChange{}
+
+	for key, value := range desired {
+		currentValue, ok := current[key]
+		if ok && equalFieldValues(currentValue, value) {
+			continue
+		}
+
+		change := FieldChange{Current: currentValue, Desired: value}
+		if sensitiveField.MatchString(key) {
+			change.Desired = redacted
+			if ok {
+				change.Current = redacted
+			}
+		}
+		fields[key] = change
+	}
+
+	return fields
+}
+
+// equalFieldValues compares the desired value of a field with the one read from Vault,
+// which may be in a normalized form: comma separated lists are read as lists, durations as seconds
+func equalFieldValues(current, desired interface{}) bool {
+	if normalizeFieldValue(current) == normalizeFieldValue(desired) {
+		return true
+	}
+
+	if s, ok := desired.(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			if seconds, err := cast.ToFloat64E(current); err == nil {
+				return d.Seconds() == seconds
+			}
+		}
+		if list, ok := current.([]interface{}); ok {
+			return normalizeFieldValue(list) == normalizeFieldValue(strings.Split(s, ","))
+		}
+	}
+
+	return false
+}
+
+func normalizeFieldValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		value = strings.TrimSpace(s)
+	}
+	if list, ok := value.([]string); ok {
+		values := make([]interface{}, len(list))
+		for i, v := range list {
+			values[i] = strings.TrimSpace(v)
+		}
+		value = values
+	}
+	if n, err := cast.ToFloat64E(value); err == nil {
+		if _, isString := value.(string); !isString {
+			value = n
+		}
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// ConfigureDryRun returns what Configure would change in Vault, without changing anything.
+// The sections are applied serially with a client which sends only the reads to Vault,
+// the sections which fail are reported as warnings and the next ones are evaluated still.
+func (v *vault) ConfigureDryRun(config *viper.Viper) (*ConfigureDiff, error) {
+	rootToken, err := v.keyStore.Get(v.rootTokenKey())
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get key '%s'", v.rootTokenKey())
+	}
+
+	clientConfig := vaultapi.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, clientConfig.Error
+	}
+	clientConfig.Address = ConfigAddress(v.cl.Address())
+	clientConfig.HttpClient.Transport.(*http.Transport).TLSHandshakeTimeout = 5 * time.Second
+
+	transport := &dryRunTransport{base: clientConfig.HttpClient.Transport}
+	clientConfig.HttpClient.Transport = transport
+
+	cl, err := vaultapi.NewClient(clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetHeaders(v.cl.Headers())
+	cl.SetToken(string(rootToken))
+
+	// the dry run isn't reported as configuration progress or metrics
+	dryRunConfig := *v.config
+	dryRunConfig.ConfigureProgressHook = nil
+	dryRunConfig.LicenseHook = nil
+	dryRunConfig.Metrics = nil
+
+	dv := *v
+	dv.cl = cl
+	dv.config = &dryRunConfig
+	// rotations are never tracked by a dry run
+	dv.rotateCache = newRotationCache()
+
+	if err := v.resolveConfigValueReferences(config); err != nil {
+		return nil, err
+	}
+
+	diff := ConfigureDiff{Changes: []ConfigChange{}}
+
+	for _, step := range configureSteps {
+		step := step
+		err := dv.configureSection(step.section, func(v *vault) error { return step.configure(v, config) })
+		if err != nil {
+			diff.Warnings = append(diff.Warnings, errors.Wrap(err, step.message).Error())
+		}
+
+		transport.mu.Lock()
+		for _, change := range transport.changes {
+			change.Section = step.section
+			diff.Changes = append(diff.Changes, change)
+		}
+		transport.changes = nil
+		transport.mu.Unlock()
+	}
+
+	return &diff, nil
+}
@@ -0,0 +1,119 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("dry run sent a write: %s %s", r.Method, r.URL.Path)
+		}
+
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/sys/policies/acl/unchanged":
+			response = map[string]interface{}{"data": map[string]interface{}{"name": "unchanged", "policy": "path \"secret/*\" {\n  capabilities = [\"read\"]\n}"}}
+		case "/v1/sys/policies/acl/changed":
+			response = map[string]interface{}{"data": map[string]interface{}{"name": "changed", "policy": "path \"secret/*\" {\n  capabilities = [\"list\"]\n}"}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("{\"errors\":[]}"))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(memoryKV{"vault-root": []byte("root")}, cl, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+policies:
+  - name: unchanged
+    rules: path "secret/*" { capabilities = ["read"] }
+  - name: changed
+    rules: path "secret/*" { capabilities = ["read"] }
+  - name: created
+    rules: path "secret/*" { capabilities = ["read"] }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := v.ConfigureDryRun(externalConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operations := map[string]ConfigOperation{}
+	for _, change := range diff.Changes {
+		if change.Section != "policies" {
+			t.Errorf("unexpected change in section %s: %+v", change.Section, change)
+		}
+		operations[change.Path] = change.Operation
+	}
+
+	expected := map[string]ConfigOperation{
+		"sys/policies/acl/changed": ConfigUpdate,
+		"sys/policies/acl/created": ConfigCreate,
+	}
+	if len(operations) != len(expected) {
+		t.Errorf("unexpected changes: %+v", diff.Changes)
+	}
+	for path, operation := range expected {
+		if operations[path] != operation {
+			t.Errorf("%s: expected %s, got %q", path, operation, operations[path])
+		}
+	}
+}
+
+func TestDiffFieldsRedactsSecrets(t *testing.T) {
+	fields := diffFields(
+		map[string]interface{}{"ttl": 3600, "policies": []interface{}{"a", "b"}, "client_secret": "old"},
+		map[string]interface{}{"ttl": "1h", "policies": "a,b", "client_secret": "new", "max_ttl": "2h"},
+	)
+
+	if len(fields) != 2 {
+		t.Errorf("unexpected changed fields: %+v", fields)
+	}
+	if fields["client_secret"].Current != redacted || fields["client_secret"].Desired != redacted {
+		t.Errorf("secret is not redacted: %+v", fields["client_secret"])
+	}
+	if fields["max_ttl"].Desired != "2h" {
+		t.Errorf("unexpected max_ttl change: %+v", fields["max_ttl"])
+	}
+}
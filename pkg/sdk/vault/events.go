@@ -0,0 +1,266 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrEventsNotSupported is returned by Subscribe if Vault doesn't support event notifications (before Vault 1.16)
+const ErrEventsNotSupported = errors.Sentinel("vault doesn't support event notifications")
+
+const (
+	defaultEventsMinBackoff = time.Second
+	defaultEventsMaxBackoff = time.Minute
+)
+
+// Event is an event notification of Vault, for example a write of a kv secret
+type Event struct {
+	ID   string
+	Type string
+	Time time.Time
+	// the mount path of the plugin sending the event, e.g. secret/
+	MountPath string
+	// e.g. path, data_path, current_version and operation of the kv events
+	Metadata map[string]interface{}
+}
+
+// Path returns the data path of the event, or its path if there is no data path
+func (e Event) Path() string {
+	for _, key := range []string{"data_path", "path"} {
+		if path, ok := e.Metadata[key].(string); ok && path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// cloudEvent is the format of the event notifications on the WebSocket
+type cloudEvent struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Data struct {
+		Event struct {
+			ID       string                 `json:"id"`
+			Metadata map[string]interface{} `json:"metadata"`
+		} `json:"event"`
+		EventType  string `json:"event_type"`
+		PluginInfo struct {
+			MountPath string `json:"mount_path"`
+		} `json:"plugin_info"`
+	} `json:"data"`
+}
+
+// EventsClient subscribes to the event notifications of Vault on WebSockets, reconnecting with backoff
+type EventsClient struct {
+	client     *vaultapi.Client
+	tlsConfig  *tls.Config
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     logrus.FieldLogger
+}
+
+// EventsOption configures an EventsClient
+type EventsOption func(*EventsClient)
+
+// EventsTLSConfig sets the TLS configuration of the WebSocket connections, the one of the
+// VAULT_CACERT, VAULT_SKIP_VERIFY, etc. environment variables is used by default
+func EventsTLSConfig(tlsConfig *tls.Config) EventsOption {
+	return func(c *EventsClient) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// EventsBackoff sets the minimum and maximum delay of the reconnections, they default to 1 second and 1 minute
+func EventsBackoff(min, max time.Duration) EventsOption {
+	return func(c *EventsClient) {
+		c.minBackoff, c.maxBackoff = min, max
+	}
+}
+
+// EventsLogger sets the logger of the reconnections
+func EventsLogger(logger logrus.FieldLogger) EventsOption {
+	return func(c *EventsClient) {
+		c.logger = logger
+	}
+}
+
+// NewEventsClient returns an events client using the address, token and namespace of the Vault client
+func NewEventsClient(client *vaultapi.Client, opts ...EventsOption) *EventsClient {
+	c := &EventsClient{
+		client:     client,
+		minBackoff: defaultEventsMinBackoff,
+		maxBackoff: defaultEventsMaxBackoff,
+		logger:     logrus.StandardLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.tlsConfig == nil {
+		if config := vaultapi.DefaultConfig(); config.Error == nil {
+			if transport, ok := config.HttpClient.Transport.(*http.Transport); ok {
+				c.tlsConfig = transport.TLSClientConfig
+			}
+		}
+	}
+
+	return c
+}
+
+// connect opens the WebSocket of the event type, which may contain * wildcards (e.g. kv*)
+func (c *EventsClient) connect(ctx context.Context, eventType string) (*websocket.Conn, error) {
+	u, err := url.Parse(c.client.Address())
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing vault address")
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/sys/events/subscribe/" + eventType
+	u.RawQuery = url.Values{"json": {"true"}}.Encode()
+
+	header := http.Header{}
+	for key, values := range c.client.Headers() {
+		header[key] = values
+	}
+	header.Set(consts.AuthHeaderName, c.client.Token())
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+		TLSClientConfig:  c.tlsConfig,
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed) {
+			return nil, errors.WithStack(ErrEventsNotSupported)
+		}
+		if resp != nil {
+			return nil, errors.Wrapf(err, "error subscribing to %s events (status %d)", eventType, resp.StatusCode)
+		}
+		return nil, errors.Wrapf(err, "error subscribing to %s events", eventType)
+	}
+
+	return conn, nil
+}
+
+// Subscribe subscribes to the events of the event type until the context is done, then the channel is closed.
+// The first connection is made before it returns, so unsupported events are reported with ErrEventsNotSupported,
+// the connection is reopened with exponential backoff after it breaks, the events in between are lost.
+func (c *EventsClient) Subscribe(ctx context.Context, eventType string) (<-chan Event, error) {
+	conn, err := c.connect(ctx, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		backoff := c.minBackoff
+		for {
+			// closing the connection interrupts the read when the context is done
+			stop := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					_ = conn.Close()
+				case <-stop:
+				}
+			}()
+
+			err := c.read(ctx, conn, events, func() { backoff = c.minBackoff })
+			close(stop)
+			_ = conn.Close()
+
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+
+				c.logger.Warnf("%s events subscription broken, reconnecting in %s: %s", eventType, backoff, err)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > c.maxBackoff {
+					backoff = c.maxBackoff
+				}
+
+				conn, err = c.connect(ctx, eventType)
+				if err == nil {
+					break
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// read sends the events of the connection to the channel until the connection breaks
+func (c *EventsClient) read(ctx context.Context, conn *websocket.Conn, events chan<- Event, received func()) error {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		received()
+
+		var e cloudEvent
+		if err := json.Unmarshal(message, &e); err != nil {
+			c.logger.Warnf("error decoding event: %s", err)
+			continue
+		}
+
+		event := Event{
+			ID:        e.ID,
+			Type:      e.Data.EventType,
+			Time:      e.Time,
+			MountPath: e.Data.PluginInfo.MountPath,
+			Metadata:  e.Data.Event.Metadata,
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
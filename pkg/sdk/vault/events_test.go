@@ -0,0 +1,103 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/vault/api"
+)
+
+const testKVEvent = `{
+  "id": "%d",
+  "type": "*",
+  "time": "2024-01-01T00:00:00Z",
+  "data": {
+    "event": {"id": "%d", "metadata": {"data_path": "secret/data/app", "path": "secret/data/app", "operation": "data-write"}},
+    "event_type": "kv-v2/data-write",
+    "plugin_info": {"mount_path": "secret/"}
+  }
+}`
+
+func TestEventsClientSubscribe(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	var connections int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/events/subscribe/kv*" || r.URL.Query().Get("json") != "true" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		// every connection sends a single event then breaks
+		connections++
+		message := []byte(fmt.Sprintf(testKVEvent, connections, connections))
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := NewEventsClient(cl, EventsBackoff(10*time.Millisecond, 10*time.Millisecond))
+
+	if _, err := client.Subscribe(ctx, "kv-v1*"); !errors.Is(err, ErrEventsNotSupported) {
+		t.Fatalf("expected ErrEventsNotSupported, got %v", err)
+	}
+
+	events, err := client.Subscribe(ctx, "kv*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		event := <-events
+		if event.ID != id || event.Type != "kv-v2/data-write" || event.Path() != "secret/data/app" || event.MountPath != "secret/" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
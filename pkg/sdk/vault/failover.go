@@ -0,0 +1,230 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+const defaultFailoverCheckInterval = 30 * time.Second
+
+// failoverTransport is an http.RoundTripper which sends requests to one of
+// many Vault addresses, preferring the active node and failing over to the
+// next address on connection errors or 503 responses, see replayable.
+type failoverTransport struct {
+	base      http.RoundTripper
+	addresses []*url.URL
+
+	mu      sync.RWMutex
+	current int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newFailoverTransport(base http.RoundTripper, addresses []string) (*failoverTransport, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("at least one Vault address is required for failover") // nolint:goerr113
+	}
+
+	t := &failoverTransport{
+		base: base,
+		stop: make(chan struct{}),
+	}
+
+	for _, address := range addresses {
+		u, err := url.Parse(strings.TrimSpace(address))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse Vault address '%s'", address)
+		}
+		t.addresses = append(t.addresses, u)
+	}
+
+	return t, nil
+}
+
+// resolveSRVAddresses looks up the DNS SRV record and returns the Vault addresses
+// behind it, ordered by priority and weight, using the given scheme.
+func resolveSRVAddresses(name, scheme string) ([]string, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lookup SRV record '%s'", name)
+	}
+
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addresses = append(addresses, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprint(record.Port))))
+	}
+
+	return addresses, nil
+}
+
+// Address returns the currently preferred Vault address.
+func (t *failoverTransport) Address() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.addresses[t.current].String()
+}
+
+func (t *failoverTransport) setCurrent(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current != i {
+		logger.Infof("switching Vault address from %s to %s", t.addresses[t.current], t.addresses[i])
+		t.current = i
+	}
+}
+
+func (t *failoverTransport) currentIndex() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.current
+}
+
+// replayable reports whether the request can be sent to the next address after the failed attempt.
+// Idempotent requests are replayed after connection errors and 503 responses, the others only if the
+// connection couldn't be established, so they are never applied twice. The body is replayed with GetBody.
+func replayable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "LIST":
+		return true
+	}
+
+	var opErr *net.OpError
+	return resp == nil && errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.currentIndex()
+
+	var resp *http.Response
+	var err error
+
+	for i := 0; i < len(t.addresses); i++ {
+		index := (start + i) % len(t.addresses)
+		address := t.addresses[index]
+
+		r := new(http.Request)
+		*r = *req
+		u := *req.URL
+		u.Scheme = address.Scheme
+		u.Host = address.Host
+		r.URL = &u
+		r.Host = ""
+		if i > 0 && req.GetBody != nil {
+			r.Body, err = req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to replay request body")
+			}
+		}
+
+		resp, err = t.base.RoundTrip(r)
+		if err == nil && resp.StatusCode != http.StatusServiceUnavailable {
+			t.setCurrent(index)
+			return resp, nil
+		}
+
+		if i == len(t.addresses)-1 {
+			break
+		}
+
+		if !replayable(req, resp, err) {
+			// the request is returned as is, the next one goes to the next address
+			logger.Debugf("request to Vault address %s failed, it can't be replayed", address)
+			t.setCurrent((index + 1) % len(t.addresses))
+			break
+		}
+
+		if err != nil {
+			logger.Debugf("request to Vault address %s failed, trying next one: %s", address, err)
+		} else {
+			logger.Debugf("Vault address %s is unavailable, trying next one", address)
+			_ = resp.Body.Close()
+		}
+	}
+
+	return resp, err
+}
+
+// checkHealth queries sys/health on all addresses and selects the active node,
+// or the first healthy standby node if there is no active one reachable.
+func (t *failoverTransport) checkHealth() {
+	client := &http.Client{Transport: t.base, Timeout: 5 * time.Second}
+
+	standby := -1
+
+	for i, address := range t.addresses {
+		resp, err := client.Get(address.String() + "/v1/sys/health")
+		if err != nil {
+			logger.Debugf("health check of Vault address %s failed: %s", address, err)
+			continue
+		}
+		_ = resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			t.setCurrent(i)
+			return
+		// 429: unsealed standby, 473: performance standby
+		case http.StatusTooManyRequests, 473:
+			if standby == -1 {
+				standby = i
+			}
+		}
+	}
+
+	if standby != -1 {
+		t.setCurrent(standby)
+	}
+}
+
+// run periodically re-checks the health of the addresses until it is closed.
+func (t *failoverTransport) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.checkHealth()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *failoverTransport) close() {
+	t.stopOnce.Do(func() { close(t.stop) })
+}
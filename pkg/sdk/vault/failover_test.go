@@ -0,0 +1,146 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestVaultServer(healthStatus, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/health" {
+			w.WriteHeader(healthStatus)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+}
+
+func TestFailoverTransport(t *testing.T) {
+	sealed := newTestVaultServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer sealed.Close()
+
+	active := newTestVaultServer(http.StatusOK, http.StatusOK)
+	defer active.Close()
+
+	transport, err := newFailoverTransport(http.DefaultTransport, []string{sealed.URL, active.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.close()
+
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(sealed.URL + "/v1/secret/data/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if transport.Address() != active.URL {
+		t.Errorf("expected current address to be %s, got %s", active.URL, transport.Address())
+	}
+}
+
+func TestFailoverTransportWrites(t *testing.T) {
+	sealed := newTestVaultServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer sealed.Close()
+
+	active := newTestVaultServer(http.StatusOK, http.StatusOK)
+	defer active.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	transport, err := newFailoverTransport(http.DefaultTransport, []string{sealed.URL, unreachable.URL, active.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.close()
+
+	client := &http.Client{Transport: transport}
+
+	// the write may have been applied by the node returning the error, so it isn't replayed
+	resp, err := client.Post(sealed.URL+"/v1/auth/token/create", "application/json", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	if transport.Address() != unreachable.URL {
+		t.Errorf("expected the next request to go to %s, got %s", unreachable.URL, transport.Address())
+	}
+
+	// the write is replayed when the connection couldn't be established
+	resp, err = client.Post(sealed.URL+"/v1/auth/token/create", "application/json", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("expected the request body to be replayed to %s, got %d %q", active.URL, resp.StatusCode, body)
+	}
+
+	if transport.Address() != active.URL {
+		t.Errorf("expected current address to be %s, got %s", active.URL, transport.Address())
+	}
+
+	// a body which can't be replayed isn't buffered
+	transport.setCurrent(1)
+	resp, err = client.Post(sealed.URL+"/v1/sys/storage/raft/snapshot-force", "application/octet-stream", ioutil.NopCloser(strings.NewReader("snapshot")))
+	if err == nil {
+		resp.Body.Close()
+		t.Error("expected the request to fail without replaying it")
+	}
+}
+
+func TestFailoverTransportPrefersActive(t *testing.T) {
+	standby := newTestVaultServer(http.StatusTooManyRequests, http.StatusOK)
+	defer standby.Close()
+
+	active := newTestVaultServer(http.StatusOK, http.StatusOK)
+	defer active.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	transport, err := newFailoverTransport(http.DefaultTransport, []string{unreachable.URL, standby.URL, active.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.close()
+
+	transport.checkHealth()
+
+	if transport.Address() != active.URL {
+		t.Errorf("expected the active node %s to be preferred, got %s", active.URL, transport.Address())
+	}
+}
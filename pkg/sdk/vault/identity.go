@@ -0,0 +1,328 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// identityAlias is an alias of an entity or a group, bound to an auth method by its mount path
+type identityAlias struct {
+	Name      string `mapstructure:"name"`
+	MountPath string `mapstructure:"mountpath"`
+}
+
+type identityEntity struct {
+	Name     string                 `mapstructure:"name"`
+	Policies []string               `mapstructure:"policies"`
+	Metadata map[string]interface{} `mapstructure:"metadata"`
+	Disabled bool                   `mapstructure:"disabled"`
+	Aliases  []identityAlias        `mapstructure:"aliases"`
+}
+
+type identityGroup struct {
+	Name     string                 `mapstructure:"name"`
+	Type     string                 `mapstructure:"type"`
+	Policies []string               `mapstructure:"policies"`
+	Metadata map[string]interface{} `mapstructure:"metadata"`
+	// the names of the member entities and groups of internal groups
+	MemberEntities []string `mapstructure:"member_entities"`
+	MemberGroups   []string `mapstructure:"member_groups"`
+	// the alias of an external group, external groups can have a single alias
+	Alias *identityAlias `mapstructure:"alias"`
+}
+
+type identityConfig struct {
+	Entities []identityEntity `mapstructure:"entities"`
+	Groups   []identityGroup  `mapstructure:"groups"`
+}
+
+// configureIdentity reconciles the identity entities with their aliases, and the internal groups with
+// their members and the external groups with their aliases of the identity block:
+//
+//	identity:
+//	  entities:
+//	    - name: alice
+//	      policies: [developer]
+//	      aliases:
+//	        - name: alice
+//	          mountpath: userpass
+//	  groups:
+//	    - name: developers
+//	      type: internal
+//	      policies: [developer]
+//	      member_entities: [alice]
+//	    - name: admins
+//	      type: external
+//	      policies: [admin]
+//	      alias:
+//	        name: admins
+//	        mountpath: github
+func (v *vault) configureIdentity(config *viper.Viper) error {
+	var identity identityConfig
+	err := config.UnmarshalKey("identity", &identity)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling vault identity config")
+	}
+
+	entityIDs := map[string]string{}
+	for _, entity := range identity.Entities {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		id, err := v.configureIdentityEntity(entity)
+		if err != nil {
+			return errors.Wrapf(err, "error configuring entity %s", entity.Name)
+		}
+		entityIDs[entity.Name] = id
+	}
+
+	// the groups are written without their member groups, which might be declared later, first
+	groupIDs := map[string]string{}
+	for _, group := range identity.Groups {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		id, err := v.configureIdentityGroup(group, entityIDs)
+		if err != nil {
+			return errors.Wrapf(err, "error configuring group %s", group.Name)
+		}
+		groupIDs[group.Name] = id
+	}
+
+	for _, group := range identity.Groups {
+		if len(group.MemberGroups) == 0 {
+			continue
+		}
+
+		memberGroupIDs := make([]string, 0, len(group.MemberGroups))
+		for _, member := range group.MemberGroups {
+			id, ok := groupIDs[member]
+			if !ok {
+				id, err = getVaultGroupID(member, v.cl)
+				if err != nil {
+					return errors.Wrapf(err, "error finding member group %s of group %s", member, group.Name)
+				}
+			}
+			memberGroupIDs = append(memberGroupIDs, id)
+		}
+
+		_, err = v.cl.Logical().Write(fmt.Sprintf("identity/group/name/%s", group.Name), map[string]interface{}{
+			"member_group_ids": memberGroupIDs,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to set member groups of group %s", group.Name)
+		}
+	}
+
+	return nil
+}
+
+// writeIdentityByName creates or updates the named entity or group, and returns its ID
+func (v *vault) writeIdentityByName(kind, name string, data map[string]interface{}) (string, *api.Secret, error) {
+	path := fmt.Sprintf("identity/%s/name/%s", kind, name)
+
+	existing, err := v.cl.Logical().Read(path)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read %s", kind)
+	}
+
+	if existing == nil {
+		logrus.Infof("creating %s: %s", kind, name)
+	} else {
+		logrus.Infof("tuning already existing %s: %s", kind, name)
+	}
+
+	// the response only contains the ID if the entity or group has been created
+	created, err := v.cl.Logical().Write(path, data)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to write %s", kind)
+	}
+
+	switch {
+	case existing != nil:
+		return cast.ToString(existing.Data["id"]), existing, nil
+	case created != nil:
+		return cast.ToString(created.Data["id"]), nil, nil
+	default:
+		return "", nil, errors.Errorf("no ID returned for %s", kind)
+	}
+}
+
+func (v *vault) configureIdentityEntity(entity identityEntity) (string, error) {
+	id, existing, err := v.writeIdentityByName("entity", entity.Name, map[string]interface{}{
+		"policies": entity.Policies,
+		"metadata": cast.ToStringMapString(entity.Metadata),
+		"disabled": entity.Disabled,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	existingAliases := map[string]bool{}
+	if existing != nil {
+		aliases, _ := existing.Data["aliases"].([]interface{})
+		for _, alias := range aliases {
+			alias := cast.ToStringMap(alias)
+			existingAliases[cast.ToString(alias["name"])+"@"+cast.ToString(alias["mount_accessor"])] = true
+		}
+	}
+
+	for _, alias := range entity.Aliases {
+		accessor, err := getVaultAuthMountAccessor(alias.MountPath, v.cl)
+		if err != nil {
+			return "", errors.Wrapf(err, "error getting mount accessor for %s", alias.MountPath)
+		}
+
+		if existingAliases[alias.Name+"@"+accessor] {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"name":           alias.Name,
+			"mount_accessor": accessor,
+			"canonical_id":   id,
+		}
+
+		// the alias might belong to another entity, in which case it is moved to this one
+		aliasID, err := v.findEntityAliasID(alias.Name, accessor)
+		if err != nil {
+			return "", err
+		}
+
+		if aliasID == "" {
+			logrus.Infof("creating entity-alias: %s@%s", alias.Name, accessor)
+			_, err = v.cl.Logical().Write("identity/entity-alias", data)
+		} else {
+			logrus.Infof("moving entity-alias %s@%s to entity %s", alias.Name, accessor, entity.Name)
+			_, err = v.cl.Logical().Write(fmt.Sprintf("identity/entity-alias/id/%s", aliasID), data)
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to write entity-alias %s@%s", alias.Name, accessor)
+		}
+	}
+
+	return id, nil
+}
+
+// findEntityAliasID returns the ID of the entity alias with the name on the auth mount, or an empty string if there is none
+func (v *vault) findEntityAliasID(name, accessor string) (string, error) {
+	entity, err := v.cl.Logical().Write("identity/lookup/entity", map[string]interface{}{
+		"alias_name":           name,
+		"alias_mount_accessor": accessor,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "error looking up entity of alias %s@%s", name, accessor)
+	}
+	if entity == nil {
+		return "", nil
+	}
+
+	aliases, _ := entity.Data["aliases"].([]interface{})
+	for _, alias := range aliases {
+		alias := cast.ToStringMap(alias)
+		if cast.ToString(alias["name"]) == name && cast.ToString(alias["mount_accessor"]) == accessor {
+			return cast.ToString(alias["id"]), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (v *vault) configureIdentityGroup(group identityGroup, entityIDs map[string]string) (string, error) {
+	groupType := group.Type
+	if groupType == "" {
+		groupType = "internal"
+	}
+
+	data := map[string]interface{}{
+		"type":     groupType,
+		"policies": group.Policies,
+		"metadata": cast.ToStringMapString(group.Metadata),
+	}
+
+	switch groupType {
+	case "internal":
+		if group.Alias != nil {
+			return "", errors.New("only external groups can have an alias") // nolint:goerr113
+		}
+
+		memberEntityIDs := make([]string, 0, len(group.MemberEntities))
+		for _, member := range group.MemberEntities {
+			id, ok := entityIDs[member]
+			if !ok {
+				var err error
+				id, err = v.identityEntityID(member)
+				if err != nil {
+					return "", errors.Wrap(err, "error finding member entity")
+				}
+			}
+			memberEntityIDs = append(memberEntityIDs, id)
+		}
+		data["member_entity_ids"] = memberEntityIDs
+	case "external":
+		if len(group.MemberEntities) > 0 || len(group.MemberGroups) > 0 {
+			return "", errors.New("the members of external groups are managed by their alias") // nolint:goerr113
+		}
+	default:
+		return "", errors.Errorf("unknown group type: %s", groupType)
+	}
+
+	id, _, err := v.writeIdentityByName("group", group.Name, data)
+	if err != nil {
+		return "", err
+	}
+
+	if group.Alias == nil {
+		return id, nil
+	}
+
+	accessor, err := getVaultAuthMountAccessor(group.Alias.MountPath, v.cl)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting mount accessor for %s", group.Alias.MountPath)
+	}
+
+	aliasID, err := findVaultGroupAliasIDFromNameAndMount(group.Alias.Name, accessor, v.cl)
+	if err != nil {
+		return "", errors.Wrapf(err, "error finding group-alias %s", group.Alias.Name)
+	}
+
+	aliasData := map[string]interface{}{
+		"name":           group.Alias.Name,
+		"mount_accessor": accessor,
+		"canonical_id":   id,
+	}
+
+	if aliasID == "" {
+		logrus.Infof("creating group-alias: %s@%s", group.Alias.Name, accessor)
+		_, err = v.cl.Logical().Write("identity/group-alias", aliasData)
+	} else {
+		logrus.Infof("tuning already existing group-alias: %s@%s - ID: %s", group.Alias.Name, accessor, aliasID)
+		_, err = v.cl.Logical().Write(fmt.Sprintf("identity/group-alias/id/%s", aliasID), aliasData)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to write group-alias %s", group.Alias.Name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,128 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureIdentity(t *testing.T) {
+	writes := map[string]map[string]interface{}{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/auth":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"userpass/": map[string]interface{}{"type": "userpass", "accessor": "auth_userpass_1"},
+			}}
+		case "GET /v1/identity/entity/name/alice":
+			// alice exists with the alias already
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"id":      "alice-id",
+				"aliases": []interface{}{map[string]interface{}{"id": "a1", "name": "alice", "mount_accessor": "auth_userpass_1"}},
+			}}
+		case "GET /v1/identity/entity/name/bob", "GET /v1/identity/group/name/developers", "GET /v1/identity/group/name/everyone":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "PUT /v1/identity/lookup/entity":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "PUT /v1/identity/entity/name/alice", "PUT /v1/identity/entity/name/bob", "PUT /v1/identity/entity-alias",
+			"PUT /v1/identity/group/name/developers", "PUT /v1/identity/group/name/everyone":
+			path := strings.TrimPrefix(r.URL.Path, "/v1/")
+			if _, ok := writes[path]; ok {
+				path += "#2"
+			}
+			writes[path] = body
+			switch path {
+			case "identity/entity/name/bob":
+				response = map[string]interface{}{"data": map[string]interface{}{"id": "bob-id"}}
+			case "identity/group/name/developers":
+				response = map[string]interface{}{"data": map[string]interface{}{"id": "developers-id"}}
+			case "identity/group/name/everyone":
+				response = map[string]interface{}{"data": map[string]interface{}{"id": "everyone-id"}}
+			default:
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+identity:
+  entities:
+    - name: alice
+      policies: [developer]
+      aliases:
+        - name: alice
+          mountpath: userpass
+    - name: bob
+      aliases:
+        - name: bob
+          mountpath: userpass/
+  groups:
+    - name: developers
+      policies: [developer]
+      member_entities: [alice, bob]
+    - name: everyone
+      member_groups: [developers]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configureIdentity(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if alias := writes["identity/entity-alias"]; alias["name"] != "bob" || alias["canonical_id"] != "bob-id" || alias["mount_accessor"] != "auth_userpass_1" {
+		t.Errorf("unexpected entity alias: %+v", alias)
+	}
+	if members := writes["identity/group/name/developers"]["member_entity_ids"]; len(members.([]interface{})) != 2 || members.([]interface{})[1] != "bob-id" {
+		t.Errorf("unexpected members of developers: %+v", members)
+	}
+	if members := writes["identity/group/name/everyone#2"]["member_group_ids"]; len(members.([]interface{})) != 1 || members.([]interface{})[0] != "developers-id" {
+		t.Errorf("unexpected member groups of everyone: %+v", members)
+	}
+}
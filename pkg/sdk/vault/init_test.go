@@ -0,0 +1,186 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestInitWithRecoveryPGPKeysAndWrappedRootToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/init":
+			response = map[string]interface{}{"initialized": false}
+		case "PUT /v1/sys/init":
+			if body["recovery_shares"] != 2.0 || body["recovery_threshold"] != 1.0 {
+				t.Errorf("unexpected recovery shares: %v", body)
+			}
+			if keys, ok := body["recovery_pgp_keys"].([]interface{}); !ok || len(keys) != 2 {
+				t.Errorf("unexpected recovery PGP keys: %v", body["recovery_pgp_keys"])
+			}
+			response = api.InitResponse{RecoveryKeys: []string{"encrypted-0", "encrypted-1"}, RootToken: "root"}
+		case "GET /v1/sys/seal-status":
+			response = api.SealStatusResponse{Type: "awskms", Initialized: true}
+		case "PUT /v1/sys/wrapping/wrap":
+			if ttl := r.Header.Get("X-Vault-Wrap-TTL"); ttl != "10m0s" {
+				t.Errorf("unexpected wrap TTL: %q", ttl)
+			}
+			if token := r.Header.Get("X-Vault-Token"); token != "root" {
+				t.Errorf("the root token should wrap itself, got %q", token)
+			}
+			response = map[string]interface{}{"wrap_info": map[string]interface{}{"token": "wrapping", "ttl": 600}}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memoryKV{}
+	v, err := New(store, cl, Config{
+		SecretShares:     2,
+		SecretThreshold:  1,
+		RecoveryPGPKeys:  []string{"key-0", "key-1"},
+		StoreRootToken:   true,
+		WrapRootTokenTTL: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"vault-recovery-pgp-0": "encrypted-0",
+		"vault-recovery-pgp-1": "encrypted-1",
+		"vault-root-wrapped":   "wrapping",
+	}
+	for key, value := range expected {
+		if actual := string(store[key]); actual != value {
+			t.Errorf("%s: expected %q, got %q", key, value, actual)
+		}
+	}
+	if _, ok := store["vault-root"]; ok {
+		t.Error("the raw root token shouldn't be stored")
+	}
+	if _, ok := store["vault-recovery-0"]; ok {
+		t.Error("the encrypted recovery keys shouldn't be stored as plain recovery keys")
+	}
+}
+
+func TestInitRefusesExistingRecoveryKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method+" "+r.URL.Path != "GET /v1/sys/init" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"initialized": false})
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"vault-recovery-1", "vault-recovery-pgp-0"} {
+		v, err := New(memoryKV{key: []byte("existing")}, cl, Config{SecretShares: 2, SecretThreshold: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := v.Init(); err == nil {
+			t.Errorf("%s: init must not overwrite an existing recovery key", key)
+		}
+	}
+}
+
+func TestNewValidatesPGPKeys(t *testing.T) {
+	cl, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(memoryKV{}, cl, Config{SecretShares: 3, SecretThreshold: 2, PGPKeys: []string{"key-0"}}); err == nil {
+		t.Error("a PGP key is required for every share")
+	}
+	if _, err := New(memoryKV{}, cl, Config{SecretShares: 3, SecretThreshold: 2, RecoveryShares: 1}); err == nil {
+		t.Error("the recovery threshold defaults to the secret threshold, which is bigger than the recovery shares")
+	}
+
+	pgpKeys := []string{"key-0", "key-1"}
+	if _, err := New(memoryKV{}, cl, Config{SecretShares: 2, SecretThreshold: 1, PGPKeys: pgpKeys, InitAuditFilePath: "stdout"}); err == nil {
+		t.Error("the init audit device requires unseal keys bank-vaults can unseal with")
+	}
+	if _, err := New(memoryKV{}, cl, Config{SecretShares: 2, SecretThreshold: 1, PGPKeys: pgpKeys, WrapRootTokenTTL: time.Minute}); err == nil {
+		t.Error("wrapping the root token requires unseal keys bank-vaults can unseal with")
+	}
+}
+
+// forwardingLocker is a wrapper of a key store which doesn't support locking
+type forwardingLocker struct {
+	memoryKV
+}
+
+func (forwardingLocker) Lock(string, time.Duration) (func() error, error) {
+	return nil, errKVLockingNotSupported
+}
+
+func TestLockKeyStoreWithoutLocking(t *testing.T) {
+	cl, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []KVService{memoryKV{}, forwardingLocker{memoryKV{}}} {
+		v, err := New(store, cl, Config{SecretShares: 1, SecretThreshold: 1, LockKeyStore: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unlock, err := v.(*vault).lockKeyStore("init")
+		if err != nil {
+			t.Fatalf("%T: a key store without locking should be used without the lock: %s", store, err)
+		}
+		if err := unlock(); err != nil {
+			t.Errorf("%T: %s", store, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const defaultLicenseExpiryWarning = 30 * 24 * time.Hour
+
+// LicenseStatus is the status of the license of Vault Enterprise
+type LicenseStatus struct {
+	LicenseID  string
+	Expiration time.Time
+	// the license expires within the expiry warning period of the configuration
+	ExpiresSoon bool
+	// the license is autoloaded from the configuration file or the environment of Vault
+	Autoloaded bool
+}
+
+// configureLicense installs the license of Vault Enterprise from the license block, and validates the status
+// of the installed or autoloaded license. The text can be a valueFrom reference to a Kubernetes Secret, if it is
+// not set only the status is validated, which is the way to go with autoloaded licenses (Vault 1.8+):
+//
+//	license:
+//	  text:
+//	    valueFrom:
+//	      secretKeyRef:
+//	        name: vault-license
+//	        key: license
+//	  expiryWarning: 720h
+//
+// The configuration fails if the license has expired, and warns if it expires within the expiryWarning period.
+func (v *vault) configureLicense(config *viper.Viper) error {
+	if !config.IsSet("license") {
+		return nil
+	}
+
+	license := config.GetStringMap("license")
+
+	text, err := getOrDefaultString(license, "text")
+	if err != nil {
+		return errors.Wrap(err, "error getting text for license")
+	}
+
+	expiryWarning := defaultLicenseExpiryWarning
+	if raw, ok := license["expirywarning"]; ok {
+		expiryWarning, err = cast.ToDurationE(raw)
+		if err != nil {
+			return errors.Wrap(err, "error parsing expiryWarning for license")
+		}
+	}
+
+	if text != "" {
+		if _, err := v.cl.Logical().Write("sys/license", map[string]interface{}{"text": text}); err != nil {
+			return errors.Wrap(err, "error installing license")
+		}
+		logrus.Info("installed vault license")
+	}
+
+	status, err := v.licenseStatus()
+	if err != nil {
+		return err
+	}
+
+	status.ExpiresSoon = time.Until(status.Expiration) < expiryWarning
+
+	if v.config.LicenseHook != nil {
+		v.config.LicenseHook(*status)
+	}
+
+	log := logrus.WithFields(logrus.Fields{"license": status.LicenseID, "expiration": status.Expiration.Format(time.RFC3339)})
+
+	if time.Now().After(status.Expiration) {
+		return errors.Errorf("the vault license %s has expired at %s", status.LicenseID, status.Expiration.Format(time.RFC3339))
+	}
+
+	if status.ExpiresSoon {
+		log.Warnf("the vault license expires in %s", time.Until(status.Expiration).Round(time.Hour))
+	} else {
+		log.Info("vault license is valid")
+	}
+
+	return nil
+}
+
+// licenseStatus reads the status of the license from sys/license/status (Vault 1.8+) or sys/license
+func (v *vault) licenseStatus() (*LicenseStatus, error) {
+	// the endpoint doesn't exist before Vault 1.8, the client returns no secret for 404
+	secret, err := v.cl.Logical().Read("sys/license/status")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading license status")
+	}
+
+	status := &LicenseStatus{}
+	var license map[string]interface{}
+	if secret != nil && secret.Data != nil {
+		for _, key := range []string{"autoloaded", "persisted_autoload"} {
+			if l, ok := secret.Data[key].(map[string]interface{}); ok {
+				license = l
+				status.Autoloaded = key == "autoloaded"
+				break
+			}
+		}
+	}
+
+	if license == nil {
+		secret, err = v.cl.Logical().Read("sys/license")
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading license")
+		}
+		if secret == nil || secret.Data == nil {
+			return nil, errors.New("vault has no license, is it Vault Enterprise?") // nolint:goerr113
+		}
+		license = secret.Data
+	}
+
+	status.LicenseID = cast.ToString(license["license_id"])
+
+	expiration, err := time.Parse(time.RFC3339, cast.ToString(license["expiration_time"]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing expiration time of license %s", status.LicenseID)
+	}
+	status.Expiration = expiration
+
+	return status, nil
+}
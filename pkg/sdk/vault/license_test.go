@@ -0,0 +1,93 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func testExternalConfig(t *testing.T, yaml string) *viper.Viper {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	if err := config.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestConfigureLicense(t *testing.T) {
+	expiration := time.Now().Add(10 * 24 * time.Hour).UTC().Truncate(time.Second)
+
+	paths := map[string]map[string]interface{}{
+		"sys/license/status": {
+			"autoloading_used": true,
+			"autoloaded":       map[string]interface{}{"license_id": "autoloaded", "expiration_time": expiration.Format(time.RFC3339)},
+		},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status LicenseStatus
+	v := &vault{cl: cl, config: &Config{LicenseHook: func(s LicenseStatus) { status = s }}}
+
+	if err := v.configureLicense(testExternalConfig(t, `
+license:
+  text: license-text
+  expiryWarning: 480h
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if text := paths["sys/license"]["text"]; text != "license-text" {
+		t.Errorf("the license must be installed, got %v", text)
+	}
+
+	expected := LicenseStatus{LicenseID: "autoloaded", Expiration: expiration, ExpiresSoon: true, Autoloaded: true}
+	if status != expected {
+		t.Errorf("expected license status %+v, got %+v", expected, status)
+	}
+
+	// Vault before 1.8 has no license status endpoint
+	delete(paths, "sys/license/status")
+	paths["sys/license"] = map[string]interface{}{"license_id": "installed", "expiration_time": expiration.Format(time.RFC3339)}
+
+	if err := v.configureLicense(testExternalConfig(t, "license:\n  expiryWarning: 24h\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = LicenseStatus{LicenseID: "installed", Expiration: expiration}
+	if status != expected {
+		t.Errorf("expected license status %+v, got %+v", expected, status)
+	}
+
+	paths["sys/license"]["expiration_time"] = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	if err := v.configureLicense(testExternalConfig(t, "license: {}\n")); err == nil {
+		t.Error("an expired license must fail the configuration")
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// mfaMethodTypes are the supported login MFA method types of Vault 1.13+
+var mfaMethodTypes = map[string]bool{
+	"duo":    true,
+	"okta":   true,
+	"pingid": true,
+	"totp":   true,
+}
+
+type mfaMethod struct {
+	id         string
+	methodType string
+}
+
+// listMFAMethods returns the login MFA methods by their name
+func (v *vault) listMFAMethods() (map[string]mfaMethod, error) {
+	methods := map[string]mfaMethod{}
+
+	secret, err := v.cl.Logical().List("identity/mfa/method")
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing mfa methods")
+	}
+	if secret == nil {
+		return methods, nil
+	}
+
+	for id, info := range cast.ToStringMap(secret.Data["key_info"]) {
+		info := cast.ToStringMap(info)
+		if name := cast.ToString(info["method_name"]); name != "" {
+			methods[name] = mfaMethod{id: id, methodType: cast.ToString(info["type"])}
+		}
+	}
+
+	return methods, nil
+}
+
+// configureLoginMFA reconciles the login MFA methods and their enforcements, the methods are
+// identified by their name, so they are updated instead of created again on every run, and
+// they are only written if they have changed. With purgeUnmanagedConfig.mfa the methods and
+// enforcements which are not configured are deleted.
+func (v *vault) configureLoginMFA(config *viper.Viper) error {
+	methods := []map[string]interface{}{}
+	enforcements := []map[string]interface{}{}
+
+	err := config.UnmarshalKey("mfa.methods", &methods)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling vault mfa methods config")
+	}
+
+	err = config.UnmarshalKey("mfa.enforcements", &enforcements)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling vault mfa enforcements config")
+	}
+
+	if len(methods) == 0 && len(enforcements) == 0 && !purgeUnmanaged(config, "mfa") {
+		return nil
+	}
+
+	existingMethods, err := v.listMFAMethods()
+	if err != nil {
+		return err
+	}
+
+	for _, method := range methods {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		name, err := getOrError(method, "name")
+		if err != nil {
+			return errors.Wrap(err, "error finding mfa method name")
+		}
+
+		methodType, err := getOrError(method, "type")
+		if err != nil {
+			return errors.Wrapf(err, "error finding type of mfa method %s", name)
+		}
+		if !mfaMethodTypes[methodType] {
+			return errors.Errorf("unsupported type of mfa method %s: %s", name, methodType)
+		}
+
+		methodConfig, err := getOrDefaultStringMap(method, "config")
+		if err != nil {
+			return errors.Wrapf(err, "error finding config of mfa method %s", name)
+		}
+
+		data := map[string]interface{}{"method_name": name}
+		for key, value := range methodConfig {
+			data[key] = value
+		}
+
+		existing, ok := existingMethods[name]
+		if !ok {
+			logrus.Infof("creating %s mfa method: %s", methodType, name)
+			secret, err := v.cl.Logical().Write(fmt.Sprintf("identity/mfa/method/%s", methodType), data)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create mfa method %s", name)
+			}
+			if secret == nil || cast.ToString(secret.Data["method_id"]) == "" {
+				return errors.Errorf("no id returned for mfa method %s", name)
+			}
+			existingMethods[name] = mfaMethod{id: cast.ToString(secret.Data["method_id"]), methodType: methodType}
+			continue
+		}
+
+		if existing.methodType != methodType {
+			return errors.Errorf("mfa method %s exists already with type %s", name, existing.methodType)
+		}
+
+		methodPath := fmt.Sprintf("identity/mfa/method/%s/%s", methodType, existing.id)
+
+		current, err := v.cl.Logical().Read(methodPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read mfa method %s", name)
+		}
+		if current != nil && !mfaMethodChanged(current.Data, data) {
+			logrus.Debugf("%s mfa method %s is unchanged", methodType, name)
+			continue
+		}
+
+		logrus.Infof("tuning already existing %s mfa method: %s", methodType, name)
+		_, err = v.cl.Logical().Write(methodPath, data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to tune mfa method %s", name)
+		}
+	}
+
+	managedEnforcements := map[string]bool{}
+
+	for _, enforcement := range enforcements {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		name, err := getOrError(enforcement, "name")
+		if err != nil {
+			return errors.Wrap(err, "error finding mfa enforcement name")
+		}
+		managedEnforcements[name] = true
+
+		var methodIDs []string
+		for _, method := range cast.ToStringSlice(enforcement["methods"]) {
+			existing, ok := existingMethods[method]
+			if !ok {
+				return errors.Errorf("mfa method %s of enforcement %s does not exist", method, name)
+			}
+			methodIDs = append(methodIDs, existing.id)
+		}
+		if len(methodIDs) == 0 {
+			return errors.Errorf("mfa enforcement %s has no methods", name)
+		}
+
+		accessors := []string{}
+		for _, path := range cast.ToStringSlice(enforcement["auth_methods"]) {
+			accessor, err := getVaultAuthMountAccessor(path, v.cl)
+			if err != nil {
+				return errors.Wrapf(err, "error getting mount accessor of mfa enforcement %s", name)
+			}
+			accessors = append(accessors, accessor)
+		}
+
+		groupIDs := []string{}
+		for _, group := range cast.ToStringSlice(enforcement["identity_groups"]) {
+			id, err := getVaultGroupID(group, v.cl)
+			if err != nil {
+				return errors.Wrapf(err, "error getting group id of mfa enforcement %s", name)
+			}
+			groupIDs = append(groupIDs, id)
+		}
+
+		// empty lists are sent as well, so that the removed targets are removed from the enforcement
+		data := map[string]interface{}{
+			"mfa_method_ids":        methodIDs,
+			"auth_method_accessors": accessors,
+			"auth_method_types":     append([]string{}, cast.ToStringSlice(enforcement["auth_method_types"])...),
+			"identity_group_ids":    groupIDs,
+			"identity_entity_ids":   append([]string{}, cast.ToStringSlice(enforcement["identity_entity_ids"])...),
+		}
+
+		enforcementPath := fmt.Sprintf("identity/mfa/login-enforcement/%s", name)
+
+		current, err := v.cl.Logical().Read(enforcementPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read mfa login enforcement %s", name)
+		}
+		if current != nil && !mfaEnforcementChanged(current.Data, data) {
+			logrus.Debugf("mfa login enforcement %s is unchanged", name)
+			continue
+		}
+
+		logrus.Infof("configuring mfa login enforcement: %s", name)
+		_, err = v.cl.Logical().Write(enforcementPath, data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to configure mfa login enforcement %s", name)
+		}
+	}
+
+	if purgeUnmanaged(config, "mfa") {
+		return v.purgeUnmanagedLoginMFA(methods, managedEnforcements, existingMethods)
+	}
+
+	return nil
+}
+
+// mfaMethodChanged tells whether the configuration of the method differs from its current one, the
+// secrets of the methods (like the secret key of Duo) are not returned by Vault, so they count as changed
+func mfaMethodChanged(current, data map[string]interface{}) bool {
+	for key, value := range data {
+		currentValue, ok := current[key]
+		if !ok || fmt.Sprint(currentValue) != fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaEnforcementChanged tells whether the targets of the enforcement differ from its current ones, in any order
+func mfaEnforcementChanged(current, data map[string]interface{}) bool {
+	for key, value := range data {
+		currentValues := cast.ToStringSlice(current[key])
+		values := cast.ToStringSlice(value)
+		sort.Strings(currentValues)
+		sort.Strings(values)
+		if strings.Join(currentValues, ",") != strings.Join(values, ",") {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeUnmanagedLoginMFA deletes the login enforcements which are not configured, then the methods which are
+// not configured, since methods can't be deleted while an enforcement uses them
+func (v *vault) purgeUnmanagedLoginMFA(methods []map[string]interface{}, managedEnforcements map[string]bool, existingMethods map[string]mfaMethod) error {
+	secret, err := v.cl.Logical().List("identity/mfa/login-enforcement")
+	if err != nil {
+		return errors.Wrap(err, "error listing mfa login enforcements")
+	}
+	if secret != nil && secret.Data != nil {
+		for _, name := range cast.ToStringSlice(secret.Data["keys"]) {
+			if managedEnforcements[name] {
+				continue
+			}
+
+			logrus.Infof("deleting unmanaged mfa login enforcement: %s", name)
+
+			if _, err := v.cl.Logical().Delete("identity/mfa/login-enforcement/" + name); err != nil {
+				return errors.Wrapf(err, "error deleting unmanaged mfa login enforcement %s", name)
+			}
+		}
+	}
+
+	managedMethods := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		managedMethods[cast.ToString(method["name"])] = true
+	}
+
+	for name, method := range existingMethods {
+		if managedMethods[name] {
+			continue
+		}
+
+		logrus.Infof("deleting unmanaged %s mfa method: %s", method.methodType, name)
+
+		if _, err := v.cl.Logical().Delete(fmt.Sprintf("identity/mfa/method/%s/%s", method.methodType, method.id)); err != nil {
+			return errors.Wrapf(err, "error deleting unmanaged mfa method %s", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureLoginMFA(t *testing.T) {
+	writes := map[string]map[string]interface{}{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		method := r.Method
+		if r.URL.Query().Get("list") == "true" {
+			method = "LIST"
+		}
+
+		var response interface{}
+		switch method + " " + r.URL.Path {
+		case "LIST /v1/identity/mfa/method":
+			response = api.Secret{Data: map[string]interface{}{
+				"keys":     []string{"totp-id"},
+				"key_info": map[string]interface{}{"totp-id": map[string]interface{}{"type": "totp", "method_name": "totp"}},
+			}}
+		case "GET /v1/sys/auth":
+			response = api.Secret{Data: map[string]interface{}{"userpass/": map[string]interface{}{"type": "userpass", "accessor": "auth_userpass_1234"}}}
+		case "GET /v1/identity/mfa/method/totp/totp-id":
+			response = api.Secret{Data: map[string]interface{}{"method_name": "totp", "issuer": "Old"}}
+		case "GET /v1/identity/mfa/login-enforcement/userpass":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "PUT /v1/identity/mfa/method/duo":
+			writes[r.URL.Path] = body
+			response = api.Secret{Data: map[string]interface{}{"method_id": "duo-id"}}
+		case "PUT /v1/identity/mfa/method/totp/totp-id", "PUT /v1/identity/mfa/login-enforcement/userpass":
+			writes[r.URL.Path] = body
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(memoryKV{}, cl, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+mfa:
+  methods:
+    - name: totp
+      type: totp
+      config:
+        issuer: Vault
+    - name: duo
+      type: duo
+      config:
+        api_hostname: api.duosecurity.com
+  enforcements:
+    - name: userpass
+      methods: [totp, duo]
+      auth_methods: [userpass]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.(*vault).configureSection("mfa", func(v *vault) error { return v.configureLoginMFA(externalConfig) }); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]interface{}{
+		"/v1/identity/mfa/method/totp/totp-id": {"method_name": "totp", "issuer": "Vault"},
+		"/v1/identity/mfa/method/duo":          {"method_name": "duo", "api_hostname": "api.duosecurity.com"},
+		"/v1/identity/mfa/login-enforcement/userpass": {
+			"mfa_method_ids":        []interface{}{"totp-id", "duo-id"},
+			"auth_method_accessors": []interface{}{"auth_userpass_1234"},
+			"auth_method_types":     []interface{}{},
+			"identity_group_ids":    []interface{}{},
+			"identity_entity_ids":   []interface{}{},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, writes) {
+		t.Errorf("unexpected writes:\nexpected: %v\ngot:      %v", expected, writes)
+	}
+}
+
+func TestConfigureLoginMFAUnchanged(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"identity/mfa/method": {
+			"keys": []interface{}{"totp-id", "okta-id"},
+			"key_info": map[string]interface{}{
+				"totp-id": map[string]interface{}{"type": "totp", "method_name": "totp"},
+				"okta-id": map[string]interface{}{"type": "okta", "method_name": "okta"},
+			},
+		},
+		"identity/mfa/method/totp/totp-id": {"method_name": "totp", "issuer": "Vault", "period": 30, "marker": true},
+		"identity/mfa/method/okta/okta-id": {"method_name": "okta"},
+		"identity/mfa/login-enforcement":   {"keys": []interface{}{"userpass", "obsolete"}},
+		"identity/mfa/login-enforcement/userpass": {
+			"mfa_method_ids":        []interface{}{"totp-id"},
+			"auth_method_types":     []interface{}{"userpass"},
+			"auth_method_accessors": []interface{}{},
+			"marker":                true,
+		},
+		"identity/mfa/login-enforcement/obsolete": {"mfa_method_ids": []interface{}{"okta-id"}},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	err = v.configureLoginMFA(testExternalConfig(t, `
+mfa:
+  methods:
+    - name: totp
+      type: totp
+      config:
+        issuer: Vault
+        period: 30
+  enforcements:
+    - name: userpass
+      methods: [totp]
+      auth_method_types: [userpass]
+purgeUnmanagedConfig:
+  mfa: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := paths["identity/mfa/method/totp/totp-id"]["marker"]; !ok {
+		t.Error("the unchanged mfa method must not be written again")
+	}
+	if _, ok := paths["identity/mfa/login-enforcement/userpass"]["marker"]; !ok {
+		t.Error("the unchanged mfa login enforcement must not be written again")
+	}
+	if _, ok := paths["identity/mfa/login-enforcement/obsolete"]; ok {
+		t.Error("the unmanaged mfa login enforcement must be deleted")
+	}
+	if _, ok := paths["identity/mfa/method/okta/okta-id"]; ok {
+		t.Error("the unmanaged mfa method must be deleted")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+)
+
+// MigrateSeal unseals a Vault which has been restarted with a new seal configuration in migration mode,
+// then stores the migrated keys under their new names in the key store. From Shamir to auto-unseal
+// the unseal keys are submitted and they become the recovery keys, from auto-unseal to Shamir the
+// recovery keys are submitted and they become the unseal keys. The previous keys are kept in the
+// key store. It does nothing if Vault is unsealed and not in migration mode.
+func (v *vault) MigrateSeal() error {
+	unlock, err := v.lockKeyStore("migrate-seal")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			logrus.Warnf("error unlocking key store: %s", err.Error())
+		}
+	}()
+
+	defer v.config.SealStatusCache.Invalidate(v.cl.Address())
+
+	status, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return errors.Wrap(err, "error checking status")
+	}
+
+	if !status.Migration {
+		if status.Sealed {
+			return errors.New("vault is sealed but not in seal migration mode, restart it with the new seal configuration") // nolint:goerr113
+		}
+		logrus.Infof("vault at %s is not in seal migration mode, nothing to migrate", v.cl.Address())
+		return nil
+	}
+
+	// the seal type is the one Vault is migrating to
+	sourceKeyForID, targetKeyForID := v.unsealKeyForID, v.recoveryKeyForID
+	if status.Type == "shamir" {
+		sourceKeyForID, targetKeyForID = v.recoveryKeyForID, v.unsealKeyForID
+	}
+
+	keys, err := v.storedKeys(sourceKeyForID)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("migrating the seal of vault at %s to %s", v.cl.Address(), status.Type)
+
+	for _, key := range keys {
+		status, err = v.cl.Sys().UnsealWithOptions(&api.UnsealOpts{Key: key, Migrate: true})
+		if err != nil {
+			return errors.Wrap(err, "fail to send migrate unseal request to vault")
+		}
+		if !status.Sealed {
+			break
+		}
+		if status.Progress == 0 {
+			return errors.New("failed to migrate the seal of vault. progress reset to 0") // nolint:goerr113
+		}
+	}
+
+	if status.Sealed {
+		return errors.Errorf("the %d stored keys didn't unseal vault for the seal migration", len(keys))
+	}
+
+	for i, key := range keys {
+		keyID := targetKeyForID(i)
+		if err := v.keyStore.Set(keyID, []byte(key)); err != nil {
+			return errors.Wrapf(err, "error storing migrated key '%s'", keyID)
+		}
+
+		logrus.WithField("key", keyID).Info("migrated key stored in key store")
+	}
+
+	logrus.Infof("seal of vault at %s migrated to %s", v.cl.Address(), status.Type)
+
+	return nil
+}
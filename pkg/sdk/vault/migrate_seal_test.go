@@ -0,0 +1,108 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestMigrateSealServer simulates a Vault with a threshold of 2 migrating its seal to sealType
+func newTestMigrateSealServer(t *testing.T, sealType, expectedKeyPrefix string) *httptest.Server {
+	var submitted int
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/seal-status":
+			response = api.SealStatusResponse{Type: sealType, Initialized: true, Sealed: true, Migration: true, T: 2, N: 2}
+		case "PUT /v1/sys/unseal":
+			if body["migrate"] != true {
+				t.Error("unseal request without migrate")
+			}
+			if key := body["key"]; key != expectedKeyPrefix+"0" && key != expectedKeyPrefix+"1" {
+				t.Errorf("unexpected key submitted: %v", key)
+			}
+			submitted++
+			response = api.SealStatusResponse{Type: sealType, Initialized: true, Sealed: submitted < 2, Progress: submitted % 2, T: 2, N: 2}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestMigrateSeal(t *testing.T) {
+	tests := []struct {
+		name     string
+		sealType string
+		store    memoryKV
+		expected map[string]string
+	}{
+		{
+			name:     "shamir to auto-unseal",
+			sealType: "awskms",
+			store:    memoryKV{"vault-unseal-0": []byte("unseal-0"), "vault-unseal-1": []byte("unseal-1")},
+			expected: map[string]string{"vault-recovery-0": "unseal-0", "vault-recovery-1": "unseal-1", "vault-unseal-0": "unseal-0"},
+		},
+		{
+			name:     "auto-unseal to shamir",
+			sealType: "shamir",
+			store:    memoryKV{"vault-recovery-0": []byte("recovery-0"), "vault-recovery-1": []byte("recovery-1")},
+			expected: map[string]string{"vault-unseal-0": "recovery-0", "vault-unseal-1": "recovery-1", "vault-recovery-0": "recovery-0"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			prefix := map[string]string{"awskms": "unseal-", "shamir": "recovery-"}[test.sealType]
+			server := newTestMigrateSealServer(t, test.sealType, prefix)
+			defer server.Close()
+
+			config := api.DefaultConfig()
+			config.Address = server.URL
+			cl, err := api.NewClient(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := New(test.store, cl, Config{SecretShares: 2, SecretThreshold: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := v.MigrateSeal(); err != nil {
+				t.Fatal(err)
+			}
+
+			for key, expected := range test.expected {
+				if value := string(test.store[key]); value != expected {
+					t.Errorf("%s: expected %q, got %q", key, expected, value)
+				}
+			}
+		})
+	}
+}
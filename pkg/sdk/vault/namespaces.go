@@ -0,0 +1,146 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// namespaceConfigureSteps are the sections which can be configured within a namespace, in their order of application
+var namespaceConfigureSteps = []configureStep{
+	{
+		section:   "policies",
+		message:   "error configuring policies",
+		configure: (*vault).configurePolicies,
+	},
+	{
+		section:   "auth",
+		message:   "error configuring auth methods",
+		configure: (*vault).configureAuthMethods,
+	},
+	{
+		section:   "secrets",
+		message:   "error configuring secret engines",
+		configure: (*vault).configureSecretEngines,
+	},
+}
+
+// namespace returns the Vault Enterprise namespace the client of the helper operates in
+func (v *vault) namespace() string {
+	return strings.Trim(v.cl.Headers().Get(consts.NamespaceHeaderName), "/")
+}
+
+// withNamespace returns a copy of the helper operating in the child namespace of its current namespace
+func (v *vault) withNamespace(name string) (*vault, error) {
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating vault client")
+	}
+
+	cl.SetToken(v.cl.Token())
+	cl.SetHeaders(v.cl.Headers())
+
+	namespace := name
+	if parent := v.namespace(); parent != "" {
+		namespace = parent + "/" + name
+	}
+	cl.SetNamespace(namespace)
+
+	nv := *v
+	nv.cl = cl
+
+	return &nv, nil
+}
+
+// configureNamespaces creates the Vault Enterprise namespaces, then applies the policies, auth methods
+// and secret engines declared within them, and their child namespaces recursively:
+//
+//	namespaces:
+//	  - name: team-a
+//	    policies: [...]
+//	    auth: [...]
+//	    secrets: [...]
+//	    namespaces:
+//	      - name: project-x
+func (v *vault) configureNamespaces(config *viper.Viper) error {
+	namespaces := []map[string]interface{}{}
+	err := config.UnmarshalKey("namespaces", &namespaces)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling vault namespaces config")
+	}
+
+	for _, namespace := range namespaces {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		name, err := cast.ToStringE(namespace["name"])
+		if err != nil {
+			return errors.Wrap(err, "error finding namespace name")
+		}
+		name = strings.Trim(name, "/")
+		if name == "" {
+			return errors.New("namespace name is empty") // nolint:goerr113
+		}
+
+		if err := v.configureNamespace(name, namespace); err != nil {
+			return errors.Wrapf(err, "error configuring namespace %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) configureNamespace(name string, namespace map[string]interface{}) error {
+	existing, err := v.cl.Logical().Read("sys/namespaces/" + name)
+	if err != nil {
+		return errors.Wrap(err, "error reading namespace")
+	}
+
+	if existing == nil {
+		logrus.Infof("creating namespace %s in namespace %q", name, v.namespace())
+
+		if _, err := v.cl.Logical().Write("sys/namespaces/"+name, nil); err != nil {
+			return errors.Wrap(err, "error creating namespace")
+		}
+	}
+
+	nv, err := v.withNamespace(name)
+	if err != nil {
+		return err
+	}
+
+	config := viper.New()
+	if err := config.MergeConfigMap(namespace); err != nil {
+		return errors.Wrap(err, "error reading namespace config")
+	}
+
+	for _, step := range namespaceConfigureSteps {
+		if !config.IsSet(step.section) {
+			continue
+		}
+		if err := step.configure(nv, config); err != nil {
+			return errors.Wrap(err, step.message)
+		}
+	}
+
+	return nv.configureNamespaces(config)
+}
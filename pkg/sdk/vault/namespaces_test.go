@@ -0,0 +1,146 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureNamespaces(t *testing.T) {
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.Header.Get(consts.NamespaceHeaderName)
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/namespaces/team-a":
+			_, _ = w.Write([]byte(`{"data":{"path":"team-a/"}}`))
+			return
+		case "GET /v1/sys/namespaces/project-x":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		case "PUT /v1/sys/namespaces/project-x", "PUT /v1/sys/policies/acl/team", "PUT /v1/sys/policies/acl/project":
+			if r.Header.Get("X-Vault-Token") != "root" {
+				t.Errorf("request without the root token: %s %s", r.Method, r.URL.Path)
+			}
+			requests = append(requests, namespace+" "+r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s in namespace %q", r.Method, r.URL.Path, namespace)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("root")
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+namespaces:
+  - name: team-a
+    policies:
+      - name: team
+        rules: path "secret/*" { capabilities = ["read"] }
+    namespaces:
+      - name: project-x
+        policies:
+          - name: project
+            rules: path "secret/*" { capabilities = ["read"] }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configureNamespaces(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(requests)
+	expected := []string{
+		"team-a PUT /v1/sys/namespaces/project-x",
+		"team-a PUT /v1/sys/policies/acl/team",
+		"team-a/project-x PUT /v1/sys/policies/acl/project",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+}
+
+func TestRotateSecretEngineCredentialsPerNamespace(t *testing.T) {
+	var mu sync.Mutex
+	rotations := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method+" "+r.URL.Path != "PUT /v1/aws/config/rotate-root" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		mu.Lock()
+		rotations[r.Header.Get(consts.NamespaceHeaderName)]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}, rotateCache: newRotationCache()}
+	nv, err := v.withNamespace("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the copies share the cache and may rotate concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		for _, helper := range []*vault{v, nv} {
+			wg.Add(1)
+			go func(helper *vault) {
+				defer wg.Done()
+				if err := helper.rotateSecretEngineCredentials("aws", "aws", "", "aws/config/root"); err != nil {
+					t.Error(err)
+				}
+			}(helper)
+		}
+	}
+	wg.Wait()
+
+	if rotations[""] != 1 || rotations["team-a"] != 1 {
+		t.Errorf("the credentials should be rotated once per namespace: %v", rotations)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configureOIDCProvider configures Vault as an OIDC identity provider from the identity.oidc block. The items are
+// written in dependency order (keys, scopes, assignments, clients, providers), and the entities, groups and clients
+// can be referenced by their names, which are resolved to their IDs:
+//
+//	identity:
+//	  oidc:
+//	    keys:
+//	      - name: apps
+//	        rotation_period: 24h
+//	        allowed_clients: [argocd]
+//	    scopes:
+//	      - name: groups
+//	        template: '{"groups": {{identity.entity.groups.names}}}'
+//	    assignments:
+//	      - name: developers
+//	        groups: [developers]
+//	    clients:
+//	      - name: argocd
+//	        key: apps
+//	        redirect_uris: [https://argocd.example.com/auth/callback]
+//	        assignments: [developers]
+//	    providers:
+//	      - name: default
+//	        allowed_clients: [argocd]
+//	        scopes_supported: [groups]
+func (v *vault) configureOIDCProvider(config *viper.Viper) error {
+	oidc := map[string][]map[string]interface{}{}
+	err := config.UnmarshalKey("identity.oidc", &oidc)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling vault oidc provider config")
+	}
+
+	// the keys are written again with their allowed clients after the clients have been created
+	for _, key := range oidc["keys"] {
+		data := withoutKeys(key, "name", "allowed_clients")
+		if err := v.writeOIDCItem("key", key, data); err != nil {
+			return err
+		}
+	}
+
+	for _, scope := range oidc["scopes"] {
+		if err := v.writeOIDCItem("scope", scope, withoutKeys(scope, "name")); err != nil {
+			return err
+		}
+	}
+
+	for _, assignment := range oidc["assignments"] {
+		data := withoutKeys(assignment, "name", "entities", "groups")
+
+		entityIDs := cast.ToStringSlice(data["entity_ids"])
+		for _, entity := range cast.ToStringSlice(assignment["entities"]) {
+			id, err := v.identityEntityID(entity)
+			if err != nil {
+				return err
+			}
+			entityIDs = append(entityIDs, id)
+		}
+		data["entity_ids"] = entityIDs
+
+		groupIDs := cast.ToStringSlice(data["group_ids"])
+		for _, group := range cast.ToStringSlice(assignment["groups"]) {
+			id, err := getVaultGroupID(group, v.cl)
+			if err != nil {
+				return errors.Wrapf(err, "error finding group %s of oidc assignment %s", group, assignment["name"])
+			}
+			groupIDs = append(groupIDs, id)
+		}
+		data["group_ids"] = groupIDs
+
+		if err := v.writeOIDCItem("assignment", assignment, data); err != nil {
+			return err
+		}
+	}
+
+	for _, client := range oidc["clients"] {
+		if err := v.writeOIDCItem("client", client, withoutKeys(client, "name")); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range oidc["keys"] {
+		if _, ok := key["allowed_clients"]; !ok {
+			continue
+		}
+
+		data := withoutKeys(key, "name", "allowed_clients")
+		if data["allowed_client_ids"], err = v.oidcClientIDs(key["allowed_clients"], data["allowed_client_ids"]); err != nil {
+			return err
+		}
+		if err := v.writeOIDCItem("key", key, data); err != nil {
+			return err
+		}
+	}
+
+	for _, provider := range oidc["providers"] {
+		data := withoutKeys(provider, "name", "allowed_clients")
+		if _, ok := provider["allowed_clients"]; ok {
+			if data["allowed_client_ids"], err = v.oidcClientIDs(provider["allowed_clients"], data["allowed_client_ids"]); err != nil {
+				return err
+			}
+		}
+		if err := v.writeOIDCItem("provider", provider, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withoutKeys returns a copy of the item without the keys
+func withoutKeys(item map[string]interface{}, keys ...string) map[string]interface{} {
+	data := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		data[key] = value
+	}
+	for _, key := range keys {
+		delete(data, key)
+	}
+	return data
+}
+
+func (v *vault) writeOIDCItem(kind string, item, data map[string]interface{}) error {
+	if err := v.progressStep(); err != nil {
+		return err
+	}
+
+	name, err := cast.ToStringE(item["name"])
+	if err != nil || name == "" {
+		return errors.Errorf("oidc %s without a name", kind)
+	}
+
+	logrus.Debugf("writing oidc %s: %s", kind, name)
+
+	_, err = v.cl.Logical().Write(fmt.Sprintf("identity/oidc/%s/%s", kind, name), data)
+	if err != nil {
+		return errors.Wrapf(err, "error writing oidc %s %s", kind, name)
+	}
+
+	return nil
+}
+
+func (v *vault) identityEntityID(name string) (string, error) {
+	entity, err := v.cl.Logical().Read(fmt.Sprintf("identity/entity/name/%s", name))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read entity %s", name)
+	}
+	if entity == nil {
+		return "", errors.Errorf("entity %s does not exist", name)
+	}
+	return cast.ToString(entity.Data["id"]), nil
+}
+
+// oidcClientIDs resolves the names of the clients to their generated client IDs, "*" allows every client
+func (v *vault) oidcClientIDs(names, clientIDs interface{}) ([]string, error) {
+	ids := cast.ToStringSlice(clientIDs)
+	for _, name := range cast.ToStringSlice(names) {
+		if name == "*" {
+			ids = append(ids, name)
+			continue
+		}
+
+		client, err := v.cl.Logical().Read(fmt.Sprintf("identity/oidc/client/%s", name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read oidc client %s", name)
+		}
+		if client == nil {
+			return nil, errors.Errorf("oidc client %s does not exist", name)
+		}
+		ids = append(ids, cast.ToString(client.Data["client_id"]))
+	}
+	return ids, nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureOIDCProvider(t *testing.T) {
+	var writes []string
+	bodies := map[string]map[string]interface{}{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+		switch r.Method {
+		case http.MethodPut:
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			writes = append(writes, path)
+			bodies[path] = body
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			var response interface{}
+			switch path {
+			case "identity/group/name/developers":
+				response = map[string]interface{}{"data": map[string]interface{}{"id": "developers-id"}}
+			case "identity/oidc/client/argocd":
+				response = map[string]interface{}{"data": map[string]interface{}{"client_id": "argocd-client-id"}}
+			default:
+				t.Errorf("unexpected read: %s", path)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(response)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+identity:
+  oidc:
+    keys:
+      - name: apps
+        allowed_clients: [argocd]
+    scopes:
+      - name: groups
+        template: '{"groups": {{identity.entity.groups.names}}}'
+    assignments:
+      - name: developers
+        groups: [developers]
+    clients:
+      - name: argocd
+        key: apps
+        assignments: [developers]
+    providers:
+      - name: default
+        allowed_clients: ["*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configureOIDCProvider(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"identity/oidc/key/apps",
+		"identity/oidc/scope/groups",
+		"identity/oidc/assignment/developers",
+		"identity/oidc/client/argocd",
+		"identity/oidc/key/apps",
+		"identity/oidc/provider/default",
+	}
+	if strings.Join(writes, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected writes %v, got %v", expected, writes)
+	}
+
+	if ids := bodies["identity/oidc/key/apps"]["allowed_client_ids"]; len(ids.([]interface{})) != 1 || ids.([]interface{})[0] != "argocd-client-id" {
+		t.Errorf("unexpected allowed client IDs of the key: %v", ids)
+	}
+	if ids := bodies["identity/oidc/assignment/developers"]["group_ids"]; len(ids.([]interface{})) != 1 || ids.([]interface{})[0] != "developers-id" {
+		t.Errorf("unexpected group IDs of the assignment: %v", ids)
+	}
+	if _, ok := bodies["identity/oidc/provider/default"]["allowed_clients"]; ok {
+		t.Error("client names must not be sent to vault")
+	}
+}
@@ -17,18 +17,19 @@ package vault
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"emperror.dev/errors"
 	"github.com/hashicorp/hcl"
 	hclPrinter "github.com/hashicorp/hcl/hcl/printer"
 	"github.com/hashicorp/vault/api"
-	"github.com/hashicorp/vault/sdk/helper/consts"
 	json "github.com/json-iterator/go"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sirupsen/logrus"
@@ -37,6 +38,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 	crconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/banzaicloud/bank-vaults/pkg/sdk/metrics"
 )
 
 // DefaultConfigFile is the name of the default config file
@@ -59,14 +62,72 @@ type Config struct {
 	SecretShares int
 	// how many of these parts are needed to unseal Vault (secretThreshold <= secretShares)
 	SecretThreshold int
+	// how many recovery key parts exist with auto-unseal seals, defaults to SecretShares
+	RecoveryShares int
+	// how many of the recovery key parts are needed (recoveryThreshold <= recoveryShares), defaults to SecretThreshold
+	RecoveryThreshold int
+	// how many of the key parts are stored by the seal, for the seals which need it (HSM)
+	StoredShares int
+
+	// the base64 encoded PGP public keys (one per share) the unseal keys are encrypted with at init,
+	// the encrypted keys are stored under vault-unseal-pgp-<n>, bank-vaults can't unseal with them
+	PGPKeys []string
+	// the base64 encoded PGP public keys (one per recovery share) the recovery keys are encrypted with at init,
+	// the encrypted keys are stored under vault-recovery-pgp-<n>
+	RecoveryPGPKeys []string
 
 	// if this root token is set, the dynamic generated will be invalidated and this created instead
 	InitRootToken string
 	// should the root token be stored in the keyStore
 	StoreRootToken bool
+	// if set, the root token is response-wrapped with this TTL and the wrapping token is stored
+	// in the keyStore under vault-root-wrapped instead of the root token itself,
+	// Vault has to be unsealed for this, so it can't be used with PGP encrypted unseal keys
+	WrapRootTokenTTL time.Duration
 
 	// should the KV backend be tested first to validate access rights
 	PreFlightChecks bool
+
+	// if set, a file audit device is enabled with this file path right after init, before any other operation,
+	// use "stdout" to write the audit log to the standard output of Vault, Vault has to be unsealed for this,
+	// so it can't be used with PGP encrypted unseal keys
+	InitAuditFilePath string
+
+	// should the KV backend be locked during destructive operations to prevent concurrent writers
+	LockKeyStore bool
+	// how long the KV backend lock is held at most, defaults to 5 minutes
+	KeyStoreLockTTL time.Duration
+
+	// the cache of the seal status, DefaultSealStatusCache (disabled by default) is used if not set
+	SealStatusCache *SealStatusCache
+
+	// how often the progress of the configuration sections is logged, defaults to 30 seconds
+	ConfigureHeartbeat time.Duration
+	// timeouts of the configuration sections (auth, policies, plugins, secrets, audit, startupSecrets, groups, mfa)
+	ConfigureSectionTimeouts map[string]time.Duration
+	// called on the start, heartbeat and end of every configuration section
+	ConfigureProgressHook func(ConfigureProgress)
+	// how many independent configuration sections are applied at the same time, defaults to 1 (serially)
+	ConfigureConcurrency int
+	// should the applied changes be rolled back if the configuration fails midway (best-effort)
+	ConfigureRollback bool
+	// should the configuration be validated with a dry run first, it is not applied if a section of it fails
+	ConfigureDryRunValidation bool
+	// the Vault Enterprise namespace the configuration is applied to first, it is not applied if that fails
+	ConfigureCanaryNamespace string
+
+	// called after Vault has been initialized, not called if Vault was initialized already
+	InitHook func()
+
+	// records the metrics of the configuration, they are dropped if not set
+	Metrics metrics.Recorder
+
+	// called with the status of the Vault Enterprise license after the license section has been applied
+	LicenseHook func(LicenseStatus)
+
+	// resolves the valueFrom references of the configuration, the Secrets and ConfigMaps
+	// of the namespace of Vault are read if not set
+	ValueResolver ValueResolver
 }
 
 // vault is an implementation of the Vault interface that will perform actions
@@ -75,24 +136,73 @@ type vault struct {
 	keyStore    KVService
 	cl          *api.Client
 	config      *Config
-	rotateCache map[string]bool
+	rotateCache *rotationCache
+	progress    *sectionProgress
+	// the configuration is applied to the canary namespace, without the configs with rotated credentials
+	canary bool
 }
 
 // Interface check
 var _ Vault = &vault{}
 
+// rotationCache records the credential rotations done by a helper and its copies, which may configure
+// namespaces concurrently, so the paths are recorded together with their namespace
+type rotationCache struct {
+	mu      sync.Mutex
+	rotated map[string]bool
+}
+
+func newRotationCache() *rotationCache {
+	return &rotationCache{rotated: map[string]bool{}}
+}
+
+// markRotated records the rotation of the path in the namespace and reports if it was recorded already
+func (c *rotationCache) markRotated(namespace, path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := namespace + "|" + path
+	if c.rotated[key] {
+		return true
+	}
+	c.rotated[key] = true
+	return false
+}
+
+// forget removes the rotation of the path in the namespace, so it is retried
+func (c *rotationCache) forget(namespace, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.rotated, namespace+"|"+path)
+}
+
 // Vault is an interface that can be used to attempt to perform actions against
 // a Vault server.
 type Vault interface {
 	Init() error
 	RaftInitialized() (bool, error)
 	RaftJoin(string) error
+	RaftPeers() ([]RaftPeer, error)
+	RaftRemovePeer(id string) error
+	RaftAutopilotConfigure(config map[string]interface{}) error
+	Initialized() (bool, error)
 	Sealed() (bool, error)
 	Active() (bool, error)
 	Unseal() error
+	Seal() error
 	Leader() (bool, error)
 	Configure(config *viper.Viper) error
+	ConfigureDryRun(config *viper.Viper) (*ConfigureDiff, error)
 	StepDownActive(string) error
+	Rekey(dryRun bool) error
+	RotateRoot() error
+	MigrateSeal() error
+	RaftSnapshot(w io.Writer) (int64, error)
+	RaftSnapshotRestore(snapshot io.Reader) error
+	VerifyReadable(paths []string) error
+	AuthMountAccessor(path string) (string, error)
+	ReplicationSecondaryToken(replicationType, id string, ttl time.Duration) (string, error)
 }
 
 //
@@ -101,6 +211,20 @@ type KVService interface {
 	Get(key string) ([]byte, error)
 }
 
+// kvLocker is implemented by the KV backends which support advisory locking
+type kvLocker interface {
+	Lock(name string, ttl time.Duration) (func() error, error)
+}
+
+// errKVLockingNotSupported is the kv.ErrLockingNotSupported sentinel of the KV backends, which
+// is returned by the wrappers when the backend they wrap doesn't support locking
+const errKVLockingNotSupported = errors.Sentinel("locking is not supported by the key-value store")
+
+// kvDeleter is implemented by the KV backends which support deleting keys
+type kvDeleter interface {
+	Delete(key string) error
+}
+
 type kvTester struct {
 	Service KVService
 }
@@ -123,16 +247,57 @@ func New(k KVService, cl *api.Client, config Config) (Vault, error) {
 		return nil, errors.Errorf("the secret threshold can't be bigger than the shares [%d < %d]", config.SecretShares, config.SecretThreshold)
 	}
 
+	if config.RecoveryShares == 0 {
+		config.RecoveryShares = config.SecretShares
+	}
+	if config.RecoveryThreshold == 0 {
+		config.RecoveryThreshold = config.SecretThreshold
+	}
+	if config.RecoveryShares < config.RecoveryThreshold {
+		return nil, errors.Errorf("the recovery threshold can't be bigger than the shares [%d < %d]", config.RecoveryShares, config.RecoveryThreshold)
+	}
+
+	if len(config.PGPKeys) > 0 && len(config.PGPKeys) != config.SecretShares {
+		return nil, errors.Errorf("the number of PGP keys has to match the secret shares [%d != %d]", len(config.PGPKeys), config.SecretShares)
+	}
+	if len(config.RecoveryPGPKeys) > 0 && len(config.RecoveryPGPKeys) != config.RecoveryShares {
+		return nil, errors.Errorf("the number of recovery PGP keys has to match the recovery shares [%d != %d]", len(config.RecoveryPGPKeys), config.RecoveryShares)
+	}
+
+	// bank-vaults can't unseal with PGP encrypted keys, so init would wait forever for an external unseal
+	if len(config.PGPKeys) > 0 && config.InitAuditFilePath != "" {
+		return nil, errors.New("the init audit device can't be enabled with PGP encrypted unseal keys") // nolint:goerr113
+	}
+	if len(config.PGPKeys) > 0 && config.WrapRootTokenTTL > 0 {
+		return nil, errors.New("the root token can't be wrapped with PGP encrypted unseal keys") // nolint:goerr113
+	}
+
+	if config.SealStatusCache == nil {
+		config.SealStatusCache = DefaultSealStatusCache
+	}
+
+	if config.KeyStoreLockTTL == 0 {
+		config.KeyStoreLockTTL = 5 * time.Minute
+	}
+
 	return &vault{
 		keyStore:    k,
 		cl:          cl,
 		config:      &config,
-		rotateCache: map[string]bool{},
+		rotateCache: newRotationCache(),
 	}, nil
 }
 
+func (v *vault) Initialized() (bool, error) {
+	resp, err := v.config.SealStatusCache.SealStatus(v.cl)
+	if err != nil {
+		return false, errors.Wrap(err, "error checking status")
+	}
+	return resp.Initialized, nil
+}
+
 func (v *vault) Sealed() (bool, error) {
-	resp, err := v.cl.Sys().SealStatus()
+	resp, err := v.config.SealStatusCache.SealStatus(v.cl)
 	if err != nil {
 		return false, errors.Wrap(err, "error checking status")
 	}
@@ -168,6 +333,7 @@ func (v *vault) Leader() (bool, error) {
 // was invalid.
 func (v *vault) Unseal() error {
 	defer runtime.GC()
+	defer v.config.SealStatusCache.Invalidate(v.cl.Address())
 	for i := 0; ; i++ {
 		keyID := v.unsealKeyForID(i)
 
@@ -198,6 +364,24 @@ func (v *vault) Unseal() error {
 	}
 }
 
+// Seal seals vault with the client token, or with the root token from the key store if the client has none.
+// It does nothing if vault is sealed already.
+func (v *vault) Seal() error {
+	defer v.config.SealStatusCache.Invalidate(v.cl.Address())
+
+	status, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return errors.Wrap(err, "error checking status")
+	}
+	if status.Sealed {
+		return nil
+	}
+
+	return v.withRootToken(func() error {
+		return errors.Wrap(v.cl.Sys().Seal(), "error sealing vault")
+	})
+}
+
 type notFoundError interface {
 	NotFound() bool
 }
@@ -229,8 +413,45 @@ func (v *vault) keyStoreSet(key string, val []byte) error {
 	}
 }
 
+// lockKeyStore acquires the named lock of the key store if locking is enabled,
+// the key stores which don't support locking are used without the lock
+func (v *vault) lockKeyStore(name string) (func() error, error) {
+	noop := func() error { return nil }
+
+	if !v.config.LockKeyStore {
+		return noop, nil
+	}
+
+	locker, ok := v.keyStore.(kvLocker)
+	if !ok {
+		logrus.Warnf("the key store doesn't support locking, %s runs without the lock", name)
+		return noop, nil
+	}
+
+	unlock, err := locker.Lock(name, v.config.KeyStoreLockTTL)
+	if errors.Is(err, errKVLockingNotSupported) {
+		logrus.Warnf("the key store doesn't support locking, %s runs without the lock", name)
+		return noop, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error locking key store for %s", name)
+	}
+
+	return unlock, nil
+}
+
 // Init initializes Vault if is not initialized already
 func (v *vault) Init() error {
+	unlock, err := v.lockKeyStore("init")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			logrus.Warnf("error unlocking key store: %s", err.Error())
+		}
+	}()
+
 	initialized, err := v.cl.Sys().InitStatus()
 	if err != nil {
 		return errors.Wrap(err, "error testing if vault is initialized")
@@ -254,11 +475,17 @@ func (v *vault) Init() error {
 	// test for an existing keys
 	keys := []string{
 		v.rootTokenKey(),
+		v.wrappedRootTokenKey(),
 	}
 
 	// add unseal keys
 	for i := 0; i <= v.config.SecretShares; i++ {
-		keys = append(keys, v.unsealKeyForID(i))
+		keys = append(keys, v.unsealKeyForID(i), v.unsealPGPKeyForID(i))
+	}
+
+	// add recovery keys
+	for i := 0; i <= v.config.RecoveryShares; i++ {
+		keys = append(keys, v.recoveryKeyForID(i), v.recoveryPGPKeyForID(i))
 	}
 
 	// test every key
@@ -274,16 +501,28 @@ func (v *vault) Init() error {
 	resp, err := v.cl.Sys().Init(&api.InitRequest{
 		SecretShares:      v.config.SecretShares,
 		SecretThreshold:   v.config.SecretThreshold,
-		RecoveryShares:    v.config.SecretShares,
-		RecoveryThreshold: v.config.SecretThreshold,
+		StoredShares:      v.config.StoredShares,
+		PGPKeys:           v.config.PGPKeys,
+		RecoveryShares:    v.config.RecoveryShares,
+		RecoveryThreshold: v.config.RecoveryThreshold,
+		RecoveryPGPKeys:   v.config.RecoveryPGPKeys,
 	})
 
 	if err != nil {
 		return errors.Wrap(err, "error initializing vault")
 	}
 
+	// the keys encrypted with PGP keys are stored apart from the ones bank-vaults unseals with
+	unsealKeyForID, recoveryKeyForID := v.unsealKeyForID, v.recoveryKeyForID
+	if len(v.config.PGPKeys) > 0 {
+		unsealKeyForID = v.unsealPGPKeyForID
+	}
+	if len(v.config.RecoveryPGPKeys) > 0 {
+		recoveryKeyForID = v.recoveryPGPKeyForID
+	}
+
 	for i, k := range resp.Keys {
-		keyID := v.unsealKeyForID(i)
+		keyID := unsealKeyForID(i)
 		err := v.keyStoreSet(keyID, []byte(k))
 
 		if err != nil {
@@ -294,7 +533,7 @@ func (v *vault) Init() error {
 	}
 
 	for i, k := range resp.RecoveryKeys {
-		keyID := v.recoveryKeyForID(i)
+		keyID := recoveryKeyForID(i)
 		err := v.keyStoreSet(keyID, []byte(k))
 
 		if err != nil {
@@ -306,6 +545,16 @@ func (v *vault) Init() error {
 
 	rootToken := resp.RootToken
 
+	// bank-vaults can unseal a Shamir sealed Vault with the stored keys, unless they are encrypted
+	shamir := len(resp.Keys) > 0 && len(v.config.PGPKeys) == 0
+
+	if v.config.InitAuditFilePath != "" {
+		err = v.enableInitAuditDevice(resp.RootToken, shamir)
+		if err != nil {
+			return errors.Wrap(err, "error enabling audit device after init")
+		}
+	}
+
 	// this sets up a predefined root token
 	if v.config.InitRootToken != "" {
 		logrus.Info("setting up init root token, waiting for vault to be unsealed")
@@ -350,7 +599,17 @@ func (v *vault) Init() error {
 		rootToken = v.config.InitRootToken
 	}
 
-	if v.config.StoreRootToken {
+	if v.config.WrapRootTokenTTL > 0 {
+		wrappingToken, err := v.wrapRootToken(rootToken, shamir)
+		if err != nil {
+			return errors.Wrap(err, "error wrapping root token")
+		}
+		wrappedRootTokenKey := v.wrappedRootTokenKey()
+		if err = v.keyStoreSet(wrappedRootTokenKey, []byte(wrappingToken)); err != nil {
+			return errors.Wrapf(err, "error storing wrapped root token in key '%s'", wrappedRootTokenKey)
+		}
+		logrus.WithField("key", wrappedRootTokenKey).Infof("root token wrapped for %s and stored in key store", v.config.WrapRootTokenTTL)
+	} else if v.config.StoreRootToken {
 		rootTokenKey := v.rootTokenKey()
 		if err = v.keyStoreSet(rootTokenKey, []byte(resp.RootToken)); err != nil {
 			return errors.Wrapf(err, "error storing root token '%s' in key'%s'", rootToken, rootTokenKey)
@@ -360,22 +619,108 @@ func (v *vault) Init() error {
 		logrus.WithField("root-token", resp.RootToken).Warnf("won't store root token in key store, this token grants full privileges to vault, so keep this secret")
 	}
 
+	if v.config.InitHook != nil {
+		v.config.InitHook()
+	}
+
 	return nil
 }
 
-// in our case Vault is initialized when root key is stored in the Cloud KMS
-func (v *vault) RaftInitialized() (bool, error) {
-	rootToken, err := v.keyStore.Get(v.rootTokenKey())
+// enableInitAuditDevice enables a file audit device with the fresh root token, so that the first
+// root token operations are audited already. Vault has to be unsealed for this, with Shamir seals
+// it is unsealed with the stored keys, with auto-unseal it is waited for.
+func (v *vault) enableInitAuditDevice(rootToken string, shamir bool) error {
+	if err := v.waitUnsealed(shamir, "enable the audit device"); err != nil {
+		return err
+	}
+
+	v.cl.SetToken(rootToken)
+	defer v.cl.SetToken("")
+
+	// the default path of file audit devices, so configuring a file audit device later doesn't enable a second one
+	path := "file"
+
+	err := v.cl.Sys().EnableAuditWithOptions(path, &api.EnableAuditOptions{
+		Type:        "file",
+		Description: "audit device enabled by bank-vaults at init",
+		Options:     map[string]string{"file_path": v.config.InitAuditFilePath},
+	})
 	if err != nil {
-		if isNotFoundError(err) {
-			return false, nil
+		return errors.Wrapf(err, "error enabling audit device %s in vault", path)
+	}
+
+	logrus.Infof("mounted file audit device to %s with file path %s", path, v.config.InitAuditFilePath)
+
+	return nil
+}
+
+// waitUnsealed waits for Vault to be unsealed, with Shamir seals it is unsealed with the stored keys
+func (v *vault) waitUnsealed(shamir bool, purpose string) error {
+	for {
+		sealed, err := v.Sealed()
+		if err == nil && !sealed {
+			return nil
 		}
 
-		return false, errors.Wrapf(err, "unable to get key '%s'", v.rootTokenKey())
+		if err == nil && shamir {
+			if err := v.Unseal(); err != nil {
+				return errors.Wrap(err, "error unsealing vault")
+			}
+			continue
+		}
+
+		if err == nil {
+			logrus.Infof("vault still sealed, wait for unsealing to %s", purpose)
+		} else {
+			logrus.Infof("vault not reachable: %s", err.Error())
+		}
+
+		time.Sleep(2 * time.Second)
 	}
+}
 
-	if len(rootToken) > 0 {
-		return true, nil
+// wrapRootToken response-wraps the root token with the configured TTL and returns the wrapping token,
+// so the root token itself never gets stored, it can be unwrapped once with "vault unwrap"
+func (v *vault) wrapRootToken(rootToken string, shamir bool) (string, error) {
+	if err := v.waitUnsealed(shamir, "wrap the root token"); err != nil {
+		return "", err
+	}
+
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return "", errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetToken(rootToken)
+	cl.SetWrappingLookupFunc(func(string, string) string {
+		return v.config.WrapRootTokenTTL.String()
+	})
+
+	secret, err := cl.Logical().Write("sys/wrapping/wrap", map[string]interface{}{"token": rootToken})
+	if err != nil {
+		return "", errors.Wrap(err, "error wrapping root token")
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", errors.New("vault returned no wrapping token") // nolint:goerr113
+	}
+
+	return secret.WrapInfo.Token, nil
+}
+
+// in our case Vault is initialized when root key (or the wrapped root key) is stored in the Cloud KMS
+func (v *vault) RaftInitialized() (bool, error) {
+	for _, key := range []string{v.rootTokenKey(), v.wrappedRootTokenKey()} {
+		rootToken, err := v.keyStore.Get(key)
+		if err != nil {
+			if isNotFoundError(err) {
+				continue
+			}
+
+			return false, errors.Wrapf(err, "unable to get key '%s'", key)
+		}
+
+		if len(rootToken) > 0 {
+			return true, nil
+		}
 	}
 
 	return false, nil
@@ -436,16 +781,19 @@ func (v *vault) StepDownActive(address string) error {
 	defer v.cl.SetToken("")
 	defer func() { rootToken = nil }()
 
-	tmpClient, err := api.NewClient(nil)
+	// the address is set in the config, so unix domain socket addresses are dialed as such
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return errors.Wrap(config.Error, "unable to create temporary client")
+	}
+	config.Address = ConfigAddress(address)
+
+	tmpClient, err := api.NewClient(config)
 	if err != nil {
 		return errors.Wrap(err, "unable to create temporary client")
 	}
 
 	tmpClient.SetToken(string(rootToken))
-	err = tmpClient.SetAddress(address)
-	if err != nil {
-		return errors.Wrap(err, "unable to set address of client")
-	}
 
 	return tmpClient.Sys().StepDown()
 }
@@ -465,42 +813,19 @@ func (v *vault) Configure(config *viper.Viper) error {
 	defer v.cl.SetToken("")
 	defer func() { rootToken = nil }()
 
-	err = v.configureAuthMethods(config)
-	if err != nil {
-		return errors.Wrap(err, "error configuring auth methods for vault")
-	}
-
-	err = v.configurePolicies(config)
-	if err != nil {
-		return errors.Wrap(err, "error configuring policies for vault")
-	}
-
-	err = v.configurePlugins(config)
-	if err != nil {
-		return errors.Wrap(err, "error configuring plugins for vault")
-	}
-
-	err = v.configureSecretEngines(config)
-	if err != nil {
-		return errors.Wrap(err, "error configuring secret engines for vault")
-	}
-
-	err = v.configureAuditDevices(config)
-	if err != nil {
-		return errors.Wrap(err, "error configuring audit devices for vault")
+	if err := v.resolveConfigValueReferences(config); err != nil {
+		return err
 	}
 
-	err = v.configureStartupSecrets(config)
-	if err != nil {
-		return errors.Wrap(err, "error writing startup secrets to vault")
+	if err := v.configureCanary(config); err != nil {
+		return err
 	}
 
-	err = v.configureIdentityGroups(config)
-	if err != nil {
-		return errors.Wrap(err, "error writing groups configurations for vault")
+	if v.config.ConfigureRollback {
+		return v.configureWithRollback(config)
 	}
 
-	return err
+	return v.applyConfigureSteps(config, configureSteps, v.config.ConfigureConcurrency)
 }
 
 func (*vault) unsealKeyForID(i int) string {
@@ -511,10 +836,22 @@ func (*vault) recoveryKeyForID(i int) string {
 	return fmt.Sprint("vault-recovery-", i)
 }
 
+func (*vault) unsealPGPKeyForID(i int) string {
+	return fmt.Sprint("vault-unseal-pgp-", i)
+}
+
+func (*vault) recoveryPGPKeyForID(i int) string {
+	return fmt.Sprint("vault-recovery-pgp-", i)
+}
+
 func (*vault) rootTokenKey() string {
 	return "vault-root"
 }
 
+func (*vault) wrappedRootTokenKey() string {
+	return "vault-root-wrapped"
+}
+
 func (*vault) testKey() string {
 	return "vault-test"
 }
@@ -549,6 +886,10 @@ func (v *vault) configureAuthMethods(config *viper.Viper) error {
 	}
 
 	for _, authMethod := range authMethods {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		authMethodType, err := cast.ToStringE(authMethod["type"])
 		if err != nil {
 			return errors.Wrap(err, "error finding auth method type")
@@ -580,6 +921,12 @@ func (v *vault) configureAuthMethods(config *viper.Viper) error {
 			}
 		}
 
+		// the token auth method is always mounted at token/, it can be tuned only
+		if authMethodType == "token" {
+			path = "token"
+			exists = true
+		}
+
 		// get auth mount options
 		// https://www.vaultproject.io/api/system/auth.html#config
 		var authConfigInput api.AuthConfigInput
@@ -741,6 +1088,10 @@ func (v *vault) configureAuthMethods(config *viper.Viper) error {
 				return errors.Wrapf(err, "error configuring %s roles on path %s for vault", authMethodType, path)
 			}
 		case "token":
+			// the token auth method may be declared for tuning its mount only
+			if _, ok := authMethod["roles"]; !ok {
+				break
+			}
 			roles, err := cast.ToSliceE(authMethod["roles"])
 			if err != nil {
 				return errors.Wrap(err, "error finding roles block for token")
@@ -816,11 +1167,15 @@ func (v *vault) configureAuthMethods(config *viper.Viper) error {
 		}
 	}
 
+	if purgeUnmanaged(config, "auth") {
+		return v.purgeUnmanagedAuthMethods(authMethods)
+	}
+
 	return nil
 }
 
 func (v *vault) configurePolicies(config *viper.Viper) error {
-	policies := []map[string]string{}
+	policies := []map[string]interface{}{}
 
 	err := config.UnmarshalKey("policies", &policies)
 	if err != nil {
@@ -828,19 +1183,34 @@ func (v *vault) configurePolicies(config *viper.Viper) error {
 	}
 
 	for _, policy := range policies {
-		policyName := policy["name"]
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		policyName := cast.ToString(policy["name"])
+		rules := cast.ToString(policy["rules"])
+
+		if policyType := policyType(policy); policyType != "acl" {
+			if !isSentinelPolicyType(policyType) {
+				return errors.Errorf("unsupported type of %s policy: %s", policyName, policyType)
+			}
+			if err := v.configureSentinelPolicy(policyType, policyName, policy); err != nil {
+				return err
+			}
+			continue
+		}
 
 		// Try to format rules (HCL only)
-		policyRules, err := hclPrinter.Format([]byte(policy["rules"]))
+		policyRules, err := hclPrinter.Format([]byte(rules))
 		if err != nil {
 			// Check if rules parse (HCL or JSON)
-			_, parseErr := hcl.Parse(policy["rules"])
+			_, parseErr := hcl.Parse(rules)
 			if parseErr != nil {
 				return errors.Wrapf(err, "error parsing %s policy rules", policyName)
 			}
 
 			// Policies are parsable but couldn't be HCL formatted (most likely JSON)
-			policyRules = []byte(policy["rules"])
+			policyRules = []byte(rules)
 			logrus.Debugf("error HCL-formatting %s policy rules (ignore if rules are JSON-formatted): %s", policyName, err.Error())
 		}
 
@@ -850,6 +1220,10 @@ func (v *vault) configurePolicies(config *viper.Viper) error {
 		}
 	}
 
+	if purgeUnmanaged(config, "policies") {
+		return v.purgeUnmanagedPolicies(policies)
+	}
+
 	return nil
 }
 
@@ -888,6 +1262,10 @@ func (v *vault) configureAwsConfig(path string, config map[string]interface{}) e
 // https://www.vaultproject.io/api/auth/token/index.html
 func (v *vault) configureGenericAuthRoles(method, path, roleSubPath string, roles []interface{}) error {
 	for _, roleInterface := range roles {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		role, err := cast.ToStringMapE(roleInterface)
 		if err != nil {
 			return errors.Wrapf(err, "error converting roles for %s", method)
@@ -903,21 +1281,39 @@ func (v *vault) configureGenericAuthRoles(method, path, roleSubPath string, role
 
 func (v *vault) configureUserpassUsers(path string, users []interface{}) error {
 	for _, userRaw := range users {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		user, err := cast.ToStringMapE(userRaw)
 		if err != nil {
 			return errors.Wrapf(err, "error converting user for userpass")
 		}
 
-		_, err = v.cl.Logical().Write(fmt.Sprintf("auth/%s/%s/%s", path, "users", user["username"]), user)
+		data, recordRotation, err := v.prepareUserpassUser(path, user)
+		if err != nil {
+			return err
+		}
+
+		_, err = v.cl.Logical().Write(fmt.Sprintf("auth/%s/%s/%s", path, "users", user["username"]), data)
 		if err != nil {
 			return errors.Wrapf(err, "error putting userpass %s user into vault", user["username"])
 		}
+
+		err = recordRotation()
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (v *vault) configureAWSCrossAccountRoles(path string, crossAccountRoles []interface{}) error {
 	for _, roleInterface := range crossAccountRoles {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		crossAccountRole, err := cast.ToStringMapE(roleInterface)
 		if err != nil {
 			return errors.Wrap(err, "error converting cross account aws roles for aws")
@@ -952,6 +1348,10 @@ func (v *vault) configureGenericAuthConfig(method, path string, config map[strin
 // TODO try to generalize this with configureGenericAuthRoles() fix the type flaw
 func (v *vault) configureJwtRoles(path string, roles []interface{}) error {
 	for _, roleInterface := range roles {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		role, err := cast.ToStringMapE(roleInterface)
 		if err != nil {
 			return errors.Wrap(err, "error converting roles for jwt")
@@ -996,49 +1396,19 @@ func (v *vault) configurePlugins(config *viper.Viper) error {
 		return errors.Wrap(err, "error unmarshalling vault plugins config")
 	}
 
-	listPlugins, err := v.cl.Sys().ListPlugins(&api.ListPluginsInput{})
-	if err != nil {
-		return errors.Wrap(err, "failed to retrieve list of plugins")
-	}
-
-	logrus.Debugf("already registered plugins: %#v", listPlugins.PluginsByType)
-
 	for _, plugin := range plugins {
-		command, err := getOrError(plugin, "command")
-		if err != nil {
-			return errors.Wrap(err, "error getting command for plugin")
-		}
-		pluginName, err := getOrError(plugin, "plugin_name")
-		if err != nil {
-			return errors.Wrap(err, "error getting plugin_name for plugin")
-		}
-		sha256, err := getOrError(plugin, "sha256")
-		if err != nil {
-			return errors.Wrap(err, "error getting sha256 for plugin")
-		}
-		typeRaw, err := getOrError(plugin, "type")
-		if err != nil {
-			return errors.Wrap(err, "error getting type for plugin")
-		}
-		pluginType, err := consts.ParsePluginType(typeRaw)
-		if err != nil {
-			return errors.Wrap(err, "error parsing type for plugin")
-		}
-
-		input := api.RegisterPluginInput{
-			Name:    pluginName,
-			Command: command,
-			SHA256:  sha256,
-			Type:    pluginType,
+		if err := v.progressStep(); err != nil {
+			return err
 		}
-		logrus.Infof("registering plugin with input: %#v", input)
 
-		err = v.cl.Sys().RegisterPlugin(&input)
+		catalogPlugin, err := parseCatalogPlugin(plugin)
 		if err != nil {
-			return errors.Wrapf(err, "error registering plugin %s in vault", pluginName)
+			return err
 		}
 
-		logrus.Infoln("registered plugin", pluginName)
+		if err := v.configurePlugin(catalogPlugin); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1061,6 +1431,10 @@ func (v *vault) configureSecretEngines(config *viper.Viper) error {
 	}
 
 	for _, secretEngine := range secretsEngines {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		secretEngineType, err := cast.ToStringE(secretEngine["type"])
 		if err != nil {
 			return errors.Wrap(err, "error finding type for secret engine")
@@ -1178,6 +1552,12 @@ func (v *vault) configureSecretEngines(config *viper.Viper) error {
 				// Delete the rotate key from the map, so we don't push it to vault
 				delete(subConfigData, "rotate")
 
+				// the credentials of the config may have been rotated by the configuration outside of the canary
+				if rotate && v.canary {
+					logrus.Infof("skipping config %s with rotated credentials in the canary namespace", configPath)
+					continue
+				}
+
 				var dontUpdate = false
 				if (createOnly || rotate) && mountExists {
 					sec, err := v.cl.Logical().Read(configPath)
@@ -1224,6 +1604,15 @@ func (v *vault) configureSecretEngines(config *viper.Viper) error {
 		}
 	}
 
+	// removedSecrets lists the paths of the secret engines to disable, e.g. the ones removed from the config
+	if err := v.removeSecretEngines(secretsEngines, config.GetStringSlice("removedSecrets")); err != nil {
+		return err
+	}
+
+	if purgeUnmanaged(config, "secrets") {
+		return v.purgeUnmanagedSecretEngines(secretsEngines)
+	}
+
 	return nil
 }
 
@@ -1240,17 +1629,17 @@ func (v *vault) rotateSecretEngineCredentials(secretEngineType, path, name, conf
 		return errors.Errorf("secret engine type '%s' doesn't support credential rotation", secretEngineType)
 	}
 
-	if _, ok := v.rotateCache[rotatePath]; !ok {
+	namespace := v.namespace()
+	if !v.rotateCache.markRotated(namespace, rotatePath) {
 		logrus.Infoln("doing credential rotation at", rotatePath)
 
 		_, err := v.cl.Logical().Write(rotatePath, nil)
 		if err != nil {
+			v.rotateCache.forget(namespace, rotatePath)
 			return errors.Wrapf(err, "error rotating credentials for '%s' config in vault", configPath)
 		}
 
 		logrus.Infoln("credential got rotated at", rotatePath)
-
-		v.rotateCache[rotatePath] = true
 	} else {
 		logrus.Infoln("credentials were rotated previously for", rotatePath)
 	}
@@ -1266,6 +1655,10 @@ func (v *vault) configureAuditDevices(config *viper.Viper) error {
 	}
 
 	for _, auditDevice := range auditDevices {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		auditDeviceType, err := cast.ToStringE(auditDevice["type"])
 		if err != nil {
 			return errors.Wrap(err, "error finding type for audit device")
@@ -1288,15 +1681,8 @@ func (v *vault) configureAuditDevices(config *viper.Viper) error {
 		logrus.Infof("already existing audit devices: %#v", mounts)
 
 		if mounts[path+"/"] == nil {
-			var options api.EnableAuditOptions
-			err = mapstructure.Decode(auditDevice, &options)
-			if err != nil {
-				return errors.Wrap(err, "error parsing audit options")
-			}
-			logrus.Infof("enabling audit device with options: %#v", options)
-			err = v.cl.Sys().EnableAuditWithOptions(path, &options)
-			if err != nil {
-				return errors.Wrapf(err, "error enabling audit device %s in vault", path)
+			if err := v.enableAuditDevice(path, auditDevice); err != nil {
+				return err
 			}
 
 			logrus.Infoln("mounted audit device", auditDeviceType, "to", path)
@@ -1305,6 +1691,10 @@ func (v *vault) configureAuditDevices(config *viper.Viper) error {
 		}
 	}
 
+	if purgeUnmanaged(config, "audit") {
+		return v.purgeUnmanagedAuditDevices(auditDevices)
+	}
+
 	return nil
 }
 
@@ -1315,6 +1705,10 @@ func (v *vault) configureStartupSecrets(config *viper.Viper) error {
 		return errors.Wrapf(err, "error decoding data for startup secrets")
 	}
 	for _, startupSecret := range startupSecrets {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		startupSecretType, err := cast.ToStringE(startupSecret["type"])
 		if err != nil {
 			return errors.Wrap(err, "error finding type for startup secret")
@@ -1327,9 +1721,8 @@ func (v *vault) configureStartupSecrets(config *viper.Viper) error {
 				return errors.Wrap(err, "unable to read 'kv' startup secret")
 			}
 
-			_, err = v.cl.Logical().Write(path, data)
-			if err != nil {
-				return errors.Wrapf(err, "error writing data for startup 'kv' secret '%s'", path)
+			if err := v.writeKVStartupSecret(startupSecret, path, data); err != nil {
+				return err
 			}
 
 		case "pki":
@@ -1420,6 +1813,23 @@ func readVaultGroupAlias(id string, client *api.Client) (secret *api.Secret, err
 	return secret, nil
 }
 
+// AuthMountAccessor returns the accessor of the auth method mounted at path. It reads the auth methods with the
+// root token from the key store on a clone of the client, so it can be called while Vault is being configured.
+func (v *vault) AuthMountAccessor(path string) (string, error) {
+	rootToken, err := v.keyStore.Get(v.rootTokenKey())
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get key '%s'", v.rootTokenKey())
+	}
+
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return "", errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetToken(string(rootToken))
+
+	return getVaultAuthMountAccessor(path, cl)
+}
+
 func getVaultAuthMountAccessor(path string, client *api.Client) (accessor string, err error) {
 	path = strings.TrimRight(path, "/") + "/"
 	mounts, err := client.Sys().ListAuth()
@@ -1509,6 +1919,10 @@ func (v *vault) configureIdentityGroups(config *viper.Viper) error {
 	}
 
 	for _, group := range groups {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
 		g, err := readVaultGroup(cast.ToString(group["name"]), v.cl)
 		if err != nil {
 			return errors.Wrap(err, "error reading group")
@@ -0,0 +1,65 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestConfigureTokenAuthMethod(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/auth": {"token/": map[string]interface{}{"type": "token"}},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	err = v.configureAuthMethods(testExternalConfig(t, `
+auth:
+  - type: token
+    path: tokens
+    options:
+      default_lease_ttl: 1h
+      max_lease_ttl: 24h
+  - type: token
+    roles:
+      - name: batch
+        token_type: batch
+        allowed_policies: [reader]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tune := paths["sys/mounts/auth/token/tune"]; tune["default_lease_ttl"] != "1h" || tune["max_lease_ttl"] != "24h" {
+		t.Errorf("the token auth method must be tuned, got %v", tune)
+	}
+	if _, ok := paths["sys/auth/tokens"]; ok {
+		t.Error("the token auth method must not be enabled on another path")
+	}
+	if role := paths["auth/token/roles/batch"]; role["token_type"] != "batch" {
+		t.Errorf("the token role must be written, got %v", role)
+	}
+}
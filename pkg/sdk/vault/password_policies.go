@@ -0,0 +1,119 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configurePasswordPolicies writes the named password policies of the passwordPolicies block, which are
+// referenced by the password_policy option of the secret engines (LDAP, AD, database):
+//
+//	passwordPolicies:
+//	  - name: active-directory
+//	    policy: |
+//	      length = 20
+//	      rule "charset" {
+//	        charset = "abcdefghijklmnopqrstuvwxyz"
+//	        min-chars = 1
+//	      }
+//
+// The policies which are unchanged aren't written again, and with purgeUnmanagedConfig.passwordPolicies
+// the ones which are not configured are deleted (Vault 1.12+ can list them).
+func (v *vault) configurePasswordPolicies(config *viper.Viper) error {
+	passwordPolicies := []map[string]interface{}{}
+	err := config.UnmarshalKey("passwordPolicies", &passwordPolicies)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling password policies config")
+	}
+
+	managed := make(map[string]bool, len(passwordPolicies))
+
+	for _, passwordPolicy := range passwordPolicies {
+		if err := v.progressStep(); err != nil {
+			return err
+		}
+
+		name, err := getOrError(passwordPolicy, "name")
+		if err != nil {
+			return errors.Wrap(err, "error getting name for password policy")
+		}
+		policy, err := getOrError(passwordPolicy, "policy")
+		if err != nil {
+			return errors.Wrapf(err, "error getting policy for password policy %s", name)
+		}
+
+		managed[name] = true
+
+		current, err := v.cl.Logical().Read("sys/policies/password/" + name)
+		if err != nil {
+			return errors.Wrapf(err, "error reading password policy %s", name)
+		}
+		if current != nil && current.Data != nil && strings.TrimSpace(cast.ToString(current.Data["policy"])) == strings.TrimSpace(policy) {
+			logrus.Debugf("password policy %s is unchanged", name)
+			continue
+		}
+
+		// Vault validates the policy by generating a password with it
+		if _, err := v.cl.Logical().Write("sys/policies/password/"+name, map[string]interface{}{"policy": policy}); err != nil {
+			return errors.Wrapf(err, "error putting password policy %s into vault", name)
+		}
+
+		logrus.Infof("password policy %s configured", name)
+	}
+
+	if purgeUnmanaged(config, "passwordPolicies") {
+		return v.purgeUnmanagedPasswordPolicies(managed)
+	}
+
+	return nil
+}
+
+// purgeUnmanagedPasswordPolicies deletes the password policies which are not configured,
+// Vault can list them from 1.12 on, before that nothing is purged
+func (v *vault) purgeUnmanagedPasswordPolicies(managed map[string]bool) error {
+	secret, err := v.cl.Logical().List("sys/policies/password")
+	if err != nil {
+		if respErr, ok := err.(*api.ResponseError); ok && respErr.StatusCode == http.StatusMethodNotAllowed {
+			logrus.Warn("vault can't list the password policies, the unmanaged ones are not purged")
+			return nil
+		}
+		return errors.Wrap(err, "error listing password policies")
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	for _, name := range cast.ToStringSlice(secret.Data["keys"]) {
+		if managed[name] {
+			continue
+		}
+
+		logrus.Infof("deleting unmanaged password policy: %s", name)
+
+		if _, err := v.cl.Logical().Delete("sys/policies/password/" + name); err != nil {
+			return errors.Wrapf(err, "error deleting unmanaged password policy %s", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestConfigurePasswordPolicies(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/policies/password/unchanged": {"policy": "length = 20\n"},
+		"sys/policies/password/changed":   {"policy": "length = 10\n"},
+		"sys/policies/password/unmanaged": {"policy": "length = 8\n"},
+		"sys/policies/password":           {"keys": []interface{}{"unchanged", "changed", "unmanaged"}},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	// the unchanged one is marked, so rewriting it would be noticed
+	paths["sys/policies/password/unchanged"]["marker"] = true
+
+	err = v.configurePasswordPolicies(testExternalConfig(t, `
+passwordPolicies:
+  - name: unchanged
+    policy: length = 20
+  - name: changed
+    policy: length = 24
+  - name: created
+    policy: length = 32
+purgeUnmanagedConfig:
+  passwordPolicies: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := paths["sys/policies/password/unchanged"]["marker"]; !ok {
+		t.Error("the unchanged password policy must not be written again")
+	}
+	if policy := paths["sys/policies/password/changed"]["policy"]; policy != "length = 24" {
+		t.Errorf("the changed password policy must be written, got %v", policy)
+	}
+	if policy := paths["sys/policies/password/created"]["policy"]; policy != "length = 32" {
+		t.Errorf("the new password policy must be written, got %v", policy)
+	}
+	if _, ok := paths["sys/policies/password/unmanaged"]; ok {
+		t.Error("the unmanaged password policy must be deleted")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// catalogPlugin is a plugin of the plugin catalog
+type catalogPlugin struct {
+	name       string
+	pluginType consts.PluginType
+	command    string
+	sha256     string
+	args       []string
+	version    string
+	// reloadScope is sent with the reload request, "global" reloads the plugin on all the nodes of the cluster
+	reloadScope string
+}
+
+func (p *catalogPlugin) catalogPath() string {
+	return "sys/plugins/catalog/" + p.pluginType.String() + "/" + p.name
+}
+
+func parseCatalogPlugin(plugin map[string]interface{}) (*catalogPlugin, error) {
+	command, err := getOrError(plugin, "command")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting command for plugin")
+	}
+	pluginName, err := getOrError(plugin, "plugin_name")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting plugin_name for plugin")
+	}
+	sha256, err := getOrError(plugin, "sha256")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting sha256 for plugin")
+	}
+	typeRaw, err := getOrError(plugin, "type")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting type for plugin")
+	}
+	pluginType, err := consts.ParsePluginType(typeRaw)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing type for plugin")
+	}
+	var args []string
+	if rawArgs, ok := plugin["args"]; ok {
+		args, err = cast.ToStringSliceE(rawArgs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting args for plugin %s", pluginName)
+		}
+	}
+	version, err := getOrDefaultString(plugin, "version")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting version for plugin %s", pluginName)
+	}
+	reloadScope, err := getOrDefaultString(plugin, "reload_scope")
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting reload_scope for plugin %s", pluginName)
+	}
+
+	return &catalogPlugin{
+		name:        pluginName,
+		pluginType:  pluginType,
+		command:     command,
+		sha256:      sha256,
+		args:        args,
+		version:     version,
+		reloadScope: reloadScope,
+	}, nil
+}
+
+// registeredPlugin returns the catalog entry of the plugin, or nil if it isn't registered
+func (v *vault) registeredPlugin(plugin *catalogPlugin) (map[string]interface{}, error) {
+	var query map[string][]string
+	if plugin.version != "" {
+		query = map[string][]string{"version": {plugin.version}}
+	}
+
+	secret, err := v.cl.Logical().ReadWithData(plugin.catalogPath(), query)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return secret.Data, nil
+}
+
+// configurePlugin registers the plugin in the plugin catalog if it isn't registered with the same
+// sha256, command, args (and version). If the plugin has been registered with a different sha256,
+// the plugin is reloaded, so the mounts using it restart with the new binary.
+func (v *vault) configurePlugin(plugin *catalogPlugin) error {
+	registered, err := v.registeredPlugin(plugin)
+	if err != nil {
+		return errors.Wrapf(err, "error reading plugin %s from the plugin catalog", plugin.name)
+	}
+
+	if registered != nil {
+		args, _ := cast.ToStringSliceE(registered["args"])
+		if cast.ToString(registered["sha256"]) == plugin.sha256 &&
+			cast.ToString(registered["command"]) == plugin.command &&
+			sameArgs(args, plugin.args) {
+			logrus.Debugf("plugin %s is registered already", plugin.name)
+			return nil
+		}
+	}
+
+	data := map[string]interface{}{
+		"command": plugin.command,
+		"sha256":  plugin.sha256,
+	}
+	if len(plugin.args) > 0 {
+		data["args"] = plugin.args
+	}
+	if plugin.version != "" {
+		data["version"] = plugin.version
+	}
+
+	logrus.Infof("registering plugin %s with command %s and sha256 %s", plugin.name, plugin.command, plugin.sha256)
+
+	if _, err := v.cl.Logical().Write(plugin.catalogPath(), data); err != nil {
+		return errors.Wrapf(err, "error registering plugin %s in vault", plugin.name)
+	}
+
+	logrus.Infoln("registered plugin", plugin.name)
+
+	if registered != nil && cast.ToString(registered["sha256"]) != plugin.sha256 {
+		return v.reloadPlugin(plugin)
+	}
+
+	return nil
+}
+
+func sameArgs(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// reloadPlugin reloads the mounts using the plugin
+func (v *vault) reloadPlugin(plugin *catalogPlugin) error {
+	data := map[string]interface{}{"plugin": plugin.name}
+	if plugin.reloadScope != "" {
+		data["scope"] = plugin.reloadScope
+	}
+
+	if _, err := v.cl.Logical().Write("sys/plugins/reload/backend", data); err != nil {
+		return errors.Wrapf(err, "error reloading plugin %s", plugin.name)
+	}
+
+	logrus.Infof("reloaded the mounts of plugin %s after its sha256 changed", plugin.name)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestConfigurePlugin(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/plugins/catalog/secret/changed":   {"name": "changed", "command": "changed", "sha256": "old"},
+		"sys/plugins/catalog/secret/unchanged": {"name": "unchanged", "command": "unchanged", "sha256": "same", "args": []interface{}{}},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	for _, raw := range []map[string]interface{}{
+		{"plugin_name": "unchanged", "type": "secret", "command": "unchanged", "sha256": "same"},
+		{"plugin_name": "changed", "type": "secret", "command": "changed", "sha256": "new", "reload_scope": "global"},
+		{"plugin_name": "new", "type": "auth", "command": "new", "sha256": "first", "version": "v1.0.0"},
+	} {
+		plugin, err := parseCatalogPlugin(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.configurePlugin(plugin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := paths["sys/plugins/catalog/secret/unchanged"]["name"]; !ok {
+		t.Error("the unchanged plugin must not be registered again")
+	}
+	if sha := paths["sys/plugins/catalog/secret/changed"]["sha256"]; sha != "new" {
+		t.Errorf("the changed plugin must be registered with the new sha256, got %v", sha)
+	}
+	if reload := paths["sys/plugins/reload/backend"]; reload["plugin"] != "changed" || reload["scope"] != "global" {
+		t.Errorf("the changed plugin must be reloaded, got %v", reload)
+	}
+	if version := paths["sys/plugins/catalog/auth/new"]["version"]; version != "v1.0.0" {
+		t.Errorf("the new plugin must be registered with its version, got %v", version)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// purgeUnmanagedConfigKey is the key of the sections which are purged of everything not declared in the config:
+//
+//	purgeUnmanagedConfig:
+//	  policies: true
+//	  passwordPolicies: true
+//	  auth: true
+//	  secrets: true
+//	  audit: true
+//	  mfa: true
+//	  quotas: true
+const purgeUnmanagedConfigKey = "purgeUnmanagedConfig"
+
+// builtinPolicies can't be deleted
+var builtinPolicies = map[string]bool{
+	"root":    true,
+	"default": true,
+}
+
+// builtinMountTypes are the mounts of Vault itself, which can't be disabled
+var builtinMountTypes = map[string]bool{
+	"token":     true,
+	"system":    true,
+	"identity":  true,
+	"cubbyhole": true,
+}
+
+// authRoleSubPaths are the paths of the roles below the auth method mounts configured by bank-vaults
+var authRoleSubPaths = map[string]string{
+	"kubernetes": "role",
+	"aws":        "role",
+	"gcp":        "role",
+	"oci":        "role",
+	"approle":    "role",
+	"jwt":        "role",
+	"oidc":       "role",
+	"azure":      "role",
+	"token":      "roles",
+	"cert":       "certs",
+}
+
+// purgeUnmanaged returns true if the section opted in for purging the unmanaged configuration
+func purgeUnmanaged(config *viper.Viper, section string) bool {
+	return config.GetBool(purgeUnmanagedConfigKey + "." + section)
+}
+
+// configuredPath returns the path of a configured auth method, secret engine or audit device, which defaults to its type
+func configuredPath(item map[string]interface{}) (string, error) {
+	path, err := cast.ToStringE(item["type"])
+	if err != nil {
+		return "", errors.Wrap(err, "error finding type")
+	}
+
+	if pathOverwrite, ok := item["path"]; ok {
+		path, err = cast.ToStringE(pathOverwrite)
+		if err != nil {
+			return "", errors.Wrap(err, "error converting path")
+		}
+		path = strings.Trim(path, "/")
+	}
+
+	return path, nil
+}
+
+// configuredPaths returns the mount paths (with a trailing slash, as Vault lists them) of the configured items
+func configuredPaths(items []map[string]interface{}) (map[string]bool, error) {
+	paths := make(map[string]bool, len(items))
+	for _, item := range items {
+		path, err := configuredPath(item)
+		if err != nil {
+			return nil, err
+		}
+		paths[path+"/"] = true
+	}
+	return paths, nil
+}
+
+func (v *vault) purgeUnmanagedPolicies(policies []map[string]interface{}) error {
+	managed := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		managed[policyType(policy)+"/"+cast.ToString(policy["name"])] = true
+	}
+
+	existingPolicies, err := v.cl.Sys().ListPolicies()
+	if err != nil {
+		return errors.Wrap(err, "error listing policies")
+	}
+
+	for _, policy := range existingPolicies {
+		if managed["acl/"+policy] || builtinPolicies[policy] {
+			continue
+		}
+
+		logrus.Infof("deleting unmanaged policy: %s", policy)
+
+		if err := v.cl.Sys().DeletePolicy(policy); err != nil {
+			return errors.Wrapf(err, "error deleting unmanaged policy %s", policy)
+		}
+	}
+
+	return v.purgeUnmanagedSentinelPolicies(managed)
+}
+
+func (v *vault) purgeUnmanagedAuthMethods(authMethods []map[string]interface{}) error {
+	managed, err := configuredPaths(authMethods)
+	if err != nil {
+		return errors.Wrap(err, "error finding auth method path")
+	}
+
+	existingAuths, err := v.cl.Sys().ListAuth()
+	if err != nil {
+		return errors.Wrap(err, "error listing auth backends vault")
+	}
+
+	for path, authMount := range existingAuths {
+		if managed[path] || builtinMountTypes[authMount.Type] {
+			continue
+		}
+
+		logrus.Infof("disabling unmanaged %s auth method: %s", authMount.Type, path)
+
+		if err := v.cl.Sys().DisableAuth(strings.TrimSuffix(path, "/")); err != nil {
+			return errors.Wrapf(err, "error disabling unmanaged auth method %s", path)
+		}
+	}
+
+	for _, authMethod := range authMethods {
+		authMethodType := cast.ToString(authMethod["type"])
+		roleSubPath, ok := authRoleSubPaths[authMethodType]
+		if !ok {
+			continue
+		}
+
+		path, err := configuredPath(authMethod)
+		if err != nil {
+			return errors.Wrap(err, "error finding auth method path")
+		}
+		if authMethodType == "token" {
+			path = "token"
+		}
+
+		var roles []interface{}
+		if rolesRaw, ok := authMethod["roles"]; ok {
+			roles, err = cast.ToSliceE(rolesRaw)
+			if err != nil {
+				return errors.Wrapf(err, "error finding roles block for %s", authMethodType)
+			}
+		}
+
+		if err := v.purgeUnmanagedAuthRoles(fmt.Sprintf("auth/%s/%s", path, roleSubPath), roles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) purgeUnmanagedAuthRoles(rolesPath string, roles []interface{}) error {
+	managed := make(map[string]bool, len(roles))
+	for _, roleInterface := range roles {
+		role, err := cast.ToStringMapE(roleInterface)
+		if err != nil {
+			return errors.Wrapf(err, "error converting roles of %s", rolesPath)
+		}
+		managed[cast.ToString(role["name"])] = true
+	}
+
+	secret, err := v.cl.Logical().List(rolesPath)
+	if err != nil {
+		return errors.Wrapf(err, "error listing roles of %s", rolesPath)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	existingRoles, err := cast.ToStringSliceE(secret.Data["keys"])
+	if err != nil {
+		return errors.Wrapf(err, "error converting roles of %s", rolesPath)
+	}
+
+	for _, role := range existingRoles {
+		if managed[role] {
+			continue
+		}
+
+		logrus.Infof("deleting unmanaged role: %s/%s", rolesPath, role)
+
+		if _, err := v.cl.Logical().Delete(rolesPath + "/" + role); err != nil {
+			return errors.Wrapf(err, "error deleting unmanaged role %s/%s", rolesPath, role)
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) purgeUnmanagedSecretEngines(secretEngines []map[string]interface{}) error {
+	managed, err := configuredPaths(secretEngines)
+	if err != nil {
+		return errors.Wrap(err, "error finding secret engine path")
+	}
+
+	mounts, err := v.cl.Sys().ListMounts()
+	if err != nil {
+		return errors.Wrap(err, "error reading mounts from vault")
+	}
+
+	for path, mount := range mounts {
+		if managed[path] || builtinMountTypes[mount.Type] {
+			continue
+		}
+
+		logrus.Infof("disabling unmanaged %s secret engine: %s", mount.Type, path)
+
+		if err := v.cl.Sys().Unmount(strings.TrimSuffix(path, "/")); err != nil {
+			return errors.Wrapf(err, "error disabling unmanaged secret engine %s", path)
+		}
+	}
+
+	return nil
+}
+
+// removeSecretEngines disables the secret engines mounted at the removed paths, which are not configured (anymore)
+func (v *vault) removeSecretEngines(secretEngines []map[string]interface{}, removed []string) error {
+	if len(removed) == 0 {
+		return nil
+	}
+
+	managed, err := configuredPaths(secretEngines)
+	if err != nil {
+		return errors.Wrap(err, "error finding secret engine path")
+	}
+
+	mounts, err := v.cl.Sys().ListMounts()
+	if err != nil {
+		return errors.Wrap(err, "error reading mounts from vault")
+	}
+
+	for _, path := range removed {
+		path = strings.Trim(path, "/") + "/"
+		if managed[path] || mounts[path] == nil {
+			continue
+		}
+
+		logrus.Infof("disabling removed %s secret engine: %s", mounts[path].Type, path)
+
+		if err := v.cl.Sys().Unmount(strings.TrimSuffix(path, "/")); err != nil {
+			return errors.Wrapf(err, "error disabling removed secret engine %s", path)
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) purgeUnmanagedAuditDevices(auditDevices []map[string]interface{}) error {
+	managed, err := configuredPaths(auditDevices)
+	if err != nil {
+		return errors.Wrap(err, "error finding audit device path")
+	}
+
+	devices, err := v.cl.Sys().ListAudit()
+	if err != nil {
+		return errors.Wrap(err, "error reading audit mounts from vault")
+	}
+
+	for path, device := range devices {
+		if managed[path] {
+			continue
+		}
+
+		logrus.Infof("disabling unmanaged %s audit device: %s", device.Type, path)
+
+		if err := v.cl.Sys().DisableAudit(strings.TrimSuffix(path, "/")); err != nil {
+			return errors.Wrapf(err, "error disabling unmanaged audit device %s", path)
+		}
+	}
+
+	return nil
+}
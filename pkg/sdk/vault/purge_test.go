@@ -0,0 +1,159 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestPurgeUnmanagedConfig(t *testing.T) {
+	var deleted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /v1/sys/policies/acl/managed":
+		case "GET /v1/sys/policies/acl":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"root", "default", "managed", "unmanaged"}}}
+		case "GET /v1/sys/audit":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"file/":      map[string]interface{}{"type": "file", "path": "file/"},
+				"unmanaged/": map[string]interface{}{"type": "syslog", "path": "unmanaged/"},
+			}}
+		case "GET /v1/sys/policies/egp", "GET /v1/sys/policies/rgp":
+			// Sentinel policies are not supported without Vault Enterprise
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"1 error occurred:\n\t* unsupported path\n\n"}})
+			return
+		case "DELETE /v1/sys/policies/acl/unmanaged", "DELETE /v1/sys/audit/unmanaged":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if response == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+purgeUnmanagedConfig:
+  policies: true
+  audit: true
+policies:
+  - name: managed
+    rules: path "secret/*" { capabilities = ["read"] }
+audit:
+  - type: file
+    options:
+      file_path: /tmp/vault.log
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configurePolicies(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.configureAuditDevices(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(deleted)
+	expected := []string{"/v1/sys/audit/unmanaged", "/v1/sys/policies/acl/unmanaged"}
+	if strings.Join(deleted, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v to be deleted, got %v", expected, deleted)
+	}
+}
+
+func TestRemovedSecrets(t *testing.T) {
+	var unmounted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/mounts":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"secret/":  map[string]interface{}{"type": "kv"},
+				"pki/":     map[string]interface{}{"type": "pki"},
+				"transit/": map[string]interface{}{"type": "transit"},
+			}})
+		case "POST /v1/sys/mounts/secret/tune":
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE /v1/sys/mounts/pki":
+			unmounted = append(unmounted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+secrets:
+  - path: secret
+    type: kv
+removedSecrets:
+  - pki
+  - secret
+  - database
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configureSecretEngines(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(unmounted, ",") != "/v1/sys/mounts/pki" {
+		t.Errorf("only the removed pki mount should be disabled, got %v", unmounted)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// quotaTypes are the types of the resource quotas with their key in the quotas block
+var quotaTypes = []struct {
+	key       string
+	quotaType string
+}{
+	{key: "rateLimit", quotaType: "rate-limit"},
+	{key: "leaseCount", quotaType: "lease-count"},
+}
+
+// configureQuotas writes the resource quotas of the quotas block. The path of a quota is empty
+// for a global quota, a namespace (and a mount in it) or a mount, and can be an auth method
+// login path ending with a role, for example:
+//
+//	quotas:
+//	  config:
+//	    enable_rate_limit_audit_logging: true
+//	  rateLimit:
+//	    - name: global
+//	      rate: 1000
+//	    - name: team-a
+//	      path: team-a/
+//	      rate: 100
+//	      interval: 1s
+//	      block_interval: 1m
+//	  leaseCount:
+//	    - name: database
+//	      path: database/
+//	      max_leases: 1000
+//
+// Lease count quotas are a Vault Enterprise feature. With purgeUnmanagedConfig.quotas
+// the quotas which are not configured are deleted.
+func (v *vault) configureQuotas(config *viper.Viper) error {
+	if config.IsSet("quotas.config") {
+		quotasConfig := cast.ToStringMap(config.Get("quotas.config"))
+		if _, err := v.cl.Logical().Write("sys/quotas/config", quotasConfig); err != nil {
+			return errors.Wrap(err, "error configuring quotas")
+		}
+	}
+
+	for _, t := range quotaTypes {
+		quotaType := t.quotaType
+		quotas := []map[string]interface{}{}
+		err := config.UnmarshalKey("quotas."+t.key, &quotas)
+		if err != nil {
+			return errors.Wrapf(err, "error unmarshalling %s quotas config", quotaType)
+		}
+
+		managed := make(map[string]bool, len(quotas))
+
+		for _, quota := range quotas {
+			if err := v.progressStep(); err != nil {
+				return err
+			}
+
+			name, err := getOrError(quota, "name")
+			if err != nil {
+				return errors.Wrapf(err, "error getting name for %s quota", quotaType)
+			}
+
+			managed[name] = true
+
+			data := make(map[string]interface{}, len(quota))
+			for k, value := range quota {
+				if k != "name" {
+					data[k] = value
+				}
+			}
+
+			if _, err := v.cl.Logical().Write("sys/quotas/"+quotaType+"/"+name, data); err != nil {
+				return errors.Wrapf(err, "error putting %s quota %s into vault", quotaType, name)
+			}
+
+			logrus.Infof("%s quota %s configured", quotaType, name)
+		}
+
+		if purgeUnmanaged(config, "quotas") {
+			if err := v.purgeUnmanagedQuotas(quotaType, managed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// purgeUnmanagedQuotas deletes the quotas of the type which are not configured
+func (v *vault) purgeUnmanagedQuotas(quotaType string, managed map[string]bool) error {
+	secret, err := v.cl.Logical().List("sys/quotas/" + quotaType)
+	if err != nil {
+		return errors.Wrapf(err, "error listing %s quotas", quotaType)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	for _, name := range cast.ToStringSlice(secret.Data["keys"]) {
+		if managed[name] {
+			continue
+		}
+
+		logrus.Infof("deleting unmanaged %s quota: %s", quotaType, name)
+
+		if _, err := v.cl.Logical().Delete("sys/quotas/" + quotaType + "/" + name); err != nil {
+			return errors.Wrapf(err, "error deleting unmanaged %s quota %s", quotaType, name)
+		}
+	}
+
+	return nil
+}
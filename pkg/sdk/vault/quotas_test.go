@@ -0,0 +1,77 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestConfigureQuotas(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/quotas/rate-limit/unmanaged": {"rate": 10},
+		"sys/quotas/rate-limit":           {"keys": []interface{}{"global", "unmanaged"}},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	err = v.configureQuotas(testExternalConfig(t, `
+quotas:
+  config:
+    enable_rate_limit_audit_logging: true
+  rateLimit:
+    - name: global
+      rate: 1000
+    - name: team-a
+      path: team-a/
+      rate: 100
+      interval: 1s
+  leaseCount:
+    - name: database
+      path: database/
+      max_leases: 50
+purgeUnmanagedConfig:
+  quotas: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if logging := paths["sys/quotas/config"]["enable_rate_limit_audit_logging"]; logging != true {
+		t.Errorf("the quotas config must be written, got %v", paths["sys/quotas/config"])
+	}
+	if quota := paths["sys/quotas/rate-limit/team-a"]; quota["path"] != "team-a/" || quota["interval"] != "1s" {
+		t.Errorf("the rate limit quota must be written, got %v", quota)
+	}
+	if _, ok := paths["sys/quotas/rate-limit/team-a"]["name"]; ok {
+		t.Error("the name of the quota must not be written in its body")
+	}
+	if quota := paths["sys/quotas/lease-count/database"]; quota["path"] != "database/" {
+		t.Errorf("the lease count quota must be written, got %v", quota)
+	}
+	if _, ok := paths["sys/quotas/rate-limit/unmanaged"]; ok {
+		t.Error("the unmanaged rate limit quota must be deleted")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+// RaftPeer is a server of the Raft cluster of Vault
+type RaftPeer struct {
+	ID      string
+	Address string
+	Leader  bool
+	Voter   bool
+	// Healthy is reported by autopilot (Vault 1.7+), peers are considered healthy without it
+	Healthy bool
+}
+
+// RaftState is the state of the Raft cluster observed by the leader
+type RaftState struct {
+	Peers   int `json:"peers"`
+	Voters  int `json:"voters"`
+	Healthy int `json:"healthy"`
+}
+
+// RaftPeers returns the servers of the Raft cluster, with their health if autopilot is available
+func (v *vault) RaftPeers() ([]RaftPeer, error) {
+	var peers []RaftPeer
+
+	err := v.withRootToken(func() error {
+		secret, err := v.cl.Logical().Read("sys/storage/raft/configuration")
+		if err != nil {
+			return errors.Wrap(err, "error reading raft configuration")
+		}
+		if secret == nil || secret.Data == nil {
+			return errors.New("empty raft configuration") // nolint:goerr113
+		}
+
+		servers := cast.ToStringMap(secret.Data["config"])["servers"]
+		for _, server := range cast.ToSlice(servers) {
+			server := cast.ToStringMap(server)
+			peers = append(peers, RaftPeer{
+				ID:      cast.ToString(server["node_id"]),
+				Address: cast.ToString(server["address"]),
+				Leader:  cast.ToBool(server["leader"]),
+				Voter:   cast.ToBool(server["voter"]),
+				Healthy: true,
+			})
+		}
+
+		state, err := v.cl.Logical().Read("sys/storage/raft/autopilot/state")
+		if err != nil || state == nil {
+			// autopilot is not available before Vault 1.7
+			return nil
+		}
+
+		health := cast.ToStringMap(state.Data["servers"])
+		for i := range peers {
+			if server, ok := health[peers[i].ID]; ok {
+				peers[i].Healthy = cast.ToBool(cast.ToStringMap(server)["healthy"])
+			}
+		}
+
+		return nil
+	})
+
+	return peers, err
+}
+
+// RaftRemovePeer removes a server from the Raft cluster
+func (v *vault) RaftRemovePeer(id string) error {
+	return v.withRootToken(func() error {
+		_, err := v.cl.Logical().Write("sys/storage/raft/remove-peer", map[string]interface{}{"server_id": id})
+		return errors.Wrapf(err, "error removing raft peer %s", id)
+	})
+}
+
+// RaftAutopilotConfigure updates the autopilot configuration of the Raft cluster (Vault 1.7+),
+// e.g. server_stabilization_time after which autopilot promotes the healthy non-voters
+func (v *vault) RaftAutopilotConfigure(config map[string]interface{}) error {
+	return v.withRootToken(func() error {
+		_, err := v.cl.Logical().Write("sys/storage/raft/autopilot/configuration", config)
+		return errors.Wrap(err, "error configuring raft autopilot")
+	})
+}
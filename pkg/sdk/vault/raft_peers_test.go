@@ -0,0 +1,84 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestRaftPeers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("X-Vault-Token"); token != "root" {
+			t.Errorf("unexpected token: %s", token)
+		}
+
+		var response interface{}
+		switch r.URL.Path {
+		case "/v1/sys/storage/raft/configuration":
+			response = api.Secret{Data: map[string]interface{}{"config": map[string]interface{}{"servers": []interface{}{
+				map[string]interface{}{"node_id": "vault-0", "address": "vault-0:8201", "leader": true, "voter": true},
+				map[string]interface{}{"node_id": "vault-1", "address": "vault-1:8201", "voter": true},
+				map[string]interface{}{"node_id": "vault-2", "address": "vault-2:8201", "voter": false},
+			}}}}
+		case "/v1/sys/storage/raft/autopilot/state":
+			response = api.Secret{Data: map[string]interface{}{"servers": map[string]interface{}{
+				"vault-0": map[string]interface{}{"healthy": true},
+				"vault-1": map[string]interface{}{"healthy": false},
+				"vault-2": map[string]interface{}{"healthy": true},
+			}}}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("")
+
+	v, err := New(memoryKV{"vault-root": []byte("root")}, cl, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := v.RaftPeers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RaftPeer{
+		{ID: "vault-0", Address: "vault-0:8201", Leader: true, Voter: true, Healthy: true},
+		{ID: "vault-1", Address: "vault-1:8201", Voter: true, Healthy: false},
+		{ID: "vault-2", Address: "vault-2:8201", Voter: false, Healthy: true},
+	}
+
+	if !reflect.DeepEqual(expected, peers) {
+		t.Errorf("unexpected peers:\nexpected: %+v\ngot:      %+v", expected, peers)
+	}
+}
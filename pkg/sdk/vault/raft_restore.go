@@ -0,0 +1,183 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+)
+
+// raftRestoreTimeout limits how long the steps of a restore are waited for
+const raftRestoreTimeout = 5 * time.Minute
+
+// raftRestoreRetryPeriod is how often the steps of a restore are retried
+var raftRestoreRetryPeriod = 2 * time.Second
+
+// bootstrapRestoreTarget initializes and unseals a fresh Vault with temporary keys which are not stored,
+// since they are replaced by the keys of the snapshot, and returns the temporary root token
+func (v *vault) bootstrapRestoreTarget() (string, error) {
+	logrus.Info("initializing vault with temporary keys for the restore")
+
+	resp, err := v.cl.Sys().Init(&api.InitRequest{
+		SecretShares:      1,
+		SecretThreshold:   1,
+		RecoveryShares:    1,
+		RecoveryThreshold: 1,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "error initializing vault")
+	}
+
+	for deadline := time.Now().Add(raftRestoreTimeout); ; time.Sleep(raftRestoreRetryPeriod) {
+		if time.Now().After(deadline) {
+			return "", errors.New("vault wasn't unsealed with the temporary keys in time") // nolint:goerr113
+		}
+
+		status, err := v.cl.Sys().SealStatus()
+		if err == nil && !status.Sealed {
+			break
+		}
+		if err == nil && len(resp.Keys) > 0 {
+			if _, err := v.cl.Sys().Unseal(resp.Keys[0]); err != nil {
+				logrus.Warnf("error unsealing vault with the temporary key: %s", err.Error())
+			}
+		}
+	}
+
+	return resp.RootToken, nil
+}
+
+// RaftSnapshotRestore force-restores a Raft snapshot into Vault, then unseals it with the keys in the
+// key store, which have to be the keys of the cluster the snapshot was taken from.
+// If Vault is not initialized, it is initialized with temporary keys first, otherwise the client
+// needs a root token of the target cluster (e.g. from VAULT_TOKEN).
+func (v *vault) RaftSnapshotRestore(snapshot io.Reader) error {
+	defer v.config.SealStatusCache.Invalidate(v.cl.Address())
+
+	// the snapshot is rewound or buffered, so that the restore request can be retried
+	seeker, ok := snapshot.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(snapshot)
+		if err != nil {
+			return errors.Wrap(err, "error reading snapshot")
+		}
+		seeker = bytes.NewReader(data)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "error reading snapshot")
+	}
+
+	status, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return errors.Wrap(err, "error checking status")
+	}
+
+	token := v.cl.Token()
+	if !status.Initialized {
+		token, err = v.bootstrapRestoreTarget()
+		if err != nil {
+			return err
+		}
+	} else if token == "" {
+		return errors.New("vault is initialized already, a root token of it is needed for the restore") // nolint:goerr113
+	}
+
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetToken(token)
+
+	// a freshly unsealed Raft cluster needs a few seconds to elect its leader
+	for deadline := time.Now().Add(raftRestoreTimeout); ; time.Sleep(raftRestoreRetryPeriod) {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return errors.Wrap(err, "error rewinding snapshot")
+		}
+		err = cl.Sys().RaftSnapshotRestore(seeker, true)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.Wrap(err, "error restoring raft snapshot")
+		}
+		logrus.Infof("vault is not ready for the restore yet: %s", err.Error())
+	}
+
+	logrus.Info("raft snapshot restored, unsealing vault with the stored keys")
+
+	// the root token of the snapshot's cluster is valid once the restored data is in use
+	var rootToken string
+	if raw, err := v.keyStore.Get(v.rootTokenKey()); err == nil {
+		rootToken = string(raw)
+	}
+	cl.SetToken(rootToken)
+
+	for deadline := time.Now().Add(raftRestoreTimeout); ; time.Sleep(raftRestoreRetryPeriod) {
+		if time.Now().After(deadline) {
+			return errors.New("vault wasn't unsealed with the stored keys in time after the restore") // nolint:goerr113
+		}
+
+		status, err := v.cl.Sys().SealStatus()
+		if err != nil {
+			logrus.Infof("error checking status after the restore: %s", err.Error())
+			continue
+		}
+
+		if status.Sealed {
+			if status.Type == "shamir" {
+				if err := v.Unseal(); err != nil {
+					logrus.Warnf("error unsealing vault with the stored keys: %s", err.Error())
+				}
+			}
+			continue
+		}
+
+		if rootToken == "" {
+			break
+		}
+		if _, err := cl.Auth().Token().LookupSelf(); err == nil {
+			break
+		}
+		logrus.Info("the stored root token is not valid yet, waiting for the restored data")
+	}
+
+	logrus.Info("vault restored and unsealed")
+
+	return nil
+}
+
+// VerifyReadable reads the paths with the root token from the key store (or the token of the client),
+// to check that the data of a restored snapshot is in use.
+func (v *vault) VerifyReadable(paths []string) error {
+	return v.withRootToken(func() error {
+		for _, path := range paths {
+			secret, err := v.cl.Logical().Read(path)
+			if err != nil {
+				return errors.Wrapf(err, "error reading '%s'", path)
+			}
+			if secret == nil {
+				return errors.Errorf("'%s' doesn't exist", path)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestRestoreServer simulates a fresh Vault which is sealed with the keys of the snapshot after the restore
+func newTestRestoreServer(t *testing.T) *httptest.Server {
+	initialized, sealed, restored := false, true, false
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.URL.Path != "/v1/sys/storage/raft/snapshot-force" {
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		}
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/seal-status":
+			response = api.SealStatusResponse{Type: "shamir", Initialized: initialized, Sealed: sealed, T: 1, N: 1}
+		case "PUT /v1/sys/init":
+			initialized = true
+			response = api.InitResponse{Keys: []string{"temporary-key"}, RootToken: "temporary-token"}
+		case "PUT /v1/sys/unseal":
+			expected := "temporary-key"
+			if restored {
+				expected = "snapshot-key"
+			}
+			if body["key"] != expected {
+				t.Errorf("unexpected unseal key: %v", body["key"])
+			}
+			sealed = false
+			response = api.SealStatusResponse{Type: "shamir", Initialized: true, Sealed: sealed, T: 1, N: 1}
+		case "POST /v1/sys/storage/raft/snapshot-force":
+			if token := r.Header.Get("X-Vault-Token"); token != "temporary-token" {
+				t.Errorf("unexpected token for the restore: %s", token)
+			}
+			snapshot, _ := ioutil.ReadAll(r.Body)
+			if string(snapshot) != "snapshot" {
+				t.Errorf("unexpected snapshot: %s", snapshot)
+			}
+			restored, sealed = true, true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "GET /v1/auth/token/lookup-self":
+			if token := r.Header.Get("X-Vault-Token"); token != "snapshot-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			response = api.Secret{Data: map[string]interface{}{"id": "snapshot-token"}}
+		case "PUT /v1/sys/seal":
+			if token := r.Header.Get("X-Vault-Token"); token != "snapshot-token" {
+				t.Errorf("unexpected token for sealing: %s", token)
+			}
+			sealed = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestRaftSnapshotRestore(t *testing.T) {
+	raftRestoreRetryPeriod = 10 * time.Millisecond
+
+	server := newTestRestoreServer(t)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("")
+
+	store := memoryKV{"vault-unseal-0": []byte("snapshot-key"), "vault-root": []byte("snapshot-token")}
+
+	v, err := New(store, cl, Config{SecretShares: 1, SecretThreshold: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.RaftSnapshotRestore(strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a standby is sealed again with the root token of the snapshot after the restore
+	if err := v.Seal(); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, err := v.Sealed(); err != nil || !sealed {
+		t.Errorf("vault should be sealed: %v", err)
+	}
+}
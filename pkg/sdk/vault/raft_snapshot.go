@@ -0,0 +1,75 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"io"
+	"runtime"
+
+	"emperror.dev/errors"
+)
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// withRootToken runs fn with the root token from the key store set on the client,
+// unless the client has a token already
+func (v *vault) withRootToken(fn func() error) error {
+	if v.cl.Token() != "" {
+		return fn()
+	}
+
+	rootToken, err := v.keyStore.Get(v.rootTokenKey())
+	if err != nil {
+		return errors.Wrapf(err, "unable to get key '%s'", v.rootTokenKey())
+	}
+
+	v.cl.SetToken(string(rootToken))
+
+	// Clear the token and GC it
+	defer runtime.GC()
+	defer v.cl.SetToken("")
+	defer func() { rootToken = nil }()
+
+	return fn()
+}
+
+// RaftSnapshot writes a snapshot of the Raft storage of Vault to w and returns its size.
+func (v *vault) RaftSnapshot(w io.Writer) (int64, error) {
+	cw := countingWriter{w: w}
+
+	err := v.withRootToken(func() error {
+		return v.cl.Sys().RaftSnapshot(&cw)
+	})
+	if err != nil {
+		return cw.n, errors.Wrap(err, "error taking raft snapshot")
+	}
+
+	// the client doesn't return the errors of the request itself, only of the response
+	if cw.n == 0 {
+		return 0, errors.New("raft snapshot is empty, vault may be unreachable") // nolint:goerr113
+	}
+
+	return cw.n, nil
+}
@@ -0,0 +1,234 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+)
+
+// rekeyProcess abstracts the rekey endpoints of the unseal and the recovery keys
+type rekeyProcess struct {
+	name     string
+	keyForID func(int) string
+	status   func() (*api.RekeyStatusResponse, error)
+	init     func(*api.RekeyInitRequest) (*api.RekeyStatusResponse, error)
+	update   func(shard, nonce string) (*api.RekeyUpdateResponse, error)
+	verify   func(shard, nonce string) (*api.RekeyVerificationUpdateResponse, error)
+	cancel   func() error
+}
+
+func (v *vault) rekeyProcess(sealType string) rekeyProcess {
+	sys := v.cl.Sys()
+
+	if sealType == "" || sealType == "shamir" {
+		return rekeyProcess{
+			name:     "unseal",
+			keyForID: v.unsealKeyForID,
+			status:   sys.RekeyStatus,
+			init:     sys.RekeyInit,
+			update:   sys.RekeyUpdate,
+			verify:   sys.RekeyVerificationUpdate,
+			cancel:   sys.RekeyCancel,
+		}
+	}
+
+	return rekeyProcess{
+		name:     "recovery",
+		keyForID: v.recoveryKeyForID,
+		status:   sys.RekeyRecoveryKeyStatus,
+		init:     sys.RekeyRecoveryKeyInit,
+		update:   sys.RekeyRecoveryKeyUpdate,
+		verify:   sys.RekeyRecoveryKeyVerificationUpdate,
+		cancel:   sys.RekeyRecoveryKeyCancel,
+	}
+}
+
+func (*vault) rekeyPendingKeyForID(process rekeyProcess, i int) string {
+	return fmt.Sprintf("vault-rekey-%s-%d", process.name, i)
+}
+
+// storedKeys returns the keys of the key store until the first missing one
+func (v *vault) storedKeys(keyForID func(int) string) ([]string, error) {
+	var keys []string
+	for i := 0; ; i++ {
+		key, err := v.keyStore.Get(keyForID(i))
+		if isNotFoundError(err) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get key '%s'", keyForID(i))
+		}
+		keys = append(keys, string(key))
+	}
+}
+
+// Rekey replaces the unseal keys (or the recovery keys with auto-unseal) of Vault with new ones,
+// using the current keys from the key store. The new keys are stored under pending names first,
+// and only replace the current keys after Vault verified that they reach the threshold.
+// The pending copies and the stale keys over the new share count are deleted at the end,
+// so the key store has to support deleting keys.
+// In dry-run mode only the preconditions are checked and Vault is not changed.
+func (v *vault) Rekey(dryRun bool) error {
+	unlock, err := v.lockKeyStore("rekey")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			logrus.Warnf("error unlocking key store: %s", err.Error())
+		}
+	}()
+
+	sealStatus, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return errors.Wrap(err, "error checking status")
+	}
+	if !sealStatus.Initialized || sealStatus.Sealed {
+		return errors.New("vault has to be initialized and unsealed for rekeying") // nolint:goerr113
+	}
+
+	deleter, ok := v.keyStore.(kvDeleter)
+	if !ok {
+		return errors.New("the key store doesn't support deleting keys, which is required for rekeying") // nolint:goerr113
+	}
+
+	process := v.rekeyProcess(sealStatus.Type)
+
+	currentKeys, err := v.storedKeys(process.keyForID)
+	if err != nil {
+		return err
+	}
+
+	status, err := process.status()
+	if err != nil {
+		return errors.Wrapf(err, "error checking %s key rekey status", process.name)
+	}
+
+	threshold := sealStatus.T
+	if len(currentKeys) < threshold {
+		return errors.Errorf("only %d of the %d required %s keys are in the key store", len(currentKeys), threshold, process.name)
+	}
+
+	if v.config.SecretShares < len(currentKeys) {
+		logrus.Infof("%d stale %s keys will be deleted, since there will be only %d new ones",
+			len(currentKeys)-v.config.SecretShares, process.name, v.config.SecretShares)
+	}
+
+	if dryRun {
+		logrus.WithFields(logrus.Fields{
+			"keys":            process.name,
+			"storedKeys":      len(currentKeys),
+			"threshold":       threshold,
+			"secretShares":    v.config.SecretShares,
+			"secretThreshold": v.config.SecretThreshold,
+			"rekeyInProgress": status.Started,
+		}).Info("dry run: vault can be rekeyed")
+		return nil
+	}
+
+	if status.Started {
+		logrus.Warnf("cancelling %s key rekey which is already in progress", process.name)
+		if err := process.cancel(); err != nil {
+			return errors.Wrapf(err, "error cancelling %s key rekey", process.name)
+		}
+	}
+
+	status, err = process.init(&api.RekeyInitRequest{
+		SecretShares:        v.config.SecretShares,
+		SecretThreshold:     v.config.SecretThreshold,
+		RequireVerification: true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error initializing %s key rekey", process.name)
+	}
+
+	logrus.Infof("%s key rekey initialized", process.name)
+
+	var update *api.RekeyUpdateResponse
+	for _, key := range currentKeys {
+		update, err = process.update(key, status.Nonce)
+		if err != nil {
+			_ = process.cancel()
+			return errors.Wrapf(err, "error submitting %s key for rekey", process.name)
+		}
+		if update.Complete {
+			break
+		}
+	}
+
+	if update == nil || !update.Complete {
+		_ = process.cancel()
+		return errors.Errorf("the stored %s keys didn't complete the rekey", process.name)
+	}
+
+	// the new keys aren't active until they are verified, store them first so that they can't get lost
+	for i, k := range update.Keys {
+		keyID := v.rekeyPendingKeyForID(process, i)
+		if err := v.keyStore.Set(keyID, []byte(k)); err != nil {
+			_ = process.cancel()
+			return errors.Wrapf(err, "error storing new %s key '%s'", process.name, keyID)
+		}
+	}
+
+	if update.VerificationRequired {
+		var verified bool
+		for _, k := range update.Keys {
+			resp, err := process.verify(k, update.VerificationNonce)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying new %s key", process.name)
+			}
+			if resp.Complete {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			return errors.Errorf("the new %s keys couldn't be verified", process.name)
+		}
+	}
+
+	logrus.Infof("new %s keys verified, replacing the stored keys", process.name)
+
+	for i, k := range update.Keys {
+		keyID := process.keyForID(i)
+		if err := v.keyStore.Set(keyID, []byte(k)); err != nil {
+			return errors.Wrapf(err, "error storing %s key '%s', the new keys are available under '%s'",
+				process.name, keyID, v.rekeyPendingKeyForID(process, i))
+		}
+
+		logrus.WithField("key", keyID).Infof("%s key stored in key store", process.name)
+	}
+
+	// the pending copies and the keys over the new share count aren't needed anymore
+	staleKeys := make([]string, 0, len(update.Keys)+len(currentKeys))
+	for i := range update.Keys {
+		staleKeys = append(staleKeys, v.rekeyPendingKeyForID(process, i))
+	}
+	for i := len(update.Keys); i < len(currentKeys); i++ {
+		staleKeys = append(staleKeys, process.keyForID(i))
+	}
+
+	for _, keyID := range staleKeys {
+		if err := deleter.Delete(keyID); err != nil {
+			return errors.Wrapf(err, "vault has been rekeyed, but the stale %s key '%s' couldn't be deleted", process.name, keyID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestRekeyServer simulates the unseal key rekey of a Vault with a threshold of 2
+func newTestRekeyServer(t *testing.T) *httptest.Server {
+	var submitted, verified int
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/seal-status":
+			response = api.SealStatusResponse{Type: "shamir", Initialized: true, T: 2, N: 3}
+		case "GET /v1/sys/rekey/init":
+			response = api.RekeyStatusResponse{}
+		case "PUT /v1/sys/rekey/init":
+			response = api.RekeyStatusResponse{Started: true, Nonce: "nonce", Required: 2}
+		case "PUT /v1/sys/rekey/update":
+			if body["key"] != "old-0" && body["key"] != "old-1" {
+				t.Errorf("unexpected key submitted: %v", body["key"])
+			}
+			submitted++
+			response = api.RekeyUpdateResponse{Complete: submitted == 2}
+			if submitted == 2 {
+				response = api.RekeyUpdateResponse{
+					Complete:             true,
+					Keys:                 []string{"new-0", "new-1"},
+					VerificationRequired: true,
+					VerificationNonce:    "verification-nonce",
+				}
+			}
+		case "PUT /v1/sys/rekey/verify":
+			verified++
+			response = api.RekeyVerificationUpdateResponse{Complete: verified == 2}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestRekey(t *testing.T) {
+	server := newTestRekeyServer(t)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memoryKV{"vault-unseal-0": []byte("old-0"), "vault-unseal-1": []byte("old-1"), "vault-unseal-2": []byte("old-2")}
+
+	v, err := New(store, cl, Config{SecretShares: 2, SecretThreshold: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Rekey(true); err != nil {
+		t.Fatal(err)
+	}
+	if string(store["vault-unseal-0"]) != "old-0" {
+		t.Error("dry run must not change the stored keys")
+	}
+
+	if err := v.Rekey(false); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{
+		"vault-unseal-0": "new-0",
+		"vault-unseal-1": "new-1",
+	} {
+		if value := string(store[key]); value != expected {
+			t.Errorf("%s: expected %q, got %q", key, expected, value)
+		}
+	}
+
+	for _, key := range []string{"vault-unseal-2", "vault-rekey-unseal-0", "vault-rekey-unseal-1"} {
+		if _, ok := store[key]; ok {
+			t.Errorf("%s: the stale key must be deleted", key)
+		}
+	}
+}
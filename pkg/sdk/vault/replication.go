@@ -0,0 +1,240 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultReplicationWaitHealthy = 5 * time.Minute
+	replicationPollInterval       = 2 * time.Second
+)
+
+// replicationTypes are the replication types of the configuration in bootstrap order,
+// a performance primary is usually a DR primary as well
+var replicationTypes = []string{"dr", "performance"}
+
+// replicationStatus is the mode and the state of a replication type of Vault Enterprise
+type replicationStatus struct {
+	Mode  string
+	State string
+}
+
+// healthy tells if the replication stream of the mode is up, secondaries stream the WALs of the primary
+func (s replicationStatus) healthy() bool {
+	switch s.Mode {
+	case "primary":
+		return s.State == "running"
+	case "secondary":
+		return s.State == "stream-wals"
+	default:
+		return false
+	}
+}
+
+// configureReplication bootstraps the DR and performance replication of Vault Enterprise from the replication block,
+// enabling the primary or activating the secondary if the type isn't enabled yet, then waits for the replication
+// stream to be healthy (waitHealthy: 0 disables waiting). The activation token of a secondary is generated on the
+// primary with "bank-vaults replication-token" and is usually a valueFrom reference to a Kubernetes Secret:
+//
+//	replication:
+//	  dr:
+//	    mode: primary
+//	    primaryClusterAddr: https://vault-0.vault:8201
+//	  performance:
+//	    mode: secondary
+//	    token:
+//	      valueFrom:
+//	        secretKeyRef:
+//	          name: vault-performance-secondary
+//	          key: token
+//	    primaryAPIAddr: https://vault.primary:8200
+//	    caFile: /vault/tls/ca.crt
+//	    waitHealthy: 10m
+//
+// Activating a secondary replaces its data with the data of the primary (and invalidates its root token),
+// so the configuration of a secondary shouldn't have anything else than the replication block.
+// Promotion and demotion are left to the operators, a type enabled in another mode fails the configuration.
+func (v *vault) configureReplication(config *viper.Viper) error {
+	if !config.IsSet("replication") {
+		return nil
+	}
+
+	replication := config.GetStringMap("replication")
+
+	for _, replicationType := range replicationTypes {
+		raw, ok := replication[replicationType]
+		if !ok {
+			continue
+		}
+
+		replicationConfig, err := cast.ToStringMapE(raw)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing %s replication", replicationType)
+		}
+
+		if err := v.configureReplicationType(replicationType, replicationConfig); err != nil {
+			return errors.Wrapf(err, "error configuring %s replication", replicationType)
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) configureReplicationType(replicationType string, replicationConfig map[string]interface{}) error {
+	mode, err := getOrError(replicationConfig, "mode")
+	if err != nil {
+		return err
+	}
+
+	waitHealthy := defaultReplicationWaitHealthy
+	if raw, ok := replicationConfig["waithealthy"]; ok {
+		waitHealthy, err = cast.ToDurationE(raw)
+		if err != nil {
+			return errors.Wrap(err, "error parsing waitHealthy")
+		}
+	}
+
+	status, err := v.replicationStatus(replicationType)
+	if err != nil {
+		return err
+	}
+
+	log := logrus.WithField("replication", replicationType)
+
+	switch {
+	case status.Mode == mode:
+		log.Debugf("replication is enabled as %s already", mode)
+
+	case status.Mode != "disabled":
+		return errors.Errorf("replication is enabled as %s instead of %s, promote or demote the cluster manually", status.Mode, mode)
+
+	case mode == "primary":
+		data := map[string]interface{}{}
+		if addr, _ := getOrDefaultString(replicationConfig, "primaryclusteraddr"); addr != "" {
+			data["primary_cluster_addr"] = addr
+		}
+
+		if _, err := v.cl.Logical().Write(fmt.Sprintf("sys/replication/%s/primary/enable", replicationType), data); err != nil {
+			return errors.Wrap(err, "error enabling primary")
+		}
+		log.Info("replication primary enabled")
+
+	case mode == "secondary":
+		token, err := getOrError(replicationConfig, "token")
+		if err != nil {
+			return errors.Wrap(err, "the activation token is required for secondaries")
+		}
+
+		data := map[string]interface{}{"token": token}
+		for key, param := range map[string]string{"primaryapiaddr": "primary_api_addr", "cafile": "ca_file", "capath": "ca_path"} {
+			if value, _ := getOrDefaultString(replicationConfig, key); value != "" {
+				data[param] = value
+			}
+		}
+
+		if _, err := v.cl.Logical().Write(fmt.Sprintf("sys/replication/%s/secondary/enable", replicationType), data); err != nil {
+			return errors.Wrap(err, "error activating secondary")
+		}
+		log.Info("replication secondary activated")
+
+	default:
+		return errors.Errorf("unknown replication mode: %s", mode)
+	}
+
+	if waitHealthy == 0 {
+		return nil
+	}
+
+	return v.waitReplicationHealthy(replicationType, waitHealthy)
+}
+
+// replicationStatus reads the status of the replication type, it is disabled if Vault doesn't report it
+func (v *vault) replicationStatus(replicationType string) (replicationStatus, error) {
+	secret, err := v.cl.Logical().Read(fmt.Sprintf("sys/replication/%s/status", replicationType))
+	if err != nil {
+		return replicationStatus{}, errors.Wrapf(err, "error reading %s replication status", replicationType)
+	}
+
+	status := replicationStatus{Mode: "disabled"}
+	if secret != nil && secret.Data != nil {
+		if mode := cast.ToString(secret.Data["mode"]); mode != "" {
+			status.Mode = mode
+		}
+		status.State = cast.ToString(secret.Data["state"])
+	}
+
+	return status, nil
+}
+
+// waitReplicationHealthy waits for the replication stream of the type to be healthy
+func (v *vault) waitReplicationHealthy(replicationType string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		status, err := v.replicationStatus(replicationType)
+		if err == nil && status.healthy() {
+			logrus.WithField("replication", replicationType).Infof("replication %s is healthy", status.Mode)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return errors.Wrapf(err, "replication isn't healthy after %s", timeout)
+			}
+			return errors.Errorf("replication isn't healthy after %s, the state is %q", timeout, status.State)
+		}
+
+		if err == nil {
+			logrus.WithField("replication", replicationType).Infof("waiting for the replication to be healthy, the state is %q", status.State)
+		}
+
+		time.Sleep(replicationPollInterval)
+	}
+}
+
+// ReplicationSecondaryToken generates the activation token of the secondary with the id on the replication primary,
+// with the root token from the key store. The token is response-wrapped for ttl (Vault defaults to 30 minutes if 0).
+func (v *vault) ReplicationSecondaryToken(replicationType, id string, ttl time.Duration) (string, error) {
+	data := map[string]interface{}{"id": id}
+	if ttl > 0 {
+		data["ttl"] = ttl.String()
+	}
+
+	var token string
+	err := v.withRootToken(func() error {
+		secret, err := v.cl.Logical().Write(fmt.Sprintf("sys/replication/%s/primary/secondary-token", replicationType), data)
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+			return errors.New("vault returned no activation token") // nolint:goerr113
+		}
+		token = secret.WrapInfo.Token
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "error generating %s replication token for secondary %s", replicationType, id)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,145 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestReplicationServer simulates a Vault Enterprise cluster with the replication types disabled
+func newTestReplicationServer(t *testing.T, enabled map[string]map[string]interface{}) *httptest.Server {
+	status := map[string]map[string]interface{}{
+		"dr":          {"mode": "disabled"},
+		"performance": {"mode": "disabled"},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/replication/dr/status":
+			response = map[string]interface{}{"data": status["dr"]}
+		case "GET /v1/sys/replication/performance/status":
+			response = map[string]interface{}{"data": status["performance"]}
+		case "PUT /v1/sys/replication/dr/primary/enable":
+			enabled["dr"] = body
+			status["dr"] = map[string]interface{}{"mode": "primary", "state": "running"}
+		case "PUT /v1/sys/replication/performance/secondary/enable":
+			enabled["performance"] = body
+			status["performance"] = map[string]interface{}{"mode": "secondary", "state": "stream-wals"}
+		case "PUT /v1/sys/replication/dr/primary/secondary-token":
+			if r.Header.Get("X-Vault-Token") != "root" {
+				t.Errorf("the secondary token has to be generated with the root token")
+			}
+			if body["id"] != "dr-east" || body["ttl"] != "1h0m0s" {
+				t.Errorf("unexpected secondary token request: %v", body)
+			}
+			response = map[string]interface{}{"wrap_info": map[string]interface{}{"token": "activation-token"}}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if response == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestConfigureReplication(t *testing.T) {
+	enabled := map[string]map[string]interface{}{}
+	server := newTestReplicationServer(t, enabled)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := testExternalConfig(t, `
+replication:
+  dr:
+    mode: primary
+    primaryClusterAddr: https://vault-0.vault:8201
+  performance:
+    mode: secondary
+    token: activation-token
+    primaryAPIAddr: https://vault.primary:8200
+    waitHealthy: 1m
+`)
+
+	if err := v.configureReplication(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if addr := enabled["dr"]["primary_cluster_addr"]; addr != "https://vault-0.vault:8201" {
+		t.Errorf("the dr primary should be enabled with the cluster address, got %v", enabled["dr"])
+	}
+	if enabled["performance"]["token"] != "activation-token" || enabled["performance"]["primary_api_addr"] != "https://vault.primary:8200" {
+		t.Errorf("the performance secondary should be activated with the token, got %v", enabled["performance"])
+	}
+
+	// enabled already in the same mode, nothing to do
+	delete(enabled, "dr")
+	delete(enabled, "performance")
+	if err := v.configureReplication(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+	if len(enabled) != 0 {
+		t.Errorf("the replication shouldn't be enabled again: %v", enabled)
+	}
+
+	// promotion and demotion are manual
+	if err := v.configureReplication(testExternalConfig(t, "replication:\n  dr:\n    mode: secondary\n    token: t\n")); err == nil {
+		t.Error("a dr primary shouldn't be turned into a secondary")
+	}
+}
+
+func TestReplicationSecondaryToken(t *testing.T) {
+	server := newTestReplicationServer(t, map[string]map[string]interface{}{})
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}, keyStore: memoryKV{"vault-root": []byte("root")}}
+
+	token, err := v.ReplicationSecondaryToken("dr", "dr-east", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "activation-token" {
+		t.Errorf("unexpected activation token: %q", token)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// tokenInPath matches the legacy token endpoints which take the token in the URL path
+var tokenInPath = regexp.MustCompile(`^(/v1/auth/token/(?:lookup|renew|revoke|revoke-orphan))/.+$`)
+
+// loggingTransport is an http.RoundTripper which logs the Vault requests and responses at Debug level.
+// Only metadata is logged: bodies, tokens and query parameters (which can hold secrets) never are.
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+type requestLoggingOption bool
+
+func (co requestLoggingOption) apply(o *clientOptions) {
+	o.requestLogging = bool(co)
+}
+
+// WithRequestLogging enables logging the method, path, status, duration and
+// request ID of every Vault request at Debug level, without any secret data.
+// It only takes effect when the client is created from a config (not from a raw client).
+func WithRequestLogging() ClientOption {
+	return requestLoggingOption(true)
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !logger.IsLevelEnabled(logrus.DebugLevel) {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+
+	fields := logrus.Fields{
+		"method":   req.Method,
+		"path":     redactPath(req.URL.Path),
+		"duration": time.Since(start).String(),
+	}
+
+	if namespace := req.Header.Get(consts.NamespaceHeaderName); namespace != "" {
+		fields["namespace"] = namespace
+	}
+
+	if err != nil {
+		logger.WithFields(fields).Debugf("Vault request failed: %s", err)
+		return nil, err
+	}
+
+	fields["status"] = resp.StatusCode
+
+	if requestID := responseRequestID(resp); requestID != "" {
+		fields["request_id"] = requestID
+	}
+
+	logger.WithFields(fields).Debug("Vault request")
+
+	return resp, nil
+}
+
+func redactPath(path string) string {
+	return tokenInPath.ReplaceAllString(path, "$1/<redacted>")
+}
+
+// responseRequestID extracts the request_id field of a JSON response, leaving the body readable
+func responseRequestID(resp *http.Response) string {
+	if resp.Body == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var response struct {
+		RequestID string `json:"request_id"`
+	}
+	_ = json.Unmarshal(body, &response)
+
+	return response.RequestID
+}
+
+// setRequestLogging installs a logging transport into the config's HTTP client.
+func setRequestLogging(config *vaultapi.Config, enabled bool) {
+	if !enabled {
+		return
+	}
+
+	config.HttpClient = &http.Client{
+		Transport:     &loggingTransport{base: config.HttpClient.Transport},
+		CheckRedirect: config.HttpClient.CheckRedirect,
+		Jar:           config.HttpClient.Jar,
+		Timeout:       config.HttpClient.Timeout,
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/v1/auth/token/lookup/s.secret", expected: "/v1/auth/token/lookup/<redacted>"},
+		{path: "/v1/auth/token/renew/s.secret", expected: "/v1/auth/token/renew/<redacted>"},
+		{path: "/v1/auth/token/revoke/s.secret", expected: "/v1/auth/token/revoke/<redacted>"},
+		{path: "/v1/auth/token/revoke-orphan/s.secret", expected: "/v1/auth/token/revoke-orphan/<redacted>"},
+		{path: "/v1/auth/token/lookup-self", expected: "/v1/auth/token/lookup-self"},
+		{path: "/v1/auth/token/renew-self", expected: "/v1/auth/token/renew-self"},
+		{path: "/v1/auth/token/lookup", expected: "/v1/auth/token/lookup"},
+		{path: "/v1/secret/data/app", expected: "/v1/secret/data/app"},
+	}
+
+	for _, test := range tests {
+		if actual := redactPath(test.path); actual != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, actual)
+		}
+	}
+}
+
+func TestRequestLoggingRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"request_id": "req-1", "data": {"password": "s3cr3t-response"}}`))
+	}))
+	defer server.Close()
+
+	log, hook := test.NewNullLogger()
+	log.SetLevel(logrus.DebugLevel)
+	previous := logger
+	logger = log
+	defer func() { logger = previous }()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	setRequestLogging(config, true)
+
+	cl, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.SetToken("s.header-token")
+
+	secrets := []string{"s.header-token", "s.path-token", "s3cr3t-request", "s3cr3t-query", "s3cr3t-response"}
+
+	_, err = cl.Logical().Write("auth/token/lookup/s.path-token", map[string]interface{}{"password": "s3cr3t-request"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Logical().ReadWithData("secret/data/app", map[string][]string{"version": {"s3cr3t-query"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log entries, got %d", len(entries))
+	}
+
+	if path := entries[0].Data["path"]; path != "/v1/auth/token/lookup/<redacted>" {
+		t.Errorf("the token in the path should be redacted, got %v", path)
+	}
+	if requestID := entries[1].Data["request_id"]; requestID != "req-1" {
+		t.Errorf("the request ID should be logged, got %v", requestID)
+	}
+
+	for _, entry := range entries {
+		line, err := entry.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(line, secret) {
+				t.Errorf("log entry contains %q: %s", secret, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// mountPath matches the paths enabling secret engines and auth methods, which can't be read one by one
+var mountPath = regexp.MustCompile(`^/v1/sys/(mounts|auth)/(.+)$`)
+
+// appliedChange is a write of the configuration which has been applied, with the state of its path before it
+type appliedChange struct {
+	url    string
+	header http.Header
+	// the path didn't exist before the write
+	created bool
+	// the previous state of the path, nil if it didn't exist or it couldn't be read
+	previous map[string]interface{}
+}
+
+// changesetTransport is an http.RoundTripper which records the state of the paths of the writes before
+// they are applied, for rolling them back if the configuration fails midway
+type changesetTransport struct {
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	changes []appliedChange
+}
+
+func (t *changesetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isDryRunRead(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	exists, previous, err := t.read(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		return resp, err
+	}
+
+	// the deleted paths which didn't exist and the unreadable paths which existed can't be rolled back,
+	// the latter are recorded for reporting them
+	if req.Method != http.MethodDelete || exists {
+		t.mu.Lock()
+		t.changes = append(t.changes, appliedChange{url: req.URL.String(), header: req.Header.Clone(), created: !exists, previous: previous})
+		t.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+// read reads the state of the path before the write, the mounts are looked up in the list of the mounts
+func (t *changesetTransport) read(req *http.Request) (exists bool, current map[string]interface{}, err error) {
+	match := mountPath.FindStringSubmatch(req.URL.Path)
+	if match == nil || strings.HasSuffix(match[2], "/tune") {
+		return readCurrentState(t.base, req)
+	}
+
+	list := *req.URL
+	list.Path = "/v1/sys/" + match[1]
+	listReq := req.Clone(req.Context())
+	listReq.URL = &list
+
+	exists, mounts, err := readCurrentState(t.base, listReq)
+	if err != nil || !exists {
+		return exists, nil, err
+	}
+	_, exists = mounts[strings.TrimSuffix(match[2], "/")+"/"]
+	return exists, nil, nil
+}
+
+// rollback undoes the recorded changes in reverse order: the created paths are deleted, the previous state
+// of the updated and deleted paths is written back. It returns the paths which couldn't be rolled back.
+func (t *changesetTransport) rollback() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var failed []string
+	for i := len(t.changes) - 1; i >= 0; i-- {
+		change := t.changes[i]
+
+		path := change.url
+		if u, err := url.Parse(change.url); err == nil {
+			path = strings.TrimPrefix(u.Path, "/v1/")
+		}
+
+		if err := t.undo(change); err != nil {
+			logrus.WithField("path", path).Warnf("error rolling back configuration change: %s", err.Error())
+			failed = append(failed, path)
+			continue
+		}
+
+		logrus.WithField("path", path).Info("configuration change rolled back")
+	}
+	t.changes = nil
+
+	return failed
+}
+
+func (t *changesetTransport) undo(change appliedChange) error {
+	method := http.MethodDelete
+	var body io.Reader
+
+	if !change.created {
+		if change.previous == nil {
+			return errors.New("the previous state is unknown") // nolint:goerr113
+		}
+		previous, err := json.Marshal(change.previous)
+		if err != nil {
+			return errors.Wrap(err, "error encoding previous state")
+		}
+		method = http.MethodPut
+		body = bytes.NewReader(previous)
+	}
+
+	req, err := http.NewRequest(method, change.url, body)
+	if err != nil {
+		return errors.Wrap(err, "error creating rollback request")
+	}
+	req.Header = change.header.Clone()
+	req.Header.Del("Content-Length")
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// configureWithRollback applies the configuration like Configure, but rolls the applied changes back
+// on the best-effort basis if it fails, so Vault isn't left half-configured
+func (v *vault) configureWithRollback(config *viper.Viper) error {
+	clientConfig := vaultapi.DefaultConfig()
+	if clientConfig.Error != nil {
+		return clientConfig.Error
+	}
+	clientConfig.Address = ConfigAddress(v.cl.Address())
+	clientConfig.HttpClient.Transport.(*http.Transport).TLSHandshakeTimeout = 5 * time.Second
+
+	transport := &changesetTransport{base: clientConfig.HttpClient.Transport}
+	clientConfig.HttpClient.Transport = transport
+
+	cl, err := vaultapi.NewClient(clientConfig)
+	if err != nil {
+		return errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetHeaders(v.cl.Headers())
+	cl.SetToken(v.cl.Token())
+
+	rv := *v
+	rv.cl = cl
+
+	err = rv.applyConfigureSteps(config, configureSteps, v.config.ConfigureConcurrency)
+	if err == nil {
+		return nil
+	}
+
+	logrus.Warnf("configuration failed, rolling back the applied changes: %s", err.Error())
+
+	if failed := transport.rollback(); len(failed) > 0 {
+		return errors.Wrapf(err, "configuration failed and the changes of %d paths couldn't be rolled back (%s)", len(failed), strings.Join(failed, ", "))
+	}
+
+	return errors.Wrap(err, "configuration failed and the applied changes have been rolled back")
+}
@@ -0,0 +1,128 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// newTestPathServer simulates a Vault storing the written data of the paths, the mounts are listed under sys/mounts
+func newTestPathServer(t *testing.T, paths map[string]map[string]interface{}) *httptest.Server {
+	var mu sync.Mutex
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+		switch r.Method {
+		case http.MethodGet, "LIST":
+			if path == "sys/mounts" {
+				mounts := map[string]interface{}{}
+				for p := range paths {
+					if strings.HasPrefix(p, "sys/mounts/") {
+						mounts[strings.TrimPrefix(p, "sys/mounts/")+"/"] = map[string]interface{}{}
+					}
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": mounts})
+				return
+			}
+			if strings.HasPrefix(path, "sys/mounts/") {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			data, ok := paths[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		case http.MethodPut, http.MethodPost:
+			var data map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&data)
+			if path == "auth/failing/config" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			paths[path] = data
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			delete(paths, path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+}
+
+func TestChangesetTransportRollback(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/policy/existing": {"policy": "old"},
+		"sys/policy/obsolete": {"policy": "obsolete"},
+	}
+	original := map[string]map[string]interface{}{}
+	for path, data := range paths {
+		original[path] = data
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	transport := &changesetTransport{base: http.DefaultTransport}
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	config.HttpClient.Transport = transport
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, policy := range map[string]string{"sys/policy/existing": "new", "sys/policy/created": "created"} {
+		if _, err := cl.Logical().Write(path, map[string]interface{}{"policy": policy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cl.Logical().Delete("sys/policy/obsolete"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.Sys().Mount("kv", &api.MountInput{Type: "kv"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Logical().Write("auth/failing/config", map[string]interface{}{}); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	if len(transport.changes) != 4 {
+		t.Fatalf("expected 4 recorded changes, got %d", len(transport.changes))
+	}
+
+	if failed := transport.rollback(); len(failed) > 0 {
+		t.Errorf("unexpected paths which couldn't be rolled back: %v", failed)
+	}
+
+	if !reflect.DeepEqual(paths, original) {
+		t.Errorf("unexpected paths after rollback: %v", paths)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+const otpAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// generateOTP returns a random base62 one-time password for the generate-root workflow
+func generateOTP(length int) (string, error) {
+	otp := make([]byte, length)
+	max := big.NewInt(int64(len(otpAlphabet)))
+	for i := range otp {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "error generating OTP")
+		}
+		otp[i] = otpAlphabet[n.Int64()]
+	}
+	return string(otp), nil
+}
+
+// decodeRootToken decodes the encoded token of the generate-root workflow with the OTP
+func decodeRootToken(encodedToken, otp string) (string, error) {
+	tokenBytes, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encodedToken, "="))
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding root token")
+	}
+
+	if len(tokenBytes) != len(otp) {
+		return "", errors.Errorf("length of the encoded root token and the OTP differ [%d != %d]", len(tokenBytes), len(otp))
+	}
+
+	for i := range tokenBytes {
+		tokenBytes[i] ^= otp[i]
+	}
+
+	return string(tokenBytes), nil
+}
+
+// tokenAccessor returns the accessor of the token, to identify it in the logs without revealing it
+func tokenAccessor(cl *api.Client, token string) (string, error) {
+	secret, err := cl.Auth().Token().Lookup(token)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("empty response while looking up token") // nolint:goerr113
+	}
+	return cast.ToString(secret.Data["accessor"]), nil
+}
+
+// generateRoot runs the generate-root workflow with the stored unseal keys (or recovery keys with auto-unseal)
+func (v *vault) generateRoot() (string, error) {
+	sealStatus, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return "", errors.Wrap(err, "error checking status")
+	}
+	if !sealStatus.Initialized || sealStatus.Sealed {
+		return "", errors.New("vault has to be initialized and unsealed for generating a root token") // nolint:goerr113
+	}
+
+	keyForID := v.unsealKeyForID
+	if sealStatus.Type != "" && sealStatus.Type != "shamir" {
+		keyForID = v.recoveryKeyForID
+	}
+
+	keys, err := v.storedKeys(keyForID)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := v.cl.Sys().GenerateRootStatus()
+	if err != nil {
+		return "", errors.Wrap(err, "error checking root token generation status")
+	}
+	if status.OTPLength == 0 {
+		return "", errors.New("vault doesn't support OTP based root token generation") // nolint:goerr113
+	}
+	if status.Started {
+		logrus.Warn("cancelling root token generation which is already in progress")
+		if err := v.cl.Sys().GenerateRootCancel(); err != nil {
+			return "", errors.Wrap(err, "error cancelling root token generation")
+		}
+	}
+
+	otp, err := generateOTP(status.OTPLength)
+	if err != nil {
+		return "", err
+	}
+
+	status, err = v.cl.Sys().GenerateRootInit(otp, "")
+	if err != nil {
+		return "", errors.Wrap(err, "error initializing root token generation")
+	}
+
+	for _, key := range keys {
+		status, err = v.cl.Sys().GenerateRootUpdate(key, status.Nonce)
+		if err != nil {
+			_ = v.cl.Sys().GenerateRootCancel()
+			return "", errors.Wrap(err, "error submitting key for root token generation")
+		}
+		if status.Complete {
+			break
+		}
+	}
+
+	if !status.Complete {
+		_ = v.cl.Sys().GenerateRootCancel()
+		return "", errors.Errorf("the %d stored keys didn't complete the root token generation", len(keys))
+	}
+
+	encodedToken := status.EncodedToken
+	if encodedToken == "" {
+		encodedToken = status.EncodedRootToken
+	}
+
+	return decodeRootToken(encodedToken, otp)
+}
+
+// RotateRoot generates a new root token with the stored keys, replaces the root token in the
+// key store with it, then revokes the previous root token (and its child tokens).
+// The new token is only stored after it has been verified, and the previous one is only
+// revoked after the new one has been stored, so the key store always holds a valid root token.
+func (v *vault) RotateRoot() error {
+	unlock, err := v.lockKeyStore("rotate-root")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			logrus.Warnf("error unlocking key store: %s", err.Error())
+		}
+	}()
+
+	rootTokenKey := v.rootTokenKey()
+
+	var previousToken string
+	raw, err := v.keyStore.Get(rootTokenKey)
+	if err != nil && !isNotFoundError(err) {
+		return errors.Wrapf(err, "unable to get key '%s'", rootTokenKey)
+	}
+	if err == nil {
+		previousToken = string(raw)
+	}
+
+	token, err := v.generateRoot()
+	if err != nil {
+		return err
+	}
+
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return errors.Wrap(err, "error creating vault client")
+	}
+	cl.SetToken(token)
+
+	accessor, err := tokenAccessor(cl, token)
+	if err != nil {
+		return errors.Wrap(err, "error verifying the new root token")
+	}
+
+	audit := logrus.WithFields(logrus.Fields{
+		"audit":       true,
+		"operation":   "rotate-root",
+		"key":         rootTokenKey,
+		"newAccessor": accessor,
+		"time":        time.Now().UTC().Format(time.RFC3339),
+	})
+
+	var previousAccessor string
+	if previousToken != "" {
+		previousAccessor, err = tokenAccessor(cl, previousToken)
+		if err != nil {
+			audit.Warnf("the previous root token is not valid anymore: %s", err.Error())
+			previousToken = ""
+		} else {
+			audit = audit.WithField("previousAccessor", previousAccessor)
+		}
+	}
+
+	if err := v.keyStore.Set(rootTokenKey, []byte(token)); err != nil {
+		// don't leave a valid root token behind which isn't stored anywhere
+		if revokeErr := cl.Auth().Token().RevokeSelf(""); revokeErr != nil {
+			audit.Errorf("error revoking the new root token after failing to store it: %s", revokeErr.Error())
+		}
+		return errors.Wrapf(err, "error storing root token in key '%s'", rootTokenKey)
+	}
+
+	audit.Info("new root token stored in key store")
+
+	if previousToken != "" {
+		if err := cl.Auth().Token().RevokeTree(previousToken); err != nil {
+			return errors.Wrapf(err, "error revoking the previous root token with accessor '%s'", previousAccessor)
+		}
+		audit.Info("previous root token revoked")
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeRootToken(t *testing.T) {
+	const token = "s.OHe2KxBXY2sJ7mx5W3MPKTlH"
+
+	otp, err := generateOTP(len(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Vault encodes the root token by XORing it with the OTP
+	encoded := []byte(token)
+	for i := range encoded {
+		encoded[i] ^= otp[i]
+	}
+
+	decoded, err := decodeRootToken(base64.RawStdEncoding.EncodeToString(encoded), otp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != token {
+		t.Errorf("expected %q, got %q", token, decoded)
+	}
+
+	if _, err := decodeRootToken(base64.RawStdEncoding.EncodeToString(encoded), otp[1:]); err == nil {
+		t.Error("an OTP with a different length must be rejected")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// DefaultSealStatusCache is the seal status cache shared by the clients of this process.
+// It is disabled (nil) unless the VAULT_SEAL_STATUS_CACHE_TTL environment variable sets its TTL,
+// so the seal status is read from Vault on every call by default.
+var DefaultSealStatusCache = sealStatusCacheFromEnv()
+
+func sealStatusCacheFromEnv() *SealStatusCache {
+	env, ok := os.LookupEnv("VAULT_SEAL_STATUS_CACHE_TTL")
+	if !ok {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(env)
+	if err != nil {
+		logger.Warnf("failed to parse VAULT_SEAL_STATUS_CACHE_TTL, the seal status cache is disabled: %s", err)
+		return nil
+	}
+
+	return NewSealStatusCache(ttl)
+}
+
+type sealStatusEntry struct {
+	status  *api.SealStatusResponse
+	err     error
+	fetched time.Time
+	done    chan struct{}
+}
+
+// SealStatusCache caches the seal status of Vault servers by address for a TTL.
+// Concurrent lookups of the same address are deduplicated into a single request,
+// so even with a zero TTL there is at most one request in flight per address.
+type SealStatusCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*sealStatusEntry
+}
+
+// NewSealStatusCache returns a new SealStatusCache with the given TTL.
+func NewSealStatusCache(ttl time.Duration) *SealStatusCache {
+	return &SealStatusCache{
+		ttl:     ttl,
+		entries: map[string]*sealStatusEntry{},
+	}
+}
+
+// SetTTL changes the TTL of the cached seal statuses.
+func (c *SealStatusCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+}
+
+// SealStatus returns the seal status of the server the client points to,
+// from the cache if it is fresh enough, otherwise from sys/seal-status.
+// A nil cache always reads the seal status from Vault.
+func (c *SealStatusCache) SealStatus(cl *api.Client) (*api.SealStatusResponse, error) {
+	if c == nil {
+		return cl.Sys().SealStatus()
+	}
+
+	address := cl.Address()
+
+	c.mu.Lock()
+	entry, ok := c.entries[address]
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.err != nil || time.Since(entry.fetched) >= c.ttl {
+				ok = false
+			}
+		default:
+			// a request is already in flight, wait for it below
+		}
+	}
+
+	if !ok {
+		entry = &sealStatusEntry{done: make(chan struct{})}
+		c.entries[address] = entry
+		c.mu.Unlock()
+
+		entry.status, entry.err = cl.Sys().SealStatus()
+		entry.fetched = time.Now()
+		close(entry.done)
+
+		return entry.status, entry.err
+	}
+	c.mu.Unlock()
+
+	<-entry.done
+
+	return entry.status, entry.err
+}
+
+// Invalidate drops the cached seal status of an address, for example after an unseal.
+func (c *SealStatusCache) Invalidate(address string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[address]; ok {
+		select {
+		case <-entry.done:
+			delete(c.entries, address)
+		default:
+			// keep the in flight request, the waiters are still depending on it
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// sentinelPolicyTypes are the Sentinel policy types of Vault Enterprise, endpoint governing (egp) and
+// role governing (rgp) policies, which can be configured in the policies section besides the ACL policies:
+//
+//	policies:
+//	  - name: business-hours
+//	    type: egp
+//	    enforcement_level: soft-mandatory
+//	    paths: ["secret/*"]
+//	    rules: |
+//	      import "time"
+//	      main = rule { time.now.hour >= 8 and time.now.hour < 18 }
+var sentinelPolicyTypes = []string{"egp", "rgp"}
+
+// sentinelEnforcementLevels are the accepted enforcement levels of the Sentinel policies
+var sentinelEnforcementLevels = map[string]bool{
+	"advisory":       true,
+	"soft-mandatory": true,
+	"hard-mandatory": true,
+}
+
+// policyType returns the type of a configured policy, which defaults to acl
+func policyType(policy map[string]interface{}) string {
+	if policyType := cast.ToString(policy["type"]); policyType != "" {
+		return policyType
+	}
+	return "acl"
+}
+
+func isSentinelPolicyType(policyType string) bool {
+	for _, sentinelPolicyType := range sentinelPolicyTypes {
+		if policyType == sentinelPolicyType {
+			return true
+		}
+	}
+	return false
+}
+
+// configureSentinelPolicy writes an EGP or RGP policy, the enforcement level defaults to hard-mandatory
+func (v *vault) configureSentinelPolicy(policyType, name string, policy map[string]interface{}) error {
+	enforcementLevel := cast.ToString(policy["enforcement_level"])
+	if enforcementLevel == "" {
+		enforcementLevel = "hard-mandatory"
+	}
+	if !sentinelEnforcementLevels[enforcementLevel] {
+		return errors.Errorf("unsupported enforcement level of %s policy %s: %s", policyType, name, enforcementLevel)
+	}
+
+	data := map[string]interface{}{
+		"policy":            cast.ToString(policy["rules"]),
+		"enforcement_level": enforcementLevel,
+	}
+
+	if policyType == "egp" {
+		paths := cast.ToStringSlice(policy["paths"])
+		if len(paths) == 0 {
+			return errors.Errorf("egp policy %s has no paths", name)
+		}
+		data["paths"] = paths
+	}
+
+	_, err := v.cl.Logical().Write(fmt.Sprintf("sys/policies/%s/%s", policyType, name), data)
+	return errors.Wrapf(err, "error putting %s policy %s into vault", policyType, name)
+}
+
+// purgeUnmanagedSentinelPolicies deletes the EGP and RGP policies which are not configured,
+// without Vault Enterprise there are none
+func (v *vault) purgeUnmanagedSentinelPolicies(managed map[string]bool) error {
+	for _, policyType := range sentinelPolicyTypes {
+		secret, err := v.cl.Logical().List("sys/policies/" + policyType)
+		if err != nil {
+			return errors.Wrapf(err, "error listing %s policies", policyType)
+		}
+		if secret == nil || secret.Data == nil {
+			continue
+		}
+
+		for _, name := range cast.ToStringSlice(secret.Data["keys"]) {
+			if managed[policyType+"/"+name] {
+				continue
+			}
+
+			logrus.Infof("deleting unmanaged %s policy: %s", policyType, name)
+
+			if _, err := v.cl.Logical().Delete(fmt.Sprintf("sys/policies/%s/%s", policyType, name)); err != nil {
+				return errors.Wrapf(err, "error deleting unmanaged %s policy %s", policyType, name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureSentinelPolicies(t *testing.T) {
+	written := map[string]map[string]interface{}{}
+	var deleted []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		var response interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /v1/sys/policies/acl/reader", "PUT /v1/sys/policies/egp/business-hours", "PUT /v1/sys/policies/rgp/mfa":
+			written[r.URL.Path] = body
+		case "GET /v1/sys/policies/acl":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"root", "default", "reader"}}}
+		case "GET /v1/sys/policies/egp":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"business-hours"}}}
+		case "GET /v1/sys/policies/rgp":
+			response = map[string]interface{}{"data": map[string]interface{}{"keys": []string{"mfa", "unmanaged"}}}
+		case "DELETE /v1/sys/policies/rgp/unmanaged":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if response == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &vault{cl: cl, config: &Config{}}
+
+	externalConfig := viper.New()
+	externalConfig.SetConfigType("yaml")
+	err = externalConfig.ReadConfig(strings.NewReader(`
+purgeUnmanagedConfig:
+  policies: true
+policies:
+  - name: reader
+    rules: path "secret/*" { capabilities = ["read"] }
+  - name: business-hours
+    type: egp
+    enforcement_level: soft-mandatory
+    paths: ["secret/*"]
+    rules: main = rule { true }
+  - name: mfa
+    type: rgp
+    rules: main = rule { true }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.configurePolicies(externalConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]interface{}{
+		"/v1/sys/policies/acl/reader": {"policy": "path \"secret/*\" {\n  capabilities = [\"read\"]\n}\n"},
+		"/v1/sys/policies/egp/business-hours": {
+			"policy":            "main = rule { true }",
+			"enforcement_level": "soft-mandatory",
+			"paths":             []interface{}{"secret/*"},
+		},
+		"/v1/sys/policies/rgp/mfa": {
+			"policy":            "main = rule { true }",
+			"enforcement_level": "hard-mandatory",
+		},
+	}
+	if !reflect.DeepEqual(expected, written) {
+		t.Errorf("expected policies %v, got %v", expected, written)
+	}
+
+	if expected := []string{"/v1/sys/policies/rgp/unmanaged"}; !reflect.DeepEqual(expected, deleted) {
+		t.Errorf("expected %v to be deleted, got %v", expected, deleted)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultGeneratedPasswordLength = 32
+	defaultGeneratedRSAKeyBits     = 2048
+	defaultGeneratedECDSAKeyCurve  = "P256"
+)
+
+// the public keys of the generated key pairs are stored next to the private keys with this suffix
+const generatedPublicKeySuffix = ".pub"
+
+// startupSecretGenerator generates the values of a key of a startup secret from the parameters of the generator
+type startupSecretGenerator func(v *vault, key string, params map[string]interface{}) (map[string]interface{}, error)
+
+// startupSecretGenerators are the value generators of the 'kv' startup secrets by lowercase name
+var startupSecretGenerators = map[string]startupSecretGenerator{
+	"randompassword": generateRandomPassword,
+	"rsakeypair":     generateRSAKeyPair,
+	"ecdsakeypair":   generateECDSAKeyPair,
+	"uuid":           generateUUID,
+}
+
+// generateStartupSecretValues replaces the generated values of the data of a 'kv' startup secret. The values are
+// generated only once, if the key exists in the current secret already its current value (and public key) is kept:
+//
+//	data:
+//	  data:
+//	    password:
+//	      generate: randomPassword
+//	      policy: app-passwords # a password policy of Vault, or length: 32
+//	    signing-key:
+//	      generate: rsaKeyPair # stored as signing-key and signing-key.pub, bits: 2048
+//	    token-key:
+//	      generate: ecdsaKeyPair # curve: P256 (P224, P384, P521)
+//	    instance-id:
+//	      generate: uuid
+func (v *vault) generateStartupSecretValues(declared, current map[string]interface{}) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	for key, value := range declared {
+		// the maps of the YAML lists may not have string keys
+		params, err := cast.ToStringMapE(value)
+		if err != nil || params["generate"] == nil {
+			data[key] = value
+			continue
+		}
+
+		if existing, ok := current[key]; ok {
+			data[key] = existing
+			if public, ok := current[key+generatedPublicKeySuffix]; ok {
+				data[key+generatedPublicKeySuffix] = public
+			}
+			continue
+		}
+
+		name, err := cast.ToStringE(params["generate"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting the generator of '%s'", key)
+		}
+
+		generator, ok := startupSecretGenerators[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown generator '%s' of '%s', only randomPassword, rsaKeyPair, ecdsaKeyPair or uuid", name, key)
+		}
+
+		generated, err := generator(v, key, params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error generating '%s' with %s", key, name)
+		}
+
+		for key, value := range generated {
+			data[key] = value
+		}
+	}
+
+	return data, nil
+}
+
+// generateRandomPassword generates a password with the password policy of Vault, or a random base62 one of length
+func generateRandomPassword(v *vault, key string, params map[string]interface{}) (map[string]interface{}, error) {
+	policy, err := getOrDefaultString(params, "policy")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting policy")
+	}
+
+	if policy != "" {
+		secret, err := v.cl.Logical().Read(fmt.Sprintf("sys/policies/password/%s/generate", policy))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error generating password with policy '%s'", policy)
+		}
+		if secret == nil || secret.Data == nil || secret.Data["password"] == nil {
+			return nil, errors.Errorf("password policy '%s' generated no password", policy)
+		}
+		return map[string]interface{}{key: cast.ToString(secret.Data["password"])}, nil
+	}
+
+	length := defaultGeneratedPasswordLength
+	if raw, ok := params["length"]; ok {
+		length, err = cast.ToIntE(raw)
+		if err != nil || length <= 0 {
+			return nil, errors.Errorf("invalid password length: %v", raw)
+		}
+	}
+
+	password, err := generateOTP(length)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{key: password}, nil
+}
+
+// keyPairValues returns the PEM encoded private key under key, and the public key under key.pub
+func keyPairValues(key string, publicKey interface{}, privateKeyType string, privateKeyBytes []byte) (map[string]interface{}, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding public key")
+	}
+
+	return map[string]interface{}{
+		key:                            string(pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: privateKeyBytes})),
+		key + generatedPublicKeySuffix: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})),
+	}, nil
+}
+
+func generateRSAKeyPair(_ *vault, key string, params map[string]interface{}) (map[string]interface{}, error) {
+	bits := defaultGeneratedRSAKeyBits
+	if raw, ok := params["bits"]; ok {
+		var err error
+		bits, err = cast.ToIntE(raw)
+		if err != nil || bits < 2048 {
+			return nil, errors.Errorf("invalid RSA key size, at least 2048 bits are required: %v", raw)
+		}
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating RSA key")
+	}
+
+	return keyPairValues(key, &privateKey.PublicKey, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(privateKey))
+}
+
+func generateECDSAKeyPair(_ *vault, key string, params map[string]interface{}) (map[string]interface{}, error) {
+	curveName, err := getOrDefaultString(params, "curve")
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting curve")
+	}
+	if curveName == "" {
+		curveName = defaultGeneratedECDSAKeyCurve
+	}
+
+	curves := map[string]elliptic.Curve{
+		"P224": elliptic.P224(),
+		"P256": elliptic.P256(),
+		"P384": elliptic.P384(),
+		"P521": elliptic.P521(),
+	}
+	curve, ok := curves[strings.ToUpper(strings.ReplaceAll(curveName, "-", ""))]
+	if !ok {
+		return nil, errors.Errorf("unknown ECDSA curve '%s', only P224, P256, P384 or P521", curveName)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating ECDSA key")
+	}
+
+	privateKeyBytes, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding ECDSA key")
+	}
+
+	return keyPairValues(key, &privateKey.PublicKey, "EC PRIVATE KEY", privateKeyBytes)
+}
+
+// generateUUID generates a random (version 4) UUID
+func generateUUID(_ *vault, key string, _ map[string]interface{}) (map[string]interface{}, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "error generating UUID")
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return map[string]interface{}{key: fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])}, nil
+}
@@ -0,0 +1,117 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestGenerateStartupSecretValues(t *testing.T) {
+	paths := map[string]map[string]interface{}{
+		"sys/policies/password/app/generate": {"password": "from-policy"},
+		"kv/app":                             {"instance-id": "existing"},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	secret := map[string]interface{}{
+		"type": "kv",
+		"path": "kv/app",
+		"data": map[string]interface{}{
+			"username":    "app",
+			"password":    map[interface{}]interface{}{"generate": "randomPassword", "policy": "app"},
+			"api-key":     map[string]interface{}{"generate": "randomPassword", "length": 16},
+			"signing-key": map[string]interface{}{"generate": "rsaKeyPair"},
+			"token-key":   map[string]interface{}{"generate": "ecdsaKeyPair", "curve": "P384"},
+			"instance-id": map[string]interface{}{"generate": "uuid"},
+			"request-id":  map[string]interface{}{"generate": "uuid"},
+		},
+	}
+
+	path, data, err := readStartupSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.writeKVStartupSecret(secret, path, data); err != nil {
+		t.Fatal(err)
+	}
+
+	written := paths["kv/app"]
+
+	if written["username"] != "app" || written["password"] != "from-policy" {
+		t.Errorf("unexpected values: %v", written)
+	}
+	if password, _ := written["api-key"].(string); len(password) != 16 {
+		t.Errorf("the password should be 16 characters long: %q", password)
+	}
+	if written["instance-id"] != "existing" {
+		t.Errorf("the existing value shouldn't be regenerated: %v", written["instance-id"])
+	}
+	if id, _ := written["request-id"].(string); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("invalid UUID: %q", id)
+	}
+
+	for _, key := range []string{"signing-key", "token-key"} {
+		for _, k := range []string{key, key + ".pub"} {
+			value, _ := written[k].(string)
+			if block, _ := pem.Decode([]byte(value)); block == nil {
+				t.Errorf("%s should be PEM encoded: %q", k, value)
+			}
+		}
+	}
+
+	block, _ := pem.Decode([]byte(written["token-key"].(string)))
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Curve.Params().Name != "P-384" {
+		t.Errorf("unexpected curve: %s", key.Curve.Params().Name)
+	}
+
+	// nothing is regenerated on re-apply
+	previous := map[string]interface{}{}
+	for key, value := range written {
+		previous[key] = value
+	}
+	if err := v.writeKVStartupSecret(secret, path, data); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range previous {
+		if paths["kv/app"][key] != value {
+			t.Errorf("%s was regenerated", key)
+		}
+	}
+
+	secret["data"] = map[string]interface{}{"unknown": map[string]interface{}{"generate": "magic"}}
+	path, data, _ = readStartupSecret(secret)
+	if err := v.writeKVStartupSecret(secret, path, data); err == nil {
+		t.Error("unknown generators should fail")
+	}
+}
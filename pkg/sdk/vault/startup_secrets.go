@@ -0,0 +1,135 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// kvVersion returns the version of the KV secrets engine mounted at the path, the payload of the
+// startup secret decides it if the mount can't be looked up (KV version 2 wraps the secret in data)
+func (v *vault) kvVersion(path string, declared map[string]interface{}) int {
+	mount, err := v.cl.Logical().Read("sys/internal/ui/mounts/" + path)
+	if err == nil && mount != nil && mount.Data != nil {
+		options, _ := cast.ToStringMapStringE(mount.Data["options"])
+		if options["version"] == "2" {
+			return 2
+		}
+		return 1
+	}
+
+	if _, ok := declared["data"].(map[string]interface{}); ok {
+		return 2
+	}
+	return 1
+}
+
+// currentKVSecret returns the data and the version of the secret at the path, the version is 0 in KV version 1
+func (v *vault) currentKVSecret(path string, version int) (map[string]interface{}, int, error) {
+	secret, err := v.cl.Logical().Read(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+
+	if version == 1 {
+		return secret.Data, 0, nil
+	}
+
+	// the metadata is returned for the deleted secrets too, the check-and-set has to use its version
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	current, _ := secret.Data["data"].(map[string]interface{})
+	number, _ := metadata["version"].(json.Number)
+	currentVersion, _ := number.Int64()
+	return current, int(currentVersion), nil
+}
+
+// writeKVStartupSecret writes a 'kv' startup secret. With preserveExisting an existing secret isn't
+// overwritten, with patch only the declared keys of the secret are written, the others are kept.
+// The generated values are generated only if the secret doesn't have them yet.
+// In KV version 2 the write checks-and-sets the version read, so the changes made in the meantime
+// aren't lost, and the mounts with cas_required are supported, unless the cas option is declared.
+func (v *vault) writeKVStartupSecret(startupSecret map[string]interface{}, path string, data map[string]interface{}) error {
+	preserveExisting, err := getOrDefaultBool(startupSecret, "preserveExisting")
+	if err != nil {
+		return errors.Wrapf(err, "error getting preserveExisting for startup 'kv' secret '%s'", path)
+	}
+	patch, err := getOrDefaultBool(startupSecret, "patch")
+	if err != nil {
+		return errors.Wrapf(err, "error getting patch for startup 'kv' secret '%s'", path)
+	}
+
+	version := v.kvVersion(strings.TrimPrefix(path, "/"), data)
+
+	current, currentVersion, err := v.currentKVSecret(path, version)
+	if err != nil {
+		return errors.Wrapf(err, "error reading startup 'kv' secret '%s'", path)
+	}
+
+	if preserveExisting && current != nil {
+		logrus.Debugf("startup 'kv' secret '%s' exists, preserving it", path)
+		return nil
+	}
+
+	declared := data
+	if version == 2 {
+		declared, err = getOrDefaultStringMap(data, "data")
+		if err != nil {
+			return errors.Wrapf(err, "error getting data for startup 'kv' secret '%s'", path)
+		}
+	}
+
+	declared, err = v.generateStartupSecretValues(declared, current)
+	if err != nil {
+		return errors.Wrapf(err, "error generating data for startup 'kv' secret '%s'", path)
+	}
+
+	if patch {
+		merged := map[string]interface{}{}
+		for key, value := range current {
+			merged[key] = value
+		}
+		for key, value := range declared {
+			merged[key] = value
+		}
+		declared = merged
+	}
+
+	payload := declared
+	if version == 2 {
+		options, err := getOrDefaultStringMap(data, "options")
+		if err != nil {
+			return errors.Wrapf(err, "error getting options for startup 'kv' secret '%s'", path)
+		}
+		if _, ok := options["cas"]; !ok {
+			options["cas"] = currentVersion
+		}
+		payload = map[string]interface{}{"data": declared, "options": options}
+	}
+
+	_, err = v.cl.Logical().Write(path, payload)
+	if err != nil {
+		return errors.Wrapf(err, "error writing data for startup 'kv' secret '%s'", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestWriteKVStartupSecret(t *testing.T) {
+	kv2 := map[string]interface{}{"path": "secret/", "options": map[string]interface{}{"version": "2"}}
+	paths := map[string]map[string]interface{}{
+		"sys/internal/ui/mounts/secret/data/app":       kv2,
+		"sys/internal/ui/mounts/secret/data/preserved": kv2,
+		"sys/internal/ui/mounts/secret/data/new":       kv2,
+		"secret/data/app": {
+			"data":     map[string]interface{}{"kept": "old", "replaced": "old"},
+			"metadata": map[string]interface{}{"version": 3},
+		},
+		"secret/data/preserved": {
+			"data":     map[string]interface{}{"kept": "old"},
+			"metadata": map[string]interface{}{"version": 1},
+		},
+		"kv/app": {"kept": "old"},
+	}
+
+	server := newTestPathServer(t, paths)
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vault{cl: cl}
+
+	secrets := []map[string]interface{}{
+		{"type": "kv", "path": "secret/data/app", "patch": true, "data": map[string]interface{}{"data": map[string]interface{}{"replaced": "new"}}},
+		{"type": "kv", "path": "secret/data/preserved", "preserveExisting": true, "data": map[string]interface{}{"data": map[string]interface{}{"kept": "new"}}},
+		{"type": "kv", "path": "secret/data/new", "preserveExisting": true, "data": map[string]interface{}{"data": map[string]interface{}{"created": "new"}}},
+		{"type": "kv", "path": "kv/app", "patch": true, "data": map[string]interface{}{"added": "new"}},
+	}
+	for _, secret := range secrets {
+		path, data, err := readStartupSecret(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.writeKVStartupSecret(secret, path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]map[string]interface{}{
+		"secret/data/app": {
+			"data":    map[string]interface{}{"kept": "old", "replaced": "new"},
+			"options": map[string]interface{}{"cas": float64(3)},
+		},
+		"secret/data/preserved": paths["secret/data/preserved"],
+		"secret/data/new": {
+			"data":    map[string]interface{}{"created": "new"},
+			"options": map[string]interface{}{"cas": float64(0)},
+		},
+		"kv/app": {"kept": "old", "added": "new"},
+	}
+	for path, want := range expected {
+		if got := paths[path]; !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
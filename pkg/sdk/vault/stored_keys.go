@@ -0,0 +1,107 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// StoredKeys returns the names of the keys which are written to the key store by bank-vaults:
+// the root token and its wrapped copy, the test key, the unseal and recovery keys with their
+// PGP encrypted and pending rekey copies, the userpass fingerprint key and the password rotation
+// records of the userpass users in the given Vault configurations.
+// The indexed keys are listed until the first missing index, the others even if they are missing.
+func StoredKeys(store KVService, configs ...*viper.Viper) ([]string, error) {
+	v := &vault{keyStore: store}
+
+	keys := []string{v.rootTokenKey(), v.wrappedRootTokenKey(), v.testKey(), userpassFingerprintKey}
+
+	unsealRekey, recoveryRekey := rekeyProcess{name: "unseal"}, rekeyProcess{name: "recovery"}
+	for _, keyForID := range []func(int) string{
+		v.unsealKeyForID,
+		v.unsealPGPKeyForID,
+		v.recoveryKeyForID,
+		v.recoveryPGPKeyForID,
+		func(i int) string { return v.rekeyPendingKeyForID(unsealRekey, i) },
+		func(i int) string { return v.rekeyPendingKeyForID(recoveryRekey, i) },
+	} {
+		for i := 0; ; i++ {
+			key := keyForID(i)
+			_, err := store.Get(key)
+			if isNotFoundError(err) {
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading key '%s'", key)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, config := range configs {
+		userpassKeys, err := userpassRotationKeys(config)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range userpassKeys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// userpassRotationKeys returns the password rotation record keys of the userpass users in the configuration
+func userpassRotationKeys(config *viper.Viper) ([]string, error) {
+	authMethods := []map[string]interface{}{}
+	if err := config.UnmarshalKey("auth", &authMethods); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling vault auth methods config")
+	}
+
+	var keys []string
+	for _, authMethod := range authMethods {
+		if cast.ToString(authMethod["type"]) != "userpass" {
+			continue
+		}
+
+		path := "userpass"
+		if pathOverwrite, ok := authMethod["path"]; ok {
+			path = strings.Trim(cast.ToString(pathOverwrite), "/")
+		}
+
+		users, err := cast.ToSliceE(authMethod["users"])
+		if err != nil {
+			return nil, errors.Wrap(err, "error finding users block for userpass")
+		}
+
+		for _, userRaw := range users {
+			user, err := cast.ToStringMapE(userRaw)
+			if err != nil {
+				return nil, errors.Wrap(err, "error converting user for userpass")
+			}
+			keys = append(keys, userpassRotationKey(path, cast.ToString(user["username"])))
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestStoredKeys(t *testing.T) {
+	store := memoryKV{
+		"vault-root":           []byte("root"),
+		"vault-unseal-0":       []byte("unseal-0"),
+		"vault-unseal-1":       []byte("unseal-1"),
+		"vault-unseal-3":       []byte("after a missing index"),
+		"vault-unseal-pgp-0":   []byte("unseal-pgp-0"),
+		"vault-recovery-pgp-0": []byte("recovery-pgp-0"),
+		"vault-rekey-unseal-0": []byte("rekey-unseal-0"),
+	}
+
+	config := viper.New()
+	config.SetConfigType("yaml")
+	err := config.ReadConfig(strings.NewReader(`
+auth:
+  - type: userpass
+    path: break/glass
+    users:
+      - username: emergency
+  - type: kubernetes
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := StoredKeys(store, config, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"vault-root",
+		"vault-root-wrapped",
+		"vault-test",
+		"vault-userpass-fingerprint-key",
+		"vault-unseal-0",
+		"vault-unseal-1",
+		"vault-unseal-pgp-0",
+		"vault-recovery-pgp-0",
+		"vault-rekey-unseal-0",
+		"vault-userpass-break-glass-emergency",
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// TokenEventType is the type of a token lifecycle event.
+type TokenEventType string
+
+const (
+	// TokenLoggedIn is emitted when the first Vault token is received after login
+	TokenLoggedIn TokenEventType = "logged_in"
+	// TokenRenewed is emitted when the Vault token has been renewed
+	TokenRenewed TokenEventType = "renewed"
+	// TokenRenewalFailed is emitted when the Vault token couldn't be renewed
+	TokenRenewalFailed TokenEventType = "renewal_failed"
+	// TokenReauthenticated is emitted when a new Vault token is received after the previous one expired
+	TokenReauthenticated TokenEventType = "reauthenticated"
+	// TokenRevoked is emitted when the Vault token of the client has been revoked
+	TokenRevoked TokenEventType = "revoked"
+)
+
+// TokenEvent describes a change in the lifecycle of the client's Vault token.
+type TokenEvent struct {
+	Type TokenEventType
+	// Secret is the login or renewal response, it is nil for failures and revocation
+	Secret *vaultapi.Secret
+	// Err is set for TokenRenewalFailed events
+	Err error
+}
+
+// TokenHook receives the token lifecycle events of a client, for example to emit
+// metrics or to invalidate secret caches when the identity changes.
+// Hooks are called synchronously from the token renewal goroutine, so they should not block.
+type TokenHook interface {
+	OnTokenEvent(event TokenEvent)
+}
+
+// TokenHookFunc is an adapter to use ordinary functions as TokenHooks.
+type TokenHookFunc func(event TokenEvent)
+
+// OnTokenEvent calls f(event).
+func (f TokenHookFunc) OnTokenEvent(event TokenEvent) {
+	f(event)
+}
+
+// ClientTokenHooks are called on the token lifecycle events of the client.
+type ClientTokenHooks []TokenHook
+
+func (co ClientTokenHooks) apply(o *clientOptions) {
+	o.tokenHooks = append(o.tokenHooks, co...)
+}
+
+func (client *Client) emitTokenEvent(event TokenEvent) {
+	for _, hook := range client.tokenHooks {
+		hook.OnTokenEvent(event)
+	}
+}
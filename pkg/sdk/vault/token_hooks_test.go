@@ -0,0 +1,119 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+type recordedTokenEvents struct {
+	mu     sync.Mutex
+	events []TokenEvent
+}
+
+func (r *recordedTokenEvents) OnTokenEvent(event TokenEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordedTokenEvents) types() []TokenEventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []TokenEventType
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestTokenHooks(t *testing.T) {
+	var mu sync.Mutex
+	var renewals int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /v1/auth/approle/login":
+			_, _ = w.Write([]byte(`{"auth": {"client_token": "s.token", "renewable": true, "lease_duration": 1}}`))
+		case "PUT /v1/auth/token/renew-self":
+			mu.Lock()
+			renewals++
+			first := renewals == 1
+			mu.Unlock()
+			if !first {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth": {"client_token": "s.token", "renewable": true, "lease_duration": 1}}`))
+		case "POST /v1/auth/token/revoke-self", "PUT /v1/auth/token/revoke-self":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	events := &recordedTokenEvents{}
+	client, err := NewClientFromConfig(config, ClientRole("app"), ClientAppRole{RoleID: "role-id", SecretID: "secret-id"}, ClientTokenHooks{events})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		types := events.types()
+		if len(types) > 0 && types[len(types)-1] == TokenRenewalFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the renewal failure, events: %v", types)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if err := client.RevokeToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TokenEventType{TokenLoggedIn, TokenRenewed, TokenRenewalFailed, TokenRevoked}
+	types := events.types()
+	if len(types) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("expected events %v, got %v", expected, types)
+			break
+		}
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if events.events[0].Secret == nil || events.events[0].Secret.Auth.ClientToken != "s.token" {
+		t.Error("the login event should carry the login response")
+	}
+	if events.events[2].Err == nil {
+		t.Error("the renewal failure event should carry the error")
+	}
+}
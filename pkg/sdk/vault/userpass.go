@@ -0,0 +1,225 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	json "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// Defaults of the token TTLs of break-glass userpass accounts, to keep emergency access short lived
+const (
+	breakGlassDefaultTokenTTL    = "15m"
+	breakGlassDefaultTokenMaxTTL = "1h"
+)
+
+// userpassRotation is the password rotation record of a break-glass account, kept in the key store
+type userpassRotation struct {
+	Fingerprint string    `json:"fingerprint"`
+	RotatedAt   time.Time `json:"rotatedAt"`
+}
+
+// resolvePasswordRef returns the password referenced by "env:NAME" or "file:/path"
+func resolvePasswordRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		password, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+		return password, nil
+	case strings.HasPrefix(ref, "file:"):
+		path := strings.TrimPrefix(ref, "file:")
+		password, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading password file %s", path)
+		}
+		return strings.TrimRight(string(password), "\r\n"), nil
+	default:
+		return "", errors.Errorf("unsupported password reference %q, use env:NAME or file:/path", ref)
+	}
+}
+
+func userpassRotationKey(path, username string) string {
+	return fmt.Sprintf("vault-userpass-%s-%s", strings.ReplaceAll(path, "/", "-"), username)
+}
+
+// userpassFingerprintKey is the key of the HMAC key of the password fingerprints in the key store
+const userpassFingerprintKey = "vault-userpass-fingerprint-key"
+
+// fingerprintKey returns the random HMAC key of the password fingerprints, generating it on first use,
+// so the fingerprints in the key store can't be brute-forced without the key
+func (v *vault) fingerprintKey() ([]byte, error) {
+	key, err := v.keyStore.Get(userpassFingerprintKey)
+	if err == nil {
+		return key, nil
+	}
+	if !isNotFoundError(err) {
+		return nil, errors.Wrap(err, "error reading the userpass fingerprint key")
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "error generating the userpass fingerprint key")
+	}
+	if err := v.keyStore.Set(userpassFingerprintKey, key); err != nil {
+		return nil, errors.Wrap(err, "error storing the userpass fingerprint key")
+	}
+
+	return key, nil
+}
+
+func passwordFingerprint(key []byte, username, password string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(username + ":" + password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// userpassUserExists checks if the user is in Vault, so one deleted out-of-band is recreated with its password
+func (v *vault) userpassUserExists(path, username string) (bool, error) {
+	secret, err := v.cl.Logical().Read(fmt.Sprintf("auth/%s/users/%s", path, username))
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading userpass user %s", username)
+	}
+	return secret != nil, nil
+}
+
+// prepareUserpassUser resolves the password reference and applies the break-glass
+// settings of a userpass user, returning the data to write into Vault and a function
+// which records the password rotation once the user has been written.
+func (v *vault) prepareUserpassUser(path string, user map[string]interface{}) (map[string]interface{}, func() error, error) {
+	noop := func() error { return nil }
+
+	username := cast.ToString(user["username"])
+
+	data := make(map[string]interface{}, len(user))
+	for k, val := range user {
+		data[k] = val
+	}
+
+	if ref, ok := data["password_ref"]; ok {
+		password, err := resolvePasswordRef(cast.ToString(ref))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error resolving password of userpass user %s", username)
+		}
+		data["password"] = password
+		delete(data, "password_ref")
+	}
+
+	breakGlass := cast.ToBool(data["break_glass"])
+	delete(data, "break_glass")
+
+	var rotationPeriod time.Duration
+	if raw, ok := data["rotation_period"]; ok {
+		var err error
+		rotationPeriod, err = cast.ToDurationE(raw)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error parsing rotation_period of userpass user %s", username)
+		}
+		delete(data, "rotation_period")
+	}
+
+	forceRotation := cast.ToBool(data["force_rotation"])
+	delete(data, "force_rotation")
+
+	if !breakGlass {
+		return data, noop, nil
+	}
+
+	if _, ok := data["token_policies"]; !ok {
+		return nil, nil, errors.Errorf("break-glass userpass user %s must have token_policies", username)
+	}
+	if _, ok := data["token_ttl"]; !ok {
+		data["token_ttl"] = breakGlassDefaultTokenTTL
+	}
+	if _, ok := data["token_max_ttl"]; !ok {
+		data["token_max_ttl"] = breakGlassDefaultTokenMaxTTL
+	}
+
+	password, ok := data["password"]
+	if !ok {
+		return data, noop, nil
+	}
+
+	hmacKey, err := v.fingerprintKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := userpassRotationKey(path, username)
+	fingerprint := passwordFingerprint(hmacKey, username, cast.ToString(password))
+
+	var rotation userpassRotation
+	raw, err := v.keyStore.Get(key)
+	if err != nil && !isNotFoundError(err) {
+		return nil, nil, errors.Wrapf(err, "error reading password rotation of userpass user %s", username)
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &rotation); err != nil {
+			return nil, nil, errors.Wrapf(err, "error parsing password rotation of userpass user %s", username)
+		}
+	}
+
+	if rotation.Fingerprint != fingerprint {
+		rotation = userpassRotation{Fingerprint: fingerprint, RotatedAt: time.Now().UTC()}
+
+		record := func() error {
+			raw, err := json.Marshal(rotation)
+			if err != nil {
+				return errors.Wrap(err, "error marshaling password rotation")
+			}
+			if err := v.keyStore.Set(key, raw); err != nil {
+				return errors.Wrapf(err, "error storing password rotation of userpass user %s", username)
+			}
+			logrus.Infof("password of break-glass userpass user %s has been rotated", username)
+			return nil
+		}
+
+		return data, record, nil
+	}
+
+	// the password is unchanged, don't reset it on every run, unless the user is missing
+	exists, err := v.userpassUserExists(path, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exists {
+		delete(data, "password")
+	}
+
+	if rotationPeriod > 0 && time.Since(rotation.RotatedAt) > rotationPeriod {
+		if forceRotation {
+			return nil, nil, errors.Errorf("password of break-glass userpass user %s was last rotated at %s, it has to be rotated every %s",
+				username, rotation.RotatedAt.Format(time.RFC3339), rotationPeriod)
+		}
+		logrus.Warnf("password of break-glass userpass user %s was last rotated at %s, it is overdue for rotation (rotation_period: %s)",
+			username, rotation.RotatedAt.Format(time.RFC3339), rotationPeriod)
+	}
+
+	return data, noop, nil
+}
@@ -0,0 +1,126 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+type notFound struct{}
+
+func (notFound) Error() string  { return "not found" }
+func (notFound) NotFound() bool { return true }
+
+type memoryKV map[string][]byte
+
+func (m memoryKV) Get(key string) ([]byte, error) {
+	if value, ok := m[key]; ok {
+		return value, nil
+	}
+	return nil, notFound{}
+}
+
+func (m memoryKV) Set(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryKV) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestPrepareBreakGlassUserpassUser(t *testing.T) {
+	os.Setenv("BREAK_GLASS_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("BREAK_GLASS_PASSWORD")
+
+	userExists := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v1/auth/userpass/users/emergency" && userExists {
+			_, _ = w.Write([]byte(`{"data": {"token_policies": ["admin"]}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	cl, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyStore := memoryKV{}
+	v := &vault{keyStore: keyStore, cl: cl}
+	user := map[string]interface{}{
+		"username":        "emergency",
+		"password_ref":    "env:BREAK_GLASS_PASSWORD",
+		"token_policies":  "admin",
+		"break_glass":     true,
+		"rotation_period": "720h",
+	}
+
+	data, recordRotation, err := v.prepareUserpassUser("userpass", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["password"] != "s3cr3t" || data["token_max_ttl"] != breakGlassDefaultTokenMaxTTL {
+		t.Fatalf("unexpected user data: %+v", data)
+	}
+	for _, key := range []string{"password_ref", "break_glass", "rotation_period"} {
+		if _, ok := data[key]; ok {
+			t.Fatalf("%s must not be written to vault", key)
+		}
+	}
+	if err := recordRotation(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotation := string(keyStore[userpassRotationKey("userpass", "emergency")])
+	if len(keyStore[userpassFingerprintKey]) != 32 || strings.Contains(rotation, passwordFingerprint(nil, "emergency", "s3cr3t")) {
+		t.Fatalf("the password fingerprint must be keyed with the random fingerprint key: %s", rotation)
+	}
+
+	// an unchanged password is not reset again
+	data, _, err = v.prepareUserpassUser("userpass", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data["password"]; ok {
+		t.Fatal("unchanged password must not be written again")
+	}
+
+	// a user deleted out-of-band is recreated with its password
+	userExists = false
+	data, _, err = v.prepareUserpassUser("userpass", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["password"] != "s3cr3t" {
+		t.Fatal("the password of a missing user must be written")
+	}
+
+	delete(user, "token_policies")
+	if _, _, err := v.prepareUserpassUser("userpass", user); err == nil {
+		t.Fatal("break-glass users without policies must be rejected")
+	}
+}
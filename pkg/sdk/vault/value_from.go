@@ -0,0 +1,238 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// ValueReference is a reference to a key of a Kubernetes Secret or ConfigMap in the external configuration,
+// it is resolved when the configuration is applied, so sensitive values don't have to be in the configuration:
+//
+//	bindpass:
+//	  valueFrom:
+//	    secretKeyRef:
+//	      name: ldap
+//	      key: password
+type ValueReference struct {
+	// Secret or ConfigMap
+	Kind string
+	Name string
+	Key  string
+}
+
+// ValueResolver resolves the value references of the external configuration
+type ValueResolver interface {
+	Resolve(ref ValueReference) (string, error)
+}
+
+// valueReferenceOf returns the reference if the value is a valueFrom reference
+func valueReferenceOf(value interface{}) (ValueReference, bool, error) {
+	m, err := cast.ToStringMapE(value)
+	if err != nil || len(m) != 1 {
+		return ValueReference{}, false, nil
+	}
+	// viper lowercases the keys of the maps it doesn't read from lists
+	var valueFrom interface{}
+	for key, value := range m {
+		if !strings.EqualFold(key, "valueFrom") {
+			return ValueReference{}, false, nil
+		}
+		valueFrom = value
+	}
+
+	refs, err := cast.ToStringMapE(valueFrom)
+	if err != nil || len(refs) != 1 {
+		return ValueReference{}, false, errors.New("valueFrom needs exactly one of secretKeyRef or configMapKeyRef") // nolint:goerr113
+	}
+
+	var ref ValueReference
+	for kind, keyRef := range refs {
+		switch strings.ToLower(kind) {
+		case "secretkeyref":
+			ref.Kind = "Secret"
+		case "configmapkeyref":
+			ref.Kind = "ConfigMap"
+		default:
+			return ValueReference{}, false, errors.Errorf("unsupported valueFrom reference: %s", kind)
+		}
+
+		selector, err := cast.ToStringMapStringE(keyRef)
+		if err != nil {
+			return ValueReference{}, false, errors.Wrapf(err, "invalid %s", kind)
+		}
+		ref.Name, ref.Key = selector["name"], selector["key"]
+		if ref.Name == "" || ref.Key == "" {
+			return ValueReference{}, false, errors.Errorf("%s needs a name and a key", kind)
+		}
+	}
+
+	return ref, true, nil
+}
+
+// resolveValueReferences returns the value with its references replaced by the resolved values, and whether it had any
+func resolveValueReferences(value interface{}, resolve func(ValueReference) (string, error)) (interface{}, bool, error) {
+	ref, ok, err := valueReferenceOf(value)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		resolved, err := resolve(ref)
+		return resolved, true, err
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		m := cast.ToStringMap(value)
+		var changed bool
+		for key, item := range m {
+			resolved, itemChanged, err := resolveValueReferences(item, resolve)
+			if err != nil {
+				return nil, false, errors.Wrap(err, key)
+			}
+			if itemChanged {
+				m[key] = resolved
+				changed = true
+			}
+		}
+		if changed {
+			return m, true, nil
+		}
+	case []interface{}:
+		var changed bool
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved, itemChanged, err := resolveValueReferences(item, resolve)
+			if err != nil {
+				return nil, false, err
+			}
+			items[i] = resolved
+			changed = changed || itemChanged
+		}
+		if changed {
+			return items, true, nil
+		}
+	}
+
+	return value, false, nil
+}
+
+// ValueReferences returns the distinct value references of the external configuration, sorted by kind and name
+func ValueReferences(config interface{}) ([]ValueReference, error) {
+	found := map[ValueReference]bool{}
+	_, _, err := resolveValueReferences(config, func(ref ValueReference) (string, error) {
+		found[ref] = true
+		return "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]ValueReference, 0, len(found))
+	for ref := range found {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind < refs[j].Kind
+		}
+		if refs[i].Name != refs[j].Name {
+			return refs[i].Name < refs[j].Name
+		}
+		return refs[i].Key < refs[j].Key
+	})
+	return refs, nil
+}
+
+// kubernetesValueResolver reads the references from the namespace of the Vault (the NAMESPACE environment variable)
+type kubernetesValueResolver struct {
+	once      sync.Once
+	client    crclient.Client
+	err       error
+	namespace string
+}
+
+func (r *kubernetesValueResolver) Resolve(ref ValueReference) (string, error) {
+	r.once.Do(func() {
+		r.namespace = os.Getenv("NAMESPACE")
+
+		k8sCfg, err := crconfig.GetConfig()
+		if err != nil {
+			r.err = errors.Wrap(err, "error creating k8s config")
+			return
+		}
+		r.client, r.err = crclient.New(k8sCfg, crclient.Options{})
+	})
+	if r.err != nil {
+		return "", r.err
+	}
+
+	key := crclient.ObjectKey{Namespace: r.namespace, Name: ref.Name}
+
+	switch ref.Kind {
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.client.Get(context.Background(), key, secret); err != nil {
+			return "", errors.Wrapf(err, "error getting secret '%s'", ref.Name)
+		}
+		if value, ok := secret.Data[ref.Key]; ok {
+			return string(value), nil
+		}
+	case "ConfigMap":
+		configMap := &corev1.ConfigMap{}
+		if err := r.client.Get(context.Background(), key, configMap); err != nil {
+			return "", errors.Wrapf(err, "error getting configmap '%s'", ref.Name)
+		}
+		if value, ok := configMap.Data[ref.Key]; ok {
+			return value, nil
+		}
+		if value, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(value), nil
+		}
+	}
+
+	return "", errors.Errorf("key '%s' not found in %s '%s'", ref.Key, ref.Kind, ref.Name)
+}
+
+// resolveConfigValueReferences replaces the value references of the configuration sections with the resolved values
+func (v *vault) resolveConfigValueReferences(config *viper.Viper) error {
+	resolver := v.config.ValueResolver
+	if resolver == nil {
+		resolver = &kubernetesValueResolver{}
+	}
+
+	for section, value := range config.AllSettings() {
+		resolved, changed, err := resolveValueReferences(value, resolver.Resolve)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving value references of %s", section)
+		}
+		if changed {
+			config.Set(section, resolved)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type staticValueResolver map[ValueReference]string
+
+func (r staticValueResolver) Resolve(ref ValueReference) (string, error) {
+	return r[ref], nil
+}
+
+const valueFromConfig = `
+auth:
+  - type: ldap
+    config:
+      binddn: cn=vault,ou=Users,dc=example,dc=com
+      bindpass:
+        valueFrom:
+          secretKeyRef:
+            name: ldap
+            key: password
+      url:
+        valueFrom:
+          configMapKeyRef:
+            name: ldap
+            key: url
+`
+
+func TestResolveConfigValueReferences(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	if err := config.ReadConfig(bytes.NewBufferString(valueFromConfig)); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := ValueReferences(config.AllSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRefs := []ValueReference{
+		{Kind: "ConfigMap", Name: "ldap", Key: "url"},
+		{Kind: "Secret", Name: "ldap", Key: "password"},
+	}
+	if !reflect.DeepEqual(refs, expectedRefs) {
+		t.Errorf("unexpected references: %v", refs)
+	}
+
+	v := &vault{config: &Config{ValueResolver: staticValueResolver{
+		{Kind: "Secret", Name: "ldap", Key: "password"}: "secret",
+		{Kind: "ConfigMap", Name: "ldap", Key: "url"}:   "ldaps://ldap.example.com",
+	}}}
+
+	if err := v.resolveConfigValueReferences(config); err != nil {
+		t.Fatal(err)
+	}
+
+	var authMethods []map[string]interface{}
+	if err := config.UnmarshalKey("auth", &authMethods); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"binddn":   "cn=vault,ou=Users,dc=example,dc=com",
+		"bindpass": "secret",
+		"url":      "ldaps://ldap.example.com",
+	}
+	if got := authMethods[0]["config"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected config: %v", got)
+	}
+}
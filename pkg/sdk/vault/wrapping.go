@@ -0,0 +1,142 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	vaultapi "github.com/hashicorp/vault/api"
+	json "github.com/json-iterator/go"
+	"github.com/spf13/cast"
+)
+
+// WrappingValidation describes the expected properties of a response wrapping token,
+// an unexpected token may have been substituted by an attacker to intercept the unwrapped secret.
+// ref: https://www.vaultproject.io/docs/concepts/response-wrapping#response-wrapping-token-validation
+type WrappingValidation struct {
+	// CreationPath is the API path the wrapping token has to be created at, path.Match patterns are supported
+	CreationPath string
+	// MaxTTL is the longest allowed TTL of the wrapping token, no limit is enforced if 0
+	MaxTTL time.Duration
+}
+
+// LookupWrappingToken returns the wrap info of the token as known by Vault, it fails if the
+// token doesn't exist, for example because it has already been unwrapped by someone else.
+// ref: https://www.vaultproject.io/api/system/wrapping-lookup
+func LookupWrappingToken(client *vaultapi.Client, token string) (*vaultapi.SecretWrapInfo, error) {
+	secret, err := client.Logical().Write("sys/wrapping/lookup", map[string]interface{}{"token": token})
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking up wrapping token")
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("empty response while looking up wrapping token")
+	}
+
+	creationTime, err := time.Parse(time.RFC3339Nano, cast.ToString(secret.Data["creation_time"]))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing creation time of wrapping token")
+	}
+
+	// the numbers are decoded as json.Number by the Vault client
+	return &vaultapi.SecretWrapInfo{
+		Token:        token,
+		TTL:          cast.ToInt(cast.ToString(secret.Data["creation_ttl"])),
+		CreationTime: creationTime,
+		CreationPath: cast.ToString(secret.Data["creation_path"]),
+	}, nil
+}
+
+// ValidateWrappingToken checks the creation path and TTL of the wrapping token with Vault before it gets unwrapped.
+func ValidateWrappingToken(client *vaultapi.Client, token string, validation WrappingValidation) (*vaultapi.SecretWrapInfo, error) {
+	info, err := LookupWrappingToken(client, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if validation.CreationPath != "" {
+		match, err := path.Match(strings.Trim(validation.CreationPath, "/"), strings.Trim(info.CreationPath, "/"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid wrapping token creation path pattern %q", validation.CreationPath)
+		}
+		if !match {
+			return nil, errors.Errorf("wrapping token was created at %q instead of %q", info.CreationPath, validation.CreationPath)
+		}
+	}
+
+	if validation.MaxTTL > 0 && time.Duration(info.TTL)*time.Second > validation.MaxTTL {
+		return nil, errors.Errorf("wrapping token TTL %ds is longer than the allowed %s", info.TTL, validation.MaxTTL)
+	}
+
+	return info, nil
+}
+
+// UnwrapValidated validates the wrapping token and unwraps the secret in it.
+func UnwrapValidated(client *vaultapi.Client, token string, validation WrappingValidation) (*vaultapi.Secret, error) {
+	if _, err := ValidateWrappingToken(client, token, validation); err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Unwrap(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unwrapping secret")
+	}
+	if secret == nil {
+		return nil, errors.New("empty response while unwrapping secret")
+	}
+
+	return secret, nil
+}
+
+// ReadWrappedTokenSink reads a response wrapped Vault token from a token sink file (for example
+// written by Vault Agent with wrap_ttl set), verifies that the wrap info in the sink matches the
+// one known by Vault and the validation, then unwraps the token.
+// ref: https://www.vaultproject.io/docs/agent/autoauth#response-wrapping-tokens
+func ReadWrappedTokenSink(client *vaultapi.Client, sinkPath string, validation WrappingValidation) (string, error) {
+	raw, err := ioutil.ReadFile(sinkPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading token sink %s", sinkPath)
+	}
+
+	var sink vaultapi.SecretWrapInfo
+	if err := json.Unmarshal(raw, &sink); err != nil {
+		return "", errors.Wrapf(err, "error parsing wrapped token sink %s", sinkPath)
+	}
+	if sink.Token == "" {
+		return "", errors.Errorf("token sink %s doesn't contain a wrapping token", sinkPath)
+	}
+
+	info, err := ValidateWrappingToken(client, sink.Token, validation)
+	if err != nil {
+		return "", err
+	}
+
+	if sink.CreationPath != "" && sink.CreationPath != info.CreationPath {
+		return "", errors.Errorf("wrapping token in sink %s was created at %q, but Vault knows it from %q", sinkPath, sink.CreationPath, info.CreationPath)
+	}
+
+	secret, err := client.Logical().Unwrap(sink.Token)
+	if err != nil {
+		return "", errors.Wrapf(err, "error unwrapping token from sink %s", sinkPath)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", errors.Errorf("wrapping token in sink %s doesn't wrap a Vault token", sinkPath)
+	}
+
+	return secret.Auth.ClientToken, nil
+}
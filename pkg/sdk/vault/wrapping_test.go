@@ -0,0 +1,116 @@
+// Copyright © 2020 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// newTestWrappingServer serves wrapping tokens created at the given paths, each wrapping a secret_id
+func newTestWrappingServer(tokens map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		token, _ := body["token"].(string)
+		if token == "" {
+			token = r.Header.Get("X-Vault-Token")
+		}
+
+		var response map[string]interface{}
+		switch r.URL.Path {
+		case "/v1/sys/wrapping/lookup":
+			response = map[string]interface{}{"data": map[string]interface{}{
+				"creation_path": tokens[token],
+				"creation_ttl":  120,
+				"creation_time": time.Now().Format(time.RFC3339Nano),
+			}}
+		case "/v1/sys/wrapping/unwrap":
+			response = map[string]interface{}{"data": map[string]interface{}{"secret_id": "secret-id-of-" + token}}
+		case "/v1/auth/approle/login":
+			response = map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.logged-in-with-" + body["secret_id"].(string)}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestUnwrapValidated(t *testing.T) {
+	server := newTestWrappingServer(map[string]string{
+		"s.wrapped":     "auth/approle/role/app/secret-id",
+		"s.substituted": "sys/wrapping/wrap",
+	})
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+	client, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validation := WrappingValidation{CreationPath: "auth/approle/role/*/secret-id", MaxTTL: 5 * time.Minute}
+
+	secret, err := UnwrapValidated(client, "s.wrapped", validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["secret_id"] != "secret-id-of-s.wrapped" {
+		t.Errorf("unexpected secret_id: %v", secret.Data["secret_id"])
+	}
+
+	if _, err := UnwrapValidated(client, "s.substituted", validation); err == nil {
+		t.Error("a wrapping token created at an unexpected path must be rejected")
+	}
+
+	if _, err := UnwrapValidated(client, "s.wrapped", WrappingValidation{MaxTTL: time.Minute}); err == nil {
+		t.Error("a wrapping token with a too long TTL must be rejected")
+	}
+}
+
+func TestClientAppRoleWrappedSecretID(t *testing.T) {
+	server := newTestWrappingServer(map[string]string{
+		"s.wrapped":     "auth/approle/role/app/secret-id",
+		"s.substituted": "auth/approle/role/admin/secret-id",
+	})
+	defer server.Close()
+
+	config := vaultapi.DefaultConfig()
+	config.Address = server.URL
+
+	client, err := NewClientFromConfig(config, ClientRole("app"), ClientAppRole{RoleID: "role-id", WrappedSecretID: "s.wrapped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if token := client.RawClient().Token(); token != "s.logged-in-with-secret-id-of-s.wrapped" {
+		t.Errorf("unexpected token: %s", token)
+	}
+
+	_, err = NewClientFromConfig(config, ClientRole("app"), ClientAppRole{RoleID: "role-id", WrappedSecretID: "s.substituted"})
+	if err == nil {
+		t.Error("a secret_id wrapped for another role must be rejected")
+	}
+}